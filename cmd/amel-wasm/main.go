@@ -0,0 +1,24 @@
+//go:build js && wasm
+
+// Command amel-wasm is the WebAssembly build of the AMEL engine. It installs a
+// global "amel" object in the JavaScript host and keeps running so the object
+// stays callable. See package wasm for usage.
+package main
+
+import (
+	"fmt"
+
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/bencagri/amel/pkg/wasm"
+)
+
+func main() {
+	eng, err := engine.New(engine.WithCaching(true))
+	if err != nil {
+		fmt.Println("amel:", err)
+		return
+	}
+
+	wasm.New(eng).Register("amel")
+	select {}
+}
@@ -0,0 +1,16 @@
+//go:build !(js && wasm)
+
+// Command amel-wasm is the WebAssembly build of the AMEL engine. It installs a
+// global "amel" object in the JavaScript host and keeps running so the object
+// stays callable. See package wasm for usage.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "amel-wasm must be built with GOOS=js GOARCH=wasm")
+	os.Exit(2)
+}
@@ -0,0 +1,558 @@
+// Command amel evaluates, checks, formats, lints, compiles, and tests AMEL expressions.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/compiler"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/format"
+	"github.com/bencagri/amel/pkg/lint"
+	"github.com/bencagri/amel/pkg/lsp"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/rulefile"
+	"github.com/bencagri/amel/pkg/ruletest"
+)
+
+// fail reports an error and returns the failure exit code.
+func fail(e *env, err error) int {
+	fmt.Fprintf(e.stderr, "amel: %v\n", err)
+	return exitFailure
+}
+
+// parseFlags parses the flags of a command, returning false with the exit code
+// to use if parsing stopped.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return 0, true
+}
+
+// runEval implements "amel eval".
+func runEval(e *env, args []string) int {
+	var in inputFlags
+	fs := newFlagSet(e, "eval", "[file]")
+	in.exprFlag(fs)
+	in.payloadFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	src, err := in.single(e, fs.Args())
+	if err != nil {
+		return fail(e, err)
+	}
+	payload, err := in.readPayload(e)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	eng, err := engine.New()
+	if err != nil {
+		return fail(e, err)
+	}
+	resp := eng.EvaluateRequest(&engine.EvalRequest{DSL: src.text, Payload: payload})
+	if resp.Error != "" {
+		return fail(e, fmt.Errorf("%s: %s", src.name, resp.Error))
+	}
+
+	return writeJSON(e, resp)
+}
+
+// runCheck implements "amel check".
+func runCheck(e *env, args []string) int {
+	var in inputFlags
+	fs := newFlagSet(e, "check", "[file ...]")
+	in.exprFlag(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	sources, err := in.sources(e, fs.Args())
+	if err != nil {
+		return fail(e, err)
+	}
+
+	code := exitOK
+	for _, src := range sources {
+		if _, err := parser.Parse(src.text); err != nil {
+			fmt.Fprintf(e.stdout, "%s: %v\n", src.name, err)
+			code = exitFailure
+			continue
+		}
+		fmt.Fprintf(e.stdout, "%s: ok\n", src.name)
+	}
+	return code
+}
+
+// runFmt implements "amel fmt".
+func runFmt(e *env, args []string) int {
+	var in inputFlags
+	fs := newFlagSet(e, "fmt", "[file ...]")
+	in.exprFlag(fs)
+	write := fs.Bool("w", false, "write the result to the source files instead of standard output")
+	list := fs.Bool("l", false, "list files whose formatting differs from the canonical form")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	sources, err := in.sources(e, fs.Args())
+	if err != nil {
+		return fail(e, err)
+	}
+
+	code := exitOK
+	for _, src := range sources {
+		formatted, err := format.Source(src.text)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "%s: %v\n", src.name, err)
+			code = exitFailure
+			continue
+		}
+
+		changed := strings.TrimSpace(src.text) != formatted
+		switch {
+		case *list:
+			if changed {
+				fmt.Fprintln(e.stdout, src.name)
+			}
+		case *write && src.name != stdinName && src.name != "<expr>":
+			if changed {
+				if err := os.WriteFile(src.name, []byte(formatted+"\n"), 0o644); err != nil {
+					return fail(e, err)
+				}
+			}
+		default:
+			fmt.Fprintln(e.stdout, formatted)
+		}
+	}
+	return code
+}
+
+// runLint implements "amel lint".
+func runLint(e *env, args []string) int {
+	var in inputFlags
+	fs := newFlagSet(e, "lint", "[file ...]")
+	in.exprFlag(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	sources, err := in.sources(e, fs.Args())
+	if err != nil {
+		return fail(e, err)
+	}
+
+	eng, err := engine.New()
+	if err != nil {
+		return fail(e, err)
+	}
+	linter := lint.New(lint.WithFunctions(eng.GetFunctionRegistry()))
+
+	code := exitOK
+	for _, src := range sources {
+		issues, err := linter.LintSource(src.text)
+		if err != nil {
+			fmt.Fprintf(e.stdout, "%s: %v\n", src.name, err)
+			code = exitFailure
+			continue
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(e.stdout, "%s:%s\n", src.name, issue)
+			code = exitFailure
+		}
+	}
+	return code
+}
+
+// runExternalize implements "amel externalize".
+func runExternalize(e *env, args []string) int {
+	var in inputFlags
+	fs := newFlagSet(e, "externalize", "[file]")
+	in.exprFlag(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	src, err := in.single(e, fs.Args())
+	if err != nil {
+		return fail(e, err)
+	}
+	ext, err := format.ExternalizeSource(src.text)
+	if err != nil {
+		return fail(e, fmt.Errorf("%s: %v", src.name, err))
+	}
+	return writeJSON(e, ext)
+}
+
+// runCompile implements "amel compile".
+func runCompile(e *env, args []string) int {
+	var in inputFlags
+	fs := newFlagSet(e, "compile", "[file]")
+	in.exprFlag(fs)
+	target := fs.String("target", "sql", "compilation target: sql, mongo, painless, or redisearch")
+	dialect := fs.String("dialect", "standard", "SQL dialect: standard, postgres, mysql, or sqlite")
+	trace := fs.Bool("trace", false, "report which part of the expression produced each part of the output")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	src, err := in.single(e, fs.Args())
+	if err != nil {
+		return fail(e, err)
+	}
+	expr, err := parser.Parse(src.text)
+	if err != nil {
+		return fail(e, fmt.Errorf("%s: %w", src.name, err))
+	}
+
+	switch *target {
+	case "sql":
+		d, ok := sqlDialects[*dialect]
+		if !ok {
+			return fail(e, fmt.Errorf("unknown SQL dialect %q", *dialect))
+		}
+		result, err := compiler.CompileToSQL(expr, compiler.WithDialect(d), compiler.WithSQLTrace(*trace))
+		if err != nil {
+			return fail(e, err)
+		}
+		// Print the clause followed by its parameters and trace as SQL comments
+		params, err := json.Marshal(result.Params)
+		if err != nil {
+			return fail(e, err)
+		}
+		fmt.Fprintln(e.stdout, result.SQL)
+		fmt.Fprintf(e.stdout, "-- params: %s\n", params)
+		for _, entry := range result.Trace {
+			fmt.Fprintf(e.stdout, "-- %d:%d-%d:%d %s => %s\n", entry.Span.Line, entry.Span.Column,
+				entry.Span.EndLine, entry.Span.EndColumn, entry.Expression, entry.Fragment)
+		}
+		return exitOK
+
+	case "mongo", "mongodb":
+		result, err := compiler.NewMongoDBCompiler(compiler.WithMongoTrace(*trace)).Compile(expr)
+		if err != nil {
+			return fail(e, err)
+		}
+		if *trace {
+			return writeJSON(e, map[string]interface{}{"query": result.Query, "trace": result.Trace})
+		}
+		return writeJSON(e, result.Query)
+
+	case "painless":
+		result, err := compiler.NewPainlessCompiler(compiler.WithPainlessTrace(*trace)).Compile(expr)
+		if err != nil {
+			return fail(e, err)
+		}
+		if *trace {
+			return writeJSON(e, map[string]interface{}{"script": result.Script(), "trace": result.Trace})
+		}
+		return writeJSON(e, result.Script())
+
+	case "redisearch":
+		result, err := compiler.NewRediSearchCompiler(compiler.WithRediSearchTrace(*trace)).Compile(expr)
+		if err != nil {
+			return fail(e, err)
+		}
+		if *trace {
+			return writeJSON(e, map[string]interface{}{"query": result.Query, "trace": result.Trace})
+		}
+		// The query as is, to paste into FT.SEARCH
+		fmt.Fprintln(e.stdout, result.Query)
+		return exitOK
+
+	default:
+		return fail(e, fmt.Errorf("unknown target %q (want sql, mongo, painless, or redisearch)", *target))
+	}
+}
+
+var sqlDialects = map[string]compiler.SQLDialect{
+	"standard": compiler.DialectStandard,
+	"postgres": compiler.DialectPostgres,
+	"mysql":    compiler.DialectMySQL,
+	"sqlite":   compiler.DialectSQLite,
+}
+
+// runExplain implements "amel explain".
+func runExplain(e *env, args []string) int {
+	var in inputFlags
+	fs := newFlagSet(e, "explain", "[file]")
+	in.exprFlag(fs)
+	in.payloadFlags(fs)
+	asJSON := fs.Bool("json", false, "print the explanation as JSON")
+	failures := fs.Bool("failures", false, "print only the clauses that kept the expression from matching")
+	suggest := fs.Bool("suggest", false, "print the payload changes that would make the expression match")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	src, err := in.single(e, fs.Args())
+	if err != nil {
+		return fail(e, err)
+	}
+	payload, err := in.readPayload(e)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	eng, err := engine.New()
+	if err != nil {
+		return fail(e, err)
+	}
+	if *failures || *suggest {
+		return writeFailures(e, eng, src, payload, *suggest, *asJSON)
+	}
+	resp := eng.ExplainRequest(&engine.EvalRequest{DSL: src.text, Payload: payload})
+	if resp.Error != "" {
+		return fail(e, fmt.Errorf("%s: %s", src.name, resp.Error))
+	}
+
+	if *asJSON {
+		return writeJSON(e, resp)
+	}
+	writeExplanation(e, resp.Explanation, 0)
+	return exitOK
+}
+
+// writeFailures prints the clauses that kept an expression from matching, or
+// the changes that would make it match if suggest is true, one message per
+// line. It prints nothing if the expression matched.
+func writeFailures(e *env, eng *engine.Engine, src source, payload interface{}, suggest, asJSON bool) int {
+	compiled, err := eng.Compile(src.text)
+	if err != nil {
+		return fail(e, fmt.Errorf("%s: %v", src.name, err))
+	}
+
+	var messages []string
+	var result interface{}
+	if suggest {
+		suggestions, err := eng.SuggestChanges(compiled, payload)
+		if err != nil {
+			return fail(e, fmt.Errorf("%s: %v", src.name, err))
+		}
+		for _, s := range suggestions {
+			messages = append(messages, s.Message)
+		}
+		if suggestions == nil {
+			suggestions = []engine.Suggestion{}
+		}
+		result = suggestions
+	} else {
+		failed, err := eng.ExplainFailure(compiled, payload)
+		if err != nil {
+			return fail(e, fmt.Errorf("%s: %v", src.name, err))
+		}
+		for _, f := range failed {
+			messages = append(messages, f.Message)
+		}
+		if failed == nil {
+			failed = []engine.FailedClause{}
+		}
+		result = failed
+	}
+
+	if asJSON {
+		return writeJSON(e, result)
+	}
+	for _, message := range messages {
+		fmt.Fprintln(e.stdout, message)
+	}
+	return exitOK
+}
+
+// runImpact implements "amel impact".
+func runImpact(e *env, args []string) int {
+	var in inputFlags
+	fs := newFlagSet(e, "impact", "[file]")
+	in.exprFlag(fs)
+	corpus := fs.String("corpus", "", `payload corpus file as a JSON array or JSON Lines, or "-" for standard input`)
+	baseline := fs.String("baseline", "", "current version of the rule to compare with")
+	examples := fs.Int("examples", engine.DefaultImpactExamples, "maximum number of example records per change direction")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *corpus == "" {
+		return fail(e, fmt.Errorf("-corpus is required"))
+	}
+
+	in.payload = *corpus // Rejects reading both the expression and the corpus from standard input
+	src, err := in.single(e, fs.Args())
+	if err != nil {
+		return fail(e, err)
+	}
+	payloads, err := readCorpus(e, *corpus)
+	if err != nil {
+		return fail(e, err)
+	}
+
+	eng, err := engine.New()
+	if err != nil {
+		return fail(e, err)
+	}
+	opts := []engine.ImpactOption{engine.ImpactExamples(*examples)}
+	if *baseline != "" {
+		opts = append(opts, engine.ImpactBaseline(*baseline))
+	}
+	report, err := eng.Impact(src.text, payloads, opts...)
+	if err != nil {
+		return fail(e, fmt.Errorf("%s: %w", src.name, err))
+	}
+	return writeJSON(e, report)
+}
+
+// runTest implements "amel test".
+func runTest(e *env, args []string) int {
+	fs := newFlagSet(e, "test", "file|dir ...")
+	rules := fs.String("rules", "", "directory of rule files providing the rules named by suites")
+	verbose := fs.Bool("v", false, "also list the cases that pass")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var suites []ruletest.Suite
+	for _, name := range fs.Args() {
+		loaded, err := loadSuites(name)
+		if err != nil {
+			return fail(e, err)
+		}
+		suites = append(suites, loaded...)
+	}
+
+	eng, err := engine.New()
+	if err != nil {
+		return fail(e, err)
+	}
+	var opts []ruletest.Option
+	if *rules != "" {
+		defs, err := rulefile.Load(os.DirFS(*rules))
+		if err != nil {
+			return fail(e, err)
+		}
+		rs, err := rulefile.Build(eng, defs)
+		if err != nil {
+			return fail(e, err)
+		}
+		opts = append(opts, ruletest.WithRules(rs))
+	}
+
+	report := ruletest.NewRunner(eng, opts...).Run(suites...)
+	if *asJSON {
+		if code := writeJSON(e, report); code != exitOK {
+			return code
+		}
+	} else {
+		for _, result := range report.Results {
+			switch {
+			case !result.Passed:
+				fmt.Fprintf(e.stdout, "--- FAIL: %s/%s (%s)\n    %s\n", result.Suite, result.Case, result.Source, result.Failure)
+			case *verbose:
+				fmt.Fprintf(e.stdout, "--- PASS: %s/%s\n", result.Suite, result.Case)
+			}
+		}
+		status := "PASS"
+		if !report.OK() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(e.stdout, "%s: %d passed, %d failed\n", status, report.Passed, report.Failed)
+	}
+
+	if !report.OK() {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// loadSuites reads the test suites of a file, or of every JSON and YAML file
+// in a directory.
+func loadSuites(name string) ([]ruletest.Suite, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		suites, err := ruletest.Load(os.DirFS(name))
+		if err != nil {
+			return nil, err
+		}
+		for i := range suites {
+			suites[i].Source = filepath.Join(name, suites[i].Source)
+		}
+		return suites, nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	format, _ := rulefile.FormatFromPath(name)
+	suites, err := ruletest.Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	for i := range suites {
+		suites[i].Source = name
+	}
+	return suites, nil
+}
+
+// runLSP implements "amel lsp".
+func runLSP(e *env, args []string) int {
+	fs := newFlagSet(e, "lsp", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	eng, err := engine.New()
+	if err != nil {
+		return fail(e, err)
+	}
+	if err := lsp.NewServer(eng).Serve(context.Background(), e.stdin, e.stdout); err != nil {
+		return fail(e, err)
+	}
+	return exitOK
+}
+
+// writeExplanation prints an explanation tree, one step per line.
+func writeExplanation(e *env, exp *eval.Explanation, depth int) {
+	if exp == nil {
+		return
+	}
+
+	result, _ := json.Marshal(exp.Result.Raw)
+	line := fmt.Sprintf("%s%s => %s", strings.Repeat("  ", depth), exp.Expression, result)
+	if exp.Reason != "" {
+		line += "  (" + exp.Reason + ")"
+	}
+	fmt.Fprintln(e.stdout, line)
+
+	for _, child := range exp.Children {
+		writeExplanation(e, child, depth+1)
+	}
+}
+
+// writeJSON prints v as indented JSON.
+func writeJSON(e *env, v interface{}) int {
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fail(e, err)
+	}
+	return exitOK
+}
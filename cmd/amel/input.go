@@ -0,0 +1,159 @@
+// Command amel evaluates, checks, formats, lints, compiles, and tests AMEL expressions.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const stdinName = "<stdin>"
+
+// source is an expression read from the command line, a file, or standard input.
+type source struct {
+	name string
+	text string
+}
+
+// inputFlags are the flags shared by commands that read expressions.
+type inputFlags struct {
+	expr    string
+	payload string
+	data    string
+}
+
+// newFlagSet creates a flag set for a command that writes errors and usage to stderr.
+func newFlagSet(e *env, name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: amel %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// exprFlag registers the -e flag.
+func (f *inputFlags) exprFlag(fs *flag.FlagSet) {
+	fs.StringVar(&f.expr, "e", "", "expression to process instead of reading files or standard input")
+}
+
+// payloadFlags registers the -p and -d flags.
+func (f *inputFlags) payloadFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.payload, "p", "", `JSON payload file, or "-" for standard input`)
+	fs.StringVar(&f.data, "d", "", "inline JSON payload")
+}
+
+// sources returns the expressions to process: the -e flag, the named files, or
+// standard input, in that order of preference.
+func (f *inputFlags) sources(e *env, files []string) ([]source, error) {
+	if f.expr != "" {
+		if len(files) > 0 {
+			return nil, fmt.Errorf("cannot combine -e with file arguments")
+		}
+		return []source{{name: "<expr>", text: f.expr}}, nil
+	}
+
+	if len(files) == 0 {
+		if f.payload == "-" {
+			return nil, fmt.Errorf("cannot read both the expression and the payload from standard input")
+		}
+		data, err := io.ReadAll(e.stdin)
+		if err != nil {
+			return nil, err
+		}
+		return []source{{name: stdinName, text: string(data)}}, nil
+	}
+
+	sources := make([]source, 0, len(files))
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{name: name, text: string(data)})
+	}
+	return sources, nil
+}
+
+// single returns the only expression to process, for commands that take one.
+func (f *inputFlags) single(e *env, files []string) (source, error) {
+	if len(files) > 1 {
+		return source{}, fmt.Errorf("expected a single expression file, got %d", len(files))
+	}
+	sources, err := f.sources(e, files)
+	if err != nil {
+		return source{}, err
+	}
+	return sources[0], nil
+}
+
+// readPayload returns the payload as a JSON document, or nil if none was given.
+func (f *inputFlags) readPayload(e *env) (interface{}, error) {
+	var data []byte
+	switch {
+	case f.data != "" && f.payload != "":
+		return nil, fmt.Errorf("cannot combine -d with -p")
+	case f.data != "":
+		data = []byte(f.data)
+	case f.payload == "-":
+		var err error
+		if data, err = io.ReadAll(e.stdin); err != nil {
+			return nil, err
+		}
+	case f.payload != "":
+		var err error
+		if data, err = os.ReadFile(f.payload); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("payload is not valid JSON")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readCorpus reads the payloads of a corpus file, or of standard input if name
+// is "-". The corpus is a JSON array of payloads or one payload per line.
+func readCorpus(e *env, name string) ([]interface{}, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(e.stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var payloads []interface{}
+		if err := json.Unmarshal(trimmed, &payloads); err != nil {
+			return nil, fmt.Errorf("corpus is not a valid JSON array: %w", err)
+		}
+		return payloads, nil
+	}
+
+	var payloads []interface{}
+	for i, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var payload interface{}
+		if err := json.Unmarshal(line, &payload); err != nil {
+			return nil, fmt.Errorf("corpus line %d is not valid JSON: %w", i+1, err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
@@ -0,0 +1,104 @@
+// Command amel evaluates, checks, formats, lints, compiles, and tests AMEL expressions.
+//
+// Usage:
+//
+//	amel <command> [flags] [file ...]
+//
+// The commands are:
+//
+//	eval        evaluate an expression against a payload
+//	check       report syntax errors
+//	fmt         print expressions in canonical form
+//	lint        report suspicious constructs
+//	externalize replace the constants of an expression with named parameters
+//	compile     compile an expression to a SQL WHERE clause, MongoDB query, Painless script, or RediSearch query
+//	explain     evaluate an expression and print the explanation tree
+//	impact      report how a rule or rule change matches a corpus of payloads
+//	test        run rule test suites
+//	lsp         run the language server on standard input and output
+//
+// Expressions are read from -e, from the named files, or from standard input.
+// Payloads are read from -p (a file, or "-" for standard input) or given inline
+// with -d. The impact command reads a corpus of payloads from -corpus, as a
+// JSON array or JSON Lines. The test command reads test suites from the named
+// JSON and YAML files and directories.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit codes
+const (
+	exitOK      = 0
+	exitFailure = 1 // evaluation failed, syntax errors, lint issues, or failed tests
+	exitUsage   = 2
+)
+
+// command is an amel subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(env *env, args []string) int
+}
+
+// env holds the standard streams used by a command.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = []*command{
+	{"eval", "evaluate an expression against a payload", runEval},
+	{"check", "report syntax errors", runCheck},
+	{"fmt", "print expressions in canonical form", runFmt},
+	{"lint", "report suspicious constructs", runLint},
+	{"externalize", "replace the constants of an expression with named parameters", runExternalize},
+	{"compile", "compile an expression to a SQL WHERE clause, MongoDB query, Painless script, or RediSearch query", runCompile},
+	{"explain", "evaluate an expression and print the explanation tree", runExplain},
+	{"impact", "report how a rule or rule change matches a corpus of payloads", runImpact},
+	{"test", "run rule test suites", runTest},
+	{"lsp", "run the language server on standard input and output", runLSP},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+// run dispatches to the subcommand named by args[0] and returns the exit code.
+func run(args []string, e *env) int {
+	if len(args) == 0 {
+		usage(e.stderr)
+		return exitUsage
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(e.stdout)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(e, args[1:])
+		}
+	}
+
+	fmt.Fprintf(e.stderr, "amel: unknown command %q\n", name)
+	usage(e.stderr)
+	return exitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: amel <command> [flags] [file ...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "amel <command> -h" for the flags of a command.`)
+}
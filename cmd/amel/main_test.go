@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runCmd runs the CLI with the given arguments and standard input.
+func runCmd(stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, &env{stdin: strings.NewReader(stdin), stdout: &out, stderr: &errOut})
+	return code, out.String(), errOut.String()
+}
+
+func TestRun_Usage(t *testing.T) {
+	code, _, stderr := runCmd("")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "Commands:")
+
+	code, _, stderr = runCmd("", "bogus")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `unknown command "bogus"`)
+
+	code, _, _ = runCmd("", "eval", "-h")
+	assert.Equal(t, exitOK, code)
+}
+
+func TestRun_Eval(t *testing.T) {
+	code, stdout, _ := runCmd("", "eval", "-e", "$.age >= 18", "-d", `{"age": 20}`)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"result": true`)
+
+	// Payload from standard input
+	code, stdout, _ = runCmd(`{"items": [1, 2, 3]}`, "eval", "-e", "sum($.items)", "-p", "-")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"result": 6`)
+
+	// Expression from standard input
+	code, stdout, _ = runCmd("1 + 2", "eval")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"result": 3`)
+
+	code, _, stderr := runCmd("", "eval", "-e", "$.a", "-d", "{not json")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "not valid JSON")
+
+	code, _, stderr = runCmd("", "eval", "-e", "(1 +")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "Parser Error")
+}
+
+func TestRun_CheckAndLint(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.amel")
+	bad := filepath.Join(dir, "bad.amel")
+	require.NoError(t, os.WriteFile(good, []byte("$.age >= 18"), 0o644))
+	require.NoError(t, os.WriteFile(bad, []byte("$.age >="), 0o644))
+
+	code, stdout, _ := runCmd("", "check", good, bad)
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stdout, good+": ok")
+	assert.Contains(t, stdout, bad+": Parser Error")
+
+	code, _, _ = runCmd("", "lint", good)
+	assert.Equal(t, exitOK, code)
+
+	code, stdout, _ = runCmd("", "lint", "-e", "$.active == true")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stdout, "boolean-comparison")
+}
+
+func TestRun_Fmt(t *testing.T) {
+	code, stdout, _ := runCmd("$.a>1 AND $.b<2", "fmt")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "$.a > 1 && $.b < 2\n", stdout)
+
+	file := filepath.Join(t.TempDir(), "rule.amel")
+	require.NoError(t, os.WriteFile(file, []byte("$.a>1"), 0o644))
+
+	code, stdout, _ = runCmd("", "fmt", "-l", file)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, file+"\n", stdout)
+
+	code, _, _ = runCmd("", "fmt", "-w", file)
+	assert.Equal(t, exitOK, code)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "$.a > 1\n", string(data))
+}
+
+func TestRun_Externalize(t *testing.T) {
+	code, stdout, _ := runCmd("", "externalize", "-e", `$.age >= 18 && $.country IN ["DE"]`)
+	assert.Equal(t, exitOK, code)
+	assert.JSONEq(t, `{"source": "$.age >= minAge && $.country IN countryList", "params": {"minAge": 18, "countryList": ["DE"]}}`, stdout)
+}
+
+func TestRun_Compile(t *testing.T) {
+	code, stdout, _ := runCmd("", "compile", "-target=sql", "-dialect=postgres", "-e", `$.age > 18`)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"age" > $1`)
+
+	code, stdout, _ = runCmd("", "compile", "--target=mongo", "-e", `$.age > 18`)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"$gt": 18`)
+
+	code, stdout, _ = runCmd("", "compile", "-target=sql", "-trace", "-e", `$.age > 18 && $.ok`)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "-- 1:1-1:11 ($.age > 18) => (\"age\" > ?)\n")
+
+	code, stdout, _ = runCmd("", "compile", "-target=mongo", "-trace", "-e", `$.age > 18`)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"expression": "($.age > 18)"`)
+
+	code, stdout, _ = runCmd("", "compile", "-target=painless", "-e", `$.age > 18`)
+	assert.Equal(t, exitOK, code)
+	assert.JSONEq(t, `{"lang": "painless", "source": "(doc['age'].value > params.p1)", "params": {"p1": 18}}`, stdout)
+
+	code, stdout, _ = runCmd("", "compile", "-target=redisearch", "-e", `$.age > 18 && $.tier IN ["gold", "vip"]`)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "(@age:[(18 +inf] @tier:{gold | vip})\n", stdout)
+
+	code, _, stderr := runCmd("", "compile", "-target=xml", "-e", `$.age > 18`)
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "unknown target")
+}
+
+func TestRun_Explain(t *testing.T) {
+	code, stdout, _ := runCmd("", "explain", "-e", "$.age >= 18", "-d", `{"age": 20}`)
+	assert.Equal(t, exitOK, code)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "=> true")
+	assert.True(t, strings.HasPrefix(lines[1], "  $.age => 20"))
+
+	code, stdout, _ = runCmd("", "explain", "-json", "-e", "1 < 2")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"explanation"`)
+
+	code, stdout, _ = runCmd("", "explain", "-failures", "-e", `$.age >= 18 && $.country == "DE"`, "-d", `{"age": 16, "country": "DE"}`)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "`$.age >= 18` failed: age=16\n", stdout)
+
+	code, stdout, _ = runCmd("", "explain", "-suggest", "-e", `$.age >= 18 && $.country == "DE"`, "-d", `{"age": 16, "country": "DE"}`)
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, "age must be at least 18 (is 16)\n", stdout)
+}
+
+func TestRun_Impact(t *testing.T) {
+	corpus := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(t, os.WriteFile(corpus, []byte("{\"amount\": 50}\n{\"amount\": 150}\n\n{\"amount\": 250}\n"), 0o644))
+
+	code, stdout, _ := runCmd("", "impact", "-corpus", corpus, "-baseline", "$.amount > 100", "-e", "$.amount > 200 || $.amount < 60")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"total": 3`)
+	assert.Contains(t, stdout, `"newlyMatched": 1`)
+	assert.Contains(t, stdout, `"noLongerMatched": 1`)
+	assert.Contains(t, stdout, `"clause": "($.amount > 200)"`)
+
+	code, stdout, _ = runCmd(`[{"amount": 1}, {"amount": 2}]`, "impact", "-corpus", "-", "-e", "$.amount > 1")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"matchRate": 0.5`)
+
+	code, _, stderr := runCmd("", "impact", "-e", "$.amount > 1")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stderr, "-corpus is required")
+}
+
+func TestRun_Test(t *testing.T) {
+	dir := t.TempDir()
+	rules := filepath.Join(dir, "rules")
+	tests := filepath.Join(dir, "tests")
+	require.NoError(t, os.Mkdir(rules, 0o755))
+	require.NoError(t, os.Mkdir(tests, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(rules, "fraud.yaml"), []byte(`
+rules:
+  - name: velocity
+    expression: $.txPerHour > 10
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tests, "fraud.yaml"), []byte(`
+tests:
+  - name: velocity
+    rule: velocity
+    cases:
+      - name: busy
+        payload: {txPerHour: 11}
+        expect: true
+      - name: quiet
+        payload: {txPerHour: 2}
+        expect: false
+`), 0o644))
+
+	code, stdout, _ := runCmd("", "test", "-v", "-rules", rules, tests)
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "--- PASS: velocity/busy")
+	assert.Contains(t, stdout, "PASS: 2 passed, 0 failed")
+
+	broken := filepath.Join(dir, "broken.json")
+	require.NoError(t, os.WriteFile(broken, []byte(`{"tests": [{"name": "math", "expression": "1 + 1", "cases": [{"name": "wrong", "expect": 3}]}]}`), 0o644))
+	code, stdout, _ = runCmd("", "test", broken)
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, stdout, "--- FAIL: math/wrong ("+broken+")\n    expected 3, got 2")
+	assert.Contains(t, stdout, "FAIL: 0 passed, 1 failed")
+
+	code, _, _ = runCmd("", "test")
+	assert.Equal(t, exitUsage, code)
+}
+
+func TestRun_LSP(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	input := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+
+	code, stdout, _ := runCmd(input, "lsp")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, `"hoverProvider":true`)
+}
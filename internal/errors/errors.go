@@ -2,6 +2,8 @@
 package errors
 
 import (
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
 )
 
@@ -30,6 +32,10 @@ const (
 	ErrArgumentType      ErrorCode = 303
 	ErrInvalidOperator   ErrorCode = 304
 	ErrUndefinedVariable ErrorCode = 305
+	// Strict type errors, raised only by engines with strict types
+	ErrStrictComparison ErrorCode = 306 // Comparison of values of different types
+	ErrStrictNumeric    ErrorCode = 307 // An int and a float in one operation
+	ErrStrictTruthiness ErrorCode = 308 // A value other than a bool used as a condition
 
 	// Runtime errors (4xx)
 	ErrDivisionByZero   ErrorCode = 400
@@ -39,10 +45,20 @@ const (
 	ErrMemoryLimit      ErrorCode = 404
 	ErrSandboxViolation ErrorCode = 405
 	ErrFunctionPanic    ErrorCode = 406
+	ErrIterationLimit   ErrorCode = 407
+	ErrFunctionDenied   ErrorCode = 408
+	ErrExternalCall     ErrorCode = 409
+	ErrCircuitOpen      ErrorCode = 410
+	ErrCallBudget       ErrorCode = 411
+	ErrDepthLimit       ErrorCode = 412
+	ErrRegexDenied      ErrorCode = 413
 
 	// JSONPath errors (5xx)
 	ErrInvalidPath  ErrorCode = 500
 	ErrPathNotFound ErrorCode = 501
+	// ErrInvalidPayload is returned for payloads that cannot be decoded or
+	// do not match the payload schema of the engine.
+	ErrInvalidPayload ErrorCode = 502
 )
 
 // String returns the string representation of an error code.
@@ -80,6 +96,12 @@ func (c ErrorCode) String() string {
 		return "InvalidOperator"
 	case ErrUndefinedVariable:
 		return "UndefinedVariable"
+	case ErrStrictComparison:
+		return "StrictComparison"
+	case ErrStrictNumeric:
+		return "StrictNumeric"
+	case ErrStrictTruthiness:
+		return "StrictTruthiness"
 	case ErrDivisionByZero:
 		return "DivisionByZero"
 	case ErrNullReference:
@@ -94,10 +116,26 @@ func (c ErrorCode) String() string {
 		return "SandboxViolation"
 	case ErrFunctionPanic:
 		return "FunctionPanic"
+	case ErrIterationLimit:
+		return "IterationLimit"
+	case ErrFunctionDenied:
+		return "FunctionDenied"
+	case ErrExternalCall:
+		return "ExternalCall"
+	case ErrCircuitOpen:
+		return "CircuitOpen"
+	case ErrCallBudget:
+		return "CallBudget"
+	case ErrDepthLimit:
+		return "DepthLimit"
+	case ErrRegexDenied:
+		return "RegexDenied"
 	case ErrInvalidPath:
 		return "InvalidPath"
 	case ErrPathNotFound:
 		return "PathNotFound"
+	case ErrInvalidPayload:
+		return "InvalidPayload"
 	default:
 		return "Unknown"
 	}
@@ -121,6 +159,61 @@ func (c ErrorCode) Category() string {
 	}
 }
 
+// Hint returns a generic suggestion for fixing errors with the code, or ""
+// if there is none.
+func (c ErrorCode) Hint() string {
+	switch c {
+	case ErrUnterminatedString:
+		return "close the string with the quote it was opened with"
+	case ErrUnmatchedParen:
+		return "check that every '(' has a matching ')'"
+	case ErrUnexpectedEOF, ErrMissingExpression:
+		return "the expression is incomplete"
+	case ErrInvalidJSONPath, ErrInvalidPath:
+		return "paths start with $, for example $.user.name or $.items[0]"
+	case ErrTypeMismatch:
+		return "check the operand types; convert values with int(), float(), or string()"
+	case ErrUndefinedFunction:
+		return "check the function name, or register the function with the engine"
+	case ErrArgumentCount, ErrArgumentType:
+		return "check the arguments against the function signature"
+	case ErrUndefinedVariable:
+		return "payload fields are read with a path such as $.field"
+	case ErrStrictComparison:
+		return "strict types compare only values of the same type; convert one with int(), float(), or string()"
+	case ErrStrictNumeric:
+		return "strict types do not mix int and float; convert one with int() or float()"
+	case ErrStrictTruthiness:
+		return "strict types accept only booleans as conditions; compare the value, for example $.count > 0"
+	case ErrDivisionByZero:
+		return "guard the divisor, for example with ifThenElse($.d != 0, $.n / $.d, 0)"
+	case ErrNullReference:
+		return "use coalesce or defaultVal for values that may be missing"
+	case ErrIndexOutOfBounds:
+		return "check the length of the list with len() first"
+	case ErrTimeout:
+		return "raise the timeout with WithTimeout, or per expression with WithLimits"
+	case ErrMemoryLimit:
+		return "raise the memory limit of the sandbox, or pass less data to the function"
+	case ErrIterationLimit:
+		return "raise the iteration budget with WithLimits, or filter the list first"
+	case ErrCallBudget:
+		return "raise the call budget with WithLimits"
+	case ErrDepthLimit:
+		return "flatten the nesting of the expression, or raise the limit with WithMaxDepth"
+	case ErrRegexDenied:
+		return "use a shorter pattern, or one of the approved patterns of the engine"
+	case ErrFunctionDenied:
+		return "add the function to the allowlist of the expression limits"
+	case ErrCircuitOpen:
+		return "the external function failed repeatedly; calls resume after the cool-down"
+	case ErrInvalidPayload:
+		return "the payload must be a JSON object matching the payload schema"
+	default:
+		return ""
+	}
+}
+
 // Error represents an error in the AMEL engine with position information.
 type Error struct {
 	Code    ErrorCode
@@ -128,6 +221,85 @@ type Error struct {
 	Line    int
 	Column  int
 	Cause   error
+
+	// EndLine and EndColumn are the position just after the offending
+	// expression; they are 0 if the error has no span.
+	EndLine   int
+	EndColumn int
+	// Path is the payload path involved in the error, if any.
+	Path string
+	// Function is the function involved in the error, if any.
+	Function string
+	// Hint suggests how to fix the error. The constructors set it to the
+	// hint of Code.
+	Hint string
+}
+
+// Span is the range of the expression source an error refers to. Lines and
+// columns count from 1; the end is exclusive.
+type Span struct {
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"endLine,omitempty"`
+	EndColumn int `json:"endColumn,omitempty"`
+}
+
+// Span returns the range of the expression the error refers to, or nil if
+// the error has no position.
+func (e *Error) Span() *Span {
+	if e.Line == 0 {
+		return nil
+	}
+	return &Span{Line: e.Line, Column: e.Column, EndLine: e.EndLine, EndColumn: e.EndColumn}
+}
+
+// jsonError is the JSON representation of an Error.
+type jsonError struct {
+	Code     ErrorCode `json:"code"`
+	Name     string    `json:"name"`
+	Category string    `json:"category"`
+	Message  string    `json:"message"`
+	Span     *Span     `json:"span,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Function string    `json:"function,omitempty"`
+	Hint     string    `json:"hint,omitempty"`
+	Cause    string    `json:"cause,omitempty"`
+}
+
+// MarshalJSON encodes the error as an object with its code, code name,
+// category, message, span, path, function, hint, and cause.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	out := jsonError{
+		Code:     e.Code,
+		Name:     e.Code.String(),
+		Category: e.Code.Category(),
+		Message:  e.Message,
+		Span:     e.Span(),
+		Path:     e.Path,
+		Function: e.Function,
+		Hint:     e.Hint,
+	}
+	if e.Cause != nil {
+		out.Cause = e.Cause.Error()
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes an error encoded by MarshalJSON. The cause is
+// restored as a plain error.
+func (e *Error) UnmarshalJSON(data []byte) error {
+	var in jsonError
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*e = Error{Code: in.Code, Message: in.Message, Path: in.Path, Function: in.Function, Hint: in.Hint}
+	if in.Span != nil {
+		e.Line, e.Column, e.EndLine, e.EndColumn = in.Span.Line, in.Span.Column, in.Span.EndLine, in.Span.EndColumn
+	}
+	if in.Cause != "" {
+		e.Cause = stderrors.New(in.Cause)
+	}
+	return nil
 }
 
 // Error implements the error interface.
@@ -156,6 +328,7 @@ func (e *Error) Is(target error) bool {
 func New(code ErrorCode, message string) *Error {
 	return &Error{
 		Code:    code,
+		Hint:    code.Hint(),
 		Message: message,
 	}
 }
@@ -164,6 +337,7 @@ func New(code ErrorCode, message string) *Error {
 func NewAt(code ErrorCode, message string, line, column int) *Error {
 	return &Error{
 		Code:    code,
+		Hint:    code.Hint(),
 		Message: message,
 		Line:    line,
 		Column:  column,
@@ -174,6 +348,7 @@ func NewAt(code ErrorCode, message string, line, column int) *Error {
 func Wrap(code ErrorCode, message string, cause error) *Error {
 	return &Error{
 		Code:    code,
+		Hint:    code.Hint(),
 		Message: message,
 		Cause:   cause,
 	}
@@ -183,6 +358,7 @@ func Wrap(code ErrorCode, message string, cause error) *Error {
 func WrapAt(code ErrorCode, message string, line, column int, cause error) *Error {
 	return &Error{
 		Code:    code,
+		Hint:    code.Hint(),
 		Message: message,
 		Line:    line,
 		Column:  column,
@@ -194,6 +370,7 @@ func WrapAt(code ErrorCode, message string, line, column int, cause error) *Erro
 func Newf(code ErrorCode, format string, args ...interface{}) *Error {
 	return &Error{
 		Code:    code,
+		Hint:    code.Hint(),
 		Message: fmt.Sprintf(format, args...),
 	}
 }
@@ -202,6 +379,7 @@ func Newf(code ErrorCode, format string, args ...interface{}) *Error {
 func NewAtf(code ErrorCode, line, column int, format string, args ...interface{}) *Error {
 	return &Error{
 		Code:    code,
+		Hint:    code.Hint(),
 		Message: fmt.Sprintf(format, args...),
 		Line:    line,
 		Column:  column,
@@ -223,3 +401,12 @@ func IsCategory(err error, category string) bool {
 	}
 	return false
 }
+
+// As returns the AMEL error in err's chain, if any.
+func As(err error) (*Error, bool) {
+	var amelErr *Error
+	if stderrors.As(err, &amelErr) {
+		return amelErr, true
+	}
+	return nil, false
+}
@@ -0,0 +1,17 @@
+// Package amelhttp exposes an AMEL engine over a JSON REST API.
+package amelhttp
+
+import _ "embed"
+
+// schemaJSON holds the JSON Schema definitions of the API's request and response
+// bodies, served at GET /schema.
+//
+//go:embed schema.json
+var schemaJSON []byte
+
+// Schema returns the JSON Schema document describing the API's request and response bodies.
+func Schema() []byte {
+	out := make([]byte, len(schemaJSON))
+	copy(out, schemaJSON)
+	return out
+}
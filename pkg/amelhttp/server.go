@@ -0,0 +1,468 @@
+// Package amelhttp exposes an AMEL engine over a JSON REST API.
+//
+// The handler serves the following endpoints:
+//
+//	POST /compile          validate an expression and return its optimized form
+//	POST /evaluate         evaluate a single request
+//	POST /evaluate/batch   evaluate several requests in one call
+//	POST /evaluate/stream  evaluate a stream of newline-delimited JSON payloads
+//	POST /explain          evaluate a request and return the explanation tree
+//	GET  /functions        list the registered functions and their signatures
+//	GET  /schema           JSON Schema documents for the request and response bodies
+//	GET  /stats            engine statistics
+//
+// Evaluations stop when the client goes away or the request timeout set with
+// WithRequestTimeout passes. The "limits" field of a request restricts its
+// evaluation, and its "functions" list is the set of functions the expression
+// may call. Limits can only lower the engine limits: a timeout or budget
+// above the engine's is clamped to it.
+//
+// Mount it under a prefix with http.StripPrefix.
+package amelhttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+const (
+	defaultMaxBodyBytes = 1 << 20 // 1 MiB
+	defaultMaxBatchSize = 1000
+)
+
+// Handler serves the AMEL REST API for a single engine.
+type Handler struct {
+	engine               *engine.Engine
+	mux                  *http.ServeMux
+	maxBodyBytes         int64
+	maxBatchSize         int
+	requestTimeout       time.Duration
+	functionRegistration bool
+}
+
+// Option is a function that configures the handler.
+type Option func(*Handler)
+
+// WithMaxBodyBytes limits the size of request bodies. Larger requests are
+// rejected with 413 Request Entity Too Large.
+func WithMaxBodyBytes(n int64) Option {
+	return func(h *Handler) {
+		h.maxBodyBytes = n
+	}
+}
+
+// WithMaxBatchSize limits the number of requests in a single batch call.
+func WithMaxBatchSize(n int) Option {
+	return func(h *Handler) {
+		h.maxBatchSize = n
+	}
+}
+
+// WithRequestTimeout bounds the evaluations of each request, including a
+// whole batch, by d on top of the engine timeout. Requests over time fail
+// with ErrTimeout, as do those whose client disconnects. Zero, the default,
+// only stops evaluations when the client disconnects.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(h *Handler) {
+		h.requestTimeout = d
+	}
+}
+
+// WithFunctionRegistration allows clients to register JavaScript functions
+// through the "functions" field of an evaluation request. Registered functions
+// are added to the shared engine, so this is disabled by default.
+func WithFunctionRegistration(enabled bool) Option {
+	return func(h *Handler) {
+		h.functionRegistration = enabled
+	}
+}
+
+// New creates a handler serving the given engine.
+func New(eng *engine.Engine, opts ...Option) *Handler {
+	h := &Handler{
+		engine:       eng,
+		mux:          http.NewServeMux(),
+		maxBodyBytes: defaultMaxBodyBytes,
+		maxBatchSize: defaultMaxBatchSize,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("POST /compile", h.handleCompile)
+	h.mux.HandleFunc("POST /evaluate", h.handleEvaluate)
+	h.mux.HandleFunc("POST /evaluate/batch", h.handleBatch)
+	h.mux.HandleFunc("POST /evaluate/stream", h.handleStream)
+	h.mux.HandleFunc("POST /explain", h.handleExplain)
+	h.mux.HandleFunc("GET /functions", h.handleFunctions)
+	h.mux.HandleFunc("GET /schema", h.handleSchema)
+	h.mux.HandleFunc("GET /stats", h.handleStats)
+
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// ============================================================================
+// Request/Response structures
+// ============================================================================
+
+// CompileRequest is the body of a compile call. If Limits lists functions,
+// calling any other function makes the expression invalid.
+type CompileRequest struct {
+	DSL    string         `json:"dsl"`
+	Limits *engine.Limits `json:"limits,omitempty"`
+}
+
+// CompileResponse is the result of a compile call.
+type CompileResponse struct {
+	Valid     bool   `json:"valid"`
+	DSL       string `json:"dsl"`
+	Optimized string `json:"optimized,omitempty"`
+	Error     *Error `json:"error,omitempty"`
+}
+
+// BatchRequest is the body of a batch evaluation call.
+type BatchRequest struct {
+	Requests []*engine.EvalRequest `json:"requests"`
+}
+
+// BatchResponse holds one response per request, in request order.
+type BatchResponse struct {
+	Results []*engine.EvalResponse `json:"results"`
+}
+
+// FunctionInfo describes a registered function overload.
+type FunctionInfo struct {
+	Name        string          `json:"name"`
+	Parameters  []ParameterInfo `json:"parameters"`
+	ReturnType  string          `json:"returnType"`
+	Variadic    bool            `json:"variadic,omitempty"`
+	Kind        string          `json:"kind"` // "builtin", "js", or "lua"
+	Category    string          `json:"category,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Examples    []string        `json:"examples,omitempty"`
+}
+
+// ParameterInfo describes a function parameter.
+type ParameterInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+// FunctionsResponse is the result of a list-functions call.
+type FunctionsResponse struct {
+	Functions []FunctionInfo `json:"functions"`
+}
+
+// Error is the JSON representation of an API error.
+// Code is the AMEL error code for expression errors and 0 for request errors.
+type Error struct {
+	Code      int    `json:"code,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Category  string `json:"category,omitempty"`
+	Message   string `json:"message"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Path      string `json:"path,omitempty"`     // The payload path involved
+	Function  string `json:"function,omitempty"` // The function involved
+	Hint      string `json:"hint,omitempty"`     // How to fix the error
+}
+
+// ErrorResponse is returned for requests that could not be processed.
+type ErrorResponse struct {
+	Error *Error `json:"error"`
+}
+
+// newError converts err to its JSON representation.
+func newError(err error) *Error {
+	if amelErr, ok := err.(*errors.Error); ok {
+		return &Error{
+			Code:      int(amelErr.Code),
+			Name:      amelErr.Code.String(),
+			Category:  amelErr.Code.Category(),
+			Message:   amelErr.Message,
+			Line:      amelErr.Line,
+			Column:    amelErr.Column,
+			EndLine:   amelErr.EndLine,
+			EndColumn: amelErr.EndColumn,
+			Path:      amelErr.Path,
+			Function:  amelErr.Function,
+			Hint:      amelErr.Hint,
+		}
+	}
+	return &Error{Message: err.Error()}
+}
+
+// ============================================================================
+// Handlers
+// ============================================================================
+
+func (h *Handler) handleCompile(w http.ResponseWriter, r *http.Request) {
+	var req CompileRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	resp := &CompileResponse{DSL: req.DSL}
+	compiled, err := h.engine.Compile(req.DSL)
+	if err == nil && req.Limits != nil {
+		compiled, err = compiled.WithLimits(*req.Limits)
+	}
+	if err != nil {
+		resp.Error = newError(err)
+		writeJSON(w, http.StatusUnprocessableEntity, resp)
+		return
+	}
+
+	resp.Valid = true
+	if compiled.Optimized != nil {
+		resp.Optimized = compiled.Optimized.String()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	var req engine.EvalRequest
+	if !h.decode(w, r, &req) || !h.checkFunctions(w, &req) {
+		return
+	}
+	h.clampLimits(&req)
+
+	ctx, cancel := h.context(r)
+	defer cancel()
+	writeEvalResponse(w, h.engine.EvaluateRequestContext(ctx, &req))
+}
+
+func (h *Handler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if h.maxBatchSize > 0 && len(req.Requests) > h.maxBatchSize {
+		writeError(w, http.StatusRequestEntityTooLarge,
+			&Error{Message: "batch exceeds the maximum of " + strconv.Itoa(h.maxBatchSize) + " requests"})
+		return
+	}
+	for _, item := range req.Requests {
+		if item == nil {
+			writeError(w, http.StatusBadRequest, &Error{Message: "batch contains a null request"})
+			return
+		}
+		if !h.checkFunctions(w, item) {
+			return
+		}
+		h.clampLimits(item)
+	}
+
+	// Evaluation errors are reported per item; the call itself succeeds
+	ctx, cancel := h.context(r)
+	defer cancel()
+	writeJSON(w, http.StatusOK, &BatchResponse{Results: h.engine.EvaluateRequestsContext(ctx, req.Requests)})
+}
+
+// handleStream evaluates the expression given in the "dsl" query parameter
+// against each line of a newline-delimited JSON body and streams one result
+// per line. With filter=true, the matching input lines are streamed instead.
+// The "limits" query parameter holds the limits as JSON, as in the "limits"
+// field of other requests. The maximum body size applies to each line rather
+// than to the whole body.
+func (h *Handler) handleStream(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var limits *engine.Limits
+	if s := query.Get("limits"); s != "" {
+		if err := json.Unmarshal([]byte(s), &limits); err != nil {
+			writeError(w, http.StatusBadRequest, &Error{Message: "invalid limits: " + err.Error()})
+			return
+		}
+	}
+	req := &engine.EvalRequest{DSL: query.Get("dsl"), Limits: limits}
+	h.clampLimits(req)
+
+	compiled, err := h.engine.Compile(req.DSL)
+	if err == nil && req.Limits != nil {
+		compiled, err = compiled.WithLimits(*req.Limits)
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, newError(err))
+		return
+	}
+
+	filter, _ := strconv.ParseBool(query.Get("filter"))
+	opts := []engine.StreamOption{engine.StreamFilter(filter)}
+	if h.maxBodyBytes > 0 {
+		opts = append(opts, engine.StreamMaxLineBytes(int(h.maxBodyBytes)))
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	// Errors after the header was sent can only end the stream early
+	ctx, cancel := h.context(r)
+	defer cancel()
+	_, _ = h.engine.EvaluateStream(ctx, compiled, r.Body, &flushWriter{w: w}, opts...)
+}
+
+func (h *Handler) handleExplain(w http.ResponseWriter, r *http.Request) {
+	var req engine.EvalRequest
+	if !h.decode(w, r, &req) || !h.checkFunctions(w, &req) {
+		return
+	}
+	h.clampLimits(&req)
+
+	ctx, cancel := h.context(r)
+	defer cancel()
+	writeEvalResponse(w, h.engine.ExplainRequestContext(ctx, &req))
+}
+
+func (h *Handler) handleFunctions(w http.ResponseWriter, r *http.Request) {
+	registry := h.engine.GetFunctionRegistry()
+	names := registry.List()
+	sort.Strings(names)
+
+	resp := &FunctionsResponse{Functions: make([]FunctionInfo, 0, len(names))}
+	for _, name := range names {
+		for _, fn := range registry.ListOverloads(name) {
+			resp.Functions = append(resp.Functions, functionInfo(name, fn))
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// functionInfo describes a function overload for the list-functions endpoint.
+func functionInfo(name string, fn *functions.Function) FunctionInfo {
+	info := FunctionInfo{
+		Name:       name,
+		Parameters: []ParameterInfo{},
+		ReturnType: types.TypeAny.String(),
+		Kind:       "builtin",
+	}
+	switch {
+	case fn.IsJS():
+		info.Kind = "js"
+	case fn.IsLua():
+		info.Kind = "lua"
+	}
+	sig := fn.Signature
+	if sig == nil {
+		return info
+	}
+
+	info.ReturnType = sig.ReturnType.String()
+	info.Variadic = sig.Variadic
+	info.Category = sig.Category
+	info.Description = sig.Description
+	info.Examples = sig.Examples
+	for _, p := range sig.Parameters {
+		info.Parameters = append(info.Parameters, ParameterInfo{Name: p.Name, Type: p.Type.String(), Description: p.Description})
+	}
+	return info
+}
+
+func (h *Handler) handleSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(schemaJSON)
+}
+
+func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.engine.Stats())
+}
+
+// ============================================================================
+// Helpers
+// ============================================================================
+
+// decode reads the JSON request body into v. It writes an error response and
+// returns false if the body is missing, too large, or malformed.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body := r.Body
+	if h.maxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+	}
+
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			writeError(w, http.StatusRequestEntityTooLarge, &Error{Message: err.Error()})
+			return false
+		}
+		writeError(w, http.StatusBadRequest, &Error{Message: "invalid request body: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// context returns the context bounding the evaluations of r.
+func (h *Handler) context(r *http.Request) (context.Context, context.CancelFunc) {
+	if h.requestTimeout > 0 {
+		return context.WithTimeout(r.Context(), h.requestTimeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+// clampLimits lowers the limits of a request to the engine limits, so clients
+// can tighten them but never raise them.
+func (h *Handler) clampLimits(req *engine.EvalRequest) {
+	if req.Limits != nil {
+		limits := h.engine.ClampLimits(*req.Limits)
+		req.Limits = &limits
+	}
+}
+
+// checkFunctions rejects requests that register functions unless the handler allows it.
+func (h *Handler) checkFunctions(w http.ResponseWriter, req *engine.EvalRequest) bool {
+	if len(req.Functions) > 0 && !h.functionRegistration {
+		writeError(w, http.StatusForbidden, &Error{Message: "function registration is disabled"})
+		return false
+	}
+	return true
+}
+
+// writeEvalResponse writes an evaluation response, using 422 Unprocessable Entity
+// for expressions that failed to compile or evaluate.
+func writeEvalResponse(w http.ResponseWriter, resp *engine.EvalResponse) {
+	status := http.StatusOK
+	if resp.Error != "" {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, resp)
+}
+
+// flushWriter flushes the response after every write so stream results reach
+// the client as soon as they are produced.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = http.NewResponseController(f.w).Flush()
+	}
+	return n, err
+}
+
+func writeError(w http.ResponseWriter, status int, err *Error) {
+	writeJSON(w, status, &ErrorResponse{Error: err})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,338 @@
+package amelhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, opts ...Option) *httptest.Server {
+	t.Helper()
+
+	eng, err := engine.New()
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(New(eng, opts...))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func post(t *testing.T, srv *httptest.Server, path, body string, out interface{}) int {
+	t.Helper()
+
+	resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	return resp.StatusCode
+}
+
+func TestHandler_Compile(t *testing.T) {
+	srv := newTestServer(t)
+
+	var ok CompileResponse
+	status := post(t, srv, "/compile", `{"dsl": "$.age >= 18 && 1 + 2 == 3"}`, &ok)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, ok.Valid)
+	assert.NotEmpty(t, ok.Optimized)
+	assert.Nil(t, ok.Error)
+
+	var bad CompileResponse
+	status = post(t, srv, "/compile", `{"dsl": "(5 +"}`, &bad)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.False(t, bad.Valid)
+	require.NotNil(t, bad.Error)
+	assert.NotZero(t, bad.Error.Code)
+	assert.Equal(t, "Parser", bad.Error.Category)
+}
+
+func TestHandler_Evaluate(t *testing.T) {
+	srv := newTestServer(t)
+
+	t.Run("success", func(t *testing.T) {
+		var resp engine.EvalResponse
+		status := post(t, srv, "/evaluate", `{"dsl": "$.age >= 18", "payload": {"age": 25}}`, &resp)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, true, resp.Result)
+		assert.Equal(t, "bool", resp.Type)
+		assert.Empty(t, resp.Error)
+	})
+
+	t.Run("evaluation error", func(t *testing.T) {
+		var resp engine.EvalResponse
+		status := post(t, srv, "/evaluate", `{"dsl": "unknownVar + 1"}`, &resp)
+		assert.Equal(t, http.StatusUnprocessableEntity, status)
+		assert.NotEmpty(t, resp.Error)
+		assert.NotZero(t, resp.ErrorCode)
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		var resp ErrorResponse
+		status := post(t, srv, "/evaluate", `{"dsl": `, &resp)
+		assert.Equal(t, http.StatusBadRequest, status)
+		require.NotNil(t, resp.Error)
+		assert.Contains(t, resp.Error.Message, "invalid request body")
+	})
+
+	t.Run("function registration disabled", func(t *testing.T) {
+		var resp ErrorResponse
+		status := post(t, srv, "/evaluate",
+			`{"dsl": "double(2)", "functions": ["function double(x) { return x * 2; }"]}`, &resp)
+		assert.Equal(t, http.StatusForbidden, status)
+	})
+
+	t.Run("function registration enabled", func(t *testing.T) {
+		srv := newTestServer(t, WithFunctionRegistration(true))
+
+		var resp engine.EvalResponse
+		status := post(t, srv, "/evaluate",
+			`{"dsl": "double(2)", "functions": ["function double(x) { return x * 2; }"]}`, &resp)
+		assert.Equal(t, http.StatusOK, status)
+		assert.EqualValues(t, 4, resp.Result)
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		srv := newTestServer(t, WithMaxBodyBytes(16))
+
+		var resp ErrorResponse
+		status := post(t, srv, "/evaluate", `{"dsl": "$.name == \"a very long string\""}`, &resp)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+	})
+}
+
+func TestHandler_Limits(t *testing.T) {
+	srv := newTestServer(t)
+
+	var resp engine.EvalResponse
+	status := post(t, srv, "/evaluate",
+		`{"dsl": "upper($.name) == \"A\"", "payload": {"name": "a"}, "limits": {"functions": ["upper"]}}`, &resp)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, resp.Result)
+
+	status = post(t, srv, "/explain",
+		`{"dsl": "len($.name) > 0", "payload": {"name": "a"}, "limits": {"functions": ["upper"]}}`, &resp)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, int(engine.ErrFunctionDenied), resp.ErrorCode)
+
+	var compiled CompileResponse
+	status = post(t, srv, "/compile", `{"dsl": "len($.name) > 0", "limits": {"functions": []}}`, &compiled)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.False(t, compiled.Valid)
+	assert.Equal(t, int(engine.ErrFunctionDenied), compiled.Error.Code)
+
+	var batch BatchResponse
+	status = post(t, srv, "/evaluate/batch",
+		`{"requests": [{"dsl": "len($.a)", "payload": {"a": "xy"}, "limits": {"functions": []}}, {"dsl": "len($.a)", "payload": {"a": "xy"}}]}`, &batch)
+	assert.Equal(t, http.StatusOK, status)
+	require.Len(t, batch.Results, 2)
+	assert.Equal(t, int(engine.ErrFunctionDenied), batch.Results[0].ErrorCode)
+	assert.Equal(t, float64(2), batch.Results[1].Result)
+}
+
+func TestHandler_LimitsCannotBeRaised(t *testing.T) {
+	eng, err := engine.New(engine.WithMaxIterations(5), engine.WithMaxCalls(20))
+	require.NoError(t, err)
+	srv := httptest.NewServer(New(eng))
+	t.Cleanup(srv.Close)
+
+	body := func(limits string) string {
+		return `{"dsl": "len(map($.items, x => x * 2))", "payload": {"items": [1, 2, 3, 4, 5, 6, 7, 8]}` + limits + `}`
+	}
+
+	var resp engine.EvalResponse
+	status := post(t, srv, "/evaluate", body(""), &resp)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, int(engine.ErrIterationLimit), resp.ErrorCode)
+
+	status = post(t, srv, "/evaluate", body(`, "limits": {"maxIterations": 1000000, "maxCalls": 100000}`), &resp)
+	assert.Equal(t, http.StatusUnprocessableEntity, status, "limits above the engine's are clamped")
+	assert.Equal(t, int(engine.ErrIterationLimit), resp.ErrorCode)
+
+	status = post(t, srv, "/explain", body(`, "limits": {"maxIterations": 1000000}`), &resp)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, int(engine.ErrIterationLimit), resp.ErrorCode)
+
+	var batch BatchResponse
+	post(t, srv, "/evaluate/batch", `{"requests": [`+body(`, "limits": {"maxIterations": 1000000}`)+`]}`, &batch)
+	require.Len(t, batch.Results, 1)
+	assert.Equal(t, int(engine.ErrIterationLimit), batch.Results[0].ErrorCode)
+
+	status = post(t, srv, "/evaluate", `{"dsl": "len(map($.items, x => x))", "payload": {"items": [1, 2, 3]}, "limits": {"maxIterations": 2}}`, &resp)
+	assert.Equal(t, http.StatusUnprocessableEntity, status, "limits below the engine's apply")
+	assert.Equal(t, int(engine.ErrIterationLimit), resp.ErrorCode)
+
+	limits := url.QueryEscape(`{"maxIterations": 1000000}`)
+	stream, err := http.Post(srv.URL+"/evaluate/stream?limits="+limits+"&dsl="+url.QueryEscape("len(map($.items, x => x))"),
+		"application/x-ndjson", strings.NewReader(`{"items": [1, 2, 3, 4, 5, 6, 7, 8]}`+"\n"))
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	var line engine.StreamResult
+	require.NoError(t, json.NewDecoder(stream.Body).Decode(&line))
+	assert.Equal(t, int(engine.ErrIterationLimit), line.ErrorCode)
+}
+
+func TestHandler_RequestTimeout(t *testing.T) {
+	srv := newTestServer(t, WithRequestTimeout(time.Nanosecond))
+
+	var resp engine.EvalResponse
+	status := post(t, srv, "/evaluate", `{"dsl": "$.a + 1", "payload": {"a": 1}}`, &resp)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, int(engine.ErrTimeout), resp.ErrorCode)
+
+	var batch BatchResponse
+	post(t, srv, "/evaluate/batch", `{"requests": [{"dsl": "$.a + 1", "payload": {"a": 1}}]}`, &batch)
+	require.Len(t, batch.Results, 1)
+	assert.Equal(t, int(engine.ErrTimeout), batch.Results[0].ErrorCode)
+
+	stream, err := http.Post(srv.URL+"/evaluate/stream?dsl="+url.QueryEscape("$.a + 1"), "application/x-ndjson", strings.NewReader("{\"a\":1}\n"))
+	require.NoError(t, err)
+	defer stream.Body.Close()
+	out, err := io.ReadAll(stream.Body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), `"result":2`, "the request timeout applies to streams")
+}
+
+func TestHandler_Batch(t *testing.T) {
+	srv := newTestServer(t, WithMaxBatchSize(3))
+
+	var resp BatchResponse
+	status := post(t, srv, "/evaluate/batch", `{"requests": [
+		{"dsl": "$.x * 2", "payload": {"x": 4}},
+		{"dsl": "(1 +"},
+		{"dsl": "\"ok\""}
+	]}`, &resp)
+	assert.Equal(t, http.StatusOK, status)
+	require.Len(t, resp.Results, 3)
+	assert.EqualValues(t, 8, resp.Results[0].Result)
+	assert.NotEmpty(t, resp.Results[1].Error)
+	assert.Equal(t, "ok", resp.Results[2].Result)
+
+	var tooMany ErrorResponse
+	status = post(t, srv, "/evaluate/batch",
+		`{"requests": [{"dsl": "1"}, {"dsl": "2"}, {"dsl": "3"}, {"dsl": "4"}]}`, &tooMany)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+}
+
+func TestHandler_Stream(t *testing.T) {
+	srv := newTestServer(t)
+	body := "{\"level\":\"error\",\"ms\":900}\n\n{\"level\":\"info\",\"ms\":10}\nnot json\n"
+
+	stream := func(query string) (int, string) {
+		resp, err := http.Post(srv.URL+"/evaluate/stream?"+query, "application/x-ndjson", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	dsl := url.QueryEscape(`$.level == "error" && $.ms > 500`)
+	status, out := stream("dsl=" + dsl)
+	assert.Equal(t, http.StatusOK, status)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3)
+
+	var first engine.StreamResult
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, 1, first.Line)
+	assert.Equal(t, true, first.Result)
+	assert.Contains(t, lines[2], `"line":4`)
+	assert.Contains(t, lines[2], `"error":"invalid JSON payload"`)
+
+	status, out = stream("filter=true&dsl=" + dsl)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "{\"level\":\"error\",\"ms\":900}\n", out)
+
+	status, out = stream("dsl=" + url.QueryEscape("$.ms >"))
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Contains(t, out, `"error"`)
+}
+
+func TestHandler_Explain(t *testing.T) {
+	srv := newTestServer(t)
+
+	var resp engine.EvalResponse
+	status := post(t, srv, "/explain", `{"dsl": "$.age >= 18 && $.verified", "payload": {"age": 25, "verified": true}}`, &resp)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, resp.Result)
+	require.NotNil(t, resp.Explanation)
+	assert.NotEmpty(t, resp.Explanation.Children)
+}
+
+func TestHandler_Functions(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, err := http.Get(srv.URL + "/functions")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body FunctionsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.NotEmpty(t, body.Functions)
+
+	var found bool
+	for _, fn := range body.Functions {
+		if fn.Name == "max" {
+			found = true
+			assert.Equal(t, "builtin", fn.Kind)
+			assert.Equal(t, "aggregate", fn.Category)
+			assert.NotEmpty(t, fn.Description)
+		}
+	}
+	assert.True(t, found)
+
+	// Method not allowed
+	postResp, err := http.Post(srv.URL+"/functions", "application/json", nil)
+	require.NoError(t, err)
+	postResp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, postResp.StatusCode)
+}
+
+func TestHandler_Schema(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp, err := http.Get(srv.URL + "/schema")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var schema map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&schema))
+	defs, ok := schema["$defs"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Contains(t, defs, "EvalRequest")
+	assert.Contains(t, defs, "ErrorResponse")
+	assert.Contains(t, defs, "StatsResponse")
+}
+
+func TestHandler_Stats(t *testing.T) {
+	srv := newTestServer(t)
+
+	var evalResp engine.EvalResponse
+	post(t, srv, "/evaluate", `{"dsl": "$.a > 1", "payload": {"a": 2}}`, &evalResp)
+	post(t, srv, "/evaluate", `{"dsl": "$.a / 0", "payload": {"a": 2}}`, &evalResp)
+
+	resp, err := http.Get(srv.URL + "/stats")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var stats engine.Stats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.Equal(t, uint64(2), stats.Evaluate.Total)
+	assert.Equal(t, uint64(1), stats.Evaluate.True)
+	assert.Equal(t, uint64(1), stats.Evaluate.Failed)
+	assert.Equal(t, uint64(1), stats.Errors["DivisionByZero"])
+}
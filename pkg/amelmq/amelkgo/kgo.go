@@ -0,0 +1,54 @@
+// Package amelkgo filters and routes the Kafka records polled with franz-go
+// with amelmq filters and routers. It is a separate module, so the amel
+// module does not depend on franz-go.
+//
+//	fetches := client.PollFetches(ctx)
+//	fetches.EachRecord(amelkgo.RecordHandler(filter, process))
+//
+// Dropped records are committed like handled ones when the client commits
+// the offsets of polled records, as it does by default.
+package amelkgo
+
+import (
+	"github.com/bencagri/amel/pkg/amelmq"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// RecordHandler wraps a record handler, such as one passed to
+// kgo.Fetches.EachRecord, so that it only receives the records whose value
+// matches the filter.
+func RecordHandler(f *amelmq.Filter, next func(*kgo.Record)) func(*kgo.Record) {
+	return amelmq.Handler(f, recordValue, next)
+}
+
+// RouteHandler returns a record handler calling the handler of the route
+// each record matches, like amelmq.Dispatch. The handler named "" receives
+// the records no route matches; records without a handler are dropped.
+func RouteHandler(r *amelmq.Router, handlers map[string]func(*kgo.Record)) func(*kgo.Record) {
+	return amelmq.Dispatch(r, recordValue, handlers)
+}
+
+// Filter returns the records of fetches whose value matches the filter, in
+// order.
+func Filter(f *amelmq.Filter, fetches kgo.Fetches) []*kgo.Record {
+	var records []*kgo.Record
+	fetches.EachRecord(RecordHandler(f, func(r *kgo.Record) {
+		records = append(records, r)
+	}))
+	return records
+}
+
+// Route groups the records of fetches by the route their value matches,
+// keeping their order. Records no route matches are grouped under "".
+func Route(r *amelmq.Router, fetches kgo.Fetches) map[string][]*kgo.Record {
+	routed := make(map[string][]*kgo.Record)
+	fetches.EachRecord(func(record *kgo.Record) {
+		route := r.Route(record.Value)
+		routed[route] = append(routed[route], record)
+	})
+	return routed
+}
+
+func recordValue(r *kgo.Record) []byte {
+	return r.Value
+}
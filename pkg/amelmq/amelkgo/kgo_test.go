@@ -0,0 +1,72 @@
+package amelkgo
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/amelmq"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func newTestEngine(t *testing.T) *engine.Engine {
+	t.Helper()
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return eng
+}
+
+// testFetches returns fetches of one partition holding records with the
+// values, keyed by their index.
+func testFetches(values ...string) kgo.Fetches {
+	records := make([]*kgo.Record, len(values))
+	for i, value := range values {
+		records[i] = &kgo.Record{Key: []byte{byte('a' + i)}, Value: []byte(value), Offset: int64(i)}
+	}
+	return kgo.Fetches{{Topics: []kgo.FetchTopic{{Topic: "payments", Partitions: []kgo.FetchPartition{{Records: records}}}}}}
+}
+
+func keys(records []*kgo.Record) []string {
+	var keys []string
+	for _, r := range records {
+		keys = append(keys, string(r.Key))
+	}
+	return keys
+}
+
+func TestFilter(t *testing.T) {
+	filter, err := amelmq.NewFilter(newTestEngine(t), `$.amount > 100`)
+	require.NoError(t, err)
+	fetches := testFetches(`{"amount": 500}`, `{"amount": 5}`, `{`, `{"amount": 101}`)
+
+	assert.Equal(t, []string{"a", "d"}, keys(Filter(filter, fetches)))
+
+	var handled []*kgo.Record
+	fetches.EachRecord(RecordHandler(filter, func(r *kgo.Record) {
+		handled = append(handled, r)
+	}))
+	assert.Equal(t, []string{"a", "d"}, keys(handled))
+}
+
+func TestRoute(t *testing.T) {
+	router, err := amelmq.NewRouter(newTestEngine(t), []amelmq.Route{
+		{Name: "fraud", DSL: `$.score > 0.9`},
+		{Name: "priority", DSL: `$.tier == "gold"`},
+	})
+	require.NoError(t, err)
+	fetches := testFetches(`{"score": 0.99}`, `{"score": 0.2, "tier": "gold"}`, `{"score": 0.2}`, `{"score": 0.95}`)
+
+	routed := Route(router, fetches)
+	assert.Equal(t, []string{"a", "d"}, keys(routed["fraud"]))
+	assert.Equal(t, []string{"b"}, keys(routed["priority"]))
+	assert.Equal(t, []string{"c"}, keys(routed[""]))
+
+	var fraud, other []*kgo.Record
+	fetches.EachRecord(RouteHandler(router, map[string]func(*kgo.Record){
+		"fraud": func(r *kgo.Record) { fraud = append(fraud, r) },
+		"":      func(r *kgo.Record) { other = append(other, r) },
+	}))
+	assert.Equal(t, []string{"a", "d"}, keys(fraud))
+	assert.Equal(t, []string{"c"}, keys(other))
+}
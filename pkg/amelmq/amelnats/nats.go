@@ -0,0 +1,60 @@
+// Package amelnats filters and routes NATS messages with amelmq filters and
+// routers. It is a separate module, so the amel module does not depend on
+// the NATS client.
+//
+//	filter, _ := amelmq.NewFilter(eng, `$.amount > 100`)
+//	sub, _ := amelnats.Subscribe(nc, "payments", filter, handle)
+//
+// The handlers work with JetStream subscriptions too. Dropped JetStream
+// messages are acknowledged, so they are not redelivered.
+package amelnats
+
+import (
+	"github.com/bencagri/amel/pkg/amelmq"
+	"github.com/nats-io/nats.go"
+)
+
+// MsgHandler wraps a message handler so that it only receives the messages
+// whose data matches the filter.
+func MsgHandler(f *amelmq.Filter, next nats.MsgHandler) nats.MsgHandler {
+	return func(m *nats.Msg) {
+		if f.Match(m.Data) {
+			next(m)
+			return
+		}
+		drop(m)
+	}
+}
+
+// RouteHandler returns a message handler calling the handler of the route
+// each message matches, like amelmq.Dispatch. The handler named "" receives
+// the messages no route matches; messages without a handler are dropped.
+func RouteHandler(r *amelmq.Router, handlers map[string]nats.MsgHandler) nats.MsgHandler {
+	return func(m *nats.Msg) {
+		if handle, ok := handlers[r.Route(m.Data)]; ok {
+			handle(m)
+			return
+		}
+		drop(m)
+	}
+}
+
+// Subscribe subscribes to subject, passing the messages matching the filter
+// to handler.
+func Subscribe(nc *nats.Conn, subject string, f *amelmq.Filter, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return nc.Subscribe(subject, MsgHandler(f, handler))
+}
+
+// QueueSubscribe subscribes to subject as a member of a queue group, passing
+// the messages matching the filter to handler.
+func QueueSubscribe(nc *nats.Conn, subject, queue string, f *amelmq.Filter, handler nats.MsgHandler) (*nats.Subscription, error) {
+	return nc.QueueSubscribe(subject, queue, MsgHandler(f, handler))
+}
+
+// drop acknowledges a dropped JetStream message. Core NATS messages have no
+// JetStream metadata and need no acknowledgement.
+func drop(m *nats.Msg) {
+	if _, err := m.Metadata(); err == nil {
+		_ = m.Ack()
+	}
+}
@@ -0,0 +1,55 @@
+package amelnats
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/amelmq"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEngine(t *testing.T) *engine.Engine {
+	t.Helper()
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return eng
+}
+
+func TestMsgHandler(t *testing.T) {
+	filter, err := amelmq.NewFilter(newTestEngine(t), `$.amount > 100`)
+	require.NoError(t, err)
+
+	var handled []string
+	handler := MsgHandler(filter, func(m *nats.Msg) {
+		handled = append(handled, m.Subject)
+	})
+	handler(&nats.Msg{Subject: "big", Data: []byte(`{"amount": 500}`)})
+	handler(&nats.Msg{Subject: "small", Data: []byte(`{"amount": 5}`)})
+	handler(&nats.Msg{Subject: "invalid", Data: []byte(`{`)})
+	assert.Equal(t, []string{"big"}, handled)
+}
+
+func TestRouteHandler(t *testing.T) {
+	router, err := amelmq.NewRouter(newTestEngine(t), []amelmq.Route{
+		{Name: "fraud", DSL: `$.score > 0.9`},
+		{Name: "priority", DSL: `$.tier == "gold"`},
+	})
+	require.NoError(t, err)
+
+	routed := map[string][]string{}
+	record := func(route string) nats.MsgHandler {
+		return func(m *nats.Msg) {
+			routed[route] = append(routed[route], m.Subject)
+		}
+	}
+	handler := RouteHandler(router, map[string]nats.MsgHandler{
+		"fraud": record("fraud"),
+		"":      record("default"),
+	})
+	handler(&nats.Msg{Subject: "a", Data: []byte(`{"score": 0.99}`)})
+	handler(&nats.Msg{Subject: "b", Data: []byte(`{"score": 0.2, "tier": "gold"}`)}) // No priority handler
+	handler(&nats.Msg{Subject: "c", Data: []byte(`{"score": 0.2}`)})
+	assert.Equal(t, map[string][]string{"fraud": {"a"}, "default": {"c"}}, routed)
+}
@@ -0,0 +1,109 @@
+// Package amelsarama filters and routes the Kafka messages consumed with a
+// Sarama consumer group with amelmq filters and routers. It is a separate
+// module, so the amel module does not depend on Sarama.
+//
+//	handler := amelsarama.ConsumerGroupHandler(filter, consumer)
+//	for ctx.Err() == nil {
+//		if err := group.Consume(ctx, topics, handler); err != nil {
+//			return err
+//		}
+//	}
+package amelsarama
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/bencagri/amel/pkg/amelmq"
+)
+
+// ConsumerGroupHandler wraps a consumer group handler so that the claims it
+// consumes only deliver the messages whose value matches the filter.
+//
+// Dropped messages are not marked: marking a later message commits past
+// them, while marking a dropped message could commit past a matching one the
+// handler has not processed yet. Dropped messages after the last marked one
+// are consumed and dropped again after a rebalance or restart.
+func ConsumerGroupHandler(f *amelmq.Filter, handler sarama.ConsumerGroupHandler) sarama.ConsumerGroupHandler {
+	return &filterHandler{ConsumerGroupHandler: handler, filter: f}
+}
+
+type filterHandler struct {
+	sarama.ConsumerGroupHandler
+	filter *amelmq.Filter
+}
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler.
+func (h *filterHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	messages := make(chan *sarama.ConsumerMessage)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(messages)
+		for msg := range claim.Messages() {
+			if !h.filter.Match(msg.Value) {
+				continue
+			}
+			select {
+			case messages <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return h.ConsumerGroupHandler.ConsumeClaim(session, &filteredClaim{ConsumerGroupClaim: claim, messages: messages})
+}
+
+// filteredClaim is a claim delivering only the messages matching a filter.
+type filteredClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+// Messages implements sarama.ConsumerGroupClaim.
+func (c *filteredClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+// MessageHandler handles a message of a claim. Returning an error stops
+// consuming the claim.
+type MessageHandler func(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error
+
+// RouteHandler returns a consumer group handler calling the handler of the
+// route each message matches, like amelmq.Dispatch. The handler named ""
+// receives the messages no route matches; messages without a handler are
+// dropped. Messages are marked once their handler returns, and dropped
+// messages at once, as they are handled in order.
+func RouteHandler(r *amelmq.Router, handlers map[string]MessageHandler) sarama.ConsumerGroupHandler {
+	return &routeHandler{router: r, handlers: handlers}
+}
+
+type routeHandler struct {
+	router   *amelmq.Router
+	handlers map[string]MessageHandler
+}
+
+// Setup implements sarama.ConsumerGroupHandler.
+func (h *routeHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+// Cleanup implements sarama.ConsumerGroupHandler.
+func (h *routeHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim implements sarama.ConsumerGroupHandler.
+func (h *routeHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if handle, ok := h.handlers[h.router.Route(msg.Value)]; ok {
+				if err := handle(session, msg); err != nil {
+					return err
+				}
+			}
+			session.MarkMessage(msg, "")
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
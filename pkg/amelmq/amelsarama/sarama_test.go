@@ -0,0 +1,130 @@
+package amelsarama
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/bencagri/amel/pkg/amelmq"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEngine(t *testing.T) *engine.Engine {
+	t.Helper()
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return eng
+}
+
+// testSession records the offsets of the messages marked in a session.
+type testSession struct {
+	sarama.ConsumerGroupSession
+	marked []int64
+}
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *testSession) Context() context.Context { return context.Background() }
+
+// testClaim delivers the messages with the values, at their index as offset.
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func newTestClaim(values ...string) *testClaim {
+	c := &testClaim{messages: make(chan *sarama.ConsumerMessage, len(values))}
+	for i, value := range values {
+		c.messages <- &sarama.ConsumerMessage{Topic: "payments", Value: []byte(value), Offset: int64(i)}
+	}
+	close(c.messages)
+	return c
+}
+
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// markingHandler marks every message it consumes.
+type markingHandler struct {
+	handled []int64
+}
+
+func (h *markingHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *markingHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+func (h *markingHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		h.handled = append(h.handled, msg.Offset)
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+func TestConsumerGroupHandler(t *testing.T) {
+	filter, err := amelmq.NewFilter(newTestEngine(t), `$.amount > 100`)
+	require.NoError(t, err)
+
+	inner := &markingHandler{}
+	handler := ConsumerGroupHandler(filter, inner)
+	session := &testSession{}
+	require.NoError(t, handler.Setup(session))
+	require.NoError(t, handler.ConsumeClaim(session, newTestClaim(`{"amount": 500}`, `{"amount": 5}`, `{`, `{"amount": 101}`, `{"amount": 1}`)))
+	assert.Equal(t, []int64{0, 3}, inner.handled)
+	assert.Equal(t, []int64{0, 3}, session.marked)
+
+	t.Run("handler stops early", func(t *testing.T) {
+		stop := errors.New("stop")
+		handler := ConsumerGroupHandler(filter, &stoppingHandler{err: stop})
+		err := handler.ConsumeClaim(&testSession{}, newTestClaim(`{"amount": 500}`, `{"amount": 600}`))
+		assert.ErrorIs(t, err, stop)
+	})
+}
+
+// stoppingHandler returns its error without consuming the claim.
+type stoppingHandler struct {
+	markingHandler
+	err error
+}
+
+func (h *stoppingHandler) ConsumeClaim(sarama.ConsumerGroupSession, sarama.ConsumerGroupClaim) error {
+	return h.err
+}
+
+func TestRouteHandler(t *testing.T) {
+	router, err := amelmq.NewRouter(newTestEngine(t), []amelmq.Route{
+		{Name: "fraud", DSL: `$.score > 0.9`},
+		{Name: "priority", DSL: `$.tier == "gold"`},
+	})
+	require.NoError(t, err)
+
+	routed := map[string][]int64{}
+	record := func(route string) MessageHandler {
+		return func(_ sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error {
+			routed[route] = append(routed[route], msg.Offset)
+			return nil
+		}
+	}
+	handler := RouteHandler(router, map[string]MessageHandler{
+		"fraud": record("fraud"),
+		"":      record("default"),
+	})
+	session := &testSession{}
+	claim := newTestClaim(`{"score": 0.99}`, `{"score": 0.2, "tier": "gold"}`, `{"score": 0.2}`)
+	require.NoError(t, handler.ConsumeClaim(session, claim))
+	assert.Equal(t, map[string][]int64{"fraud": {0}, "default": {2}}, routed)
+	assert.Equal(t, []int64{0, 1, 2}, session.marked, "the dropped message is marked too")
+
+	t.Run("handler error", func(t *testing.T) {
+		failed := errors.New("downstream failed")
+		handler := RouteHandler(router, map[string]MessageHandler{
+			"fraud": func(sarama.ConsumerGroupSession, *sarama.ConsumerMessage) error { return failed },
+		})
+		session := &testSession{}
+		err := handler.ConsumeClaim(session, newTestClaim(`{"score": 0.1}`, `{"score": 0.99}`, `{"score": 0.1}`))
+		assert.ErrorIs(t, err, failed)
+		assert.Equal(t, []int64{0}, session.marked)
+	})
+}
@@ -0,0 +1,240 @@
+// Package amelmq filters and routes message-broker messages with AMEL
+// expressions evaluated against their payloads.
+//
+// A Filter keeps the messages matching one expression, and a Router sends
+// each message to the first of several named routes whose expression
+// matches. Both can be reloaded with new expressions while messages are being
+// handled, so rules can change without restarting consumers.
+//
+// The package does not depend on broker clients. Handler and Dispatch wrap
+// handlers of any message type, given a function returning the message data.
+// The adapters for NATS, franz-go, and Sarama are separate modules with their
+// own dependencies: amelmq/amelnats, amelmq/amelkgo, and amelmq/amelsarama.
+package amelmq
+
+import (
+	"sync/atomic"
+
+	"github.com/bencagri/amel/pkg/engine"
+)
+
+// Decoder converts message data to a payload accepted by the engine, such as
+// a map, a protobuf message, or eval.YAML. Without a decoder the data is
+// evaluated as a JSON document.
+type Decoder func(data []byte) (interface{}, error)
+
+// ErrorFunc receives the messages that could not be decoded or evaluated.
+// They are dropped.
+type ErrorFunc func(data []byte, err error)
+
+// Option configures a Filter or Router.
+type Option func(*config)
+
+type config struct {
+	decode  Decoder
+	onError ErrorFunc
+}
+
+// WithDecoder sets the function converting message data to payloads.
+func WithDecoder(d Decoder) Option {
+	return func(c *config) {
+		c.decode = d
+	}
+}
+
+// WithErrorHandler sets the function receiving the messages that could not be
+// decoded or evaluated. By default they are dropped silently.
+func WithErrorHandler(fn ErrorFunc) Option {
+	return func(c *config) {
+		c.onError = fn
+	}
+}
+
+func newConfig(opts []Option) config {
+	var c config
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// payload decodes message data, reporting failures to the error handler.
+func (c *config) payload(data []byte) (interface{}, bool) {
+	if c.decode == nil {
+		return data, true
+	}
+	payload, err := c.decode(data)
+	if err != nil {
+		c.fail(data, err)
+		return nil, false
+	}
+	return payload, true
+}
+
+func (c *config) fail(data []byte, err error) {
+	if c.onError != nil {
+		c.onError(data, err)
+	}
+}
+
+// ============================================================================
+// Filter
+// ============================================================================
+
+// Filter keeps the messages whose payload matches an expression. It is safe
+// for concurrent use.
+type Filter struct {
+	engine *engine.Engine
+	expr   atomic.Pointer[engine.CompiledExpression]
+	config config
+}
+
+// NewFilter creates a filter for the messages matching dsl.
+func NewFilter(eng *engine.Engine, dsl string, opts ...Option) (*Filter, error) {
+	f := &Filter{engine: eng, config: newConfig(opts)}
+	if err := f.Reload(dsl); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload replaces the expression of the filter. Messages being handled finish
+// with the previous expression. If dsl does not compile the filter keeps its
+// expression and the error is returned.
+func (f *Filter) Reload(dsl string) error {
+	expr, err := f.engine.Compile(dsl)
+	if err != nil {
+		return err
+	}
+	f.expr.Store(expr)
+	return nil
+}
+
+// Source returns the expression of the filter.
+func (f *Filter) Source() string {
+	return f.expr.Load().Source
+}
+
+// Match reports whether the message data matches the filter. Messages that
+// cannot be decoded or evaluated do not match.
+func (f *Filter) Match(data []byte) bool {
+	payload, ok := f.config.payload(data)
+	if !ok {
+		return false
+	}
+	matched, err := f.engine.EvaluateBool(f.expr.Load(), payload)
+	if err != nil {
+		f.config.fail(data, err)
+		return false
+	}
+	return matched
+}
+
+// Handler wraps a message handler so that it only receives the messages
+// matching the filter. data returns the payload bytes of a message.
+func Handler[M any](f *Filter, data func(M) []byte, next func(M)) func(M) {
+	return func(msg M) {
+		if f.Match(data(msg)) {
+			next(msg)
+		}
+	}
+}
+
+// ErrHandler is like Handler for handlers returning an error. Dropped
+// messages return nil.
+func ErrHandler[M any](f *Filter, data func(M) []byte, next func(M) error) func(M) error {
+	return func(msg M) error {
+		if f.Match(data(msg)) {
+			return next(msg)
+		}
+		return nil
+	}
+}
+
+// ============================================================================
+// Router
+// ============================================================================
+
+// Route names an expression selecting the messages sent to a destination.
+type Route struct {
+	Name string `json:"name" yaml:"name"`
+	DSL  string `json:"dsl" yaml:"dsl"`
+}
+
+type compiledRoute struct {
+	name string
+	expr *engine.CompiledExpression
+}
+
+// Router sends each message to the first route whose expression matches. It
+// is safe for concurrent use.
+type Router struct {
+	engine *engine.Engine
+	routes atomic.Pointer[[]compiledRoute]
+	config config
+}
+
+// NewRouter creates a router for routes, which are tried in order.
+func NewRouter(eng *engine.Engine, routes []Route, opts ...Option) (*Router, error) {
+	r := &Router{engine: eng, config: newConfig(opts)}
+	if err := r.Reload(routes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload replaces the routes of the router. If any expression does not
+// compile the router keeps its routes and the error is returned.
+func (r *Router) Reload(routes []Route) error {
+	compiled := make([]compiledRoute, len(routes))
+	for i, route := range routes {
+		expr, err := r.engine.Compile(route.DSL)
+		if err != nil {
+			return err
+		}
+		compiled[i] = compiledRoute{name: route.Name, expr: expr}
+	}
+	r.routes.Store(&compiled)
+	return nil
+}
+
+// Routes returns the routes of the router, in order.
+func (r *Router) Routes() []Route {
+	compiled := *r.routes.Load()
+	routes := make([]Route, len(compiled))
+	for i, route := range compiled {
+		routes[i] = Route{Name: route.name, DSL: route.expr.Source}
+	}
+	return routes
+}
+
+// Route returns the name of the first route matching the message data, or ""
+// if none matches. Routes whose expression fails to evaluate are skipped.
+func (r *Router) Route(data []byte) string {
+	payload, ok := r.config.payload(data)
+	if !ok {
+		return ""
+	}
+	for _, route := range *r.routes.Load() {
+		matched, err := r.engine.EvaluateBool(route.expr, payload)
+		if err != nil {
+			r.config.fail(data, err)
+			continue
+		}
+		if matched {
+			return route.name
+		}
+	}
+	return ""
+}
+
+// Dispatch returns a message handler calling the handler of the route each
+// message matches. The handler named "" receives the messages no route
+// matches; messages without a handler are dropped.
+func Dispatch[M any](r *Router, data func(M) []byte, handlers map[string]func(M)) func(M) {
+	return func(msg M) {
+		if handle, ok := handlers[r.Route(data(msg))]; ok {
+			handle(msg)
+		}
+	}
+}
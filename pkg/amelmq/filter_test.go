@@ -0,0 +1,135 @@
+package amelmq
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMessage stands in for a broker message type, such as *nats.Msg.
+type testMessage struct {
+	Subject string
+	Data    []byte
+}
+
+func messageData(m *testMessage) []byte { return m.Data }
+
+func newTestEngine(t *testing.T) *engine.Engine {
+	t.Helper()
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return eng
+}
+
+func TestFilter(t *testing.T) {
+	var failures []string
+	filter, err := NewFilter(newTestEngine(t), `$.amount > 100`, WithErrorHandler(func(data []byte, err error) {
+		failures = append(failures, string(data))
+	}))
+	require.NoError(t, err)
+
+	assert.True(t, filter.Match([]byte(`{"amount": 150}`)))
+	assert.False(t, filter.Match([]byte(`{"amount": 50}`)))
+	assert.False(t, filter.Match([]byte(`{"amount": "x"}`)))
+	assert.Equal(t, []string{`{"amount": "x"}`}, failures)
+
+	var handled []string
+	handler := Handler(filter, messageData, func(m *testMessage) {
+		handled = append(handled, m.Subject)
+	})
+	handler(&testMessage{Subject: "big", Data: []byte(`{"amount": 500}`)})
+	handler(&testMessage{Subject: "small", Data: []byte(`{"amount": 5}`)})
+	assert.Equal(t, []string{"big"}, handled)
+
+	t.Run("reload", func(t *testing.T) {
+		require.NoError(t, filter.Reload(`$.amount > 10`))
+		assert.Equal(t, `$.amount > 10`, filter.Source())
+		assert.True(t, filter.Match([]byte(`{"amount": 50}`)))
+
+		err := filter.Reload(`$.amount >`)
+		require.Error(t, err)
+		assert.Equal(t, `$.amount > 10`, filter.Source())
+	})
+
+	t.Run("error handler", func(t *testing.T) {
+		calls := 0
+		handler := ErrHandler(filter, messageData, func(*testMessage) error {
+			calls++
+			return errors.New(errors.ErrExternalCall, "downstream failed")
+		})
+		assert.NoError(t, handler(&testMessage{Data: []byte(`{"amount": 1}`)}))
+		assert.Error(t, handler(&testMessage{Data: []byte(`{"amount": 99}`)}))
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("decoder", func(t *testing.T) {
+		// Messages carry "key=value" text rather than JSON
+		decoded, err := NewFilter(newTestEngine(t), `$.region == "eu"`, WithDecoder(func(data []byte) (interface{}, error) {
+			var payload map[string]interface{}
+			err := json.Unmarshal([]byte(`{"region": "`+string(data[len("region="):])+`"}`), &payload)
+			return payload, err
+		}))
+		require.NoError(t, err)
+		assert.True(t, decoded.Match([]byte("region=eu")))
+		assert.False(t, decoded.Match([]byte("region=us")))
+	})
+}
+
+func TestRouter(t *testing.T) {
+	router, err := NewRouter(newTestEngine(t), []Route{
+		{Name: "fraud", DSL: `$.score > 0.9`},
+		{Name: "priority", DSL: `$.tier == "gold"`},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "fraud", router.Route([]byte(`{"score": 0.95, "tier": "gold"}`)))
+	assert.Equal(t, "priority", router.Route([]byte(`{"score": 0.1, "tier": "gold"}`)))
+	assert.Equal(t, "", router.Route([]byte(`{"score": 0.1, "tier": "basic"}`)))
+
+	routed := map[string][]string{}
+	var mu sync.Mutex
+	record := func(route string) func(*testMessage) {
+		return func(m *testMessage) {
+			mu.Lock()
+			defer mu.Unlock()
+			routed[route] = append(routed[route], m.Subject)
+		}
+	}
+	dispatch := Dispatch(router, messageData, map[string]func(*testMessage){
+		"fraud": record("fraud"),
+		"":      record("default"),
+	})
+	dispatch(&testMessage{Subject: "a", Data: []byte(`{"score": 0.99}`)})
+	dispatch(&testMessage{Subject: "b", Data: []byte(`{"score": 0.2, "tier": "gold"}`)}) // No priority handler
+	dispatch(&testMessage{Subject: "c", Data: []byte(`{"score": 0.2}`)})
+	assert.Equal(t, map[string][]string{"fraud": {"a"}, "default": {"c"}}, routed)
+
+	t.Run("reload", func(t *testing.T) {
+		err := router.Reload([]Route{{Name: "broken", DSL: `(`}})
+		require.Error(t, err)
+		assert.Len(t, router.Routes(), 2)
+
+		require.NoError(t, router.Reload([]Route{{Name: "all", DSL: `true`}}))
+		assert.Equal(t, []Route{{Name: "all", DSL: `true`}}, router.Routes())
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					router.Route([]byte(`{}`))
+				}
+			}()
+		}
+		for i := 0; i < 20; i++ {
+			require.NoError(t, router.Reload([]Route{{Name: "all", DSL: `$.x == null`}}))
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,223 @@
+// Package amelmw provides net/http middleware that admits or rejects requests
+// with AMEL rules evaluated against request attributes.
+//
+// Each request is evaluated against a payload such as:
+//
+//	{
+//	  "method": "POST",
+//	  "path": "/orders/42",
+//	  "host": "api.example.com",
+//	  "remoteIP": "203.0.113.7",
+//	  "headers": {"x-tenant": "acme", "content-type": "application/json"},
+//	  "query": {"dryRun": "true"},
+//	  "claims": {"sub": "u-1", "roles": ["admin"]},
+//	  "body": {"amount": 250}
+//	}
+//
+// so that attribute-based access rules read like:
+//
+//	mux.Handle("/orders/", amelmw.Require(eng, `"admin" IN $.claims.roles || $.method == "GET"`)(orders))
+//
+// Header names are lower case. Headers and query parameters with several
+// values are joined with commas. Claims come from ContextWithClaims, usually
+// set by authentication middleware, or from WithClaims. The body is included
+// only with WithBody.
+package amelmw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/engine"
+)
+
+type claimsKey struct{}
+
+// ContextWithClaims returns a context carrying the claims of the
+// authenticated caller, such as the claims of a verified JWT. Rules read them
+// as $.claims.
+func ContextWithClaims(ctx context.Context, claims interface{}) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims set with ContextWithClaims, or nil.
+func ClaimsFromContext(ctx context.Context) interface{} {
+	return ctx.Value(claimsKey{})
+}
+
+// Option configures a Gate.
+type Option func(*Gate)
+
+// WithClaims sets the function returning the claims of a request, for
+// authentication libraries that do not use ContextWithClaims.
+func WithClaims(fn func(r *http.Request) interface{}) Option {
+	return func(g *Gate) {
+		g.claims = fn
+	}
+}
+
+// WithBody includes JSON request bodies of up to maxBytes bytes in the
+// payload as $.body. The body is restored for the next handler. Larger
+// bodies are rejected with 413 Request Entity Too Large; bodies that are not
+// JSON are left out of the payload.
+func WithBody(maxBytes int64) Option {
+	return func(g *Gate) {
+		g.maxBodyBytes = maxBytes
+	}
+}
+
+// WithDenied sets the handler receiving the requests the rule rejects,
+// instead of replying 403 Forbidden. Use it to route rejected requests, for
+// example to a challenge page or a restricted variant of the endpoint.
+func WithDenied(h http.Handler) Option {
+	return func(g *Gate) {
+		g.denied = h
+	}
+}
+
+// WithErrorHandler sets the function receiving the errors of requests whose
+// rule failed to evaluate. Such requests are always denied.
+func WithErrorHandler(fn func(r *http.Request, err error)) Option {
+	return func(g *Gate) {
+		g.onError = fn
+	}
+}
+
+// Gate admits the requests for which a rule is truthy. It is safe for
+// concurrent use.
+type Gate struct {
+	engine       *engine.Engine
+	expr         *engine.CompiledExpression
+	claims       func(r *http.Request) interface{}
+	maxBodyBytes int64
+	denied       http.Handler
+	onError      func(r *http.Request, err error)
+}
+
+// New creates a gate for rule, returning an error if the rule does not
+// compile.
+func New(eng *engine.Engine, rule string, opts ...Option) (*Gate, error) {
+	expr, err := eng.Compile(rule)
+	if err != nil {
+		return nil, err
+	}
+	g := &Gate{
+		engine: eng,
+		expr:   expr,
+		claims: func(r *http.Request) interface{} { return ClaimsFromContext(r.Context()) },
+		denied: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		}),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g, nil
+}
+
+// Require returns middleware that passes the requests for which rule is
+// truthy to the next handler and denies the others. It panics if the rule
+// does not compile, as rules are usually constants; use New for rules loaded
+// at run time.
+func Require(eng *engine.Engine, rule string, opts ...Option) func(http.Handler) http.Handler {
+	g, err := New(eng, rule, opts...)
+	if err != nil {
+		panic("amelmw: " + err.Error())
+	}
+	return g.Middleware
+}
+
+// Middleware wraps next so that it only receives the requests the gate admits.
+func (g *Gate) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := g.payload(r)
+		if err != nil {
+			status := http.StatusBadRequest
+			if _, ok := err.(*http.MaxBytesError); ok {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		allowed, err := g.engine.EvaluateBool(g.expr, payload)
+		if err != nil {
+			if g.onError != nil {
+				g.onError(r, err)
+			}
+			allowed = false
+		}
+		if !allowed {
+			g.denied.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Allow reports whether the gate admits the request, without calling a
+// handler. The error is non-nil if the body cannot be read or the rule fails
+// to evaluate.
+func (g *Gate) Allow(r *http.Request) (bool, error) {
+	payload, err := g.payload(r)
+	if err != nil {
+		return false, err
+	}
+	return g.engine.EvaluateBool(g.expr, payload)
+}
+
+// payload builds the evaluation payload of a request, as JSON. It returns an
+// *http.MaxBytesError if the body is too large.
+func (g *Gate) payload(r *http.Request) ([]byte, error) {
+	payload := map[string]interface{}{
+		"method":   r.Method,
+		"path":     r.URL.Path,
+		"host":     r.Host,
+		"remoteIP": remoteIP(r.RemoteAddr),
+		"headers":  joinValues(r.Header, strings.ToLower),
+		"query":    joinValues(r.URL.Query(), nil),
+	}
+	if claims := g.claims(r); claims != nil {
+		payload["claims"] = claims
+	}
+
+	if g.maxBodyBytes > 0 && r.Body != nil && r.Body != http.NoBody {
+		data, err := io.ReadAll(io.LimitReader(r.Body, g.maxBodyBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > g.maxBodyBytes {
+			return nil, &http.MaxBytesError{Limit: g.maxBodyBytes}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		if json.Valid(data) {
+			payload["body"] = json.RawMessage(data)
+		}
+	}
+	return json.Marshal(payload)
+}
+
+// joinValues converts multi-valued headers or query parameters to a map of
+// comma-joined values, optionally normalizing the keys.
+func joinValues(values map[string][]string, key func(string) string) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if key != nil {
+			k = key(k)
+		}
+		result[k] = strings.Join(v, ",")
+	}
+	return result
+}
+
+// remoteIP returns the IP address of a host:port remote address.
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,118 @@
+package amelmw
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEngine(t *testing.T) *engine.Engine {
+	t.Helper()
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return eng
+}
+
+// echo replies 200 with the request body.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	_, _ = w.Write(body)
+})
+
+// mapClaims mimics claim types of JWT libraries.
+type mapClaims map[string]interface{}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRequire(t *testing.T) {
+	eng := newTestEngine(t)
+	h := Require(eng, `$.method == "GET" || ("admin" IN $.claims.roles && $.headers["x-tenant"] == "acme")`)(echo)
+
+	t.Run("request attributes", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(h, httptest.NewRequest("GET", "/orders", nil)).Code)
+
+		r := httptest.NewRequest("DELETE", "/orders/1", nil)
+		assert.Equal(t, http.StatusForbidden, serve(h, r).Code)
+
+		r = httptest.NewRequest("DELETE", "/orders/1", nil)
+		r.Header.Set("X-Tenant", "acme")
+		r = r.WithContext(ContextWithClaims(r.Context(), mapClaims{"roles": []string{"admin"}}))
+		assert.Equal(t, http.StatusOK, serve(h, r).Code)
+	})
+
+	t.Run("path, query, and remote address", func(t *testing.T) {
+		h := Require(eng, `startsWith($.path, "/public/") && $.query.lang == "en,de" && $.remoteIP == "192.0.2.1"`)(echo)
+		r := httptest.NewRequest("GET", "/public/docs?lang=en&lang=de", nil)
+		assert.Equal(t, http.StatusOK, serve(h, r).Code)
+		r = httptest.NewRequest("GET", "/private/docs?lang=en&lang=de", nil)
+		assert.Equal(t, http.StatusForbidden, serve(h, r).Code)
+	})
+
+	t.Run("invalid rule panics", func(t *testing.T) {
+		assert.Panics(t, func() { Require(eng, `$.method ==`) })
+		_, err := New(eng, `$.method ==`)
+		assert.Error(t, err)
+	})
+}
+
+func TestGateOptions(t *testing.T) {
+	eng := newTestEngine(t)
+
+	t.Run("body", func(t *testing.T) {
+		h := Require(eng, `$.body.amount <= 100`, WithBody(64))(echo)
+
+		w := serve(h, httptest.NewRequest("POST", "/pay", strings.NewReader(`{"amount": 50}`)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"amount": 50}`, w.Body.String(), "body is restored for the handler")
+
+		w = serve(h, httptest.NewRequest("POST", "/pay", strings.NewReader(`{"amount": 500}`)))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = serve(h, httptest.NewRequest("POST", "/pay", strings.NewReader(`{"amount": 1, "memo": "`+strings.Repeat("x", 64)+`"}`)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("denied handler routes rejected requests", func(t *testing.T) {
+		limited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+		h := Require(eng, `$.headers["x-plan"] == "pro"`, WithDenied(limited))(echo)
+		assert.Equal(t, http.StatusTeapot, serve(h, httptest.NewRequest("GET", "/", nil)).Code)
+	})
+
+	t.Run("claims function", func(t *testing.T) {
+		h := Require(eng, `$.claims.sub == "u-1"`, WithClaims(func(r *http.Request) interface{} {
+			return map[string]string{"sub": r.Header.Get("X-User")}
+		}))(echo)
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-User", "u-1")
+		assert.Equal(t, http.StatusOK, serve(h, r).Code)
+	})
+
+	t.Run("evaluation errors deny", func(t *testing.T) {
+		var failed error
+		h := Require(eng, `$.query.n * 2 > 3`, WithErrorHandler(func(r *http.Request, err error) {
+			failed = err
+		}))(echo)
+		assert.Equal(t, http.StatusForbidden, serve(h, httptest.NewRequest("GET", "/?n=x", nil)).Code)
+		assert.Error(t, failed)
+	})
+
+	t.Run("allow", func(t *testing.T) {
+		g, err := New(eng, `$.method == "GET"`)
+		require.NoError(t, err)
+		ok, err := g.Allow(httptest.NewRequest("GET", "/", nil))
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/bencagri/amel/pkg/lexer"
 )
@@ -47,6 +48,16 @@ func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 
+// DurationLiteral represents a duration literal (e.g., 5m or 2h30m).
+type DurationLiteral struct {
+	Token lexer.Token
+	Value time.Duration
+}
+
+func (dl *DurationLiteral) expressionNode()      {}
+func (dl *DurationLiteral) TokenLiteral() string { return dl.Token.Literal }
+func (dl *DurationLiteral) String() string       { return dl.Token.Literal }
+
 // StringLiteral represents a string literal (e.g., "hello").
 type StringLiteral struct {
 	Token lexer.Token
@@ -96,6 +107,29 @@ func (ll *ListLiteral) String() string {
 	return out.String()
 }
 
+// MapLiteral represents a map literal (e.g., {"name": $.name, "total": 3}).
+// Keys are kept in source order.
+type MapLiteral struct {
+	Token  lexer.Token // The '{' token
+	Keys   []string
+	Values []Expression
+}
+
+func (ml *MapLiteral) expressionNode()      {}
+func (ml *MapLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MapLiteral) String() string {
+	var out bytes.Buffer
+	out.WriteString("{")
+	for i, key := range ml.Keys {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		out.WriteString(fmt.Sprintf("%q: %s", key, ml.Values[i].String()))
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
 // ============================================================================
 // Identifier and Path Expressions
 // ============================================================================
@@ -213,6 +247,37 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// ============================================================================
+// Slice Expression
+// ============================================================================
+
+// SliceExpression represents a slice of a string or list (e.g., code[0:3]).
+// Start and End are nil when omitted, as in code[:3] and code[1:].
+type SliceExpression struct {
+	Token lexer.Token // The '[' token
+	Left  Expression  // The expression being sliced
+	Start Expression  // The first index, or nil for the beginning
+	End   Expression  // The index after the last, or nil for the end
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+	return out.String()
+}
+
 // ============================================================================
 // Member Access Expression
 // ============================================================================
@@ -241,7 +306,7 @@ func (me *MemberExpression) String() string {
 // ============================================================================
 
 // ConditionalExpression represents a ternary conditional (condition ? then : else).
-// Note: This is for future use if we add ternary operator support.
+// Only the branch selected by the condition is evaluated.
 type ConditionalExpression struct {
 	Token       lexer.Token // The '?' token
 	Condition   Expression
@@ -263,6 +328,46 @@ func (ce *ConditionalExpression) String() string {
 	return out.String()
 }
 
+// ============================================================================
+// Case Expression
+// ============================================================================
+
+// CaseExpression represents a case expression
+// (e.g., case { $.tier == "gold" => 0.2; $.tier == "silver" => 0.1; else => 0 }).
+// The conditions are tested in order and only the result of the first one
+// that holds is evaluated. Default, the result of the else arm, is evaluated
+// if none holds; it is nil if there is no else arm, and the case is null.
+type CaseExpression struct {
+	Token      lexer.Token // The 'case' token
+	Conditions []Expression
+	Results    []Expression // Results[i] is the result of Conditions[i]
+	Default    Expression   // Nil without an else arm
+}
+
+func (ce *CaseExpression) expressionNode()      {}
+func (ce *CaseExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CaseExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("case { ")
+	for i, cond := range ce.Conditions {
+		if i > 0 {
+			out.WriteString("; ")
+		}
+		out.WriteString(cond.String())
+		out.WriteString(" => ")
+		out.WriteString(ce.Results[i].String())
+	}
+	if ce.Default != nil {
+		if len(ce.Conditions) > 0 {
+			out.WriteString("; ")
+		}
+		out.WriteString("else => ")
+		out.WriteString(ce.Default.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
 // ============================================================================
 // Grouped Expression
 // ============================================================================
@@ -366,3 +471,66 @@ func (le *LambdaExpression) String() string {
 	out.WriteString(le.Body.String())
 	return out.String()
 }
+
+// ============================================================================
+// Traversal
+// ============================================================================
+
+// Inspect traverses an AST in depth-first order, calling fn for each expression.
+// If fn returns false, the children of that expression are not visited.
+// The property identifier of a MemberExpression is not visited, since it is a
+// name rather than an expression.
+func Inspect(node Expression, fn func(Expression) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *ListLiteral:
+		for _, el := range n.Elements {
+			Inspect(el, fn)
+		}
+	case *MapLiteral:
+		for _, v := range n.Values {
+			Inspect(v, fn)
+		}
+	case *BinaryExpression:
+		Inspect(n.Left, fn)
+		Inspect(n.Right, fn)
+	case *UnaryExpression:
+		Inspect(n.Operand, fn)
+	case *FunctionCall:
+		for _, arg := range n.Arguments {
+			Inspect(arg, fn)
+		}
+	case *IndexExpression:
+		Inspect(n.Left, fn)
+		Inspect(n.Index, fn)
+	case *SliceExpression:
+		Inspect(n.Left, fn)
+		Inspect(n.Start, fn)
+		Inspect(n.End, fn)
+	case *MemberExpression:
+		Inspect(n.Object, fn)
+	case *ConditionalExpression:
+		Inspect(n.Condition, fn)
+		Inspect(n.Consequence, fn)
+		Inspect(n.Alternative, fn)
+	case *CaseExpression:
+		for i, cond := range n.Conditions {
+			Inspect(cond, fn)
+			Inspect(n.Results[i], fn)
+		}
+		Inspect(n.Default, fn)
+	case *GroupedExpression:
+		Inspect(n.Expression, fn)
+	case *InExpression:
+		Inspect(n.Left, fn)
+		Inspect(n.Right, fn)
+	case *RegexExpression:
+		Inspect(n.Left, fn)
+		Inspect(n.Pattern, fn)
+	case *LambdaExpression:
+		Inspect(n.Body, fn)
+	}
+}
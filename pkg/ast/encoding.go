@@ -0,0 +1,439 @@
+// Package ast defines the Abstract Syntax Tree nodes for the AMEL DSL.
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bencagri/amel/pkg/lexer"
+)
+
+// Node kinds used in the serialized form. They are part of the compiled
+// expression format and must not be renamed.
+const (
+	kindInteger     = "int"
+	kindFloat       = "float"
+	kindString      = "string"
+	kindBoolean     = "bool"
+	kindNull        = "null"
+	kindList        = "list"
+	kindIdentifier  = "ident"
+	kindJSONPath    = "path"
+	kindBinary      = "binary"
+	kindUnary       = "unary"
+	kindCall        = "call"
+	kindIndex       = "index"
+	kindMember      = "member"
+	kindConditional = "cond"
+	kindGrouped     = "group"
+	kindIn          = "in"
+	kindRegex       = "regex"
+	kindLambda      = "lambda"
+	kindDuration    = "duration"
+	kindMap         = "map"
+	kindSlice       = "slice"
+	kindCase        = "case"
+)
+
+// encodedToken is the serialized form of a lexer.Token.
+type encodedToken struct {
+	Type    lexer.TokenType `json:"t"`
+	Literal string          `json:"l,omitempty"`
+	Line    int             `json:"ln,omitempty"`
+	Column  int             `json:"col,omitempty"`
+}
+
+// encodedNode is the serialized form of an expression. Only the fields used by
+// the node kind are set.
+type encodedNode struct {
+	Kind     string         `json:"k"`
+	Token    encodedToken   `json:"tok"`
+	Int      int64          `json:"i,omitempty"`
+	Float    float64        `json:"f,omitempty"`
+	Str      string         `json:"s,omitempty"`
+	Bool     bool           `json:"b,omitempty"`
+	Operator string         `json:"op,omitempty"`
+	Children []*encodedNode `json:"c,omitempty"`
+	Params   []*encodedNode `json:"p,omitempty"`
+	Keys     []string       `json:"ks,omitempty"`
+}
+
+// Marshal encodes an expression tree, including token positions, as JSON.
+// The result can be decoded with Unmarshal.
+func Marshal(expr Expression) ([]byte, error) {
+	node, err := encodeNode(expr)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(node)
+}
+
+// Unmarshal decodes an expression tree produced by Marshal.
+func Unmarshal(data []byte) (Expression, error) {
+	var node encodedNode
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("ast: %w", err)
+	}
+	return decodeNode(&node)
+}
+
+func encodeToken(tok lexer.Token) encodedToken {
+	return encodedToken{Type: tok.Type, Literal: tok.Literal, Line: tok.Line, Column: tok.Column}
+}
+
+func decodeToken(tok encodedToken) lexer.Token {
+	return lexer.Token{Type: tok.Type, Literal: tok.Literal, Line: tok.Line, Column: tok.Column}
+}
+
+func encodeNodes(exprs []Expression) ([]*encodedNode, error) {
+	nodes := make([]*encodedNode, len(exprs))
+	for i, expr := range exprs {
+		node, err := encodeNode(expr)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+func encodeNode(expr Expression) (*encodedNode, error) {
+	switch n := expr.(type) {
+	case *IntegerLiteral:
+		return &encodedNode{Kind: kindInteger, Token: encodeToken(n.Token), Int: n.Value}, nil
+	case *FloatLiteral:
+		return &encodedNode{Kind: kindFloat, Token: encodeToken(n.Token), Float: n.Value}, nil
+	case *DurationLiteral:
+		return &encodedNode{Kind: kindDuration, Token: encodeToken(n.Token), Int: int64(n.Value)}, nil
+	case *StringLiteral:
+		return &encodedNode{Kind: kindString, Token: encodeToken(n.Token), Str: n.Value}, nil
+	case *BooleanLiteral:
+		return &encodedNode{Kind: kindBoolean, Token: encodeToken(n.Token), Bool: n.Value}, nil
+	case *NullLiteral:
+		return &encodedNode{Kind: kindNull, Token: encodeToken(n.Token)}, nil
+	case *ListLiteral:
+		elements, err := encodeNodes(n.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindList, Token: encodeToken(n.Token), Children: elements}, nil
+	case *MapLiteral:
+		values, err := encodeNodes(n.Values)
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindMap, Token: encodeToken(n.Token), Keys: n.Keys, Children: values}, nil
+	case *Identifier:
+		return &encodedNode{Kind: kindIdentifier, Token: encodeToken(n.Token), Str: n.Value}, nil
+	case *JSONPathExpression:
+		return &encodedNode{Kind: kindJSONPath, Token: encodeToken(n.Token), Str: n.Path}, nil
+	case *BinaryExpression:
+		children, err := encodeNodes([]Expression{n.Left, n.Right})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindBinary, Token: encodeToken(n.Token), Operator: n.Operator, Children: children}, nil
+	case *UnaryExpression:
+		children, err := encodeNodes([]Expression{n.Operand})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindUnary, Token: encodeToken(n.Token), Operator: n.Operator, Children: children}, nil
+	case *FunctionCall:
+		args, err := encodeNodes(n.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindCall, Token: encodeToken(n.Token), Str: n.Name, Children: args}, nil
+	case *IndexExpression:
+		children, err := encodeNodes([]Expression{n.Left, n.Index})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindIndex, Token: encodeToken(n.Token), Children: children}, nil
+	case *SliceExpression:
+		children, err := encodeOptionalNodes([]Expression{n.Left, n.Start, n.End})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindSlice, Token: encodeToken(n.Token), Children: children}, nil
+	case *MemberExpression:
+		children, err := encodeNodes([]Expression{n.Object, n.Property})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindMember, Token: encodeToken(n.Token), Children: children}, nil
+	case *ConditionalExpression:
+		children, err := encodeNodes([]Expression{n.Condition, n.Consequence, n.Alternative})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindConditional, Token: encodeToken(n.Token), Children: children}, nil
+	case *CaseExpression:
+		// Conditions and results alternate; the default, or null, comes last
+		arms := make([]Expression, 0, 2*len(n.Conditions)+1)
+		for i, cond := range n.Conditions {
+			arms = append(arms, cond, n.Results[i])
+		}
+		children, err := encodeOptionalNodes(append(arms, n.Default))
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children[:len(arms)] {
+			if child == nil {
+				return nil, fmt.Errorf("ast: cannot encode nil expression")
+			}
+		}
+		return &encodedNode{Kind: kindCase, Token: encodeToken(n.Token), Children: children}, nil
+	case *GroupedExpression:
+		children, err := encodeNodes([]Expression{n.Expression})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindGrouped, Token: encodeToken(n.Token), Children: children}, nil
+	case *InExpression:
+		children, err := encodeNodes([]Expression{n.Left, n.Right})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindIn, Token: encodeToken(n.Token), Bool: n.Negated, Children: children}, nil
+	case *RegexExpression:
+		children, err := encodeNodes([]Expression{n.Left, n.Pattern})
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindRegex, Token: encodeToken(n.Token), Bool: n.Negated, Children: children}, nil
+	case *LambdaExpression:
+		params := make([]Expression, len(n.Parameters))
+		for i, p := range n.Parameters {
+			params[i] = p
+		}
+		encodedParams, err := encodeNodes(params)
+		if err != nil {
+			return nil, err
+		}
+		body, err := encodeNode(n.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &encodedNode{Kind: kindLambda, Token: encodeToken(n.Token), Params: encodedParams, Children: []*encodedNode{body}}, nil
+	case nil:
+		return nil, fmt.Errorf("ast: cannot encode nil expression")
+	default:
+		return nil, fmt.Errorf("ast: cannot encode node of type %T", expr)
+	}
+}
+
+// encodeOptionalNodes encodes expressions that may be nil, such as the bounds
+// of a slice, as null entries.
+func encodeOptionalNodes(exprs []Expression) ([]*encodedNode, error) {
+	nodes := make([]*encodedNode, len(exprs))
+	for i, expr := range exprs {
+		if expr == nil {
+			continue
+		}
+		node, err := encodeNode(expr)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// decodeOptional decodes a node that may be null.
+func decodeOptional(node *encodedNode) (Expression, error) {
+	if node == nil {
+		return nil, nil
+	}
+	return decodeNode(node)
+}
+
+func decodeNodes(nodes []*encodedNode) ([]Expression, error) {
+	exprs := make([]Expression, len(nodes))
+	for i, node := range nodes {
+		expr, err := decodeNode(node)
+		if err != nil {
+			return nil, err
+		}
+		exprs[i] = expr
+	}
+	return exprs, nil
+}
+
+// decodeChildren decodes the children of a node that has a fixed arity.
+func decodeChildren(node *encodedNode, want int) ([]Expression, error) {
+	if len(node.Children) != want {
+		return nil, fmt.Errorf("ast: %s node has %d children, want %d", node.Kind, len(node.Children), want)
+	}
+	return decodeNodes(node.Children)
+}
+
+func decodeIdentifier(node *encodedNode) (*Identifier, error) {
+	expr, err := decodeNode(node)
+	if err != nil {
+		return nil, err
+	}
+	ident, ok := expr.(*Identifier)
+	if !ok {
+		return nil, fmt.Errorf("ast: expected identifier, got %s node", node.Kind)
+	}
+	return ident, nil
+}
+
+func decodeNode(node *encodedNode) (Expression, error) {
+	if node == nil {
+		return nil, fmt.Errorf("ast: missing node")
+	}
+	tok := decodeToken(node.Token)
+
+	switch node.Kind {
+	case kindInteger:
+		return &IntegerLiteral{Token: tok, Value: node.Int}, nil
+	case kindFloat:
+		return &FloatLiteral{Token: tok, Value: node.Float}, nil
+	case kindDuration:
+		return &DurationLiteral{Token: tok, Value: time.Duration(node.Int)}, nil
+	case kindString:
+		return &StringLiteral{Token: tok, Value: node.Str}, nil
+	case kindBoolean:
+		return &BooleanLiteral{Token: tok, Value: node.Bool}, nil
+	case kindNull:
+		return &NullLiteral{Token: tok}, nil
+	case kindList:
+		elements, err := decodeNodes(node.Children)
+		if err != nil {
+			return nil, err
+		}
+		return &ListLiteral{Token: tok, Elements: elements}, nil
+	case kindMap:
+		c, err := decodeChildren(node, len(node.Keys))
+		if err != nil {
+			return nil, err
+		}
+		return &MapLiteral{Token: tok, Keys: node.Keys, Values: c}, nil
+	case kindIdentifier:
+		return &Identifier{Token: tok, Value: node.Str}, nil
+	case kindJSONPath:
+		return &JSONPathExpression{Token: tok, Path: node.Str}, nil
+	case kindBinary:
+		c, err := decodeChildren(node, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpression{Token: tok, Left: c[0], Operator: node.Operator, Right: c[1]}, nil
+	case kindUnary:
+		c, err := decodeChildren(node, 1)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpression{Token: tok, Operator: node.Operator, Operand: c[0]}, nil
+	case kindCall:
+		args, err := decodeNodes(node.Children)
+		if err != nil {
+			return nil, err
+		}
+		return &FunctionCall{Token: tok, Name: node.Str, Arguments: args}, nil
+	case kindIndex:
+		c, err := decodeChildren(node, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &IndexExpression{Token: tok, Left: c[0], Index: c[1]}, nil
+	case kindSlice:
+		if len(node.Children) != 3 {
+			return nil, fmt.Errorf("ast: slice node has %d children, want 3", len(node.Children))
+		}
+		left, err := decodeNode(node.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		start, err := decodeOptional(node.Children[1])
+		if err != nil {
+			return nil, err
+		}
+		end, err := decodeOptional(node.Children[2])
+		if err != nil {
+			return nil, err
+		}
+		return &SliceExpression{Token: tok, Left: left, Start: start, End: end}, nil
+	case kindMember:
+		if len(node.Children) != 2 {
+			return nil, fmt.Errorf("ast: member node has %d children, want 2", len(node.Children))
+		}
+		object, err := decodeNode(node.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		property, err := decodeIdentifier(node.Children[1])
+		if err != nil {
+			return nil, err
+		}
+		return &MemberExpression{Token: tok, Object: object, Property: property}, nil
+	case kindConditional:
+		c, err := decodeChildren(node, 3)
+		if err != nil {
+			return nil, err
+		}
+		return &ConditionalExpression{Token: tok, Condition: c[0], Consequence: c[1], Alternative: c[2]}, nil
+	case kindCase:
+		if len(node.Children)%2 != 1 {
+			return nil, fmt.Errorf("ast: case node has %d children, want an odd number", len(node.Children))
+		}
+		if len(node.Children) == 1 && node.Children[0] == nil {
+			return nil, fmt.Errorf("ast: case node has no arms")
+		}
+		arms, err := decodeNodes(node.Children[:len(node.Children)-1])
+		if err != nil {
+			return nil, err
+		}
+		def, err := decodeOptional(node.Children[len(node.Children)-1])
+		if err != nil {
+			return nil, err
+		}
+		expr := &CaseExpression{Token: tok, Default: def}
+		for i := 0; i < len(arms); i += 2 {
+			expr.Conditions = append(expr.Conditions, arms[i])
+			expr.Results = append(expr.Results, arms[i+1])
+		}
+		return expr, nil
+	case kindGrouped:
+		c, err := decodeChildren(node, 1)
+		if err != nil {
+			return nil, err
+		}
+		return &GroupedExpression{Token: tok, Expression: c[0]}, nil
+	case kindIn:
+		c, err := decodeChildren(node, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &InExpression{Token: tok, Left: c[0], Right: c[1], Negated: node.Bool}, nil
+	case kindRegex:
+		c, err := decodeChildren(node, 2)
+		if err != nil {
+			return nil, err
+		}
+		return &RegexExpression{Token: tok, Left: c[0], Pattern: c[1], Negated: node.Bool}, nil
+	case kindLambda:
+		if len(node.Children) != 1 {
+			return nil, fmt.Errorf("ast: lambda node has %d children, want 1", len(node.Children))
+		}
+		params := make([]*Identifier, len(node.Params))
+		for i, p := range node.Params {
+			ident, err := decodeIdentifier(p)
+			if err != nil {
+				return nil, err
+			}
+			params[i] = ident
+		}
+		body, err := decodeNode(node.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		return &LambdaExpression{Token: tok, Parameters: params, Body: body}, nil
+	default:
+		return nil, fmt.Errorf("ast: unknown node kind %q", node.Kind)
+	}
+}
@@ -0,0 +1,39 @@
+// Package ast defines the Abstract Syntax Tree nodes for the AMEL DSL.
+package ast
+
+import "sort"
+
+// ExtractPaths returns the payload paths an expression reads, such as
+// "$.user.age", sorted and without duplicates. Paths are reported as written,
+// so "$.items" also stands for the fields of its elements that lambdas read,
+// as in any($.items, x => x.price > 10).
+func ExtractPaths(expr Expression) []string {
+	seen := make(map[string]bool)
+	paths := []string{}
+	Inspect(expr, func(node Expression) bool {
+		if n, ok := node.(*JSONPathExpression); ok && !seen[n.Path] {
+			seen[n.Path] = true
+			paths = append(paths, n.Path)
+		}
+		return true
+	})
+	sort.Strings(paths)
+	return paths
+}
+
+// ExtractFunctions returns the names of the functions an expression calls,
+// including higher-order functions such as map and calls inside lambdas,
+// sorted and without duplicates.
+func ExtractFunctions(expr Expression) []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	Inspect(expr, func(node Expression) bool {
+		if n, ok := node.(*FunctionCall); ok && !seen[n.Name] {
+			seen[n.Name] = true
+			names = append(names, n.Name)
+		}
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
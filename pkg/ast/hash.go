@@ -0,0 +1,165 @@
+// Package ast defines the Abstract Syntax Tree nodes for the AMEL DSL.
+package ast
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Hash returns a stable identity of an expression as "sha256:" followed by
+// hex digits. Expressions that differ only in whitespace, comments,
+// parentheses, the spelling of operators (and, AND, &&), the quoting and
+// escaping of strings, the formatting of numbers (1e3, 1000.0), or the names
+// of lambda parameters have the same hash. It suits cache keys, audit
+// correlation, and finding duplicate rules.
+func Hash(expr Expression) string {
+	h := &hasher{}
+	h.write(expr)
+	sum := sha256.Sum256([]byte(h.sb.String()))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// hasher writes the canonical form of an expression: a prefix notation that
+// keeps only what affects evaluation.
+type hasher struct {
+	sb     strings.Builder
+	scopes []map[string]int // Lambda parameters by name, innermost last
+	params int              // Lambda parameters declared so far
+}
+
+func (h *hasher) write(expr Expression) {
+	switch n := expr.(type) {
+	case nil:
+		h.sb.WriteString("nil")
+	case *IntegerLiteral:
+		h.sb.WriteString("i:")
+		h.sb.WriteString(strconv.FormatInt(n.Value, 10))
+	case *FloatLiteral:
+		h.sb.WriteString("f:")
+		h.sb.WriteString(strconv.FormatFloat(n.Value, 'g', -1, 64))
+	case *DurationLiteral:
+		h.sb.WriteString("d:")
+		h.sb.WriteString(strconv.FormatInt(int64(n.Value), 10))
+	case *StringLiteral:
+		h.sb.WriteString("s:")
+		h.sb.WriteString(strconv.Quote(n.Value))
+	case *BooleanLiteral:
+		h.sb.WriteString(strconv.FormatBool(n.Value))
+	case *NullLiteral:
+		h.sb.WriteString("null")
+	case *ListLiteral:
+		h.list("list", n.Elements...)
+	case *MapLiteral:
+		h.sb.WriteString("(map")
+		for i, key := range n.Keys {
+			h.sb.WriteByte(' ')
+			h.sb.WriteString(strconv.Quote(key))
+			h.sb.WriteByte(':')
+			h.write(n.Values[i])
+		}
+		h.sb.WriteByte(')')
+	case *Identifier:
+		h.identifier(n.Value)
+	case *JSONPathExpression:
+		h.sb.WriteString("path:")
+		h.sb.WriteString(strconv.Quote(n.Path))
+	case *BinaryExpression:
+		h.list(canonicalOperator(n.Operator), n.Left, n.Right)
+	case *UnaryExpression:
+		h.list("unary"+canonicalOperator(n.Operator), n.Operand)
+	case *FunctionCall:
+		h.list("call:"+n.Name, n.Arguments...)
+	case *IndexExpression:
+		h.list("index", n.Left, n.Index)
+	case *SliceExpression:
+		h.list("slice", n.Left, n.Start, n.End)
+	case *MemberExpression:
+		h.list("member", n.Object)
+		h.sb.WriteString(strconv.Quote(n.Property.Value))
+	case *ConditionalExpression:
+		h.list("cond", n.Condition, n.Consequence, n.Alternative)
+	case *CaseExpression:
+		arms := make([]Expression, 0, 2*len(n.Conditions)+1)
+		for i, cond := range n.Conditions {
+			arms = append(arms, cond, n.Results[i])
+		}
+		h.list("case", append(arms, n.Default)...)
+	case *GroupedExpression:
+		h.write(n.Expression)
+	case *InExpression:
+		op := "in"
+		if n.Negated {
+			op = "notin"
+		}
+		h.list(op, n.Left, n.Right)
+	case *RegexExpression:
+		op := "match"
+		if n.Negated {
+			op = "notmatch"
+		}
+		h.list(op, n.Left, n.Pattern)
+	case *LambdaExpression:
+		h.lambda(n)
+	default:
+		// Unknown node types are told apart by their printed form
+		h.sb.WriteString("node:")
+		h.sb.WriteString(strconv.Quote(expr.String()))
+	}
+}
+
+// list writes a node with its children as (name child...).
+func (h *hasher) list(name string, children ...Expression) {
+	h.sb.WriteByte('(')
+	h.sb.WriteString(name)
+	for _, child := range children {
+		h.sb.WriteByte(' ')
+		h.write(child)
+	}
+	h.sb.WriteByte(')')
+}
+
+// identifier writes a lambda parameter by its position of declaration, so
+// that renaming parameters does not change the hash, and other identifiers
+// by name.
+func (h *hasher) identifier(name string) {
+	for i := len(h.scopes) - 1; i >= 0; i-- {
+		if param, ok := h.scopes[i][name]; ok {
+			h.sb.WriteString("param:")
+			h.sb.WriteString(strconv.Itoa(param))
+			return
+		}
+	}
+	h.sb.WriteString("ident:")
+	h.sb.WriteString(name)
+}
+
+func (h *hasher) lambda(n *LambdaExpression) {
+	scope := make(map[string]int, len(n.Parameters))
+	h.sb.WriteString("(lambda")
+	for _, param := range n.Parameters {
+		scope[param.Value] = h.params
+		h.sb.WriteString(" param:")
+		h.sb.WriteString(strconv.Itoa(h.params))
+		h.params++
+	}
+	h.scopes = append(h.scopes, scope)
+	h.sb.WriteByte(' ')
+	h.write(n.Body)
+	h.scopes = h.scopes[:len(h.scopes)-1]
+	h.sb.WriteByte(')')
+}
+
+// canonicalOperator normalizes the keyword spellings of operators.
+func canonicalOperator(op string) string {
+	switch strings.ToLower(op) {
+	case "and":
+		return "&&"
+	case "or":
+		return "||"
+	case "not":
+		return "!"
+	}
+	return op
+}
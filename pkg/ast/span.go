@@ -0,0 +1,174 @@
+// Package ast defines the Abstract Syntax Tree nodes for the AMEL DSL.
+package ast
+
+import (
+	"strconv"
+
+	"github.com/bencagri/amel/pkg/lexer"
+)
+
+// Span is the source range of a node. Lines and columns start at 1, and the
+// end is just after the last character of the node.
+type Span struct {
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+}
+
+// SpanOf returns the source range of a node. Parentheses around the node are
+// not part of it, and closing brackets are assumed to directly follow the
+// last element.
+func SpanOf(node Expression) Span {
+	start := nodeStart(node)
+	endLine, endColumn := nodeEnd(node)
+	return Span{Line: start.Line, Column: start.Column, EndLine: endLine, EndColumn: endColumn}
+}
+
+// nodeStart returns the first token of a node.
+func nodeStart(node Expression) lexer.Token {
+	switch n := node.(type) {
+	case *BinaryExpression:
+		return nodeStart(n.Left)
+	case *InExpression:
+		return nodeStart(n.Left)
+	case *RegexExpression:
+		return nodeStart(n.Left)
+	case *IndexExpression:
+		return nodeStart(n.Left)
+	case *SliceExpression:
+		return nodeStart(n.Left)
+	case *MemberExpression:
+		return nodeStart(n.Object)
+	case *ConditionalExpression:
+		return nodeStart(n.Condition)
+	case *LambdaExpression:
+		if len(n.Parameters) > 0 {
+			return n.Parameters[0].Token
+		}
+		return n.Token
+	default:
+		return tokenOf(node)
+	}
+}
+
+// nodeEnd returns the position just after the last character of a node.
+// Closing brackets are assumed to directly follow the last element.
+func nodeEnd(node Expression) (line, column int) {
+	switch n := node.(type) {
+	case *BinaryExpression:
+		return nodeEnd(n.Right)
+	case *UnaryExpression:
+		return nodeEnd(n.Operand)
+	case *InExpression:
+		return nodeEnd(n.Right)
+	case *RegexExpression:
+		return nodeEnd(n.Pattern)
+	case *ConditionalExpression:
+		return nodeEnd(n.Alternative)
+	case *CaseExpression:
+		last := n.Default
+		if last == nil {
+			last = n.Results[len(n.Results)-1]
+		}
+		line, column = nodeEnd(last)
+		return line, column + 1
+	case *LambdaExpression:
+		return nodeEnd(n.Body)
+	case *MemberExpression:
+		return nodeEnd(n.Property)
+	case *IndexExpression:
+		line, column = nodeEnd(n.Index)
+		return line, column + 1
+	case *SliceExpression:
+		switch {
+		case n.End != nil:
+			line, column = nodeEnd(n.End)
+			return line, column + 1
+		case n.Start != nil:
+			line, column = nodeEnd(n.Start)
+			return line, column + 2
+		}
+		return n.Token.Line, n.Token.Column + 3
+	case *GroupedExpression:
+		line, column = nodeEnd(n.Expression)
+		return line, column + 1
+	case *ListLiteral:
+		if len(n.Elements) == 0 {
+			return n.Token.Line, n.Token.Column + 2
+		}
+		line, column = nodeEnd(n.Elements[len(n.Elements)-1])
+		return line, column + 1
+	case *MapLiteral:
+		if len(n.Values) == 0 {
+			return n.Token.Line, n.Token.Column + 2
+		}
+		line, column = nodeEnd(n.Values[len(n.Values)-1])
+		return line, column + 1
+	case *FunctionCall:
+		if len(n.Arguments) == 0 {
+			return n.Token.Line, n.Token.Column + len(n.Name) + 2
+		}
+		line, column = nodeEnd(n.Arguments[len(n.Arguments)-1])
+		return line, column + 1
+	case *StringLiteral:
+		return n.Token.Line, n.Token.Column + len(strconv.Quote(n.Value))
+	case *JSONPathExpression:
+		return n.Token.Line, n.Token.Column + len(n.Path)
+	default:
+		tok := tokenOf(node)
+		return tok.Line, tok.Column + len(tok.Literal)
+	}
+}
+
+// tokenOf returns the token stored in a node.
+func tokenOf(node Expression) lexer.Token {
+	switch n := node.(type) {
+	case *IntegerLiteral:
+		return n.Token
+	case *FloatLiteral:
+		return n.Token
+	case *DurationLiteral:
+		return n.Token
+	case *StringLiteral:
+		return n.Token
+	case *BooleanLiteral:
+		return n.Token
+	case *NullLiteral:
+		return n.Token
+	case *ListLiteral:
+		return n.Token
+	case *MapLiteral:
+		return n.Token
+	case *Identifier:
+		return n.Token
+	case *JSONPathExpression:
+		return n.Token
+	case *BinaryExpression:
+		return n.Token
+	case *UnaryExpression:
+		return n.Token
+	case *FunctionCall:
+		return n.Token
+	case *IndexExpression:
+		return n.Token
+	case *SliceExpression:
+		return n.Token
+	case *MemberExpression:
+		return n.Token
+	case *ConditionalExpression:
+		return n.Token
+	case *CaseExpression:
+		return n.Token
+	case *GroupedExpression:
+		return n.Token
+	case *InExpression:
+		return n.Token
+	case *RegexExpression:
+		return n.Token
+	case *LambdaExpression:
+		return n.Token
+	default:
+		return lexer.Token{}
+	}
+}
@@ -12,6 +12,8 @@ import (
 // MongoDBCompiler compiles AMEL expressions to MongoDB query documents.
 type MongoDBCompiler struct {
 	fieldMapper func(string) string // Maps JSON paths to MongoDB field names
+	trace       bool
+	entries     []TraceEntry
 }
 
 // MongoDBCompilerOption configures the MongoDB compiler.
@@ -24,6 +26,14 @@ func WithMongoFieldMapper(mapper func(string) string) MongoDBCompilerOption {
 	}
 }
 
+// WithMongoTrace makes the compiler report which expression produced each
+// part of the query document, in MongoDBResult.Trace.
+func WithMongoTrace(enabled bool) MongoDBCompilerOption {
+	return func(c *MongoDBCompiler) {
+		c.trace = enabled
+	}
+}
+
 // NewMongoDBCompiler creates a new MongoDB compiler with the given options.
 func NewMongoDBCompiler(opts ...MongoDBCompilerOption) *MongoDBCompiler {
 	c := &MongoDBCompiler{
@@ -42,6 +52,7 @@ func NewMongoDBCompiler(opts ...MongoDBCompilerOption) *MongoDBCompiler {
 // MongoDBResult contains the compiled MongoDB query.
 type MongoDBResult struct {
 	Query map[string]interface{} // The MongoDB query document
+	Trace []TraceEntry           // Nil unless tracing is enabled
 }
 
 // ToJSON returns the query as a JSON string.
@@ -64,6 +75,7 @@ func (r *MongoDBResult) ToPrettyJSON() (string, error) {
 
 // Compile compiles an AMEL expression to a MongoDB query document.
 func (c *MongoDBCompiler) Compile(expr ast.Expression) (*MongoDBResult, error) {
+	c.entries = nil
 	query, err := c.compile(expr)
 	if err != nil {
 		return nil, err
@@ -71,10 +83,34 @@ func (c *MongoDBCompiler) Compile(expr ast.Expression) (*MongoDBResult, error) {
 
 	return &MongoDBResult{
 		Query: query,
+		Trace: c.entries,
 	}, nil
 }
 
+// compile compiles a node, recording its trace entry if tracing is enabled
+// and the span of the node on errors.
 func (c *MongoDBCompiler) compile(expr ast.Expression) (map[string]interface{}, error) {
+	if !c.trace || !traced(expr) {
+		query, err := c.compileNode(expr)
+		return query, annotate(err, expr)
+	}
+
+	// Reserve the entry so that it precedes those of the operands
+	i := len(c.entries)
+	c.entries = append(c.entries, TraceEntry{})
+	query, err := c.compileNode(expr)
+	if err != nil {
+		return nil, annotate(err, expr)
+	}
+	fragment, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[i] = TraceEntry{Fragment: string(fragment), Expression: expr.String(), Span: ast.SpanOf(expr)}
+	return query, nil
+}
+
+func (c *MongoDBCompiler) compileNode(expr ast.Expression) (map[string]interface{}, error) {
 	switch e := expr.(type) {
 	case *ast.BinaryExpression:
 		return c.compileBinaryExpression(e)
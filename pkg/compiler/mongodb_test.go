@@ -2,8 +2,10 @@ package compiler
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 
+	"github.com/bencagri/amel/pkg/ast"
 	"github.com/bencagri/amel/pkg/parser"
 )
 
@@ -660,3 +662,24 @@ func assertJSONEqual(t *testing.T, expected, actual map[string]interface{}) {
 		t.Errorf("JSON mismatch:\nexpected: %s\nactual:   %s", string(expectedNormJSON), string(actualNormJSON))
 	}
 }
+
+func TestMongoDBCompiler_Trace(t *testing.T) {
+	expr, err := parser.Parse(`$.age > 18 || $.tier IN ["gold"]`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	result, err := NewMongoDBCompiler(WithMongoTrace(true)).Compile(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	expected := []TraceEntry{
+		{Fragment: `{"$or":[{"age":{"$gt":18}},{"tier":{"$in":["gold"]}}]}`, Expression: expr.String(), Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 33}},
+		{Fragment: `{"age":{"$gt":18}}`, Expression: `($.age > 18)`, Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 11}},
+		{Fragment: `{"tier":{"$in":["gold"]}}`, Expression: `($.tier IN ["gold"])`, Span: ast.Span{Line: 1, Column: 15, EndLine: 1, EndColumn: 33}},
+	}
+	if !reflect.DeepEqual(expected, result.Trace) {
+		t.Errorf("expected trace:\n%+v\ngot:\n%+v", expected, result.Trace)
+	}
+}
@@ -0,0 +1,647 @@
+// Package compiler provides compilation targets for AMEL expressions.
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+)
+
+// PainlessCompiler compiles AMEL expressions to Painless scripts, for the
+// script queries and script_fields of Elasticsearch and OpenSearch. Payload
+// paths read doc values, so the fields they map to must have doc values, such
+// as keyword rather than text fields. Literals are bound as script parameters
+// so that the compiled script is cached across values.
+type PainlessCompiler struct {
+	fieldMapper func(string) string // Maps JSON paths to index field names
+	params      map[string]interface{}
+	bound       []interface{} // Parameter values in order, for trace entries
+	trace       bool
+	entries     []TraceEntry
+}
+
+// PainlessCompilerOption configures the Painless compiler.
+type PainlessCompilerOption func(*PainlessCompiler)
+
+// WithPainlessFieldMapper sets a custom function to map JSON paths to index
+// field names, such as "$.user.name" to "user.name.keyword". An empty name
+// means the path has no field.
+func WithPainlessFieldMapper(mapper func(string) string) PainlessCompilerOption {
+	return func(c *PainlessCompiler) {
+		c.fieldMapper = mapper
+	}
+}
+
+// WithPainlessTrace makes the compiler report which expression produced each
+// fragment of the script, in PainlessResult.Trace.
+func WithPainlessTrace(enabled bool) PainlessCompilerOption {
+	return func(c *PainlessCompiler) {
+		c.trace = enabled
+	}
+}
+
+// NewPainlessCompiler creates a new Painless compiler with the given options.
+func NewPainlessCompiler(opts ...PainlessCompilerOption) *PainlessCompiler {
+	c := &PainlessCompiler{
+		fieldMapper: defaultPainlessFieldMapper,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// PainlessResult contains the compiled script and its parameters.
+type PainlessResult struct {
+	Source string                 // The script source
+	Params map[string]interface{} // The parameter values, read as params.p1, params.p2, ...
+	Trace  []TraceEntry           // Nil unless tracing is enabled
+}
+
+// Script returns the script object of a query, with "lang", "source", and
+// "params".
+func (r *PainlessResult) Script() map[string]interface{} {
+	return map[string]interface{}{
+		"lang":   "painless",
+		"source": r.Source,
+		"params": r.Params,
+	}
+}
+
+// ToJSON returns the script object as a JSON string.
+func (r *PainlessResult) ToJSON() (string, error) {
+	data, err := json.Marshal(r.Script())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Compile compiles an AMEL expression to a Painless script.
+func (c *PainlessCompiler) Compile(expr ast.Expression) (*PainlessResult, error) {
+	c.params = make(map[string]interface{})
+	c.bound = nil
+	c.entries = nil
+
+	source, err := c.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PainlessResult{
+		Source: source,
+		Params: c.params,
+		Trace:  c.entries,
+	}, nil
+}
+
+// compile compiles a node, recording its trace entry if tracing is enabled
+// and the span of the node on errors.
+func (c *PainlessCompiler) compile(expr ast.Expression) (string, error) {
+	if !c.trace || !traced(expr) {
+		source, err := c.compileNode(expr)
+		return source, annotate(err, expr)
+	}
+
+	// Reserve the entry so that it precedes those of the operands
+	i := len(c.entries)
+	c.entries = append(c.entries, TraceEntry{})
+	first := len(c.bound)
+	source, err := c.compileNode(expr)
+	if err != nil {
+		return "", annotate(err, expr)
+	}
+	c.entries[i] = TraceEntry{Fragment: source, Expression: expr.String(), Span: ast.SpanOf(expr)}
+	if len(c.bound) > first {
+		c.entries[i].Params = append([]interface{}(nil), c.bound[first:]...)
+	}
+	return source, nil
+}
+
+func (c *PainlessCompiler) compileNode(expr ast.Expression) (string, error) {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		return c.compileParam(e.Value), nil
+
+	case *ast.FloatLiteral:
+		return c.compileParam(e.Value), nil
+
+	case *ast.StringLiteral:
+		return c.compileParam(e.Value), nil
+
+	case *ast.BooleanLiteral:
+		if e.Value {
+			return "true", nil
+		}
+		return "false", nil
+
+	case *ast.NullLiteral:
+		return "null", nil
+
+	case *ast.ListLiteral:
+		values := make([]interface{}, len(e.Elements))
+		for i, elem := range e.Elements {
+			value, ok := literalValue(elem)
+			if !ok {
+				return "", errors.Newf(errors.ErrInvalidSyntax, "list elements must be literals for Painless, got %s", elem.String())
+			}
+			values[i] = value
+		}
+		return c.compileParam(values), nil
+
+	case *ast.Identifier:
+		// Identifiers are treated as field names
+		return docValue(e.Value), nil
+
+	case *ast.JSONPathExpression:
+		field, err := c.field(e)
+		if err != nil {
+			return "", err
+		}
+		return docValue(field), nil
+
+	case *ast.BinaryExpression:
+		return c.compileBinaryExpression(e)
+
+	case *ast.UnaryExpression:
+		return c.compileUnaryExpression(e)
+
+	case *ast.ConditionalExpression:
+		return c.compileTernary(e.Condition, e.Consequence, e.Alternative)
+
+	case *ast.CaseExpression:
+		return c.compileCaseExpression(e)
+
+	case *ast.InExpression:
+		return c.compileInExpression(e)
+
+	case *ast.RegexExpression:
+		return c.compileRegexExpression(e)
+
+	case *ast.GroupedExpression:
+		return c.compile(e.Expression)
+
+	case *ast.FunctionCall:
+		return c.compileFunctionCall(e)
+
+	default:
+		return "", errors.Newf(errors.ErrInvalidSyntax, "unsupported expression type for Painless: %T", expr)
+	}
+}
+
+// compileParam binds a value to the next script parameter and returns the
+// reference to it.
+func (c *PainlessCompiler) compileParam(value interface{}) string {
+	name := fmt.Sprintf("p%d", len(c.bound)+1)
+	c.params[name] = value
+	c.bound = append(c.bound, value)
+	return "params." + name
+}
+
+// field returns the index field a payload path maps to.
+func (c *PainlessCompiler) field(jp *ast.JSONPathExpression) (string, error) {
+	field := c.fieldMapper(jp.Path)
+	if field == "" {
+		return "", errors.Newf(errors.ErrInvalidSyntax, "cannot map %s to a field for Painless", jp.Path)
+	}
+	return field, nil
+}
+
+// fieldOf returns the field name of a payload path or identifier, or false
+// for other expressions.
+func (c *PainlessCompiler) fieldOf(expr ast.Expression) (string, bool, error) {
+	switch e := expr.(type) {
+	case *ast.JSONPathExpression:
+		field, err := c.field(e)
+		return field, err == nil, err
+	case *ast.Identifier:
+		return e.Value, true, nil
+	case *ast.GroupedExpression:
+		return c.fieldOf(e.Expression)
+	}
+	return "", false, nil
+}
+
+func (c *PainlessCompiler) compileBinaryExpression(be *ast.BinaryExpression) (string, error) {
+	// A missing field has no value to compare, so null checks test the
+	// number of values instead
+	if be.Operator == "==" || be.Operator == "!=" {
+		operand := be.Left
+		if isNullLiteral(be.Left) {
+			operand = be.Right
+		}
+		if isNullLiteral(be.Left) || isNullLiteral(be.Right) {
+			return c.compileNullCheck(operand, be.Operator == "==")
+		}
+	}
+
+	left, err := c.compile(be.Left)
+	if err != nil {
+		return "", err
+	}
+	right, err := c.compile(be.Right)
+	if err != nil {
+		return "", err
+	}
+
+	switch be.Operator {
+	case "&&", "AND", "and":
+		return fmt.Sprintf("(%s && %s)", left, right), nil
+	case "||", "OR", "or":
+		return fmt.Sprintf("(%s || %s)", left, right), nil
+	case "==", "!=", "+", "-", "*", "%":
+		return fmt.Sprintf("(%s %s %s)", left, be.Operator, right), nil
+	case "<", "<=", ">", ">=":
+		// Painless orders strings with compareTo only, so the type of the
+		// operands must be known from a literal or an arithmetic expression
+		if isStringLiteral(be.Left) || isStringLiteral(be.Right) {
+			return fmt.Sprintf("(%s.compareTo(%s) %s 0)", left, right, be.Operator), nil
+		}
+		if !isNumeric(be.Left) && !isNumeric(be.Right) {
+			return "", errors.Newf(errors.ErrTypeMismatch,
+				"unsupported operands for Painless %s: one side must be a number or a string literal, got %s", be.Operator, be.String())
+		}
+		return fmt.Sprintf("(%s %s %s)", left, be.Operator, right), nil
+	case "/":
+		// AMEL divides ints without truncating
+		return fmt.Sprintf("((double) %s / %s)", left, right), nil
+	case "~/":
+		return fmt.Sprintf("((long) (%s / %s))", left, right), nil
+	default:
+		return "", errors.Newf(errors.ErrInvalidOperator, "unsupported binary operator for Painless: %s", be.Operator)
+	}
+}
+
+// compileNullCheck tests whether an expression is null, or a field has no
+// value.
+func (c *PainlessCompiler) compileNullCheck(expr ast.Expression, isNull bool) (string, error) {
+	field, ok, err := c.fieldOf(expr)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		if isNull {
+			return fmt.Sprintf("(%s.size() == 0)", docField(field)), nil
+		}
+		return fmt.Sprintf("(%s.size() > 0)", docField(field)), nil
+	}
+
+	operand, err := c.compile(expr)
+	if err != nil {
+		return "", err
+	}
+	if isNull {
+		return fmt.Sprintf("(%s == null)", operand), nil
+	}
+	return fmt.Sprintf("(%s != null)", operand), nil
+}
+
+func (c *PainlessCompiler) compileUnaryExpression(ue *ast.UnaryExpression) (string, error) {
+	operand, err := c.compile(ue.Operand)
+	if err != nil {
+		return "", err
+	}
+
+	switch ue.Operator {
+	case "!", "NOT", "not":
+		return fmt.Sprintf("!(%s)", operand), nil
+	case "-":
+		return fmt.Sprintf("-(%s)", operand), nil
+	default:
+		return "", errors.Newf(errors.ErrInvalidOperator, "unsupported unary operator for Painless: %s", ue.Operator)
+	}
+}
+
+func (c *PainlessCompiler) compileTernary(condition, consequence, alternative ast.Expression) (string, error) {
+	cond, err := c.compile(condition)
+	if err != nil {
+		return "", err
+	}
+	then, err := c.compile(consequence)
+	if err != nil {
+		return "", err
+	}
+	otherwise, err := c.compile(alternative)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s ? %s : %s)", cond, then, otherwise), nil
+}
+
+// compileCaseExpression compiles a case expression to nested ternaries,
+// ending with the else arm or null.
+func (c *PainlessCompiler) compileCaseExpression(ce *ast.CaseExpression) (string, error) {
+	source := "null"
+	if ce.Default != nil {
+		var err error
+		if source, err = c.compile(ce.Default); err != nil {
+			return "", err
+		}
+	}
+
+	arms := make([]string, len(ce.Conditions))
+	for i := range ce.Conditions {
+		cond, err := c.compile(ce.Conditions[i])
+		if err != nil {
+			return "", err
+		}
+		result, err := c.compile(ce.Results[i])
+		if err != nil {
+			return "", err
+		}
+		arms[i] = cond + " ? " + result + " : "
+	}
+	for i := len(arms) - 1; i >= 0; i-- {
+		source = "(" + arms[i] + source + ")"
+	}
+	return source, nil
+}
+
+func (c *PainlessCompiler) compileInExpression(ie *ast.InExpression) (string, error) {
+	left, err := c.compile(ie.Left)
+	if err != nil {
+		return "", err
+	}
+
+	list, ok := ie.Right.(*ast.ListLiteral)
+	if !ok {
+		return "", errors.New(errors.ErrTypeMismatch, "expected list for IN expression")
+	}
+
+	// Comparing with == rather than List.contains compares numbers by value,
+	// whatever their boxed type
+	parts := make([]string, len(list.Elements))
+	for i, elem := range list.Elements {
+		value, err := c.compile(elem)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = fmt.Sprintf("%s == %s", left, value)
+	}
+
+	source := "false"
+	if len(parts) > 0 {
+		source = "(" + strings.Join(parts, " || ") + ")"
+	}
+	if ie.Negated {
+		return "!" + source, nil
+	}
+	return source, nil
+}
+
+func (c *PainlessCompiler) compileRegexExpression(re *ast.RegexExpression) (string, error) {
+	left, err := c.compile(re.Left)
+	if err != nil {
+		return "", err
+	}
+
+	pattern, ok := re.Pattern.(*ast.StringLiteral)
+	if !ok {
+		return "", errors.New(errors.ErrTypeMismatch, "regex pattern must be a string literal for Painless compilation")
+	}
+
+	// =~ finds the pattern anywhere in the string, as in AMEL
+	source, err := escapeRegexSlashes(pattern.Value)
+	if err != nil {
+		return "", err
+	}
+	match := fmt.Sprintf("(%s =~ /%s/)", left, source)
+	if re.Negated {
+		return "!" + match, nil
+	}
+	return match, nil
+}
+
+func (c *PainlessCompiler) compileFunctionCall(fc *ast.FunctionCall) (string, error) {
+	switch strings.ToLower(fc.Name) {
+	case "lower":
+		return c.compileMethodCall("toLowerCase", fc, 1)
+	case "upper":
+		return c.compileMethodCall("toUpperCase", fc, 1)
+	case "trim":
+		return c.compileMethodCall("trim", fc, 1)
+	case "len", "length":
+		return c.compileMethodCall("length", fc, 1)
+	case "contains":
+		return c.compileMethodCall("contains", fc, 2)
+	case "startswith":
+		return c.compileMethodCall("startsWith", fc, 2)
+	case "endswith":
+		return c.compileMethodCall("endsWith", fc, 2)
+	case "abs":
+		return c.compileMathFunction("Math.abs", fc, 1)
+	case "sqrt":
+		return c.compileMathFunction("Math.sqrt", fc, 1)
+	case "pow":
+		return c.compileMathFunction("Math.pow", fc, 2)
+	case "ceil":
+		return c.compileMathFunction("(long) Math.ceil", fc, 1)
+	case "floor":
+		return c.compileMathFunction("(long) Math.floor", fc, 1)
+	case "round":
+		// Math.round rounds halves up; AMEL rounds them away from zero
+		if len(fc.Arguments) != 1 {
+			return "", errors.New(errors.ErrArgumentCount, "round requires exactly 1 argument")
+		}
+		arg, err := c.compile(fc.Arguments[0])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("((long) (Math.signum(%s) * Math.floor(Math.abs(%s) + 0.5)))", arg, arg), nil
+	case "min", "max":
+		return c.compileMinMax("Math."+strings.ToLower(fc.Name), fc)
+	case "ifthenelse":
+		if len(fc.Arguments) != 3 {
+			return "", errors.New(errors.ErrArgumentCount, "ifThenElse requires exactly 3 arguments")
+		}
+		return c.compileTernary(fc.Arguments[0], fc.Arguments[1], fc.Arguments[2])
+	case "isnull", "isnotnull":
+		if len(fc.Arguments) != 1 {
+			return "", errors.Newf(errors.ErrArgumentCount, "%s requires exactly 1 argument", fc.Name)
+		}
+		return c.compileNullCheck(fc.Arguments[0], strings.EqualFold(fc.Name, "isNull"))
+	case "exists":
+		if len(fc.Arguments) != 1 {
+			return "", errors.New(errors.ErrArgumentCount, "exists requires exactly 1 argument")
+		}
+		field, ok, err := c.fieldOf(fc.Arguments[0])
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", errors.New(errors.ErrInvalidSyntax, "exists requires a field for Painless")
+		}
+		// doc fails on fields missing from the mapping
+		return fmt.Sprintf("(doc.containsKey(%s) && %s.size() > 0)", quotePainless(field), docField(field)), nil
+	default:
+		return "", errors.Newf(errors.ErrUndefinedFunction, "unsupported function for Painless: %s", fc.Name)
+	}
+}
+
+// compileMethodCall compiles a function to a method of its first argument,
+// such as "x.toLowerCase()".
+func (c *PainlessCompiler) compileMethodCall(method string, fc *ast.FunctionCall, arity int) (string, error) {
+	args, err := c.compileArguments(fc, arity)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s(%s)", args[0], method, strings.Join(args[1:], ", ")), nil
+}
+
+// compileMathFunction compiles a function to a static method, such as
+// "Math.abs(x)".
+func (c *PainlessCompiler) compileMathFunction(method string, fc *ast.FunctionCall, arity int) (string, error) {
+	args, err := c.compileArguments(fc, arity)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s(%s)", method, strings.Join(args, ", ")), nil
+}
+
+// compileMinMax compiles min or max of two or more values to nested calls of
+// the two-argument Math method.
+func (c *PainlessCompiler) compileMinMax(method string, fc *ast.FunctionCall) (string, error) {
+	if len(fc.Arguments) < 2 {
+		return "", errors.Newf(errors.ErrArgumentCount, "%s requires at least 2 arguments for Painless", fc.Name)
+	}
+	source, err := c.compile(fc.Arguments[0])
+	if err != nil {
+		return "", err
+	}
+	for _, arg := range fc.Arguments[1:] {
+		next, err := c.compile(arg)
+		if err != nil {
+			return "", err
+		}
+		source = fmt.Sprintf("%s(%s, %s)", method, source, next)
+	}
+	return source, nil
+}
+
+func (c *PainlessCompiler) compileArguments(fc *ast.FunctionCall, arity int) ([]string, error) {
+	if len(fc.Arguments) != arity {
+		noun := "arguments"
+		if arity == 1 {
+			noun = "argument"
+		}
+		return nil, errors.Newf(errors.ErrArgumentCount, "%s requires exactly %d %s", fc.Name, arity, noun)
+	}
+	args := make([]string, arity)
+	for i, arg := range fc.Arguments {
+		compiled, err := c.compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = compiled
+	}
+	return args, nil
+}
+
+// Helper functions
+
+// docField returns the doc values of a field, such as "doc['user.age']".
+func docField(field string) string {
+	return "doc[" + quotePainless(field) + "]"
+}
+
+// docValue returns the first doc value of a field.
+func docValue(field string) string {
+	return docField(field) + ".value"
+}
+
+// quotePainless quotes a string as a Painless string literal.
+func quotePainless(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// defaultPainlessFieldMapper converts $.user.name to user.name. Paths with
+// indexes have no field: doc values are not ordered as in the source
+// document.
+func defaultPainlessFieldMapper(path string) string {
+	if strings.Contains(path, "[") {
+		return ""
+	}
+	path = strings.TrimPrefix(path, "$.")
+	path = strings.TrimPrefix(path, "$")
+	return strings.Trim(path, ".")
+}
+
+func isStringLiteral(expr ast.Expression) bool {
+	_, ok := expr.(*ast.StringLiteral)
+	return ok
+}
+
+// isNumeric reports whether an expression is known to be a number: a number
+// literal, arithmetic, or a function returning a number.
+func isNumeric(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		return true
+	case *ast.UnaryExpression:
+		return e.Operator == "-"
+	case *ast.BinaryExpression:
+		switch e.Operator {
+		case "-", "*", "/", "~/", "%":
+			return true
+		case "+":
+			// + concatenates strings too
+			return isNumeric(e.Left) || isNumeric(e.Right)
+		}
+	case *ast.FunctionCall:
+		switch strings.ToLower(e.Name) {
+		case "len", "length", "abs", "sqrt", "pow", "ceil", "floor", "round", "min", "max":
+			return true
+		}
+	}
+	return false
+}
+
+// escapeRegexSlashes escapes the slashes of a pattern that are not escaped
+// already, so the pattern fits between the slashes of a Painless regex.
+func escapeRegexSlashes(pattern string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			if i+1 == len(pattern) {
+				return "", errors.New(errors.ErrInvalidSyntax, "regex pattern ends with a backslash")
+			}
+			b.WriteString(pattern[i : i+2])
+			i++
+		case '/':
+			b.WriteString(`\/`)
+		default:
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// literalValue returns the value of a literal.
+func literalValue(expr ast.Expression) (interface{}, bool) {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		return e.Value, true
+	case *ast.FloatLiteral:
+		return e.Value, true
+	case *ast.StringLiteral:
+		return e.Value, true
+	case *ast.BooleanLiteral:
+		return e.Value, true
+	case *ast.NullLiteral:
+		return nil, true
+	}
+	return nil, false
+}
+
+// CompileToPainless is a convenience function that compiles an AMEL expression to a Painless script.
+func CompileToPainless(expr ast.Expression, opts ...PainlessCompilerOption) (*PainlessResult, error) {
+	compiler := NewPainlessCompiler(opts...)
+	return compiler.Compile(expr)
+}
@@ -0,0 +1,292 @@
+package compiler
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+func TestPainlessCompiler_Basic(t *testing.T) {
+	tests := []struct {
+		name           string
+		dsl            string
+		expectedSource string
+		expectedParams map[string]interface{}
+	}{
+		{
+			name:           "comparison",
+			dsl:            `$.age > 18`,
+			expectedSource: `(doc['age'].value > params.p1)`,
+			expectedParams: map[string]interface{}{"p1": int64(18)},
+		},
+		{
+			name:           "nested field",
+			dsl:            `$.user.tier == "gold"`,
+			expectedSource: `(doc['user.tier'].value == params.p1)`,
+			expectedParams: map[string]interface{}{"p1": "gold"},
+		},
+		{
+			name:           "logical operators",
+			dsl:            `$.age >= 18 && ($.active || !$.banned)`,
+			expectedSource: `((doc['age'].value >= params.p1) && (doc['active'].value || !(doc['banned'].value)))`,
+			expectedParams: map[string]interface{}{"p1": int64(18)},
+		},
+		{
+			name:           "arithmetic",
+			dsl:            `$.price * $.quantity - 5 > 100`,
+			expectedSource: `(((doc['price'].value * doc['quantity'].value) - params.p1) > params.p2)`,
+			expectedParams: map[string]interface{}{"p1": int64(5), "p2": int64(100)},
+		},
+		{
+			name:           "division does not truncate",
+			dsl:            `$.clicks / $.views >= 0.1`,
+			expectedSource: `(((double) doc['clicks'].value / doc['views'].value) >= params.p1)`,
+			expectedParams: map[string]interface{}{"p1": 0.1},
+		},
+		{
+			name:           "integer division",
+			dsl:            `$.minutes ~/ 60`,
+			expectedSource: `((long) (doc['minutes'].value / params.p1))`,
+			expectedParams: map[string]interface{}{"p1": int64(60)},
+		},
+		{
+			name:           "string ordering",
+			dsl:            `$.name < "m"`,
+			expectedSource: `(doc['name'].value.compareTo(params.p1) < 0)`,
+			expectedParams: map[string]interface{}{"p1": "m"},
+		},
+		{
+			name:           "ternary",
+			dsl:            `$.vip ? 0.2 : 0`,
+			expectedSource: `(doc['vip'].value ? params.p1 : params.p2)`,
+			expectedParams: map[string]interface{}{"p1": 0.2, "p2": int64(0)},
+		},
+		{
+			name:           "case",
+			dsl:            `case { $.tier == "gold" => 2; $.tier == "silver" => 1; else => 0 }`,
+			expectedSource: `((doc['tier'].value == params.p2) ? params.p3 : ((doc['tier'].value == params.p4) ? params.p5 : params.p1))`,
+			expectedParams: map[string]interface{}{"p1": int64(0), "p2": "gold", "p3": int64(2), "p4": "silver", "p5": int64(1)},
+		},
+		{
+			name:           "null comparison",
+			dsl:            `$.deletedAt == null && null != $.email`,
+			expectedSource: `((doc['deletedAt'].size() == 0) && (doc['email'].size() > 0))`,
+			expectedParams: map[string]interface{}{},
+		},
+		{
+			name:           "in",
+			dsl:            `$.status NOT IN ["deleted", "archived"]`,
+			expectedSource: `!(doc['status'].value == params.p1 || doc['status'].value == params.p2)`,
+			expectedParams: map[string]interface{}{"p1": "deleted", "p2": "archived"},
+		},
+		{
+			name:           "empty in",
+			dsl:            `$.status IN []`,
+			expectedSource: `false`,
+			expectedParams: map[string]interface{}{},
+		},
+		{
+			name:           "regex",
+			dsl:            `$.path =~ "^/api/"`,
+			expectedSource: `(doc['path'].value =~ /^\/api\//)`,
+			expectedParams: map[string]interface{}{},
+		},
+		{
+			name:           "regex with escaped slash",
+			dsl:            `$.path =~ "^\\/api/v\\d+\\/"`,
+			expectedSource: `(doc['path'].value =~ /^\/api\/v\d+\//)`,
+			expectedParams: map[string]interface{}{},
+		},
+		{
+			name:           "ordering of fields with arithmetic",
+			dsl:            `$.spent - 10 > $.budget`,
+			expectedSource: `((doc['spent'].value - params.p1) > doc['budget'].value)`,
+			expectedParams: map[string]interface{}{"p1": int64(10)},
+		},
+		{
+			name:           "negated regex",
+			dsl:            `$.email !~ "@example\\.com$"`,
+			expectedSource: `!(doc['email'].value =~ /@example\.com$/)`,
+			expectedParams: map[string]interface{}{},
+		},
+		{
+			name:           "quoted field",
+			dsl:            `user_name == "x"`,
+			expectedSource: `(doc['user_name'].value == params.p1)`,
+			expectedParams: map[string]interface{}{"p1": "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parser.Parse(tt.dsl)
+			if err != nil {
+				t.Fatalf("failed to parse DSL: %v", err)
+			}
+
+			result, err := CompileToPainless(expr)
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			if result.Source != tt.expectedSource {
+				t.Errorf("expected source:\n%s\ngot:\n%s", tt.expectedSource, result.Source)
+			}
+			if !reflect.DeepEqual(tt.expectedParams, result.Params) {
+				t.Errorf("expected params %v, got %v", tt.expectedParams, result.Params)
+			}
+		})
+	}
+}
+
+func TestPainlessCompiler_Functions(t *testing.T) {
+	tests := []struct {
+		dsl            string
+		expectedSource string
+	}{
+		{`lower($.name) == "john"`, `(doc['name'].value.toLowerCase() == params.p1)`},
+		{`len(trim($.code)) > 3`, `(doc['code'].value.trim().length() > params.p1)`},
+		{`contains($.title, "sale")`, `doc['title'].value.contains(params.p1)`},
+		{`startsWith($.sku, "A-")`, `doc['sku'].value.startsWith(params.p1)`},
+		{`abs($.delta)`, `Math.abs(doc['delta'].value)`},
+		{`pow($.x, 2)`, `Math.pow(doc['x'].value, params.p1)`},
+		{`floor($.score)`, `(long) Math.floor(doc['score'].value)`},
+		{`round($.score)`, `((long) (Math.signum(doc['score'].value) * Math.floor(Math.abs(doc['score'].value) + 0.5)))`},
+		{`max($.a, $.b, 0)`, `Math.max(Math.max(doc['a'].value, doc['b'].value), params.p1)`},
+		{`ifThenElse($.vip, 1, 2)`, `(doc['vip'].value ? params.p1 : params.p2)`},
+		{`isNull($.email)`, `(doc['email'].size() == 0)`},
+		{`isNotNull($.email)`, `(doc['email'].size() > 0)`},
+		{`exists($.email)`, `(doc.containsKey('email') && doc['email'].size() > 0)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			expr, err := parser.Parse(tt.dsl)
+			if err != nil {
+				t.Fatalf("failed to parse DSL: %v", err)
+			}
+
+			result, err := CompileToPainless(expr)
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			if result.Source != tt.expectedSource {
+				t.Errorf("expected source:\n%s\ngot:\n%s", tt.expectedSource, result.Source)
+			}
+		})
+	}
+}
+
+func TestPainlessCompiler_FieldMapper(t *testing.T) {
+	expr, err := parser.Parse(`$.user.name == "x" && $.note == "it's"`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	mapper := func(path string) string {
+		if path == "$.user.name" {
+			return "user.name.keyword"
+		}
+		return "o'brien"
+	}
+	result, err := NewPainlessCompiler(WithPainlessFieldMapper(mapper)).Compile(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	expected := `((doc['user.name.keyword'].value == params.p1) && (doc['o\'brien'].value == params.p2))`
+	if result.Source != expected {
+		t.Errorf("expected source:\n%s\ngot:\n%s", expected, result.Source)
+	}
+	if result.Params["p2"] != "it's" {
+		t.Errorf("expected the literal as a parameter, got %v", result.Params)
+	}
+}
+
+func TestPainlessCompiler_Script(t *testing.T) {
+	expr, err := parser.Parse(`$.age > 18`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	result, err := CompileToPainless(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	jsonStr, err := result.ToJSON()
+	if err != nil {
+		t.Fatalf("failed to convert to JSON: %v", err)
+	}
+	var script map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &script); err != nil {
+		t.Fatalf("failed to parse JSON: %v", err)
+	}
+	expected := map[string]interface{}{
+		"lang":   "painless",
+		"source": "(doc['age'].value > params.p1)",
+		"params": map[string]interface{}{"p1": float64(18)},
+	}
+	if !reflect.DeepEqual(expected, script) {
+		t.Errorf("expected script %v, got %v", expected, script)
+	}
+}
+
+func TestPainlessCompiler_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		dsl  string
+		code errors.ErrorCode
+		msg  string
+	}{
+		{"unsupported function", `customFunc($.name)`, errors.ErrUndefinedFunction, "unsupported function for Painless"},
+		{"indexed path", `$.items[0].price > 5`, errors.ErrInvalidSyntax, "cannot map"},
+		{"dynamic pattern", `$.name =~ $.pattern`, errors.ErrTypeMismatch, "string literal"},
+		{"dynamic list", `$.tier IN $.tiers`, errors.ErrTypeMismatch, "expected list"},
+		{"arity", `lower($.a, $.b)`, errors.ErrArgumentCount, "exactly 1 argument"},
+		{"min of one", `min($.a)`, errors.ErrArgumentCount, "at least 2"},
+		{"ordering of fields", `$.a < $.b`, errors.ErrTypeMismatch, "unsupported operands for Painless <"},
+		{"ordering of strings", `lower($.a) >= $.b`, errors.ErrTypeMismatch, "unsupported operands for Painless >="},
+		{"trailing backslash", `$.a =~ "a\\"`, errors.ErrInvalidSyntax, "ends with a backslash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parser.Parse(tt.dsl)
+			if err != nil {
+				t.Fatalf("failed to parse DSL: %v", err)
+			}
+
+			_, err = CompileToPainless(expr)
+			if !errors.IsCode(err, tt.code) || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("expected %v error containing %q, got: %v", tt.code, tt.msg, err)
+			}
+		})
+	}
+}
+
+func TestPainlessCompiler_Trace(t *testing.T) {
+	expr, err := parser.Parse(`$.age > 18 || $.tier IN ["gold"]`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	result, err := NewPainlessCompiler(WithPainlessTrace(true)).Compile(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	expected := []TraceEntry{
+		{Fragment: result.Source, Expression: expr.String(), Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 33}, Params: []interface{}{int64(18), "gold"}},
+		{Fragment: `(doc['age'].value > params.p1)`, Expression: `($.age > 18)`, Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 11}, Params: []interface{}{int64(18)}},
+		{Fragment: `doc['age'].value`, Expression: `$.age`, Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 6}},
+		{Fragment: `(doc['tier'].value == params.p2)`, Expression: `($.tier IN ["gold"])`, Span: ast.Span{Line: 1, Column: 15, EndLine: 1, EndColumn: 33}, Params: []interface{}{"gold"}},
+		{Fragment: `doc['tier'].value`, Expression: `$.tier`, Span: ast.Span{Line: 1, Column: 15, EndLine: 1, EndColumn: 21}},
+	}
+	if !reflect.DeepEqual(expected, result.Trace) {
+		t.Errorf("expected trace:\n%+v\ngot:\n%+v", expected, result.Trace)
+	}
+}
@@ -0,0 +1,532 @@
+// Package compiler provides compilation targets for AMEL expressions.
+package compiler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+)
+
+// RediSearchCompiler compiles AMEL filter expressions to RediSearch queries,
+// for FT.SEARCH and FT.AGGREGATE on Redis indexes. Numeric comparisons become
+// ranges such as "@age:[18 +inf]", string and boolean equality matches TAG
+// fields such as "@status:{active}", and the fields declared with
+// WithRediSearchTextFields are matched as TEXT. Tag and text matching is case
+// insensitive unless the index says otherwise.
+type RediSearchCompiler struct {
+	fieldMapper func(string) string // Maps JSON paths to index attribute names
+	textFields  map[string]bool     // Attributes indexed as TEXT rather than TAG
+	trace       bool
+	entries     []TraceEntry
+}
+
+// RediSearchCompilerOption configures the RediSearch compiler.
+type RediSearchCompilerOption func(*RediSearchCompiler)
+
+// WithRediSearchFieldMapper sets a custom function to map JSON paths to
+// index attribute names, such as "$.user.name" to "user_name" for an index
+// declaring "$.user.name AS user_name". An empty name means the path has no
+// attribute.
+func WithRediSearchFieldMapper(mapper func(string) string) RediSearchCompilerOption {
+	return func(c *RediSearchCompiler) {
+		c.fieldMapper = mapper
+	}
+}
+
+// WithRediSearchTextFields declares attributes indexed as TEXT, by their
+// mapped names. Other attributes compared with strings are taken to be TAG
+// attributes.
+func WithRediSearchTextFields(fields ...string) RediSearchCompilerOption {
+	return func(c *RediSearchCompiler) {
+		for _, f := range fields {
+			c.textFields[f] = true
+		}
+	}
+}
+
+// WithRediSearchTrace makes the compiler report which expression produced
+// each fragment of the query, in RediSearchResult.Trace.
+func WithRediSearchTrace(enabled bool) RediSearchCompilerOption {
+	return func(c *RediSearchCompiler) {
+		c.trace = enabled
+	}
+}
+
+// NewRediSearchCompiler creates a new RediSearch compiler with the given
+// options.
+func NewRediSearchCompiler(opts ...RediSearchCompilerOption) *RediSearchCompiler {
+	c := &RediSearchCompiler{
+		fieldMapper: defaultRediSearchFieldMapper,
+		textFields:  make(map[string]bool),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// RediSearchResult contains the compiled query.
+type RediSearchResult struct {
+	Query string       // The query string
+	Trace []TraceEntry // Nil unless tracing is enabled
+}
+
+// Command returns the arguments of an FT.SEARCH command running the query on
+// an index. The query needs dialect 2 or later.
+func (r *RediSearchResult) Command(index string) []string {
+	return []string{"FT.SEARCH", index, r.Query, "DIALECT", "2"}
+}
+
+// Compile compiles an AMEL expression to a RediSearch query.
+func (c *RediSearchCompiler) Compile(expr ast.Expression) (*RediSearchResult, error) {
+	c.entries = nil
+
+	query, err := c.compile(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RediSearchResult{
+		Query: query,
+		Trace: c.entries,
+	}, nil
+}
+
+// compile compiles a node, recording its trace entry if tracing is enabled
+// and the span of the node on errors.
+func (c *RediSearchCompiler) compile(expr ast.Expression) (string, error) {
+	if !c.trace || !traced(expr) {
+		query, err := c.compileNode(expr)
+		return query, annotate(err, expr)
+	}
+
+	// Reserve the entry so that it precedes those of the operands
+	i := len(c.entries)
+	c.entries = append(c.entries, TraceEntry{})
+	query, err := c.compileNode(expr)
+	if err != nil {
+		return "", annotate(err, expr)
+	}
+	c.entries[i] = TraceEntry{Fragment: query, Expression: expr.String(), Span: ast.SpanOf(expr)}
+	return query, nil
+}
+
+func (c *RediSearchCompiler) compileNode(expr ast.Expression) (string, error) {
+	switch e := expr.(type) {
+	case *ast.BooleanLiteral:
+		if e.Value {
+			return "*", nil
+		}
+		return "", errors.New(errors.ErrInvalidSyntax, "RediSearch has no query matching nothing")
+
+	case *ast.Identifier, *ast.JSONPathExpression:
+		// A field on its own is a boolean flag
+		field, _, err := c.fieldOf(expr)
+		if err != nil {
+			return "", err
+		}
+		return tagQuery(field, []string{"true"}), nil
+
+	case *ast.BinaryExpression:
+		return c.compileBinaryExpression(e)
+
+	case *ast.UnaryExpression:
+		return c.compileUnaryExpression(e)
+
+	case *ast.InExpression:
+		return c.compileInExpression(e)
+
+	case *ast.GroupedExpression:
+		return c.compile(e.Expression)
+
+	case *ast.FunctionCall:
+		return c.compileFunctionCall(e)
+
+	case *ast.RegexExpression:
+		return "", errors.New(errors.ErrInvalidOperator, "RediSearch has no regex matching; use startsWith, endsWith, or contains")
+
+	default:
+		return "", errors.Newf(errors.ErrInvalidSyntax, "unsupported expression type for RediSearch: %T", expr)
+	}
+}
+
+// fieldOf returns the attribute of a payload path or identifier, also inside
+// lower and upper, which change nothing in case-insensitive matching. ok is
+// false for other expressions.
+func (c *RediSearchCompiler) fieldOf(expr ast.Expression) (string, bool, error) {
+	switch e := expr.(type) {
+	case *ast.JSONPathExpression:
+		field := c.fieldMapper(e.Path)
+		if field == "" {
+			return "", false, errors.Newf(errors.ErrInvalidSyntax, "cannot map %s to an attribute for RediSearch", e.Path)
+		}
+		return field, true, nil
+	case *ast.Identifier:
+		return e.Value, true, nil
+	case *ast.GroupedExpression:
+		return c.fieldOf(e.Expression)
+	case *ast.FunctionCall:
+		if (strings.EqualFold(e.Name, "lower") || strings.EqualFold(e.Name, "upper")) && len(e.Arguments) == 1 {
+			return c.fieldOf(e.Arguments[0])
+		}
+	}
+	return "", false, nil
+}
+
+// field returns the attribute of an operand that must be a field.
+func (c *RediSearchCompiler) field(expr ast.Expression, what string) (string, error) {
+	field, ok, err := c.fieldOf(expr)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.Newf(errors.ErrInvalidSyntax, "%s requires a field for RediSearch, got %s", what, expr.String())
+	}
+	return field, nil
+}
+
+func (c *RediSearchCompiler) compileBinaryExpression(be *ast.BinaryExpression) (string, error) {
+	switch be.Operator {
+	case "&&", "AND", "and":
+		return c.compileLogicalExpression(be, " ")
+	case "||", "OR", "or":
+		return c.compileLogicalExpression(be, " | ")
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return "", errors.Newf(errors.ErrInvalidOperator, "unsupported operator for RediSearch: %s", be.Operator)
+	}
+
+	// Queries compare an attribute with a value, so a field on the right is
+	// swapped to the left
+	operator, left, right := be.Operator, be.Left, be.Right
+	if _, ok, err := c.fieldOf(left); err != nil {
+		return "", err
+	} else if !ok {
+		left, right = right, left
+		operator = swapComparison(operator)
+	}
+	field, err := c.field(left, "comparison")
+	if err != nil {
+		return "", err
+	}
+	if _, ok, _ := c.fieldOf(right); ok {
+		return "", errors.New(errors.ErrInvalidOperator, "RediSearch cannot compare two fields")
+	}
+
+	if operator == "==" || operator == "!=" {
+		query, err := c.compileEquality(field, right)
+		if err != nil {
+			return "", err
+		}
+		if operator == "!=" {
+			return negate(query), nil
+		}
+		return query, nil
+	}
+
+	n, ok := numberLiteral(right)
+	if !ok {
+		return "", errors.Newf(errors.ErrTypeMismatch, "RediSearch orders numbers only, got %s", right.String())
+	}
+	switch operator {
+	case "<":
+		return numericQuery(field, "-inf", "("+n), nil
+	case "<=":
+		return numericQuery(field, "-inf", n), nil
+	case ">":
+		return numericQuery(field, "("+n, "+inf"), nil
+	default:
+		return numericQuery(field, n, "+inf"), nil
+	}
+}
+
+// compileLogicalExpression joins the operands of && with spaces, for their
+// intersection, or of || with "|", for their union. Operands that are the
+// same operator are merged into one group.
+func (c *RediSearchCompiler) compileLogicalExpression(be *ast.BinaryExpression, sep string) (string, error) {
+	parts := make([]string, 2)
+	for i, operand := range []ast.Expression{be.Left, be.Right} {
+		query, err := c.compile(operand)
+		if err != nil {
+			return "", err
+		}
+		if inner, ok := operand.(*ast.BinaryExpression); ok && logicalOperator(inner.Operator) == logicalOperator(be.Operator) {
+			query = query[1 : len(query)-1]
+		}
+		parts[i] = query
+	}
+	return "(" + strings.Join(parts, sep) + ")", nil
+}
+
+// compileEquality matches the values of an attribute equal to a literal.
+func (c *RediSearchCompiler) compileEquality(field string, value ast.Expression) (string, error) {
+	if isNullLiteral(value) {
+		return missingQuery(field), nil
+	}
+	if n, ok := numberLiteral(value); ok {
+		return numericQuery(field, n, n), nil
+	}
+	switch v := value.(type) {
+	case *ast.StringLiteral:
+		if c.textFields[field] {
+			return "@" + escapeRediSearch(field) + ":" + quoteRediSearch(v.Value), nil
+		}
+		return tagQuery(field, []string{escapeRediSearch(v.Value)}), nil
+	case *ast.BooleanLiteral:
+		return tagQuery(field, []string{strconv.FormatBool(v.Value)}), nil
+	}
+	return "", errors.Newf(errors.ErrInvalidSyntax, "RediSearch compares attributes with literals only, got %s", value.String())
+}
+
+func (c *RediSearchCompiler) compileUnaryExpression(ue *ast.UnaryExpression) (string, error) {
+	switch ue.Operator {
+	case "!", "NOT", "not":
+		operand, err := c.compile(ue.Operand)
+		if err != nil {
+			return "", err
+		}
+		return negate(operand), nil
+	default:
+		return "", errors.Newf(errors.ErrInvalidOperator, "unsupported unary operator for RediSearch: %s", ue.Operator)
+	}
+}
+
+func (c *RediSearchCompiler) compileInExpression(ie *ast.InExpression) (string, error) {
+	var query string
+	if list, ok := ie.Right.(*ast.ListLiteral); ok {
+		field, err := c.field(ie.Left, "IN")
+		if err != nil {
+			return "", err
+		}
+		if query, err = c.compileMembership(field, list); err != nil {
+			return "", err
+		}
+	} else {
+		// A value IN a field matches one of the values of a TAG attribute
+		field, err := c.field(ie.Right, "IN")
+		if err != nil {
+			return "", err
+		}
+		if query, err = c.compileEquality(field, ie.Left); err != nil {
+			return "", err
+		}
+	}
+
+	if ie.Negated {
+		return negate(query), nil
+	}
+	return query, nil
+}
+
+// compileMembership matches the values of an attribute equal to one of the
+// elements of a list: in one tag query for strings, or a union otherwise.
+func (c *RediSearchCompiler) compileMembership(field string, list *ast.ListLiteral) (string, error) {
+	if len(list.Elements) == 0 {
+		return "", errors.New(errors.ErrInvalidSyntax, "RediSearch has no query matching nothing; IN requires at least one value")
+	}
+
+	tags := make([]string, 0, len(list.Elements))
+	for _, elem := range list.Elements {
+		if s, ok := elem.(*ast.StringLiteral); ok {
+			tags = append(tags, escapeRediSearch(s.Value))
+		}
+	}
+	if len(tags) == len(list.Elements) && !c.textFields[field] {
+		return tagQuery(field, tags), nil
+	}
+
+	parts := make([]string, len(list.Elements))
+	for i, elem := range list.Elements {
+		query, err := c.compileEquality(field, elem)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = query
+	}
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return "(" + strings.Join(parts, " | ") + ")", nil
+}
+
+func (c *RediSearchCompiler) compileFunctionCall(fc *ast.FunctionCall) (string, error) {
+	switch strings.ToLower(fc.Name) {
+	case "startswith":
+		return c.compilePattern(fc, "", "*")
+	case "endswith":
+		return c.compilePattern(fc, "*", "")
+	case "contains":
+		return c.compilePattern(fc, "*", "*")
+	case "between":
+		if len(fc.Arguments) != 3 {
+			return "", errors.New(errors.ErrArgumentCount, "between requires exactly 3 arguments")
+		}
+		field, err := c.field(fc.Arguments[0], "between")
+		if err != nil {
+			return "", err
+		}
+		low, lowOK := numberLiteral(fc.Arguments[1])
+		high, highOK := numberLiteral(fc.Arguments[2])
+		if !lowOK || !highOK {
+			return "", errors.New(errors.ErrTypeMismatch, "between bounds must be number literals for RediSearch")
+		}
+		return numericQuery(field, low, high), nil
+	case "isnull", "isnotnull", "exists":
+		if len(fc.Arguments) != 1 {
+			return "", errors.Newf(errors.ErrArgumentCount, "%s requires exactly 1 argument", fc.Name)
+		}
+		field, err := c.field(fc.Arguments[0], fc.Name)
+		if err != nil {
+			return "", err
+		}
+		if strings.EqualFold(fc.Name, "isNull") {
+			return missingQuery(field), nil
+		}
+		return negate(missingQuery(field)), nil
+	default:
+		return "", errors.Newf(errors.ErrUndefinedFunction, "unsupported function for RediSearch: %s", fc.Name)
+	}
+}
+
+// compilePattern compiles startsWith, endsWith, or contains of an attribute
+// and a string literal to a prefix, suffix, or infix match. Suffix and infix
+// matches need RediSearch 2.6 or later.
+func (c *RediSearchCompiler) compilePattern(fc *ast.FunctionCall, before, after string) (string, error) {
+	if len(fc.Arguments) != 2 {
+		return "", errors.Newf(errors.ErrArgumentCount, "%s requires exactly 2 arguments", fc.Name)
+	}
+	field, err := c.field(fc.Arguments[0], fc.Name)
+	if err != nil {
+		return "", err
+	}
+	s, ok := fc.Arguments[1].(*ast.StringLiteral)
+	if !ok {
+		return "", errors.Newf(errors.ErrTypeMismatch, "%s requires a string literal for RediSearch", fc.Name)
+	}
+	if s.Value == "" {
+		// Every string starts with, ends with, and contains ""
+		return negate(missingQuery(field)), nil
+	}
+
+	pattern := before + escapeRediSearch(s.Value) + after
+	if c.textFields[field] {
+		return "@" + escapeRediSearch(field) + ":" + pattern, nil
+	}
+	return tagQuery(field, []string{pattern}), nil
+}
+
+// Helper functions
+
+// numericQuery matches the values of a NUMERIC attribute in a range, such as
+// "@age:[18 +inf]". A bound starting with "(" is exclusive.
+func numericQuery(field, low, high string) string {
+	return "@" + escapeRediSearch(field) + ":[" + low + " " + high + "]"
+}
+
+// tagQuery matches the values of a TAG attribute equal to any of the
+// escaped tags, such as "@status:{active | pending}".
+func tagQuery(field string, tags []string) string {
+	return "@" + escapeRediSearch(field) + ":{" + strings.Join(tags, " | ") + "}"
+}
+
+// missingQuery matches documents without a value for an attribute. The
+// attribute must be indexed with INDEXMISSING, in RediSearch 2.10 or later.
+func missingQuery(field string) string {
+	return "ismissing(@" + escapeRediSearch(field) + ")"
+}
+
+// negate excludes the documents a query matches.
+func negate(query string) string {
+	if strings.HasPrefix(query, "-") {
+		return "-(" + query + ")"
+	}
+	return "-" + query
+}
+
+// numberLiteral returns a number literal, or a negated one, as written in
+// numeric ranges.
+func numberLiteral(expr ast.Expression) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(e.Value, 10), true
+	case *ast.FloatLiteral:
+		return strconv.FormatFloat(e.Value, 'f', -1, 64), true
+	case *ast.GroupedExpression:
+		return numberLiteral(e.Expression)
+	case *ast.UnaryExpression:
+		if e.Operator == "-" {
+			if n, ok := numberLiteral(e.Operand); ok && !strings.HasPrefix(n, "-") {
+				return "-" + n, true
+			}
+		}
+	}
+	return "", false
+}
+
+// swapComparison returns the operator comparing the operands in the other
+// order.
+func swapComparison(operator string) string {
+	switch operator {
+	case "<":
+		return ">"
+	case ">":
+		return "<"
+	case "<=":
+		return ">="
+	case ">=":
+		return "<="
+	}
+	return operator
+}
+
+// logicalOperator normalizes the spellings of && and ||, and returns "" for
+// other operators.
+func logicalOperator(operator string) string {
+	switch operator {
+	case "&&", "AND", "and":
+		return "&&"
+	case "||", "OR", "or":
+		return "||"
+	}
+	return ""
+}
+
+// escapeRediSearch escapes the punctuation and spaces of a tag, term, or
+// attribute name with backslashes, so they are not read as query syntax.
+func escapeRediSearch(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 128 && !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// quoteRediSearch quotes a string as an exact phrase of a TEXT attribute.
+func quoteRediSearch(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// defaultRediSearchFieldMapper converts $.user.name to user.name, which
+// queries read as "@user\.name". Paths with indexes have no attribute.
+func defaultRediSearchFieldMapper(path string) string {
+	if strings.Contains(path, "[") {
+		return ""
+	}
+	path = strings.TrimPrefix(path, "$.")
+	path = strings.TrimPrefix(path, "$")
+	return strings.Trim(path, ".")
+}
+
+// CompileToRediSearch is a convenience function that compiles an AMEL expression to a RediSearch query.
+func CompileToRediSearch(expr ast.Expression, opts ...RediSearchCompilerOption) (*RediSearchResult, error) {
+	compiler := NewRediSearchCompiler(opts...)
+	return compiler.Compile(expr)
+}
@@ -0,0 +1,189 @@
+package compiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+func TestRediSearchCompiler_Basic(t *testing.T) {
+	tests := []struct {
+		dsl           string
+		expectedQuery string
+	}{
+		{`$.age > 18`, `@age:[(18 +inf]`},
+		{`$.age >= 18`, `@age:[18 +inf]`},
+		{`$.price < 9.99`, `@price:[-inf (9.99]`},
+		{`$.balance <= -5`, `@balance:[-inf -5]`},
+		{`18 < $.age`, `@age:[(18 +inf]`},
+		{`$.age == 30`, `@age:[30 30]`},
+		{`$.age != 30`, `-@age:[30 30]`},
+		{`$.status == "active"`, `@status:{active}`},
+		{`"active" == $.status`, `@status:{active}`},
+		{`$.user.email == "a.b@example.com"`, `@user\.email:{a\.b\@example\.com}`},
+		{`$.city == "New York"`, `@city:{New\ York}`},
+		{`lower($.status) == "active"`, `@status:{active}`},
+		{`$.verified == true`, `@verified:{true}`},
+		{`$.verified`, `@verified:{true}`},
+		{`!$.banned`, `-@banned:{true}`},
+		{`$.deletedAt == null`, `ismissing(@deletedAt)`},
+		{`$.deletedAt != null`, `-ismissing(@deletedAt)`},
+		{`$.age >= 18 && $.status == "active"`, `(@age:[18 +inf] @status:{active})`},
+		{`$.a > 1 && $.b > 2 && $.c > 3`, `(@a:[(1 +inf] @b:[(2 +inf] @c:[(3 +inf])`},
+		{`$.tier == "gold" || $.tier == "platinum" || $.vip`, `(@tier:{gold} | @tier:{platinum} | @vip:{true})`},
+		{`$.age >= 18 && ($.country == "US" || $.country == "CA")`, `(@age:[18 +inf] (@country:{US} | @country:{CA}))`},
+		{`!($.a > 1 && $.b > 2)`, `-(@a:[(1 +inf] @b:[(2 +inf])`},
+		{`!($.age != 30)`, `-(-@age:[30 30])`},
+		{`$.status IN ["active", "pending"]`, `@status:{active | pending}`},
+		{`$.status NOT IN ["banned"]`, `-@status:{banned}`},
+		{`$.code IN [1, 2]`, `(@code:[1 1] | @code:[2 2])`},
+		{`$.code IN [1]`, `@code:[1 1]`},
+		{`"admin" IN $.roles`, `@roles:{admin}`},
+		{`startsWith($.sku, "AB-")`, `@sku:{AB\-*}`},
+		{`endsWith($.email, "@example.com")`, `@email:{*\@example\.com}`},
+		{`contains($.name, "ann")`, `@name:{*ann*}`},
+		{`startsWith($.sku, "")`, `-ismissing(@sku)`},
+		{`between($.age, 18, 65)`, `@age:[18 65]`},
+		{`isNull($.email)`, `ismissing(@email)`},
+		{`isNotNull($.email)`, `-ismissing(@email)`},
+		{`exists($.email)`, `-ismissing(@email)`},
+		{`true`, `*`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			expr, err := parser.Parse(tt.dsl)
+			if err != nil {
+				t.Fatalf("failed to parse DSL: %v", err)
+			}
+
+			result, err := CompileToRediSearch(expr)
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			if result.Query != tt.expectedQuery {
+				t.Errorf("expected query:\n%s\ngot:\n%s", tt.expectedQuery, result.Query)
+			}
+		})
+	}
+}
+
+func TestRediSearchCompiler_TextFields(t *testing.T) {
+	tests := []struct {
+		dsl           string
+		expectedQuery string
+	}{
+		{`$.title == "hello world"`, `@title:"hello world"`},
+		{`$.title == "say \"hi\""`, `@title:"say \"hi\""`},
+		{`startsWith($.title, "hel")`, `@title:hel*`},
+		{`endsWith($.title, "orld")`, `@title:*orld`},
+		{`contains($.title, "lo wo")`, `@title:*lo\ wo*`},
+		{`$.title IN ["a", "b"]`, `(@title:"a" | @title:"b")`},
+		{`$.status == "active"`, `@status:{active}`},
+	}
+
+	c := NewRediSearchCompiler(WithRediSearchTextFields("title"))
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			expr, err := parser.Parse(tt.dsl)
+			if err != nil {
+				t.Fatalf("failed to parse DSL: %v", err)
+			}
+
+			result, err := c.Compile(expr)
+			if err != nil {
+				t.Fatalf("failed to compile: %v", err)
+			}
+			if result.Query != tt.expectedQuery {
+				t.Errorf("expected query:\n%s\ngot:\n%s", tt.expectedQuery, result.Query)
+			}
+		})
+	}
+}
+
+func TestRediSearchCompiler_FieldMapper(t *testing.T) {
+	expr, err := parser.Parse(`$.user.name == "x" && $.user.age > 21`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	mapper := func(path string) string {
+		return strings.ReplaceAll(strings.TrimPrefix(path, "$."), ".", "_")
+	}
+	result, err := NewRediSearchCompiler(WithRediSearchFieldMapper(mapper)).Compile(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	expected := `(@user_name:{x} @user_age:[(21 +inf])`
+	if result.Query != expected {
+		t.Errorf("expected query:\n%s\ngot:\n%s", expected, result.Query)
+	}
+
+	command := []string{"FT.SEARCH", "idx:users", expected, "DIALECT", "2"}
+	if !reflect.DeepEqual(command, result.Command("idx:users")) {
+		t.Errorf("expected command %q, got %q", command, result.Command("idx:users"))
+	}
+}
+
+func TestRediSearchCompiler_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		dsl  string
+		code errors.ErrorCode
+		msg  string
+	}{
+		{"unsupported function", `customFunc($.name)`, errors.ErrUndefinedFunction, "unsupported function for RediSearch"},
+		{"indexed path", `$.items[0].price > 5`, errors.ErrInvalidSyntax, "cannot map"},
+		{"regex", `$.name =~ "^a"`, errors.ErrInvalidOperator, "no regex matching"},
+		{"two fields", `$.a > $.b`, errors.ErrInvalidOperator, "cannot compare two fields"},
+		{"no field", `1 < 2`, errors.ErrInvalidSyntax, "requires a field"},
+		{"string ordering", `$.name < "m"`, errors.ErrTypeMismatch, "orders numbers only"},
+		{"arithmetic", `$.price * $.quantity > 100`, errors.ErrInvalidSyntax, "requires a field"},
+		{"arithmetic operator", `$.price + 1`, errors.ErrInvalidOperator, "unsupported operator"},
+		{"empty list", `$.tier IN []`, errors.ErrInvalidSyntax, "at least one value"},
+		{"false", `false`, errors.ErrInvalidSyntax, "matching nothing"},
+		{"dynamic pattern", `startsWith($.sku, $.prefix)`, errors.ErrTypeMismatch, "string literal"},
+		{"dynamic bounds", `between($.age, $.min, 65)`, errors.ErrTypeMismatch, "number literals"},
+		{"arity", `contains($.name)`, errors.ErrArgumentCount, "exactly 2 arguments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parser.Parse(tt.dsl)
+			if err != nil {
+				t.Fatalf("failed to parse DSL: %v", err)
+			}
+
+			_, err = CompileToRediSearch(expr)
+			if !errors.IsCode(err, tt.code) || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("expected %v error containing %q, got: %v", tt.code, tt.msg, err)
+			}
+		})
+	}
+}
+
+func TestRediSearchCompiler_Trace(t *testing.T) {
+	expr, err := parser.Parse(`$.age > 18 || $.tier IN ["gold"]`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	result, err := NewRediSearchCompiler(WithRediSearchTrace(true)).Compile(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	expected := []TraceEntry{
+		{Fragment: result.Query, Expression: expr.String(), Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 33}},
+		{Fragment: `@age:[(18 +inf]`, Expression: `($.age > 18)`, Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 11}},
+		{Fragment: `@tier:{gold}`, Expression: `($.tier IN ["gold"])`, Span: ast.Span{Line: 1, Column: 15, EndLine: 1, EndColumn: 33}},
+	}
+	if !reflect.DeepEqual(expected, result.Trace) {
+		t.Errorf("expected trace:\n%+v\ngot:\n%+v", expected, result.Trace)
+	}
+}
@@ -0,0 +1,93 @@
+// Package compiler provides compilation targets for AMEL expressions.
+package compiler
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/bencagri/amel/pkg/ast"
+)
+
+// Target is a compilation backend: it translates expressions to the query
+// language of a store, such as a SQL dialect or a search API filter.
+// Implementations must be safe for concurrent use.
+type Target interface {
+	// Name identifies the target, such as "postgres".
+	Name() string
+	// Compile returns the compiled query, such as a *SQLResult, or an error
+	// if the expression uses something the target cannot express.
+	Compile(expr ast.Expression) (interface{}, error)
+}
+
+// TargetFunc is the compile function of a target created with NewTarget.
+type TargetFunc func(expr ast.Expression) (interface{}, error)
+
+type funcTarget struct {
+	name string
+	fn   TargetFunc
+}
+
+func (t funcTarget) Name() string { return t.name }
+
+func (t funcTarget) Compile(expr ast.Expression) (interface{}, error) { return t.fn(expr) }
+
+// NewTarget returns a target compiling expressions with fn.
+func NewTarget(name string, fn TargetFunc) Target {
+	return funcTarget{name: name, fn: fn}
+}
+
+var (
+	targetsMu sync.RWMutex
+	targets   = make(map[string]Target)
+)
+
+func init() {
+	sql := func(name string, dialect SQLDialect) {
+		Register(NewTarget(name, func(expr ast.Expression) (interface{}, error) {
+			return CompileToSQL(expr, WithDialect(dialect))
+		}))
+	}
+	sql("sql", DialectStandard)
+	sql("postgres", DialectPostgres)
+	sql("mysql", DialectMySQL)
+	sql("sqlite", DialectSQLite)
+	Register(NewTarget("mongodb", func(expr ast.Expression) (interface{}, error) {
+		return CompileToMongoDB(expr)
+	}))
+	Register(NewTarget("painless", func(expr ast.Expression) (interface{}, error) {
+		return CompileToPainless(expr)
+	}))
+	Register(NewTarget("redisearch", func(expr ast.Expression) (interface{}, error) {
+		return CompileToRediSearch(expr)
+	}))
+}
+
+// Register adds a target to the registry, replacing the target of the same
+// name. Third-party backends typically register their targets in an init
+// function. The registry starts with the targets "sql", "postgres", "mysql",
+// "sqlite", "mongodb", "painless", and "redisearch".
+func Register(t Target) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	targets[t.Name()] = t
+}
+
+// Lookup returns the registered target of the given name.
+func Lookup(name string) (Target, bool) {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	t, ok := targets[name]
+	return t, ok
+}
+
+// Targets returns the registered targets, sorted by name.
+func Targets() []Target {
+	targetsMu.RLock()
+	defer targetsMu.RUnlock()
+	list := make([]Target, 0, len(targets))
+	for _, t := range targets {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
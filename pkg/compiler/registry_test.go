@@ -0,0 +1,48 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+func TestTargetRegistry(t *testing.T) {
+	for _, name := range []string{"sql", "postgres", "mysql", "sqlite", "mongodb", "painless", "redisearch"} {
+		if _, ok := Lookup(name); !ok {
+			t.Errorf("expected built-in target %q", name)
+		}
+	}
+
+	expr, err := parser.Parse(`$.age > 18`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	postgres, _ := Lookup("postgres")
+	output, err := postgres.Compile(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	if sql := output.(*SQLResult).SQL; sql != `("age" > $1)` {
+		t.Errorf("expected postgres SQL, got: %s", sql)
+	}
+
+	Register(NewTarget("echo", func(expr ast.Expression) (interface{}, error) {
+		return expr.String(), nil
+	}))
+	echo, ok := Lookup("echo")
+	if !ok {
+		t.Fatal("expected registered target")
+	}
+	if output, _ := echo.Compile(expr); output != "($.age > 18)" {
+		t.Errorf("unexpected output: %v", output)
+	}
+
+	names := ""
+	for _, target := range Targets() {
+		names += target.Name() + " "
+	}
+	if names != "echo mongodb mysql painless postgres redisearch sql sqlite " {
+		t.Errorf("expected targets sorted by name, got: %s", names)
+	}
+}
@@ -26,6 +26,8 @@ type SQLCompiler struct {
 	paramStyle  ParamStyle
 	params      []interface{}
 	paramIndex  int
+	trace       bool
+	entries     []TraceEntry
 }
 
 // ParamStyle represents how parameters are formatted in SQL.
@@ -72,6 +74,14 @@ func WithFieldMapper(mapper func(string) string) SQLCompilerOption {
 	}
 }
 
+// WithSQLTrace makes the compiler report which expression produced each
+// fragment of the SQL, in SQLResult.Trace.
+func WithSQLTrace(enabled bool) SQLCompilerOption {
+	return func(c *SQLCompiler) {
+		c.trace = enabled
+	}
+}
+
 // NewSQLCompiler creates a new SQL compiler with the given options.
 func NewSQLCompiler(opts ...SQLCompilerOption) *SQLCompiler {
 	c := &SQLCompiler{
@@ -96,12 +106,14 @@ func NewSQLCompiler(opts ...SQLCompilerOption) *SQLCompiler {
 type SQLResult struct {
 	SQL    string        // The WHERE clause (without "WHERE" keyword)
 	Params []interface{} // The parameter values
+	Trace  []TraceEntry  // Nil unless tracing is enabled
 }
 
 // Compile compiles an AMEL expression to a SQL WHERE clause.
 func (c *SQLCompiler) Compile(expr ast.Expression) (*SQLResult, error) {
 	c.params = make([]interface{}, 0)
 	c.paramIndex = 0
+	c.entries = nil
 
 	sql, err := c.compile(expr)
 	if err != nil {
@@ -111,10 +123,34 @@ func (c *SQLCompiler) Compile(expr ast.Expression) (*SQLResult, error) {
 	return &SQLResult{
 		SQL:    sql,
 		Params: c.params,
+		Trace:  c.entries,
 	}, nil
 }
 
+// compile compiles a node, recording its trace entry if tracing is enabled
+// and the span of the node on errors.
 func (c *SQLCompiler) compile(expr ast.Expression) (string, error) {
+	if !c.trace || !traced(expr) {
+		sql, err := c.compileNode(expr)
+		return sql, annotate(err, expr)
+	}
+
+	// Reserve the entry so that it precedes those of the operands
+	i := len(c.entries)
+	c.entries = append(c.entries, TraceEntry{})
+	first := len(c.params)
+	sql, err := c.compileNode(expr)
+	if err != nil {
+		return "", annotate(err, expr)
+	}
+	c.entries[i] = TraceEntry{Fragment: sql, Expression: expr.String(), Span: ast.SpanOf(expr)}
+	if len(c.params) > first {
+		c.entries[i].Params = append([]interface{}(nil), c.params[first:]...)
+	}
+	return sql, nil
+}
+
+func (c *SQLCompiler) compileNode(expr ast.Expression) (string, error) {
 	switch e := expr.(type) {
 	case *ast.IntegerLiteral:
 		return c.compileParam(e.Value)
@@ -225,6 +261,11 @@ func (c *SQLCompiler) compileJSONPath(jp *ast.JSONPathExpression) (string, error
 }
 
 func (c *SQLCompiler) compileBinaryExpression(be *ast.BinaryExpression) (string, error) {
+	if be.Operator == "~/" {
+		// Integer division differs between dialects: DIV, /, or FLOOR(a / b)
+		return "", errors.Newf(errors.ErrInvalidOperator, "unsupported binary operator for SQL: %s", be.Operator)
+	}
+
 	left, err := c.compile(be.Left)
 	if err != nil {
 		return "", err
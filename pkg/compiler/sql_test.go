@@ -1,8 +1,10 @@
 package compiler
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/bencagri/amel/pkg/ast"
 	"github.com/bencagri/amel/pkg/parser"
 )
 
@@ -715,3 +717,35 @@ func TestCompileToSQL_Convenience(t *testing.T) {
 		t.Errorf("expected 2 params, got %d", len(result.Params))
 	}
 }
+
+func TestSQLCompiler_Trace(t *testing.T) {
+	expr, err := parser.Parse(`$.age > 18 && lower($.name) IN ["ann", "bob"]`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	result, err := NewSQLCompiler(WithDialect(DialectPostgres), WithSQLTrace(true)).Compile(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+
+	expected := []TraceEntry{
+		{Fragment: result.SQL, Expression: expr.String(), Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 46}, Params: []interface{}{int64(18), "ann", "bob"}},
+		{Fragment: `("age" > $1)`, Expression: `($.age > 18)`, Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 11}, Params: []interface{}{int64(18)}},
+		{Fragment: `"age"`, Expression: `$.age`, Span: ast.Span{Line: 1, Column: 1, EndLine: 1, EndColumn: 6}},
+		{Fragment: `LOWER("name") IN ($2, $3)`, Expression: `(lower($.name) IN ["ann", "bob"])`, Span: ast.Span{Line: 1, Column: 15, EndLine: 1, EndColumn: 46}, Params: []interface{}{"ann", "bob"}},
+		{Fragment: `LOWER("name")`, Expression: `lower($.name)`, Span: ast.Span{Line: 1, Column: 15, EndLine: 1, EndColumn: 28}},
+		{Fragment: `"name"`, Expression: `$.name`, Span: ast.Span{Line: 1, Column: 21, EndLine: 1, EndColumn: 27}},
+	}
+	if !reflect.DeepEqual(expected, result.Trace) {
+		t.Errorf("expected trace:\n%+v\ngot:\n%+v", expected, result.Trace)
+	}
+
+	result, err = NewSQLCompiler().Compile(expr)
+	if err != nil {
+		t.Fatalf("failed to compile: %v", err)
+	}
+	if result.Trace != nil {
+		t.Errorf("expected no trace without WithSQLTrace, got %+v", result.Trace)
+	}
+}
@@ -0,0 +1,43 @@
+// Package compiler provides compilation targets for AMEL expressions.
+package compiler
+
+import (
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+)
+
+// TraceEntry links a fragment of compiled output to the expression it was
+// compiled from, to debug unexpected query output. Entries are recorded for
+// operators, function calls, and payload paths, outermost first.
+type TraceEntry struct {
+	Fragment   string   `json:"fragment"`   // The SQL text, the JSON of the MongoDB query document, the Painless source, or the RediSearch query
+	Expression string   `json:"expression"` // The expression as printed by the AST
+	Span       ast.Span `json:"span"`       // The source range of the expression
+
+	// Params holds the SQL or Painless parameters bound by the placeholders
+	// of the fragment, in order.
+	Params []interface{} `json:"params,omitempty"`
+}
+
+// traced reports whether compiling a node records a trace entry.
+func traced(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.BinaryExpression, *ast.UnaryExpression, *ast.InExpression,
+		*ast.RegexExpression, *ast.FunctionCall, *ast.JSONPathExpression:
+		return true
+	}
+	return false
+}
+
+// annotate records on err the span of the node it was raised by. Only the
+// innermost node is recorded; errors passing through enclosing nodes keep it.
+func annotate(err error, node ast.Expression) error {
+	amelErr, ok := err.(*errors.Error)
+	if !ok || amelErr.EndLine > 0 {
+		return err
+	}
+	span := ast.SpanOf(node)
+	amelErr.Line, amelErr.Column = span.Line, span.Column
+	amelErr.EndLine, amelErr.EndColumn = span.EndLine, span.EndColumn
+	return err
+}
@@ -0,0 +1,126 @@
+// Package decision provides decision tables evaluated by the AMEL engine.
+package decision
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// CSV header conventions.
+const (
+	csvOutputPrefix   = "out:"     // Marks an output column, e.g. "out:discount"
+	csvPriorityColumn = "priority" // Optional row priority column
+)
+
+// ParseJSON parses a decision table from its JSON representation.
+//
+//	{
+//	  "name": "discounts",
+//	  "hitPolicy": "first",
+//	  "inputs": ["$.age", "$.tier"],
+//	  "outputs": ["discount"],
+//	  "rows": [
+//	    {"conditions": [">= 65", "-"], "outputs": {"discount": 0.2}},
+//	    {"conditions": ["-", "\"gold\""], "outputs": {"discount": 0.1}}
+//	  ]
+//	}
+func ParseJSON(data []byte) (*Table, error) {
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "failed to parse decision table JSON", err)
+	}
+	return &t, nil
+}
+
+// LoadJSON reads a decision table in JSON format from r.
+func LoadJSON(r io.Reader) (*Table, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJSON(data)
+}
+
+// LoadCSV reads a decision table in CSV format from r.
+//
+// The first record is the header. Columns prefixed with "out:" are outputs, a column
+// named "priority" holds the row priority, and every other column is an input
+// expression. Each following record is a row. Output cells are decoded as JSON
+// literals when possible and kept as plain strings otherwise.
+//
+//	$.age,$.tier,out:discount,priority
+//	>= 65,-,0.2,1
+//	-,"""gold""",0.1,2
+func LoadCSV(r io.Reader, policy HitPolicy) (*Table, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "failed to parse decision table CSV", err)
+	}
+	if len(records) == 0 {
+		return nil, errors.New(errors.ErrInvalidSyntax, "decision table CSV is empty")
+	}
+
+	t := &Table{HitPolicy: policy}
+
+	header := records[0]
+	inputCols := []int{}
+	outputCols := []int{}
+	priorityCol := -1
+	for i, col := range header {
+		col = strings.TrimSpace(col)
+		switch {
+		case strings.HasPrefix(col, csvOutputPrefix):
+			t.Outputs = append(t.Outputs, strings.TrimSpace(strings.TrimPrefix(col, csvOutputPrefix)))
+			outputCols = append(outputCols, i)
+		case strings.EqualFold(col, csvPriorityColumn):
+			priorityCol = i
+		default:
+			t.Inputs = append(t.Inputs, col)
+			inputCols = append(inputCols, i)
+		}
+	}
+
+	for n, record := range records[1:] {
+		row := &Row{
+			Conditions: make([]string, len(inputCols)),
+			Outputs:    make(map[string]interface{}, len(outputCols)),
+		}
+		for i, col := range inputCols {
+			row.Conditions[i] = record[col]
+		}
+		for i, col := range outputCols {
+			row.Outputs[t.Outputs[i]] = parseCSVValue(record[col])
+		}
+		if priorityCol >= 0 && strings.TrimSpace(record[priorityCol]) != "" {
+			priority, err := strconv.Atoi(strings.TrimSpace(record[priorityCol]))
+			if err != nil {
+				return nil, errors.Newf(errors.ErrInvalidNumber, "row %d: invalid priority %q", n+1, record[priorityCol])
+			}
+			row.Priority = priority
+		}
+		t.Rows = append(t.Rows, row)
+	}
+
+	return t, nil
+}
+
+// parseCSVValue decodes a CSV output cell as a JSON literal, falling back to the raw string.
+func parseCSVValue(cell string) interface{} {
+	cell = strings.TrimSpace(cell)
+	if cell == "" {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(cell), &v); err == nil {
+		return v
+	}
+	return cell
+}
@@ -0,0 +1,227 @@
+// Package decision provides decision tables evaluated by the AMEL engine.
+package decision
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/engine"
+)
+
+// HitPolicy determines which matching rows contribute to the result.
+type HitPolicy int
+
+const (
+	HitFirst    HitPolicy = iota // First matching row in table order
+	HitPriority                  // Matching row with the highest priority
+	HitCollect                   // All matching rows in table order
+)
+
+var hitPolicyNames = map[HitPolicy]string{
+	HitFirst:    "first",
+	HitPriority: "priority",
+	HitCollect:  "collect",
+}
+
+// String returns the string representation of a hit policy.
+func (h HitPolicy) String() string {
+	if name, ok := hitPolicyNames[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("HitPolicy(%d)", h)
+}
+
+// ParseHitPolicy parses a hit policy name (case-insensitive).
+func ParseHitPolicy(name string) (HitPolicy, error) {
+	for h, n := range hitPolicyNames {
+		if strings.EqualFold(n, name) {
+			return h, nil
+		}
+	}
+	return HitFirst, errors.Newf(errors.ErrInvalidSyntax, "unknown hit policy '%s'", name)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (h HitPolicy) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (h *HitPolicy) UnmarshalText(text []byte) error {
+	parsed, err := ParseHitPolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// conflictPolicy maps the hit policy to the equivalent rule set conflict policy.
+func (h HitPolicy) conflictPolicy() engine.ConflictPolicy {
+	switch h {
+	case HitPriority:
+		return engine.PolicyHighestPriority
+	case HitCollect:
+		return engine.PolicyAllMatches
+	default:
+		return engine.PolicyFirstMatch
+	}
+}
+
+// Row is a single rule of a decision table.
+//
+// Each condition cell applies to the input column at the same position. A cell is
+// either a wildcard ("" or "-"), an operator followed by an operand (">= 18",
+// `IN ["gold", "silver"]`, `=~ "^A"`), or a plain value that is compared for equality.
+type Row struct {
+	Conditions []string               `json:"conditions"`
+	Outputs    map[string]interface{} `json:"outputs"`
+	Priority   int                    `json:"priority,omitempty"`
+}
+
+// Table is a decision table: input expressions, rows of conditions, and the outputs
+// each row produces when all of its conditions hold.
+type Table struct {
+	Name      string    `json:"name,omitempty"`
+	HitPolicy HitPolicy `json:"hitPolicy"`
+	Inputs    []string  `json:"inputs"`
+	Outputs   []string  `json:"outputs"`
+	Rows      []*Row    `json:"rows"`
+
+	rules *engine.RuleSet
+}
+
+// Match describes a row that matched during evaluation.
+type Match struct {
+	Row      int                    // Zero-based row index
+	Priority int                    // Row priority
+	Outputs  map[string]interface{} // Row outputs
+}
+
+// Result is the outcome of evaluating a decision table.
+type Result struct {
+	Matches []*Match
+}
+
+// Matched returns true if at least one row matched.
+func (r *Result) Matched() bool {
+	return len(r.Matches) > 0
+}
+
+// Outputs returns the outputs of the first selected row, or nil if nothing matched.
+func (r *Result) Outputs() map[string]interface{} {
+	if len(r.Matches) == 0 {
+		return nil
+	}
+	return r.Matches[0].Outputs
+}
+
+// Compile validates the table and compiles every row with the given engine.
+// A table must be compiled before it can be evaluated.
+func (t *Table) Compile(eng *engine.Engine) error {
+	if len(t.Inputs) == 0 {
+		return errors.New(errors.ErrInvalidSyntax, "decision table requires at least one input")
+	}
+
+	rules := eng.NewRuleSet(engine.WithConflictPolicy(t.HitPolicy.conflictPolicy()))
+	for i, row := range t.Rows {
+		if len(row.Conditions) != len(t.Inputs) {
+			return errors.Newf(errors.ErrInvalidSyntax,
+				"row %d has %d conditions, expected %d", i+1, len(row.Conditions), len(t.Inputs))
+		}
+		for name := range row.Outputs {
+			if !t.hasOutput(name) {
+				return errors.Newf(errors.ErrInvalidSyntax, "row %d has unknown output '%s'", i+1, name)
+			}
+		}
+
+		dsl := t.rowExpression(row)
+		if err := rules.Add(rowName(i), dsl, engine.WithPriority(row.Priority)); err != nil {
+			return errors.Wrap(errors.ErrInvalidSyntax, fmt.Sprintf("row %d: %v", i+1, err), err)
+		}
+	}
+
+	t.rules = rules
+	return nil
+}
+
+// Evaluate evaluates the table against a payload according to its hit policy.
+func (t *Table) Evaluate(payload interface{}) (*Result, error) {
+	if t.rules == nil {
+		return nil, errors.New(errors.ErrInvalidSyntax, "decision table is not compiled")
+	}
+
+	fired, err := t.rules.Fire(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	for _, f := range fired.Fired {
+		result.Matches = append(result.Matches, t.match(rowIndex(f.Name)))
+	}
+	return result, nil
+}
+
+// hasOutput checks if the table declares an output column with the given name.
+func (t *Table) hasOutput(name string) bool {
+	for _, o := range t.Outputs {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// match builds a Match for the row at index i.
+func (t *Table) match(i int) *Match {
+	row := t.Rows[i]
+	return &Match{Row: i, Priority: row.Priority, Outputs: row.Outputs}
+}
+
+// rowExpression combines a row's condition cells into a single AMEL expression.
+func (t *Table) rowExpression(row *Row) string {
+	parts := make([]string, 0, len(row.Conditions))
+	for i, cell := range row.Conditions {
+		if cond := conditionExpression(t.Inputs[i], cell); cond != "" {
+			parts = append(parts, cond)
+		}
+	}
+	if len(parts) == 0 {
+		return "true"
+	}
+	return strings.Join(parts, " && ")
+}
+
+// cellOperators lists the operators a condition cell may start with.
+// Longer operators come first so that ">=" is not mistaken for ">".
+var cellOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "<", ">", "NOT IN ", "not in ", "IN ", "in "}
+
+// conditionExpression builds the AMEL expression for a single condition cell.
+// It returns an empty string for wildcard cells.
+func conditionExpression(input, cell string) string {
+	cell = strings.TrimSpace(cell)
+	if cell == "" || cell == "-" {
+		return ""
+	}
+
+	for _, op := range cellOperators {
+		if strings.HasPrefix(cell, op) {
+			return fmt.Sprintf("(%s) %s", input, cell)
+		}
+	}
+	return fmt.Sprintf("(%s) == (%s)", input, cell)
+}
+
+// rowName returns the rule name used for the row at index i.
+func rowName(i int) string {
+	return fmt.Sprintf("row%d", i)
+}
+
+// rowIndex parses the row index back out of a rule name.
+func rowIndex(name string) int {
+	i, _ := strconv.Atoi(strings.TrimPrefix(name, "row"))
+	return i
+}
@@ -0,0 +1,144 @@
+package decision
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const discountTableJSON = `{
+	"name": "discounts",
+	"hitPolicy": "first",
+	"inputs": ["$.age", "$.tier"],
+	"outputs": ["discount"],
+	"rows": [
+		{"conditions": [">= 65", "-"], "outputs": {"discount": 0.2}, "priority": 1},
+		{"conditions": ["-", "\"gold\""], "outputs": {"discount": 0.1}, "priority": 2},
+		{"conditions": ["< 18", "IN [\"silver\", \"gold\"]"], "outputs": {"discount": 0.05}, "priority": 3}
+	]
+}`
+
+func compileTable(t *testing.T, table *Table) *Table {
+	t.Helper()
+
+	eng, err := engine.New()
+	require.NoError(t, err)
+	require.NoError(t, table.Compile(eng))
+	return table
+}
+
+func TestParseJSON(t *testing.T) {
+	table, err := ParseJSON([]byte(discountTableJSON))
+	require.NoError(t, err)
+
+	assert.Equal(t, "discounts", table.Name)
+	assert.Equal(t, HitFirst, table.HitPolicy)
+	assert.Equal(t, []string{"$.age", "$.tier"}, table.Inputs)
+	assert.Len(t, table.Rows, 3)
+
+	_, err = ParseJSON([]byte(`{"hitPolicy": "unknown"}`))
+	assert.Error(t, err)
+}
+
+func TestTable_HitPolicies(t *testing.T) {
+	payload := map[string]interface{}{"age": 70, "tier": "gold"}
+
+	tests := []struct {
+		policy      HitPolicy
+		wantRows    []int
+		wantOutputs map[string]interface{}
+	}{
+		{HitFirst, []int{0}, map[string]interface{}{"discount": 0.2}},
+		{HitPriority, []int{1}, map[string]interface{}{"discount": 0.1}},
+		{HitCollect, []int{0, 1}, map[string]interface{}{"discount": 0.2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			table, err := ParseJSON([]byte(discountTableJSON))
+			require.NoError(t, err)
+			table.HitPolicy = tt.policy
+			compileTable(t, table)
+
+			result, err := table.Evaluate(payload)
+			require.NoError(t, err)
+
+			rows := make([]int, len(result.Matches))
+			for i, m := range result.Matches {
+				rows[i] = m.Row
+			}
+			assert.Equal(t, tt.wantRows, rows)
+			assert.Equal(t, tt.wantOutputs, result.Outputs())
+		})
+	}
+}
+
+func TestTable_NoMatch(t *testing.T) {
+	table, err := ParseJSON([]byte(discountTableJSON))
+	require.NoError(t, err)
+	compileTable(t, table)
+
+	result, err := table.Evaluate(map[string]interface{}{"age": 30, "tier": "bronze"})
+	require.NoError(t, err)
+	assert.False(t, result.Matched())
+	assert.Nil(t, result.Outputs())
+}
+
+func TestTable_CompileErrors(t *testing.T) {
+	eng, err := engine.New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		table *Table
+	}{
+		{"no inputs", &Table{}},
+		{"condition count mismatch", &Table{
+			Inputs: []string{"$.a", "$.b"},
+			Rows:   []*Row{{Conditions: []string{"1"}}},
+		}},
+		{"unknown output", &Table{
+			Inputs:  []string{"$.a"},
+			Outputs: []string{"x"},
+			Rows:    []*Row{{Conditions: []string{"1"}, Outputs: map[string]interface{}{"y": 1}}},
+		}},
+		{"invalid condition", &Table{
+			Inputs: []string{"$.a"},
+			Rows:   []*Row{{Conditions: []string{">= (1 +"}}},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.table.Compile(eng))
+		})
+	}
+
+	_, err = (&Table{Inputs: []string{"$.a"}}).Evaluate(nil)
+	assert.Error(t, err, "evaluating an uncompiled table should fail")
+}
+
+func TestLoadCSV(t *testing.T) {
+	input := `$.age,$.tier,out:discount,out:label,priority
+>= 65,-,0.2,senior,1
+-,"""gold""",0.1,"""gold member""",2
+`
+	table, err := LoadCSV(strings.NewReader(input), HitPriority)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"$.age", "$.tier"}, table.Inputs)
+	assert.Equal(t, []string{"discount", "label"}, table.Outputs)
+	require.Len(t, table.Rows, 2)
+	assert.Equal(t, []string{"-", `"gold"`}, table.Rows[1].Conditions)
+	assert.Equal(t, 2, table.Rows[1].Priority)
+	assert.Equal(t, "senior", table.Rows[0].Outputs["label"])
+	assert.Equal(t, "gold member", table.Rows[1].Outputs["label"])
+
+	compileTable(t, table)
+	result, err := table.Evaluate(map[string]interface{}{"age": 70, "tier": "gold"})
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, result.Outputs()["discount"])
+}
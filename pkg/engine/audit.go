@@ -0,0 +1,128 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// AuditRecord describes one evaluation for compliance logging. Expressions and
+// payloads are identified by SHA-256 digests so records can be correlated
+// without storing the payload itself. ExpressionHash is the digest of the
+// source text; CanonicalHash is the same for equivalent expressions written
+// differently.
+type AuditRecord struct {
+	Time           time.Time     `json:"time"`
+	Tenant         string        `json:"tenant,omitempty"`
+	Rule           string        `json:"rule,omitempty"`
+	ExpressionHash string        `json:"expressionHash"`
+	CanonicalHash  string        `json:"canonicalHash,omitempty"` // See CompiledExpression.Hash
+	PayloadDigest  string        `json:"payloadDigest"`
+	Result         interface{}   `json:"result"`
+	ResultType     string        `json:"resultType"`
+	Error          string        `json:"error,omitempty"`
+	ErrorCode      int           `json:"errorCode,omitempty"`
+	Duration       time.Duration `json:"durationNs"`
+	Functions      []string      `json:"functions"`
+	Cached         bool          `json:"cached,omitempty"` // The result was provided by a plugin
+}
+
+// AuditSink receives one record per evaluation. Audit is called synchronously
+// on the evaluating goroutine and must be safe for concurrent use.
+type AuditSink interface {
+	Audit(record *AuditRecord)
+}
+
+// AuditSinkFunc adapts a function to the AuditSink interface.
+type AuditSinkFunc func(record *AuditRecord)
+
+// Audit calls f(record).
+func (f AuditSinkFunc) Audit(record *AuditRecord) {
+	f(record)
+}
+
+// WithAuditSink sends an AuditRecord for every evaluation to the sink,
+// including evaluations of rules in rule sets. The audit hook runs after the
+// hooks of plugins added before it, so it sees results they replaced.
+func WithAuditSink(sink AuditSink) Option {
+	return WithPlugins(&auditPlugin{sink: sink})
+}
+
+// auditPlugin turns evaluations into audit records.
+type auditPlugin struct {
+	sink AuditSink
+}
+
+func (p *auditPlugin) Name() string { return "audit" }
+
+func (p *auditPlugin) PostEvaluate(ev *Evaluation) {
+	record := &AuditRecord{
+		Time:           ev.Start,
+		Tenant:         ev.Tenant,
+		Rule:           ev.Rule,
+		ExpressionHash: Digest(ev.Source),
+		PayloadDigest:  Digest(ev.PayloadJSON),
+		Result:         ev.Result.Raw,
+		ResultType:     ev.Result.Type.String(),
+		Duration:       ev.Duration,
+		Functions:      ev.Functions,
+		Cached:         ev.Skipped(),
+	}
+	if record.Functions == nil {
+		record.Functions = []string{}
+	}
+	if ev.Expression != nil {
+		record.CanonicalHash = ev.Expression.Hash()
+	}
+	if ev.Err != nil {
+		record.Result = nil
+		record.ResultType = "null"
+		record.Error = ev.Err.Error()
+		if amelErr, ok := ev.Err.(*errors.Error); ok {
+			record.ErrorCode = int(amelErr.Code)
+		}
+	}
+	p.sink.Audit(record)
+}
+
+// Digest returns the SHA-256 digest of s as "sha256:" followed by hex digits.
+func Digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// JSONAuditSink writes audit records to a writer as JSON, one record per line.
+type JSONAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewJSONAuditSink returns a sink writing JSON lines to w.
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{enc: json.NewEncoder(w)}
+}
+
+// Audit writes the record. Write errors are kept and returned by Err; later
+// records are still attempted.
+func (s *JSONAuditSink) Audit(record *AuditRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.enc.Encode(record); err != nil && s.err == nil {
+		s.err = err
+	}
+}
+
+// Err returns the first error encountered while writing records.
+func (s *JSONAuditSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
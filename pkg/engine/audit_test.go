@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAuditSink(t *testing.T) {
+	var mu sync.Mutex
+	var records []*AuditRecord
+	sink := AuditSinkFunc(func(r *AuditRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		records = append(records, r)
+	})
+
+	engine, err := New(WithAuditSink(sink))
+	require.NoError(t, err)
+
+	payload := `{"name":"alice","age":30}`
+	ok, err := engine.EvaluateDirectBool(`$.age > 100 && upper($.name) == "ALICE" || len($.name) == 5`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, Digest(`$.age > 100 && upper($.name) == "ALICE" || len($.name) == 5`), r.ExpressionHash)
+	assert.Equal(t, Digest(payload), r.PayloadDigest)
+	assert.True(t, strings.HasPrefix(r.PayloadDigest, "sha256:"))
+	assert.Equal(t, true, r.Result)
+	assert.Equal(t, "bool", r.ResultType)
+	assert.Equal(t, []string{"len"}, r.Functions, "upper is skipped by short-circuit evaluation")
+	assert.False(t, r.Time.IsZero())
+	assert.Empty(t, r.Error)
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := engine.EvaluateDirect(`$.age / 0`, payload)
+		require.Error(t, err)
+		r := records[len(records)-1]
+		assert.Nil(t, r.Result)
+		assert.Equal(t, int(errors.ErrDivisionByZero), r.ErrorCode)
+		assert.NotEmpty(t, r.Error)
+	})
+
+	t.Run("rules", func(t *testing.T) {
+		require.NoError(t, engine.AddRule("adult", `$.age >= 18`))
+		_, err := engine.Rules().EvaluateAll(payload)
+		require.NoError(t, err)
+		assert.Equal(t, "adult", records[len(records)-1].Rule)
+	})
+
+	t.Run("tenants", func(t *testing.T) {
+		tenant, err := engine.ForTenant("acme")
+		require.NoError(t, err)
+		_, err = tenant.EvaluateDirect(`1 + 1`, payload)
+		require.NoError(t, err)
+		assert.Equal(t, "acme", records[len(records)-1].Tenant)
+	})
+}
+
+func TestJSONAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONAuditSink(&buf)
+	engine, err := New(WithAuditSink(sink))
+	require.NoError(t, err)
+
+	_, err = engine.EvaluateDirect(`max($.a, 2)`, map[string]interface{}{"a": 5})
+	require.NoError(t, err)
+	_, err = engine.EvaluateDirect(`$.a > 1`, map[string]interface{}{"a": 5})
+	require.NoError(t, err)
+	require.NoError(t, sink.Err())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var first map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.EqualValues(t, 5, first["result"])
+	assert.Equal(t, "int", first["resultType"])
+	assert.Equal(t, []interface{}{"max"}, first["functions"])
+	assert.Contains(t, first, "durationNs")
+	assert.NotContains(t, first, "rule")
+}
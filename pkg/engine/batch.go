@@ -0,0 +1,132 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// WithBatchWorkers sets the number of goroutines used to evaluate batches.
+// Zero or less uses runtime.GOMAXPROCS(0).
+func WithBatchWorkers(n int) Option {
+	return func(e *Engine) {
+		e.batchWorkers = n
+	}
+}
+
+// BatchEvalRequest evaluates one expression against many payloads, or many
+// expressions against one payload.
+//
+// Set DSL and Payloads for the first form, or DSLs and Payload for the second.
+// Functions are registered once before any item is evaluated.
+type BatchEvalRequest struct {
+	DSL       string        `json:"dsl,omitempty"`
+	Payloads  []interface{} `json:"payloads,omitempty"`
+	DSLs      []string      `json:"dsls,omitempty"`
+	Payload   interface{}   `json:"payload,omitempty"`
+	Functions []string      `json:"functions,omitempty"`
+}
+
+// BatchEvalResponse holds one response per payload or expression, in request
+// order. Error is set only if the batch as a whole could not be evaluated;
+// failures of single items are reported in their responses.
+type BatchEvalResponse struct {
+	Results   []*EvalResponse `json:"results"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode int             `json:"errorCode,omitempty"`
+}
+
+// EvaluateBatch evaluates a batch request across the engine's worker pool.
+// The response includes explanations when explain mode is enabled.
+func (e *Engine) EvaluateBatch(req *BatchEvalRequest) *BatchEvalResponse {
+	resp := &BatchEvalResponse{Results: []*EvalResponse{}}
+	fail := func(err error) *BatchEvalResponse {
+		resp.Error = err.Error()
+		if amelErr, ok := err.(*errors.Error); ok {
+			resp.ErrorCode = int(amelErr.Code)
+		}
+		return resp
+	}
+
+	if req.DSLs != nil && req.Payloads != nil {
+		return fail(errors.New(errors.ErrInvalidSyntax, "batch request must set either payloads or dsls, not both"))
+	}
+
+	for _, fnSrc := range req.Functions {
+		if err := e.RegisterFunction(fnSrc); err != nil {
+			return fail(err)
+		}
+	}
+
+	if req.DSLs != nil {
+		resp.Results = make([]*EvalResponse, len(req.DSLs))
+		e.parallel(len(req.DSLs), func(i int) {
+			resp.Results[i] = e.evaluateRequest(context.Background(), &EvalRequest{DSL: req.DSLs[i], Payload: req.Payload}, e.explainMode)
+		})
+		return resp
+	}
+
+	compiled, err := e.Compile(req.DSL)
+	if err != nil {
+		return fail(err)
+	}
+	resp.Results = make([]*EvalResponse, len(req.Payloads))
+	e.parallel(len(req.Payloads), func(i int) {
+		resp.Results[i] = e.respond(context.Background(), compiled, req.Payloads[i], e.explainMode)
+	})
+	return resp
+}
+
+// EvaluateRequests evaluates independent requests across the engine's worker
+// pool and returns their responses in request order.
+func (e *Engine) EvaluateRequests(reqs []*EvalRequest) []*EvalResponse {
+	return e.EvaluateRequestsContext(context.Background(), reqs)
+}
+
+// EvaluateRequestsContext is EvaluateRequests with a Go context: the requests
+// not yet evaluated once ctx is canceled or its deadline passes fail with
+// ErrTimeout.
+func (e *Engine) EvaluateRequestsContext(ctx context.Context, reqs []*EvalRequest) []*EvalResponse {
+	results := make([]*EvalResponse, len(reqs))
+	e.parallel(len(reqs), func(i int) {
+		results[i] = e.evaluateRequest(ctx, reqs[i], e.explainMode)
+	})
+	return results
+}
+
+// parallel calls fn for every index in [0, n) using at most batchWorkers goroutines.
+func (e *Engine) parallel(n int, fn func(i int)) {
+	workers := e.batchWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
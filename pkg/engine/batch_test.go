@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_EvaluateBatchPayloads(t *testing.T) {
+	engine, err := New(WithBatchWorkers(4))
+	require.NoError(t, err)
+
+	payloads := make([]interface{}, 100)
+	for i := range payloads {
+		payloads[i] = map[string]interface{}{"n": i}
+	}
+	payloads[50] = map[string]interface{}{"n": "text"}
+
+	resp := engine.EvaluateBatch(&BatchEvalRequest{DSL: `$.n * 2`, Payloads: payloads})
+	require.Empty(t, resp.Error)
+	require.Len(t, resp.Results, 100)
+
+	for i, r := range resp.Results {
+		if i == 50 {
+			assert.Equal(t, int(errors.ErrTypeMismatch), r.ErrorCode)
+			continue
+		}
+		assert.Empty(t, r.Error)
+		assert.Equal(t, int64(i*2), r.Result, "result %d is in request order", i)
+	}
+}
+
+func TestEngine_EvaluateBatchExpressions(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	resp := engine.EvaluateBatch(&BatchEvalRequest{
+		DSLs:      []string{`$.a + 1`, `triple($.a)`, `$.a >`},
+		Payload:   map[string]interface{}{"a": 2},
+		Functions: []string{`function triple(x) { return x * 3; }`},
+	})
+	require.Empty(t, resp.Error)
+	require.Len(t, resp.Results, 3)
+	assert.Equal(t, int64(3), resp.Results[0].Result)
+	assert.EqualValues(t, 6, resp.Results[1].Result)
+	assert.NotEmpty(t, resp.Results[2].Error)
+}
+
+func TestEngine_EvaluateBatchErrors(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	resp := engine.EvaluateBatch(&BatchEvalRequest{DSL: `$.a >`, Payloads: []interface{}{nil}})
+	assert.NotEmpty(t, resp.Error)
+	assert.NotZero(t, resp.ErrorCode)
+	assert.Empty(t, resp.Results)
+
+	resp = engine.EvaluateBatch(&BatchEvalRequest{DSLs: []string{"1"}, Payloads: []interface{}{nil}})
+	assert.Contains(t, resp.Error, "not both")
+}
+
+func TestEngine_EvaluateRequests(t *testing.T) {
+	engine, err := New(WithBatchWorkers(3))
+	require.NoError(t, err)
+
+	reqs := make([]*EvalRequest, 20)
+	for i := range reqs {
+		reqs[i] = &EvalRequest{DSL: fmt.Sprintf("%d + $.x", i), Payload: map[string]interface{}{"x": 1}}
+	}
+	results := engine.EvaluateRequests(reqs)
+	require.Len(t, results, 20)
+	for i, r := range results {
+		assert.Equal(t, int64(i+1), r.Result)
+	}
+
+	assert.Empty(t, engine.EvaluateRequests(nil))
+}
@@ -0,0 +1,28 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import "github.com/bencagri/amel/pkg/vm"
+
+// WithBytecode makes the engine compile each expression to bytecode and
+// evaluate it on the virtual machine of package vm instead of walking its
+// tree, which saves time for expressions evaluated many times. Results,
+// errors, and limits are the same. Explanations and evaluations that collect
+// clause statistics still walk the tree. It is disabled by default.
+func WithBytecode(enabled bool) Option {
+	return func(e *Engine) {
+		e.bytecode = enabled
+	}
+}
+
+// compileProgram compiles the bytecode of a compiled expression if the
+// engine evaluates bytecode.
+func (e *Engine) compileProgram(compiled *CompiledExpression) {
+	if !e.bytecode {
+		return
+	}
+	base := compiled.Optimized
+	if base == nil {
+		base = compiled.AST
+	}
+	compiled.program = vm.Compile(base)
+}
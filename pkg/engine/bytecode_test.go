@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithBytecode(t *testing.T) {
+	payload := map[string]interface{}{
+		"user":  map[string]interface{}{"name": "Alice", "age": 30, "roles": []interface{}{"admin"}},
+		"items": []interface{}{1, 2, 3},
+		"zero":  0,
+	}
+	opts := []Option{WithMaxDepth(20), WithFunctionCallLimit("upper", 1)}
+	walker, err := New(opts...)
+	require.NoError(t, err)
+	bytecode, err := New(append(opts, WithBytecode(true))...)
+	require.NoError(t, err)
+
+	tests := []string{
+		`$.user.age >= 18 && "admin" IN $.user.roles`,
+		`$.zero > 0 && 1 / $.zero > 1`,
+		`$.user.age > 40 ? "senior" : "junior"`,
+		`sum(map($.items, x => x * 2)) == 12`,
+		`ifThenElse($.zero == 0, "none", 10 / $.zero)`,
+		`lower($.user.name)[1:3] == "li"`,
+		`{"name": $.user.name}.name + "!"`,
+		`1 / $.zero`,
+		`upper("a") + upper("b")`,
+		`$.user.name * 2`,
+	}
+	for _, dsl := range tests {
+		t.Run(dsl, func(t *testing.T) {
+			compiled, err := bytecode.Compile(dsl)
+			require.NoError(t, err)
+			require.NotNil(t, compiled.program)
+
+			want, wantErr := walker.EvaluateDirect(dsl, payload)
+			got, gotErr := bytecode.Evaluate(compiled, payload)
+			assert.Equal(t, want, got)
+			assert.Equal(t, wantErr, gotErr)
+		})
+	}
+
+	t.Run("parameters", func(t *testing.T) {
+		compiled, err := bytecode.Compile(`lower(name) + name`)
+		require.NoError(t, err)
+		bound, err := compiled.Bind(map[string]interface{}{"name": "Bob"})
+		require.NoError(t, err)
+
+		got, err := bytecode.Evaluate(bound, nil)
+		require.NoError(t, err)
+		assert.Equal(t, types.String("bobBob"), got)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		compiled, err := walker.Compile(`1 + 1`)
+		require.NoError(t, err)
+		assert.Nil(t, compiled.program)
+	})
+}
@@ -0,0 +1,169 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the maximum number of compiled expressions kept by the
+// compile cache unless WithCacheSize is used.
+const DefaultCacheSize = 10000
+
+// CacheStats reports the activity of the compile cache.
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`   // Entries removed to make room for new ones
+	Expirations uint64 `json:"expirations"` // Entries removed because their TTL passed
+	Entries     int    `json:"entries"`
+	MaxEntries  int    `json:"maxEntries"`
+}
+
+// HitRatio returns the fraction of lookups served from the cache.
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// WithCacheSize sets the maximum number of compiled expressions kept by the
+// cache. The least recently used entry is evicted when the cache is full.
+// A size of zero or less uses DefaultCacheSize.
+func WithCacheSize(n int) Option {
+	return func(e *Engine) {
+		e.cacheSize = n
+	}
+}
+
+// WithCacheTTL sets how long a compiled expression stays in the cache after it
+// was compiled. Zero keeps entries until they are evicted.
+func WithCacheTTL(d time.Duration) Option {
+	return func(e *Engine) {
+		e.cacheTTL = d
+	}
+}
+
+// compileCache caches compiled expressions by source text.
+type compileCache = lruCache[*CompiledExpression]
+
+// lruCache is a concurrency-safe LRU cache with an optional time to live.
+type lruCache[V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+
+	order *list.List // Front is most recently used
+	items map[string]*list.Element
+	stats CacheStats
+}
+
+type cacheEntry[V any] struct {
+	key      string
+	value    V
+	expireAt time.Time // Zero if the entry does not expire
+}
+
+func newCompileCache(maxEntries int, ttl time.Duration) *compileCache {
+	return newLRUCache[*CompiledExpression](maxEntries, ttl)
+}
+
+// newLRUCache creates a cache of at most maxEntries entries, or
+// DefaultCacheSize if maxEntries is zero or less.
+func newLRUCache[V any](maxEntries int, ttl time.Duration) *lruCache[V] {
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheSize
+	}
+	return &lruCache[V]{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached value for key and marks it as recently used.
+func (c *lruCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return zero, false
+	}
+
+	entry := el.Value.(*cacheEntry[V])
+	if !entry.expireAt.IsZero() && !c.now().Before(entry.expireAt) {
+		c.remove(el)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return zero, false
+	}
+
+	c.order.MoveToFront(el)
+	c.stats.Hits++
+	return entry.value, true
+}
+
+// add stores a value, evicting the least recently used entry if the cache is
+// full. If another caller stored the same key in the meantime, the existing
+// entry is kept and returned so all callers share one instance.
+func (c *lruCache[V]) add(key string, value V) V {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*cacheEntry[V])
+		if entry.expireAt.IsZero() || c.now().Before(entry.expireAt) {
+			c.order.MoveToFront(el)
+			return entry.value
+		}
+		c.remove(el)
+		c.stats.Expirations++
+	}
+
+	entry := &cacheEntry[V]{key: key, value: value}
+	if c.ttl > 0 {
+		entry.expireAt = c.now().Add(c.ttl)
+	}
+	c.items[key] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+	return value
+}
+
+// remove deletes an element. The caller must hold the lock.
+func (c *lruCache[V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry[V]).key)
+}
+
+// clear removes all entries. Statistics are kept.
+func (c *lruCache[V]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// snapshot returns the current statistics.
+func (c *lruCache[V]) snapshot() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	stats.MaxEntries = c.maxEntries
+	return stats
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_CacheEviction(t *testing.T) {
+	engine, err := New(WithCaching(true), WithCacheSize(2))
+	require.NoError(t, err)
+
+	a, err := engine.Compile("1")
+	require.NoError(t, err)
+	_, err = engine.Compile("2")
+	require.NoError(t, err)
+
+	// Touch "1" so that "2" becomes the least recently used entry
+	again, err := engine.Compile("1")
+	require.NoError(t, err)
+	assert.Same(t, a, again)
+
+	_, err = engine.Compile("3")
+	require.NoError(t, err)
+
+	stats := engine.CacheStats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, 2, stats.MaxEntries)
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+	assert.InDelta(t, 0.25, stats.HitRatio(), 0.001)
+
+	// "1" survived, "2" was evicted
+	again, err = engine.Compile("1")
+	require.NoError(t, err)
+	assert.Same(t, a, again)
+	_, err = engine.Compile("2")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), engine.CacheStats().Misses)
+}
+
+func TestEngine_CacheTTL(t *testing.T) {
+	engine, err := New(WithCaching(true), WithCacheTTL(time.Minute))
+	require.NoError(t, err)
+
+	now := time.Now()
+	engine.cache.now = func() time.Time { return now }
+
+	first, err := engine.Compile("$.x > 1")
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Second)
+	second, err := engine.Compile("$.x > 1")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	now = now.Add(31 * time.Second)
+	third, err := engine.Compile("$.x > 1")
+	require.NoError(t, err)
+	assert.NotSame(t, first, third)
+	assert.Equal(t, uint64(1), engine.CacheStats().Expirations)
+}
+
+func TestEngine_CacheConcurrent(t *testing.T) {
+	engine, err := New(WithCaching(true), WithCacheSize(16))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				compiled, err := engine.Compile(fmt.Sprintf("$.x > %d", (g+i)%32))
+				if assert.NoError(t, err) {
+					_, err = engine.Evaluate(compiled, map[string]interface{}{"x": 5})
+					assert.NoError(t, err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	stats := engine.CacheStats()
+	assert.LessOrEqual(t, stats.Entries, 16)
+	assert.Equal(t, uint64(8*200), stats.Hits+stats.Misses)
+}
+
+func TestEngine_CacheStatsDisabled(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	_, err = engine.Compile("1")
+	require.NoError(t, err)
+	assert.Equal(t, CacheStats{}, engine.CacheStats())
+	engine.ClearCache()
+}
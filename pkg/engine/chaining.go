@@ -0,0 +1,152 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// WithOutput makes a rule publish its result as a derived fact under the given name.
+// Later rules in the same set can read the fact as a plain identifier, e.g. a rule
+// with output "riskScore" lets another rule test `riskScore > 70`.
+//
+// Rules that publish facts are derivation rules: their results appear in EvaluateAll,
+// but they are never selected as a match by EvaluateUntilFirstMatch or Fire.
+func WithOutput(fact string) RuleOption {
+	return func(r *Rule) {
+		r.Output = fact
+	}
+}
+
+// ruleRun holds the state shared by the rules of a single rule set evaluation.
+type ruleRun struct {
+	base  *eval.EvalContext
+	facts map[string]types.Value
+}
+
+// newRun prepares a rule set evaluation against the payload.
+func (e *Engine) newRun(payload interface{}) (*ruleRun, error) {
+	base, err := e.newContext(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &ruleRun{base: base, facts: make(map[string]types.Value)}, nil
+}
+
+// context returns a fresh evaluation context that shares the converted payload and
+// exposes the facts derived so far as variables.
+func (run *ruleRun) context() *eval.EvalContext {
+	ctx := &eval.EvalContext{
+		Payload:     run.base.Payload,
+		PayloadJSON: run.base.PayloadJSON,
+		Variables:   make(map[string]types.Value, len(run.facts)),
+	}
+	for name, value := range run.facts {
+		ctx.Variables[name] = value
+	}
+	return ctx
+}
+
+// freeIdentifiers returns the identifiers an expression reads that are not bound by
+// one of its own lambda parameters.
+func freeIdentifiers(expr ast.Expression) []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	var walk func(node ast.Expression, bound map[string]bool)
+	walk = func(node ast.Expression, bound map[string]bool) {
+		ast.Inspect(node, func(n ast.Expression) bool {
+			switch n := n.(type) {
+			case *ast.Identifier:
+				if !bound[n.Value] && !seen[n.Value] {
+					seen[n.Value] = true
+					names = append(names, n.Value)
+				}
+			case *ast.LambdaExpression:
+				inner := make(map[string]bool, len(bound)+len(n.Parameters))
+				for name := range bound {
+					inner[name] = true
+				}
+				for _, p := range n.Parameters {
+					inner[p.Value] = true
+				}
+				walk(n.Body, inner)
+				return false
+			}
+			return true
+		})
+	}
+
+	walk(expr, map[string]bool{})
+	return names
+}
+
+// orderRules returns the rules sorted so that every fact is derived before the rules
+// that read it. Rules without dependencies between them keep their insertion order.
+// An error is returned if two rules publish the same fact or the facts form a cycle.
+func orderRules(rules []*Rule) ([]*Rule, error) {
+	producers := make(map[string]int)
+	for i, rule := range rules {
+		if rule.Output == "" {
+			continue
+		}
+		if j, exists := producers[rule.Output]; exists {
+			return nil, errors.Newf(errors.ErrInvalidSyntax,
+				"fact '%s' is published by both rule '%s' and rule '%s'", rule.Output, rules[j].Name, rule.Name)
+		}
+		producers[rule.Output] = i
+	}
+
+	// deps[i] lists the rules that rule i reads facts from
+	deps := make([][]int, len(rules))
+	for i, rule := range rules {
+		for _, name := range freeIdentifiers(rule.Compiled.AST) {
+			if j, ok := producers[name]; ok {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(rules))
+	ordered := make([]*Rule, 0, len(rules))
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			path = append(path, rules[i].Name)
+			return errors.Newf(errors.ErrInvalidSyntax, "rule dependency cycle: %s", strings.Join(path, " -> "))
+		}
+
+		state[i] = visiting
+		path = append(path, rules[i].Name)
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		ordered = append(ordered, rules[i])
+		return nil
+	}
+
+	for i := range rules {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTypeCoercion(t *testing.T) {
+	payload := `{"age": "21", "flag": "TRUE", "price": " 9.5 ", "id": "7", "name": "bob"}`
+
+	strict, err := New()
+	require.NoError(t, err)
+	lenient, err := New(WithTypeCoercion(true))
+	require.NoError(t, err)
+
+	tests := []struct {
+		dsl     string
+		lenient bool
+	}{
+		{`"5" > 3`, true},
+		{`"5" == 5`, true},
+		{`$.age >= 18`, true},
+		{`$.flag == true`, true},
+		{`$.price < 10.0`, true},
+		{`$.id IN [5, 6, 7]`, true},
+		{`$.name == 0`, false},
+		{`$.age == "21"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			got, err := lenient.EvaluateDirectBool(tt.dsl, payload)
+			require.NoError(t, err)
+			assert.Equal(t, tt.lenient, got)
+		})
+	}
+
+	t.Run("strict by default", func(t *testing.T) {
+		ok, err := strict.EvaluateDirectBool(`$.flag == true || "5" == 5 || $.id IN [7]`, payload)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		_, err = strict.EvaluateDirect(`$.age >= 18`, payload)
+		assert.Error(t, err)
+	})
+
+	t.Run("non-numeric strings do not compare", func(t *testing.T) {
+		_, err := lenient.EvaluateDirect(`$.name > 3`, payload)
+		assert.Error(t, err)
+	})
+
+	t.Run("explanation", func(t *testing.T) {
+		compiled, err := lenient.Compile(`$.age >= 18 && $.id IN [5, 7]`)
+		require.NoError(t, err)
+		value, explanation, err := lenient.EvaluateWithExplanation(compiled, payload)
+		require.NoError(t, err)
+		assert.Equal(t, true, value.Raw)
+
+		var coercions []string
+		var walk func(*eval.Explanation)
+		walk = func(e *eval.Explanation) {
+			coercions = append(coercions, e.Coercions...)
+			for _, child := range e.Children {
+				walk(child)
+			}
+		}
+		walk(explanation)
+		assert.Equal(t, []string{`"21" (string) as 21 (int)`, `"7" (string) as 7 (int)`, `"7" (string) as 7 (int)`}, coercions)
+	})
+
+	t.Run("payload schema", func(t *testing.T) {
+		schema := []byte(`{"type": "object", "properties": {"age": {"type": "string"}}}`)
+		strictSchema, err := New(WithPayloadSchema(schema))
+		require.NoError(t, err)
+		_, err = strictSchema.Compile(`$.age >= 18`)
+		assert.Error(t, err)
+
+		lenientSchema, err := New(WithPayloadSchema(schema), WithTypeCoercion(true))
+		require.NoError(t, err)
+		_, err = lenientSchema.Compile(`$.age >= 18`)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Countries(t *testing.T) {
+	payload := map[string]interface{}{"billing": "de", "shipping": "XK"}
+
+	plain, err := New()
+	require.NoError(t, err)
+
+	result, err := plain.EvaluateDirect(`[isoCountryName($.billing), currencyForCountry($.billing), inEU($.billing), isoCountryName($.shipping)]`, payload)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"Germany", "EUR", true, nil}, result.Plain())
+
+	t.Run("overrides", func(t *testing.T) {
+		engine, err := New(WithCountries(map[string]functions.Country{
+			"XK": {Name: "Kosovo", Currency: "EUR"},
+			"DE": {Name: "Deutschland", Currency: "EUR", EU: true},
+		}))
+		require.NoError(t, err)
+
+		result, err := engine.EvaluateDirect(`[isoCountryName($.billing), isoCountryName($.shipping), inEU($.shipping), isoCountryName("FR")]`, payload)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"Deutschland", "Kosovo", false, "France"}, result.Plain())
+
+		result, err = plain.EvaluateDirect(`isoCountryName($.billing)`, payload)
+		require.NoError(t, err)
+		assert.Equal(t, "Germany", result.Raw, "other engines keep the embedded table")
+	})
+}
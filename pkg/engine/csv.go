@@ -0,0 +1,160 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"context"
+	"encoding/csv"
+	stderrors "errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// CSVOption configures FilterCSV.
+type CSVOption func(*csvConfig)
+
+type csvConfig struct {
+	comma      rune
+	inferTypes bool
+	lazyQuotes bool
+}
+
+// CSVComma sets the field delimiter of the input and output, such as ';' or
+// '\t'. The default is ','.
+func CSVComma(r rune) CSVOption {
+	return func(c *csvConfig) {
+		c.comma = r
+	}
+}
+
+// CSVInferTypes controls whether cells that look like integers, decimal
+// numbers, or booleans are read as such, so that $.age > 30 compares numbers.
+// It is enabled by default; when disabled every cell is a string. Empty cells
+// are null either way.
+func CSVInferTypes(enabled bool) CSVOption {
+	return func(c *csvConfig) {
+		c.inferTypes = enabled
+	}
+}
+
+// CSVLazyQuotes accepts quotes in unquoted fields and unescaped quotes in
+// quoted fields, which some spreadsheet exports produce.
+func CSVLazyQuotes(enabled bool) CSVOption {
+	return func(c *csvConfig) {
+		c.lazyQuotes = enabled
+	}
+}
+
+// CSVStats summarizes a FilterCSV run.
+type CSVStats struct {
+	Rows    int `json:"rows"`    // Data rows read, excluding the header
+	Matched int `json:"matched"` // Rows whose result was truthy
+	Errors  int `json:"errors"`  // Rows with the wrong number of fields or that failed to evaluate
+}
+
+// FilterCSV reads CSV rows from r, evaluates the compiled expression against
+// each, and writes the header and the rows whose result is truthy to w,
+// unchanged. The first row is the header: each cell of a row is exposed as
+// $.<column name>, so a column named "unit price" is read with
+// $["unit price"].
+//
+// Rows with a different number of fields than the header, and rows that fail
+// to evaluate, are dropped and counted in CSVStats.Errors. Rows are read and
+// written one at a time, so memory use stays bounded by the row size. FilterCSV
+// stops when r is exhausted, ctx is canceled, the input is not valid CSV, or
+// writing fails.
+func (e *Engine) FilterCSV(ctx context.Context, expr *CompiledExpression, r io.Reader, w io.Writer, opts ...CSVOption) (CSVStats, error) {
+	config := &csvConfig{comma: ',', inferTypes: true}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	var stats CSVStats
+	reader := csv.NewReader(r)
+	reader.Comma = config.comma
+	reader.LazyQuotes = config.lazyQuotes
+	reader.ReuseRecord = true
+	writer := csv.NewWriter(w)
+	writer.Comma = config.comma
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, errors.Wrap(errors.ErrInvalidPayload, "invalid CSV header", err)
+	}
+	columns := make([]string, len(header))
+	copy(columns, header)
+	columns[0] = strings.TrimPrefix(columns[0], "\ufeff") // Byte order mark
+	if err := writer.Write(header); err != nil {
+		return stats, err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			writer.Flush()
+			return stats, err
+		}
+
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !stderrors.Is(err, csv.ErrFieldCount) {
+			writer.Flush()
+			return stats, errors.Wrap(errors.ErrInvalidPayload, "invalid CSV input", err)
+		}
+		stats.Rows++
+		if err != nil {
+			stats.Errors++
+			continue
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = csvValue(record[i], config.inferTypes)
+		}
+		value, err := e.Evaluate(expr, row)
+		if err != nil {
+			stats.Errors++
+			continue
+		}
+		if !e.IsTruthy(value) {
+			continue
+		}
+		stats.Matched++
+		if err := writer.Write(record); err != nil {
+			return stats, err
+		}
+	}
+
+	writer.Flush()
+	return stats, writer.Error()
+}
+
+// csvValue converts a CSV cell to a payload value.
+func csvValue(cell string, inferTypes bool) interface{} {
+	if cell == "" {
+		return nil
+	}
+	if !inferTypes {
+		return cell
+	}
+	if n, err := strconv.ParseInt(cell, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(cell, 64); err == nil && !strings.ContainsAny(cell, "xXnN") {
+		// Plain decimals only, not hexadecimal floats, NaN, or Inf
+		return f
+	}
+	switch cell {
+	case "true", "TRUE", "True":
+		return true
+	case "false", "FALSE", "False":
+		return false
+	}
+	return cell
+}
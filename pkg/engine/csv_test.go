@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_FilterCSV(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	input := "name,age,active,unit price\n" +
+		"ada,36,true,9.5\n" +
+		"bob,17,true,3\n" +
+		"\"carol, jr\",41,false,12\n" +
+		"dan,52,true\n" +
+		"eve,,true,1\n"
+
+	filter := func(t *testing.T, dsl, input string, opts ...CSVOption) (string, CSVStats, error) {
+		t.Helper()
+		expr, err := engine.Compile(dsl)
+		require.NoError(t, err)
+		var out bytes.Buffer
+		stats, err := engine.FilterCSV(context.Background(), expr, strings.NewReader(input), &out, opts...)
+		return out.String(), stats, err
+	}
+
+	t.Run("typed columns", func(t *testing.T) {
+		out, stats, err := filter(t, `$.age >= 18 && $.active && $["unit price"] > 5`, input)
+		require.NoError(t, err)
+		assert.Equal(t, "name,age,active,unit price\nada,36,true,9.5\n", out)
+		// dan has too few fields, and comparing eve's empty age fails
+		assert.Equal(t, CSVStats{Rows: 5, Matched: 1, Errors: 2}, stats)
+	})
+
+	t.Run("quoted fields are written unchanged", func(t *testing.T) {
+		out, _, err := filter(t, `startsWith($.name, "carol")`, input)
+		require.NoError(t, err)
+		assert.Equal(t, "name,age,active,unit price\n\"carol, jr\",41,false,12\n", out)
+	})
+
+	t.Run("empty cells are null", func(t *testing.T) {
+		out, _, err := filter(t, `$.age == null`, input)
+		require.NoError(t, err)
+		assert.Equal(t, "name,age,active,unit price\neve,,true,1\n", out)
+	})
+
+	t.Run("strings only", func(t *testing.T) {
+		out, stats, err := filter(t, `$.age == "36"`, input, CSVInferTypes(false))
+		require.NoError(t, err)
+		assert.Equal(t, 1, stats.Matched)
+		assert.Contains(t, out, "ada,36")
+	})
+
+	t.Run("delimiter and byte order mark", func(t *testing.T) {
+		out, stats, err := filter(t, `$.id > 1`, "\ufeffid;code\n1;a\n2;b\n", CSVComma(';'))
+		require.NoError(t, err)
+		assert.Equal(t, "\ufeffid;code\n2;b\n", out)
+		assert.Equal(t, CSVStats{Rows: 2, Matched: 1}, stats)
+	})
+
+	t.Run("invalid input", func(t *testing.T) {
+		_, _, err := filter(t, `true`, "a,b\n\"x,1\n")
+		assert.True(t, errors.IsCode(err, errors.ErrInvalidPayload))
+
+		out, stats, err := filter(t, `true`, "")
+		require.NoError(t, err)
+		assert.Empty(t, out)
+		assert.Zero(t, stats.Rows)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		expr, err := engine.Compile(`true`)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = engine.FilterCSV(ctx, expr, strings.NewReader(input), &bytes.Buffer{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
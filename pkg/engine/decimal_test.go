@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_DecimalArithmetic(t *testing.T) {
+	payload := map[string]interface{}{"a": 0.1, "b": 0.2, "total": 0.3}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		engine, err := New()
+		require.NoError(t, err)
+
+		ok, err := engine.EvaluateDirectBool(`$.a + $.b == $.total`, payload)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = engine.EvaluateDirectBool(`decimal($.a) + $.b == $.total`, payload)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	for _, bytecode := range []bool{false, true} {
+		engine, err := New(WithDecimalArithmetic(true), WithBytecode(bytecode))
+		require.NoError(t, err)
+
+		for _, dsl := range []string{`$.a + $.b == $.total`, `0.1 + 0.2 == 0.3`, `1 / 3 * 3 == 1`} {
+			ok, err := engine.EvaluateDirectBool(dsl, payload)
+			require.NoError(t, err, dsl)
+			assert.True(t, ok, "%s, bytecode %v", dsl, bytecode)
+		}
+	}
+
+	t.Run("results encode as JSON numbers", func(t *testing.T) {
+		engine, err := New(WithDecimalArithmetic(true))
+		require.NoError(t, err)
+
+		resp := engine.EvaluateRequest(&EvalRequest{DSL: `$.a + $.b`, Payload: payload})
+		require.Empty(t, resp.Error)
+		assert.Equal(t, "decimal", resp.Type)
+		data, err := json.Marshal(resp.Result)
+		require.NoError(t, err)
+		assert.Equal(t, "0.3", string(data))
+	})
+
+	t.Run("float operands give decimals", func(t *testing.T) {
+		engine, err := New(WithDecimalArithmetic(true))
+		require.NoError(t, err)
+
+		compiled, err := engine.Compile(`$.a * 1.5`)
+		require.NoError(t, err)
+		result, err := engine.Evaluate(compiled, payload)
+		require.NoError(t, err)
+		assert.Equal(t, types.TypeDecimal, result.Type)
+	})
+}
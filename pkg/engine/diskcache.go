@@ -0,0 +1,133 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+)
+
+// modulePath is the import path of the AMEL module, used to find its version
+// in the build information.
+const modulePath = "github.com/bencagri/amel"
+
+// diskCacheExt is the file name extension of disk cache entries.
+const diskCacheExt = ".amelc"
+
+// WithDiskCache persists compiled expressions in dir, so that services with
+// many stored rules do not parse and optimize them again on every start.
+// Compile looks an expression up in the directory before parsing it and
+// writes the expressions it compiles there.
+//
+// Entries are named after a hash of the expression, the compiled format
+// version, the version of the AMEL module, the parse depth limit, and the
+// optimizer settings, including the type coercion, strict types, and decimal
+// arithmetic options that change how constants are folded, so upgrading the
+// module or changing those options never loads a stale tree. Entries are loaded with LoadCompiled, which checks the functions
+// they call against the registry of the engine. The cache is best effort:
+// unreadable or invalid entries are compiled again and overwritten, and
+// failures to write are ignored. Use it together with WithCaching to also keep
+// the loaded expressions in memory.
+func WithDiskCache(dir string) Option {
+	return func(e *Engine) {
+		e.diskCacheDir = dir
+	}
+}
+
+// DiskCacheDir returns the directory set with WithDiskCache, or "".
+func (e *Engine) DiskCacheDir() string {
+	return e.diskCacheDir
+}
+
+// ClearDiskCache removes every entry from the disk cache directory. Other
+// files in the directory are left alone.
+func (e *Engine) ClearDiskCache() error {
+	if e.diskCacheDir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(e.diskCacheDir, "*"+diskCacheExt))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// diskCachePath returns the path of the disk cache entry of dsl.
+func (e *Engine) diskCachePath(dsl string) string {
+	h := sha256.New()
+	// Type coercion, strict types, and decimal arithmetic change how
+	// operations on constants are folded
+	fmt.Fprintf(h, "amel/%d/%s/%d/%t/%t/%t/%t\x00", CompiledFormatVersion, moduleVersion(), e.maxDepth,
+		e.optimizer != nil, e.typeCoercion, e.strictTypes, e.decimalArithmetic)
+	h.Write([]byte(dsl))
+	return filepath.Join(e.diskCacheDir, hex.EncodeToString(h.Sum(nil))+diskCacheExt)
+}
+
+// loadDiskCache returns the compiled expression of dsl stored in the disk
+// cache, if there is a valid one.
+func (e *Engine) loadDiskCache(dsl string) (*CompiledExpression, bool) {
+	data, err := os.ReadFile(e.diskCachePath(dsl))
+	if err != nil {
+		return nil, false
+	}
+	compiled, err := e.LoadCompiled(data)
+	if err != nil || compiled.Source != dsl {
+		return nil, false
+	}
+	return compiled, true
+}
+
+// storeDiskCache writes a compiled expression to the disk cache. The entry is
+// written to a temporary file and renamed, so concurrent readers never see a
+// partial entry.
+func (e *Engine) storeDiskCache(compiled *CompiledExpression) {
+	data, err := compiled.MarshalBinary()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(e.diskCacheDir, 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(e.diskCacheDir, ".tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), e.diskCachePath(compiled.Source))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+var moduleVersion = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "unknown"
+})
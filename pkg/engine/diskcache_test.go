@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_DiskCache(t *testing.T) {
+	dir := t.TempDir()
+	const dsl = `$.user.age >= 18 && lower($.user.country) IN ["de", "fr"]`
+
+	first, err := New(WithDiskCache(dir))
+	require.NoError(t, err)
+	compiled, err := first.Compile(dsl)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), first.Stats().Compile.Compiled)
+
+	entries, err := filepath.Glob(filepath.Join(dir, "*.amelc"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	t.Run("loaded without parsing", func(t *testing.T) {
+		second, err := New(WithDiskCache(dir))
+		require.NoError(t, err)
+		loaded, err := second.Compile(dsl)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), second.Stats().Compile.Compiled)
+		assert.Equal(t, compiled.AST.String(), loaded.AST.String())
+
+		ok, err := second.EvaluateBool(loaded, map[string]interface{}{
+			"user": map[string]interface{}{"age": 30, "country": "DE"},
+		})
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("optimizer setting is part of the key", func(t *testing.T) {
+		unoptimized, err := New(WithDiskCache(dir), WithOptimization(false))
+		require.NoError(t, err)
+		_, err = unoptimized.Compile(dsl)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), unoptimized.Stats().Compile.Compiled)
+	})
+
+	t.Run("decimal arithmetic is part of the key", func(t *testing.T) {
+		const sum = `0.1 + 0.2 == 0.3`
+		plain, err := New(WithDiskCache(dir))
+		require.NoError(t, err)
+		result, err := plain.EvaluateDirect(sum, nil)
+		require.NoError(t, err)
+		assert.Equal(t, false, result.Raw)
+
+		decimal, err := New(WithDiskCache(dir), WithDecimalArithmetic(true))
+		require.NoError(t, err)
+		result, err = decimal.EvaluateDirect(sum, nil)
+		require.NoError(t, err)
+		assert.Equal(t, true, result.Raw)
+		assert.Equal(t, uint64(1), decimal.Stats().Compile.Compiled)
+	})
+
+	t.Run("invalid entries are recompiled", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(entries[0], []byte("garbage"), 0o644))
+		engine, err := New(WithDiskCache(dir))
+		require.NoError(t, err)
+		_, err = engine.Compile(dsl)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), engine.Stats().Compile.Compiled)
+
+		data, err := os.ReadFile(entries[0])
+		require.NoError(t, err)
+		assert.NotEqual(t, "garbage", string(data), "entry is rewritten")
+	})
+
+	t.Run("entries calling unknown functions are recompiled", func(t *testing.T) {
+		withFn, err := New(WithDiskCache(dir))
+		require.NoError(t, err)
+		require.NoError(t, withFn.RegisterFunction(`function double(x) { return x * 2; }`))
+		_, err = withFn.Compile(`double($.n) > 4`)
+		require.NoError(t, err)
+
+		without, err := New(WithDiskCache(dir))
+		require.NoError(t, err)
+		_, err = without.Compile(`double($.n) > 4`)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), without.Stats().Compile.Compiled, "entry calling an unknown function is ignored")
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		other := filepath.Join(dir, "notes.txt")
+		require.NoError(t, os.WriteFile(other, []byte("keep"), 0o644))
+		require.NoError(t, first.ClearDiskCache())
+		entries, err := filepath.Glob(filepath.Join(dir, "*.amelc"))
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		assert.FileExists(t, other)
+	})
+}
@@ -2,28 +2,84 @@
 package engine
 
 import (
+	"context"
+	"sync"
 	"time"
 
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/bencagri/amel/internal/errors"
 	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/compiler"
 	"github.com/bencagri/amel/pkg/eval"
 	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/lookup"
 	"github.com/bencagri/amel/pkg/optimizer"
 	"github.com/bencagri/amel/pkg/parser"
 	"github.com/bencagri/amel/pkg/types"
+	"github.com/bencagri/amel/pkg/vm"
 )
 
 // Engine is the main AMEL DSL engine.
 type Engine struct {
-	evaluator       *eval.Evaluator
-	functions       *functions.Registry
-	sandbox         *functions.Sandbox
-	optimizer       *optimizer.Optimizer
-	timeout         time.Duration
-	explainMode     bool
-	strictTypes     bool
-	caching         bool
-	optimizeEnabled bool
-	cache           map[string]*CompiledExpression
+	evaluator           *eval.Evaluator
+	functions           *functions.Registry
+	sandbox             *functions.Sandbox // Nil if JavaScript functions are disabled
+	luaSandbox          *functions.LuaSandbox
+	optimizer           *optimizer.Optimizer
+	timeout             time.Duration
+	explainMode         bool
+	strictTypes         bool
+	typeCoercion        bool
+	decimalArithmetic   bool
+	caching             bool
+	optimizeEnabled     bool
+	jsFunctions         bool
+	httpGetJSON         *functions.HTTPConfig         // Nil unless httpGetJSON is enabled
+	countries           map[string]functions.Country  // Overrides of the country reference table
+	jwtKeys             map[string]*functions.JWTKeys // Key sets of jwtValid, by name
+	lookupTables        map[string]lookup.Provider
+	lookups             *lookup.Tables // Nil until a lookup table is added
+	lookupsMu           sync.Mutex
+	schemaSources       map[string][]byte
+	schemas             map[string]*jsonschema.Schema // Nil until a schema is added
+	schemasMu           sync.RWMutex
+	cache               *compileCache
+	cacheSize           int
+	cacheTTL            time.Duration
+	resultCaching       bool
+	resultCache         *lruCache[types.Value] // Nil unless WithResultCache is used
+	resultCacheSize     int
+	resultCacheTTL      time.Duration
+	diskCacheDir        string // Empty unless WithDiskCache is used
+	rules               *RuleSet
+	plugins             []Plugin
+	precompile          []string
+	batchWorkers        int
+	maxIterations       int
+	maxCalls            int
+	maxDepth            int
+	callLimits          map[string]int
+	regexConfig         functions.RegexConfig
+	regexes             *functions.RegexCache
+	clauseStats         bool
+	bytecode            bool
+	safeIndex           bool
+	reorderEvery        int
+	targets             map[string]compiler.Target // Nil until RegisterTarget is called
+	targetsMu           sync.Mutex
+	console             functions.ConsoleFunc
+	truthiness          *types.Truthiness // Nil unless WithTruthiness is used
+	payloadSchemaSource []byte
+	payloadSchema       *payloadSchema // Nil unless a payload schema is set
+	hooks               hooks
+	stats               *statsCollector
+
+	options        []Option // Options passed to New, reused for tenant engines
+	tenantID       string
+	tenantDefaults []Option
+	tenantsMu      sync.Mutex
+	tenants        map[string]*Engine
 }
 
 // CompiledExpression represents a pre-parsed expression ready for evaluation.
@@ -31,6 +87,15 @@ type CompiledExpression struct {
 	AST       ast.Expression
 	Optimized ast.Expression
 	Source    string
+	// Warnings lists the payload paths the payload schema of the engine does
+	// not define. It is empty if the engine has no payload schema.
+	Warnings []Diagnostic
+
+	limits  *Limits                // Nil if the engine defaults apply
+	clauses *clauseTracker         // Nil unless clause statistics are collected
+	hash    string                 // Canonical hash of AST; computed by Hash if empty
+	params  map[string]types.Value // Set by Bind
+	program *vm.Program            // Nil unless the engine evaluates bytecode
 }
 
 // Result represents the result of an evaluation.
@@ -56,20 +121,60 @@ func WithExplainMode(enabled bool) Option {
 	}
 }
 
-// WithStrictTypes enables strict type checking.
+// WithStrictTypes disallows implicit conversions between types. Comparing
+// values of different types, such as "5" == 5 or a datetime with a string,
+// fails with ErrStrictComparison; an int and a float in one comparison or
+// arithmetic operation, such as 1 == 1.0, fail with ErrStrictNumeric; and a
+// value other than a bool used as a condition, such as the operands of &&,
+// ||, and !, the condition of ?:, the conditions of case and score, the results of the
+// lambdas of filter, find, some, and every, or the result of EvaluateBool or
+// of a rule, fails with ErrStrictTruthiness. Any value may be compared with
+// null. Violations among constants and payload paths whose types the payload
+// schema gives fail at compile time, the others when evaluated.
 func WithStrictTypes(enabled bool) Option {
 	return func(e *Engine) {
 		e.strictTypes = enabled
 	}
 }
 
-// WithCaching enables expression caching.
+// WithSafeIndex makes an index beyond either end of a list or string give
+// null instead of failing with ErrIndexOutOfBounds, in both $.items[10] and
+// at($.items, 10), so rules reading payload arrays of unknown length need no
+// length guards: $.items[2].sku == "X" is false for a shorter list. It is
+// disabled by default.
+func WithSafeIndex(enabled bool) Option {
+	return func(e *Engine) {
+		e.safeIndex = enabled
+	}
+}
+
+// WithTypeCoercion enables lenient comparisons for payloads that carry
+// numbers and booleans as strings, as many webhooks do: ==, !=, <, <=, >, >=,
+// and IN convert a string compared with a number or a boolean, so "5" > 3 and
+// $.flag == true with "flag": "true" hold. Strings that do not convert are
+// compared as before. Explanations list the coercions made.
+func WithTypeCoercion(enabled bool) Option {
+	return func(e *Engine) {
+		e.typeCoercion = enabled
+	}
+}
+
+// WithDecimalArithmetic computes arithmetic on floats exactly, with
+// decimals, so that 0.1 + 0.2 == 0.3 holds, for rules on money. +, -, *, and
+// % with a float operand, and / with any two numbers, give decimals, which
+// results encode as JSON numbers. Operations on decimals returned by the
+// decimal function are exact either way. It is disabled by default.
+func WithDecimalArithmetic(enabled bool) Option {
+	return func(e *Engine) {
+		e.decimalArithmetic = enabled
+	}
+}
+
+// WithCaching enables caching of compiled expressions by source text.
+// The cache is bounded; see WithCacheSize and WithCacheTTL.
 func WithCaching(enabled bool) Option {
 	return func(e *Engine) {
 		e.caching = enabled
-		if enabled && e.cache == nil {
-			e.cache = make(map[string]*CompiledExpression)
-		}
 	}
 }
 
@@ -94,6 +199,16 @@ func WithSandbox(s *functions.Sandbox) Option {
 	}
 }
 
+// WithConsoleLogger sets the function receiving console output, such as
+// console.log calls, of JavaScript functions. Each entry names the function
+// that wrote it. Without a logger console output is discarded; explanations
+// include it either way.
+func WithConsoleLogger(fn functions.ConsoleFunc) Option {
+	return func(e *Engine) {
+		e.console = fn
+	}
+}
+
 // WithSandboxConfig sets sandbox configuration.
 func WithSandboxConfig(config *functions.SandboxConfig) Option {
 	return func(e *Engine) {
@@ -101,16 +216,69 @@ func WithSandboxConfig(config *functions.SandboxConfig) Option {
 	}
 }
 
+// WithJSFunctions enables or disables user-defined JavaScript functions.
+// They are enabled by default. When disabled the engine has no sandbox, even
+// if one was configured with WithSandbox or WithSandboxConfig, RegisterFunction
+// fails, and New rejects a function registry containing JavaScript functions,
+// so no JavaScript is ever executed.
+func WithJSFunctions(enabled bool) Option {
+	return func(e *Engine) {
+		e.jsFunctions = enabled
+	}
+}
+
+// WithHTTPGetJSON enables the httpGetJSON(url) function, which fetches a
+// JSON document from one of config.AllowedHosts. It is disabled by default.
+// Requests are bounded by both config.Timeout and the evaluation timeout,
+// which is short by default; raise it with WithTimeout or WithLimits.
+func WithHTTPGetJSON(config functions.HTTPConfig) Option {
+	return func(e *Engine) {
+		e.httpGetJSON = &config
+	}
+}
+
+// WithCountries overrides entries of the country reference table read by
+// isoCountryName, currencyForCountry, and inEU, or adds entries, such as
+// "XK" for Kosovo. Entries are keyed by upper-case ISO 3166-1 alpha-2 codes;
+// the other entries of the embedded table are kept.
+func WithCountries(overrides map[string]functions.Country) Option {
+	return func(e *Engine) {
+		if e.countries == nil {
+			e.countries = make(map[string]functions.Country)
+		}
+		for code, country := range overrides {
+			e.countries[code] = country
+		}
+	}
+}
+
+// WithJWTKeys configures a key set jwtValid verifies tokens with, under a
+// name rules pass as its second argument, as in jwtValid($.token, "gateway").
+// Keys are created with functions.JWTSecret or functions.ParseJWKS. The
+// option may be repeated for several key sets.
+func WithJWTKeys(name string, keys *functions.JWTKeys) Option {
+	return func(e *Engine) {
+		if e.jwtKeys == nil {
+			e.jwtKeys = make(map[string]*functions.JWTKeys)
+		}
+		e.jwtKeys[name] = keys
+	}
+}
+
 // New creates a new AMEL engine with the given options.
 func New(opts ...Option) (*Engine, error) {
 	e := &Engine{
 		timeout:         100 * time.Millisecond,
 		optimizeEnabled: true, // enabled by default
+		jsFunctions:     true,
+		maxDepth:        parser.DefaultMaxDepth,
+		stats:           newStatsCollector(),
 	}
 
 	for _, opt := range opts {
 		opt(e)
 	}
+	e.options = opts
 
 	// Create default function registry if not provided
 	if e.functions == nil {
@@ -121,30 +289,135 @@ func New(opts ...Option) (*Engine, error) {
 		e.functions = r
 	}
 
-	// Create default sandbox if not provided
-	if e.sandbox == nil {
+	if len(e.payloadSchemaSource) > 0 {
+		schema, err := compilePayloadSchema(e.payloadSchemaSource)
+		if err != nil {
+			return nil, err
+		}
+		e.payloadSchema = schema
+	}
+
+	regexes, err := functions.NewRegexCache(e.regexConfig)
+	if err != nil {
+		return nil, err
+	}
+	e.regexes = regexes
+
+	if e.httpGetJSON != nil {
+		// Replace the function of a cloned registry so each engine has its own
+		// configuration and response cache
+		e.functions.Unregister(functions.HTTPGetJSONName)
+		if err := functions.RegisterHTTPGetJSON(e.functions, *e.httpGetJSON); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.countries != nil {
+		table := functions.Countries()
+		for code, country := range e.countries {
+			table[code] = country
+		}
+		// Replace the functions of a cloned registry, which read the table of
+		// another engine
+		e.functions.Unregister(functions.CountryNameFunction)
+		e.functions.Unregister(functions.CountryCurrencyFunction)
+		e.functions.Unregister(functions.InEUFunction)
+		if err := functions.RegisterCountries(e.functions, table); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.jwtKeys != nil {
+		// Replace the function of a cloned registry, which verifies with the
+		// keys of another engine
+		e.functions.Unregister(functions.JWTValidFunction)
+		if err := functions.RegisterJWTValid(e.functions, e.jwtKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, p := range e.lookupTables {
+		if err := e.RegisterLookupTable(name, p); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, schema := range e.schemaSources {
+		if err := e.RegisterSchema(name, schema); err != nil {
+			return nil, err
+		}
+	}
+
+	if !e.jsFunctions {
+		e.sandbox = nil
+		for _, name := range e.functions.List() {
+			for _, fn := range e.functions.ListOverloads(name) {
+				if fn.IsJS() {
+					return nil, errors.Newf(errors.ErrSandboxViolation,
+						"function '%s' is a JavaScript function but JavaScript functions are disabled", name)
+				}
+			}
+		}
+	} else if e.sandbox == nil {
+		// Create default sandbox if not provided
 		e.sandbox = functions.NewSandbox(&functions.SandboxConfig{
 			Timeout:       e.timeout,
-			MemoryLimit:   10 * 1024 * 1024, // 10MB
+			MaxStackDepth: 100,
+		})
+	}
+	if e.luaSandbox == nil {
+		e.luaSandbox = functions.NewLuaSandbox(&functions.SandboxConfig{
+			Timeout:       e.timeout,
 			MaxStackDepth: 100,
 		})
 	}
 
+	if e.caching {
+		e.cache = newCompileCache(e.cacheSize, e.cacheTTL)
+	}
+	if e.resultCaching {
+		e.resultCache = newLRUCache[types.Value](e.resultCacheSize, e.resultCacheTTL)
+	}
+	e.hooks = newHooks(e.plugins)
+
 	// Create optimizer if optimization is enabled
 	if e.optimizeEnabled {
-		e.optimizer = optimizer.New(optimizer.WithConstantFolding(true))
+		e.optimizer = optimizer.New(optimizer.WithConstantFolding(true),
+			optimizer.WithTypeCoercion(e.typeCoercion), optimizer.WithStrictTypes(e.strictTypes),
+			optimizer.WithDecimalArithmetic(e.decimalArithmetic))
 	}
 
 	// Create evaluator with sandbox support
-	evaluator, err := eval.New(
+	evalOpts := []eval.Option{
 		eval.WithFunctions(e.functions),
 		eval.WithTimeout(e.timeout),
+		eval.WithMaxIterations(e.maxIterations),
+		eval.WithMaxCalls(e.maxCalls),
+		eval.WithMaxDepth(e.maxDepth),
+		eval.WithRegexCache(e.regexes),
 		eval.WithSandbox(e.sandbox),
-	)
+		eval.WithConsole(e.console),
+		eval.WithTypeCoercion(e.typeCoercion),
+		eval.WithStrictTypes(e.strictTypes),
+		eval.WithSafeIndex(e.safeIndex),
+		eval.WithDecimalArithmetic(e.decimalArithmetic),
+	}
+	for name, n := range e.callLimits {
+		evalOpts = append(evalOpts, eval.WithFunctionCallLimit(name, n))
+	}
+	if e.truthiness != nil {
+		evalOpts = append(evalOpts, eval.WithTruthiness(*e.truthiness))
+	}
+	evaluator, err := eval.New(evalOpts...)
 	if err != nil {
 		return nil, err
 	}
 	e.evaluator = evaluator
+	e.rules = e.NewRuleSet()
+
+	if err := e.Warmup(e.precompile...); err != nil {
+		return nil, err
+	}
 
 	return e, nil
 }
@@ -153,14 +426,33 @@ func New(opts ...Option) (*Engine, error) {
 func (e *Engine) Compile(dsl string) (*CompiledExpression, error) {
 	// Check cache
 	if e.caching {
-		if cached, ok := e.cache[dsl]; ok {
+		if cached, ok := e.cache.get(dsl); ok {
 			return cached, nil
 		}
 	}
 
+	if e.diskCacheDir != "" {
+		if compiled, ok := e.loadDiskCache(dsl); ok {
+			if err := e.onCompile(compiled); err != nil {
+				e.onCompileError(dsl, err)
+				return nil, err
+			}
+			if e.caching {
+				return e.cache.add(dsl, compiled), nil
+			}
+			return compiled, nil
+		}
+	}
+
 	// Parse the expression
-	expr, err := parser.Parse(dsl)
+	expr, err := parser.Parse(dsl, parser.WithMaxDepth(e.maxDepth))
+	var warnings []Diagnostic
+	if err == nil {
+		warnings, err = e.checkTypes(expr)
+	}
 	if err != nil {
+		e.stats.compile(err)
+		e.onCompileError(dsl, err)
 		return nil, err
 	}
 
@@ -176,11 +468,25 @@ func (e *Engine) Compile(dsl string) (*CompiledExpression, error) {
 		AST:       expr,
 		Optimized: optimized,
 		Source:    dsl,
+		Warnings:  warnings,
+		hash:      ast.Hash(expr),
+	}
+	e.trackClauses(compiled)
+	e.compileProgram(compiled)
+
+	if err := e.onCompile(compiled); err != nil {
+		e.stats.compile(err)
+		e.onCompileError(dsl, err)
+		return nil, err
+	}
+	e.stats.compile(nil)
+	if e.diskCacheDir != "" {
+		e.storeDiskCache(compiled)
 	}
 
 	// Store in cache
 	if e.caching {
-		e.cache[dsl] = compiled
+		return e.cache.add(dsl, compiled), nil
 	}
 
 	return compiled, nil
@@ -188,46 +494,50 @@ func (e *Engine) Compile(dsl string) (*CompiledExpression, error) {
 
 // Evaluate evaluates a compiled expression against a payload.
 func (e *Engine) Evaluate(expr *CompiledExpression, payload interface{}) (types.Value, error) {
-	ctx, err := eval.NewContext(payload)
+	ctx, err := e.newContext(payload)
 	if err != nil {
 		return types.Null(), err
 	}
 
-	// Use optimized AST if available
-	astToEval := expr.Optimized
-	if astToEval == nil {
-		astToEval = expr.AST
-	}
+	return e.evaluateContext(expr, ctx, "")
+}
 
-	return e.evaluator.Evaluate(astToEval, ctx)
+// evaluateContext evaluates a compiled expression against a prepared evaluation context.
+// The rule name, if any, is reported to plugins.
+func (e *Engine) evaluateContext(expr *CompiledExpression, ctx *eval.EvalContext, rule string) (types.Value, error) {
+	value, _, err := e.run(expr, ctx, rule, false)
+	return value, err
 }
 
 // EvaluateWithExplanation evaluates an expression and returns detailed explanation.
 // Note: Uses the original AST (not optimized) for better explanation accuracy.
 func (e *Engine) EvaluateWithExplanation(expr *CompiledExpression, payload interface{}) (types.Value, *eval.Explanation, error) {
-	ctx, err := eval.NewContext(payload)
+	ctx, err := e.newContext(payload)
 	if err != nil {
 		return types.Null(), nil, err
 	}
 
-	// Use original AST for explanations to show the full expression tree
-	return e.evaluator.EvaluateWithExplanation(expr.AST, ctx)
+	return e.run(expr, ctx, "", true)
+}
+
+// explainContext evaluates a compiled expression with explanation against a prepared context.
+// It does not run plugin hooks; it is used to explain results that were already evaluated.
+func (e *Engine) explainContext(expr *CompiledExpression, ctx *eval.EvalContext) (types.Value, *eval.Explanation, error) {
+	return e.evaluateRaw(expr, ctx, true)
 }
 
 // EvaluateBool evaluates a compiled expression and returns a boolean result.
 func (e *Engine) EvaluateBool(expr *CompiledExpression, payload interface{}) (bool, error) {
-	ctx, err := eval.NewContext(payload)
+	ctx, err := e.newContext(payload)
 	if err != nil {
 		return false, err
 	}
 
-	// Use optimized AST if available
-	astToEval := expr.Optimized
-	if astToEval == nil {
-		astToEval = expr.AST
+	value, err := e.evaluateContext(expr, ctx, "")
+	if err != nil {
+		return false, err
 	}
-
-	return e.evaluator.EvaluateBool(astToEval, ctx)
+	return e.evaluator.Matched(value)
 }
 
 // EvaluateDirect compiles and evaluates an expression in one step.
@@ -252,7 +562,11 @@ func (e *Engine) EvaluateDirectBool(dsl string, payload interface{}) (bool, erro
 
 // RegisterFunction registers a user-defined JavaScript function.
 // The source should be in the format: function name(params): returnType { body }
+// It fails if JavaScript functions are disabled.
 func (e *Engine) RegisterFunction(source string) error {
+	if e.sandbox == nil {
+		return errors.New(errors.ErrSandboxViolation, "JavaScript functions are disabled")
+	}
 	return e.functions.RegisterJSFunction(source, e.sandbox)
 }
 
@@ -261,19 +575,66 @@ func (e *Engine) RegisterBuiltIn(name string, fn functions.BuiltInFunc, sig *typ
 	return e.functions.RegisterBuiltIn(name, fn, sig)
 }
 
-// ClearCache clears the expression cache.
+// RegisterLazy registers a built-in Go function that receives its arguments
+// unevaluated, so it can skip the arguments it does not need.
+func (e *Engine) RegisterLazy(name string, fn functions.LazyFunc, sig *types.FunctionSignature) error {
+	return e.functions.RegisterLazy(name, fn, sig)
+}
+
+// RegisterContextual registers a built-in Go function that receives the Go
+// context of the evaluation, which carries its deadline, and the evaluation
+// context, which gives access to the payload and variables.
+func (e *Engine) RegisterContextual(name string, fn functions.ContextFunc, sig *types.FunctionSignature) error {
+	return e.functions.RegisterContextual(name, fn, sig)
+}
+
+// RegisterExternal registers a function backed by a network call or another
+// slow resource, with the timeout, retries, and circuit breaker given by opts.
+// Calls are also bounded by the evaluation timeout, which may need raising
+// with WithTimeout or WithLimits.
+func (e *Engine) RegisterExternal(name string, fn functions.ExternalFunc, sig *types.FunctionSignature, opts ...functions.ExternalOption) error {
+	return e.functions.RegisterExternal(name, fn, sig, opts...)
+}
+
+// Rules returns the engine's rule catalog.
+// Rules from different domains can share the catalog and be told apart by tags.
+func (e *Engine) Rules() *RuleSet {
+	return e.rules
+}
+
+// AddRule compiles a rule and adds it to the engine's rule catalog.
+func (e *Engine) AddRule(name, dsl string, opts ...RuleOption) error {
+	return e.rules.Add(name, dsl, opts...)
+}
+
+// SelectRules returns the rules of the catalog carrying at least one of the given tags.
+func (e *Engine) SelectRules(tags ...string) *RuleSet {
+	return e.rules.Select(tags...)
+}
+
+// ClearCache clears the expression cache. Cache statistics are kept.
 func (e *Engine) ClearCache() {
 	if e.cache != nil {
-		e.cache = make(map[string]*CompiledExpression)
+		e.cache.clear()
 	}
 }
 
+// CacheStats returns the compile cache statistics.
+// All values are zero if caching is disabled.
+func (e *Engine) CacheStats() CacheStats {
+	if e.cache == nil {
+		return CacheStats{}
+	}
+	return e.cache.snapshot()
+}
+
 // GetFunctionRegistry returns the function registry.
 func (e *Engine) GetFunctionRegistry() *functions.Registry {
 	return e.functions
 }
 
-// GetSandbox returns the JavaScript sandbox.
+// GetSandbox returns the JavaScript sandbox, or nil if JavaScript functions
+// are disabled.
 func (e *Engine) GetSandbox() *functions.Sandbox {
 	return e.sandbox
 }
@@ -292,11 +653,14 @@ func (e *Engine) ListFunctions() []string {
 // Input/Output structures for JSON API
 // ============================================================================
 
-// EvalRequest represents an evaluation request.
+// EvalRequest represents an evaluation request. Limits, if set, restrict the
+// evaluation as CompiledExpression.WithLimits does; its Functions list is the
+// set of functions the expression may call.
 type EvalRequest struct {
 	Payload   interface{} `json:"payload"`
 	DSL       string      `json:"dsl"`
 	Functions []string    `json:"functions,omitempty"`
+	Limits    *Limits     `json:"limits,omitempty"`
 }
 
 // EvalResponse represents an evaluation response.
@@ -305,46 +669,87 @@ type EvalResponse struct {
 	Type        string            `json:"type"`
 	Explanation *eval.Explanation `json:"explanation,omitempty"`
 	Error       string            `json:"error,omitempty"`
+	ErrorCode   int               `json:"errorCode,omitempty"`
+	ErrorDetail *Error            `json:"errorDetail,omitempty"`
+}
+
+// setError records err on the response, including its AMEL error code and
+// details if it has them.
+func (r *EvalResponse) setError(err error) {
+	r.Error = err.Error()
+	if amelErr, ok := err.(*errors.Error); ok {
+		r.ErrorCode = int(amelErr.Code)
+		r.ErrorDetail = amelErr
+	}
 }
 
 // EvaluateRequest evaluates a request and returns a response.
+// The response includes an explanation when explain mode is enabled.
 func (e *Engine) EvaluateRequest(req *EvalRequest) *EvalResponse {
+	return e.evaluateRequest(context.Background(), req, e.explainMode)
+}
+
+// EvaluateRequestContext is EvaluateRequest with a Go context: the evaluation
+// fails with ErrTimeout once ctx is canceled or its deadline passes, as when
+// the client of a server handling the request goes away.
+func (e *Engine) EvaluateRequestContext(ctx context.Context, req *EvalRequest) *EvalResponse {
+	return e.evaluateRequest(ctx, req, e.explainMode)
+}
+
+// ExplainRequest evaluates a request and returns a response with an explanation,
+// regardless of the engine's explain mode.
+func (e *Engine) ExplainRequest(req *EvalRequest) *EvalResponse {
+	return e.evaluateRequest(context.Background(), req, true)
+}
+
+// ExplainRequestContext is ExplainRequest with a Go context, which stops the
+// evaluation as in EvaluateRequestContext.
+func (e *Engine) ExplainRequestContext(ctx context.Context, req *EvalRequest) *EvalResponse {
+	return e.evaluateRequest(ctx, req, true)
+}
+
+// evaluateRequest evaluates a request, optionally with an explanation.
+func (e *Engine) evaluateRequest(ctx context.Context, req *EvalRequest, explain bool) *EvalResponse {
 	resp := &EvalResponse{}
 
 	// Register any custom functions
 	for _, fnSrc := range req.Functions {
 		if err := e.RegisterFunction(fnSrc); err != nil {
-			resp.Error = err.Error()
+			resp.setError(err)
 			return resp
 		}
 	}
 
 	// Compile the expression
 	compiled, err := e.Compile(req.DSL)
+	if err == nil && req.Limits != nil {
+		compiled, err = compiled.WithLimits(*req.Limits)
+	}
 	if err != nil {
-		resp.Error = err.Error()
+		resp.setError(err)
 		return resp
 	}
 
-	// Evaluate
-	if e.explainMode {
-		value, explanation, err := e.EvaluateWithExplanation(compiled, req.Payload)
-		if err != nil {
-			resp.Error = err.Error()
-			return resp
-		}
-		resp.Result = value.Raw
-		resp.Type = value.Type.String()
-		resp.Explanation = explanation
-	} else {
-		value, err := e.Evaluate(compiled, req.Payload)
-		if err != nil {
-			resp.Error = err.Error()
-			return resp
-		}
-		resp.Result = value.Raw
-		resp.Type = value.Type.String()
+	return e.respond(ctx, compiled, req.Payload, explain)
+}
+
+// respond evaluates a compiled expression and builds the response.
+func (e *Engine) respond(ctx context.Context, compiled *CompiledExpression, payload interface{}, explain bool) *EvalResponse {
+	resp := &EvalResponse{}
+
+	evalCtx, err := e.newContext(payload)
+	if err != nil {
+		resp.setError(err)
+		return resp
+	}
+	value, explanation, err := e.run(compiled, evalCtx.WithContext(ctx), "", explain)
+	if err != nil {
+		resp.setError(err)
+		return resp
 	}
+	resp.Result = value.Plain()
+	resp.Type = value.Type.String()
+	resp.Explanation = explanation
 
 	return resp
 }
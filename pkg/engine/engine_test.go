@@ -2,9 +2,11 @@
 package engine
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/bencagri/amel/internal/errors"
 	"github.com/bencagri/amel/pkg/functions"
 	"github.com/bencagri/amel/pkg/types"
 	"github.com/stretchr/testify/assert"
@@ -610,6 +612,34 @@ func TestEngine_EvaluateRequestWithExplanation(t *testing.T) {
 	assert.NotNil(t, resp.Explanation)
 }
 
+func TestEngine_EvaluateRequestContext(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	req := &EvalRequest{
+		Payload: map[string]interface{}{"xs": []interface{}{1, 2, 3}},
+		DSL:     "sum(map($.xs, x => x * 2))",
+		Limits:  &Limits{Functions: []string{"sum", "map"}},
+	}
+	resp := engine.EvaluateRequestContext(context.Background(), req)
+	assert.Empty(t, resp.Error)
+	assert.Equal(t, float64(12), resp.Result)
+
+	req.Limits.Functions = []string{"sum"}
+	resp = engine.ExplainRequestContext(context.Background(), req)
+	assert.Equal(t, int(ErrFunctionDenied), resp.ErrorCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req.Limits = nil
+	resp = engine.EvaluateRequestContext(ctx, req)
+	assert.Equal(t, int(ErrTimeout), resp.ErrorCode)
+
+	// A canceled context does not affect later evaluations
+	resp = engine.EvaluateRequest(req)
+	assert.Empty(t, resp.Error)
+}
+
 func TestConvenienceFunctions(t *testing.T) {
 	t.Run("Eval", func(t *testing.T) {
 		result, err := Eval("5 + 3", nil)
@@ -703,3 +733,400 @@ func BenchmarkEngine_EvaluateComplex(b *testing.B) {
 		engine.EvaluateBool(compiled, payload)
 	}
 }
+
+func TestEngine_DateTime(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	recent := time.Now().Add(-3 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	payload := map[string]interface{}{"createdAt": recent, "old": "2020-01-01", "dob": "2000-02-29"}
+
+	for dsl, want := range map[string]bool{
+		`$.createdAt > dateAdd(now(), -7, 'days')`:                true,
+		`$.old > dateAdd(now(), -7, "days")`:                      false,
+		`$.old == parseDate("2020-01-01T00:00:00Z")`:              true,
+		`dateDiff($.dob, "2018-02-28", "years") == 17`:            true,
+		`typeOf(now()) == "datetime"`:                             true,
+		`formatDate(dateAdd($.old, 1, "year"), "2006") == "2021"`: true,
+	} {
+		got, err := engine.EvaluateDirectBool(dsl, payload)
+		require.NoError(t, err, dsl)
+		assert.Equal(t, want, got, dsl)
+	}
+
+	_, err = engine.EvaluateDirect(`now() > 5`, nil)
+	assert.Error(t, err)
+}
+
+func TestEngine_Duration(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	recent := time.Now().Add(-3 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	payload := map[string]interface{}{"createdAt": recent, "old": "2020-01-01", "timeout": "90s", "elapsed": 45}
+
+	for dsl, want := range map[string]bool{
+		`$.createdAt > now() - 7d`:                                               true,
+		`$.old > now() - 7d`:                                                     false,
+		`$.old + 36h == parseDate("2020-01-02T12:00:00Z")`:                       true,
+		`parseDate("2020-01-02") - $.old == 24h`:                                 true,
+		`2h30m == 150m && 1.5h == 90m`:                                           true,
+		`duration($.timeout) < 2m && $.timeout == 1m30s`:                         true,
+		`minutes(2 * 45m) == 90 && hours(-30m) == -0.5`:                          true,
+		`seconds($.elapsed * 1s) == 45 && 3h / 90m == 2`:                         true,
+		`typeOf(1d) == "duration" && string(90m / 2) == "45m0s"`:                 true,
+		`formatDate(parseDate("2024-05-01") + 1d, "2006-01-02") == "2024-05-02"`: true,
+	} {
+		got, err := engine.EvaluateDirectBool(dsl, payload)
+		require.NoError(t, err, dsl)
+		assert.Equal(t, want, got, dsl)
+	}
+
+	for _, dsl := range []string{`now() + 5`, `5m + 1`, `1d > now()`, `5m / 0`} {
+		_, err := engine.EvaluateDirect(dsl, nil)
+		assert.Error(t, err, dsl)
+	}
+
+	result, err := engine.Validate(`now() - 7d > $.createdAt && hours(now() - $.createdAt) < 1 && 5m - 1 > 0`, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Errors(), 1)
+	assert.Contains(t, result.Errors()[0].Message, "operator - requires numbers, got duration and int")
+}
+
+func TestEngine_MapLiteral(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{"name": "Ann", "age": 20, "items": []interface{}{1, 2, 3}}
+
+	compiled, err := engine.Compile(`{"name": upper($.name), "adult": $.age >= 18, "total": 1 + 2, "items": {"count": len($.items)}}`)
+	require.NoError(t, err)
+	result, err := engine.Evaluate(compiled, payload)
+	require.NoError(t, err)
+	assert.Equal(t, types.TypeMap, result.Type)
+	assert.Equal(t, types.Map(map[string]types.Value{
+		"name":  types.String("ANN"),
+		"adult": types.Bool(true),
+		"total": types.Int(3),
+		"items": types.Map(map[string]types.Value{"count": types.Int(3)}),
+	}), result)
+
+	for dsl, want := range map[string]bool{
+		`{"a": {"b": 5}}.a.b == 5`:                    true,
+		`{"a": 1}["a"] == 1 && {"a": 1}["z"] == null`: true,
+		`{"a": 1, "b": [1]} == {"b": [1.0], "a": 1}`:  true,
+		`{"a": 1} != {"a": 1, "b": 2}`:                true,
+		`len({"a": 1, "b": 2}) == 2 && isEmpty({})`:   true,
+		`typeOf({}) == "map" && !{}`:                  true,
+	} {
+		got, err := engine.EvaluateDirectBool(dsl, nil)
+		require.NoError(t, err, dsl)
+		assert.Equal(t, want, got, dsl)
+	}
+
+	_, err = engine.EvaluateDirect(`{"a": 1}[0]`, nil)
+	assert.Error(t, err)
+
+	_, explanation, err := engine.EvaluateWithExplanation(compiled, payload)
+	require.NoError(t, err)
+	assert.Equal(t, "Map with 4 entries", explanation.Reason)
+	assert.Len(t, explanation.Children, 4)
+
+	data, err := compiled.MarshalBinary()
+	require.NoError(t, err)
+	loaded, err := engine.LoadCompiled(data)
+	require.NoError(t, err)
+	again, err := engine.Evaluate(loaded, payload)
+	require.NoError(t, err)
+	assert.True(t, result.Equals(again))
+}
+
+func TestEngine_MemberAccess(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterFunction(`function profile() { return {address: {city: "Oslo"}, zip: 150}; }`))
+
+	payload := map[string]interface{}{
+		"user":   map[string]interface{}{"address": map[string]interface{}{"city": "Oslo"}, "age": 30},
+		"orders": []interface{}{map[string]interface{}{"total": 5}, map[string]interface{}{"total": 7}},
+	}
+
+	for _, dsl := range []string{
+		`($.user).address.city == "Oslo"`,
+		`($).user.address.city == "Oslo"`,
+		`$.user["address"].city == "Oslo"`,
+		`first($.orders).total == 5 && typeOf(first($.orders).total) == "int"`,
+		`map($.orders, o => o.total) == [5, 7]`,
+		`profile().address.city == "Oslo" && profile().zip == 150`,
+		`typeOf($.user) == "map" && len($.user) == 2`,
+		`$.user == $.user && $.user.address == {"city": "Oslo"}`,
+		`$.user.missing.city == null`,
+	} {
+		got, err := engine.EvaluateDirectBool(dsl, payload)
+		require.NoError(t, err, dsl)
+		assert.True(t, got, dsl)
+	}
+
+	t.Run("JSON payloads", func(t *testing.T) {
+		got, err := engine.EvaluateDirectBool(`($).user.address.city == "Oslo"`, `{"user": {"address": {"city": "Oslo"}}}`)
+		require.NoError(t, err)
+		assert.True(t, got)
+	})
+
+	t.Run("variables", func(t *testing.T) {
+		compiled, err := engine.Compile(`limits.daily.max >= $.user.age`)
+		require.NoError(t, err)
+		bound, err := compiled.Bind(map[string]interface{}{
+			"limits": map[string]interface{}{"daily": map[string]interface{}{"max": 30}},
+		})
+		require.NoError(t, err)
+		got, err := engine.EvaluateBool(bound, payload)
+		require.NoError(t, err)
+		assert.True(t, got)
+
+		rules := engine.NewRuleSet()
+		require.NoError(t, rules.Add("isOslo", `user.address.city == "Oslo"`))
+		require.NoError(t, rules.Add("user", `$.user`, WithOutput("user")))
+		results, err := rules.EvaluateAll(payload)
+		require.NoError(t, err)
+		assert.True(t, results["isOslo"].Matched())
+	})
+
+	t.Run("responses", func(t *testing.T) {
+		resp := engine.EvaluateRequest(&EvalRequest{DSL: `$.user.address`, Payload: payload})
+		require.Empty(t, resp.Error)
+		assert.Equal(t, "map", resp.Type)
+		assert.Equal(t, map[string]interface{}{"city": "Oslo"}, resp.Result)
+	})
+}
+
+func TestEngine_StringIndexAndSlice(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{"code": "ÉTÉ-2024", "items": []interface{}{1, 2, 3, 4}, "n": 2}
+
+	for dsl, want := range map[string]interface{}{
+		`$.code[0]`:         "É",
+		`$.code[-1]`:        "4",
+		`$.code[0:3]`:       "ÉTÉ",
+		`$.code[:3]`:        "ÉTÉ",
+		`$.code[4:]`:        "2024",
+		`$.code[-4:]`:       "2024",
+		`$.code[$.n:]`:      "É-2024",
+		`$.code[6:2]`:       "",
+		`$.code[0:100]`:     "ÉTÉ-2024",
+		`$.code[20]`:        nil,
+		`"abc"[1]`:          "b",
+		`lower($.code)[:3]`: "été",
+	} {
+		got, err := engine.EvaluateDirect(dsl, payload)
+		require.NoError(t, err, dsl)
+		assert.Equal(t, want, got.Raw, dsl)
+	}
+
+	got, err := engine.EvaluateDirect(`$.items[1:3]`, payload)
+	require.NoError(t, err)
+	assert.True(t, got.Equals(types.List(types.Int(2), types.Int(3))))
+	got, err = engine.EvaluateDirect(`$.items[-1]`, payload)
+	require.NoError(t, err)
+	assert.Equal(t, types.Int(4), got)
+
+	for _, dsl := range []string{`"abc"[3]`, `$.n[0:1]`, `$.code["a":]`} {
+		_, err := engine.EvaluateDirect(dsl, payload)
+		assert.Error(t, err, dsl)
+	}
+
+	result, err := engine.Validate(`len(42[1:]) > 0`, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Errors(), 1)
+	assert.Contains(t, result.Errors()[0].Message, "cannot slice int")
+}
+
+func TestEngine_IntegerDivisionAndModulo(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{"latency": 237.5, "minutes": 135, "zero": 0}
+
+	for dsl, want := range map[string]types.Value{
+		`$.minutes ~/ 60`:                types.Int(2),
+		`-$.minutes ~/ 60`:               types.Int(-2),
+		`$.latency ~/ 50`:                types.Int(4),
+		`$.latency ~/ 50 * 50`:           types.Int(200),
+		`$.latency % 50`:                 types.Float(37.5),
+		`-7.5 % 2`:                       types.Float(-1.5),
+		`$.minutes % 60`:                 types.Int(15),
+		`divmod($.minutes, 60)`:          types.List(types.Int(2), types.Int(15)),
+		`divmod($.latency, 100)`:         types.List(types.Int(2), types.Float(37.5)),
+		`1 + 7 ~/ 2 // integer division`: types.Int(4),
+	} {
+		got, err := engine.EvaluateDirect(dsl, payload)
+		require.NoError(t, err, dsl)
+		assert.True(t, got.Equals(want), "%s = %v", dsl, got)
+		assert.Equal(t, want.Type, got.Type, dsl)
+	}
+
+	for _, dsl := range []string{`$.minutes ~/ $.zero`, `$.latency % 0.0`, `"a" ~/ 2`, `divmod(1, $.zero)`,
+		`(-9223372036854775807 - 1) ~/ -1`, `divmod(-9223372036854775807 - 1, -1)`} {
+		_, err := engine.EvaluateDirect(dsl, payload)
+		assert.Error(t, err, dsl)
+	}
+
+	result, err := engine.Validate(`$.n ~/ 2 == 1`, nil)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestEngine_Conditional(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{"x": 0, "y": 4, "tier": "gold", "items": []interface{}{-1, 2}}
+
+	for dsl, want := range map[string]types.Value{
+		`$.x != 0 ? 100 / $.x : 0`:                              types.Int(0),
+		`$.y != 0 ? 100 / $.y : 0`:                              types.Float(25),
+		`$.tier == "gold" ? 0.2 : $.tier == "silver" ? 0.1 : 0`: types.Float(0.2),
+		`($.y > 3 ? $.y : 3) * 2`:                               types.Int(8),
+		`$.x ? "set" : "unset"`:                                 types.String("unset"),
+		`map($.items, n => n < 0 ? -n : n)`:                     types.List(types.Int(1), types.Int(2)),
+		`{"limit": $.y > 3 ? "high" : "low"}.limit`:             types.String("high"),
+	} {
+		got, err := engine.EvaluateDirect(dsl, payload)
+		require.NoError(t, err, dsl)
+		assert.True(t, got.Equals(want), "%s = %v", dsl, got)
+	}
+
+	compiled, err := engine.Compile(`$.x == 0 ? "zero" : 100 / $.x`)
+	require.NoError(t, err)
+	value, explanation, err := engine.EvaluateWithExplanation(compiled, payload)
+	require.NoError(t, err)
+	assert.Equal(t, types.String("zero"), value)
+	assert.Contains(t, explanation.Reason, "selected the then branch")
+	require.Len(t, explanation.Children, 2)
+
+	result, err := engine.Validate(`len($.y > 3 ? "a" : "b") > 0`, nil)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestEngine_Case(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{"x": 0, "y": 4, "tier": "silver"}
+
+	for dsl, want := range map[string]types.Value{
+		`case { $.tier == "gold" => 0.2; $.tier == "silver" => 0.1; else => 0 }`: types.Float(0.1),
+		`case { $.x != 0 => 100 / $.x; else => 0 }`:                              types.Int(0),
+		`case { $.y != 0 => 100 / $.y; else => 0 }`:                              types.Float(25),
+		`case { $.tier == "gold" => 0.2 }`:                                       types.Null(),
+		`case { $.x => "set"; $.y => "y" }`:                                      types.String("y"),
+		`case { $.y > 3 => 1; $.y > 2 => 2; else => 3 } * 10`:                    types.Int(10),
+	} {
+		got, err := engine.EvaluateDirect(dsl, payload)
+		require.NoError(t, err, dsl)
+		assert.True(t, got.Equals(want), "%s = %v", dsl, got)
+	}
+
+	compiled, err := engine.Compile(`case { $.x == 1 => "one"; $.x == 0 => "zero"; else => 100 / $.x }`)
+	require.NoError(t, err)
+	value, explanation, err := engine.EvaluateWithExplanation(compiled, payload)
+	require.NoError(t, err)
+	assert.Equal(t, types.String("zero"), value)
+	assert.Contains(t, explanation.Reason, "selected arm 2")
+	require.Len(t, explanation.Children, 3)
+}
+
+func TestEngine_SafeIndex(t *testing.T) {
+	payload := map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"sku": "A"}},
+		"code":  "AB",
+		"i":     1,
+	}
+
+	// Constant indices in paths are read from the payload and give null;
+	// other indices fail by default
+	strict, err := New()
+	require.NoError(t, err)
+	for _, dsl := range []string{`$.items[$.i]`, `at($.items, -2)`, `upper($.code)[5]`} {
+		_, err := strict.EvaluateDirect(dsl, payload)
+		assert.ErrorContains(t, err, "index out of bounds", dsl)
+	}
+
+	for _, opts := range [][]Option{{WithSafeIndex(true)}, {WithSafeIndex(true), WithBytecode(true)}} {
+		engine, err := New(opts...)
+		require.NoError(t, err)
+
+		for dsl, want := range map[string]types.Value{
+			`$.items[$.i]`:                types.Null(),
+			`$.items[-$.i - 1]`:           types.Null(),
+			`at($.items, 3)`:              types.Null(),
+			`upper($.code)[$.i + 1]`:      types.Null(),
+			`[1, 2][5]`:                   types.Null(),
+			`$.items[$.i - 1].sku`:        types.String("A"),
+			`$.items[$.i].sku == "A"`:     types.Bool(false),
+			`coalesce($.items[$.i], "x")`: types.String("x"),
+		} {
+			compiled, err := engine.Compile(dsl)
+			require.NoError(t, err, dsl)
+			got, err := engine.Evaluate(compiled, payload)
+			require.NoError(t, err, dsl)
+			assert.True(t, got.Equals(want), "%s = %v", dsl, got)
+		}
+
+		// Other index errors still fail
+		_, err = engine.EvaluateDirect(`$.items[$.code]`, payload)
+		assert.True(t, errors.IsCode(err, ErrTypeMismatch))
+	}
+}
+
+func TestEngine_Score(t *testing.T) {
+	payload := map[string]interface{}{
+		"amount":  1500,
+		"country": "XX",
+		"device":  map[string]interface{}{"new": false},
+		"signals": []interface{}{[]interface{}{true, 5}, []interface{}{false, 50}},
+		"zero":    0,
+	}
+	dsl := `score([[$.amount > 1000, 40], [$.country IN ["XX", "YY"], 30], [$.device.new, 100 / $.zero]])`
+
+	for _, opts := range [][]Option{nil, {WithBytecode(true)}} {
+		engine, err := New(opts...)
+		require.NoError(t, err)
+
+		// The weight of a condition that does not hold is not evaluated
+		got, err := engine.EvaluateDirect(dsl, payload)
+		require.NoError(t, err)
+		assert.Equal(t, types.Float(70), got)
+
+		ok, err := engine.EvaluateDirectBool(dsl+` >= 50`, payload)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		got, err = engine.EvaluateDirect(`score($.signals)`, payload)
+		require.NoError(t, err)
+		assert.Equal(t, types.Float(5), got)
+
+		_, err = engine.EvaluateDirect(`score([[true, "high"]])`, payload)
+		assert.Error(t, err)
+	}
+
+	engine, err := New()
+	require.NoError(t, err)
+	compiled, err := engine.Compile(dsl)
+	require.NoError(t, err)
+	_, explanation, err := engine.EvaluateWithExplanation(compiled, payload)
+	require.NoError(t, err)
+	assert.Equal(t, "Score of 2 of 3 conditions = 70", explanation.Reason)
+	require.Len(t, explanation.Children, 3)
+	assert.Equal(t, "Condition holds: +40", explanation.Children[0].Reason)
+	assert.Equal(t, "Condition does not hold: +0", explanation.Children[2].Reason)
+	assert.Len(t, explanation.Children[2].Children, 1)
+
+	strict, err := New(WithStrictTypes(true))
+	require.NoError(t, err)
+	_, err = strict.EvaluateDirect(`score([[$.amount, 10]])`, payload)
+	assert.True(t, errors.IsCode(err, errors.ErrStrictTruthiness))
+}
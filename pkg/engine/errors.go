@@ -0,0 +1,74 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// Error is the structured form of the errors returned by the engine. It holds
+// the error code, the message, the span of the offending expression, the
+// payload path and function involved, and a hint, and encodes to JSON as
+//
+//	{"code": 300, "name": "TypeMismatch", "category": "Type",
+//	 "message": "...", "span": {"line": 1, "column": 1, "endLine": 1, "endColumn": 12},
+//	 "path": "$.age", "function": "", "hint": "..."}
+//
+// Use AsError to get it from an error instead of matching error strings.
+type Error = errors.Error
+
+// ErrorCode identifies the kind of an Error. Its String method returns the
+// code name, such as "TypeMismatch", and Category the group of the code.
+type ErrorCode = errors.ErrorCode
+
+// ErrorSpan is the range of the expression source an Error refers to.
+type ErrorSpan = errors.Span
+
+// Error codes of the errors returned by the engine.
+const (
+	ErrUnexpectedCharacter = errors.ErrUnexpectedCharacter
+	ErrUnterminatedString  = errors.ErrUnterminatedString
+	ErrInvalidNumber       = errors.ErrInvalidNumber
+	ErrInvalidEscape       = errors.ErrInvalidEscape
+
+	ErrUnexpectedToken   = errors.ErrUnexpectedToken
+	ErrMissingExpression = errors.ErrMissingExpression
+	ErrUnmatchedParen    = errors.ErrUnmatchedParen
+	ErrInvalidSyntax     = errors.ErrInvalidSyntax
+	ErrUnexpectedEOF     = errors.ErrUnexpectedEOF
+	ErrInvalidJSONPath   = errors.ErrInvalidJSONPath
+
+	ErrTypeMismatch      = errors.ErrTypeMismatch
+	ErrUndefinedFunction = errors.ErrUndefinedFunction
+	ErrArgumentCount     = errors.ErrArgumentCount
+	ErrArgumentType      = errors.ErrArgumentType
+	ErrInvalidOperator   = errors.ErrInvalidOperator
+	ErrUndefinedVariable = errors.ErrUndefinedVariable
+	ErrStrictComparison  = errors.ErrStrictComparison
+	ErrStrictNumeric     = errors.ErrStrictNumeric
+	ErrStrictTruthiness  = errors.ErrStrictTruthiness
+
+	ErrDivisionByZero   = errors.ErrDivisionByZero
+	ErrNullReference    = errors.ErrNullReference
+	ErrIndexOutOfBounds = errors.ErrIndexOutOfBounds
+	ErrTimeout          = errors.ErrTimeout
+	ErrMemoryLimit      = errors.ErrMemoryLimit
+	ErrSandboxViolation = errors.ErrSandboxViolation
+	ErrFunctionPanic    = errors.ErrFunctionPanic
+	ErrIterationLimit   = errors.ErrIterationLimit
+	ErrFunctionDenied   = errors.ErrFunctionDenied
+	ErrExternalCall     = errors.ErrExternalCall
+	ErrCircuitOpen      = errors.ErrCircuitOpen
+	ErrCallBudget       = errors.ErrCallBudget
+	ErrDepthLimit       = errors.ErrDepthLimit
+	ErrRegexDenied      = errors.ErrRegexDenied
+
+	ErrInvalidPath    = errors.ErrInvalidPath
+	ErrPathNotFound   = errors.ErrPathNotFound
+	ErrInvalidPayload = errors.ErrInvalidPayload
+)
+
+// AsError returns the structured error in err's chain. Errors that carry no
+// AMEL error, such as I/O errors of callers, return false.
+func AsError(err error) (*Error, bool) {
+	return errors.As(err)
+}
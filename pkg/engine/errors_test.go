@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_StructuredErrors(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	t.Run("runtime error", func(t *testing.T) {
+		_, err := engine.EvaluateDirect(`$.count >= 0 && $.total / $.count > 10`, map[string]interface{}{"total": 5, "count": 0})
+		require.Error(t, err)
+
+		amelErr, ok := AsError(fmt.Errorf("rule failed: %w", err))
+		require.True(t, ok)
+		assert.Equal(t, ErrDivisionByZero, amelErr.Code)
+		assert.Equal(t, "$.total", amelErr.Path)
+		assert.Equal(t, &ErrorSpan{Line: 1, Column: 17, EndLine: 1, EndColumn: 34}, amelErr.Span())
+	})
+
+	t.Run("function error", func(t *testing.T) {
+		_, err := engine.EvaluateDirect(`len(filter($.items, x => x > 1)) > 0`, map[string]interface{}{"items": []interface{}{"a"}})
+		require.Error(t, err)
+
+		amelErr, ok := AsError(err)
+		require.True(t, ok)
+		assert.Equal(t, "filter", amelErr.Function)
+		assert.Equal(t, "$.items", amelErr.Path)
+		assert.Equal(t, 5, amelErr.Column)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		_, err := engine.Compile(`$.a + `)
+		require.Error(t, err)
+		amelErr, ok := AsError(err)
+		require.True(t, ok)
+
+		data, err := json.Marshal(amelErr)
+		require.NoError(t, err)
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &fields))
+		assert.Equal(t, amelErr.Code.String(), fields["name"])
+		assert.Equal(t, "Parser", fields["category"])
+		assert.Contains(t, fields, "span")
+
+		var decoded Error
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, amelErr.Code, decoded.Code)
+		assert.Equal(t, amelErr.Message, decoded.Message)
+		assert.Equal(t, amelErr.Span(), decoded.Span())
+	})
+
+	t.Run("responses", func(t *testing.T) {
+		resp := engine.EvaluateRequest(&EvalRequest{DSL: `$.n / 0`, Payload: map[string]interface{}{"n": 1}})
+		require.NotNil(t, resp.ErrorDetail)
+		assert.Equal(t, ErrDivisionByZero, resp.ErrorDetail.Code)
+
+		data, err := json.Marshal(resp)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"hint":"guard the divisor`)
+	})
+
+	_, ok := AsError(fmt.Errorf("not an engine error"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,135 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/format"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// FailedClause is a clause that kept an expression from matching.
+type FailedClause struct {
+	// Clause is the clause in canonical form, such as "$.age >= 18".
+	Clause string `json:"clause"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	// Values holds the payload values the clause read, by path.
+	Values map[string]interface{} `json:"values"`
+	// Message describes the failure for end users, such as
+	// "`$.age >= 18` failed: age=16".
+	Message string `json:"message"`
+}
+
+// ExplainFailure evaluates an expression and, if the result is not truthy,
+// returns the clauses that made it fail, rather than the whole explanation
+// tree: every false clause of an && chain, and the failing clauses of every
+// alternative of an || chain. Other expressions, such as comparisons and
+// negations, are reported as a whole. It returns nil if the result is
+// truthy, and an error if the evaluation fails. Hooks do not run.
+func (e *Engine) ExplainFailure(expr *CompiledExpression, payload interface{}) ([]FailedClause, error) {
+	ctx, err := e.newContext(payload)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := e.evaluateRaw(expr, ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsTruthy(value) {
+		return nil, nil
+	}
+
+	f := &failureExplainer{engine: e, ctx: ctx}
+	f.explain(expr.AST)
+	return f.failed, nil
+}
+
+// failureExplainer collects the failing clauses of a false expression.
+type failureExplainer struct {
+	engine *Engine
+	ctx    *eval.EvalContext
+	failed []FailedClause
+}
+
+// explain records why node, which evaluated to a falsy value, failed.
+func (f *failureExplainer) explain(node ast.Expression) {
+	switch n := node.(type) {
+	case *ast.GroupedExpression:
+		f.explain(n.Expression)
+		return
+	case *ast.BinaryExpression:
+		switch logicalOperator(n.Operator) {
+		case "&&":
+			// Clauses after the first false one are not evaluated normally
+			// and may fail; only those that evaluate to false are reported
+			for _, clause := range flattenLogical(n, "&&") {
+				if value, err := f.evaluate(clause); err == nil && !f.engine.IsTruthy(value) {
+					f.explain(clause)
+				}
+			}
+			return
+		case "||":
+			for _, clause := range flattenLogical(n, "||") {
+				f.explain(clause)
+			}
+			return
+		}
+	}
+	f.record(node)
+}
+
+// record reports node as a failed clause.
+func (f *failureExplainer) record(node ast.Expression) {
+	clause := format.Node(node)
+	span := ast.SpanOf(node)
+	failed := FailedClause{
+		Clause: clause,
+		Line:   span.Line,
+		Column: span.Column,
+		Values: make(map[string]interface{}),
+	}
+
+	var values []string
+	for _, path := range ast.ExtractPaths(node) {
+		value := f.ctx.Lookup(path).Plain()
+		failed.Values[path] = value
+		values = append(values, strings.TrimPrefix(path, "$.")+"="+describeValue(value))
+	}
+	failed.Message = fmt.Sprintf("`%s` failed", clause)
+	if len(values) > 0 {
+		failed.Message += ": " + strings.Join(values, ", ")
+	}
+	f.failed = append(f.failed, failed)
+}
+
+func (f *failureExplainer) evaluate(node ast.Expression) (types.Value, error) {
+	return f.engine.evaluator.Evaluate(node, f.ctx)
+}
+
+// flattenLogical returns the operands of a chain of op, looking through
+// parentheses, such as a, b, and c for (a && b) && c.
+func flattenLogical(node ast.Expression, op string) []ast.Expression {
+	switch n := node.(type) {
+	case *ast.GroupedExpression:
+		return flattenLogical(n.Expression, op)
+	case *ast.BinaryExpression:
+		if logicalOperator(n.Operator) == op {
+			return append(flattenLogical(n.Left, op), flattenLogical(n.Right, op)...)
+		}
+	}
+	return []ast.Expression{node}
+}
+
+// describeValue formats a value for failure messages, as JSON where possible.
+func describeValue(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_ExplainFailure(t *testing.T) {
+	engine, err := New(WithOptimization(true))
+	require.NoError(t, err)
+
+	explain := func(dsl string, payload interface{}) []FailedClause {
+		t.Helper()
+		compiled, err := engine.Compile(dsl)
+		require.NoError(t, err)
+		failed, err := engine.ExplainFailure(compiled, payload)
+		require.NoError(t, err)
+		return failed
+	}
+	messages := func(failed []FailedClause) []string {
+		list := make([]string, len(failed))
+		for i, f := range failed {
+			list[i] = f.Message
+		}
+		return list
+	}
+
+	payload := map[string]interface{}{"age": 16, "country": "US", "verified": true, "tags": []interface{}{"new"}}
+
+	t.Run("and chain", func(t *testing.T) {
+		failed := explain(`$.verified == true AND $.age >= 18 && ($.country IN ["DE", "FR"])`, payload)
+		assert.Equal(t, []string{
+			"`$.age >= 18` failed: age=16",
+			"`$.country IN [\"DE\", \"FR\"]` failed: country=\"US\"",
+		}, messages(failed))
+		require.Len(t, failed, 2)
+		assert.Equal(t, "$.age >= 18", failed[0].Clause)
+		assert.Equal(t, 1, failed[0].Line)
+		assert.Equal(t, 24, failed[0].Column)
+		assert.Equal(t, map[string]interface{}{"$.age": int64(16)}, failed[0].Values)
+	})
+
+	t.Run("or chain", func(t *testing.T) {
+		failed := explain(`($.age >= 18 && $.verified) || "admin" IN $.tags`, payload)
+		assert.Equal(t, []string{
+			"`$.age >= 18` failed: age=16",
+			"`\"admin\" IN $.tags` failed: tags=[\"new\"]",
+		}, messages(failed))
+	})
+
+	t.Run("negation and missing paths", func(t *testing.T) {
+		failed := explain(`!$.verified && $.score == 10`, payload)
+		assert.Equal(t, []string{
+			"`!$.verified` failed: verified=true",
+			"`$.score == 10` failed: score=null",
+		}, messages(failed))
+	})
+
+	t.Run("clauses that fail to evaluate are skipped", func(t *testing.T) {
+		failed := explain(`$.age > 18 && $.age / 0 > 1`, payload)
+		assert.Equal(t, []string{"`$.age > 18` failed: age=16"}, messages(failed))
+	})
+
+	t.Run("match", func(t *testing.T) {
+		assert.Nil(t, explain(`$.age < 18`, payload))
+	})
+
+	t.Run("parameters", func(t *testing.T) {
+		compiled, err := engine.Compile(`$.age >= minAge`)
+		require.NoError(t, err)
+		bound, err := compiled.Bind(map[string]interface{}{"minAge": 21})
+		require.NoError(t, err)
+		failed, err := engine.ExplainFailure(bound, payload)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"`$.age >= minAge` failed: age=16"}, messages(failed))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		compiled, err := engine.Compile(`$.age / 0 > 1`)
+		require.NoError(t, err)
+		_, err = engine.ExplainFailure(compiled, payload)
+		assert.Error(t, err)
+	})
+}
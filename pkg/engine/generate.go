@@ -0,0 +1,582 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"encoding/json"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/typecheck"
+)
+
+// DefaultGenerateCount is the number of payloads of each kind returned by
+// GeneratePayloads unless GenerateCount is used.
+const DefaultGenerateCount = 5
+
+// DefaultGenerateAttempts is the number of candidate payloads evaluated by
+// GeneratePayloads unless GenerateAttempts is used.
+const DefaultGenerateAttempts = 1000
+
+// GenerateOption configures GeneratePayloads.
+type GenerateOption func(*generateConfig)
+
+type generateConfig struct {
+	count    int
+	attempts int
+	seed     int64
+	schema   []byte
+}
+
+// GenerateCount sets the maximum number of satisfying and of violating
+// payloads to return.
+func GenerateCount(n int) GenerateOption {
+	return func(c *generateConfig) {
+		c.count = n
+	}
+}
+
+// GenerateAttempts sets the maximum number of candidate payloads evaluated.
+func GenerateAttempts(n int) GenerateOption {
+	return func(c *generateConfig) {
+		c.attempts = n
+	}
+}
+
+// GenerateSeed sets the seed used to sample candidates when there are more
+// combinations than attempts. The same seed always gives the same payloads.
+func GenerateSeed(seed int64) GenerateOption {
+	return func(c *generateConfig) {
+		c.seed = seed
+	}
+}
+
+// GenerateSchema sets the JSON Schema describing the payload, instead of the
+// schema set with WithPayloadSchema. Its "type", "enum", "properties", and
+// "required" keywords shape the candidate values.
+func GenerateSchema(schema []byte) GenerateOption {
+	return func(c *generateConfig) {
+		c.schema = schema
+	}
+}
+
+// GeneratedPayloads holds sample payloads for an expression.
+type GeneratedPayloads struct {
+	Satisfying []map[string]interface{} `json:"satisfying"` // Payloads for which the expression is truthy
+	Violating  []map[string]interface{} `json:"violating"`  // Payloads for which it is falsy
+	Attempts   int                      `json:"attempts"`   // Candidate payloads evaluated
+}
+
+// GeneratePayloads produces sample payloads that satisfy and that violate an
+// expression, for authoring rules and fuzz-style testing of rule sets.
+//
+// Candidate values for each payload path are derived from the expression:
+// the literals paths are compared with and their neighbours, the elements of
+// IN lists and a value outside them, strings with and without the arguments
+// of startsWith, endsWith, and contains, and the literal prefixes of regex
+// patterns. Paths used as conditions also get true and false, paths without
+// candidates of their own get the values derived from every literal and zero,
+// and every path may be missing. Combinations of candidates are evaluated, and only payloads
+// that evaluate without error are returned, so every returned payload is
+// known to satisfy or violate the expression. Either list may be shorter than
+// requested, or empty, when no candidate combination reaches it.
+func (e *Engine) GeneratePayloads(dsl string, opts ...GenerateOption) (*GeneratedPayloads, error) {
+	cfg := generateConfig{count: DefaultGenerateCount, attempts: DefaultGenerateAttempts, seed: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var schema *typecheck.Schema
+	if e.payloadSchema != nil {
+		schema = e.payloadSchema.types
+	}
+	if len(cfg.schema) > 0 {
+		var err error
+		if schema, err = typecheck.ParseSchema(cfg.schema); err != nil {
+			return nil, err
+		}
+	}
+
+	compiled, err := e.Compile(dsl)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{candidates: make(map[string][]interface{})}
+	g.collect(compiled.AST, true)
+	paths := g.finish(schema)
+
+	result := &GeneratedPayloads{
+		Satisfying: []map[string]interface{}{},
+		Violating:  []map[string]interface{}{},
+	}
+	seen := make(map[string]bool)
+	try := func(choice []int) bool {
+		payload := g.payload(paths, choice, schema)
+		key, err := json.Marshal(payload)
+		if err != nil || seen[string(key)] {
+			return false
+		}
+		seen[string(key)] = true
+		result.Attempts++
+
+		value, err := e.Evaluate(compiled, payload)
+		switch {
+		case err != nil:
+		case e.IsTruthy(value) && len(result.Satisfying) < cfg.count:
+			result.Satisfying = append(result.Satisfying, payload)
+		case !e.IsTruthy(value) && len(result.Violating) < cfg.count:
+			result.Violating = append(result.Violating, payload)
+		}
+		return len(result.Satisfying) >= cfg.count && len(result.Violating) >= cfg.count
+	}
+
+	choice := make([]int, len(paths))
+	combinations := 1
+	for _, path := range paths {
+		combinations *= len(g.candidates[path])
+		if combinations > cfg.attempts {
+			break
+		}
+	}
+	if combinations <= cfg.attempts {
+		// Enumerate every combination, in mixed-radix order
+		for n := 0; n < combinations; n++ {
+			if try(choice) {
+				break
+			}
+			for i := len(paths) - 1; i >= 0; i-- {
+				choice[i]++
+				if choice[i] < len(g.candidates[paths[i]]) {
+					break
+				}
+				choice[i] = 0
+			}
+		}
+		return result, nil
+	}
+
+	rng := rand.New(rand.NewSource(cfg.seed))
+	for n := 0; n < cfg.attempts; n++ {
+		for i, path := range paths {
+			choice[i] = rng.Intn(len(g.candidates[path]))
+		}
+		if try(choice) {
+			break
+		}
+	}
+	return result, nil
+}
+
+// missing is the candidate of a path left out of the payload.
+type missing struct{}
+
+// generator collects candidate values for the payload paths of an expression.
+type generator struct {
+	candidates map[string][]interface{}
+	literals   []interface{} // Candidates derived from every literal, for paths without their own
+}
+
+// simplePath matches the payload paths that can be built as nested objects.
+var simplePath = regexp.MustCompile(`^\$(\.[A-Za-z_][A-Za-z0-9_]*)+$`)
+
+// pathOf returns the path of a JSONPath expression that generated payloads
+// can hold, or "".
+func pathOf(expr ast.Expression) string {
+	if p, ok := expr.(*ast.JSONPathExpression); ok && simplePath.MatchString(p.Path) {
+		return p.Path
+	}
+	return ""
+}
+
+// literalOf returns the value of a literal, including negative numbers.
+func literalOf(expr ast.Expression) (interface{}, bool) {
+	switch n := expr.(type) {
+	case *ast.IntegerLiteral:
+		return n.Value, true
+	case *ast.FloatLiteral:
+		return n.Value, true
+	case *ast.StringLiteral:
+		return n.Value, true
+	case *ast.BooleanLiteral:
+		return n.Value, true
+	case *ast.NullLiteral:
+		return nil, true
+	case *ast.GroupedExpression:
+		return literalOf(n.Expression)
+	case *ast.UnaryExpression:
+		if n.Operator == "-" {
+			switch v := n.Operand.(type) {
+			case *ast.IntegerLiteral:
+				return -v.Value, true
+			case *ast.FloatLiteral:
+				return -v.Value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (g *generator) add(path string, values ...interface{}) {
+	if path == "" {
+		return
+	}
+	g.candidates[path] = append(g.candidates[path], values...)
+}
+
+// neighbours returns a literal and values on either side of it.
+func neighbours(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case int64:
+		return []interface{}{v, v - 1, v + 1}
+	case float64:
+		return []interface{}{v, v - 1, v + 1}
+	case string:
+		if v == "" {
+			return []interface{}{v, "x"}
+		}
+		return []interface{}{v, v + "x", ""}
+	case bool:
+		return []interface{}{v, !v}
+	}
+	return []interface{}{v}
+}
+
+// collect walks an expression. condition reports whether the value of expr
+// is used as a condition.
+func (g *generator) collect(expr ast.Expression, condition bool) {
+	switch n := expr.(type) {
+	case *ast.JSONPathExpression:
+		path := pathOf(n)
+		if _, ok := g.candidates[path]; !ok && path != "" {
+			g.candidates[path] = nil
+		}
+		if condition {
+			g.add(path, true, false)
+		}
+
+	case *ast.GroupedExpression:
+		g.collect(n.Expression, condition)
+
+	case *ast.UnaryExpression:
+		g.collect(n.Operand, n.Operator == "!" || strings.EqualFold(n.Operator, "not"))
+
+	case *ast.BinaryExpression:
+		if logicalOperator(n.Operator) != "" {
+			g.collect(n.Left, true)
+			g.collect(n.Right, true)
+			return
+		}
+		for _, side := range [2][2]ast.Expression{{n.Left, n.Right}, {n.Right, n.Left}} {
+			if v, ok := literalOf(side[1]); ok {
+				values := neighbours(v)
+				g.add(pathOf(side[0]), values...)
+				g.literals = append(g.literals, values...)
+			}
+		}
+		g.collect(n.Left, false)
+		g.collect(n.Right, false)
+
+	case *ast.InExpression:
+		if list, ok := n.Right.(*ast.ListLiteral); ok {
+			var values []interface{}
+			for _, el := range list.Elements {
+				if v, ok := literalOf(el); ok {
+					values = append(values, v)
+				}
+			}
+			values = append(values, outside(values))
+			g.add(pathOf(n.Left), values...)
+			g.literals = append(g.literals, values...)
+		} else if v, ok := literalOf(n.Left); ok {
+			g.add(pathOf(n.Right), []interface{}{v}, []interface{}{})
+		}
+		g.collect(n.Left, false)
+		g.collect(n.Right, false)
+
+	case *ast.RegexExpression:
+		if lit, ok := n.Pattern.(*ast.StringLiteral); ok {
+			if re, err := regexp.Compile(lit.Value); err == nil {
+				prefix, _ := re.LiteralPrefix()
+				g.add(pathOf(n.Left), prefix, prefix+"x", "")
+			}
+		}
+		g.collect(n.Left, false)
+
+	case *ast.FunctionCall:
+		if len(n.Arguments) == 2 {
+			if s, ok := literalOf(n.Arguments[1]); ok {
+				if s, ok := s.(string); ok {
+					path := pathOf(n.Arguments[0])
+					switch n.Name {
+					case "startsWith":
+						g.add(path, s+"x", "x"+s)
+					case "endsWith":
+						g.add(path, "x"+s, s+"x")
+					case "contains":
+						g.add(path, "x"+s+"x", "x")
+					}
+				}
+			}
+		}
+		for _, arg := range n.Arguments {
+			g.collect(arg, false)
+		}
+
+	case *ast.ListLiteral:
+		for _, el := range n.Elements {
+			g.collect(el, false)
+		}
+
+	case *ast.MapLiteral:
+		for _, value := range n.Values {
+			g.collect(value, false)
+		}
+
+	case *ast.IndexExpression:
+		g.collect(n.Left, false)
+		g.collect(n.Index, false)
+
+	case *ast.ConditionalExpression:
+		g.collect(n.Condition, true)
+		g.collect(n.Consequence, condition)
+		g.collect(n.Alternative, condition)
+
+	case *ast.CaseExpression:
+		for i, cond := range n.Conditions {
+			g.collect(cond, true)
+			g.collect(n.Results[i], condition)
+		}
+		if n.Default != nil {
+			g.collect(n.Default, condition)
+		}
+
+	case *ast.SliceExpression:
+		g.collect(n.Left, false)
+		g.collect(n.Start, false)
+		g.collect(n.End, false)
+
+	case *ast.MemberExpression:
+		g.collect(n.Object, false)
+	}
+}
+
+// outside returns a value that is not in an IN list.
+func outside(values []interface{}) interface{} {
+	var strs, nums int
+	var max float64
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			strs++
+		case int64:
+			nums++
+			if float64(v) > max {
+				max = float64(v)
+			}
+		case float64:
+			nums++
+			if v > max {
+				max = v
+			}
+		}
+	}
+	if nums > strs {
+		return int64(max) + 1
+	}
+	candidate := "other"
+	for contains := true; contains; {
+		contains = false
+		for _, v := range values {
+			if v == candidate {
+				candidate += "x"
+				contains = true
+			}
+		}
+	}
+	return candidate
+}
+
+// finish completes the candidates of every path, applies the schema, and
+// returns the paths in a stable order.
+func (g *generator) finish(schema *typecheck.Schema) []string {
+	var paths []string
+	for path, values := range g.candidates {
+		if len(values) == 0 {
+			values = append(values, g.literals...)
+			values = append(values, int64(0))
+		}
+
+		required := false
+		if schema != nil {
+			node, _, _ := schema.Lookup(path)
+			required = schemaRequires(schema, path)
+			if node != nil {
+				values = schemaRestrict(node, values)
+			}
+		}
+		if !required {
+			values = append(values, missing{})
+		}
+		g.candidates[path] = dedupe(values)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func dedupe(values []interface{}) []interface{} {
+	seen := make(map[string]bool)
+	out := values[:0]
+	for _, v := range values {
+		key, _ := json.Marshal(v)
+		if _, ok := v.(missing); ok {
+			key = []byte("<missing>")
+		}
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// payload builds the payload for one choice of candidates, adding the values
+// of required schema properties the expression does not use.
+func (g *generator) payload(paths []string, choice []int, schema *typecheck.Schema) map[string]interface{} {
+	payload := schemaSample(schema)
+	for i, path := range paths {
+		value := g.candidates[path][choice[i]]
+		if _, ok := value.(missing); ok {
+			continue
+		}
+		node := payload
+		keys := strings.Split(strings.TrimPrefix(path, "$."), ".")
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := node[key].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[key] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = value
+	}
+	return payload
+}
+
+// schemaRequires reports whether the schema requires every segment of a
+// simple path.
+func schemaRequires(s *typecheck.Schema, path string) bool {
+	node := s
+	for _, key := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		found := false
+		for _, r := range node.Required {
+			if r == key {
+				found = true
+			}
+		}
+		if !found || node.Properties[key] == nil {
+			return false
+		}
+		node = node.Properties[key]
+	}
+	return true
+}
+
+// schemaRestrict keeps the candidates allowed by the schema. Enumerated values
+// replace the candidates; otherwise candidates of other types are dropped,
+// falling back to a sample value.
+func schemaRestrict(s *typecheck.Schema, values []interface{}) []interface{} {
+	if len(s.Enum) > 0 {
+		return append([]interface{}(nil), s.Enum...)
+	}
+	if len(s.Type) == 0 {
+		return values
+	}
+	var out []interface{}
+	for _, v := range values {
+		if schemaAllows(s, v) {
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, schemaSampleValue(s))
+	}
+	return out
+}
+
+// schemaAllows reports whether a candidate has one of the schema types.
+func schemaAllows(s *typecheck.Schema, v interface{}) bool {
+	for _, t := range s.Type {
+		switch v := v.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case int64:
+			if t == "integer" || t == "number" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && v == float64(int64(v))) {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// schemaSample returns an object holding sample values of the required
+// properties of the schema. It returns an empty object for a nil schema.
+func schemaSample(s *typecheck.Schema) map[string]interface{} {
+	out := make(map[string]interface{})
+	if s == nil {
+		return out
+	}
+	for _, key := range s.Required {
+		if prop := s.Properties[key]; prop != nil {
+			out[key] = schemaSampleValue(prop)
+		}
+	}
+	return out
+}
+
+// schemaSampleValue returns a value matching the schema.
+func schemaSampleValue(s *typecheck.Schema) interface{} {
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+	if len(s.Type) == 0 {
+		return nil
+	}
+	switch s.Type[0] {
+	case "integer":
+		return int64(0)
+	case "number":
+		return float64(0)
+	case "string":
+		return ""
+	case "boolean":
+		return false
+	case "array":
+		return []interface{}{}
+	case "object":
+		return schemaSample(s)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertGenerated checks that every generated payload has the expected outcome.
+func assertGenerated(t *testing.T, engine *Engine, dsl string, generated *GeneratedPayloads) {
+	t.Helper()
+	for _, payload := range generated.Satisfying {
+		ok, err := engine.EvaluateBool(mustCompile(t, engine, dsl), payload)
+		require.NoError(t, err)
+		assert.True(t, ok, "satisfying payload %v", payload)
+	}
+	for _, payload := range generated.Violating {
+		ok, err := engine.EvaluateBool(mustCompile(t, engine, dsl), payload)
+		require.NoError(t, err)
+		assert.False(t, ok, "violating payload %v", payload)
+	}
+}
+
+func mustCompile(t *testing.T, engine *Engine, dsl string) *CompiledExpression {
+	t.Helper()
+	compiled, err := engine.Compile(dsl)
+	require.NoError(t, err)
+	return compiled
+}
+
+func TestEngine_GeneratePayloads(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		dsl  string
+	}{
+		{"comparisons", `$.user.age >= 18 && $.order.total < 100.5`},
+		{"in list", `$.country IN ["DE", "FR"] || $.tier == "gold"`},
+		{"not in list", `$.status NOT IN [1, 2, 3]`},
+		{"string prefix", `startsWith($.sku, "EU-") && !endsWith($.sku, "-old")`},
+		{"membership", `"admin" IN $.roles`},
+		{"regex", `$.email =~ "^ops@"`},
+		{"conditions", `($.user.vip && $.total > 50) || $.total > 200`},
+		{"arithmetic", `$.a + $.b > 10`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generated, err := engine.GeneratePayloads(tt.dsl, GenerateCount(3))
+			require.NoError(t, err)
+			assert.NotEmpty(t, generated.Satisfying)
+			assert.NotEmpty(t, generated.Violating)
+			assert.LessOrEqual(t, len(generated.Satisfying), 3)
+			assertGenerated(t, engine, tt.dsl, generated)
+		})
+	}
+
+	t.Run("nested paths", func(t *testing.T) {
+		generated, err := engine.GeneratePayloads(`$.user.age >= 18`, GenerateCount(1))
+		require.NoError(t, err)
+		require.Len(t, generated.Satisfying, 1)
+		assert.Equal(t, map[string]interface{}{"user": map[string]interface{}{"age": int64(18)}}, generated.Satisfying[0])
+	})
+
+	t.Run("sampling is deterministic", func(t *testing.T) {
+		dsl := `$.a > 1 && $.b > 2 && $.c > 3 && $.d > 4 && $.e IN ["x", "y"]`
+		first, err := engine.GeneratePayloads(dsl, GenerateAttempts(50), GenerateSeed(7))
+		require.NoError(t, err)
+		second, err := engine.GeneratePayloads(dsl, GenerateAttempts(50), GenerateSeed(7))
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		assert.LessOrEqual(t, first.Attempts, 50)
+		assertGenerated(t, engine, dsl, first)
+	})
+
+	t.Run("schema", func(t *testing.T) {
+		schema := []byte(`{
+			"type": "object",
+			"required": ["plan", "id"],
+			"properties": {
+				"plan": {"type": "string", "enum": ["free", "pro", "enterprise"]},
+				"id": {"type": "string"},
+				"seats": {"type": "integer"}
+			}
+		}`)
+		generated, err := engine.GeneratePayloads(`$.plan != "free" && $.seats > 10`, GenerateSchema(schema))
+		require.NoError(t, err)
+		require.NotEmpty(t, generated.Satisfying)
+		for _, payload := range append(generated.Satisfying, generated.Violating...) {
+			assert.Contains(t, []interface{}{"free", "pro", "enterprise"}, payload["plan"])
+			assert.Equal(t, "", payload["id"], "required properties get sample values")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := engine.GeneratePayloads(`$.a >`)
+		assert.Error(t, err)
+		_, err = engine.GeneratePayloads(`$.a > 1`, GenerateSchema([]byte(`{`)))
+		assert.Error(t, err)
+	})
+}
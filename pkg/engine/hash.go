@@ -0,0 +1,45 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import "github.com/bencagri/amel/pkg/ast"
+
+// Hash returns the canonical hash of the expression, computed by ast.Hash
+// from its parsed AST. Expressions that differ only in formatting, operator
+// spelling, or the names of lambda parameters have the same hash, so it can
+// key caches, correlate audit records, and find duplicate rules. Unlike the
+// optimized AST it does not depend on the engine options.
+func (c *CompiledExpression) Hash() string {
+	if c.hash != "" {
+		return c.hash
+	}
+	return ast.Hash(c.AST)
+}
+
+// Duplicates returns the names of rules whose expressions have the same
+// canonical hash, one group per hash with at least two rules. Groups and the
+// names in them are in insertion order.
+func (rs *RuleSet) Duplicates() [][]string {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	groups := make(map[string]int)
+	var duplicates [][]string
+	for _, rule := range rs.rules {
+		hash := rule.Compiled.Hash()
+		i, ok := groups[hash]
+		if !ok {
+			groups[hash] = len(duplicates)
+			duplicates = append(duplicates, []string{rule.Name})
+			continue
+		}
+		duplicates[i] = append(duplicates[i], rule.Name)
+	}
+
+	result := duplicates[:0]
+	for _, names := range duplicates {
+		if len(names) > 1 {
+			result = append(result, names)
+		}
+	}
+	return result
+}
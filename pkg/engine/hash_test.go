@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompiledExpression_Hash(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	hash := func(dsl string) string {
+		t.Helper()
+		compiled, err := engine.Compile(dsl)
+		require.NoError(t, err)
+		return compiled.Hash()
+	}
+
+	equivalent := [][]string{
+		{`$.age >= 18 && $.role == "admin"`, `($.age>=18)  AND  ($.role == 'admin')`, `$.age >= 18 and $.role == "admin"`},
+		{`!$.active || $.x`, `NOT $.active OR $.x`, `not ($.active) or $.x`},
+		{`$.price > 1000.0`, `$.price > 1e3`},
+		{`$.price > 1.5`, `$.price > 1.50`, `$.price > 15e-1`},
+		{`$.x == null`, `$.x == nil`},
+		{`map($.items, x => x * 2)`, `map($.items, item => item * 2)`},
+	}
+	for _, group := range equivalent {
+		for _, dsl := range group[1:] {
+			assert.Equal(t, hash(group[0]), hash(dsl), "%s and %s", group[0], dsl)
+		}
+	}
+
+	different := []string{
+		`$.age >= 18 && $.role == "admin"`,
+		`$.role == "admin" && $.age >= 18`,
+		`$.age >= 18 || $.role == "admin"`,
+		`$.age > 18 && $.role == "admin"`,
+		`$.age >= 18.0 && $.role == "admin"`,
+		`$.age >= 18 && $.role == "Admin"`,
+		`$.age >= 18 && $.role != "admin"`,
+		`$.age >= 18 && $.roles IN ["admin"]`,
+		`$.age >= 18 && $.roles NOT IN ["admin"]`,
+		`map($.items, x => x * 2)`,
+		`map($.items, x => y * 2)`,
+	}
+	seen := make(map[string]string)
+	for _, dsl := range different {
+		h := hash(dsl)
+		assert.True(t, strings.HasPrefix(h, "sha256:"))
+		if other, ok := seen[h]; ok {
+			t.Errorf("%s and %s have the same hash", other, dsl)
+		}
+		seen[h] = dsl
+	}
+
+	t.Run("serialization", func(t *testing.T) {
+		compiled, err := engine.Compile(`$.age >= 18 AND $.role == "admin"`)
+		require.NoError(t, err)
+		data, err := compiled.MarshalBinary()
+		require.NoError(t, err)
+		loaded, err := engine.LoadCompiled(data)
+		require.NoError(t, err)
+		assert.Equal(t, compiled.Hash(), loaded.Hash())
+
+		bare := &CompiledExpression{AST: compiled.AST}
+		assert.Equal(t, compiled.Hash(), bare.Hash())
+	})
+}
+
+func TestRuleSet_Duplicates(t *testing.T) {
+	rs := newTestRuleSet(t)
+	assert.Empty(t, rs.Duplicates())
+
+	require.NoError(t, rs.Add("grown-up", "($.age>=18)"))
+	require.NoError(t, rs.Add("administrator", `$.role == 'admin'`))
+	require.NoError(t, rs.Add("adult-again", "$.age >= 18"))
+	assert.Equal(t, [][]string{
+		{"adult", "grown-up", "adult-again"},
+		{"admin", "administrator"},
+	}, rs.Duplicates())
+}
+
+func TestWithAuditSink_CanonicalHash(t *testing.T) {
+	var records []*AuditRecord
+	engine, err := New(WithAuditSink(AuditSinkFunc(func(r *AuditRecord) {
+		records = append(records, r)
+	})))
+	require.NoError(t, err)
+
+	_, err = engine.EvaluateDirect(`$.a > 1 && $.b`, `{"a": 2, "b": true}`)
+	require.NoError(t, err)
+	_, err = engine.EvaluateDirect(`$.a > 1 AND $.b`, `{"a": 2, "b": true}`)
+	require.NoError(t, err)
+
+	require.Len(t, records, 2)
+	assert.NotEqual(t, records[0].ExpressionHash, records[1].ExpressionHash)
+	assert.NotEmpty(t, records[0].CanonicalHash)
+	assert.Equal(t, records[0].CanonicalHash, records[1].CanonicalHash)
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_WithHTTPGetJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"minAge": 18}`))
+	}))
+	defer server.Close()
+
+	payload := map[string]interface{}{"age": 21, "url": server.URL + "/config.json"}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		engine, err := New()
+		require.NoError(t, err)
+		assert.False(t, engine.GetFunctionRegistry().Has(functions.HTTPGetJSONName))
+	})
+
+	engine, err := New(
+		WithTimeout(time.Second),
+		WithHTTPGetJSON(functions.HTTPConfig{
+			AllowedHosts: []string{strings.TrimPrefix(server.URL, "http://")},
+		}),
+	)
+	require.NoError(t, err)
+
+	ok, err := engine.EvaluateDirectBool(`$.age >= httpGetJSON($.url).minAge`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = engine.EvaluateDirectBool(`httpGetJSON("http://169.254.169.254/latest/meta-data") != null`, payload)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrFunctionDenied), err.Error())
+
+	tenant, err := engine.ForTenant("t1")
+	require.NoError(t, err)
+	ok, err = tenant.EvaluateDirectBool(`$.age >= httpGetJSON($.url).minAge`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,220 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/ast"
+)
+
+// DefaultImpactExamples is the number of example records kept per change
+// direction by Impact unless ImpactExamples is used.
+const DefaultImpactExamples = 5
+
+// ImpactOption configures Impact.
+type ImpactOption func(*impactConfig)
+
+type impactConfig struct {
+	baseline string
+	examples int
+}
+
+// ImpactBaseline compares the rule with the version currently in use, so the
+// report lists the records the change starts and stops matching.
+func ImpactBaseline(dsl string) ImpactOption {
+	return func(c *impactConfig) {
+		c.baseline = dsl
+	}
+}
+
+// ImpactExamples sets the maximum number of example records kept for newly
+// matching and no longer matching records. Zero keeps none; the counts are
+// always complete.
+func ImpactExamples(n int) ImpactOption {
+	return func(c *impactConfig) {
+		c.examples = n
+	}
+}
+
+// ImpactExample is a record whose match changed between the baseline and the
+// rule.
+type ImpactExample struct {
+	Index   int         `json:"index"` // Position of the payload in the corpus
+	Payload interface{} `json:"payload"`
+}
+
+// ClauseImpact reports how selective one top-level clause of the rule is.
+type ClauseImpact struct {
+	Clause      string  `json:"clause"`
+	Matched     int     `json:"matched"` // Records for which the clause is truthy
+	Errors      int     `json:"errors"`
+	Selectivity float64 `json:"selectivity"` // Matched divided by the corpus size
+}
+
+// ImpactReport summarizes the evaluation of a rule over a corpus of payloads.
+type ImpactReport struct {
+	Rule      string  `json:"rule"`
+	Total     int     `json:"total"`
+	Matched   int     `json:"matched"`
+	Errors    int     `json:"errors"` // Records that failed to evaluate; they do not match
+	MatchRate float64 `json:"matchRate"`
+
+	// Set only with ImpactBaseline
+	Baseline          string          `json:"baseline,omitempty"`
+	BaselineMatched   int             `json:"baselineMatched,omitempty"`
+	BaselineMatchRate float64         `json:"baselineMatchRate,omitempty"`
+	NewlyMatched      int             `json:"newlyMatched,omitempty"`
+	NoLongerMatched   int             `json:"noLongerMatched,omitempty"`
+	NewlyMatching     []ImpactExample `json:"newlyMatching,omitempty"`
+	NoLongerMatching  []ImpactExample `json:"noLongerMatching,omitempty"`
+
+	// Clauses lists the operands of the top-level && or || chain of the rule,
+	// in order. It is empty if the rule is a single clause.
+	Clauses []ClauseImpact `json:"clauses,omitempty"`
+}
+
+// Impact evaluates a rule over a corpus of payloads, such as historical
+// events, and reports its match rate and the selectivity of each of its
+// top-level clauses. With ImpactBaseline it also reports the records a rule
+// change starts and stops matching, with examples. A record matches if the
+// rule is truthy; records that fail to evaluate are counted as errors and do
+// not match. An error is returned only if an expression does not compile.
+func (e *Engine) Impact(rule string, payloads []interface{}, opts ...ImpactOption) (*ImpactReport, error) {
+	cfg := impactConfig{examples: DefaultImpactExamples}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	expr, err := e.Compile(rule)
+	if err != nil {
+		return nil, err
+	}
+	var baseline *CompiledExpression
+	if cfg.baseline != "" {
+		if baseline, err = e.Compile(cfg.baseline); err != nil {
+			return nil, fmt.Errorf("baseline expression: %w", err)
+		}
+	}
+
+	report := &ImpactReport{Rule: rule, Baseline: cfg.baseline}
+	clauses := e.impactClauses(expr.AST)
+	for _, clause := range clauses {
+		report.Clauses = append(report.Clauses, ClauseImpact{Clause: clause.Source})
+	}
+
+	for i, payload := range payloads {
+		report.Total++
+		ctx, err := e.newContext(payload)
+		if err != nil {
+			report.Errors++
+			for j := range report.Clauses {
+				report.Clauses[j].Errors++
+			}
+			continue
+		}
+
+		value, err := e.evaluateContext(expr, ctx, "")
+		matched := err == nil && e.IsTruthy(value)
+		if err != nil {
+			report.Errors++
+		} else if matched {
+			report.Matched++
+		}
+
+		for j, clause := range clauses {
+			value, _, err := e.evaluateRaw(clause, ctx, false)
+			switch {
+			case err != nil:
+				report.Clauses[j].Errors++
+			case e.IsTruthy(value):
+				report.Clauses[j].Matched++
+			}
+		}
+
+		if baseline == nil {
+			continue
+		}
+		value, err = e.evaluateContext(baseline, ctx, "")
+		was := err == nil && e.IsTruthy(value)
+		if was {
+			report.BaselineMatched++
+		}
+		switch {
+		case matched && !was:
+			report.NewlyMatched++
+			if len(report.NewlyMatching) < cfg.examples {
+				report.NewlyMatching = append(report.NewlyMatching, ImpactExample{Index: i, Payload: payload})
+			}
+		case was && !matched:
+			report.NoLongerMatched++
+			if len(report.NoLongerMatching) < cfg.examples {
+				report.NoLongerMatching = append(report.NoLongerMatching, ImpactExample{Index: i, Payload: payload})
+			}
+		}
+	}
+
+	if report.Total > 0 {
+		total := float64(report.Total)
+		report.MatchRate = float64(report.Matched) / total
+		report.BaselineMatchRate = float64(report.BaselineMatched) / total
+		for j := range report.Clauses {
+			report.Clauses[j].Selectivity = float64(report.Clauses[j].Matched) / total
+		}
+	}
+	return report, nil
+}
+
+// impactClauses splits a rule into the operands of its top-level && or ||
+// chain, compiled individually. It returns nil for a single clause.
+func (e *Engine) impactClauses(expr ast.Expression) []*CompiledExpression {
+	for {
+		grouped, ok := expr.(*ast.GroupedExpression)
+		if !ok {
+			break
+		}
+		expr = grouped.Expression
+	}
+	root, ok := expr.(*ast.BinaryExpression)
+	if !ok {
+		return nil
+	}
+	op := logicalOperator(root.Operator)
+	if op == "" {
+		return nil
+	}
+
+	var operands []ast.Expression
+	var flatten func(ast.Expression)
+	flatten = func(node ast.Expression) {
+		if bin, ok := node.(*ast.BinaryExpression); ok && logicalOperator(bin.Operator) == op {
+			flatten(bin.Left)
+			flatten(bin.Right)
+			return
+		}
+		operands = append(operands, node)
+	}
+	flatten(root)
+
+	clauses := make([]*CompiledExpression, len(operands))
+	for i, operand := range operands {
+		optimized := operand
+		if e.optimizer != nil {
+			optimized = e.optimizer.Optimize(operand)
+		}
+		clauses[i] = &CompiledExpression{AST: operand, Optimized: optimized, Source: operand.String()}
+	}
+	return clauses
+}
+
+// logicalOperator normalizes the spellings of && and ||, returning "" for
+// other operators.
+func logicalOperator(op string) string {
+	switch strings.ToLower(op) {
+	case "&&", "and":
+		return "&&"
+	case "||", "or":
+		return "||"
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Impact(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	corpus := []interface{}{
+		map[string]interface{}{"amount": 50, "country": "DE"},
+		map[string]interface{}{"amount": 150, "country": "DE"},
+		map[string]interface{}{"amount": 250, "country": "US"},
+		map[string]interface{}{"amount": 800, "country": "DE"},
+		map[string]interface{}{"amount": "n/a", "country": "FR"},
+	}
+
+	t.Run("match rate and clauses", func(t *testing.T) {
+		report, err := engine.Impact(`$.amount > 100 && ($.country == "DE" || $.country == "FR")`, corpus)
+		require.NoError(t, err)
+		assert.Equal(t, 5, report.Total)
+		assert.Equal(t, 2, report.Matched)
+		assert.Equal(t, 1, report.Errors)
+		assert.InDelta(t, 0.4, report.MatchRate, 0.001)
+
+		require.Len(t, report.Clauses, 2)
+		assert.Equal(t, ClauseImpact{Clause: "($.amount > 100)", Matched: 3, Errors: 1, Selectivity: 0.6}, report.Clauses[0])
+		assert.Equal(t, 4, report.Clauses[1].Matched)
+		assert.InDelta(t, 0.8, report.Clauses[1].Selectivity, 0.001)
+	})
+
+	t.Run("baseline", func(t *testing.T) {
+		report, err := engine.Impact(`$.amount > 200`, corpus, ImpactBaseline(`$.amount > 100 && $.country == "DE"`), ImpactExamples(1))
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Matched)
+		assert.Equal(t, 2, report.BaselineMatched)
+		assert.Equal(t, 1, report.NewlyMatched)
+		assert.Equal(t, 1, report.NoLongerMatched)
+		assert.Equal(t, []ImpactExample{{Index: 2, Payload: corpus[2]}}, report.NewlyMatching)
+		assert.Equal(t, []ImpactExample{{Index: 1, Payload: corpus[1]}}, report.NoLongerMatching)
+		assert.Empty(t, report.Clauses, "single clause")
+
+		data, err := json.Marshal(report)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"newlyMatching":[{"index":2,"payload":{"amount":250,"country":"US"}}]`)
+	})
+
+	t.Run("compile errors", func(t *testing.T) {
+		_, err := engine.Impact(`$.amount >`, corpus)
+		assert.Error(t, err)
+		_, err = engine.Impact(`$.amount > 1`, corpus, ImpactBaseline(`(`))
+		assert.ErrorContains(t, err, "baseline expression")
+	})
+}
@@ -0,0 +1,55 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"encoding/json"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+)
+
+// ExportJSFunctions encodes the user-defined JavaScript functions of the
+// engine, with their names and signatures, as a JSON catalog that
+// ImportJSFunctions can load into another engine. Functions are sorted by
+// name, so exporting the same functions always produces the same document.
+func (e *Engine) ExportJSFunctions() ([]byte, error) {
+	return json.MarshalIndent(e.functions.ExportJSFunctions(), "", "  ")
+}
+
+// ImportJSFunctions registers the functions of a catalog written by
+// ExportJSFunctions. Functions already registered with the same source are
+// skipped. If a function is invalid or its name is taken by a different
+// function nothing is registered. It fails if JavaScript functions are
+// disabled.
+func (e *Engine) ImportJSFunctions(data []byte) error {
+	if e.sandbox == nil {
+		return errors.New(errors.ErrSandboxViolation, "JavaScript functions are disabled")
+	}
+
+	var catalog functions.JSCatalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return errors.Wrap(errors.ErrInvalidSyntax, "invalid JS function catalog", err)
+	}
+	return e.functions.ImportJSFunctions(catalog)
+}
+
+// RegisterJSModule registers a JavaScript module that JavaScript functions
+// can load with require(name). The source assigns its exports to
+// module.exports, as in CommonJS. The bundled @amel/helpers module is always
+// available. It fails if JavaScript functions are disabled.
+func (e *Engine) RegisterJSModule(name, source string) error {
+	if e.sandbox == nil {
+		return errors.New(errors.ErrSandboxViolation, "JavaScript functions are disabled")
+	}
+	return e.sandbox.RegisterModule(name, source)
+}
+
+// ResetJSState deletes the persistent state JavaScript functions keep in
+// amel.state, which is enabled by SandboxConfig.StateLimit. Tenant engines
+// have their own state. It does nothing if JavaScript functions are
+// disabled.
+func (e *Engine) ResetJSState() {
+	if e.sandbox != nil {
+		e.sandbox.ResetState()
+	}
+}
@@ -0,0 +1,281 @@
+package engine
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_WithJSFunctionsDisabled(t *testing.T) {
+	engine, err := New(
+		WithSandboxConfig(functions.DefaultSandboxConfig()),
+		WithJSFunctions(false),
+	)
+	require.NoError(t, err)
+	assert.Nil(t, engine.GetSandbox())
+
+	err = engine.RegisterFunction(`function double(x) { return x * 2; }`)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrSandboxViolation))
+	assert.False(t, engine.GetFunctionRegistry().Has("double"))
+
+	resp := engine.EvaluateRequest(&EvalRequest{
+		DSL:       `double(2) == 4`,
+		Functions: []string{`function double(x) { return x * 2; }`},
+	})
+	assert.Equal(t, int(errors.ErrSandboxViolation), resp.ErrorCode)
+
+	ok, err := engine.EvaluateDirectBool(`upper($.name) == "AMEL"`, map[string]interface{}{"name": "amel"})
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Zero(t, engine.Stats().Sandbox)
+
+	tenant, err := engine.ForTenant("t1")
+	require.NoError(t, err)
+	assert.Nil(t, tenant.GetSandbox())
+}
+
+func TestEngine_WithJSFunctionsRejectsJSRegistry(t *testing.T) {
+	registry, err := functions.NewDefaultRegistry()
+	require.NoError(t, err)
+	require.NoError(t, registry.RegisterJSFunction(`function double(x) { return x * 2; }`, functions.NewSandbox(nil)))
+
+	_, err = New(WithFunctions(registry), WithJSFunctions(false))
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrSandboxViolation))
+	assert.Contains(t, err.Error(), "double")
+}
+
+func TestEngine_ExportImportJSFunctions(t *testing.T) {
+	source, err := New()
+	require.NoError(t, err)
+	require.NoError(t, source.RegisterFunction(`function double(x) { return x * 2; }`))
+	require.NoError(t, source.RegisterFunction(`function greet(first, last) { return "Hi " + first + " " + last; }`))
+
+	data, err := source.ExportJSFunctions()
+	require.NoError(t, err)
+
+	var catalog functions.JSCatalog
+	require.NoError(t, json.Unmarshal(data, &catalog))
+	assert.Equal(t, functions.JSCatalogVersion, catalog.Version)
+	require.Len(t, catalog.Functions, 2)
+	assert.Equal(t, "double", catalog.Functions[0].Name)
+	assert.Equal(t, "any", catalog.Functions[0].ReturnType)
+	assert.Equal(t, []string{"first", "last"}, catalog.Functions[1].Params)
+
+	replica, err := New()
+	require.NoError(t, err)
+	require.NoError(t, replica.ImportJSFunctions(data))
+	ok, err := replica.EvaluateDirectBool(`double(21) == 42 && greet("Ada", "L") == "Hi Ada L"`, map[string]interface{}{})
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	t.Run("import is idempotent", func(t *testing.T) {
+		require.NoError(t, replica.ImportJSFunctions(data))
+		again, err := replica.ExportJSFunctions()
+		require.NoError(t, err)
+		assert.Equal(t, string(data), string(again))
+	})
+
+	t.Run("conflicts register nothing", func(t *testing.T) {
+		target, err := New()
+		require.NoError(t, err)
+		require.NoError(t, target.RegisterFunction(`function greet(name) { return "Hello " + name; }`))
+
+		err = target.ImportJSFunctions(data)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "function 'greet' is already registered")
+		assert.False(t, target.GetFunctionRegistry().Has("double"))
+	})
+
+	t.Run("signature must match the source", func(t *testing.T) {
+		tampered := catalog
+		tampered.Functions = []functions.JSFunctionDef{catalog.Functions[0]}
+		tampered.Functions[0].Params = []string{"x", "y"}
+		doc, err := json.Marshal(tampered)
+		require.NoError(t, err)
+
+		target, err := New()
+		require.NoError(t, err)
+		err = target.ImportJSFunctions(doc)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not match its source")
+	})
+
+	t.Run("invalid documents", func(t *testing.T) {
+		target, err := New()
+		require.NoError(t, err)
+		assert.True(t, errors.IsCode(target.ImportJSFunctions([]byte("{")), errors.ErrInvalidSyntax))
+		assert.Error(t, target.ImportJSFunctions([]byte(`{"version": 99, "functions": []}`)))
+
+		disabled, err := New(WithJSFunctions(false))
+		require.NoError(t, err)
+		assert.True(t, errors.IsCode(disabled.ImportJSFunctions(data), errors.ErrSandboxViolation))
+	})
+}
+
+func TestEngine_ModernJSFunctions(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterFunction(`const greet = async (name: string, greeting = "Hi"): Promise<string> => `+"`${greeting} ${name}`"))
+	require.NoError(t, engine.RegisterFunction(`function area(w, h): int { return w * h; }`))
+
+	ok, err := engine.EvaluateDirectBool(`greet($.name) == "Hi Ada" && greet($.name, "Hello") == "Hello Ada" && area(2, 3) == 6`,
+		map[string]interface{}{"name": "Ada"})
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = engine.Compile(`greet()`)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrArgumentCount))
+	assert.Contains(t, err.Error(), "expects 1 to 2 arguments")
+}
+
+func TestEngine_RegisterJSModule(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterJSModule("money", `
+		const h = require("@amel/helpers");
+		exports.total = (items) => Math.round(h.sumBy(items, "price") * 100) / 100;
+	`))
+	require.NoError(t, engine.RegisterFunction(`function cartTotal(items): float { return require("money").total(items); }`))
+
+	payload := map[string]interface{}{"items": []interface{}{
+		map[string]interface{}{"price": 1.105}, map[string]interface{}{"price": 2.2},
+	}}
+	for i := 0; i < 2; i++ {
+		result, err := engine.EvaluateDirect(`cartTotal($.items)`, payload)
+		require.NoError(t, err)
+		assert.Equal(t, 3.31, result.Raw)
+	}
+
+	t.Run("tenants inherit modules", func(t *testing.T) {
+		tenant, err := engine.ForTenant("acme")
+		require.NoError(t, err)
+		require.NoError(t, tenant.RegisterJSModule("money", `exports.total = () => 0;`))
+
+		result, err := tenant.EvaluateDirect(`cartTotal($.items)`, payload)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), result.Raw)
+		result, err = engine.EvaluateDirect(`cartTotal($.items)`, payload)
+		require.NoError(t, err)
+		assert.Equal(t, 3.31, result.Raw)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Error(t, engine.RegisterJSModule("@amel/helpers", `exports.x = 1;`))
+		assert.Error(t, engine.RegisterJSModule("bad name", `exports.x = 1;`))
+		assert.Error(t, engine.RegisterJSModule("broken", `exports.x = ;`))
+
+		disabled, err := New(WithJSFunctions(false))
+		require.NoError(t, err)
+		err = disabled.RegisterJSModule("money", `exports.x = 1;`)
+		assert.True(t, errors.IsCode(err, errors.ErrSandboxViolation))
+	})
+}
+
+func TestEngine_ConsoleLogger(t *testing.T) {
+	var mu sync.Mutex
+	var logged []functions.ConsoleEntry
+	engine, err := New(WithConsoleLogger(func(entry functions.ConsoleEntry) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, entry)
+	}))
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterFunction(`function userScore(user) {
+		console.log("scoring", user.name, {age: user.age});
+		if (user.age < 18) console.warn("minor");
+		return user.age * 2;
+	}`))
+
+	payload := map[string]interface{}{"user": map[string]interface{}{"name": "Ada", "age": 17}}
+	ok, err := engine.EvaluateDirectBool(`userScore($.user) > 30`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []functions.ConsoleEntry{
+		{Function: "userScore", Level: "log", Message: `scoring Ada {"age":17}`},
+		{Function: "userScore", Level: "warn", Message: "minor"},
+	}, logged)
+
+	t.Run("explanation", func(t *testing.T) {
+		logged = nil
+		compiled, err := engine.Compile(`userScore($.user) > 30 && userScore($.user) < 40`)
+		require.NoError(t, err)
+		_, explanation, err := engine.EvaluateWithExplanation(compiled, payload)
+		require.NoError(t, err)
+		require.Len(t, explanation.Console, 4, "subexpressions explained again do not log twice")
+		assert.Equal(t, "minor", explanation.Console[3].Message)
+		assert.Len(t, logged, 4)
+		for _, child := range explanation.Children {
+			assert.Empty(t, child.Console)
+		}
+	})
+
+	t.Run("without logger", func(t *testing.T) {
+		plain, err := New(WithExplainMode(true))
+		require.NoError(t, err)
+		require.NoError(t, plain.RegisterFunction(`function hello() { console.error("oops"); return 1; }`))
+		resp := plain.EvaluateRequest(&EvalRequest{DSL: `hello() == 1`, Payload: map[string]interface{}{}})
+		require.Empty(t, resp.Error)
+		require.NotNil(t, resp.Explanation)
+		assert.Equal(t, []functions.ConsoleEntry{{Function: "hello", Level: "error", Message: "oops"}}, resp.Explanation.Console)
+	})
+}
+
+func TestEngine_JSState(t *testing.T) {
+	config := &functions.SandboxConfig{Timeout: time.Second, MaxStackDepth: 100, StateLimit: 1024}
+	engine, err := New(WithSandboxConfig(config))
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterFunction(`function tier(id) {
+		const key = "tier:" + id;
+		if (!amel.state.has(key)) {
+			amel.state.set("misses", amel.state.get("misses", 0) + 1);
+			amel.state.set(key, id.startsWith("vip") ? "gold" : "basic");
+		}
+		return amel.state.get(key);
+	}`))
+	require.NoError(t, engine.RegisterFunction(`function misses() { return amel.state.get("misses", 0); }`))
+
+	for i := 0; i < 3; i++ {
+		ok, err := engine.EvaluateDirectBool(`tier($.id) == "gold"`, map[string]interface{}{"id": "vip-1"})
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	result, err := engine.EvaluateDirect(`misses()`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Raw)
+
+	tenant, err := engine.ForTenant("acme")
+	require.NoError(t, err)
+	result, err = tenant.EvaluateDirect(`misses()`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), result.Raw, "tenants have their own state")
+
+	engine.ResetJSState()
+	result, err = engine.EvaluateDirect(`misses()`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), result.Raw)
+}
+
+func TestEngine_JSPayloadAccess(t *testing.T) {
+	engine, err := New(WithSandboxConfig(&functions.SandboxConfig{Timeout: time.Second, MaxStackDepth: 100, PayloadAccess: true}))
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterFunction(`function isAdult(): bool { return amel.path("user.age") >= amel.payload.minAge; }`))
+	require.NoError(t, engine.RegisterFunction(`function itemPrice() { return amel.variable("item").price; }`))
+
+	payload := map[string]interface{}{
+		"minAge": 18,
+		"user":   map[string]interface{}{"age": 21},
+		"items":  []interface{}{map[string]interface{}{"price": 2}, map[string]interface{}{"price": 3}},
+	}
+	ok, err := engine.EvaluateDirectBool(`isAdult() && sum(map($.items, item => itemPrice())) == 5`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
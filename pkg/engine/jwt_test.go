@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_JWT(t *testing.T) {
+	token := func(claims, secret string) string {
+		signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte(claims))
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+	rule := `jwtValid($.headers.authorization, "gateway") && jwtClaims($.headers.authorization).role == "admin"`
+	request := func(authorization string) map[string]interface{} {
+		return map[string]interface{}{"headers": map[string]interface{}{"authorization": authorization}}
+	}
+
+	engine, err := New(WithJWTKeys("gateway", functions.JWTSecret([]byte("secret"))))
+	require.NoError(t, err)
+
+	result, err := engine.EvaluateDirect(rule, request("Bearer "+token(`{"sub":"alice","role":"admin"}`, "secret")))
+	require.NoError(t, err)
+	assert.Equal(t, true, result.Raw)
+
+	result, err = engine.EvaluateDirect(rule, request("Bearer "+token(`{"sub":"bob","role":"viewer"}`, "secret")))
+	require.NoError(t, err)
+	assert.Equal(t, false, result.Raw)
+
+	result, err = engine.EvaluateDirect(rule, request("Bearer "+token(`{"sub":"mallory","role":"admin"}`, "guessed")))
+	require.NoError(t, err)
+	assert.Equal(t, false, result.Raw, "forged tokens are rejected")
+
+	t.Run("claims without keys", func(t *testing.T) {
+		plain, err := New()
+		require.NoError(t, err)
+
+		result, err := plain.EvaluateDirect(`jwtClaims($.headers.authorization).sub`, request(token(`{"sub":"alice"}`, "secret")))
+		require.NoError(t, err)
+		assert.Equal(t, "alice", result.Raw)
+
+		_, err = plain.EvaluateDirect(rule, request(token(`{"sub":"alice"}`, "secret")))
+		assert.ErrorContains(t, err, `no JWT keys named "gateway"`, "other engines have no keys")
+	})
+}
@@ -0,0 +1,160 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/eval"
+)
+
+// Limits restricts the evaluation of a single compiled expression. A positive
+// Timeout, MaxIterations, or MaxCalls overrides the engine default, and
+// MaxCallsPerFunction overrides the engine limits of the functions it lists;
+// a non-nil Functions list is the set of functions the expression may call.
+type Limits = eval.Limits
+
+// WithMaxIterations sets the default iteration budget of an evaluation: the
+// total number of times higher-order functions such as map, filter, and
+// reduce may apply their lambda. Zero or less means no limit, the default.
+// Evaluations over budget fail with ErrIterationLimit.
+func WithMaxIterations(n int) Option {
+	return func(e *Engine) {
+		e.maxIterations = n
+	}
+}
+
+// WithMaxCalls sets the default function call budget of an evaluation: the
+// total number of function calls, including calls inside lambdas. Zero or
+// less means no limit, the default. Evaluations over budget fail with
+// ErrCallBudget.
+func WithMaxCalls(n int) Option {
+	return func(e *Engine) {
+		e.maxCalls = n
+	}
+}
+
+// WithMaxDepth sets the maximum nesting depth of expressions: the number of
+// operators, calls, groups, and lambdas nested inside each other. Deeper
+// expressions fail to compile, and evaluations recursing deeper fail, with
+// ErrDepthLimit instead of exhausting the stack. Zero or less means no limit.
+// The default is parser.DefaultMaxDepth.
+func WithMaxDepth(n int) Option {
+	return func(e *Engine) {
+		e.maxDepth = n
+	}
+}
+
+// WithFunctionCallLimit limits how many times one evaluation may call the
+// named function, to contain rules that call an expensive function, such as
+// an external lookup, in a loop. Evaluations over the limit fail with
+// ErrCallBudget.
+func WithFunctionCallLimit(name string, n int) Option {
+	return func(e *Engine) {
+		if e.callLimits == nil {
+			e.callLimits = make(map[string]int)
+		}
+		e.callLimits[name] = n
+	}
+}
+
+// ClampLimits returns the requested limits lowered to at most the engine
+// defaults set with WithTimeout, WithMaxIterations, WithMaxCalls, and
+// WithFunctionCallLimit, so that limits from untrusted callers, such as
+// clients of an HTTP API, can only tighten an evaluation. Zero fields keep
+// the engine defaults; the function allowlist is kept as is.
+func (e *Engine) ClampLimits(requested Limits) Limits {
+	clamped := requested
+	clamped.Timeout = time.Duration(clampLimit(int64(e.timeout), int64(requested.Timeout)))
+	clamped.MaxIterations = int(clampLimit(int64(e.maxIterations), int64(requested.MaxIterations)))
+	clamped.MaxCalls = int(clampLimit(int64(e.maxCalls), int64(requested.MaxCalls)))
+	if requested.MaxCallsPerFunction != nil {
+		clamped.MaxCallsPerFunction = make(map[string]int, len(requested.MaxCallsPerFunction))
+		for name, n := range requested.MaxCallsPerFunction {
+			if limit, ok := e.callLimits[name]; ok && n > limit {
+				n = limit
+			}
+			clamped.MaxCallsPerFunction[name] = n
+		}
+	}
+	return clamped
+}
+
+// clampLimit returns a requested budget lowered to the engine default, where
+// zero or less means the default for requested and no limit for def.
+func clampLimit(def, requested int64) int64 {
+	if requested <= 0 {
+		return 0
+	}
+	if def > 0 && requested > def {
+		return def
+	}
+	return requested
+}
+
+// WithLimits returns a copy of the compiled expression that is evaluated with
+// the given limits instead of the engine defaults, so one expensive rule can
+// get a longer timeout without raising it for every expression. The original
+// expression, which may be shared through the compile cache, is unchanged.
+//
+// If limits.Functions is not nil it must list every function the expression
+// calls, including higher-order functions such as map; otherwise an error with
+// code ErrFunctionDenied is returned.
+func (c *CompiledExpression) WithLimits(limits Limits) (*CompiledExpression, error) {
+	if limits.Functions != nil {
+		limits.Functions = append([]string{}, limits.Functions...)
+		if err := checkAllowedFunctions(c.AST, limits.Functions); err != nil {
+			return nil, err
+		}
+	}
+	limits.MaxCallsPerFunction = copyCallLimits(limits.MaxCallsPerFunction)
+
+	copied := *c
+	copied.limits = &limits
+	return &copied, nil
+}
+
+// Limits returns the limits set with WithLimits. All fields are zero if the
+// expression uses the engine defaults.
+func (c *CompiledExpression) Limits() Limits {
+	if c.limits == nil {
+		return Limits{}
+	}
+	limits := *c.limits
+	if limits.Functions != nil {
+		limits.Functions = append([]string{}, limits.Functions...)
+	}
+	limits.MaxCallsPerFunction = copyCallLimits(limits.MaxCallsPerFunction)
+	return limits
+}
+
+func copyCallLimits(limits map[string]int) map[string]int {
+	if limits == nil {
+		return nil
+	}
+	copied := make(map[string]int, len(limits))
+	for name, n := range limits {
+		copied[name] = n
+	}
+	return copied
+}
+
+// checkAllowedFunctions returns an error for the first function called by expr
+// that is not in allowed.
+func checkAllowedFunctions(expr ast.Expression, allowed []string) error {
+	set := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		set[name] = true
+	}
+
+	var err error
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		if call, ok := node.(*ast.FunctionCall); ok && err == nil && !set[call.Name] {
+			err = errors.NewAtf(errors.ErrFunctionDenied, call.Token.Line, call.Token.Column,
+				"function '%s' is not allowed in this expression", call.Name)
+		}
+		return err == nil
+	})
+	return err
+}
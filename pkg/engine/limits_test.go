@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompiledExpression_WithLimits(t *testing.T) {
+	engine, err := New(WithCaching(true), WithMaxIterations(4))
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{"items": []interface{}{1, 2, 3, 4, 5}}
+	const dsl = `len(filter($.items, x => x > 2)) > 1`
+
+	compiled, err := engine.Compile(dsl)
+	require.NoError(t, err)
+	_, err = engine.Evaluate(compiled, payload)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrIterationLimit))
+
+	limited, err := compiled.WithLimits(Limits{
+		Timeout:       time.Second,
+		MaxIterations: 10,
+		Functions:     []string{"len", "filter"},
+	})
+	require.NoError(t, err)
+	ok, err := engine.EvaluateBool(limited, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second, limited.Limits().Timeout)
+
+	t.Run("cached expression is unchanged", func(t *testing.T) {
+		assert.Equal(t, Limits{}, compiled.Limits())
+		again, err := engine.Compile(dsl)
+		require.NoError(t, err)
+		assert.Same(t, compiled, again)
+	})
+
+	t.Run("function allowlist", func(t *testing.T) {
+		_, err := compiled.WithLimits(Limits{Functions: []string{"len"}})
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrFunctionDenied))
+		assert.Contains(t, err.Error(), "filter")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		slow, err := engine.Compile(`len(filter($.items, x => x > 2)) >= 0`)
+		require.NoError(t, err)
+		slow, err = slow.WithLimits(Limits{Timeout: time.Nanosecond, MaxIterations: 100})
+		require.NoError(t, err)
+		_, err = engine.Evaluate(slow, payload)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrTimeout))
+	})
+
+	t.Run("limits do not leak between rules", func(t *testing.T) {
+		rules := engine.NewRuleSet()
+		require.NoError(t, rules.AddCompiled("limited", limited))
+		require.NoError(t, rules.Add("default", dsl))
+		results, err := rules.EvaluateAll(payload)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		assert.True(t, results["limited"].Matched())
+		assert.True(t, errors.IsCode(results["default"].Error, errors.ErrIterationLimit))
+	})
+
+	t.Run("serialized", func(t *testing.T) {
+		data, err := limited.MarshalBinary()
+		require.NoError(t, err)
+		loaded, err := engine.LoadCompiled(data)
+		require.NoError(t, err)
+		assert.Equal(t, limited.Limits(), loaded.Limits())
+	})
+}
+
+func TestCallBudgets(t *testing.T) {
+	engine, err := New(WithMaxCalls(6), WithFunctionCallLimit("abs", 2))
+	require.NoError(t, err)
+	payload := map[string]interface{}{"items": []interface{}{-1, -2, -3}}
+
+	// Budgets apply to each evaluation separately
+	for i := 0; i < 2; i++ {
+		result, err := engine.EvaluateDirect(`abs(-1) + abs(-2)`, payload)
+		require.NoError(t, err)
+		assert.Equal(t, float64(3), result.Raw)
+	}
+
+	_, err = engine.EvaluateDirect(`sum(map($.items, x => abs(x)))`, payload)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrCallBudget))
+	assert.Contains(t, err.Error(), "function 'abs' called more than 2 times")
+
+	_, err = engine.EvaluateDirect(`len(map($.items, x => upper(lower("A")))) > 0`, payload)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrCallBudget))
+	assert.Contains(t, err.Error(), "function call budget exceeded")
+
+	t.Run("not caught by tryCatch", func(t *testing.T) {
+		_, err := engine.EvaluateDirect(`tryCatch(abs(-1) + abs(-2) + abs(-3), 0)`, payload)
+		assert.True(t, errors.IsCode(err, errors.ErrCallBudget))
+	})
+
+	t.Run("per-expression limits", func(t *testing.T) {
+		compiled, err := engine.Compile(`sum(map($.items, x => abs(x)))`)
+		require.NoError(t, err)
+		compiled, err = compiled.WithLimits(Limits{MaxCalls: 10, MaxCallsPerFunction: map[string]int{"abs": 3}})
+		require.NoError(t, err)
+		result, err := engine.Evaluate(compiled, payload)
+		require.NoError(t, err)
+		assert.Equal(t, float64(6), result.Raw)
+	})
+}
+
+func TestMaxDepth(t *testing.T) {
+	engine, err := New(WithMaxDepth(10))
+	require.NoError(t, err)
+
+	_, err = engine.Compile(`(((((((((($.a)))))))))) > 1`)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrDepthLimit))
+
+	result, err := engine.EvaluateDirect(`len(filter($.items, x => x > 1))`, map[string]interface{}{"items": []interface{}{1, 2, 3}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Raw)
+
+	t.Run("evaluation", func(t *testing.T) {
+		// Deserialized expressions skip the parser; the evaluator still
+		// bounds their depth
+		deep, err := New(WithMaxDepth(0))
+		require.NoError(t, err)
+		compiled, err := deep.Compile(`tryCatch(` + strings.Repeat("-", 20) + `$.n, 0)`)
+		require.NoError(t, err)
+
+		_, err = engine.Evaluate(compiled, map[string]interface{}{"n": 1})
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrDepthLimit), "not caught by tryCatch: %v", err)
+	})
+}
@@ -0,0 +1,57 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"context"
+
+	"github.com/bencagri/amel/pkg/lookup"
+)
+
+// WithLookupTable adds a lookup table that expressions can query with
+// lookup(name, key).
+func WithLookupTable(name string, p lookup.Provider) Option {
+	return func(e *Engine) {
+		if e.lookupTables == nil {
+			e.lookupTables = make(map[string]lookup.Provider)
+		}
+		e.lookupTables[name] = p
+	}
+}
+
+// RegisterLookupTable adds or replaces a lookup table. The lookup function is
+// registered with the first table. Tenant engines get their own set of
+// tables, starting with those passed to New.
+func (e *Engine) RegisterLookupTable(name string, p lookup.Provider) error {
+	e.lookupsMu.Lock()
+	defer e.lookupsMu.Unlock()
+
+	if e.lookups == nil {
+		tables := lookup.NewTables()
+		// Replace the function of a cloned registry, which resolves the
+		// tables of another engine
+		e.functions.Unregister(lookup.FunctionName)
+		if err := lookup.Register(e.functions, tables); err != nil {
+			return err
+		}
+		e.lookups = tables
+	}
+	return e.lookups.Add(name, p)
+}
+
+// LookupTables returns the lookup tables of the engine, or nil if none was
+// added. Use it to remove tables or to refresh them on a schedule with Watch.
+func (e *Engine) LookupTables() *lookup.Tables {
+	e.lookupsMu.Lock()
+	defer e.lookupsMu.Unlock()
+	return e.lookups
+}
+
+// RefreshLookupTables reloads the lookup tables whose provider supports it,
+// or only the named tables if names are given.
+func (e *Engine) RefreshLookupTables(ctx context.Context, names ...string) error {
+	tables := e.LookupTables()
+	if tables == nil {
+		return nil
+	}
+	return tables.Refresh(ctx, names...)
+}
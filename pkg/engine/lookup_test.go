@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/lookup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_LookupTables(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	assert.Nil(t, engine.LookupTables())
+	assert.False(t, engine.GetFunctionRegistry().Has(lookup.FunctionName))
+	assert.NoError(t, engine.RefreshLookupTables(context.Background()))
+
+	blocked := lookup.NewSetProvider("10.0.0.1")
+	engine, err = New(WithLookupTable("blocked_ips", blocked))
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{"ip": "10.0.0.1", "country": "TR"}
+	ok, err := engine.EvaluateDirectBool(`lookup("blocked_ips", $.ip) == true`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	require.NoError(t, engine.RegisterLookupTable("limits", lookup.NewMapProvider(map[string]interface{}{"TR": 500})))
+	ok, err = engine.EvaluateDirectBool(`lookup("limits", $.country) > 100`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Tenants start with the tables passed to New and keep their own
+	tenant, err := engine.ForTenant("t1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"blocked_ips"}, tenant.LookupTables().Names())
+	require.NoError(t, tenant.RegisterLookupTable("tenant_only", lookup.NewSetProvider("x")))
+	assert.Equal(t, []string{"blocked_ips", "limits"}, engine.LookupTables().Names())
+}
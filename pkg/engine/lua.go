@@ -0,0 +1,28 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"github.com/bencagri/amel/pkg/functions"
+)
+
+// WithLuaSandboxConfig sets the configuration of the sandbox running Lua
+// functions. By default it has the timeout of the engine, no memory limit,
+// and a stack depth of 100.
+func WithLuaSandboxConfig(config *functions.SandboxConfig) Option {
+	return func(e *Engine) {
+		e.luaSandbox = functions.NewLuaSandbox(config)
+	}
+}
+
+// RegisterLuaFunction registers a user-defined Lua function, in the format
+// "function name(params) body end". Lua functions are an alternative to
+// JavaScript functions and are available even if JavaScript functions are
+// disabled.
+func (e *Engine) RegisterLuaFunction(source string) error {
+	return e.functions.RegisterLuaFunction(source, e.luaSandbox)
+}
+
+// GetLuaSandbox returns the sandbox running Lua functions.
+func (e *Engine) GetLuaSandbox() *functions.LuaSandbox {
+	return e.luaSandbox
+}
@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_LuaFunctions(t *testing.T) {
+	engine, err := New(WithJSFunctions(false))
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterLuaFunction(`function discount(price, tier)
+		if tier == "gold" then return price * 0.8 end
+		return price
+	end`))
+	require.Error(t, engine.RegisterLuaFunction(`discount = 1`))
+
+	payload := map[string]interface{}{"price": 50, "tier": "gold"}
+	ok, err := engine.EvaluateDirectBool(`discount($.price, $.tier) == 40 && discount(10, "basic") == 10`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = engine.Compile(`discount(1)`)
+	assert.Error(t, err, "argument count is checked at compile time")
+
+	stats := engine.Stats()
+	assert.Equal(t, uint64(2), stats.Lua.Executions)
+	assert.Contains(t, engine.ListFunctions(), "discount")
+}
@@ -0,0 +1,70 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Bind returns a copy of the compiled expression that reads the given
+// parameters as identifiers, such as minAge in $.age >= minAge, so one rule
+// can be evaluated with different thresholds. format.Externalize produces
+// such expressions and their parameter maps. Values may be nil, bools,
+// numbers, strings, or []interface{} and map[string]interface{} of these. Parameters shadow rule facts
+// of the same name. The original expression is unchanged, and parameters
+// are not kept by MarshalBinary.
+//
+// An error with code ErrUndefinedVariable is returned for a name the
+// expression does not read.
+func (c *CompiledExpression) Bind(params map[string]interface{}) (*CompiledExpression, error) {
+	free := make(map[string]bool)
+	for _, name := range freeIdentifiers(c.AST) {
+		free[name] = true
+	}
+
+	bound := make(map[string]types.Value, len(c.params)+len(params))
+	for name, value := range c.params {
+		bound[name] = value
+	}
+	for name, value := range params {
+		if !free[name] {
+			return nil, errors.Newf(errors.ErrUndefinedVariable, "expression does not read parameter '%s'", name)
+		}
+		bound[name] = paramValue(value)
+	}
+
+	copied := *c
+	copied.params = bound
+	return &copied, nil
+}
+
+// paramValue converts a parameter to a value, converting the elements of lists
+// and maps as well.
+func paramValue(v interface{}) types.Value {
+	switch v := v.(type) {
+	case []interface{}:
+		elements := make([]types.Value, len(v))
+		for i, el := range v {
+			elements[i] = paramValue(el)
+		}
+		return types.List(elements...)
+	case map[string]interface{}:
+		entries := make(map[string]types.Value, len(v))
+		for key, el := range v {
+			entries[key] = paramValue(el)
+		}
+		return types.Map(entries)
+	}
+	return types.NewValue(v)
+}
+
+// bindParams exposes the parameters of a compiled expression as variables.
+func bindParams(expr *CompiledExpression, ctx *eval.EvalContext) {
+	if len(expr.params) > 0 && ctx.Variables == nil {
+		ctx.Variables = make(map[string]types.Value, len(expr.params))
+	}
+	for name, value := range expr.params {
+		ctx.SetVariable(name, value)
+	}
+}
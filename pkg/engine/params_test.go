@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/format"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompiledExpression_Bind(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	ext, err := format.ExternalizeSource(`$.age >= 18 && $.country IN ["DE", "FR"] && $.score > 0.5`)
+	require.NoError(t, err)
+	compiled, err := engine.Compile(ext.Source)
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{"age": 20, "country": "FR", "score": 0.7}
+
+	bound, err := compiled.Bind(ext.Params)
+	require.NoError(t, err)
+	ok, err := engine.EvaluateBool(bound, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	stricter, err := bound.Bind(map[string]interface{}{"minAge": 21})
+	require.NoError(t, err)
+	ok, err = engine.EvaluateBool(stricter, payload)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// The first binding is unchanged
+	ok, err = engine.EvaluateBool(bound, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	t.Run("unbound", func(t *testing.T) {
+		_, err := engine.EvaluateBool(compiled, payload)
+		require.Error(t, err)
+		assert.Equal(t, errors.ErrUndefinedVariable, err.(*errors.Error).Code)
+	})
+
+	t.Run("unknown parameter", func(t *testing.T) {
+		_, err := compiled.Bind(map[string]interface{}{"maxAge": 65})
+		require.Error(t, err)
+		assert.Equal(t, errors.ErrUndefinedVariable, err.(*errors.Error).Code)
+	})
+}
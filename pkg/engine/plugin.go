@@ -0,0 +1,268 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"time"
+
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Plugin extends the engine with cross-cutting behavior such as authorization,
+// caching, metrics, or auditing. A plugin implements one or more of the hook
+// interfaces CompileHook, PreEvaluateHook, PostEvaluateHook, and ErrorHook.
+// Hooks run in the order the plugins were passed to WithPlugins and must be
+// safe for concurrent use.
+type Plugin interface {
+	// Name identifies the plugin.
+	Name() string
+}
+
+// CompileHook is called after an expression has been parsed and optimized, and
+// before it is cached. Returning an error rejects the expression; Compile then
+// returns the error. Expressions served from the compile cache do not run the
+// hook again; expressions loaded from the disk cache do.
+type CompileHook interface {
+	Plugin
+	OnCompile(expr *CompiledExpression) error
+}
+
+// PreEvaluateHook is called before an expression is evaluated. Returning an
+// error aborts the evaluation with that error. Calling Evaluation.SetResult
+// skips the evaluation and the remaining pre-evaluate hooks.
+type PreEvaluateHook interface {
+	Plugin
+	PreEvaluate(ev *Evaluation) error
+}
+
+// PostEvaluateHook is called after every evaluation, including failed and
+// skipped ones. The hook may replace Result or Err.
+type PostEvaluateHook interface {
+	Plugin
+	PostEvaluate(ev *Evaluation)
+}
+
+// ErrorHook is called when compiling or evaluating fails, after the
+// post-evaluate hooks. For compile errors, Stage is StageCompile and
+// Expression is nil.
+type ErrorHook interface {
+	Plugin
+	OnError(ev *Evaluation)
+}
+
+// Stage identifies the phase an Evaluation describes.
+type Stage int
+
+const (
+	// StageEvaluate is the evaluation of a compiled expression.
+	StageEvaluate Stage = iota
+	// StageCompile is the compilation of an expression.
+	StageCompile
+)
+
+// String returns the name of the stage.
+func (s Stage) String() string {
+	if s == StageCompile {
+		return "compile"
+	}
+	return "evaluate"
+}
+
+// Evaluation describes a single evaluation as seen by plugin hooks.
+type Evaluation struct {
+	Stage      Stage
+	Source     string
+	Expression *CompiledExpression
+	Rule       string // Name of the rule being evaluated, if any
+	Tenant     string // Tenant id of the engine, if any
+	Payload    interface{}
+	// PayloadJSON is the payload as JSON text, as seen by the evaluator.
+	PayloadJSON string
+
+	Start       time.Time
+	Duration    time.Duration // Time spent in the evaluator
+	Result      types.Value
+	Explanation *eval.Explanation // Set when an explanation was requested
+	Err         error
+	// Functions lists the functions invoked during evaluation, in the order
+	// they were first called.
+	Functions []string
+
+	// Metadata carries values between the hooks of one evaluation.
+	Metadata map[string]interface{}
+
+	skipped bool
+}
+
+// SetResult sets the result of the evaluation from a pre-evaluate hook, so
+// the expression is not evaluated. Caching plugins use it to serve results.
+func (ev *Evaluation) SetResult(v types.Value) {
+	ev.Result = v
+	ev.skipped = true
+}
+
+// Skipped reports whether a pre-evaluate hook provided the result.
+func (ev *Evaluation) Skipped() bool {
+	return ev.skipped
+}
+
+// WithPlugins adds plugins to the engine.
+func WithPlugins(plugins ...Plugin) Option {
+	return func(e *Engine) {
+		e.plugins = append(e.plugins, plugins...)
+	}
+}
+
+// Plugins returns the plugins of the engine in the order their hooks run.
+func (e *Engine) Plugins() []Plugin {
+	plugins := make([]Plugin, len(e.plugins))
+	copy(plugins, e.plugins)
+	return plugins
+}
+
+// hooks holds the plugins of an engine grouped by the hooks they implement.
+type hooks struct {
+	compile []CompileHook
+	pre     []PreEvaluateHook
+	post    []PostEvaluateHook
+	errors  []ErrorHook
+}
+
+func newHooks(plugins []Plugin) hooks {
+	var h hooks
+	for _, p := range plugins {
+		if hook, ok := p.(CompileHook); ok {
+			h.compile = append(h.compile, hook)
+		}
+		if hook, ok := p.(PreEvaluateHook); ok {
+			h.pre = append(h.pre, hook)
+		}
+		if hook, ok := p.(PostEvaluateHook); ok {
+			h.post = append(h.post, hook)
+		}
+		if hook, ok := p.(ErrorHook); ok {
+			h.errors = append(h.errors, hook)
+		}
+	}
+	return h
+}
+
+// onCompile runs the compile hooks for a freshly compiled expression.
+func (e *Engine) onCompile(compiled *CompiledExpression) error {
+	for _, hook := range e.hooks.compile {
+		if err := hook.OnCompile(compiled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onCompileError runs the error hooks for a failed compilation.
+func (e *Engine) onCompileError(dsl string, err error) {
+	if len(e.hooks.errors) == 0 {
+		return
+	}
+	ev := &Evaluation{
+		Stage:    StageCompile,
+		Source:   dsl,
+		Tenant:   e.tenantID,
+		Start:    time.Now(),
+		Result:   types.Null(),
+		Err:      err,
+		Metadata: map[string]interface{}{},
+	}
+	for _, hook := range e.hooks.errors {
+		hook.OnError(ev)
+	}
+}
+
+// run evaluates a compiled expression, running the evaluation hooks around it,
+// and records the evaluation in the engine statistics.
+func (e *Engine) run(expr *CompiledExpression, ctx *eval.EvalContext, rule string, explain bool) (types.Value, *eval.Explanation, error) {
+	start := time.Now()
+	value, explanation, err := e.runHooks(expr, ctx, rule, explain)
+	e.stats.evaluate(value, err, time.Since(start))
+	return value, explanation, err
+}
+
+// runHooks evaluates a compiled expression, running the evaluation hooks around it.
+func (e *Engine) runHooks(expr *CompiledExpression, ctx *eval.EvalContext, rule string, explain bool) (types.Value, *eval.Explanation, error) {
+	if len(e.hooks.pre) == 0 && len(e.hooks.post) == 0 && len(e.hooks.errors) == 0 {
+		return e.evaluateCached(expr, ctx, explain)
+	}
+
+	ev := &Evaluation{
+		Stage:       StageEvaluate,
+		Source:      expr.Source,
+		Expression:  expr,
+		Rule:        rule,
+		Tenant:      e.tenantID,
+		Payload:     ctx.Payload,
+		PayloadJSON: ctx.PayloadJSON,
+		Start:       time.Now(),
+		Result:      types.Null(),
+		Metadata:    map[string]interface{}{},
+	}
+	ctx.TrackCalls()
+
+	for _, hook := range e.hooks.pre {
+		if err := hook.PreEvaluate(ev); err != nil {
+			ev.Err = err
+			break
+		}
+		if ev.skipped {
+			break
+		}
+	}
+
+	if ev.Err == nil && !ev.skipped {
+		start := time.Now()
+		ev.Result, ev.Explanation, ev.Err = e.evaluateCached(expr, ctx, explain)
+		ev.Duration = time.Since(start)
+		ev.Functions = ctx.InvokedFunctions()
+	}
+
+	for _, hook := range e.hooks.post {
+		hook.PostEvaluate(ev)
+	}
+	if ev.Err != nil {
+		for _, hook := range e.hooks.errors {
+			hook.OnError(ev)
+		}
+		return types.Null(), ev.Explanation, ev.Err
+	}
+	return ev.Result, ev.Explanation, nil
+}
+
+// evaluateRaw evaluates a compiled expression without running hooks.
+// Explanations use the original AST to show the full expression tree;
+// plain evaluation uses the optimized AST, or its bytecode.
+func (e *Engine) evaluateRaw(expr *CompiledExpression, ctx *eval.EvalContext, explain bool) (types.Value, *eval.Explanation, error) {
+	// Always set the limits so a reused context does not keep earlier ones.
+	var limits Limits
+	if expr.limits != nil {
+		limits = *expr.limits
+	}
+	ctx.SetLimits(limits)
+	ctx.RecordClauses(nil)
+	bindParams(expr, ctx)
+
+	if explain {
+		return e.evaluator.EvaluateWithExplanation(expr.AST, ctx)
+	}
+
+	astToEval := expr.Optimized
+	if astToEval == nil {
+		astToEval = expr.AST
+	}
+	if expr.clauses != nil {
+		astToEval = expr.clauses.expression()
+		ctx.RecordClauses(expr.clauses.stats)
+		defer expr.clauses.evaluated()
+	} else if expr.program != nil {
+		value, err := expr.program.Run(e.evaluator, ctx)
+		return value, nil, err
+	}
+	value, err := e.evaluator.Evaluate(astToEval, ctx)
+	return value, nil, err
+}
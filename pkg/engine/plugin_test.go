@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// denyFunctions rejects expressions that call any of the listed functions.
+type denyFunctions struct {
+	denied map[string]bool
+}
+
+func (p *denyFunctions) Name() string { return "deny-functions" }
+
+func (p *denyFunctions) OnCompile(expr *CompiledExpression) error {
+	var err error
+	ast.Inspect(expr.AST, func(node ast.Expression) bool {
+		if call, ok := node.(*ast.FunctionCall); ok && p.denied[call.Name] && err == nil {
+			err = fmt.Errorf("function %s is not allowed", call.Name)
+		}
+		return true
+	})
+	return err
+}
+
+// recorder records every hook call.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+	rules  []string
+	errors []string
+}
+
+func (r *recorder) Name() string { return "recorder" }
+
+func (r *recorder) PreEvaluate(ev *Evaluation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, "pre:"+ev.Source)
+	ev.Metadata["seen"] = true
+	return nil
+}
+
+func (r *recorder) PostEvaluate(ev *Evaluation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, fmt.Sprintf("post:%s:%v", ev.Source, ev.Metadata["seen"]))
+	if ev.Rule != "" {
+		r.rules = append(r.rules, ev.Rule)
+	}
+}
+
+func (r *recorder) OnError(ev *Evaluation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, ev.Stage.String()+":"+ev.Source)
+}
+
+// fixedResult answers every evaluation of one source without evaluating it.
+type fixedResult struct {
+	source string
+	value  types.Value
+}
+
+func (p *fixedResult) Name() string { return "fixed-result" }
+
+func (p *fixedResult) PreEvaluate(ev *Evaluation) error {
+	if ev.Source == p.source {
+		ev.SetResult(p.value)
+	}
+	return nil
+}
+
+// rejectPayloads fails evaluations whose payload is not a map.
+type rejectPayloads struct{}
+
+func (rejectPayloads) Name() string { return "reject-payloads" }
+
+func (rejectPayloads) PreEvaluate(ev *Evaluation) error {
+	if _, ok := ev.Payload.(map[string]interface{}); !ok {
+		return fmt.Errorf("payload must be an object")
+	}
+	return nil
+}
+
+func TestPlugins_CompileHook(t *testing.T) {
+	rec := &recorder{}
+	engine, err := New(WithPlugins(&denyFunctions{denied: map[string]bool{"upper": true}}, rec))
+	require.NoError(t, err)
+
+	_, err = engine.Compile(`upper($.name) == "X"`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "upper is not allowed")
+
+	_, err = engine.Compile(`lower($.name) == "x"`)
+	require.NoError(t, err)
+
+	_, err = engine.Compile(`$.a >`)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{`compile:upper($.name) == "X"`, `compile:$.a >`}, rec.errors)
+}
+
+func TestPlugins_EvaluateHooks(t *testing.T) {
+	rec := &recorder{}
+	fixed := &fixedResult{source: `$.a > 100`, value: types.Bool(true)}
+	engine, err := New(WithPlugins(fixed, rejectPayloads{}, rec))
+	require.NoError(t, err)
+	assert.Len(t, engine.Plugins(), 3)
+
+	payload := map[string]interface{}{"a": 1}
+
+	ok, err := engine.EvaluateDirectBool(`$.a > 0`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = engine.EvaluateDirectBool(`$.a > 100`, payload)
+	require.NoError(t, err)
+	assert.True(t, ok, "served by the fixed-result plugin")
+
+	_, err = engine.EvaluateDirect(`$.a > 0`, `{"a": 1}`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "payload must be an object")
+
+	_, err = engine.EvaluateDirect(`$.a / 0`, payload)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"pre:$.a > 0", "post:$.a > 0:true",
+		"post:$.a > 100:<nil>",
+		"post:$.a > 0:<nil>",
+		"pre:$.a / 0", "post:$.a / 0:true",
+	}, rec.events)
+	assert.Equal(t, []string{"evaluate:$.a > 0", "evaluate:$.a / 0"}, rec.errors)
+}
+
+func TestPlugins_RuleNames(t *testing.T) {
+	rec := &recorder{}
+	engine, err := New(WithPlugins(rec))
+	require.NoError(t, err)
+
+	require.NoError(t, engine.AddRule("adult", `$.age >= 18`))
+	require.NoError(t, engine.AddRule("senior", `$.age >= 65`))
+
+	_, err = engine.Rules().EvaluateAll(map[string]interface{}{"age": 70})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"adult", "senior"}, rec.rules)
+}
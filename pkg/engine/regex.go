@@ -0,0 +1,44 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"github.com/bencagri/amel/pkg/functions"
+)
+
+// WithMaxRegexLength sets the length, in bytes, of the longest regex pattern
+// expressions may use with =~, !~, and match. Longer literal patterns fail to
+// compile, and longer patterns computed at evaluation fail, with
+// ErrRegexDenied. Zero or less means no limit, the default.
+func WithMaxRegexLength(n int) Option {
+	return func(e *Engine) {
+		e.regexConfig.MaxPatternLength = n
+	}
+}
+
+// WithRegexCacheSize sets how many compiled regex patterns the engine keeps.
+// The least recently used pattern is evicted when the cache is full, so
+// expressions using thousands of distinct patterns cannot grow memory without
+// bound. Zero or less uses functions.DefaultRegexCacheSize.
+func WithRegexCacheSize(n int) Option {
+	return func(e *Engine) {
+		e.regexConfig.CacheSize = n
+	}
+}
+
+// WithApprovedRegexes restricts expressions to the given regex patterns. The
+// patterns are compiled once, when the engine is created; other patterns fail
+// with ErrRegexDenied, at compile time if they are literals. Calling it again
+// adds to the approved patterns.
+func WithApprovedRegexes(patterns ...string) Option {
+	return func(e *Engine) {
+		if e.regexConfig.Approved == nil {
+			e.regexConfig.Approved = []string{}
+		}
+		e.regexConfig.Approved = append(e.regexConfig.Approved, patterns...)
+	}
+}
+
+// RegexStats reports the activity of the regex pattern cache.
+func (e *Engine) RegexStats() functions.RegexCacheStats {
+	return e.regexes.Stats()
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_RegexControls(t *testing.T) {
+	t.Run("pattern length", func(t *testing.T) {
+		engine, err := New(WithMaxRegexLength(10))
+		require.NoError(t, err)
+
+		_, err = engine.Compile(`$.email =~ "^[a-z]+@example\\.com$"`)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrRegexDenied))
+		_, err = engine.Compile(`match($.email, "^[a-z]+@example\\.com$")`)
+		assert.True(t, errors.IsCode(err, errors.ErrRegexDenied))
+
+		// Patterns computed at evaluation are checked when they are used
+		_, err = engine.EvaluateDirect(`tryCatch($.email =~ $.pattern, false)`, map[string]interface{}{
+			"email":   "a@example.com",
+			"pattern": "^[a-z]+@example\\.com$",
+		})
+		assert.True(t, errors.IsCode(err, errors.ErrRegexDenied), "not caught by tryCatch: %v", err)
+
+		ok, err := engine.EvaluateDirectBool(`$.email =~ "^a@"`, map[string]interface{}{"email": "a@example.com"})
+		require.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("approved patterns", func(t *testing.T) {
+		engine, err := New(WithApprovedRegexes(`^ops@`, `\.com$`))
+		require.NoError(t, err)
+
+		payload := map[string]interface{}{"email": "ops@example.com"}
+		ok, err := engine.EvaluateDirectBool(`$.email =~ "^ops@" && match($.email, "\\.com$")`, payload)
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = engine.Compile(`$.email =~ "^dev@"`)
+		assert.True(t, errors.IsCode(err, errors.ErrRegexDenied))
+
+		_, err = New(WithApprovedRegexes(`(`))
+		assert.Error(t, err)
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		engine, err := New(WithRegexCacheSize(2))
+		require.NoError(t, err)
+
+		compiled, err := engine.Compile(`$.s =~ $.p`)
+		require.NoError(t, err)
+		for _, p := range []string{"a", "b", "a", "c", "d"} {
+			_, err := engine.Evaluate(compiled, map[string]interface{}{"s": "abc", "p": p})
+			require.NoError(t, err)
+		}
+		stats := engine.RegexStats()
+		assert.Equal(t, uint64(1), stats.Hits)
+		assert.Equal(t, uint64(4), stats.Misses)
+		assert.Equal(t, uint64(2), stats.Evictions)
+		assert.Equal(t, 2, stats.Entries)
+	})
+}
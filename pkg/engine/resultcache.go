@@ -0,0 +1,102 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// WithResultCache caches the results of successful evaluations, keyed by the
+// canonical hash of the expression (see CompiledExpression.Hash), the digest
+// of the payload, and the parameters and rule facts the expression can read,
+// for deployments that evaluate identical payloads repeatedly, such as
+// retries and fan-out. The cache holds at most size results, DefaultCacheSize
+// if size is zero or less, each for ttl, or until evicted if ttl is zero.
+//
+// Only enable it if the functions the expressions call are deterministic: a
+// cached result of now(), an external lookup, or a JavaScript function with
+// state is served again until it expires. Failed evaluations and
+// explanations are never cached. Evaluation hooks still run for cached
+// results. Call ClearResultCache after replacing a function.
+func WithResultCache(size int, ttl time.Duration) Option {
+	return func(e *Engine) {
+		e.resultCaching = true
+		e.resultCacheSize = size
+		e.resultCacheTTL = ttl
+	}
+}
+
+// ResultCacheStats returns the result cache statistics. All values are zero
+// if the result cache is disabled.
+func (e *Engine) ResultCacheStats() CacheStats {
+	if e.resultCache == nil {
+		return CacheStats{}
+	}
+	return e.resultCache.snapshot()
+}
+
+// ClearResultCache clears the result cache. Cache statistics are kept.
+func (e *Engine) ClearResultCache() {
+	if e.resultCache != nil {
+		e.resultCache.clear()
+	}
+}
+
+// evaluateCached evaluates a compiled expression without running hooks,
+// serving the result from the result cache if it is enabled.
+func (e *Engine) evaluateCached(expr *CompiledExpression, ctx *eval.EvalContext, explain bool) (types.Value, *eval.Explanation, error) {
+	if e.resultCache == nil || explain {
+		return e.evaluateRaw(expr, ctx, explain)
+	}
+
+	key := resultKey(expr, ctx)
+	if value, ok := e.resultCache.get(key); ok {
+		return value, nil, nil
+	}
+	value, explanation, err := e.evaluateRaw(expr, ctx, explain)
+	if err == nil {
+		e.resultCache.add(key, value)
+	}
+	return value, explanation, err
+}
+
+// resultKey identifies an evaluation by the expression, the payload, and the
+// variables the expression can read: rule facts and bound parameters.
+func resultKey(expr *CompiledExpression, ctx *eval.EvalContext) string {
+	var sb strings.Builder
+	sb.WriteString(expr.Hash())
+	sb.WriteByte(' ')
+	sb.WriteString(Digest(ctx.PayloadJSON))
+	if len(ctx.Variables) == 0 && len(expr.params) == 0 {
+		return sb.String()
+	}
+
+	variables := make(map[string]types.Value, len(ctx.Variables)+len(expr.params))
+	for name, value := range ctx.Variables {
+		variables[name] = value
+	}
+	for name, value := range expr.params {
+		variables[name] = value
+	}
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		value := variables[name]
+		fmt.Fprintf(h, "%s=%s:%#v\n", name, value.Type, value.Raw)
+	}
+	sb.WriteByte(' ')
+	sb.WriteString(hex.EncodeToString(h.Sum(nil)))
+	return sb.String()
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithResultCache(t *testing.T) {
+	engine, err := New(WithResultCache(10, 0))
+	require.NoError(t, err)
+
+	var calls atomic.Int64
+	require.NoError(t, engine.RegisterBuiltIn("points", func(args ...types.Value) (types.Value, error) {
+		calls.Add(1)
+		n, _ := args[0].AsInt()
+		return types.Int(n * 10), nil
+	}, types.NewFunctionSignature("points", types.TypeInt, types.Param("value", types.TypeInt))))
+
+	evaluate := func(dsl string, payload interface{}) types.Value {
+		t.Helper()
+		value, err := engine.EvaluateDirect(dsl, payload)
+		require.NoError(t, err)
+		return value
+	}
+
+	payload := map[string]interface{}{"n": 2}
+	assert.Equal(t, int64(20), evaluate(`points($.n)`, payload).Raw)
+	assert.Equal(t, int64(20), evaluate(`points($.n)`, payload).Raw)
+	assert.Equal(t, int64(20), evaluate(`points( ($.n) )`, payload).Raw, "equivalent expressions share results")
+	assert.Equal(t, int64(1), calls.Load())
+
+	assert.Equal(t, int64(30), evaluate(`points($.n)`, map[string]interface{}{"n": 3}).Raw)
+	assert.Equal(t, int64(2), calls.Load())
+
+	stats := engine.ResultCacheStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, 10, stats.MaxEntries)
+
+	t.Run("parameters", func(t *testing.T) {
+		compiled, err := engine.Compile(`points($.n) > limit`)
+		require.NoError(t, err)
+		low, err := compiled.Bind(map[string]interface{}{"limit": 10})
+		require.NoError(t, err)
+		high, err := compiled.Bind(map[string]interface{}{"limit": 100})
+		require.NoError(t, err)
+
+		ok, err := engine.EvaluateBool(low, payload)
+		require.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = engine.EvaluateBool(high, payload)
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		_, err := engine.EvaluateDirect(`$.n / 0`, payload)
+		require.Error(t, err)
+		_, err = engine.EvaluateDirect(`$.n / 0`, payload)
+		require.Error(t, err)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		engine.ClearResultCache()
+		before := calls.Load()
+		evaluate(`points($.n)`, payload)
+		assert.Equal(t, before+1, calls.Load())
+	})
+}
+
+func TestWithResultCache_TTL(t *testing.T) {
+	engine, err := New(WithResultCache(0, time.Minute))
+	require.NoError(t, err)
+	now := time.Now()
+	engine.resultCache.now = func() time.Time { return now }
+
+	_, err = engine.EvaluateDirect(`$.n + 1`, map[string]interface{}{"n": 1})
+	require.NoError(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = engine.EvaluateDirect(`$.n + 1`, map[string]interface{}{"n": 1})
+	require.NoError(t, err)
+
+	stats := engine.ResultCacheStats()
+	assert.Equal(t, uint64(1), stats.Expirations)
+	assert.Equal(t, DefaultCacheSize, stats.MaxEntries)
+
+	disabled, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, CacheStats{}, disabled.ResultCacheStats())
+}
@@ -0,0 +1,164 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+// WithDescription sets a human-readable description of a rule.
+func WithDescription(description string) RuleOption {
+	return func(r *Rule) {
+		r.Description = description
+	}
+}
+
+// WithOwner sets the owner (team or person) responsible for a rule.
+func WithOwner(owner string) RuleOption {
+	return func(r *Rule) {
+		r.Owner = owner
+	}
+}
+
+// WithTags adds tags to a rule.
+func WithTags(tags ...string) RuleOption {
+	return func(r *Rule) {
+		r.Tags = append(r.Tags, tags...)
+	}
+}
+
+// WithEnabled sets whether a rule is evaluated. Rules are enabled by default.
+func WithEnabled(enabled bool) RuleOption {
+	return func(r *Rule) {
+		r.Disabled = !enabled
+	}
+}
+
+// HasTag checks if the rule carries the given tag.
+func (r *Rule) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyTag checks if the rule carries at least one of the given tags.
+func (r *Rule) hasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		if r.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetEnabled enables or disables a rule by name.
+// Returns false if the rule does not exist.
+func (rs *RuleSet) SetEnabled(name string, enabled bool) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rule, ok := rs.index[name]
+	if !ok {
+		return false
+	}
+
+	// Replace the rule instead of mutating it, since rules are shared with
+	// selected subsets and in-flight evaluations.
+	updated := *rule
+	updated.Disabled = !enabled
+	rs.replace(rule, &updated)
+	return true
+}
+
+// replace swaps a rule for an updated copy in every internal list.
+func (rs *RuleSet) replace(old, updated *Rule) {
+	for i, r := range rs.rules {
+		if r == old {
+			rs.rules[i] = updated
+		}
+	}
+	for i, r := range rs.order {
+		if r == old {
+			rs.order[i] = updated
+		}
+	}
+	rs.index[updated.Name] = updated
+}
+
+// Tags returns the distinct tags used by the rules in the set.
+func (rs *RuleSet) Tags() []string {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var tags []string
+	for _, rule := range rs.rules {
+		for _, tag := range rule.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// Select returns a new rule set with the rules that carry at least one of the given
+// tags, sharing the compiled rules and the conflict policy of rs. Rules that publish
+// facts read by a selected rule are included as well, so chains keep working.
+func (rs *RuleSet) Select(tags ...string) *RuleSet {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	producers := make(map[string]*Rule)
+	for _, rule := range rs.rules {
+		if rule.Output != "" {
+			producers[rule.Output] = rule
+		}
+	}
+
+	selected := make(map[*Rule]bool)
+	var include func(rule *Rule)
+	include = func(rule *Rule) {
+		if selected[rule] {
+			return
+		}
+		selected[rule] = true
+		for _, name := range freeIdentifiers(rule.Compiled.AST) {
+			if producer, ok := producers[name]; ok {
+				include(producer)
+			}
+		}
+	}
+	for _, rule := range rs.rules {
+		if rule.hasAnyTag(tags) {
+			include(rule)
+		}
+	}
+
+	subset := &RuleSet{
+		engine: rs.engine,
+		policy: rs.policy,
+		index:  make(map[string]*Rule, len(selected)),
+	}
+	for _, rule := range rs.rules {
+		if selected[rule] {
+			subset.rules = append(subset.rules, rule)
+			subset.index[rule.Name] = rule
+		}
+	}
+	for _, rule := range rs.order {
+		if selected[rule] {
+			subset.order = append(subset.order, rule)
+		}
+	}
+	return subset
+}
+
+// EvaluateTagged evaluates the rules carrying at least one of the given tags.
+func (rs *RuleSet) EvaluateTagged(payload interface{}, tags ...string) (map[string]*RuleResult, error) {
+	return rs.Select(tags...).EvaluateAll(payload)
+}
+
+// FireTagged fires the rules carrying at least one of the given tags.
+func (rs *RuleSet) FireTagged(payload interface{}, tags ...string) (*FireResult, error) {
+	return rs.Select(tags...).Fire(payload)
+}
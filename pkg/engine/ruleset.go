@@ -0,0 +1,401 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Rule is a named, compiled expression held by a RuleSet.
+type Rule struct {
+	Name     string
+	Compiled *CompiledExpression
+	Priority int         // Higher values win under PolicyHighestPriority
+	Output   string      // Name of the fact the rule publishes, if any
+	Action   interface{} // Payload handed back to the caller when the rule fires
+
+	// Metadata
+	Description string
+	Owner       string
+	Tags        []string
+	Disabled    bool // Disabled rules are skipped during evaluation
+}
+
+// RuleOption is a function that configures a rule when it is added to a RuleSet.
+type RuleOption func(*Rule)
+
+// WithPriority sets the priority of a rule.
+func WithPriority(priority int) RuleOption {
+	return func(r *Rule) {
+		r.Priority = priority
+	}
+}
+
+// WithAction attaches an action payload to a rule, such as a decision or a
+// message template, which is returned with the rule when it fires.
+func WithAction(action interface{}) RuleOption {
+	return func(r *Rule) {
+		r.Action = action
+	}
+}
+
+// ConflictPolicy determines which matching rules fire when a rule set is fired.
+type ConflictPolicy int
+
+const (
+	PolicyFirstMatch      ConflictPolicy = iota // First matching rule in insertion order
+	PolicyHighestPriority                       // Matching rule with the highest priority
+	PolicyAllMatches                            // Every matching rule, in insertion order
+	PolicyBestScore                             // Rule with the highest positive numeric value
+)
+
+var conflictPolicyNames = map[ConflictPolicy]string{
+	PolicyFirstMatch:      "first-match",
+	PolicyHighestPriority: "highest-priority",
+	PolicyAllMatches:      "all-matches",
+	PolicyBestScore:       "best-score",
+}
+
+// String returns the string representation of a conflict policy.
+func (p ConflictPolicy) String() string {
+	if name, ok := conflictPolicyNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("ConflictPolicy(%d)", p)
+}
+
+// RuleSetOption is a function that configures a RuleSet.
+type RuleSetOption func(*RuleSet)
+
+// WithConflictPolicy sets the policy used by RuleSet.Fire.
+func WithConflictPolicy(policy ConflictPolicy) RuleSetOption {
+	return func(rs *RuleSet) {
+		rs.policy = policy
+	}
+}
+
+// RuleResult holds the outcome of evaluating a single rule.
+type RuleResult struct {
+	Value types.Value
+	Error error
+
+	truthiness *types.Truthiness // The rules of the engine, if set
+}
+
+// Matched returns true if the rule evaluated without error to a value that
+// is truthy under the rules of the engine.
+func (r *RuleResult) Matched() bool {
+	return r.Error == nil && r.truthiness.IsTruthy(r.Value)
+}
+
+// RuleSet holds named compiled rules that are evaluated against the same payload.
+// Rules are evaluated in the order they were added, except that rules publishing a
+// fact are always evaluated before the rules that read it.
+type RuleSet struct {
+	mu     sync.RWMutex
+	engine *Engine
+	policy ConflictPolicy
+	rules  []*Rule // Insertion order
+	order  []*Rule // Evaluation order
+	index  map[string]*Rule
+}
+
+// NewRuleSet creates an empty rule set bound to the engine.
+func (e *Engine) NewRuleSet(opts ...RuleSetOption) *RuleSet {
+	rs := &RuleSet{
+		engine: e,
+		policy: PolicyFirstMatch,
+		index:  make(map[string]*Rule),
+	}
+
+	for _, opt := range opts {
+		opt(rs)
+	}
+
+	return rs
+}
+
+// Add compiles the DSL expression and adds it to the rule set under the given name.
+func (rs *RuleSet) Add(name, dsl string, opts ...RuleOption) error {
+	compiled, err := rs.engine.Compile(dsl)
+	if err != nil {
+		return err
+	}
+	return rs.AddCompiled(name, compiled, opts...)
+}
+
+// AddCompiled adds an already compiled expression to the rule set.
+func (rs *RuleSet) AddCompiled(name string, compiled *CompiledExpression, opts ...RuleOption) error {
+	if name == "" {
+		return errors.New(errors.ErrInvalidSyntax, "rule name cannot be empty")
+	}
+	if compiled == nil {
+		return errors.Newf(errors.ErrInvalidSyntax, "rule '%s' has no compiled expression", name)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, exists := rs.index[name]; exists {
+		return errors.Newf(errors.ErrInvalidSyntax, "rule '%s' is already defined", name)
+	}
+
+	rule := &Rule{Name: name, Compiled: compiled}
+	for _, opt := range opts {
+		opt(rule)
+	}
+
+	rules := append(append([]*Rule{}, rs.rules...), rule)
+	order, err := orderRules(rules)
+	if err != nil {
+		return err
+	}
+
+	rs.rules = rules
+	rs.order = order
+	rs.index[name] = rule
+	return nil
+}
+
+// Remove removes a rule by name.
+func (rs *RuleSet) Remove(name string) bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, exists := rs.index[name]; !exists {
+		return false
+	}
+	delete(rs.index, name)
+	for i, rule := range rs.rules {
+		if rule.Name == name {
+			rs.rules = append(rs.rules[:i], rs.rules[i+1:]...)
+			break
+		}
+	}
+	// Removing a rule cannot introduce a cycle
+	rs.order, _ = orderRules(rs.rules)
+	return true
+}
+
+// Get retrieves a rule by name.
+func (rs *RuleSet) Get(name string) (*Rule, bool) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	rule, ok := rs.index[name]
+	return rule, ok
+}
+
+// Names returns the rule names in evaluation order.
+func (rs *RuleSet) Names() []string {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	names := make([]string, len(rs.order))
+	for i, rule := range rs.order {
+		names[i] = rule.Name
+	}
+	return names
+}
+
+// Len returns the number of rules in the set.
+func (rs *RuleSet) Len() int {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	return len(rs.rules)
+}
+
+// EvaluateAll evaluates every rule against the payload and returns the results keyed by rule name.
+// A failing rule does not stop evaluation of the others; its error is recorded in its result.
+func (rs *RuleSet) EvaluateAll(payload interface{}) (map[string]*RuleResult, error) {
+	run, err := rs.engine.newRun(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := rs.snapshot()
+	results := make(map[string]*RuleResult, len(rules))
+	for _, rule := range rules {
+		results[rule.Name] = rs.evaluateRule(rule, run, true)
+	}
+	return results, nil
+}
+
+// EvaluateAny returns true if at least one rule matches the payload.
+// Evaluation stops at the first match or the first rule error.
+func (rs *RuleSet) EvaluateAny(payload interface{}) (bool, error) {
+	name, _, err := rs.EvaluateUntilFirstMatch(payload)
+	if err != nil {
+		return false, err
+	}
+	return name != "", nil
+}
+
+// EvaluateUntilFirstMatch evaluates rules in order and returns the name and value of the
+// first rule that matches. If no rule matches, the returned name is empty.
+func (rs *RuleSet) EvaluateUntilFirstMatch(payload interface{}) (string, types.Value, error) {
+	run, err := rs.engine.newRun(payload)
+	if err != nil {
+		return "", types.Null(), err
+	}
+
+	for _, rule := range rs.snapshot() {
+		result := rs.evaluateRule(rule, run, true)
+		if result.Error != nil {
+			return "", types.Null(), fmt.Errorf("rule '%s': %w", rule.Name, result.Error)
+		}
+		if rule.Output == "" && result.Matched() {
+			return rule.Name, result.Value, nil
+		}
+	}
+	return "", types.Null(), nil
+}
+
+// Policy returns the conflict policy used by Fire.
+func (rs *RuleSet) Policy() ConflictPolicy {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	return rs.policy
+}
+
+// SetPolicy changes the conflict policy used by Fire.
+func (rs *RuleSet) SetPolicy(policy ConflictPolicy) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.policy = policy
+}
+
+// FiredRule describes a rule selected by the conflict policy.
+type FiredRule struct {
+	Name        string
+	Priority    int
+	Action      interface{}
+	Value       types.Value
+	Score       float64           // The value of the rule under PolicyBestScore
+	Reason      string            // Why the policy selected this rule
+	Explanation *eval.Explanation // Why the rule's expression matched
+}
+
+// FireResult is the outcome of firing a rule set.
+type FireResult struct {
+	Policy ConflictPolicy
+	Fired  []*FiredRule
+}
+
+// Names returns the names of the fired rules.
+func (r *FireResult) Names() []string {
+	names := make([]string, len(r.Fired))
+	for i, f := range r.Fired {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Fire evaluates the rule set against the payload, applies the conflict policy, and
+// reports which rules fired and why. Evaluation stops at the first rule error.
+// Under PolicyBestScore the value of each rule is its score, as computed by the
+// score function, and rules whose value is not a positive number do not fire.
+func (rs *RuleSet) Fire(payload interface{}) (*FireResult, error) {
+	run, err := rs.engine.newRun(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := rs.Policy()
+	rules := rs.snapshot()
+
+	result := &FireResult{Policy: policy}
+	var best *Rule
+	var bestScore float64
+	for _, rule := range rules {
+		r := rs.evaluateRule(rule, run, policy != PolicyBestScore)
+		if r.Error != nil {
+			return nil, fmt.Errorf("rule '%s': %w", rule.Name, r.Error)
+		}
+		if rule.Output != "" {
+			continue
+		}
+		var score float64
+		if policy == PolicyBestScore {
+			var ok bool
+			if score, ok = r.Value.AsFloat(); !ok || score <= 0 || (best != nil && score <= bestScore) {
+				continue
+			}
+		} else if !r.Matched() {
+			continue
+		}
+		if policy == PolicyHighestPriority && best != nil && rule.Priority <= best.Priority {
+			continue
+		}
+		best, bestScore = rule, score
+
+		fired := &FiredRule{
+			Name:     rule.Name,
+			Priority: rule.Priority,
+			Action:   rule.Action,
+			Value:    r.Value,
+			Score:    score,
+		}
+		switch policy {
+		case PolicyFirstMatch:
+			fired.Reason = "first rule to match in order"
+		case PolicyHighestPriority:
+			fired.Reason = fmt.Sprintf("highest priority (%d) among matching rules", rule.Priority)
+		case PolicyBestScore:
+			fired.Reason = fmt.Sprintf("highest score (%g) among scored rules", score)
+		default:
+			fired.Reason = "rule matched"
+		}
+		if _, fired.Explanation, err = rs.engine.explainContext(rule.Compiled, run.context()); err != nil {
+			return nil, fmt.Errorf("rule '%s': %w", rule.Name, err)
+		}
+
+		switch policy {
+		case PolicyAllMatches:
+			result.Fired = append(result.Fired, fired)
+		case PolicyHighestPriority, PolicyBestScore:
+			// Keep evaluating: a later rule may have a higher priority or score
+			result.Fired = []*FiredRule{fired}
+		default:
+			result.Fired = []*FiredRule{fired}
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
+
+// snapshot returns the enabled rules in evaluation order so evaluation does not hold the lock.
+func (rs *RuleSet) snapshot() []*Rule {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	rules := make([]*Rule, 0, len(rs.order))
+	for _, rule := range rs.order {
+		if !rule.Disabled {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// evaluateRule evaluates a single rule within a run and publishes its fact, if any.
+// match tells whether the value of the rule decides a match, rather than a score.
+func (rs *RuleSet) evaluateRule(rule *Rule, run *ruleRun, match bool) *RuleResult {
+	value, err := rs.engine.evaluateContext(rule.Compiled, run.context(), rule.Name)
+	if err == nil && match && rule.Output == "" && rs.engine.strictTypes {
+		// The value decides whether the rule matched
+		_, err = rs.engine.evaluator.Matched(value)
+	}
+	if err == nil && rule.Output != "" {
+		run.facts[rule.Output] = value
+	}
+	return &RuleResult{Value: value, Error: err, truthiness: rs.engine.truthiness}
+}
@@ -0,0 +1,329 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRuleSet(t *testing.T) *RuleSet {
+	t.Helper()
+
+	eng, err := New()
+	require.NoError(t, err)
+
+	rs := eng.NewRuleSet()
+	require.NoError(t, rs.Add("adult", "$.age >= 18"))
+	require.NoError(t, rs.Add("admin", `$.role == "admin"`))
+	require.NoError(t, rs.Add("vip", "$.score > 90"))
+	return rs
+}
+
+func TestRuleSet_Add(t *testing.T) {
+	rs := newTestRuleSet(t)
+
+	assert.Equal(t, 3, rs.Len())
+	assert.Equal(t, []string{"adult", "admin", "vip"}, rs.Names())
+
+	t.Run("duplicate name", func(t *testing.T) {
+		err := rs.Add("adult", "$.age > 21")
+		assert.Error(t, err)
+	})
+
+	t.Run("empty name", func(t *testing.T) {
+		err := rs.Add("", "true")
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid expression", func(t *testing.T) {
+		err := rs.Add("broken", "(5 +")
+		assert.Error(t, err)
+		_, ok := rs.Get("broken")
+		assert.False(t, ok)
+	})
+}
+
+func TestRuleSet_Remove(t *testing.T) {
+	rs := newTestRuleSet(t)
+
+	assert.True(t, rs.Remove("admin"))
+	assert.False(t, rs.Remove("admin"))
+	assert.Equal(t, []string{"adult", "vip"}, rs.Names())
+}
+
+func TestRuleSet_EvaluateAll(t *testing.T) {
+	rs := newTestRuleSet(t)
+	require.NoError(t, rs.Add("failing", `$.role - 1`))
+
+	payload := map[string]interface{}{"age": 25, "role": "user", "score": 95}
+
+	results, err := rs.EvaluateAll(payload)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	assert.True(t, results["adult"].Matched())
+	assert.False(t, results["admin"].Matched())
+	assert.True(t, results["vip"].Matched())
+	assert.Error(t, results["failing"].Error)
+	assert.False(t, results["failing"].Matched())
+}
+
+func TestRuleSet_EvaluateUntilFirstMatch(t *testing.T) {
+	rs := newTestRuleSet(t)
+
+	t.Run("first match wins", func(t *testing.T) {
+		name, value, err := rs.EvaluateUntilFirstMatch(map[string]interface{}{"age": 12, "role": "admin", "score": 99})
+		require.NoError(t, err)
+		assert.Equal(t, "admin", name)
+		assert.Equal(t, true, value.Raw)
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		name, _, err := rs.EvaluateUntilFirstMatch(map[string]interface{}{"age": 12, "role": "user", "score": 10})
+		require.NoError(t, err)
+		assert.Empty(t, name)
+	})
+
+	t.Run("rule error stops evaluation", func(t *testing.T) {
+		require.NoError(t, rs.Add("failing", `$.role - 1`))
+		defer rs.Remove("failing")
+
+		_, _, err := rs.EvaluateUntilFirstMatch(map[string]interface{}{"age": 12, "role": "user", "score": 10})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failing")
+	})
+}
+
+func TestRuleSet_EvaluateAny(t *testing.T) {
+	rs := newTestRuleSet(t)
+
+	matched, err := rs.EvaluateAny(map[string]interface{}{"age": 30, "role": "user", "score": 10})
+	require.NoError(t, err)
+	assert.True(t, matched)
+
+	matched, err = rs.EvaluateAny(map[string]interface{}{"age": 10, "role": "user", "score": 10})
+	require.NoError(t, err)
+	assert.False(t, matched)
+}
+
+func TestRuleSet_Fire(t *testing.T) {
+	eng, err := New()
+	require.NoError(t, err)
+
+	newRules := func(policy ConflictPolicy) *RuleSet {
+		rs := eng.NewRuleSet(WithConflictPolicy(policy))
+		require.NoError(t, rs.Add("adult", "$.age >= 18", WithPriority(1)))
+		require.NoError(t, rs.Add("senior", "$.age >= 65", WithPriority(10)))
+		require.NoError(t, rs.Add("minor", "$.age < 18", WithPriority(5)))
+		return rs
+	}
+
+	payload := map[string]interface{}{"age": 70}
+
+	tests := []struct {
+		policy ConflictPolicy
+		want   []string
+	}{
+		{PolicyFirstMatch, []string{"adult"}},
+		{PolicyHighestPriority, []string{"senior"}},
+		{PolicyAllMatches, []string{"adult", "senior"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			result, err := newRules(tt.policy).Fire(payload)
+			require.NoError(t, err)
+			assert.Equal(t, tt.policy, result.Policy)
+			assert.Equal(t, tt.want, result.Names())
+			for _, f := range result.Fired {
+				assert.NotEmpty(t, f.Reason)
+				require.NotNil(t, f.Explanation)
+				assert.Equal(t, true, f.Value.Raw)
+			}
+		})
+	}
+
+	t.Run("priority ties keep insertion order", func(t *testing.T) {
+		rs := eng.NewRuleSet(WithConflictPolicy(PolicyHighestPriority))
+		require.NoError(t, rs.Add("a", "true", WithPriority(3)))
+		require.NoError(t, rs.Add("b", "true", WithPriority(3)))
+
+		result, err := rs.Fire(nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a"}, result.Names())
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		rs := eng.NewRuleSet(WithConflictPolicy(PolicyAllMatches))
+		require.NoError(t, rs.Add("senior", "$.age >= 65"))
+
+		result, err := rs.Fire(map[string]interface{}{"age": 40})
+		require.NoError(t, err)
+		assert.Empty(t, result.Fired)
+	})
+
+	t.Run("actions", func(t *testing.T) {
+		rs := eng.NewRuleSet()
+		require.NoError(t, rs.Add("senior", "$.age >= 65", WithAction(map[string]interface{}{"discount": 15})))
+
+		result, err := rs.Fire(payload)
+		require.NoError(t, err)
+		require.Len(t, result.Fired, 1)
+		assert.Equal(t, map[string]interface{}{"discount": 15}, result.Fired[0].Action)
+	})
+
+	t.Run("best score", func(t *testing.T) {
+		rs := eng.NewRuleSet(WithConflictPolicy(PolicyBestScore))
+		require.NoError(t, rs.Add("fraud", "score([[$.age > 60, 0.4], [$.age > 18, 0.2]])", WithAction("review")))
+		require.NoError(t, rs.Add("loyal", "score([[$.age > 50, 0.7]])", WithAction("reward")))
+		require.NoError(t, rs.Add("flat", "0.7"))
+		require.NoError(t, rs.Add("none", "score([[$.age < 18, 1.0]])"))
+		require.NoError(t, rs.Add("flag", "true"))
+
+		result, err := rs.Fire(payload)
+		require.NoError(t, err)
+		assert.Equal(t, PolicyBestScore, result.Policy)
+		require.Len(t, result.Fired, 1)
+		fired := result.Fired[0]
+		assert.Equal(t, "loyal", fired.Name, "ties keep insertion order")
+		assert.Equal(t, 0.7, fired.Score)
+		assert.Equal(t, "reward", fired.Action)
+		assert.Contains(t, fired.Reason, "0.7")
+
+		result, err = rs.Fire(map[string]interface{}{"age": 10})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"none"}, result.Names())
+	})
+
+	t.Run("best score under strict types", func(t *testing.T) {
+		strict, err := New(WithStrictTypes(true))
+		require.NoError(t, err)
+		rs := strict.NewRuleSet(WithConflictPolicy(PolicyBestScore))
+		require.NoError(t, rs.Add("a", "2"))
+		require.NoError(t, rs.Add("b", "3"))
+
+		result, err := rs.Fire(nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b"}, result.Names())
+	})
+
+	t.Run("set policy", func(t *testing.T) {
+		rs := newRules(PolicyFirstMatch)
+		rs.SetPolicy(PolicyHighestPriority)
+		assert.Equal(t, PolicyHighestPriority, rs.Policy())
+	})
+}
+
+func TestRuleSet_Chaining(t *testing.T) {
+	eng, err := New()
+	require.NoError(t, err)
+
+	t.Run("derived facts feed later rules", func(t *testing.T) {
+		rs := eng.NewRuleSet()
+		// Consumers are added before the producer to exercise dependency ordering
+		require.NoError(t, rs.Add("highRisk", "riskScore > 70"))
+		require.NoError(t, rs.Add("riskScore", "$.chargebacks * 20 + $.disputes * 10", WithOutput("riskScore")))
+		assert.Equal(t, []string{"riskScore", "highRisk"}, rs.Names())
+
+		results, err := rs.EvaluateAll(map[string]interface{}{"chargebacks": 3, "disputes": 2})
+		require.NoError(t, err)
+		require.NoError(t, results["riskScore"].Error)
+		assert.Equal(t, int64(80), results["riskScore"].Value.Raw)
+		assert.True(t, results["highRisk"].Matched())
+
+		name, _, err := rs.EvaluateUntilFirstMatch(map[string]interface{}{"chargebacks": 3, "disputes": 2})
+		require.NoError(t, err)
+		assert.Equal(t, "highRisk", name, "fact-publishing rules are not selected as matches")
+	})
+
+	t.Run("lambda parameters are not dependencies", func(t *testing.T) {
+		rs := eng.NewRuleSet()
+		require.NoError(t, rs.Add("x", "1", WithOutput("x")))
+		require.NoError(t, rs.Add("doubled", "map([1, 2], x => x * 2)", WithOutput("doubled")))
+		require.NoError(t, rs.Add("check", "first(doubled) == 2 && x == 1"))
+
+		result, err := rs.Fire(nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"check"}, result.Names())
+	})
+
+	t.Run("cycle detection", func(t *testing.T) {
+		rs := eng.NewRuleSet()
+		require.NoError(t, rs.Add("a", "b + 1", WithOutput("a")))
+		err := rs.Add("b", "a + 1", WithOutput("b"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cycle")
+		assert.Equal(t, 1, rs.Len())
+
+		err = rs.Add("self", "self + 1", WithOutput("self"))
+		assert.Error(t, err)
+	})
+
+	t.Run("duplicate fact", func(t *testing.T) {
+		rs := eng.NewRuleSet()
+		require.NoError(t, rs.Add("a", "1", WithOutput("score")))
+		assert.Error(t, rs.Add("b", "2", WithOutput("score")))
+	})
+}
+
+func TestRuleSet_Metadata(t *testing.T) {
+	eng, err := New()
+	require.NoError(t, err)
+
+	require.NoError(t, eng.AddRule("velocity", "$.txPerHour > 10",
+		WithTags("fraud"), WithOwner("risk-team"), WithDescription("Too many transactions")))
+	require.NoError(t, eng.AddRule("geo", `$.country NOT IN ["US", "CA"]`, WithTags("fraud", "routing")))
+	require.NoError(t, eng.AddRule("discount", "$.total > 100", WithTags("pricing")))
+	require.NoError(t, eng.AddRule("legacy", "true", WithTags("pricing"), WithEnabled(false)))
+
+	rule, ok := eng.Rules().Get("velocity")
+	require.True(t, ok)
+	assert.Equal(t, "risk-team", rule.Owner)
+	assert.Equal(t, "Too many transactions", rule.Description)
+	assert.True(t, rule.HasTag("fraud"))
+	assert.Equal(t, []string{"fraud", "routing", "pricing"}, eng.Rules().Tags())
+
+	payload := map[string]interface{}{"txPerHour": 20, "country": "DE", "total": 150}
+
+	t.Run("select by tag", func(t *testing.T) {
+		assert.Equal(t, []string{"velocity", "geo"}, eng.SelectRules("fraud").Names())
+		assert.Equal(t, []string{"geo", "discount", "legacy"}, eng.SelectRules("routing", "pricing").Names())
+		assert.Equal(t, 0, eng.SelectRules("unknown").Len())
+	})
+
+	t.Run("disabled rules are skipped", func(t *testing.T) {
+		results, err := eng.Rules().EvaluateTagged(payload, "pricing")
+		require.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.True(t, results["discount"].Matched())
+	})
+
+	t.Run("toggle enabled", func(t *testing.T) {
+		rs := eng.SelectRules("pricing")
+		assert.True(t, rs.SetEnabled("legacy", true))
+		assert.False(t, rs.SetEnabled("missing", true))
+
+		result, err := rs.Fire(payload)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"discount"}, result.Names())
+
+		rs.SetPolicy(PolicyAllMatches)
+		result, err = rs.Fire(payload)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"discount", "legacy"}, result.Names())
+
+		// The catalog is not affected by changes to a selection
+		legacy, _ := eng.Rules().Get("legacy")
+		assert.True(t, legacy.Disabled)
+	})
+
+	t.Run("selection keeps fact producers", func(t *testing.T) {
+		require.NoError(t, eng.AddRule("score", "$.txPerHour * 5", WithOutput("score")))
+		require.NoError(t, eng.AddRule("highScore", "score > 50", WithTags("scoring")))
+
+		result, err := eng.Rules().FireTagged(payload, "scoring")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"highScore"}, result.Names())
+	})
+}
@@ -0,0 +1,155 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/typecheck"
+)
+
+// payloadSchemaURL is the URL the payload schema is compiled under. It only
+// identifies the schema in validation messages.
+const payloadSchemaURL = "payload.json"
+
+// WithPayloadSchema sets a JSON Schema describing the payloads the engine
+// evaluates. New fails if the schema is invalid or references other
+// documents.
+//
+// Every payload is validated against the schema before evaluation, and
+// payloads that do not match fail with errors.ErrInvalidPayload. The schema
+// also supplies the types of payload paths to Compile: operators and function
+// calls applied to incompatible types, such as $.user.age > "18" or
+// $.user.name == 5 when age is an integer and name a string, are compile
+// errors, and paths the schema does not define are reported in
+// CompiledExpression.Warnings. See package typecheck.
+func WithPayloadSchema(schema []byte) Option {
+	return func(e *Engine) {
+		e.payloadSchemaSource = schema
+	}
+}
+
+// WithPayloadStruct sets the payload schema to the schema of the JSON
+// encoding of a Go struct, as WithPayloadSchema does. Field names follow the
+// json struct tags; fields tagged omitempty and pointer fields are optional.
+// v may be a struct value, a pointer to one, or a reflect.Type. See
+// typecheck.SchemaOf.
+func WithPayloadStruct(v interface{}) Option {
+	return func(e *Engine) {
+		e.payloadSchemaSource, _ = json.Marshal(typecheck.SchemaOf(v))
+	}
+}
+
+// payloadSchema is a compiled payload schema.
+type payloadSchema struct {
+	source    []byte
+	types     *typecheck.Schema // Subset of the schema used for type checking
+	validator *jsonschema.Schema
+}
+
+// compilePayloadSchema parses and compiles a JSON Schema for payloads.
+func compilePayloadSchema(source []byte) (*payloadSchema, error) {
+	types, err := typecheck.ParseSchema(source)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := compileJSONSchema(payloadSchemaURL, source, "payload schema")
+	if err != nil {
+		return nil, err
+	}
+
+	return &payloadSchema{source: source, types: types, validator: validator}, nil
+}
+
+// compileJSONSchema compiles a self-contained JSON Schema under url. what
+// names the schema in errors.
+func compileJSONSchema(url string, source []byte, what string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("cannot load %s: the %s must be self-contained", url, what)
+	}
+	if err := compiler.AddResource(url, bytes.NewReader(source)); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "invalid "+what, err)
+	}
+	validator, err := compiler.Compile(url)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "invalid "+what, err)
+	}
+	return validator, nil
+}
+
+// decodeJSON decodes a JSON document for validation, keeping numbers exact.
+func decodeJSON(data string) (interface{}, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&doc)
+	return doc, err
+}
+
+// validate checks a payload, given as JSON, against the schema.
+func (s *payloadSchema) validate(payloadJSON string) error {
+	doc, err := decodeJSON(payloadJSON)
+	if err != nil {
+		return errors.Wrap(errors.ErrInvalidPayload, "payload is not valid JSON", err)
+	}
+	if err := s.validator.Validate(doc); err != nil {
+		if ve, ok := err.(*jsonschema.ValidationError); ok {
+			return errors.New(errors.ErrInvalidPayload, "payload does not match schema: "+violation(ve))
+		}
+		return errors.Wrap(errors.ErrInvalidPayload, "payload does not match schema", err)
+	}
+	return nil
+}
+
+// violation describes the first leaf error of a validation error, such as
+// "/user/age: expected integer, but got string".
+func violation(ve *jsonschema.ValidationError) string {
+	for len(ve.Causes) > 0 {
+		ve = ve.Causes[0]
+	}
+	location := ve.InstanceLocation
+	if location == "" {
+		location = "/"
+	}
+	return location + ": " + ve.Message
+}
+
+// PayloadSchema returns the schema set with WithPayloadSchema, or nil.
+func (e *Engine) PayloadSchema() []byte {
+	if e.payloadSchema == nil {
+		return nil
+	}
+	return e.payloadSchema.source
+}
+
+// ValidatePayload checks a payload against the schema set with
+// WithPayloadSchema. It returns an errors.ErrInvalidPayload error if the
+// payload does not match, and nil if it does or the engine has no schema.
+func (e *Engine) ValidatePayload(payload interface{}) error {
+	_, err := e.newContext(payload)
+	return err
+}
+
+// newContext creates an evaluation context for a payload, validating the
+// payload against the payload schema.
+func (e *Engine) newContext(payload interface{}) (*eval.EvalContext, error) {
+	ctx, err := eval.NewContext(payload)
+	if err != nil {
+		return nil, err
+	}
+	if e.payloadSchema != nil {
+		if err := e.payloadSchema.validate(ctx.PayloadJSON); err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
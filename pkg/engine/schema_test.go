@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const payloadSchemaSource = `{
+	"type": "object",
+	"required": ["user"],
+	"properties": {
+		"user": {
+			"type": "object",
+			"required": ["age"],
+			"properties": {
+				"name": {"type": "string"},
+				"age": {"type": "integer", "minimum": 0},
+				"tags": {"type": "array", "items": {"type": "string"}}
+			}
+		},
+		"meta": {"type": "object"}
+	}
+}`
+
+func TestEngine_PayloadSchema(t *testing.T) {
+	engine, err := New(WithPayloadSchema([]byte(payloadSchemaSource)))
+	require.NoError(t, err)
+	assert.JSONEq(t, payloadSchemaSource, string(engine.PayloadSchema()))
+
+	t.Run("type errors fail compilation", func(t *testing.T) {
+		_, err := engine.Compile(`$.user.age > "18"`)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrTypeMismatch))
+
+		_, err = engine.Compile(`upper($.user.age) == "X"`)
+		assert.True(t, errors.IsCode(err, errors.ErrArgumentType))
+
+		_, err = engine.Compile(`$.user.name == 5`)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrTypeMismatch))
+		assert.Contains(t, err.Error(), "string == int is always false")
+	})
+
+	t.Run("unknown paths are warnings", func(t *testing.T) {
+		compiled, err := engine.Compile(`$.user.nickname == "x" || $.meta.anything == 1`)
+		require.NoError(t, err)
+		require.Len(t, compiled.Warnings, 1)
+		assert.Equal(t, errors.ErrPathNotFound, compiled.Warnings[0].Code)
+		assert.Contains(t, compiled.Warnings[0].Message, "nickname")
+
+		compiled, err = engine.Compile(`$.user.age >= 18 && $.user.tags[0] == "vip"`)
+		require.NoError(t, err)
+		assert.Empty(t, compiled.Warnings)
+	})
+
+	t.Run("payloads are validated", func(t *testing.T) {
+		ok, err := engine.EvaluateDirectBool(`$.user.age >= 18`, map[string]interface{}{
+			"user": map[string]interface{}{"age": 21},
+		})
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = engine.EvaluateDirect(`$.user.age >= 18`, `{"user": {"age": "21"}}`)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrInvalidPayload))
+		assert.Contains(t, err.Error(), "/user/age")
+
+		assert.True(t, errors.IsCode(engine.ValidatePayload(`{"user": {}}`), errors.ErrInvalidPayload))
+		assert.True(t, errors.IsCode(engine.ValidatePayload(`{"user": {"age": -1}}`), errors.ErrInvalidPayload))
+		assert.NoError(t, engine.ValidatePayload(`{"user": {"age": 1}, "meta": {"x": true}}`))
+	})
+
+	t.Run("rule sets validate once per run", func(t *testing.T) {
+		require.NoError(t, engine.AddRule("adult", `$.user.age >= 18`))
+		_, err := engine.Rules().EvaluateAll(`{"user": {"age": "x"}}`)
+		assert.True(t, errors.IsCode(err, errors.ErrInvalidPayload))
+	})
+
+	t.Run("Validate uses the engine schema", func(t *testing.T) {
+		result, err := engine.Validate(`$.user.age > "18"`, nil)
+		require.NoError(t, err)
+		assert.False(t, result.Valid)
+	})
+}
+
+func TestEngine_PayloadSchemaInvalid(t *testing.T) {
+	_, err := New(WithPayloadSchema([]byte(`{"type": 3}`)))
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+
+	_, err = New(WithPayloadSchema([]byte(`{"$ref": "https://example.com/schema.json"}`)))
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+}
+
+func TestEngine_PayloadStruct(t *testing.T) {
+	type user struct {
+		Name string   `json:"name"`
+		Age  int      `json:"age"`
+		Tags []string `json:"tags,omitempty"`
+	}
+	engine, err := New(WithPayloadStruct(struct {
+		User *user `json:"user"`
+	}{}))
+	require.NoError(t, err)
+
+	_, err = engine.Compile(`$.user.age > "18"`)
+	assert.True(t, errors.IsCode(err, errors.ErrTypeMismatch))
+	_, err = engine.Compile(`"vip" IN $.user.name`)
+	assert.True(t, errors.IsCode(err, errors.ErrTypeMismatch))
+
+	compiled, err := engine.Compile(`$.user.age >= 18 && $.user.nickname == "x"`)
+	require.NoError(t, err)
+	require.Len(t, compiled.Warnings, 1)
+	assert.Contains(t, compiled.Warnings[0].Message, "nickname")
+
+	ok, err := engine.EvaluateBool(compiled, `{"user": {"name": "Ann", "age": 30}}`)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, errors.IsCode(engine.ValidatePayload(`{"user": {"name": "Ann"}}`), errors.ErrInvalidPayload))
+}
+
+func TestEngine_NoPayloadSchema(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	// Without a schema, comparisons with payload paths are not checked.
+	compiled, err := engine.Compile(`$.user.age > "18"`)
+	require.NoError(t, err)
+	assert.Empty(t, compiled.Warnings)
+	assert.Nil(t, engine.PayloadSchema())
+	assert.NoError(t, engine.ValidatePayload(`{"anything": 1}`))
+}
@@ -0,0 +1,110 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// MatchesSchemaName is the name of the function testing values against the
+// schemas registered with WithSchema.
+const MatchesSchemaName = "matchesSchema"
+
+// namedSchemaURL is the URL named schemas are compiled under.
+const namedSchemaURL = "schema.json"
+
+// WithSchema registers a JSON Schema under a name, for expressions to test
+// parts of the payload against with matchesSchema(value, name), as in
+// matchesSchema($.shipping.address, "address"). New fails if the schema is
+// invalid or references other documents. Unlike WithPayloadSchema, payloads
+// that do not match are evaluated as usual.
+func WithSchema(name string, schema []byte) Option {
+	return func(e *Engine) {
+		if e.schemaSources == nil {
+			e.schemaSources = make(map[string][]byte)
+		}
+		e.schemaSources[name] = schema
+	}
+}
+
+// RegisterSchema adds or replaces a named schema, as WithSchema does. The
+// matchesSchema function is registered with the first schema. Tenant engines
+// get their own set of schemas, starting with those passed to New.
+func (e *Engine) RegisterSchema(name string, schema []byte) error {
+	validator, err := compileJSONSchema(namedSchemaURL, schema, "schema '"+name+"'")
+	if err != nil {
+		return err
+	}
+
+	e.schemasMu.Lock()
+	defer e.schemasMu.Unlock()
+
+	if e.schemas == nil {
+		// Replace the function of a cloned registry, which reads the schemas
+		// of another engine
+		e.functions.Unregister(MatchesSchemaName)
+		if err := e.functions.RegisterContextual(MatchesSchemaName, e.matchesSchema, matchesSchemaSignature()); err != nil {
+			return err
+		}
+		e.schemas = make(map[string]*jsonschema.Schema)
+	}
+	e.schemas[name] = validator
+	return nil
+}
+
+// Schemas returns the sorted names of the schemas registered with WithSchema
+// and RegisterSchema.
+func (e *Engine) Schemas() []string {
+	e.schemasMu.RLock()
+	defer e.schemasMu.RUnlock()
+
+	names := make([]string, 0, len(e.schemas))
+	for name := range e.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func matchesSchemaSignature() *types.FunctionSignature {
+	return types.NewFunctionSignature(MatchesSchemaName, types.TypeBool,
+		types.DescribedParam("value", types.TypeAny, "The value to test"),
+		types.DescribedParam("schema", types.TypeString, "The name of a schema registered on the engine"),
+	).
+		WithCategory(functions.CategoryUtility).
+		WithDescription("Reports whether a value matches a JSON Schema registered on the engine.").
+		WithExamples(`matchesSchema($.shipping.address, "address")`, `all(map($.items, i => matchesSchema(i, "lineItem")))`)
+}
+
+// matchesSchema implements the matchesSchema function. An unknown schema
+// fails with ErrUndefinedVariable, like an unknown lookup table.
+func (e *Engine) matchesSchema(_ context.Context, _ functions.EvalContext, args ...types.Value) (types.Value, error) {
+	name, ok := args[1].AsString()
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrArgumentType, "schema name must be a string, got %s", args[1].Type)
+	}
+
+	e.schemasMu.RLock()
+	validator, ok := e.schemas[name]
+	e.schemasMu.RUnlock()
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrUndefinedVariable, "unknown schema '%s'", name)
+	}
+
+	data, err := json.Marshal(args[0].Plain())
+	if err != nil {
+		return types.Null(), errors.Wrap(errors.ErrTypeMismatch, "value cannot be encoded as JSON", err)
+	}
+	doc, err := decodeJSON(string(data))
+	if err != nil {
+		return types.Null(), errors.Wrap(errors.ErrTypeMismatch, "value cannot be encoded as JSON", err)
+	}
+	return types.Bool(validator.Validate(doc) == nil), nil
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const addressSchema = `{
+	"type": "object",
+	"required": ["city", "zip"],
+	"properties": {
+		"city": {"type": "string"},
+		"zip": {"type": "string", "pattern": "^[0-9]{5}$"}
+	}
+}`
+
+func TestEngine_MatchesSchema(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	assert.Empty(t, engine.Schemas())
+	assert.False(t, engine.GetFunctionRegistry().Has(MatchesSchemaName))
+
+	engine, err = New(WithSchema("address", []byte(addressSchema)))
+	require.NoError(t, err)
+
+	valid := map[string]interface{}{"shipping": map[string]interface{}{"city": "Izmir", "zip": "35000"}}
+	ok, err := engine.EvaluateDirectBool(`matchesSchema($.shipping, "address")`, valid)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	invalid := map[string]interface{}{"shipping": map[string]interface{}{"city": "Izmir", "zip": 35000}}
+	ok, err = engine.EvaluateDirectBool(`matchesSchema($.shipping, "address")`, invalid)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = engine.EvaluateDirectBool(`matchesSchema($.billing, "address")`, valid)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = engine.EvaluateDirectBool(`matchesSchema($.shipping, "order")`, valid)
+	assert.True(t, errors.IsCode(err, errors.ErrUndefinedVariable))
+
+	require.NoError(t, engine.RegisterSchema("zips", []byte(`{"type": "array", "items": {"type": "string"}}`)))
+	ok, err = engine.EvaluateDirectBool(`matchesSchema(["35000", "06000"], "zips")`, nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"address", "zips"}, engine.Schemas())
+
+	// Tenants start with the schemas passed to New and keep their own
+	tenant, err := engine.ForTenant("t1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"address"}, tenant.Schemas())
+	require.NoError(t, tenant.RegisterSchema("tenant_only", []byte(`{"type": "string"}`)))
+	assert.Equal(t, []string{"address", "zips"}, engine.Schemas())
+}
+
+func TestEngine_MatchesSchemaInvalid(t *testing.T) {
+	_, err := New(WithSchema("broken", []byte(`{"type": 1}`)))
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+
+	_, err = New(WithSchema("remote", []byte(`{"$ref": "https://example.com/address.json"}`)))
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+}
@@ -0,0 +1,95 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"sync/atomic"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/optimizer"
+)
+
+// ClauseStat reports how often a clause of an && or || chain of a compiled
+// expression evaluated to true and false.
+type ClauseStat = optimizer.ClauseStat
+
+// WithClauseStats makes the engine count, for each compiled expression, how
+// often each clause of its && and || chains evaluates to true and false.
+// Read the counts with CompiledExpression.ClauseStats. It is disabled by
+// default.
+func WithClauseStats(enabled bool) Option {
+	return func(e *Engine) {
+		e.clauseStats = enabled
+	}
+}
+
+// WithAdaptiveOrdering enables clause statistics and reorders the clauses of
+// each compiled expression every n evaluations, so that the clauses most
+// likely to short-circuit their chain on real traffic are evaluated first.
+// Only clauses that cannot fail, such as equality and IN tests against list
+// literals, are moved; under WithStrictTypes, where those can fail too, only
+// comparisons with null and of literals are. See optimizer.Reorder. Zero or less disables
+// reordering, the default.
+func WithAdaptiveOrdering(n int) Option {
+	return func(e *Engine) {
+		e.reorderEvery = n
+	}
+}
+
+// ClauseStats returns the outcomes of the clauses of the && and || chains of
+// the expression, in source order, or nil unless the engine was created
+// with WithClauseStats or WithAdaptiveOrdering. Copies made by WithLimits
+// share the statistics of the original.
+func (c *CompiledExpression) ClauseStats() []ClauseStat {
+	if c.clauses == nil {
+		return nil
+	}
+	return c.clauses.stats.Snapshot()
+}
+
+// clauseTracker records the clause outcomes of a compiled expression and
+// holds its current clause order.
+type clauseTracker struct {
+	stats       *optimizer.ClauseStats
+	base        ast.Expression // The optimized expression, in source order
+	every       uint64         // Evaluations between reorderings; zero if disabled
+	strict      bool           // Whether the engine has strict types
+	evaluations atomic.Uint64
+	current     atomic.Pointer[orderedExpression]
+}
+
+type orderedExpression struct {
+	expr ast.Expression
+}
+
+// trackClauses sets up the clause statistics of a compiled expression if
+// the engine collects them.
+func (e *Engine) trackClauses(compiled *CompiledExpression) {
+	if !e.clauseStats && e.reorderEvery <= 0 {
+		return
+	}
+	base := compiled.Optimized
+	if base == nil {
+		base = compiled.AST
+	}
+	t := &clauseTracker{stats: optimizer.NewClauseStats(base), base: base, strict: e.strictTypes}
+	if e.reorderEvery > 0 {
+		t.every = uint64(e.reorderEvery)
+	}
+	t.current.Store(&orderedExpression{expr: base})
+	compiled.clauses = t
+}
+
+// expression returns the expression to evaluate, in the current clause order.
+func (t *clauseTracker) expression() ast.Expression {
+	return t.current.Load().expr
+}
+
+// evaluated counts an evaluation and reorders the clauses when due.
+func (t *clauseTracker) evaluated() {
+	n := t.evaluations.Add(1)
+	if t.every == 0 || n%t.every != 0 {
+		return
+	}
+	reordered := optimizer.Reorder(t.base, t.stats, optimizer.WithStrictTypes(t.strict))
+	t.current.Store(&orderedExpression{expr: reordered})
+}
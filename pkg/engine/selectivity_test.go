@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/optimizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_AdaptiveOrdering(t *testing.T) {
+	const dsl = `$.country == "DE" && $.tier IN ["gold", "platinum"]`
+	payloads := []map[string]interface{}{
+		{"country": "DE", "tier": "gold"},
+		{"country": "DE", "tier": "silver"},
+		{"country": "FR", "tier": "silver"},
+		{"country": "DE", "tier": "bronze"},
+	}
+
+	// The second clause is evaluated in 3 of 4 evaluations, so it has
+	// enough samples after the second period
+	engine, err := New(WithAdaptiveOrdering(2 * optimizer.MinClauseSamples))
+	require.NoError(t, err)
+	compiled, err := engine.Compile(dsl)
+	require.NoError(t, err)
+
+	for i := 0; i < 2*optimizer.MinClauseSamples; i++ {
+		payload := payloads[i%len(payloads)]
+		ok, err := engine.EvaluateBool(compiled, payload)
+		require.NoError(t, err)
+		assert.Equal(t, payload["tier"] == "gold", ok)
+	}
+
+	stats := compiled.ClauseStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, ClauseStat{Clause: `($.country == "DE")`, Operator: "&&", True: 150, False: 50}, stats[0])
+	assert.Equal(t, ClauseStat{Clause: `($.tier IN ["gold", "platinum"])`, Operator: "&&", True: 50, False: 100}, stats[1])
+
+	assert.Equal(t, `(($.tier IN ["gold", "platinum"]) && ($.country == "DE"))`, compiled.clauses.expression().String(),
+		"the clause failing most often moves first")
+	assert.Equal(t, `(($.country == "DE") && ($.tier IN ["gold", "platinum"]))`, compiled.Optimized.String())
+
+	for _, payload := range payloads {
+		ok, err := engine.EvaluateBool(compiled, payload)
+		require.NoError(t, err)
+		assert.Equal(t, payload["tier"] == "gold", ok)
+	}
+	stats = compiled.ClauseStats()
+	assert.Equal(t, uint64(201), stats[0].True+stats[0].False)
+	assert.Equal(t, uint64(154), stats[1].True+stats[1].False)
+
+	t.Run("strict types", func(t *testing.T) {
+		// Moving the second clause first would compare "five" with 5
+		engine, err := New(WithStrictTypes(true), WithAdaptiveOrdering(10))
+		require.NoError(t, err)
+		compiled, err := engine.Compile(`$.kind == "num" && $.value == 5`)
+		require.NoError(t, err)
+		text := map[string]interface{}{"kind": "text", "value": "five"}
+
+		ok, err := engine.EvaluateBool(compiled, text)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		for i := 0; i < 2000; i++ {
+			_, err := engine.EvaluateBool(compiled, map[string]interface{}{"kind": "num", "value": 6})
+			require.NoError(t, err)
+		}
+		ok, err = engine.EvaluateBool(compiled, text)
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, compiled.Optimized.String(), compiled.clauses.expression().String())
+	})
+
+	t.Run("statistics only", func(t *testing.T) {
+		engine, err := New(WithClauseStats(true))
+		require.NoError(t, err)
+		compiled, err := engine.Compile(dsl)
+		require.NoError(t, err)
+		for i := 0; i < 2*optimizer.MinClauseSamples; i++ {
+			_, err := engine.Evaluate(compiled, payloads[2])
+			require.NoError(t, err)
+		}
+		assert.Equal(t, uint64(2*optimizer.MinClauseSamples), compiled.ClauseStats()[0].False)
+		assert.Same(t, compiled.Optimized, compiled.clauses.expression())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		engine, err := New()
+		require.NoError(t, err)
+		compiled, err := engine.Compile(dsl)
+		require.NoError(t, err)
+		assert.Nil(t, compiled.ClauseStats())
+	})
+}
@@ -0,0 +1,169 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/eval"
+)
+
+// compiledMagic prefixes every serialized compiled expression.
+var compiledMagic = []byte("AMELC")
+
+// CompiledFormatVersion is the version of the serialized compiled expression
+// format written by MarshalBinary. UnmarshalBinary rejects other versions.
+const CompiledFormatVersion = 2
+
+// compiledData is the body of a serialized compiled expression.
+type compiledData struct {
+	Source    string          `json:"source"`
+	AST       json.RawMessage `json:"ast"`
+	Optimized json.RawMessage `json:"optimized,omitempty"` // Omitted when identical to AST
+	Functions []string        `json:"functions,omitempty"`
+	Regexes   []string        `json:"regexes,omitempty"`
+	Limits    *Limits         `json:"limits,omitempty"`
+}
+
+// MarshalBinary encodes the compiled expression, including its parsed and
+// optimized trees, so it can be stored or shipped and loaded later without
+// re-parsing. The encoding is deterministic: the same expression compiled by
+// the same engine configuration always produces the same bytes, so artifacts
+// can be hashed and signed.
+//
+// Alongside the trees the encoding records the functions the expression calls
+// and its literal regex patterns, which are checked when the expression is
+// loaded, and the limits set with WithLimits.
+func (c *CompiledExpression) MarshalBinary() ([]byte, error) {
+	tree, err := ast.Marshal(c.AST)
+	if err != nil {
+		return nil, err
+	}
+
+	data := compiledData{Source: c.Source, AST: tree, Limits: c.limits}
+	optimized := c.Optimized
+	if optimized == nil {
+		optimized = c.AST
+	}
+	if optimized != c.AST {
+		opt, err := ast.Marshal(optimized)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(opt, tree) {
+			data.Optimized = opt
+		}
+	}
+	data.Functions, data.Regexes = compiledMetadata(optimized)
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(compiledMagic)+1+len(body))
+	out = append(out, compiledMagic...)
+	out = append(out, CompiledFormatVersion)
+	return append(out, body...), nil
+}
+
+// UnmarshalBinary decodes a compiled expression produced by MarshalBinary.
+// Literal regex patterns are compiled to make sure they are valid. Use
+// Engine.LoadCompiled to also check that the called functions are registered.
+func (c *CompiledExpression) UnmarshalBinary(b []byte) error {
+	if !bytes.HasPrefix(b, compiledMagic) || len(b) == len(compiledMagic) {
+		return errors.New(errors.ErrInvalidSyntax, "not a compiled AMEL expression")
+	}
+	if version := b[len(compiledMagic)]; version != CompiledFormatVersion {
+		return errors.Newf(errors.ErrInvalidSyntax,
+			"unsupported compiled expression format version %d (expected %d)", version, CompiledFormatVersion)
+	}
+
+	var data compiledData
+	if err := json.Unmarshal(b[len(compiledMagic)+1:], &data); err != nil {
+		return errors.Wrap(errors.ErrInvalidSyntax, "invalid compiled expression", err)
+	}
+
+	tree, err := ast.Unmarshal(data.AST)
+	if err != nil {
+		return errors.Wrap(errors.ErrInvalidSyntax, "invalid compiled expression", err)
+	}
+	optimized := tree
+	if len(data.Optimized) > 0 {
+		optimized, err = ast.Unmarshal(data.Optimized)
+		if err != nil {
+			return errors.Wrap(errors.ErrInvalidSyntax, "invalid compiled expression", err)
+		}
+	}
+
+	for _, pattern := range data.Regexes {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return errors.Wrap(errors.ErrInvalidSyntax, fmt.Sprintf("invalid regex pattern %q", pattern), err)
+		}
+	}
+
+	c.AST = tree
+	c.Optimized = optimized
+	c.Source = data.Source
+	c.limits = data.Limits
+	c.hash = ast.Hash(tree)
+	return nil
+}
+
+// LoadCompiled decodes a compiled expression produced by
+// CompiledExpression.MarshalBinary and checks that every function it calls is
+// registered with this engine and called with matching arguments. The loaded expression is not added to the
+// compile cache.
+func (e *Engine) LoadCompiled(b []byte) (*CompiledExpression, error) {
+	compiled := &CompiledExpression{}
+	if err := compiled.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	names, _ := compiledMetadata(compiled.Optimized)
+	for _, name := range names {
+		if !e.functions.Has(name) {
+			return nil, errors.Newf(errors.ErrUndefinedFunction, "compiled expression calls unknown function '%s'", name)
+		}
+	}
+	warnings, err := e.checkTypes(compiled.AST)
+	if err != nil {
+		return nil, err
+	}
+	compiled.Warnings = warnings
+	e.trackClauses(compiled)
+	e.compileProgram(compiled)
+	return compiled, nil
+}
+
+// compiledMetadata returns the sorted, de-duplicated names of the registry
+// functions called by expr and the literal patterns of its regex matches.
+func compiledMetadata(expr ast.Expression) (functions, regexes []string) {
+	seenFunctions := make(map[string]bool)
+	seenRegexes := make(map[string]bool)
+
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		switch n := node.(type) {
+		case *ast.FunctionCall:
+			if !eval.IsHigherOrderFunction(n.Name) && !seenFunctions[n.Name] {
+				seenFunctions[n.Name] = true
+				functions = append(functions, n.Name)
+			}
+		case *ast.RegexExpression:
+			if lit, ok := n.Pattern.(*ast.StringLiteral); ok && !seenRegexes[lit.Value] {
+				seenRegexes[lit.Value] = true
+				regexes = append(regexes, lit.Value)
+			}
+		}
+		return true
+	})
+
+	sort.Strings(functions)
+	sort.Strings(regexes)
+	return functions, regexes
+}
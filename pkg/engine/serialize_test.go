@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompiledExpression_MarshalBinary(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{
+		"user":  map[string]interface{}{"name": "John Smith", "age": 30, "tags": []interface{}{"a", "b"}},
+		"score": 7.5,
+	}
+
+	exprs := []string{
+		`$.user.age >= 18 AND $.user.name =~ "^John"`,
+		`1 + 2 * 3 == 7`,
+		`NOT ($.score < 5.5) || $.missing == null`,
+		`$.user.tags[0] IN ["a", "c"] && $.user.name !~ "x"`,
+		`max($.score, 3) > 2 and upper($.user.name) == "JOHN SMITH"`,
+		`len(filter($.user.tags, t => t != "a")) == 1`,
+		`-$.user.age < 0`,
+		`case { $.score > 9 => "high"; $.score > 5 => "mid"; else => "low" } == "mid"`,
+	}
+
+	for _, dsl := range exprs {
+		t.Run(dsl, func(t *testing.T) {
+			compiled, err := engine.Compile(dsl)
+			require.NoError(t, err)
+
+			data, err := compiled.MarshalBinary()
+			require.NoError(t, err)
+
+			again, err := compiled.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, data, again, "encoding should be deterministic")
+
+			loaded, err := engine.LoadCompiled(data)
+			require.NoError(t, err)
+			assert.Equal(t, compiled.Source, loaded.Source)
+			assert.Equal(t, compiled.AST.String(), loaded.AST.String())
+			assert.Equal(t, compiled.Optimized.String(), loaded.Optimized.String())
+			assert.Equal(t, compiled.AST, loaded.AST)
+
+			want, err := engine.Evaluate(compiled, payload)
+			require.NoError(t, err)
+			got, err := engine.Evaluate(loaded, payload)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestCompiledExpression_UnmarshalBinaryErrors(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	compiled, err := engine.Compile(`$.name =~ "^a"`)
+	require.NoError(t, err)
+	data, err := compiled.MarshalBinary()
+	require.NoError(t, err)
+
+	var c CompiledExpression
+	assert.Error(t, c.UnmarshalBinary([]byte("$.a > 1")))
+	assert.Error(t, c.UnmarshalBinary(data[:len(data)-3]))
+
+	t.Run("version mismatch", func(t *testing.T) {
+		bad := append([]byte{}, data...)
+		bad[len(compiledMagic)] = CompiledFormatVersion + 1
+		err := c.UnmarshalBinary(bad)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "format version")
+	})
+
+	t.Run("invalid regex", func(t *testing.T) {
+		bad := []byte(string(data[:len(compiledMagic)+1]) +
+			`{"source":"x","ast":{"k":"bool","tok":{"t":0}},"regexes":["("]}`)
+		assert.Error(t, c.UnmarshalBinary(bad))
+	})
+}
+
+func TestEngine_LoadCompiledUnknownFunction(t *testing.T) {
+	source, err := New()
+	require.NoError(t, err)
+	require.NoError(t, source.RegisterFunction(`function double(x) { return x * 2; }`))
+
+	compiled, err := source.Compile(`double($.n) > 4`)
+	require.NoError(t, err)
+	data, err := compiled.MarshalBinary()
+	require.NoError(t, err)
+
+	target, err := New()
+	require.NoError(t, err)
+	_, err = target.LoadCompiled(data)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrUndefinedFunction))
+
+	loaded, err := source.LoadCompiled(data)
+	require.NoError(t, err)
+	result, err := source.Evaluate(loaded, map[string]interface{}{"n": 3})
+	require.NoError(t, err)
+	assert.True(t, result.IsTruthy())
+}
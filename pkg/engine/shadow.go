@@ -0,0 +1,114 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// ShadowOutcome is the result of one side of a shadow evaluation.
+type ShadowOutcome struct {
+	Value types.Value
+	Err   error
+}
+
+// MarshalJSON encodes the outcome as {"result", "type", "error"}.
+func (o ShadowOutcome) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Result interface{} `json:"result"`
+		Type   string      `json:"type"`
+		Error  string      `json:"error,omitempty"`
+	}{Result: o.Value.Raw, Type: o.Value.Type.String()}
+	if o.Err != nil {
+		out.Result, out.Type, out.Error = nil, "null", o.Err.Error()
+	}
+	return json.Marshal(out)
+}
+
+// same reports whether two outcomes are indistinguishable to a caller: equal
+// values, or errors with the same message.
+func (o ShadowOutcome) same(other ShadowOutcome) bool {
+	if o.Err != nil || other.Err != nil {
+		return o.Err != nil && other.Err != nil && o.Err.Error() == other.Err.Error()
+	}
+	return o.Value.Type == other.Value.Type && o.Value.Equals(other.Value)
+}
+
+// ShadowDifference records a payload for which the current and candidate
+// expressions disagree.
+type ShadowDifference struct {
+	Index     int           `json:"index"` // Position of the payload in the corpus
+	Payload   interface{}   `json:"payload"`
+	Current   ShadowOutcome `json:"current"`
+	Candidate ShadowOutcome `json:"candidate"`
+}
+
+// ShadowReport summarizes a shadow evaluation over a corpus of payloads.
+type ShadowReport struct {
+	Current     string              `json:"current"`
+	Candidate   string              `json:"candidate"`
+	Total       int                 `json:"total"`
+	Same        int                 `json:"same"`
+	Changed     int                 `json:"changed"`
+	Differences []*ShadowDifference `json:"differences"`
+}
+
+// Shadow evaluates a current and a candidate version of an expression over
+// the same payloads and reports where the results differ, so a rule change can
+// be rehearsed before it is rolled out. Two outcomes are the same if they have
+// equal values of the same type, or if both fail with the same error message.
+// An error is returned only if either expression does not compile.
+func (e *Engine) Shadow(current, candidate string, payloads ...interface{}) (*ShadowReport, error) {
+	cur, err := e.Compile(current)
+	if err != nil {
+		return nil, fmt.Errorf("current expression: %w", err)
+	}
+	cand, err := e.Compile(candidate)
+	if err != nil {
+		return nil, fmt.Errorf("candidate expression: %w", err)
+	}
+
+	report := &ShadowReport{
+		Current:     current,
+		Candidate:   candidate,
+		Differences: []*ShadowDifference{},
+	}
+	for i, payload := range payloads {
+		report.Total++
+		curOut, candOut := e.shadowOutcomes(cur, cand, payload)
+		if curOut.same(candOut) {
+			report.Same++
+			continue
+		}
+		report.Changed++
+		report.Differences = append(report.Differences, &ShadowDifference{
+			Index:     i,
+			Payload:   payload,
+			Current:   curOut,
+			Candidate: candOut,
+		})
+	}
+	return report, nil
+}
+
+// ShadowEvaluate evaluates current and returns its result, and also evaluates
+// candidate against the same payload. If the outcomes differ, onDiff is called
+// before returning. The candidate never affects the returned result, so it can
+// run alongside production traffic.
+func (e *Engine) ShadowEvaluate(current, candidate *CompiledExpression, payload interface{}, onDiff func(*ShadowDifference)) (types.Value, error) {
+	curOut, candOut := e.shadowOutcomes(current, candidate, payload)
+	if !curOut.same(candOut) && onDiff != nil {
+		onDiff(&ShadowDifference{Payload: payload, Current: curOut, Candidate: candOut})
+	}
+	return curOut.Value, curOut.Err
+}
+
+// shadowOutcomes evaluates both expressions against the payload.
+func (e *Engine) shadowOutcomes(current, candidate *CompiledExpression, payload interface{}) (ShadowOutcome, ShadowOutcome) {
+	var curOut, candOut ShadowOutcome
+	curOut.Value, curOut.Err = e.Evaluate(current, payload)
+	candOut.Value, candOut.Err = e.Evaluate(candidate, payload)
+	return curOut, candOut
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Shadow(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	corpus := []interface{}{
+		map[string]interface{}{"age": 17},
+		map[string]interface{}{"age": 18},
+		map[string]interface{}{"age": 30},
+		map[string]interface{}{"age": "unknown"},
+	}
+
+	report, err := engine.Shadow(`$.age >= 18`, `$.age > 18`, corpus...)
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, 3, report.Same, "the type error is identical for both versions")
+	assert.Equal(t, 1, report.Changed)
+	require.Len(t, report.Differences, 1)
+
+	diff := report.Differences[0]
+	assert.Equal(t, 1, diff.Index)
+	assert.Equal(t, types.Bool(true), diff.Current.Value)
+	assert.Equal(t, types.Bool(false), diff.Candidate.Value)
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"current":{"result":true,"type":"bool"}`)
+
+	t.Run("error on one side", func(t *testing.T) {
+		report, err := engine.Shadow(`$.age >= 18`, `$.age / 0 > 1`, corpus[0])
+		require.NoError(t, err)
+		require.Len(t, report.Differences, 1)
+		assert.NoError(t, report.Differences[0].Current.Err)
+		assert.Error(t, report.Differences[0].Candidate.Err)
+	})
+
+	t.Run("compile errors", func(t *testing.T) {
+		_, err := engine.Shadow(`$.age >=`, `$.age > 18`)
+		assert.ErrorContains(t, err, "current expression")
+		_, err = engine.Shadow(`$.age >= 18`, `$.age >`)
+		assert.ErrorContains(t, err, "candidate expression")
+	})
+}
+
+func TestEngine_ShadowEvaluate(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	current, err := engine.Compile(`$.score > 50`)
+	require.NoError(t, err)
+	candidate, err := engine.Compile(`$.score > 60 || $.vip`)
+	require.NoError(t, err)
+
+	var diffs []*ShadowDifference
+	onDiff := func(d *ShadowDifference) { diffs = append(diffs, d) }
+
+	value, err := engine.ShadowEvaluate(current, candidate, map[string]interface{}{"score": 55}, onDiff)
+	require.NoError(t, err)
+	assert.Equal(t, types.Bool(true), value, "the current result is returned")
+	require.Len(t, diffs, 1)
+	assert.Equal(t, types.Bool(false), diffs[0].Candidate.Value)
+
+	value, err = engine.ShadowEvaluate(current, candidate, map[string]interface{}{"score": 90}, onDiff)
+	require.NoError(t, err)
+	assert.Equal(t, types.Bool(true), value)
+	assert.Len(t, diffs, 1)
+
+	broken, err := engine.Compile(`$.score / 0 > 1`)
+	require.NoError(t, err)
+	value, err = engine.ShadowEvaluate(current, broken, map[string]interface{}{"score": 90}, nil)
+	require.NoError(t, err, "candidate errors do not affect the result")
+	assert.Equal(t, types.Bool(true), value)
+}
@@ -0,0 +1,93 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RowFunc receives a row matched by FilterRows, as column name to value.
+// Returning an error stops FilterRows, which returns the error.
+type RowFunc func(row map[string]interface{}) error
+
+// RowStats summarizes a FilterRows run.
+type RowStats struct {
+	Rows    int `json:"rows"`    // Rows read
+	Matched int `json:"matched"` // Rows whose result was truthy
+	Errors  int `json:"errors"`  // Rows that failed to evaluate
+}
+
+// FilterRows evaluates the compiled expression against each row of a query
+// result and calls fn with the rows whose result is truthy. It post-filters
+// result sets when an expression cannot be pushed down to the database with
+// the compiler package.
+//
+// Each column is exposed as $.<column name>, using the name returned by the
+// driver; alias columns with the same name, as in joins, since the last one
+// wins. Byte slices are read as strings and times as RFC 3339 strings. Rows
+// that fail to evaluate are skipped and counted in RowStats.Errors.
+//
+// FilterRows reads rows until they are exhausted, ctx is canceled, or fn
+// returns an error. It does not close rows.
+func (e *Engine) FilterRows(ctx context.Context, expr *CompiledExpression, rows *sql.Rows, fn RowFunc) (RowStats, error) {
+	var stats RowStats
+	columns, err := rows.Columns()
+	if err != nil {
+		return stats, err
+	}
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return stats, err
+		}
+		stats.Rows++
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = sqlValue(values[i])
+		}
+		value, err := e.Evaluate(expr, row)
+		if err != nil {
+			stats.Errors++
+			continue
+		}
+		if !e.IsTruthy(value) {
+			continue
+		}
+		stats.Matched++
+		if err := fn(row); err != nil {
+			return stats, err
+		}
+	}
+	return stats, rows.Err()
+}
+
+// sqlValue converts a value scanned by database/sql to a payload value.
+func sqlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, bool, int64, float64, string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	}
+	return fmt.Sprint(v)
+}
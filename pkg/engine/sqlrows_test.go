@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	stderrors "errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rowsDriver is a database/sql driver whose queries all return the same rows.
+type rowsDriver struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (d *rowsDriver) Open(string) (driver.Conn, error) { return &rowsConn{d}, nil }
+
+type rowsConn struct{ d *rowsDriver }
+
+func (c *rowsConn) Prepare(string) (driver.Stmt, error) { return &rowsStmt{c.d}, nil }
+func (c *rowsConn) Close() error                        { return nil }
+func (c *rowsConn) Begin() (driver.Tx, error)           { return nil, stderrors.New("not supported") }
+
+type rowsStmt struct{ d *rowsDriver }
+
+func (s *rowsStmt) Close() error  { return nil }
+func (s *rowsStmt) NumInput() int { return -1 }
+func (s *rowsStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, stderrors.New("not supported")
+}
+func (s *rowsStmt) Query([]driver.Value) (driver.Rows, error) { return &rowsCursor{d: s.d}, nil }
+
+type rowsCursor struct {
+	d *rowsDriver
+	i int
+}
+
+func (r *rowsCursor) Columns() []string { return r.d.columns }
+func (r *rowsCursor) Close() error      { return nil }
+func (r *rowsCursor) Next(dest []driver.Value) error {
+	if r.i >= len(r.d.rows) {
+		return io.EOF
+	}
+	copy(dest, r.d.rows[r.i])
+	r.i++
+	return nil
+}
+
+func init() {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	sql.Register("amel-test-rows", &rowsDriver{
+		columns: []string{"id", "email", "total", "vip", "created_at"},
+		rows: [][]driver.Value{
+			{int64(1), []byte("ada@example.com"), 120.5, true, created},
+			{int64(2), []byte("bob@example.com"), 80.0, false, created},
+			{int64(3), nil, 300.0, true, created},
+			{int64(4), []byte("eve@example.com"), 99.0, true, nil},
+		},
+	})
+}
+
+func TestEngine_FilterRows(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	db, err := sql.Open("amel-test-rows", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	query := func(t *testing.T) *sql.Rows {
+		rows, err := db.Query("SELECT * FROM orders")
+		require.NoError(t, err)
+		t.Cleanup(func() { rows.Close() })
+		return rows
+	}
+
+	t.Run("matching rows", func(t *testing.T) {
+		expr, err := engine.Compile(`$.vip && $.total > 100 && endsWith($.email, "@example.com")`)
+		require.NoError(t, err)
+
+		var matched []map[string]interface{}
+		stats, err := engine.FilterRows(context.Background(), expr, query(t), func(row map[string]interface{}) error {
+			matched = append(matched, row)
+			return nil
+		})
+		require.NoError(t, err)
+		// Row 3 has a null email, which endsWith rejects
+		assert.Equal(t, RowStats{Rows: 4, Matched: 1, Errors: 1}, stats)
+		require.Len(t, matched, 1)
+		assert.Equal(t, map[string]interface{}{
+			"id": int64(1), "email": "ada@example.com", "total": 120.5, "vip": true,
+			"created_at": "2026-03-01T12:00:00Z",
+		}, matched[0])
+	})
+
+	t.Run("times and nulls", func(t *testing.T) {
+		expr, err := engine.Compile(`$.created_at == null || $.email == null`)
+		require.NoError(t, err)
+		var ids []interface{}
+		_, err = engine.FilterRows(context.Background(), expr, query(t), func(row map[string]interface{}) error {
+			ids = append(ids, row["id"])
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{int64(3), int64(4)}, ids)
+	})
+
+	t.Run("callback error stops", func(t *testing.T) {
+		expr, err := engine.Compile(`true`)
+		require.NoError(t, err)
+		stop := stderrors.New("stop")
+		stats, err := engine.FilterRows(context.Background(), expr, query(t), func(map[string]interface{}) error {
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, stats.Rows)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		expr, err := engine.Compile(`true`)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = engine.FilterRows(ctx, expr, query(t), func(map[string]interface{}) error { return nil })
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,189 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// latencySamples is the number of recent evaluation latencies kept to compute
+// percentiles.
+const latencySamples = 1024
+
+// Stats is a snapshot of the activity of an engine since it was created.
+type Stats struct {
+	Since    time.Time              `json:"since"`
+	Compile  CompileStats           `json:"compile"`
+	Evaluate EvaluationStats        `json:"evaluate"`
+	Errors   map[string]uint64      `json:"errors"` // Compile and evaluation errors by error code name
+	Sandbox  functions.SandboxStats `json:"sandbox"`
+	Lua      functions.SandboxStats `json:"lua"`
+}
+
+// CompileStats reports compilations and the compile cache.
+type CompileStats struct {
+	Compiled     uint64     `json:"compiled"` // Expressions parsed, not counting cache hits
+	Failed       uint64     `json:"failed"`
+	Cache        CacheStats `json:"cache"`
+	CacheHitRate float64    `json:"cacheHitRate"`
+}
+
+// EvaluationStats reports evaluations by outcome and their latency. Latency
+// percentiles are computed over the most recent evaluations and include the
+// time spent in plugin hooks.
+type EvaluationStats struct {
+	Total  uint64        `json:"total"`
+	True   uint64        `json:"true"`
+	False  uint64        `json:"false"`
+	Other  uint64        `json:"other"` // Successful evaluations with a non-boolean result
+	Failed uint64        `json:"failed"`
+	P50    time.Duration `json:"p50Ns"`
+	P99    time.Duration `json:"p99Ns"`
+}
+
+// Stats returns the statistics of the engine. Tenant engines keep their own
+// statistics; the sandbox statistics include every engine sharing the sandbox.
+func (e *Engine) Stats() Stats {
+	stats := e.stats.snapshot()
+	stats.Compile.Cache = e.CacheStats()
+	stats.Compile.CacheHitRate = stats.Compile.Cache.HitRatio()
+	if e.sandbox != nil {
+		stats.Sandbox = e.sandbox.Stats()
+	}
+	stats.Lua = e.luaSandbox.Stats()
+	return stats
+}
+
+// statsCollector accumulates engine statistics. Counters are updated
+// atomically; the latency samples and error counts are guarded by mu.
+type statsCollector struct {
+	since time.Time
+
+	compiled      atomic.Uint64
+	compileFailed atomic.Uint64
+	evaluations   atomic.Uint64
+	trueResults   atomic.Uint64
+	falseResults  atomic.Uint64
+	otherResults  atomic.Uint64
+	failed        atomic.Uint64
+
+	mu        sync.Mutex
+	latencies []time.Duration // Ring buffer of recent evaluation latencies
+	next      int
+	errors    map[string]uint64
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		since:     time.Now(),
+		latencies: make([]time.Duration, 0, latencySamples),
+		errors:    make(map[string]uint64),
+	}
+}
+
+// compile records the outcome of a compilation that was not served from the cache.
+func (s *statsCollector) compile(err error) {
+	if err != nil {
+		s.compileFailed.Add(1)
+		s.error(err)
+		return
+	}
+	s.compiled.Add(1)
+}
+
+// evaluate records the outcome and latency of an evaluation.
+func (s *statsCollector) evaluate(value types.Value, err error, d time.Duration) {
+	s.evaluations.Add(1)
+	switch {
+	case err != nil:
+		s.failed.Add(1)
+	case value.Type == types.TypeBool && value.IsTruthy():
+		s.trueResults.Add(1)
+	case value.Type == types.TypeBool:
+		s.falseResults.Add(1)
+	default:
+		s.otherResults.Add(1)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.latencies) < latencySamples {
+		s.latencies = append(s.latencies, d)
+	} else {
+		s.latencies[s.next] = d
+		s.next = (s.next + 1) % latencySamples
+	}
+	if err != nil {
+		s.errors[errorName(err)]++
+	}
+}
+
+// error counts an error by its code.
+func (s *statsCollector) error(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[errorName(err)]++
+}
+
+func (s *statsCollector) snapshot() Stats {
+	stats := Stats{
+		Since: s.since,
+		Compile: CompileStats{
+			Compiled: s.compiled.Load(),
+			Failed:   s.compileFailed.Load(),
+		},
+		Evaluate: EvaluationStats{
+			Total:  s.evaluations.Load(),
+			True:   s.trueResults.Load(),
+			False:  s.falseResults.Load(),
+			Other:  s.otherResults.Load(),
+			Failed: s.failed.Load(),
+		},
+	}
+
+	s.mu.Lock()
+	latencies := make([]time.Duration, len(s.latencies))
+	copy(latencies, s.latencies)
+	stats.Errors = make(map[string]uint64, len(s.errors))
+	for name, n := range s.errors {
+		stats.Errors[name] = n
+	}
+	s.mu.Unlock()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.Evaluate.P50 = percentile(latencies, 0.50)
+	stats.Evaluate.P99 = percentile(latencies, 0.99)
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted durations using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// errorName returns the name of the error code of err, or "Unknown" for
+// errors that do not carry an AMEL error code.
+func errorName(err error) string {
+	if amelErr, ok := err.(*errors.Error); ok {
+		return amelErr.Code.String()
+	}
+	return errors.ErrorCode(0).String()
+}
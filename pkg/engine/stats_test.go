@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_Stats(t *testing.T) {
+	engine, err := New(WithCaching(true))
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterFunction(`function double(x) { return x * 2; }`))
+
+	payload := map[string]interface{}{"a": 2, "b": 0}
+	for _, dsl := range []string{`$.a > 1`, `$.a > 1`, `$.a < 1`, `double($.a)`, `$.a / $.b`} {
+		_, _ = engine.EvaluateDirect(dsl, payload)
+	}
+	_, err = engine.Compile(`$.a >`)
+	require.Error(t, err)
+
+	stats := engine.Stats()
+	assert.False(t, stats.Since.IsZero())
+	assert.Equal(t, uint64(4), stats.Compile.Compiled)
+	assert.Equal(t, uint64(1), stats.Compile.Failed)
+	assert.Equal(t, uint64(1), stats.Compile.Cache.Hits)
+	assert.InDelta(t, 1.0/6, stats.Compile.CacheHitRate, 0.001)
+
+	assert.Equal(t, EvaluationStats{
+		Total: 5, True: 2, False: 1, Other: 1, Failed: 1,
+		P50: stats.Evaluate.P50, P99: stats.Evaluate.P99,
+	}, stats.Evaluate)
+	assert.Greater(t, stats.Evaluate.P50, time.Duration(0))
+	assert.GreaterOrEqual(t, stats.Evaluate.P99, stats.Evaluate.P50)
+
+	assert.Equal(t, map[string]uint64{"DivisionByZero": 1, "UnexpectedToken": 1}, stats.Errors)
+	assert.Equal(t, uint64(1), stats.Sandbox.Executions)
+}
+
+func TestPercentile(t *testing.T) {
+	assert.Zero(t, percentile(nil, 0.5))
+
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i + 1)
+	}
+	assert.Equal(t, time.Duration(50), percentile(sorted, 0.50))
+	assert.Equal(t, time.Duration(99), percentile(sorted, 0.99))
+	assert.Equal(t, time.Duration(7), percentile([]time.Duration{7}, 0.99))
+}
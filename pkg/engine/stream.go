@@ -0,0 +1,128 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// DefaultMaxLineBytes is the default maximum length of a line read by
+// EvaluateStream.
+const DefaultMaxLineBytes = 1 << 20 // 1 MiB
+
+// StreamOption configures EvaluateStream.
+type StreamOption func(*streamConfig)
+
+type streamConfig struct {
+	filter       bool
+	maxLineBytes int
+}
+
+// StreamFilter makes EvaluateStream copy the input lines whose result is
+// truthy to the output, unchanged, instead of writing a result per line.
+// Lines that fail to evaluate are dropped. Use it to filter logs and events.
+func StreamFilter(enabled bool) StreamOption {
+	return func(c *streamConfig) {
+		c.filter = enabled
+	}
+}
+
+// StreamMaxLineBytes limits the length of an input line. Longer lines stop the
+// stream with an error.
+func StreamMaxLineBytes(n int) StreamOption {
+	return func(c *streamConfig) {
+		c.maxLineBytes = n
+	}
+}
+
+// StreamResult is the output written for one input line by EvaluateStream.
+type StreamResult struct {
+	Line      int         `json:"line"` // 1-based input line number
+	Result    interface{} `json:"result"`
+	Type      string      `json:"type"`
+	Error     string      `json:"error,omitempty"`
+	ErrorCode int         `json:"errorCode,omitempty"`
+}
+
+// StreamStats summarizes a stream evaluation.
+type StreamStats struct {
+	Lines   int `json:"lines"`   // Non-empty input lines
+	Matched int `json:"matched"` // Lines whose result was truthy
+	Errors  int `json:"errors"`  // Lines that failed to evaluate
+}
+
+// EvaluateStream reads newline-delimited JSON payloads from r, evaluates the
+// compiled expression against each, and writes one JSON result per line to w.
+// Empty lines are skipped. Lines that are not valid JSON produce an error
+// result.
+//
+// Each result is written before the next line is read, so a slow writer slows
+// down reading and memory use stays bounded by the line size. The stream stops
+// when r is exhausted, ctx is canceled, or writing fails.
+func (e *Engine) EvaluateStream(ctx context.Context, expr *CompiledExpression, r io.Reader, w io.Writer, opts ...StreamOption) (StreamStats, error) {
+	config := &streamConfig{maxLineBytes: DefaultMaxLineBytes}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	var stats StreamStats
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, min(64*1024, config.maxLineBytes)), config.maxLineBytes)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	lineNo := 0
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		lineNo++
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		stats.Lines++
+
+		result := &StreamResult{Line: lineNo, Type: "null"}
+		matched := false
+		if !json.Valid(line) {
+			result.Error = "invalid JSON payload"
+			result.ErrorCode = int(errors.ErrInvalidPath)
+		} else if value, err := e.Evaluate(expr, string(line)); err != nil {
+			result.Error = err.Error()
+			if amelErr, ok := err.(*errors.Error); ok {
+				result.ErrorCode = int(amelErr.Code)
+			}
+		} else {
+			result.Result = value.Plain()
+			result.Type = value.Type.String()
+			if e.IsTruthy(value) {
+				matched = true
+				stats.Matched++
+			}
+		}
+		if result.Error != "" {
+			stats.Errors++
+		}
+
+		if config.filter {
+			if !matched {
+				continue
+			}
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return stats, err
+			}
+			continue
+		}
+		if err := enc.Encode(result); err != nil {
+			return stats, err
+		}
+	}
+	return stats, scanner.Err()
+}
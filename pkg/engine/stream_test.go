@@ -0,0 +1,62 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_EvaluateStream(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	compiled, err := engine.Compile(`$.n > 1`)
+	require.NoError(t, err)
+
+	in := strings.NewReader("{\"n\":1}\n{\"n\":2}\n\n{\"n\":\"x\"}\n{bad\n")
+	var out bytes.Buffer
+	stats, err := engine.EvaluateStream(context.Background(), compiled, in, &out)
+	require.NoError(t, err)
+	assert.Equal(t, StreamStats{Lines: 4, Matched: 1, Errors: 2}, stats)
+
+	assert.Equal(t, strings.Join([]string{
+		`{"line":1,"result":false,"type":"bool"}`,
+		`{"line":2,"result":true,"type":"bool"}`,
+		`{"line":4,"result":null,"type":"null","error":"Type Error [300] at line 1, column 1: cannot compare string and int","errorCode":300}`,
+		`{"line":5,"result":null,"type":"null","error":"invalid JSON payload","errorCode":500}`,
+	}, "\n")+"\n", out.String())
+}
+
+func TestEngine_EvaluateStreamFilter(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	compiled, err := engine.Compile(`$.level == "error"`)
+	require.NoError(t, err)
+
+	in := strings.NewReader("{\"level\":\"info\"}\n  {\"level\":\"error\",\"msg\":\"a\"}\n{\"level\":\"error\",\"msg\":\"b\"}\n")
+	var out bytes.Buffer
+	stats, err := engine.EvaluateStream(context.Background(), compiled, in, &out, StreamFilter(true))
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Matched)
+	assert.Equal(t, "{\"level\":\"error\",\"msg\":\"a\"}\n{\"level\":\"error\",\"msg\":\"b\"}\n", out.String())
+}
+
+func TestEngine_EvaluateStreamLimits(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	compiled, err := engine.Compile(`true`)
+	require.NoError(t, err)
+
+	_, err = engine.EvaluateStream(context.Background(), compiled,
+		strings.NewReader(`{"a":"`+strings.Repeat("x", 100)+`"}`), &bytes.Buffer{}, StreamMaxLineBytes(32))
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = engine.EvaluateStream(ctx, compiled, strings.NewReader("{}\n"), &bytes.Buffer{})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithStrictTypes(t *testing.T) {
+	payload := map[string]interface{}{
+		"age": 30, "price": 9.5, "id": "30", "active": true, "count": 2,
+		"items": []interface{}{1, 2, 3}, "missing": nil, "createdAt": "2024-05-01",
+	}
+
+	lenient, err := New()
+	require.NoError(t, err)
+	strict, err := New(WithStrictTypes(true))
+	require.NoError(t, err)
+
+	t.Run("allowed", func(t *testing.T) {
+		for dsl, want := range map[string]bool{
+			`$.age == 30 && $.price > 9.0`:               true,
+			`float($.age) > $.price`:                     true,
+			`$.id == "30" && $.missing == null`:          true,
+			`$.active && !($.count == 0)`:                true,
+			`some($.items, x => x > 2)`:                  true,
+			`len(filter($.items, x => x % 2 == 1)) == 2`: true,
+			`$.age / 4 == 7.5`:                           true,
+			`$.age IN [10, 20, 30]`:                      true,
+		} {
+			compiled, err := strict.Compile(dsl)
+			require.NoError(t, err, dsl)
+			value, err := strict.Evaluate(compiled, payload)
+			require.NoError(t, err, dsl)
+			assert.Equal(t, want, value.Raw, dsl)
+		}
+	})
+
+	t.Run("refused when evaluated", func(t *testing.T) {
+		for dsl, code := range map[string]ErrorCode{
+			`$.age == $.id`:                        ErrStrictComparison,
+			`parseDate($.createdAt) > $.createdAt`: ErrStrictComparison,
+			`$.age IN ["30"]`:                      ErrStrictComparison,
+			`$.age > $.price`:                      ErrStrictNumeric,
+			`$.age + $.price > 0`:                  ErrStrictNumeric,
+			`$.count && $.active`:                  ErrStrictTruthiness,
+			`!$.missing`:                           ErrStrictTruthiness,
+			`$.count ? 1 : 0`:                      ErrStrictTruthiness,
+			`filter($.items, x => x)`:              ErrStrictTruthiness,
+			`every($.items, x => x > 0.5)`:         ErrStrictNumeric,
+		} {
+			compiled, err := strict.Compile(dsl)
+			require.NoError(t, err, dsl)
+			_, err = strict.Evaluate(compiled, payload)
+			amelErr, ok := AsError(err)
+			require.True(t, ok, "%s: %v", dsl, err)
+			assert.Equal(t, code, amelErr.Code, dsl)
+
+			_, err = lenient.EvaluateDirect(dsl, payload)
+			assert.NoError(t, err, dsl)
+		}
+	})
+
+	t.Run("refused when compiled", func(t *testing.T) {
+		for dsl, code := range map[string]ErrorCode{
+			`1 + 2 == 3.0`:         ErrStrictNumeric,
+			`len($.items) > 2.5`:   ErrStrictNumeric,
+			`"30" == 30`:           ErrStrictComparison,
+			`1 && $.active`:        ErrStrictTruthiness,
+			`len($.items) ? 1 : 2`: ErrStrictTruthiness,
+		} {
+			_, err := strict.Compile(dsl)
+			amelErr, ok := AsError(err)
+			require.True(t, ok, "%s: %v", dsl, err)
+			assert.Equal(t, code, amelErr.Code, dsl)
+		}
+	})
+
+	t.Run("results", func(t *testing.T) {
+		compiled, err := strict.Compile(`$.count`)
+		require.NoError(t, err)
+		_, err = strict.EvaluateBool(compiled, payload)
+		amelErr, ok := AsError(err)
+		require.True(t, ok)
+		assert.Equal(t, ErrStrictTruthiness, amelErr.Code)
+
+		rules := strict.NewRuleSet()
+		require.NoError(t, rules.Add("counted", `$.count`))
+		require.NoError(t, rules.Add("adult", `$.age >= 18`))
+		results, err := rules.EvaluateAll(payload)
+		require.NoError(t, err)
+		assert.Error(t, results["counted"].Error)
+		assert.True(t, results["adult"].Matched())
+	})
+}
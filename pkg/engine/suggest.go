@@ -0,0 +1,221 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/format"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Suggestion is a change to one payload value that makes a failing clause
+// pass.
+type Suggestion struct {
+	Path    string      `json:"path"`
+	Current interface{} `json:"current"`
+	// Operator is what the value must satisfy against Target: "==", "!=",
+	// "<", "<=", ">", ">=", "in" and "not in" for lists of allowed and
+	// forbidden values, or "contains" and "not contains" for list values.
+	Operator string      `json:"operator"`
+	Target   interface{} `json:"target"`
+	// Value is the value closest to Target that satisfies the clause, if
+	// there is one, such as 18 for >= 18 and 11 for > 10. For "contains" it
+	// is the current list with Target appended.
+	Value   interface{} `json:"value,omitempty"`
+	Clause  string      `json:"clause"`
+	Message string      `json:"message"` // Such as "age must be at least 18 (is 16)"
+}
+
+// SuggestChanges suggests the smallest set of payload changes that would make
+// an expression that did not match match, for "what do I need to qualify?"
+// messages: one change for every failing clause of an && chain, and for an ||
+// chain the changes of the alternative that needs the fewest. Changes are
+// suggested for comparisons and IN tests between a payload path and a value
+// that does not depend on the payload, possibly negated; other failing
+// clauses are left out, so the suggestions may not suffice. It returns nil if
+// the result is truthy, and an error if the evaluation fails.
+func (e *Engine) SuggestChanges(expr *CompiledExpression, payload interface{}) ([]Suggestion, error) {
+	ctx, err := e.newContext(payload)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := e.evaluateRaw(expr, ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if e.IsTruthy(value) {
+		return nil, nil
+	}
+
+	f := &failureExplainer{engine: e, ctx: ctx}
+	suggestions, _ := f.suggest(expr.AST)
+	if suggestions == nil {
+		suggestions = []Suggestion{}
+	}
+	return suggestions, nil
+}
+
+// suggest returns the changes that make node, which evaluated to a falsy
+// value, truthy, and the number of failing clauses it could not suggest a
+// change for.
+func (f *failureExplainer) suggest(node ast.Expression) ([]Suggestion, int) {
+	switch n := node.(type) {
+	case *ast.GroupedExpression:
+		return f.suggest(n.Expression)
+	case *ast.BinaryExpression:
+		switch logicalOperator(n.Operator) {
+		case "&&":
+			var all []Suggestion
+			missing := 0
+			for _, clause := range flattenLogical(n, "&&") {
+				if value, err := f.evaluate(clause); err == nil && !f.engine.IsTruthy(value) {
+					suggestions, m := f.suggest(clause)
+					all = append(all, suggestions...)
+					missing += m
+				}
+			}
+			return all, missing
+		case "||":
+			var best []Suggestion
+			bestMissing := -1
+			for _, clause := range flattenLogical(n, "||") {
+				suggestions, m := f.suggest(clause)
+				if bestMissing < 0 || m < bestMissing || (m == bestMissing && len(suggestions) < len(best)) {
+					best, bestMissing = suggestions, m
+				}
+			}
+			return best, bestMissing
+		}
+	}
+
+	if s, ok := f.suggestClause(node, false); ok {
+		s.Clause = format.Node(node)
+		return []Suggestion{s}, 0
+	}
+	return nil, 1
+}
+
+// negatedOperators maps the requirements of clauses to those of their
+// negations.
+var negatedOperators = map[string]string{
+	"==": "!=", "!=": "==",
+	"<": ">=", ">=": "<",
+	">": "<=", "<=": ">",
+	"in": "not in", "not in": "in",
+	"contains": "not contains", "not contains": "contains",
+}
+
+// flippedOperators maps comparison operators to those with swapped operands.
+var flippedOperators = map[string]string{
+	"==": "==", "!=": "!=",
+	"<": ">", ">": "<",
+	"<=": ">=", ">=": "<=",
+}
+
+// suggestClause returns the change that makes a comparison, IN test, or
+// boolean path pass, or that makes it fail if negated is true.
+func (f *failureExplainer) suggestClause(node ast.Expression, negated bool) (Suggestion, bool) {
+	var path *ast.JSONPathExpression
+	var op string
+	var other ast.Expression
+
+	switch n := node.(type) {
+	case *ast.JSONPathExpression:
+		return f.suggestion(n, "==", types.Bool(!negated)), true
+	case *ast.GroupedExpression:
+		return f.suggestClause(n.Expression, negated)
+	case *ast.UnaryExpression:
+		if n.Operator != "!" && !strings.EqualFold(n.Operator, "not") {
+			return Suggestion{}, false
+		}
+		return f.suggestClause(n.Operand, !negated)
+	case *ast.BinaryExpression:
+		if _, ok := flippedOperators[n.Operator]; !ok {
+			return Suggestion{}, false
+		}
+		if p, ok := n.Left.(*ast.JSONPathExpression); ok {
+			path, op, other = p, n.Operator, n.Right
+		} else if p, ok := n.Right.(*ast.JSONPathExpression); ok {
+			path, op, other = p, flippedOperators[n.Operator], n.Left
+		}
+	case *ast.InExpression:
+		op = "in"
+		if p, ok := n.Left.(*ast.JSONPathExpression); ok {
+			path, other = p, n.Right
+		} else if p, ok := n.Right.(*ast.JSONPathExpression); ok {
+			path, op, other = p, "contains", n.Left
+		}
+		if n.Negated {
+			op = negatedOperators[op]
+		}
+	}
+	if path == nil || len(ast.ExtractPaths(other)) > 0 {
+		return Suggestion{}, false
+	}
+	target, err := f.evaluate(other)
+	if err != nil {
+		return Suggestion{}, false
+	}
+	if negated {
+		op = negatedOperators[op]
+	}
+	return f.suggestion(path, op, target), true
+}
+
+// suggestion returns the change that makes the value of path satisfy op
+// against target.
+func (f *failureExplainer) suggestion(path *ast.JSONPathExpression, op string, target types.Value) Suggestion {
+	current := f.ctx.Lookup(path.Path)
+	s := Suggestion{
+		Path:     path.Path,
+		Current:  current.Plain(),
+		Operator: op,
+		Target:   target.Plain(),
+		Value:    closestValue(op, current, target),
+	}
+	s.Message = fmt.Sprintf("%s %s %s (is %s)", strings.TrimPrefix(s.Path, "$."),
+		requirements[op], describeValue(s.Target), describeValue(s.Current))
+	return s
+}
+
+// requirements phrases the operators of suggestions for messages.
+var requirements = map[string]string{
+	"==":           "must be",
+	"!=":           "must not be",
+	"<":            "must be less than",
+	"<=":           "must be at most",
+	">":            "must be greater than",
+	">=":           "must be at least",
+	"in":           "must be one of",
+	"not in":       "must not be one of",
+	"contains":     "must contain",
+	"not contains": "must not contain",
+}
+
+// closestValue returns the value closest to target that satisfies op, or nil
+// if there is no single closest value.
+func closestValue(op string, current, target types.Value) interface{} {
+	switch op {
+	case "==", "<=", ">=":
+		return target.Plain()
+	case "<", ">":
+		n, ok := target.AsInt()
+		if !ok || target.Type != types.TypeInt {
+			return nil
+		}
+		if op == "<" {
+			return n - 1
+		}
+		return n + 1
+	case "in":
+		if list, ok := target.AsList(); ok && len(list) > 0 {
+			return list[0].Plain()
+		}
+	case "contains":
+		list, _ := current.AsList()
+		return types.List(append(append([]types.Value{}, list...), target)...).Plain()
+	}
+	return nil
+}
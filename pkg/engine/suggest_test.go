@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_SuggestChanges(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	suggest := func(dsl string, payload interface{}) []Suggestion {
+		t.Helper()
+		compiled, err := engine.Compile(dsl)
+		require.NoError(t, err)
+		suggestions, err := engine.SuggestChanges(compiled, payload)
+		require.NoError(t, err)
+		return suggestions
+	}
+	messages := func(suggestions []Suggestion) []string {
+		list := make([]string, len(suggestions))
+		for i, s := range suggestions {
+			list[i] = s.Message
+		}
+		return list
+	}
+
+	payload := map[string]interface{}{
+		"age": 16, "income": 1500.5, "country": "US", "verified": false,
+		"tags": []interface{}{"new"}, "status": "banned",
+	}
+
+	t.Run("and chain", func(t *testing.T) {
+		suggestions := suggest(`$.age >= 18 && $.country IN ["DE", "FR"] && $.income > 1000`, payload)
+		assert.Equal(t, []string{
+			`age must be at least 18 (is 16)`,
+			`country must be one of ["DE","FR"] (is "US")`,
+		}, messages(suggestions))
+		require.Len(t, suggestions, 2)
+		assert.Equal(t, Suggestion{
+			Path:     "$.age",
+			Current:  int64(16),
+			Operator: ">=",
+			Target:   int64(18),
+			Value:    int64(18),
+			Clause:   "$.age >= 18",
+			Message:  "age must be at least 18 (is 16)",
+		}, suggestions[0])
+		assert.Equal(t, "DE", suggestions[1].Value)
+	})
+
+	t.Run("closest values", func(t *testing.T) {
+		suggestions := suggest(`20 < $.age && $.income < 1000.0 && "vip" IN $.tags && $.status NOT IN ["banned"]`, payload)
+		require.Len(t, suggestions, 4)
+		assert.Equal(t, ">", suggestions[0].Operator)
+		assert.Equal(t, int64(21), suggestions[0].Value)
+		assert.Nil(t, suggestions[1].Value, "no closest float below a bound")
+		assert.Equal(t, "contains", suggestions[2].Operator)
+		assert.Equal(t, []interface{}{"new", "vip"}, suggestions[2].Value)
+		assert.Equal(t, "not in", suggestions[3].Operator)
+		assert.Equal(t, `status must not be one of ["banned"] (is "banned")`, suggestions[3].Message)
+	})
+
+	t.Run("negations and boolean paths", func(t *testing.T) {
+		suggestions := suggest(`$.verified && !($.status == "banned")`, payload)
+		assert.Equal(t, []string{
+			`verified must be true (is false)`,
+			`status must not be "banned" (is "banned")`,
+		}, messages(suggestions))
+		assert.Equal(t, `!($.status == "banned")`, suggestions[1].Clause)
+	})
+
+	t.Run("or chain picks the cheapest alternative", func(t *testing.T) {
+		suggestions := suggest(`($.age >= 18 && $.verified) || len($.tags) > 3 || $.country == "DE"`, payload)
+		assert.Equal(t, []string{`country must be "DE" (is "US")`}, messages(suggestions))
+	})
+
+	t.Run("parameters", func(t *testing.T) {
+		compiled, err := engine.Compile(`$.age >= minAge`)
+		require.NoError(t, err)
+		bound, err := compiled.Bind(map[string]interface{}{"minAge": 21})
+		require.NoError(t, err)
+		suggestions, err := engine.SuggestChanges(bound, payload)
+		require.NoError(t, err)
+		assert.Equal(t, []string{`age must be at least 21 (is 16)`}, messages(suggestions))
+	})
+
+	t.Run("unsupported clauses", func(t *testing.T) {
+		assert.Equal(t, []Suggestion{}, suggest(`len($.tags) > 3`, payload))
+	})
+
+	t.Run("match", func(t *testing.T) {
+		assert.Nil(t, suggest(`$.age < 18`, payload))
+	})
+}
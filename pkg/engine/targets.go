@@ -0,0 +1,92 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"sort"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/compiler"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+// TargetResult is the outcome of compiling an expression for one target.
+type TargetResult struct {
+	Target string `json:"target"`
+	OK     bool   `json:"ok"`
+	// Output is the compiled query, such as a *compiler.SQLResult. It is nil
+	// if the compilation failed.
+	Output      interface{}  `json:"output,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// RegisterTarget adds a compile target to this engine only, replacing the
+// target of the same name. Targets registered with compiler.Register are
+// available to every engine.
+func (e *Engine) RegisterTarget(t compiler.Target) {
+	e.targetsMu.Lock()
+	defer e.targetsMu.Unlock()
+	if e.targets == nil {
+		e.targets = make(map[string]compiler.Target)
+	}
+	e.targets[t.Name()] = t
+}
+
+// Compilers returns the compile targets available to the engine, those of
+// the compiler registry and those registered with RegisterTarget, sorted by
+// name.
+func (e *Engine) Compilers() []compiler.Target {
+	byName := make(map[string]compiler.Target)
+	for _, t := range compiler.Targets() {
+		byName[t.Name()] = t
+	}
+	e.targetsMu.Lock()
+	for name, t := range e.targets {
+		byName[name] = t
+	}
+	e.targetsMu.Unlock()
+
+	list := make([]compiler.Target, 0, len(byName))
+	for _, t := range byName {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+// CompileAll compiles an expression for every target returned by Compilers,
+// as a dry run, and reports for each target, in name order, whether it
+// compiled and why not, so that rules can be kept portable across stores. It
+// fails only if the expression does not parse.
+func (e *Engine) CompileAll(dsl string) ([]TargetResult, error) {
+	expr, err := parser.Parse(dsl, parser.WithMaxDepth(e.maxDepth))
+	if err != nil {
+		return nil, err
+	}
+
+	targets := e.Compilers()
+	results := make([]TargetResult, len(targets))
+	for i, t := range targets {
+		results[i] = TargetResult{Target: t.Name(), Diagnostics: []Diagnostic{}}
+		output, err := t.Compile(expr)
+		if err != nil {
+			results[i].Diagnostics = append(results[i].Diagnostics, diagnosticOf(err))
+			continue
+		}
+		results[i].OK = true
+		results[i].Output = output
+	}
+	return results, nil
+}
+
+// diagnosticOf converts an error to an error diagnostic, keeping its AMEL
+// error code and position if it has them.
+func diagnosticOf(err error) Diagnostic {
+	d := Diagnostic{Severity: SeverityError, Code: errors.ErrInvalidSyntax, Message: err.Error()}
+	if amelErr, ok := err.(*errors.Error); ok {
+		d.Code = amelErr.Code
+		d.Message = amelErr.Message
+		d.Line = amelErr.Line
+		d.Column = amelErr.Column
+	}
+	return d
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/compiler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_CompileAll(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	var names []string
+	for _, target := range engine.Compilers() {
+		names = append(names, target.Name())
+	}
+	assert.Equal(t, []string{"mongodb", "mysql", "painless", "postgres", "redisearch", "sql", "sqlite"}, names)
+
+	results, err := engine.CompileAll(`$.age > 18 && $.email !~ "@example\\.com$"`)
+	require.NoError(t, err)
+	require.Len(t, results, 7)
+	for _, r := range append(results[:4:4], results[5]) {
+		assert.True(t, r.OK, r.Target)
+		assert.NotNil(t, r.Output, r.Target)
+		assert.Empty(t, r.Diagnostics, r.Target)
+	}
+	assert.Equal(t, `(("age" > $1) AND "email" !~ $2)`, results[3].Output.(*compiler.SQLResult).SQL)
+	assert.Equal(t, TargetResult{
+		Target: "redisearch",
+		Diagnostics: []Diagnostic{{
+			Severity: SeverityError,
+			Code:     errors.ErrInvalidOperator,
+			Message:  "RediSearch has no regex matching; use startsWith, endsWith, or contains",
+			Line:     1,
+			Column:   15,
+		}},
+	}, results[4])
+	assert.Equal(t, TargetResult{
+		Target: "sqlite",
+		Diagnostics: []Diagnostic{{
+			Severity: SeverityError,
+			Code:     errors.ErrInvalidOperator,
+			Message:  "SQLite does not support NOT REGEXP natively",
+			Line:     1,
+			Column:   15,
+		}},
+	}, results[6])
+
+	t.Run("registered targets", func(t *testing.T) {
+		engine.RegisterTarget(compiler.NewTarget("sql", func(ast.Expression) (interface{}, error) {
+			return nil, errors.New(errors.ErrUndefinedFunction, "not supported")
+		}))
+		engine.RegisterTarget(compiler.NewTarget("search", func(expr ast.Expression) (interface{}, error) {
+			return expr.String(), nil
+		}))
+		results, err := engine.CompileAll(`$.age > 18`)
+		require.NoError(t, err)
+		require.Len(t, results, 8)
+		assert.Equal(t, TargetResult{Target: "search", OK: true, Output: "($.age > 18)", Diagnostics: []Diagnostic{}}, results[5])
+		assert.False(t, results[6].OK)
+		assert.Equal(t, errors.ErrUndefinedFunction, results[6].Diagnostics[0].Code)
+
+		other, err := New()
+		require.NoError(t, err)
+		assert.Len(t, other.Compilers(), 7, "targets registered with an engine are its own")
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		_, err := engine.CompileAll(`$.age >`)
+		assert.Error(t, err)
+	})
+}
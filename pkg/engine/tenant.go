@@ -0,0 +1,119 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"sort"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// WithTenantDefaults sets options applied to every tenant engine created by
+// ForTenant or ConfigureTenant, after the options of the parent engine. Use it
+// to give tenants tighter limits than the host, for example a shorter timeout,
+// a smaller cache, or a stricter sandbox configuration.
+func WithTenantDefaults(opts ...Option) Option {
+	return func(e *Engine) {
+		e.tenantDefaults = append(e.tenantDefaults, opts...)
+	}
+}
+
+// ForTenant returns the engine of the given tenant, creating it on first use.
+//
+// A tenant engine is configured like its parent but has its own function
+// registry, JavaScript sandbox, compile cache, and rule catalog. Its registry
+// starts as a copy of the parent's registry at the time the tenant is created;
+// functions registered on the tenant afterwards are invisible to the parent
+// and to other tenants, and functions registered on the parent afterwards are
+// not added to existing tenants. The same goes for JavaScript modules.
+func (e *Engine) ForTenant(id string) (*Engine, error) {
+	if id == "" {
+		return nil, errors.New(errors.ErrInvalidSyntax, "tenant id cannot be empty")
+	}
+
+	e.tenantsMu.Lock()
+	defer e.tenantsMu.Unlock()
+
+	if tenant, ok := e.tenants[id]; ok {
+		return tenant, nil
+	}
+	return e.newTenant(id, nil)
+}
+
+// ConfigureTenant creates the engine of the given tenant with additional
+// options, which are applied after the parent's options and the tenant
+// defaults. If the tenant already exists it is replaced, discarding its
+// registered functions, cached expressions, and rules.
+func (e *Engine) ConfigureTenant(id string, opts ...Option) (*Engine, error) {
+	if id == "" {
+		return nil, errors.New(errors.ErrInvalidSyntax, "tenant id cannot be empty")
+	}
+
+	e.tenantsMu.Lock()
+	defer e.tenantsMu.Unlock()
+
+	return e.newTenant(id, opts)
+}
+
+// RemoveTenant discards the engine of the given tenant. It reports whether the
+// tenant existed. Engines already returned by ForTenant keep working.
+func (e *Engine) RemoveTenant(id string) bool {
+	e.tenantsMu.Lock()
+	defer e.tenantsMu.Unlock()
+
+	if _, ok := e.tenants[id]; !ok {
+		return false
+	}
+	delete(e.tenants, id)
+	return true
+}
+
+// Tenants returns the ids of all tenants, sorted.
+func (e *Engine) Tenants() []string {
+	e.tenantsMu.Lock()
+	defer e.tenantsMu.Unlock()
+
+	ids := make([]string, 0, len(e.tenants))
+	for id := range e.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// TenantID returns the id of the tenant this engine belongs to, or an empty
+// string for an engine created with New.
+func (e *Engine) TenantID() string {
+	return e.tenantID
+}
+
+// newTenant builds and stores a tenant engine. The caller must hold tenantsMu.
+func (e *Engine) newTenant(id string, extra []Option) (*Engine, error) {
+	opts := make([]Option, 0, len(e.options)+len(e.tenantDefaults)+len(extra)+2)
+	opts = append(opts, e.options...)
+	opts = append(opts,
+		// Never share the parent's registry or sandbox, even if they were
+		// passed to New explicitly.
+		WithFunctions(e.functions.Clone()),
+		func(t *Engine) {
+			if e.sandbox != nil && t.sandbox == e.sandbox {
+				t.sandbox = e.sandbox.Clone()
+			}
+		},
+	)
+	opts = append(opts, e.tenantDefaults...)
+	opts = append(opts, extra...)
+
+	tenant, err := New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	tenant.tenantID = id
+	// Tenants do not inherit the host's tenant defaults for their own tenants.
+	tenant.tenantDefaults = nil
+
+	if e.tenants == nil {
+		e.tenants = make(map[string]*Engine)
+	}
+	e.tenants[id] = tenant
+	return tenant, nil
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_ForTenant(t *testing.T) {
+	host, err := New(WithCaching(true))
+	require.NoError(t, err)
+	require.NoError(t, host.RegisterFunction(`function shared(x) { return x + 1; }`))
+
+	acme, err := host.ForTenant("acme")
+	require.NoError(t, err)
+	again, err := host.ForTenant("acme")
+	require.NoError(t, err)
+	assert.Same(t, acme, again)
+	assert.Equal(t, "acme", acme.TenantID())
+	assert.Empty(t, host.TenantID())
+
+	globex, err := host.ForTenant("globex")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme", "globex"}, host.Tenants())
+
+	t.Run("functions are isolated", func(t *testing.T) {
+		require.NoError(t, acme.RegisterFunction(`function secret(x) { return x * 10; }`))
+
+		value, err := acme.EvaluateDirect(`secret(2) + shared(1)`, map[string]interface{}{})
+		require.NoError(t, err)
+		assert.Equal(t, types.Int(22), value)
+
+		_, err = globex.EvaluateDirect(`secret(2)`, map[string]interface{}{})
+		assert.Error(t, err)
+		_, err = host.EvaluateDirect(`secret(2)`, map[string]interface{}{})
+		assert.Error(t, err)
+	})
+
+	t.Run("resources are not shared", func(t *testing.T) {
+		assert.NotSame(t, host.GetFunctionRegistry(), acme.GetFunctionRegistry())
+		assert.NotSame(t, host.GetSandbox(), acme.GetSandbox())
+		assert.NotSame(t, acme.GetSandbox(), globex.GetSandbox())
+
+		acmeEntries, globexEntries, hostEntries := acme.CacheStats().Entries, globex.CacheStats().Entries, host.CacheStats().Entries
+		_, err := acme.Compile(`$.a > 1`)
+		require.NoError(t, err)
+		assert.Equal(t, acmeEntries+1, acme.CacheStats().Entries)
+		assert.Equal(t, globexEntries, globex.CacheStats().Entries)
+		assert.Equal(t, hostEntries, host.CacheStats().Entries)
+
+		require.NoError(t, acme.AddRule("r", `$.a > 1`))
+		assert.Equal(t, 1, acme.Rules().Len())
+		assert.Equal(t, 0, globex.Rules().Len())
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		assert.True(t, host.RemoveTenant("globex"))
+		assert.False(t, host.RemoveTenant("globex"))
+		assert.Equal(t, []string{"acme"}, host.Tenants())
+	})
+
+	_, err = host.ForTenant("")
+	assert.Error(t, err)
+}
+
+func TestEngine_TenantOptions(t *testing.T) {
+	sandbox := functions.NewSandbox(functions.DefaultSandboxConfig())
+	host, err := New(
+		WithTimeout(time.Second),
+		WithSandbox(sandbox),
+		WithTenantDefaults(WithTimeout(50*time.Millisecond), WithCaching(true), WithCacheSize(2)),
+	)
+	require.NoError(t, err)
+
+	tenant, err := host.ForTenant("t1")
+	require.NoError(t, err)
+	assert.Equal(t, 50*time.Millisecond, tenant.timeout)
+	assert.Equal(t, 2, tenant.CacheStats().MaxEntries)
+	assert.NotSame(t, sandbox, tenant.GetSandbox(), "an explicit parent sandbox is not shared")
+	assert.Equal(t, time.Second, host.timeout)
+
+	require.NoError(t, tenant.RegisterFunction(`function f() { return 1; }`))
+	replaced, err := host.ConfigureTenant("t1", WithCacheSize(5))
+	require.NoError(t, err)
+	assert.NotSame(t, tenant, replaced)
+	assert.Equal(t, 5, replaced.CacheStats().MaxEntries)
+	assert.False(t, replaced.GetFunctionRegistry().Has("f"))
+}
@@ -0,0 +1,25 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// WithTruthiness sets which values count as true, for hosts whose own
+// conventions differ from the defaults, under which null, false, 0, 0.0, "",
+// and [] are falsy. The rules apply to the operands of &&, ||, and !, the
+// condition of ?:, the conditions of case and score, the lambdas of filter, find, some,
+// and every, the bool, all, and any functions, and to deciding whether an
+// expression matched, as in EvaluateBool, rule sets, streams, and failure explanations. For example,
+// types.Truthiness{EmptyListTruthy: true} follows JavaScript, and
+// FalseStrings: []string{"false", "0"} reads flags stored as strings.
+func WithTruthiness(t types.Truthiness) Option {
+	return func(e *Engine) {
+		e.truthiness = &t
+	}
+}
+
+// IsTruthy returns the truthiness of a value under the rules of the engine.
+func (e *Engine) IsTruthy(v types.Value) bool {
+	return e.truthiness.IsTruthy(v)
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTruthiness(t *testing.T) {
+	payload := map[string]interface{}{
+		"tags": []interface{}{}, "name": "", "count": 0, "enabled": "false", "lists": []interface{}{[]interface{}{}, "no"},
+	}
+
+	defaults, err := New()
+	require.NoError(t, err)
+	custom, err := New(WithTruthiness(types.Truthiness{
+		EmptyListTruthy: true,
+		ZeroTruthy:      true,
+		FalseStrings:    []string{"false", "no"},
+	}))
+	require.NoError(t, err)
+
+	tests := []struct {
+		dsl    string
+		def    bool
+		custom bool
+	}{
+		{`$.tags && true`, false, true},
+		{`!$.count`, true, false},
+		{`$.name || $.count`, false, true},
+		{`$.enabled`, true, false},
+		{`bool($.enabled)`, true, false},
+		{`any($.lists)`, true, true},
+		{`all($.lists)`, false, false},
+		{`len(filter($.lists, x => x)) == 1`, true, true},
+		{`find($.lists, x => x) == "no"`, true, false},
+		{`some($.lists, x => x)`, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			for _, c := range []struct {
+				engine *Engine
+				want   bool
+			}{{defaults, tt.def}, {custom, tt.custom}} {
+				compiled, err := c.engine.Compile(tt.dsl)
+				require.NoError(t, err)
+				got, err := c.engine.EvaluateBool(compiled, payload)
+				require.NoError(t, err)
+				assert.Equal(t, c.want, got)
+			}
+		})
+	}
+
+	t.Run("rule sets", func(t *testing.T) {
+		rules := custom.NewRuleSet()
+		require.NoError(t, rules.Add("hasTags", `$.tags`))
+		results, err := rules.EvaluateAll(payload)
+		require.NoError(t, err)
+		assert.True(t, results["hasTags"].Matched())
+	})
+
+	t.Run("empty strings", func(t *testing.T) {
+		assert.False(t, defaults.IsTruthy(types.String("")))
+		assert.False(t, custom.IsTruthy(types.String("")))
+		ruby, err := New(WithTruthiness(types.Truthiness{EmptyStringTruthy: true, EmptyListTruthy: true, ZeroTruthy: true}))
+		require.NoError(t, err)
+		assert.True(t, ruby.IsTruthy(types.String("")))
+		assert.True(t, ruby.IsTruthy(types.Float(0)))
+		assert.False(t, ruby.IsTruthy(types.Null()))
+		assert.False(t, ruby.IsTruthy(types.Bool(false)))
+	})
+}
@@ -0,0 +1,133 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/typecheck"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// DiagnosticSeverity indicates how serious a validation finding is.
+type DiagnosticSeverity = typecheck.Severity
+
+const (
+	// SeverityError marks a finding that makes the expression fail or
+	// misbehave when evaluated.
+	SeverityError = typecheck.SeverityError
+	// SeverityWarning marks a finding that may be intentional.
+	SeverityWarning = typecheck.SeverityWarning
+)
+
+// Diagnostic is a single finding reported by Validate.
+type Diagnostic = typecheck.Diagnostic
+
+// ValidationResult holds the outcome of Validate.
+type ValidationResult struct {
+	// Valid is true when no diagnostic has SeverityError.
+	Valid       bool         `json:"valid"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	// Type is the statically inferred result type, or "any" if it cannot be
+	// determined.
+	Type types.Type `json:"-"`
+}
+
+// Errors returns the diagnostics with SeverityError.
+func (r *ValidationResult) Errors() []Diagnostic {
+	var out []Diagnostic
+	for _, d := range r.Diagnostics {
+		if d.Severity == SeverityError {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Validate checks an expression without evaluating it. It reports syntax
+// errors, calls to unknown functions, calls with the wrong number or types of
+// arguments, and operators applied to incompatible types.
+//
+// If schema is not empty it must be a JSON Schema describing the payload;
+// otherwise the schema set with WithPayloadSchema, if any, is used. The
+// types of payload paths are then taken from the schema, and paths the schema
+// does not define are reported as warnings, unless the object containing them
+// lists no properties. Only "type", "properties",
+// "items", and "additionalProperties" are used.
+//
+// The returned error is non-nil only if the schema itself is invalid.
+func (e *Engine) Validate(dsl string, schema []byte) (*ValidationResult, error) {
+	var root *typecheck.Schema
+	if e.payloadSchema != nil {
+		root = e.payloadSchema.types
+	}
+	if len(schema) > 0 {
+		var err error
+		if root, err = typecheck.ParseSchema(schema); err != nil {
+			return nil, err
+		}
+	}
+
+	expr, err := parser.Parse(dsl, parser.WithMaxDepth(e.maxDepth))
+	if err != nil {
+		return &ValidationResult{Diagnostics: []Diagnostic{diagnosticOf(err)}, Type: types.TypeAny}, nil
+	}
+
+	checked := typecheck.Check(expr, e.typecheckOptions(root)...)
+	result := &ValidationResult{Valid: true, Diagnostics: checked.Diagnostics, Type: checked.Type}
+	if result.Diagnostics == nil {
+		result.Diagnostics = []Diagnostic{}
+	}
+	for _, d := range result.Diagnostics {
+		if d.Severity == SeverityError {
+			result.Valid = false
+		}
+	}
+	return result, nil
+}
+
+// checkTypes returns an error for the first function call in expr whose
+// arguments do not match the signature of the function: a wrong number of
+// arguments, or an argument whose type is known statically and is
+// incompatible with the parameter. Calls to unknown functions are not
+// reported, as the function may be registered after compilation.
+//
+// Literal regex patterns refused by the regex configuration of the engine are
+// reported too. With a payload schema, the types of payload paths are known
+// statically, operators applied to incompatible types are reported too, and
+// the returned warnings list the paths the schema does not define.
+func (e *Engine) checkTypes(expr ast.Expression) ([]Diagnostic, error) {
+	var schema *typecheck.Schema
+	if e.payloadSchema != nil {
+		schema = e.payloadSchema.types
+	}
+	checked := typecheck.Check(expr, e.typecheckOptions(schema)...)
+
+	var warnings []Diagnostic
+	for _, d := range checked.Diagnostics {
+		switch {
+		case d.Code == errors.ErrArgumentCount || d.Code == errors.ErrArgumentType || d.Code == errors.ErrRegexDenied:
+			return nil, errors.NewAt(d.Code, d.Message, d.Line, d.Column)
+		case d.Code == errors.ErrTypeMismatch && schema != nil:
+			return nil, errors.NewAt(d.Code, d.Message, d.Line, d.Column)
+		case d.Code == errors.ErrStrictComparison || d.Code == errors.ErrStrictNumeric || d.Code == errors.ErrStrictTruthiness:
+			return nil, errors.NewAt(d.Code, d.Message, d.Line, d.Column)
+		case d.Code == errors.ErrPathNotFound:
+			warnings = append(warnings, d)
+		}
+	}
+	return warnings, nil
+}
+
+// typecheckOptions returns the options that check expressions with the
+// functions, regex configuration, and type conversions of the engine.
+func (e *Engine) typecheckOptions(schema *typecheck.Schema) []typecheck.Option {
+	return []typecheck.Option{
+		typecheck.WithSchema(schema),
+		typecheck.WithFunctions(e.functions),
+		typecheck.WithRegexCache(e.regexes),
+		typecheck.WithTypeCoercion(e.typeCoercion),
+		typecheck.WithStrictTypes(e.strictTypes),
+		typecheck.WithDecimalArithmetic(e.decimalArithmetic),
+	}
+}
@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validateSchema = `{
+	"type": "object",
+	"additionalProperties": false,
+	"properties": {
+		"user": {
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"name": {"type": "string"},
+				"age": {"type": "integer"},
+				"email": {"type": ["string", "null"]},
+				"tags": {"type": "array", "items": {"type": "string"}}
+			}
+		},
+		"score": {"type": "number"},
+		"extra": {"type": "object"}
+	}
+}`
+
+func TestEngine_Validate(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		dsl      string
+		valid    bool
+		code     errors.ErrorCode
+		severity DiagnosticSeverity
+		typ      types.Type
+	}{
+		{"valid", `$.user.age >= 18 && $.user.name =~ "^J" && $.user.tags[0] IN ["a"]`, true, 0, "", types.TypeBool},
+		{"arithmetic", `$.user.age + $.score`, true, 0, "", types.TypeFloat},
+		{"concatenation", `upper($.user.name) + "!"`, true, 0, "", types.TypeString},
+		{"nullable field", `$.user.email =~ "@"`, true, 0, "", types.TypeBool},
+		{"open object", `$.extra.anything == 1`, true, 0, "", types.TypeBool},
+		{"higher-order", `len(filter($.user.tags, t => t != "x")) > 0`, true, 0, "", types.TypeBool},
+		{"syntax error", `$.user.age >=`, false, 0, SeverityError, types.TypeAny},
+		{"unknown function", `nope($.user.age)`, false, errors.ErrUndefinedFunction, SeverityError, types.TypeAny},
+		{"arity", `upper($.user.name, 1)`, false, errors.ErrArgumentCount, SeverityError, types.TypeAny},
+		{"argument type", `upper($.user.age)`, false, errors.ErrArgumentType, SeverityError, types.TypeAny},
+		{"comparison", `$.user.name > 3`, false, errors.ErrTypeMismatch, SeverityError, types.TypeBool},
+		{"arithmetic mismatch", `$.user.tags * 2`, false, errors.ErrTypeMismatch, SeverityError, types.TypeAny},
+		{"regex on int", `$.user.age =~ "1"`, false, errors.ErrTypeMismatch, SeverityError, types.TypeBool},
+		{"invalid regex", `$.user.name =~ "("`, false, errors.ErrInvalidSyntax, SeverityError, types.TypeBool},
+		{"invalid redact pattern", `redact($.user.name, "(")`, false, errors.ErrInvalidSyntax, SeverityError, types.TypeString},
+		{"IN non-list", `1 IN $.user.name`, false, errors.ErrTypeMismatch, SeverityError, types.TypeBool},
+		{"reduce arity", `reduce($.user.tags, 0)`, false, errors.ErrArgumentCount, SeverityError, types.TypeAny},
+		{"unknown path", `$.user.nickname == "x"`, true, errors.ErrPathNotFound, SeverityWarning, types.TypeBool},
+		{"free identifier", `limit > 3`, true, errors.ErrUndefinedVariable, SeverityWarning, types.TypeBool},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.Validate(tt.dsl, []byte(validateSchema))
+			require.NoError(t, err)
+			assert.Equal(t, tt.valid, result.Valid, "%v", result.Diagnostics)
+			assert.Equal(t, tt.typ, result.Type)
+
+			if tt.severity == "" {
+				assert.Empty(t, result.Diagnostics)
+				return
+			}
+			require.NotEmpty(t, result.Diagnostics)
+			d := result.Diagnostics[0]
+			assert.Equal(t, tt.severity, d.Severity)
+			if tt.code != 0 {
+				assert.Equal(t, tt.code, d.Code, d.Message)
+			}
+			assert.NotZero(t, d.Line)
+			assert.NotZero(t, d.Column)
+		})
+	}
+}
+
+func TestEngine_ValidateWithoutSchema(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	result, err := engine.Validate(`$.anything > 3 && $.other =~ "x"`, nil)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Diagnostics)
+
+	result, err = engine.Validate(`"a" - 1 > 0 && $.a == 1 && nope()`, nil)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	require.Len(t, result.Errors(), 2)
+	assert.Equal(t, errors.ErrTypeMismatch, result.Diagnostics[0].Code)
+	assert.Equal(t, errors.ErrUndefinedFunction, result.Diagnostics[1].Code)
+}
+
+func TestEngine_ValidateJSFunction(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+	require.NoError(t, engine.RegisterFunction(`function double(x) { return x * 2; }`))
+
+	result, err := engine.Validate(`double($.n) > 2`, nil)
+	require.NoError(t, err)
+	assert.True(t, result.Valid, "%v", result.Diagnostics)
+
+	result, err = engine.Validate(`double($.n, 1) > 2`, nil)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, errors.ErrArgumentCount, result.Diagnostics[0].Code)
+}
+
+func TestEngine_ValidateInvalidSchema(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	_, err = engine.Validate(`$.a > 1`, []byte(`{"type": 3}`))
+	assert.Error(t, err)
+}
+
+func TestEngine_CompileChecksCalls(t *testing.T) {
+	engine, err := New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		dsl     string
+		code    errors.ErrorCode
+		message string
+		column  int
+	}{
+		{`substr($.name, 1)`, errors.ErrArgumentCount, "function substr expects 3 arguments, got 2", 1},
+		{`$.a > 1 && upper($.name, "x") == "X"`, errors.ErrArgumentCount, "function upper expects 1 arguments, got 2", 12},
+		{`lower(42) == "x"`, errors.ErrArgumentType, "function lower argument 1: expected string, got int", 1},
+		{`len(substr(upper(1), 0, 2))`, errors.ErrArgumentType, "function upper argument 1", 12},
+		{`len(filter($.items))`, errors.ErrArgumentCount, "function filter requires at least 2 arguments, got 1", 5},
+		{`concat()`, errors.ErrArgumentCount, "function concat expects at least 0 arguments", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			_, err := engine.Compile(tt.dsl)
+			if tt.column == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			amelErr, ok := err.(*errors.Error)
+			require.True(t, ok)
+			assert.Equal(t, tt.code, amelErr.Code)
+			assert.Contains(t, amelErr.Message, tt.message)
+			assert.Equal(t, 1, amelErr.Line)
+			assert.Equal(t, tt.column, amelErr.Column)
+		})
+	}
+
+	// Types only known from the payload are checked at runtime, and unknown
+	// functions may be registered later.
+	_, err = engine.Compile(`lower($.age) == "x" && later($.a)`)
+	require.NoError(t, err)
+}
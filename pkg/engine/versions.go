@@ -0,0 +1,239 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// RuleVersion is one published version of a named rule.
+type RuleVersion struct {
+	Rule        string
+	Version     int // Starts at 1 and increases with every publication
+	Compiled    *CompiledExpression
+	PublishedAt time.Time
+	ActivateAt  time.Time // The version is not used before this time
+	Comment     string
+	RolledBack  bool // Rolled back versions are never active
+}
+
+// clone returns a copy of the version, so callers never share the registry's
+// mutable state. It returns nil for a nil version.
+func (v *RuleVersion) clone() *RuleVersion {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+// Source returns the DSL source of the version.
+func (v *RuleVersion) Source() string {
+	return v.Compiled.Source
+}
+
+// VersionOption configures a rule version when it is published.
+type VersionOption func(*RuleVersion)
+
+// ActivateAt schedules a version to become active at t instead of immediately.
+func ActivateAt(t time.Time) VersionOption {
+	return func(v *RuleVersion) {
+		v.ActivateAt = t
+	}
+}
+
+// WithComment attaches a change description to a version.
+func WithComment(comment string) VersionOption {
+	return func(v *RuleVersion) {
+		v.Comment = comment
+	}
+}
+
+// VersionedResult is the result of evaluating the active version of a rule.
+type VersionedResult struct {
+	Rule    string
+	Version int
+	Value   types.Value
+}
+
+// RuleRegistry stores every published version of named rules. The active
+// version of a rule is the most recently activated version that has reached
+// its activation time and has not been rolled back. Versions returned by the
+// registry are snapshots; later rollbacks do not change them.
+type RuleRegistry struct {
+	mu       sync.RWMutex
+	engine   *Engine
+	versions map[string][]*RuleVersion // Ordered by version number
+	now      func() time.Time
+}
+
+// NewRuleRegistry creates an empty versioned rule registry bound to the engine.
+func (e *Engine) NewRuleRegistry() *RuleRegistry {
+	return &RuleRegistry{
+		engine:   e,
+		versions: make(map[string][]*RuleVersion),
+		now:      time.Now,
+	}
+}
+
+// Publish compiles dsl and stores it as the next version of the named rule.
+// Unless ActivateAt is given, the version becomes active immediately.
+func (r *RuleRegistry) Publish(name, dsl string, opts ...VersionOption) (*RuleVersion, error) {
+	if name == "" {
+		return nil, errors.New(errors.ErrInvalidSyntax, "rule name cannot be empty")
+	}
+	compiled, err := r.engine.Compile(dsl)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	version := &RuleVersion{
+		Rule:        name,
+		Version:     len(r.versions[name]) + 1,
+		Compiled:    compiled,
+		PublishedAt: now,
+		ActivateAt:  now,
+	}
+	for _, opt := range opts {
+		opt(version)
+	}
+
+	r.versions[name] = append(r.versions[name], version)
+	return version.clone(), nil
+}
+
+// Active returns the version of the named rule that is active now.
+func (r *RuleRegistry) Active(name string) (*RuleVersion, bool) {
+	return r.ActiveAt(name, r.now())
+}
+
+// ActiveAt returns the version of the named rule that was, or will be, active
+// at t, given the versions and rollbacks recorded so far.
+func (r *RuleRegistry) ActiveAt(name string, t time.Time) (*RuleVersion, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	active, ok := r.activeAt(name, t, nil)
+	return active.clone(), ok
+}
+
+// activeAt finds the version active at t, ignoring exclude. The caller must
+// hold the lock.
+func (r *RuleRegistry) activeAt(name string, t time.Time, exclude *RuleVersion) (*RuleVersion, bool) {
+	var active *RuleVersion
+	for _, v := range r.versions[name] {
+		if v == exclude || v.RolledBack || v.ActivateAt.After(t) {
+			continue
+		}
+		// The most recently activated version wins; ties go to the newer version.
+		if active == nil || !v.ActivateAt.Before(active.ActivateAt) {
+			active = v
+		}
+	}
+	return active, active != nil
+}
+
+// Version returns a specific version of the named rule.
+func (r *RuleRegistry) Version(name string, version int) (*RuleVersion, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.versions[name]
+	if version < 1 || version > len(versions) {
+		return nil, false
+	}
+	return versions[version-1].clone(), true
+}
+
+// Versions returns all versions of the named rule, oldest first.
+func (r *RuleRegistry) Versions(name string) []*RuleVersion {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := make([]*RuleVersion, len(r.versions[name]))
+	for i, v := range r.versions[name] {
+		versions[i] = v.clone()
+	}
+	return versions
+}
+
+// Names returns the names of all rules, sorted.
+func (r *RuleRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.versions))
+	for name := range r.versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Rollback marks the active version of the named rule as rolled back and
+// returns the version that is active afterwards.
+func (r *RuleRegistry) Rollback(name string) (*RuleVersion, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	current, ok := r.activeAt(name, now, nil)
+	if !ok {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "rule '%s' has no active version", name)
+	}
+	previous, ok := r.activeAt(name, now, current)
+	if !ok {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "rule '%s' has no earlier version to roll back to", name)
+	}
+	current.RolledBack = true
+	return previous.clone(), nil
+}
+
+// RollbackTo makes the given version active again by rolling back every newer
+// version, including versions scheduled for later activation.
+func (r *RuleRegistry) RollbackTo(name string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.versions[name]
+	if version < 1 || version > len(versions) {
+		return errors.Newf(errors.ErrInvalidSyntax, "rule '%s' has no version %d", name, version)
+	}
+	target := versions[version-1]
+	if target.ActivateAt.After(r.now()) {
+		return errors.Newf(errors.ErrInvalidSyntax, "version %d of rule '%s' is not active yet", version, name)
+	}
+
+	target.RolledBack = false
+	for _, v := range versions[version:] {
+		v.RolledBack = true
+	}
+	return nil
+}
+
+// Evaluate evaluates the active version of the named rule and reports which
+// version produced the result.
+func (r *RuleRegistry) Evaluate(name string, payload interface{}) (*VersionedResult, error) {
+	active, ok := r.Active(name)
+	if !ok {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "rule '%s' has no active version", name)
+	}
+
+	ctx, err := r.engine.newContext(payload)
+	if err != nil {
+		return nil, err
+	}
+	value, err := r.engine.evaluateContext(active.Compiled, ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionedResult{Rule: name, Version: active.Version, Value: value}, nil
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRegistry(t *testing.T) (*RuleRegistry, *time.Time) {
+	t.Helper()
+
+	engine, err := New()
+	require.NoError(t, err)
+	registry := engine.NewRuleRegistry()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+	return registry, &now
+}
+
+func TestRuleRegistry_Publish(t *testing.T) {
+	registry, now := newTestRegistry(t)
+
+	v1, err := registry.Publish("adult", `$.age >= 21`, WithComment("initial"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, "initial", v1.Comment)
+
+	v2, err := registry.Publish("adult", `$.age >= 18`)
+	require.NoError(t, err)
+	assert.Equal(t, 2, v2.Version)
+	assert.Equal(t, `$.age >= 18`, v2.Source())
+
+	result, err := registry.Evaluate("adult", map[string]interface{}{"age": 19})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Version)
+	assert.Equal(t, types.Bool(true), result.Value)
+
+	t.Run("scheduled activation", func(t *testing.T) {
+		_, err := registry.Publish("adult", `$.age >= 16`, ActivateAt(now.Add(time.Hour)))
+		require.NoError(t, err)
+
+		active, ok := registry.Active("adult")
+		require.True(t, ok)
+		assert.Equal(t, 2, active.Version)
+
+		future, ok := registry.ActiveAt("adult", now.Add(2*time.Hour))
+		require.True(t, ok)
+		assert.Equal(t, 3, future.Version)
+
+		*now = now.Add(time.Hour)
+		result, err := registry.Evaluate("adult", map[string]interface{}{"age": 17})
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Version)
+		assert.Equal(t, types.Bool(true), result.Value)
+	})
+
+	assert.Len(t, registry.Versions("adult"), 3)
+	assert.Equal(t, []string{"adult"}, registry.Names())
+
+	_, err = registry.Publish("broken", `$.age >=`)
+	assert.Error(t, err)
+	_, err = registry.Evaluate("missing", nil)
+	assert.Error(t, err)
+}
+
+func TestRuleRegistry_Rollback(t *testing.T) {
+	registry, _ := newTestRegistry(t)
+
+	for _, dsl := range []string{`$.v == 1`, `$.v == 2`, `$.v == 3`} {
+		_, err := registry.Publish("rule", dsl)
+		require.NoError(t, err)
+	}
+
+	previous, err := registry.Rollback("rule")
+	require.NoError(t, err)
+	assert.Equal(t, 2, previous.Version)
+
+	v3, ok := registry.Version("rule", 3)
+	require.True(t, ok)
+	assert.True(t, v3.RolledBack)
+
+	require.NoError(t, registry.RollbackTo("rule", 1))
+	active, ok := registry.Active("rule")
+	require.True(t, ok)
+	assert.Equal(t, 1, active.Version)
+
+	_, err = registry.Rollback("rule")
+	assert.Error(t, err, "there is nothing before version 1")
+
+	require.NoError(t, registry.RollbackTo("rule", 3), "a rolled back version can be restored")
+	active, _ = registry.Active("rule")
+	assert.Equal(t, 3, active.Version)
+
+	assert.Error(t, registry.RollbackTo("rule", 9))
+}
@@ -0,0 +1,65 @@
+// Package engine provides the main AMEL engine facade.
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithPrecompile compiles and caches the given expressions when the engine is
+// created, so the first evaluations do not pay for parsing and optimization.
+// It enables caching. New fails with a *WarmupError if any expression does not
+// compile.
+func WithPrecompile(exprs ...string) Option {
+	return func(e *Engine) {
+		e.caching = true
+		e.precompile = append(e.precompile, exprs...)
+	}
+}
+
+// WarmupFailure describes an expression that failed to compile during warmup.
+type WarmupFailure struct {
+	Index  int // Position in the warmup list
+	Source string
+	Err    error
+}
+
+// WarmupError reports every expression that failed to compile during warmup.
+type WarmupError struct {
+	Failures []WarmupFailure
+}
+
+// Error lists the failing expressions.
+func (w *WarmupError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of the precompiled expressions failed to compile", len(w.Failures))
+	for _, f := range w.Failures {
+		fmt.Fprintf(&b, "\n  [%d] %q: %v", f.Index, f.Source, f.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the individual failures.
+func (w *WarmupError) Unwrap() []error {
+	errs := make([]error, len(w.Failures))
+	for i, f := range w.Failures {
+		errs[i] = f.Err
+	}
+	return errs
+}
+
+// Warmup compiles the expressions and, if caching is enabled, stores them in
+// the compile cache. Every expression is attempted; if any fail, the returned
+// *WarmupError lists them all.
+func (e *Engine) Warmup(exprs ...string) error {
+	var failures []WarmupFailure
+	for i, dsl := range exprs {
+		if _, err := e.Compile(dsl); err != nil {
+			failures = append(failures, WarmupFailure{Index: i, Source: dsl, Err: err})
+		}
+	}
+	if failures != nil {
+		return &WarmupError{Failures: failures}
+	}
+	return nil
+}
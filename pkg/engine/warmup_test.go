@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	amelerrors "github.com/bencagri/amel/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithPrecompile(t *testing.T) {
+	exprs := []string{`$.age >= 18`, `upper($.name) == "X"`}
+	engine, err := New(WithPrecompile(exprs...))
+	require.NoError(t, err)
+
+	stats := engine.CacheStats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(2), stats.Misses)
+
+	_, err = engine.EvaluateDirect(`$.age >= 18`, map[string]interface{}{"age": 20})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), engine.CacheStats().Hits)
+}
+
+func TestWithPrecompileErrors(t *testing.T) {
+	_, err := New(WithPrecompile(`$.a > 1`, `$.b >`, `(1 +`))
+	require.Error(t, err)
+
+	var warmupErr *WarmupError
+	require.True(t, errors.As(err, &warmupErr))
+	require.Len(t, warmupErr.Failures, 2)
+	assert.Equal(t, 1, warmupErr.Failures[0].Index)
+	assert.Equal(t, `(1 +`, warmupErr.Failures[1].Source)
+	assert.Contains(t, err.Error(), "2 of the precompiled expressions failed")
+
+	var amelErr *amelerrors.Error
+	assert.True(t, errors.As(err, &amelErr), "individual errors are reachable")
+}
+
+func TestEngine_Warmup(t *testing.T) {
+	engine, err := New(WithCaching(true))
+	require.NoError(t, err)
+
+	require.NoError(t, engine.Warmup(`$.a > 1`, `$.b < 2`))
+	assert.Equal(t, 2, engine.CacheStats().Entries)
+
+	assert.Error(t, engine.Warmup(`$.a >`))
+}
@@ -458,6 +458,106 @@ func TestEveryFunction(t *testing.T) {
 	}
 }
 
+func TestSortWithFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsl      string
+		payload  map[string]interface{}
+		expected []interface{}
+	}{
+		{
+			name:     "numeric comparator descending",
+			dsl:      `sortWith([3, 1, 2], (a, b) => b - a)`,
+			expected: []interface{}{int64(3), int64(2), int64(1)},
+		},
+		{
+			name:     "boolean comparator",
+			dsl:      `sortWith(["ccc", "a", "bb"], (a, b) => len(a) < len(b))`,
+			expected: []interface{}{"a", "bb", "ccc"},
+		},
+		{
+			name: "by field, stable",
+			dsl:  `map(sortWith($.items, (a, b) => a.price - b.price), x => x.id)`,
+			payload: map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"id": "a", "price": 20},
+				map[string]interface{}{"id": "b", "price": 10},
+				map[string]interface{}{"id": "c", "price": 20},
+				map[string]interface{}{"id": "d", "price": 5},
+			}},
+			expected: []interface{}{"d", "b", "a", "c"},
+		},
+		{
+			name:     "default parameters",
+			dsl:      `sortWith([1, 3, 2], b - a)`,
+			expected: []interface{}{int64(3), int64(2), int64(1)},
+		},
+		{
+			name:     "empty list",
+			dsl:      `sortWith([], (a, b) => a - b)`,
+			expected: []interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluator, err := New()
+			if err != nil {
+				t.Fatalf("failed to create evaluator: %v", err)
+			}
+
+			expr, err := parser.Parse(tt.dsl)
+			if err != nil {
+				t.Fatalf("failed to parse DSL: %v", err)
+			}
+
+			ctx, err := NewContext(tt.payload)
+			if err != nil {
+				t.Fatalf("failed to create context: %v", err)
+			}
+
+			result, err := evaluator.Evaluate(expr, ctx)
+			if err != nil {
+				t.Fatalf("evaluation failed: %v", err)
+			}
+
+			list, ok := result.AsList()
+			if !ok {
+				t.Fatalf("expected list result, got %s", result.Type)
+			}
+			if len(list) != len(tt.expected) {
+				t.Fatalf("expected %d elements, got %d", len(tt.expected), len(list))
+			}
+			for i, v := range list {
+				if v.Raw != tt.expected[i] {
+					t.Errorf("element %d: expected %v, got %v", i, tt.expected[i], v.Raw)
+				}
+			}
+		})
+	}
+
+	t.Run("comparator errors", func(t *testing.T) {
+		evaluator, err := New()
+		if err != nil {
+			t.Fatalf("failed to create evaluator: %v", err)
+		}
+		for _, dsl := range []string{
+			`sortWith([1, 2], (a, b) => "x")`,
+			`sortWith([1, 2], (a, b) => a / 0)`,
+			`sortWith([1, 2], a => a)`,
+			`sortWith("abc", (a, b) => a - b)`,
+		} {
+			expr, err := parser.Parse(dsl)
+			if err != nil {
+				t.Fatalf("failed to parse DSL: %v", err)
+			}
+			ctx, _ := NewContext(nil)
+			if _, err := evaluator.Evaluate(expr, ctx); err == nil {
+				t.Errorf("%s: expected an error", dsl)
+			}
+		}
+	})
+}
+
 func TestArrayOpsErrors(t *testing.T) {
 	tests := []struct {
 		name    string
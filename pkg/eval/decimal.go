@@ -0,0 +1,82 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"math/big"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// WithDecimalArithmetic computes +, -, *, /, and % exactly, with decimals,
+// whenever an operand is a float, and / for any two numbers, so that
+// 0.1 + 0.2 == 0.3 holds and 1 / 3 * 3 == 1. Floats are read as the shortest
+// decimal that reads back as the same float. Operations on two ints other
+// than / keep returning ints. Without it, only operations on a decimal, as
+// returned by the decimal function, are exact.
+func WithDecimalArithmetic(enabled bool) Option {
+	return func(e *Evaluator) {
+		e.decimal = enabled
+	}
+}
+
+// evalDecimal applies an arithmetic operator to two numbers exactly if
+// either is a decimal or decimal arithmetic applies. It reports false if the
+// operation is not decimal.
+func (e *Evaluator) evalDecimal(op string, left, right types.Value) (types.Value, bool, error) {
+	if !left.Type.IsNumeric() || !right.Type.IsNumeric() {
+		return types.Null(), false, nil
+	}
+	decimal := left.Type == types.TypeDecimal || right.Type == types.TypeDecimal
+	if e.decimal && op != "~/" {
+		decimal = decimal || left.Type == types.TypeFloat || right.Type == types.TypeFloat || op == "/"
+	}
+	if !decimal {
+		return types.Null(), false, nil
+	}
+
+	l, lok := left.AsDecimal()
+	r, rok := right.AsDecimal()
+	if !lok || !rok {
+		return types.Null(), true, errors.Newf(errors.ErrTypeMismatch,
+			"cannot compute %v %s %v exactly", left.Raw, op, right.Raw)
+	}
+
+	switch op {
+	case "+":
+		return types.Decimal(new(big.Rat).Add(l, r)), true, nil
+	case "-":
+		return types.Decimal(new(big.Rat).Sub(l, r)), true, nil
+	case "*":
+		return types.Decimal(new(big.Rat).Mul(l, r)), true, nil
+	case "/":
+		if r.Sign() == 0 {
+			return types.Null(), true, errors.New(errors.ErrDivisionByZero, "division by zero")
+		}
+		return types.Decimal(new(big.Rat).Quo(l, r)), true, nil
+	case "~/":
+		if r.Sign() == 0 {
+			return types.Null(), true, errors.New(errors.ErrDivisionByZero, "division by zero")
+		}
+		q := truncQuo(l, r)
+		if !q.IsInt64() {
+			return types.Null(), true, errors.Newf(errors.ErrTypeMismatch,
+				"%v ~/ %v is out of the range of an int", left.Raw, right.Raw)
+		}
+		return types.Int(q.Int64()), true, nil
+	case "%":
+		if r.Sign() == 0 {
+			return types.Null(), true, errors.New(errors.ErrDivisionByZero, "modulo by zero")
+		}
+		// The remainder has the sign of the dividend, as with math.Mod
+		q := new(big.Rat).SetInt(truncQuo(l, r))
+		return types.Decimal(new(big.Rat).Sub(l, q.Mul(q, r))), true, nil
+	}
+	return types.Null(), false, nil
+}
+
+// truncQuo returns the quotient of two decimals truncated toward zero.
+func truncQuo(l, r *big.Rat) *big.Int {
+	q := new(big.Rat).Quo(l, r)
+	return new(big.Int).Quo(q.Num(), q.Denom())
+}
@@ -0,0 +1,94 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluator_Decimal(t *testing.T) {
+	payload := map[string]interface{}{"price": 19.99, "qty": 3, "rate": 0.1}
+
+	run := func(t *testing.T, evaluator *Evaluator, input string) (types.Value, error) {
+		t.Helper()
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		ctx, err := NewContext(payload)
+		require.NoError(t, err)
+		return evaluator.Evaluate(expr, ctx)
+	}
+
+	tests := []struct {
+		input    string
+		decimal  bool   // With decimal arithmetic
+		expected string // The result, formatted; "true" or "false" for comparisons
+	}{
+		{`decimal("0.1") + decimal("0.2")`, false, "0.3"},
+		{`decimal(0.1) + 0.2 == 0.3`, false, "true"},
+		{`0.1 + 0.2 == 0.3`, false, "false"},
+		{`0.1 + 0.2 == 0.3`, true, "true"},
+		{`$.price * $.qty`, true, "59.97"},
+		{`$.price * $.qty == 59.97`, true, "true"},
+		{`1 / 3 * 3 == 1`, true, "true"},
+		{`1 / 3`, true, "0.33333333333333333333"},
+		{`10 / 4`, true, "2.5"},
+		{`7 ~/ 2`, true, "3"},
+		{`decimal("-7.5") ~/ 2`, false, "-3"},
+		{`decimal("7.5") % 2`, false, "1.5"},
+		{`decimal("-7.5") % 2`, false, "-1.5"},
+		{`5 + 3`, true, "8"},
+		{`-decimal("1.25")`, false, "-1.25"},
+		{`decimal("1.10") > 1.1`, false, "false"},
+		{`decimal("1.10") >= 1.1`, false, "true"},
+		{`decimal(2.675, 2)`, false, "2.68"},
+		{`decimal(-2.5, 0)`, false, "-3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			evaluator, err := New(WithDecimalArithmetic(tt.decimal))
+			require.NoError(t, err)
+
+			result, err := run(t, evaluator, tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, fmt.Sprint(result.Raw))
+		})
+	}
+
+	t.Run("types", func(t *testing.T) {
+		evaluator, err := New(WithDecimalArithmetic(true))
+		require.NoError(t, err)
+
+		result, err := run(t, evaluator, `0.1 + 0.2`)
+		require.NoError(t, err)
+		assert.Equal(t, types.TypeDecimal, result.Type)
+
+		result, err = run(t, evaluator, `2 * 3`)
+		require.NoError(t, err)
+		assert.Equal(t, types.TypeInt, result.Type)
+	})
+
+	t.Run("division by zero", func(t *testing.T) {
+		evaluator, err := New(WithDecimalArithmetic(true))
+		require.NoError(t, err)
+
+		for _, input := range []string{`1 / 0`, `decimal(1) ~/ 0`, `decimal(1) % 0`} {
+			_, err := run(t, evaluator, input)
+			assert.True(t, errors.IsCode(err, errors.ErrDivisionByZero), input)
+		}
+	})
+
+	t.Run("strict types", func(t *testing.T) {
+		evaluator, err := New(WithStrictTypes(true))
+		require.NoError(t, err)
+
+		_, err = run(t, evaluator, `decimal(1) + 0.5`)
+		assert.True(t, errors.IsCode(err, errors.ErrStrictNumeric))
+	})
+}
@@ -0,0 +1,108 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// YAML is a YAML document used as a payload. NewContext converts it to JSON,
+// so payload paths read it like the equivalent JSON document:
+//
+//	engine.EvaluateDirect(`$.server.port == 8080`, eval.YAML(config))
+//
+// Timestamps are read as RFC 3339 strings, binary values as base64 strings,
+// and mapping keys that are not strings as their string representation.
+type YAML string
+
+// TOML is a TOML document used as a payload. NewContext converts it to JSON,
+// like YAML documents. Offset date-times are read as RFC 3339 strings, and
+// local dates, times, and date-times as strings such as "2024-05-01",
+// "07:30:00", and "2024-05-01T07:30:00".
+type TOML string
+
+// newDocumentContext creates an evaluation context from a YAML or TOML
+// document. Payload holds the decoded document.
+func newDocumentContext(format, doc string) (*EvalContext, error) {
+	var value interface{}
+	var err error
+	switch format {
+	case "YAML":
+		err = yaml.Unmarshal([]byte(doc), &value)
+	case "TOML":
+		var table map[string]interface{}
+		_, err = toml.Decode(doc, &table)
+		value = table
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidPayload, "invalid "+format+" payload", err)
+	}
+
+	return NewContext(documentValue(value))
+}
+
+// documentValue converts a decoded YAML or TOML value to the values
+// marshalJSON supports.
+func documentValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = documentValue(elem)
+		}
+		return v
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, elem := range v {
+			result[fmt.Sprint(k)] = documentValue(elem)
+		}
+		return result
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = documentValue(elem)
+		}
+		return v
+	case []map[string]interface{}:
+		result := make([]interface{}, len(v))
+		for i, elem := range v {
+			result[i] = documentValue(elem)
+		}
+		return result
+	case int:
+		return int64(v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return float64(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		}
+		return v
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		switch v.Location().String() {
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		case "date-local":
+			return v.Format("2006-01-02")
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return value
+}
@@ -0,0 +1,104 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func evalDocument(t *testing.T, payload interface{}, dsl string) types.Value {
+	t.Helper()
+	ctx, err := NewContext(payload)
+	require.NoError(t, err)
+	expr, err := parser.Parse(dsl)
+	require.NoError(t, err)
+	evaluator, err := New()
+	require.NoError(t, err)
+	result, err := evaluator.Evaluate(expr, ctx)
+	require.NoError(t, err)
+	return result
+}
+
+func TestNewContext_YAML(t *testing.T) {
+	doc := YAML(`
+server:
+  host: example.com
+  port: 8080
+  tls: true
+features: [search, export]
+limits:
+  rate: 2.5
+  1: numeric key
+released: 2024-05-01T07:30:00Z
+`)
+
+	tests := []struct {
+		dsl      string
+		expected types.Value
+	}{
+		{`$.server.port == 8080 && $.server.tls`, types.Bool(true)},
+		{`$.server.host`, types.String("example.com")},
+		{`"export" IN $.features`, types.Bool(true)},
+		{`$.limits.rate * 2`, types.Float(5)},
+		{`$.limits["1"]`, types.String("numeric key")},
+		{`$.released`, types.String("2024-05-01T07:30:00Z")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			assert.Equal(t, tt.expected, evalDocument(t, doc, tt.dsl))
+		})
+	}
+
+	_, err := NewContext(YAML("server: [unclosed"))
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidPayload))
+}
+
+func TestNewContext_TOML(t *testing.T) {
+	doc := TOML(`
+title = "service"
+enabled = true
+
+[database]
+port = 5432
+timeout = 1.5
+replicas = ["a", "b"]
+maintenance = 2024-05-01
+window = 07:30:00
+deployed = 2024-05-01T07:30:00Z
+
+[[backends]]
+name = "primary"
+weight = 3
+
+[[backends]]
+name = "secondary"
+weight = 1
+`)
+
+	tests := []struct {
+		dsl      string
+		expected types.Value
+	}{
+		{`$.enabled && $.database.port > 5000`, types.Bool(true)},
+		{`$.database.timeout`, types.Float(1.5)},
+		{`len($.database.replicas)`, types.Int(2)},
+		{`$.database.maintenance`, types.String("2024-05-01")},
+		{`$.database.window`, types.String("07:30:00")},
+		{`$.database.deployed`, types.String("2024-05-01T07:30:00Z")},
+		{`$.backends[1].name`, types.String("secondary")},
+		{`sum(map($.backends, b => b.weight))`, types.Float(4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			assert.Equal(t, tt.expected, evalDocument(t, doc, tt.dsl))
+		})
+	}
+
+	_, err := NewContext(TOML("title = "))
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidPayload))
+}
@@ -0,0 +1,60 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+)
+
+// annotate records on err the node it was raised by: the span of the node,
+// the function it calls, and the payload path it reads. Only the innermost
+// node is recorded; errors passing through enclosing nodes keep it.
+func annotate(err error, node ast.Expression) {
+	amelErr, ok := err.(*errors.Error)
+	if !ok || amelErr.EndLine > 0 {
+		return
+	}
+
+	span := ast.SpanOf(node)
+	amelErr.Line, amelErr.Column = span.Line, span.Column
+	amelErr.EndLine, amelErr.EndColumn = span.EndLine, span.EndColumn
+	if call, ok := node.(*ast.FunctionCall); ok && amelErr.Function == "" {
+		amelErr.Function = call.Name
+	}
+	if amelErr.Path == "" {
+		amelErr.Path = operandPath(node)
+	}
+}
+
+// operandPath returns the payload path a node reads directly: the node
+// itself, or its first operand or argument that is a path.
+func operandPath(node ast.Expression) string {
+	var operands []ast.Expression
+	switch n := node.(type) {
+	case *ast.JSONPathExpression:
+		return n.Path
+	case *ast.BinaryExpression:
+		operands = []ast.Expression{n.Left, n.Right}
+	case *ast.UnaryExpression:
+		operands = []ast.Expression{n.Operand}
+	case *ast.InExpression:
+		operands = []ast.Expression{n.Left, n.Right}
+	case *ast.RegexExpression:
+		operands = []ast.Expression{n.Left, n.Pattern}
+	case *ast.IndexExpression:
+		operands = []ast.Expression{n.Left, n.Index}
+	case *ast.MemberExpression:
+		operands = []ast.Expression{n.Object}
+	case *ast.FunctionCall:
+		operands = n.Arguments
+	}
+	for _, operand := range operands {
+		if grouped, ok := operand.(*ast.GroupedExpression); ok {
+			operand = grouped.Expression
+		}
+		if path, ok := operand.(*ast.JSONPathExpression); ok {
+			return path.Path
+		}
+	}
+	return ""
+}
@@ -4,31 +4,85 @@ package eval
 import (
 	"context"
 	"fmt"
+	"math"
+	"math/big"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bencagri/amel/internal/errors"
 	"github.com/bencagri/amel/pkg/ast"
 	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/parser"
 	"github.com/bencagri/amel/pkg/types"
 	"github.com/tidwall/gjson"
+	"google.golang.org/protobuf/proto"
 )
 
+// comparisonOperators are the binary operators that WithTypeCoercion applies
+// to.
+var comparisonOperators = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
 // Higher-order function names that require special handling
 var higherOrderFunctions = map[string]bool{
-	"map":    true,
-	"filter": true,
-	"reduce": true,
-	"find":   true,
-	"some":   true,
-	"every":  true,
+	"map":      true,
+	"filter":   true,
+	"reduce":   true,
+	"find":     true,
+	"some":     true,
+	"every":    true,
+	"sortWith": true,
+}
+
+// IsHigherOrderFunction reports whether name is a built-in higher-order function
+// (map, filter, reduce, find, some, every, sortWith). These take lambda arguments and are
+// handled by the evaluator rather than the function registry.
+func IsHigherOrderFunction(name string) bool {
+	return higherOrderFunctions[name]
+}
+
+// HigherOrderFunctions returns the names of the built-in higher-order functions, sorted.
+func HigherOrderFunctions() []string {
+	names := make([]string, 0, len(higherOrderFunctions))
+	for name := range higherOrderFunctions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // Evaluator evaluates AST expressions against a payload.
 type Evaluator struct {
-	functions *functions.Registry
-	sandbox   *functions.Sandbox
-	timeout   time.Duration
+	functions     *functions.Registry
+	sandbox       *functions.Sandbox
+	timeout       time.Duration
+	maxIterations int
+	maxCalls      int
+	callLimits    map[string]int
+	maxDepth      int
+	regexes       *functions.RegexCache
+	console       functions.ConsoleFunc
+	truthiness    *types.Truthiness // Nil for the rules of types.Value.IsTruthy
+	coerce        bool              // Whether comparisons convert strings
+	strict        bool              // Whether implicit conversions between types fail
+	safeIndex     bool              // Whether out-of-range indices give null
+	decimal       bool              // Whether arithmetic on floats is exact
+}
+
+// Limits restricts a single evaluation. Zero values keep the evaluator
+// defaults.
+type Limits struct {
+	Timeout       time.Duration `json:"timeout,omitempty"`       // Overrides the evaluator timeout
+	MaxIterations int           `json:"maxIterations,omitempty"` // Overrides the evaluator iteration budget
+	Functions     []string      `json:"functions,omitempty"`     // Functions the expression may call; nil allows all
+	MaxCalls      int           `json:"maxCalls,omitempty"`      // Overrides the evaluator function call budget
+
+	// MaxCallsPerFunction caps the calls of individual functions, such as
+	// {"httpGetJSON": 3}. Entries override the evaluator limits of the same
+	// functions.
+	MaxCallsPerFunction map[string]int `json:"maxCallsPerFunction,omitempty"`
 }
 
 // EvalContext contains the context for evaluation.
@@ -37,6 +91,38 @@ type EvalContext struct {
 	PayloadJSON string                 // The raw JSON string representation
 	Variables   map[string]types.Value // Additional variables
 	ctx         context.Context
+	parent      context.Context // Nil unless WithContext was called
+	calls       *callTracker    // Nil unless TrackCalls was called
+	clauses     ClauseRecorder  // Nil unless RecordClauses was called
+
+	timeout       time.Duration   // Overrides the evaluator timeout if positive
+	maxIterations int             // Overrides the evaluator iteration budget if positive
+	iterations    int             // Lambda applications left; negative if unlimited
+	allowed       map[string]bool // Nil unless a function allowlist is set
+
+	maxCalls    int            // Overrides the evaluator call budget if positive
+	callLimits  map[string]int // Overrides evaluator per-function limits
+	callsLeft   int            // Function calls left; negative if unlimited
+	depth       int            // Nesting depth of the node being evaluated
+	limitsInUse map[string]int // Per-function limits of the current evaluation
+	callCounts  map[string]int // Calls of limited functions so far
+
+	console    functions.ConsoleFunc    // Overrides the evaluator console if set
+	consoleLog []functions.ConsoleEntry // Console output collected for an explanation
+	collecting bool                     // Whether console output is collected
+	replaying  bool                     // Whether an explanation is re-evaluating subexpressions
+}
+
+// ClauseRecorder receives the outcomes of the operands of the && and ||
+// operators, such as an optimizer.ClauseStats.
+type ClauseRecorder interface {
+	Record(clause ast.Expression, truthy bool)
+}
+
+// callTracker records the names of invoked functions in first-call order.
+type callTracker struct {
+	seen  map[string]bool
+	names []string
 }
 
 // Explanation provides detailed information about an evaluation step.
@@ -45,8 +131,18 @@ type Explanation struct {
 	Result     types.Value    `json:"result"`
 	Children   []*Explanation `json:"children,omitempty"`
 	Reason     string         `json:"reason,omitempty"`
+	// Coercions describes the strings a comparison converted under
+	// WithTypeCoercion, such as `"5" (string) as 5 (int)`.
+	Coercions []string `json:"coercions,omitempty"`
+	// Console holds the console output of the JavaScript functions called
+	// by the evaluation. Only the root explanation has it.
+	Console []functions.ConsoleEntry `json:"console,omitempty"`
 }
 
+// MaxConsoleEntries is the maximum number of console messages kept in an
+// explanation. Later messages still reach the console function.
+const MaxConsoleEntries = 100
+
 // Option is a function that configures the evaluator.
 type Option func(*Evaluator)
 
@@ -64,6 +160,93 @@ func WithTimeout(d time.Duration) Option {
 	}
 }
 
+// WithMaxIterations sets how many times higher-order functions such as map
+// and filter may apply their lambda during one evaluation, in total. Zero or
+// less means no limit.
+func WithMaxIterations(n int) Option {
+	return func(e *Evaluator) {
+		e.maxIterations = n
+	}
+}
+
+// WithMaxCalls sets how many function calls one evaluation may make, in
+// total, including calls inside lambdas. Zero or less means no limit.
+func WithMaxCalls(n int) Option {
+	return func(e *Evaluator) {
+		e.maxCalls = n
+	}
+}
+
+// WithMaxDepth sets how deeply the evaluation of nested nodes may recurse.
+// Deeper evaluations fail with ErrDepthLimit instead of exhausting the stack.
+// Zero or less means no limit. The default is parser.DefaultMaxDepth, so
+// that every expression the parser accepts can be evaluated.
+func WithMaxDepth(n int) Option {
+	return func(e *Evaluator) {
+		e.maxDepth = n
+	}
+}
+
+// WithRegexCache sets the cache compiling the regex patterns of =~, !~, and
+// the match function, which also decides the patterns accepted. By default
+// every valid pattern is accepted and DefaultRegexCacheSize patterns are
+// kept.
+func WithRegexCache(c *functions.RegexCache) Option {
+	return func(e *Evaluator) {
+		e.regexes = c
+	}
+}
+
+// WithTruthiness sets which values count as true in conditions: the
+// operands of &&, ||, and !, the results of EvaluateBool and of the lambdas of
+// filter, find, some, and every, and the bool, all, and any functions. By
+// default the rules of types.Value.IsTruthy apply.
+func WithTruthiness(t types.Truthiness) Option {
+	return func(e *Evaluator) {
+		e.truthiness = &t
+	}
+}
+
+// WithSafeIndex makes an index beyond either end of a list or string, as in
+// $.items[10] or at($.items, 10), give null instead of failing with
+// ErrIndexOutOfBounds, for payload arrays of unknown length.
+func WithSafeIndex(enabled bool) Option {
+	return func(e *Evaluator) {
+		e.safeIndex = enabled
+	}
+}
+
+// WithTypeCoercion enables lenient comparisons, for payloads that carry
+// numbers and booleans as strings: ==, !=, <, <=, >, >=, and IN convert a
+// string compared with a number or a boolean with types.Coerce, so "5" > 3
+// and "true" == true hold. Strings that do not convert are compared as
+// before. Explanations list the coercions made.
+func WithTypeCoercion(enabled bool) Option {
+	return func(e *Evaluator) {
+		e.coerce = enabled
+	}
+}
+
+// WithFunctionCallLimit sets how many times one evaluation may call the named
+// function, for example to allow at most three calls of an expensive lookup.
+func WithFunctionCallLimit(name string, n int) Option {
+	return func(e *Evaluator) {
+		if e.callLimits == nil {
+			e.callLimits = make(map[string]int)
+		}
+		e.callLimits[name] = n
+	}
+}
+
+// WithConsole sets the function receiving the console output of JavaScript
+// functions, such as console.log calls. Without one, console output is
+// discarded, except that explanations include it.
+func WithConsole(fn functions.ConsoleFunc) Option {
+	return func(e *Evaluator) {
+		e.console = fn
+	}
+}
+
 // WithSandbox sets a custom JavaScript sandbox for user-defined functions.
 func WithSandbox(s *functions.Sandbox) Option {
 	return func(e *Evaluator) {
@@ -74,7 +257,8 @@ func WithSandbox(s *functions.Sandbox) Option {
 // New creates a new Evaluator with the given options.
 func New(opts ...Option) (*Evaluator, error) {
 	e := &Evaluator{
-		timeout: 100 * time.Millisecond,
+		timeout:  100 * time.Millisecond,
+		maxDepth: parser.DefaultMaxDepth,
 	}
 
 	for _, opt := range opts {
@@ -89,6 +273,13 @@ func New(opts ...Option) (*Evaluator, error) {
 		}
 		e.functions = r
 	}
+	if e.regexes == nil {
+		regexes, err := functions.NewRegexCache(functions.RegexConfig{})
+		if err != nil {
+			return nil, err
+		}
+		e.regexes = regexes
+	}
 
 	return e, nil
 }
@@ -107,6 +298,12 @@ func NewContext(payload interface{}) (*EvalContext, error) {
 		ctx.PayloadJSON = p
 	case []byte:
 		ctx.PayloadJSON = string(p)
+	case proto.Message:
+		return NewProtoContext(p)
+	case YAML:
+		return newDocumentContext("YAML", string(p))
+	case TOML:
+		return newDocumentContext("TOML", string(p))
 	case map[string]interface{}:
 		// Use fmt for simple conversion
 		jsonBytes, err := toJSON(p)
@@ -125,46 +322,287 @@ func NewContext(payload interface{}) (*EvalContext, error) {
 	return ctx, nil
 }
 
-// WithContext sets a Go context for the evaluation context.
+// WithContext sets a Go context for the evaluations using this context,
+// which fail with ErrTimeout once it is canceled or its deadline passes, in
+// addition to the evaluator timeout.
 func (ec *EvalContext) WithContext(ctx context.Context) *EvalContext {
 	ec.ctx = ctx
+	ec.parent = ctx
 	return ec
 }
 
+// TrackCalls makes the evaluation record the functions it invokes, which are
+// then returned by InvokedFunctions.
+func (ec *EvalContext) TrackCalls() {
+	if ec.calls == nil {
+		ec.calls = &callTracker{seen: make(map[string]bool)}
+	}
+}
+
+// RecordClauses makes the evaluations using this context report the outcome
+// of every evaluated operand of && and || to r. Operands skipped by
+// short-circuit evaluation are not reported.
+func (ec *EvalContext) RecordClauses(r ClauseRecorder) {
+	ec.clauses = r
+}
+
+// InvokedFunctions returns the names of the functions invoked so far, in the
+// order they were first called. Functions in branches skipped by
+// short-circuit evaluation are not included. It returns nil unless
+// TrackCalls was called.
+func (ec *EvalContext) InvokedFunctions() []string {
+	if ec.calls == nil {
+		return nil
+	}
+	names := make([]string, len(ec.calls.names))
+	copy(names, ec.calls.names)
+	return names
+}
+
+// SetConsole sets the function receiving the console output of JavaScript
+// functions in the evaluations using this context, instead of the evaluator
+// console function.
+func (ec *EvalContext) SetConsole(fn functions.ConsoleFunc) {
+	ec.console = fn
+}
+
+// writeConsole handles console output of JavaScript functions. Output of
+// subexpressions evaluated again for an explanation is dropped, as it was
+// already written by the evaluation of the whole expression.
+func (ec *EvalContext) writeConsole(sink functions.ConsoleFunc, entry functions.ConsoleEntry) {
+	if ec.replaying {
+		return
+	}
+	if ec.collecting && len(ec.consoleLog) < MaxConsoleEntries {
+		ec.consoleLog = append(ec.consoleLog, entry)
+	}
+	if sink != nil {
+		sink(entry)
+	}
+}
+
+// SetLimits restricts the evaluations using this context, overriding the
+// evaluator timeout, iteration budget, and call budgets where set.
+func (ec *EvalContext) SetLimits(limits Limits) {
+	ec.timeout = limits.Timeout
+	ec.maxIterations = limits.MaxIterations
+	ec.maxCalls = limits.MaxCalls
+	ec.callLimits = limits.MaxCallsPerFunction
+	ec.allowed = nil
+	if limits.Functions != nil {
+		ec.allowed = make(map[string]bool, len(limits.Functions))
+		for _, name := range limits.Functions {
+			ec.allowed[name] = true
+		}
+	}
+}
+
+// iterate consumes one lambda application from the iteration budget. It fails
+// once the evaluation timed out, so that loops over long lists stop promptly.
+func (ec *EvalContext) iterate() error {
+	if err := functions.Canceled(ec.ctx); err != nil {
+		return err
+	}
+	if ec.iterations < 0 {
+		return nil
+	}
+	if ec.iterations == 0 {
+		return errors.New(errors.ErrIterationLimit, "iteration budget exceeded")
+	}
+	ec.iterations--
+	return nil
+}
+
+// countCall consumes one call from the call budgets.
+func (ec *EvalContext) countCall(call *ast.FunctionCall) error {
+	name := call.Name
+	if ec.callsLeft == 0 {
+		return errors.NewAtf(errors.ErrCallBudget, call.Token.Line, call.Token.Column, "function call budget exceeded")
+	}
+	if ec.callsLeft > 0 {
+		ec.callsLeft--
+	}
+
+	if limit, ok := ec.limitsInUse[name]; ok {
+		if ec.callCounts[name] >= limit {
+			return errors.NewAtf(errors.ErrCallBudget, call.Token.Line, call.Token.Column,
+				"function '%s' called more than %d times", name, limit)
+		}
+		if ec.callCounts == nil {
+			ec.callCounts = make(map[string]int)
+		}
+		ec.callCounts[name]++
+	}
+	return nil
+}
+
+// recordCall records a function invocation if call tracking is enabled.
+func (ec *EvalContext) recordCall(name string) {
+	if ec.calls != nil && !ec.calls.seen[name] {
+		ec.calls.seen[name] = true
+		ec.calls.names = append(ec.calls.names, name)
+	}
+}
+
+// recordClause reports whether an operand of && or || is truthy and returns
+// it.
+func (ec *EvalContext) recordClause(clause ast.Expression, truthy bool) bool {
+	if ec.clauses != nil {
+		ec.clauses.Record(clause, truthy)
+	}
+	return truthy
+}
+
 // SetVariable sets a variable in the evaluation context.
 func (ec *EvalContext) SetVariable(name string, value types.Value) {
 	ec.Variables[name] = value
 }
 
-// Evaluate evaluates an AST expression and returns the result.
-func (e *Evaluator) Evaluate(expr ast.Expression, ctx *EvalContext) (types.Value, error) {
-	// Always start with a fresh context to avoid reusing canceled contexts
-	evalCtx := context.Background()
+// Variable returns a variable of the evaluation context.
+func (ec *EvalContext) Variable(name string) (types.Value, bool) {
+	value, ok := ec.Variables[name]
+	return value, ok
+}
 
-	// Create timeout context if timeout is set
-	if e.timeout > 0 {
-		var cancel context.CancelFunc
-		evalCtx, cancel = context.WithTimeout(evalCtx, e.timeout)
-		defer cancel()
+// Lookup resolves a JSONPath such as "$.user.id" against the payload. It
+// returns null if the path does not exist.
+func (ec *EvalContext) Lookup(path string) types.Value {
+	// Convert path from $.field to field (gjson doesn't need the $)
+	if len(path) > 1 && path[0] == '$' {
+		if len(path) > 2 && path[1] == '.' {
+			path = path[2:]
+		} else {
+			path = path[1:]
+		}
 	}
 
-	ctx.ctx = evalCtx
+	// Handle root ($) by returning the entire payload, converted like the
+	// values at other paths
+	if path == "" || path == "$" {
+		if ec.PayloadJSON == "" {
+			return types.NewValue(ec.Payload)
+		}
+		return gjsonToValue(gjson.Parse(ec.PayloadJSON))
+	}
+
+	// Convert bracket notation to gjson dot notation
+	// e.g., users[0].name -> users.0.name
+	// e.g., data["key"] -> data.key
+	path = convertToGjsonPath(path)
+
+	result := gjson.Get(ec.PayloadJSON, path)
+
+	if !result.Exists() {
+		return ec.lookupCharacter(path)
+	}
+
+	return gjsonToValue(result)
+}
+
+// lookupCharacter resolves a path ending in an index into a string, such as
+// code.0, to the character at that index. It returns null if the path does
+// not select a character.
+func (ec *EvalContext) lookupCharacter(path string) types.Value {
+	dot := strings.LastIndexByte(path, '.')
+	if dot < 0 {
+		return types.Null()
+	}
+	idx, err := strconv.Atoi(path[dot+1:])
+	if err != nil {
+		return types.Null()
+	}
+	parent := gjson.Get(ec.PayloadJSON, path[:dot])
+	if parent.Type != gjson.String {
+		return types.Null()
+	}
+	runes := []rune(parent.Str)
+	if idx >= len(runes) {
+		return types.Null()
+	}
+	return types.String(string(runes[idx]))
+}
+
+// Evaluate evaluates an AST expression and returns the result.
+func (e *Evaluator) Evaluate(expr ast.Expression, ctx *EvalContext) (types.Value, error) {
+	cancel := e.start(ctx, false)
+	defer cancel()
 	return e.eval(expr, ctx)
 }
 
 // EvaluateWithExplanation evaluates an expression and returns detailed explanation.
 func (e *Evaluator) EvaluateWithExplanation(expr ast.Expression, ctx *EvalContext) (types.Value, *Explanation, error) {
-	// Always start with a fresh context to avoid reusing canceled contexts
+	cancel := e.start(ctx, true)
+	defer cancel()
+	value, explanation, err := e.evalWithExplanation(expr, ctx)
+	explanation.Console = ctx.consoleLog
+	return value, explanation, err
+}
+
+// start prepares a context for a new evaluation: it sets up the timeout and
+// console output, and resets the depth and the iteration and call budgets. Explaining
+// evaluations collect console output. The returned function releases the
+// timeout.
+func (e *Evaluator) start(ctx *EvalContext, explain bool) context.CancelFunc {
+	// Always start with a fresh context to avoid reusing canceled contexts,
+	// derived from the one set with WithContext
 	evalCtx := context.Background()
+	if ctx.parent != nil {
+		evalCtx = ctx.parent
+	}
+	cancel := context.CancelFunc(func() {})
 
-	if e.timeout > 0 {
-		var cancel context.CancelFunc
-		evalCtx, cancel = context.WithTimeout(evalCtx, e.timeout)
-		defer cancel()
+	timeout := e.timeout
+	if ctx.timeout > 0 {
+		timeout = ctx.timeout
+	}
+	if timeout > 0 {
+		evalCtx, cancel = context.WithTimeout(evalCtx, timeout)
+	}
+
+	ctx.depth = 0
+	ctx.iterations = e.maxIterations
+	if ctx.maxIterations > 0 {
+		ctx.iterations = ctx.maxIterations
+	}
+	if ctx.iterations <= 0 {
+		ctx.iterations = -1
+	}
+
+	ctx.callsLeft = e.maxCalls
+	if ctx.maxCalls > 0 {
+		ctx.callsLeft = ctx.maxCalls
+	}
+	if ctx.callsLeft <= 0 {
+		ctx.callsLeft = -1
+	}
+	ctx.limitsInUse = e.callLimits
+	if len(ctx.callLimits) > 0 {
+		ctx.limitsInUse = make(map[string]int, len(e.callLimits)+len(ctx.callLimits))
+		for name, n := range e.callLimits {
+			ctx.limitsInUse[name] = n
+		}
+		for name, n := range ctx.callLimits {
+			ctx.limitsInUse[name] = n
+		}
+	}
+	ctx.callCounts = nil
+
+	evalCtx = functions.WithRegexCache(evalCtx, e.regexes)
+	evalCtx = functions.WithTruthiness(evalCtx, e.truthiness)
+	evalCtx = functions.WithSafeIndex(evalCtx, e.safeIndex)
+	ctx.consoleLog, ctx.collecting, ctx.replaying = nil, explain, false
+	sink := e.console
+	if ctx.console != nil {
+		sink = ctx.console
+	}
+	if sink != nil || explain {
+		evalCtx = functions.WithConsole(evalCtx, func(entry functions.ConsoleEntry) {
+			ctx.writeConsole(sink, entry)
+		})
 	}
 
 	ctx.ctx = evalCtx
-	return e.evalWithExplanation(expr, ctx)
+	return cancel
 }
 
 // EvaluateBool evaluates an expression and returns a boolean result.
@@ -173,16 +611,37 @@ func (e *Evaluator) EvaluateBool(expr ast.Expression, ctx *EvalContext) (bool, e
 	if err != nil {
 		return false, err
 	}
-	return result.IsTruthy(), nil
+	return e.Matched(result)
+}
+
+// IsTruthy returns the truthiness of a value under the rules of the
+// evaluator.
+func (e *Evaluator) IsTruthy(v types.Value) bool {
+	return e.truthiness.IsTruthy(v)
 }
 
-// eval is the main evaluation dispatch function.
+// eval is the main evaluation dispatch function. Errors are annotated with
+// the node that raised them.
 func (e *Evaluator) eval(node ast.Expression, ctx *EvalContext) (types.Value, error) {
+	if e.maxDepth > 0 && ctx.depth >= e.maxDepth {
+		err := errors.Newf(errors.ErrDepthLimit, "expression is nested deeper than the maximum depth of %d", e.maxDepth)
+		annotate(err, node)
+		return types.Null(), err
+	}
+	ctx.depth++
+	result, err := e.evalNode(node, ctx)
+	ctx.depth--
+	if err != nil {
+		annotate(err, node)
+	}
+	return result, err
+}
+
+// evalNode evaluates a node.
+func (e *Evaluator) evalNode(node ast.Expression, ctx *EvalContext) (types.Value, error) {
 	// Check for timeout
-	select {
-	case <-ctx.ctx.Done():
-		return types.Null(), errors.New(errors.ErrTimeout, "evaluation timed out")
-	default:
+	if err := ctx.CheckTimeout(); err != nil {
+		return types.Null(), err
 	}
 
 	switch n := node.(type) {
@@ -192,6 +651,9 @@ func (e *Evaluator) eval(node ast.Expression, ctx *EvalContext) (types.Value, er
 	case *ast.FloatLiteral:
 		return types.Float(n.Value), nil
 
+	case *ast.DurationLiteral:
+		return types.Duration(n.Value), nil
+
 	case *ast.StringLiteral:
 		return types.String(n.Value), nil
 
@@ -204,6 +666,9 @@ func (e *Evaluator) eval(node ast.Expression, ctx *EvalContext) (types.Value, er
 	case *ast.ListLiteral:
 		return e.evalListLiteral(n, ctx)
 
+	case *ast.MapLiteral:
+		return e.evalMapLiteral(n, ctx)
+
 	case *ast.Identifier:
 		return e.evalIdentifier(n, ctx)
 
@@ -222,11 +687,20 @@ func (e *Evaluator) eval(node ast.Expression, ctx *EvalContext) (types.Value, er
 	case *ast.RegexExpression:
 		return e.evalRegexExpression(n, ctx)
 
+	case *ast.ConditionalExpression:
+		return e.evalConditionalExpression(n, ctx)
+
+	case *ast.CaseExpression:
+		return e.evalCaseExpression(n, ctx)
+
 	case *ast.LambdaExpression:
 		// Lambda expressions are not directly evaluated; they are used by higher-order functions
 		return types.Null(), errors.New(errors.ErrInvalidSyntax, "lambda expressions cannot be evaluated directly")
 
 	case *ast.FunctionCall:
+		if err := e.BeginCall(n, ctx); err != nil {
+			return types.Null(), err
+		}
 		// Check if this is a higher-order function
 		if higherOrderFunctions[n.Name] {
 			return e.evalHigherOrderFunction(n, ctx)
@@ -236,6 +710,9 @@ func (e *Evaluator) eval(node ast.Expression, ctx *EvalContext) (types.Value, er
 	case *ast.IndexExpression:
 		return e.evalIndexExpression(n, ctx)
 
+	case *ast.SliceExpression:
+		return e.evalSliceExpression(n, ctx)
+
 	case *ast.MemberExpression:
 		return e.evalMemberExpression(n, ctx)
 
@@ -254,6 +731,8 @@ func (e *Evaluator) evalWithExplanation(node ast.Expression, ctx *EvalContext) (
 	}
 
 	result, err := e.eval(node, ctx)
+	// Children are evaluated again below; that output was already written
+	ctx.replaying = true
 	if err != nil {
 		explanation.Reason = fmt.Sprintf("Error: %s", err.Error())
 		return result, explanation, err
@@ -269,6 +748,9 @@ func (e *Evaluator) evalWithExplanation(node ast.Expression, ctx *EvalContext) (
 	case *ast.FloatLiteral:
 		explanation.Reason = fmt.Sprintf("Float literal: %v", n.Value)
 
+	case *ast.DurationLiteral:
+		explanation.Reason = fmt.Sprintf("Duration literal: %s", n.Value)
+
 	case *ast.StringLiteral:
 		explanation.Reason = fmt.Sprintf("String literal: %q", n.Value)
 
@@ -287,6 +769,15 @@ func (e *Evaluator) evalWithExplanation(node ast.Expression, ctx *EvalContext) (
 		explanation.Children = children
 		explanation.Reason = fmt.Sprintf("List with %d elements", len(n.Elements))
 
+	case *ast.MapLiteral:
+		children := make([]*Explanation, len(n.Values))
+		for i, value := range n.Values {
+			_, childExp, _ := e.evalWithExplanation(value, ctx)
+			children[i] = childExp
+		}
+		explanation.Children = children
+		explanation.Reason = fmt.Sprintf("Map with %d entries", len(n.Keys))
+
 	case *ast.Identifier:
 		explanation.Reason = fmt.Sprintf("Identifier '%s' resolved to %v", n.Value, result.Raw)
 
@@ -298,6 +789,11 @@ func (e *Evaluator) evalWithExplanation(node ast.Expression, ctx *EvalContext) (
 		rightVal, rightExp, _ := e.evalWithExplanation(n.Right, ctx)
 		explanation.Children = []*Explanation{leftExp, rightExp}
 		explanation.Reason = fmt.Sprintf("%v %s %v = %v", leftVal.Raw, n.Operator, rightVal.Raw, result.Raw)
+		if e.coerce && comparisonOperators[n.Operator] {
+			if _, _, c := types.Coerce(leftVal, rightVal); c != nil {
+				explanation.Coercions = []string{c.String()}
+			}
+		}
 
 	case *ast.UnaryExpression:
 		operandVal, operandExp, _ := e.evalWithExplanation(n.Operand, ctx)
@@ -313,6 +809,9 @@ func (e *Evaluator) evalWithExplanation(node ast.Expression, ctx *EvalContext) (
 			op = "NOT IN"
 		}
 		explanation.Reason = fmt.Sprintf("%v %s %v = %v", leftVal.Raw, op, rightVal.Raw, result.Raw)
+		if e.coerce {
+			explanation.Coercions = inCoercions(leftVal, rightVal)
+		}
 
 	case *ast.RegexExpression:
 		leftVal, leftExp, _ := e.evalWithExplanation(n.Left, ctx)
@@ -324,7 +823,43 @@ func (e *Evaluator) evalWithExplanation(node ast.Expression, ctx *EvalContext) (
 		}
 		explanation.Reason = fmt.Sprintf("%v %s %v = %v", leftVal.Raw, op, patternVal.Raw, result.Raw)
 
+	case *ast.ConditionalExpression:
+		condVal, condExp, _ := e.evalWithExplanation(n.Condition, ctx)
+		branch, name := n.Alternative, "else"
+		if e.IsTruthy(condVal) {
+			branch, name = n.Consequence, "then"
+		}
+		_, branchExp, _ := e.evalWithExplanation(branch, ctx)
+		explanation.Children = []*Explanation{condExp, branchExp}
+		explanation.Reason = fmt.Sprintf("Condition %v selected the %s branch = %v", condVal.Raw, name, result.Raw)
+
+	case *ast.CaseExpression:
+		// The conditions tested, then the result selected
+		var children []*Explanation
+		selected := "no arm"
+		for i, cond := range n.Conditions {
+			condVal, condExp, _ := e.evalWithExplanation(cond, ctx)
+			children = append(children, condExp)
+			if e.IsTruthy(condVal) {
+				_, resultExp, _ := e.evalWithExplanation(n.Results[i], ctx)
+				children = append(children, resultExp)
+				selected = fmt.Sprintf("arm %d", i+1)
+				break
+			}
+		}
+		if selected == "no arm" && n.Default != nil {
+			_, defaultExp, _ := e.evalWithExplanation(n.Default, ctx)
+			children = append(children, defaultExp)
+			selected = "the else arm"
+		}
+		explanation.Children = children
+		explanation.Reason = fmt.Sprintf("Case selected %s = %v", selected, result.Raw)
+
 	case *ast.FunctionCall:
+		if pairs, ok := scorePairs(n); ok && e.LazyCall(n.Name) {
+			explanation.Children, explanation.Reason = e.explainScore(pairs, result, ctx)
+			break
+		}
 		children := make([]*Explanation, len(n.Arguments))
 		argVals := make([]interface{}, len(n.Arguments))
 		for i, arg := range n.Arguments {
@@ -341,6 +876,19 @@ func (e *Evaluator) evalWithExplanation(node ast.Expression, ctx *EvalContext) (
 		explanation.Children = []*Explanation{leftExp, indexExp}
 		explanation.Reason = fmt.Sprintf("%v[%v] = %v", leftVal.Raw, indexVal.Raw, result.Raw)
 
+	case *ast.SliceExpression:
+		leftVal, leftExp, _ := e.evalWithExplanation(n.Left, ctx)
+		explanation.Children = []*Explanation{leftExp}
+		bounds := [2]string{}
+		for i, bound := range []ast.Expression{n.Start, n.End} {
+			if bound != nil {
+				boundVal, boundExp, _ := e.evalWithExplanation(bound, ctx)
+				explanation.Children = append(explanation.Children, boundExp)
+				bounds[i] = fmt.Sprint(boundVal.Raw)
+			}
+		}
+		explanation.Reason = fmt.Sprintf("%v[%s:%s] = %v", leftVal.Raw, bounds[0], bounds[1], result.Raw)
+
 	case *ast.MemberExpression:
 		objVal, objExp, _ := e.evalWithExplanation(n.Object, ctx)
 		explanation.Children = []*Explanation{objExp}
@@ -374,6 +922,18 @@ func (e *Evaluator) evalListLiteral(list *ast.ListLiteral, ctx *EvalContext) (ty
 	return types.List(elements...), nil
 }
 
+func (e *Evaluator) evalMapLiteral(m *ast.MapLiteral, ctx *EvalContext) (types.Value, error) {
+	entries := make(map[string]types.Value, len(m.Keys))
+	for i, key := range m.Keys {
+		val, err := e.eval(m.Values[i], ctx)
+		if err != nil {
+			return types.Null(), err
+		}
+		entries[key] = val
+	}
+	return types.Map(entries), nil
+}
+
 func (e *Evaluator) evalIdentifier(ident *ast.Identifier, ctx *EvalContext) (types.Value, error) {
 	// Check if it's a variable
 	if val, ok := ctx.Variables[ident.Value]; ok {
@@ -385,48 +945,28 @@ func (e *Evaluator) evalIdentifier(ident *ast.Identifier, ctx *EvalContext) (typ
 }
 
 func (e *Evaluator) evalJSONPath(jp *ast.JSONPathExpression, ctx *EvalContext) (types.Value, error) {
-	// Use gjson to resolve the path
-	// Convert path from $.field to field (gjson doesn't need the $)
-	path := jp.Path
-	if len(path) > 1 && path[0] == '$' {
-		if len(path) > 2 && path[1] == '.' {
-			path = path[2:]
-		} else {
-			path = path[1:]
-		}
-	}
-
-	// Handle root ($) by returning the entire payload
-	if path == "" || path == "$" {
-		return types.NewValue(ctx.Payload), nil
-	}
-
-	// Convert bracket notation to gjson dot notation
-	// e.g., users[0].name -> users.0.name
-	// e.g., data["key"] -> data.key
-	path = convertToGjsonPath(path)
-
-	result := gjson.Get(ctx.PayloadJSON, path)
-
-	if !result.Exists() {
-		return types.Null(), nil
-	}
-
-	return gjsonToValue(result), nil
+	return ctx.Lookup(jp.Path), nil
 }
 
+// Bracket notation in paths: [N], ["key"], and ['key']
+var (
+	numericBracket      = regexp.MustCompile(`\[(\d+)\]`)
+	stringBracket       = regexp.MustCompile(`\["([^"]+)"\]`)
+	stringBracketSingle = regexp.MustCompile(`\['([^']+)'\]`)
+)
+
 // convertToGjsonPath converts JSONPath bracket notation to gjson dot notation.
 // gjson uses dots for array indices: users.0.name instead of users[0].name
 func convertToGjsonPath(path string) string {
+	if !strings.ContainsRune(path, '[') {
+		return path
+	}
+
 	// Replace [N] with .N for numeric indices
-	numericBracket := regexp.MustCompile(`\[(\d+)\]`)
 	path = numericBracket.ReplaceAllString(path, ".$1")
 
 	// Replace ["key"] or ['key'] with .key for string keys
-	stringBracket := regexp.MustCompile(`\["([^"]+)"\]`)
 	path = stringBracket.ReplaceAllString(path, ".$1")
-
-	stringBracketSingle := regexp.MustCompile(`\['([^']+)'\]`)
 	path = stringBracketSingle.ReplaceAllString(path, ".$1")
 
 	// Clean up any leading dots
@@ -446,10 +986,18 @@ func (e *Evaluator) evalUnaryExpression(expr *ast.UnaryExpression, ctx *EvalCont
 	if err != nil {
 		return types.Null(), err
 	}
+	return e.Unary(expr.Operator, operand)
+}
 
-	switch expr.Operator {
+// Unary applies a unary operator, ! or -, to a value.
+func (e *Evaluator) Unary(op string, operand types.Value) (types.Value, error) {
+	switch op {
 	case "!", "not", "NOT":
-		return types.Bool(!operand.IsTruthy()), nil
+		truthy, err := e.condition(operand, "the operand of "+op)
+		if err != nil {
+			return types.Null(), err
+		}
+		return types.Bool(!truthy), nil
 
 	case "-":
 		switch operand.Type {
@@ -459,6 +1007,12 @@ func (e *Evaluator) evalUnaryExpression(expr *ast.UnaryExpression, ctx *EvalCont
 		case types.TypeFloat:
 			v, _ := operand.AsFloat()
 			return types.Float(-v), nil
+		case types.TypeDuration:
+			v, _ := operand.AsDuration()
+			return types.Duration(-v), nil
+		case types.TypeDecimal:
+			v, _ := operand.AsDecimal()
+			return types.Decimal(new(big.Rat).Neg(v)), nil
 		default:
 			return types.Null(), errors.Newf(errors.ErrTypeMismatch,
 				"cannot negate %s", operand.Type)
@@ -466,7 +1020,7 @@ func (e *Evaluator) evalUnaryExpression(expr *ast.UnaryExpression, ctx *EvalCont
 
 	default:
 		return types.Null(), errors.Newf(errors.ErrInvalidOperator,
-			"unknown unary operator: %s", expr.Operator)
+			"unknown unary operator: %s", op)
 	}
 }
 
@@ -477,14 +1031,21 @@ func (e *Evaluator) evalBinaryExpression(expr *ast.BinaryExpression, ctx *EvalCo
 		if err != nil {
 			return types.Null(), err
 		}
-		if !left.IsTruthy() {
+		truthy, err := e.condition(left, "the left operand of "+expr.Operator)
+		if err != nil {
+			return types.Null(), err
+		}
+		if !ctx.recordClause(expr.Left, truthy) {
 			return types.Bool(false), nil
 		}
 		right, err := e.eval(expr.Right, ctx)
 		if err != nil {
 			return types.Null(), err
 		}
-		return types.Bool(right.IsTruthy()), nil
+		if truthy, err = e.condition(right, "the right operand of "+expr.Operator); err != nil {
+			return types.Null(), err
+		}
+		return types.Bool(ctx.recordClause(expr.Right, truthy)), nil
 	}
 
 	if expr.Operator == "||" || expr.Operator == "or" || expr.Operator == "OR" {
@@ -492,14 +1053,21 @@ func (e *Evaluator) evalBinaryExpression(expr *ast.BinaryExpression, ctx *EvalCo
 		if err != nil {
 			return types.Null(), err
 		}
-		if left.IsTruthy() {
+		truthy, err := e.condition(left, "the left operand of "+expr.Operator)
+		if err != nil {
+			return types.Null(), err
+		}
+		if ctx.recordClause(expr.Left, truthy) {
 			return types.Bool(true), nil
 		}
 		right, err := e.eval(expr.Right, ctx)
 		if err != nil {
 			return types.Null(), err
 		}
-		return types.Bool(right.IsTruthy()), nil
+		if truthy, err = e.condition(right, "the right operand of "+expr.Operator); err != nil {
+			return types.Null(), err
+		}
+		return types.Bool(ctx.recordClause(expr.Right, truthy)), nil
 	}
 
 	// Evaluate both sides for other operators
@@ -512,8 +1080,20 @@ func (e *Evaluator) evalBinaryExpression(expr *ast.BinaryExpression, ctx *EvalCo
 	if err != nil {
 		return types.Null(), err
 	}
+	return e.Binary(expr.Operator, left, right)
+}
 
-	switch expr.Operator {
+// Binary applies a binary operator other than && and ||, which evaluate
+// their right operand only if needed, to two values.
+func (e *Evaluator) Binary(op string, left, right types.Value) (types.Value, error) {
+	if e.coerce && comparisonOperators[op] {
+		left, right, _ = types.Coerce(left, right)
+	}
+	if err := e.checkOperands(op, left, right); err != nil {
+		return types.Null(), err
+	}
+
+	switch op {
 	// Comparison operators
 	case "==":
 		return types.Bool(left.Equals(right)), nil
@@ -566,16 +1146,26 @@ func (e *Evaluator) evalBinaryExpression(expr *ast.BinaryExpression, ctx *EvalCo
 	case "/":
 		return e.evalDivision(left, right)
 
+	case "~/":
+		return e.evalIntegerDivision(left, right)
+
 	case "%":
 		return e.evalModulo(left, right)
 
 	default:
 		return types.Null(), errors.Newf(errors.ErrInvalidOperator,
-			"unknown binary operator: %s", expr.Operator)
+			"unknown binary operator: %s", op)
 	}
 }
 
 func (e *Evaluator) evalAddition(left, right types.Value) (types.Value, error) {
+	if result, ok, err := evalTemporal("+", left, right); ok {
+		return result, err
+	}
+	if result, ok, err := e.evalDecimal("+", left, right); ok {
+		return result, err
+	}
+
 	// String concatenation
 	if left.Type == types.TypeString && right.Type == types.TypeString {
 		l, _ := left.AsString()
@@ -600,6 +1190,13 @@ func (e *Evaluator) evalAddition(left, right types.Value) (types.Value, error) {
 }
 
 func (e *Evaluator) evalSubtraction(left, right types.Value) (types.Value, error) {
+	if result, ok, err := evalTemporal("-", left, right); ok {
+		return result, err
+	}
+	if result, ok, err := e.evalDecimal("-", left, right); ok {
+		return result, err
+	}
+
 	if !left.Type.IsNumeric() || !right.Type.IsNumeric() {
 		return types.Null(), errors.Newf(errors.ErrTypeMismatch,
 			"cannot subtract %s from %s", right.Type, left.Type)
@@ -617,6 +1214,13 @@ func (e *Evaluator) evalSubtraction(left, right types.Value) (types.Value, error
 }
 
 func (e *Evaluator) evalMultiplication(left, right types.Value) (types.Value, error) {
+	if result, ok, err := evalTemporal("*", left, right); ok {
+		return result, err
+	}
+	if result, ok, err := e.evalDecimal("*", left, right); ok {
+		return result, err
+	}
+
 	if !left.Type.IsNumeric() || !right.Type.IsNumeric() {
 		return types.Null(), errors.Newf(errors.ErrTypeMismatch,
 			"cannot multiply %s and %s", left.Type, right.Type)
@@ -634,6 +1238,13 @@ func (e *Evaluator) evalMultiplication(left, right types.Value) (types.Value, er
 }
 
 func (e *Evaluator) evalDivision(left, right types.Value) (types.Value, error) {
+	if result, ok, err := evalTemporal("/", left, right); ok {
+		return result, err
+	}
+	if result, ok, err := e.evalDecimal("/", left, right); ok {
+		return result, err
+	}
+
 	if !left.Type.IsNumeric() || !right.Type.IsNumeric() {
 		return types.Null(), errors.Newf(errors.ErrTypeMismatch,
 			"cannot divide %s by %s", left.Type, right.Type)
@@ -649,19 +1260,69 @@ func (e *Evaluator) evalDivision(left, right types.Value) (types.Value, error) {
 	return types.Float(l / r), nil
 }
 
+// evalIntegerDivision divides two numbers and truncates the quotient toward
+// zero, so that 7 ~/ 2 is 3 and -7 ~/ 2 is -3. The result is always an int.
+func (e *Evaluator) evalIntegerDivision(left, right types.Value) (types.Value, error) {
+	if !left.Type.IsNumeric() || !right.Type.IsNumeric() {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch,
+			"cannot divide %s by %s", left.Type, right.Type)
+	}
+	if result, ok, err := e.evalDecimal("~/", left, right); ok {
+		return result, err
+	}
+
+	if left.Type == types.TypeInt && right.Type == types.TypeInt {
+		l, _ := left.AsInt()
+		r, _ := right.AsInt()
+		if r == 0 {
+			return types.Null(), errors.New(errors.ErrDivisionByZero, "division by zero")
+		}
+		if l == math.MinInt64 && r == -1 {
+			return types.Null(), errors.Newf(errors.ErrTypeMismatch,
+				"%v ~/ %v is out of the range of an int", l, r)
+		}
+		return types.Int(l / r), nil
+	}
+
+	l, _ := left.AsFloat()
+	r, _ := right.AsFloat()
+	if r == 0 {
+		return types.Null(), errors.New(errors.ErrDivisionByZero, "division by zero")
+	}
+	q := math.Trunc(l / r)
+	if math.IsNaN(q) || q < math.MinInt64 || q >= math.MaxInt64 {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch,
+			"%v ~/ %v is out of the range of an int", l, r)
+	}
+	return types.Int(int64(q)), nil
+}
+
+// evalModulo returns the remainder of dividing two numbers, with the sign of
+// the dividend: an int for two ints, otherwise a float, as by math.Mod.
 func (e *Evaluator) evalModulo(left, right types.Value) (types.Value, error) {
-	if left.Type != types.TypeInt || right.Type != types.TypeInt {
+	if !left.Type.IsNumeric() || !right.Type.IsNumeric() {
 		return types.Null(), errors.Newf(errors.ErrTypeMismatch,
-			"modulo requires integers, got %s and %s", left.Type, right.Type)
+			"modulo requires numbers, got %s and %s", left.Type, right.Type)
+	}
+	if result, ok, err := e.evalDecimal("%", left, right); ok {
+		return result, err
 	}
 
-	r, _ := right.AsInt()
+	if left.Type == types.TypeInt && right.Type == types.TypeInt {
+		l, _ := left.AsInt()
+		r, _ := right.AsInt()
+		if r == 0 {
+			return types.Null(), errors.New(errors.ErrDivisionByZero, "modulo by zero")
+		}
+		return types.Int(l % r), nil
+	}
+
+	l, _ := left.AsFloat()
+	r, _ := right.AsFloat()
 	if r == 0 {
 		return types.Null(), errors.New(errors.ErrDivisionByZero, "modulo by zero")
 	}
-
-	l, _ := left.AsInt()
-	return types.Int(l % r), nil
+	return types.Float(math.Mod(l, r)), nil
 }
 
 func (e *Evaluator) evalRegexExpression(re *ast.RegexExpression, ctx *EvalContext) (types.Value, error) {
@@ -676,13 +1337,18 @@ func (e *Evaluator) evalRegexExpression(re *ast.RegexExpression, ctx *EvalContex
 	if err != nil {
 		return types.Null(), err
 	}
+	return e.Match(leftVal, patternVal, re.Negated, ctx)
+}
 
+// Match applies the =~ operator, or !~ if negated, to a string and a
+// pattern.
+func (e *Evaluator) Match(leftVal, patternVal types.Value, negated bool, ctx *EvalContext) (types.Value, error) {
 	// Left must be a string
 	leftStr, ok := leftVal.AsString()
 	if !ok {
 		// If left is null, return false (no match)
 		if leftVal.IsNull() {
-			return types.Bool(re.Negated), nil
+			return types.Bool(negated), nil
 		}
 		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "regex match requires string, got %s", leftVal.Type)
 	}
@@ -694,19 +1360,65 @@ func (e *Evaluator) evalRegexExpression(re *ast.RegexExpression, ctx *EvalContex
 	}
 
 	// Compile and match the regex
-	re2, err := regexp.Compile(patternStr)
+	re2, err := e.regexes.Compile(patternStr)
 	if err != nil {
-		return types.Null(), errors.Newf(errors.ErrInvalidSyntax, "invalid regex pattern: %v", err)
+		return types.Null(), err
 	}
 
+	// Go regexps match in linear time, so no pattern backtracks
+	// catastrophically; a long match ending past the deadline still times out
 	matched := re2.MatchString(leftStr)
-	if re.Negated {
+	if err := functions.Canceled(ctx.ctx); err != nil {
+		return types.Null(), err
+	}
+	if negated {
 		matched = !matched
 	}
 
 	return types.Bool(matched), nil
 }
 
+// evalConditionalExpression evaluates the condition of cond ? a : b and then
+// only the branch it selects, so that the other branch may hold an expression
+// that would fail, such as $.x != 0 ? 100 / $.x : 0.
+func (e *Evaluator) evalConditionalExpression(ce *ast.ConditionalExpression, ctx *EvalContext) (types.Value, error) {
+	cond, err := e.eval(ce.Condition, ctx)
+	if err != nil {
+		return types.Null(), err
+	}
+	truthy, err := e.condition(cond, "the condition of ?:")
+	if err != nil {
+		return types.Null(), err
+	}
+	if truthy {
+		return e.eval(ce.Consequence, ctx)
+	}
+	return e.eval(ce.Alternative, ctx)
+}
+
+// evalCaseExpression tests the conditions of a case expression in order and
+// evaluates only the result of the first that holds, or the else arm. A case
+// without an else arm whose conditions all fail is null.
+func (e *Evaluator) evalCaseExpression(ce *ast.CaseExpression, ctx *EvalContext) (types.Value, error) {
+	for i, cond := range ce.Conditions {
+		val, err := e.eval(cond, ctx)
+		if err != nil {
+			return types.Null(), err
+		}
+		truthy, err := e.condition(val, "a condition of case")
+		if err != nil {
+			return types.Null(), err
+		}
+		if truthy {
+			return e.eval(ce.Results[i], ctx)
+		}
+	}
+	if ce.Default != nil {
+		return e.eval(ce.Default, ctx)
+	}
+	return types.Null(), nil
+}
+
 func (e *Evaluator) evalInExpression(inExpr *ast.InExpression, ctx *EvalContext) (types.Value, error) {
 	left, err := e.eval(inExpr.Left, ctx)
 	if err != nil {
@@ -717,7 +1429,11 @@ func (e *Evaluator) evalInExpression(inExpr *ast.InExpression, ctx *EvalContext)
 	if err != nil {
 		return types.Null(), err
 	}
+	return e.In(left, right, inExpr.Negated, ctx)
+}
 
+// In applies the IN operator, or NOT IN if negated, to a value and a list.
+func (e *Evaluator) In(left, right types.Value, negated bool, ctx *EvalContext) (types.Value, error) {
 	// Right must be a list
 	list, ok := right.AsList()
 	if !ok {
@@ -727,21 +1443,50 @@ func (e *Evaluator) evalInExpression(inExpr *ast.InExpression, ctx *EvalContext)
 
 	// Check if left is in the list
 	found := false
-	for _, elem := range list {
-		if left.Equals(elem) {
+	for i, elem := range list {
+		if i%functions.CancelCheckInterval == 0 {
+			if err := functions.Canceled(ctx.ctx); err != nil {
+				return types.Null(), err
+			}
+		}
+		l := left
+		if e.coerce {
+			l, elem, _ = types.Coerce(left, elem)
+		}
+		if err := e.checkOperands("IN", l, elem); err != nil {
+			return types.Null(), err
+		}
+		if l.Equals(elem) {
 			found = true
 			break
 		}
 	}
 
-	if inExpr.Negated {
+	if negated {
 		return types.Bool(!found), nil
 	}
 	return types.Bool(found), nil
 }
 
+// inCoercions describes the coercions an IN test made, comparing the left
+// operand with the elements of the list up to the first match.
+func inCoercions(left, right types.Value) []string {
+	list, _ := right.AsList()
+	var coercions []string
+	for _, elem := range list {
+		l, el, c := types.Coerce(left, elem)
+		if c != nil {
+			coercions = append(coercions, c.String())
+		}
+		if l.Equals(el) {
+			break
+		}
+	}
+	return coercions
+}
+
 // ============================================================================
-// Higher-order function evaluation (map, filter, reduce, find, some, every)
+// Higher-order function evaluation (map, filter, reduce, find, some, every, sortWith)
 // ============================================================================
 
 func (e *Evaluator) evalHigherOrderFunction(call *ast.FunctionCall, ctx *EvalContext) (types.Value, error) {
@@ -758,6 +1503,8 @@ func (e *Evaluator) evalHigherOrderFunction(call *ast.FunctionCall, ctx *EvalCon
 		return e.evalSomeFunction(call, ctx)
 	case "every":
 		return e.evalEveryFunction(call, ctx)
+	case "sortWith":
+		return e.evalSortWithFunction(call, ctx)
 	default:
 		return types.Null(), errors.Newf(errors.ErrUndefinedFunction, "unknown higher-order function: %s", call.Name)
 	}
@@ -789,11 +1536,14 @@ func (e *Evaluator) evalMapFunction(call *ast.FunctionCall, ctx *EvalContext) (t
 	// Apply the lambda to each element
 	result := make([]types.Value, len(list))
 	for i, elem := range list {
+		if err := ctx.iterate(); err != nil {
+			return types.Null(), err
+		}
 		// Set the variable in context
 		ctx.SetVariable(paramName, elem)
 		val, err := e.eval(lambda, ctx)
 		if err != nil {
-			return types.Null(), errors.Newf(errors.ErrFunctionPanic, "map() failed at index %d: %v", i, err)
+			return types.Null(), lambdaError("map", i, err)
 		}
 		result[i] = val
 	}
@@ -827,12 +1577,19 @@ func (e *Evaluator) evalFilterFunction(call *ast.FunctionCall, ctx *EvalContext)
 	// Filter the list
 	result := make([]types.Value, 0)
 	for i, elem := range list {
+		if err := ctx.iterate(); err != nil {
+			return types.Null(), err
+		}
 		ctx.SetVariable(paramName, elem)
 		val, err := e.eval(lambda, ctx)
 		if err != nil {
-			return types.Null(), errors.Newf(errors.ErrFunctionPanic, "filter() failed at index %d: %v", i, err)
+			return types.Null(), lambdaError("filter", i, err)
+		}
+		truthy, err := e.lambdaCondition("filter", i, val)
+		if err != nil {
+			return types.Null(), err
 		}
-		if val.IsTruthy() {
+		if truthy {
 			result = append(result, elem)
 		}
 	}
@@ -871,11 +1628,14 @@ func (e *Evaluator) evalReduceFunction(call *ast.FunctionCall, ctx *EvalContext)
 
 	// Reduce the list
 	for i, elem := range list {
+		if err := ctx.iterate(); err != nil {
+			return types.Null(), err
+		}
 		ctx.SetVariable(accName, accumulator)
 		ctx.SetVariable(elemName, elem)
 		val, err := e.eval(lambda, ctx)
 		if err != nil {
-			return types.Null(), errors.Newf(errors.ErrFunctionPanic, "reduce() failed at index %d: %v", i, err)
+			return types.Null(), lambdaError("reduce", i, err)
 		}
 		accumulator = val
 	}
@@ -908,12 +1668,19 @@ func (e *Evaluator) evalFindFunction(call *ast.FunctionCall, ctx *EvalContext) (
 
 	// Find the first matching element
 	for i, elem := range list {
+		if err := ctx.iterate(); err != nil {
+			return types.Null(), err
+		}
 		ctx.SetVariable(paramName, elem)
 		val, err := e.eval(lambda, ctx)
 		if err != nil {
-			return types.Null(), errors.Newf(errors.ErrFunctionPanic, "find() failed at index %d: %v", i, err)
+			return types.Null(), lambdaError("find", i, err)
+		}
+		truthy, err := e.lambdaCondition("find", i, val)
+		if err != nil {
+			return types.Null(), err
 		}
-		if val.IsTruthy() {
+		if truthy {
 			return elem, nil
 		}
 	}
@@ -946,12 +1713,19 @@ func (e *Evaluator) evalSomeFunction(call *ast.FunctionCall, ctx *EvalContext) (
 
 	// Check if any element matches
 	for i, elem := range list {
+		if err := ctx.iterate(); err != nil {
+			return types.Null(), err
+		}
 		ctx.SetVariable(paramName, elem)
 		val, err := e.eval(lambda, ctx)
 		if err != nil {
-			return types.Null(), errors.Newf(errors.ErrFunctionPanic, "some() failed at index %d: %v", i, err)
+			return types.Null(), lambdaError("some", i, err)
 		}
-		if val.IsTruthy() {
+		truthy, err := e.lambdaCondition("some", i, val)
+		if err != nil {
+			return types.Null(), err
+		}
+		if truthy {
 			return types.Bool(true), nil
 		}
 	}
@@ -989,12 +1763,19 @@ func (e *Evaluator) evalEveryFunction(call *ast.FunctionCall, ctx *EvalContext)
 
 	// Check if all elements match
 	for i, elem := range list {
+		if err := ctx.iterate(); err != nil {
+			return types.Null(), err
+		}
 		ctx.SetVariable(paramName, elem)
 		val, err := e.eval(lambda, ctx)
 		if err != nil {
-			return types.Null(), errors.Newf(errors.ErrFunctionPanic, "every() failed at index %d: %v", i, err)
+			return types.Null(), lambdaError("every", i, err)
 		}
-		if !val.IsTruthy() {
+		truthy, err := e.lambdaCondition("every", i, val)
+		if err != nil {
+			return types.Null(), err
+		}
+		if !truthy {
 			return types.Bool(false), nil
 		}
 	}
@@ -1002,6 +1783,70 @@ func (e *Evaluator) evalEveryFunction(call *ast.FunctionCall, ctx *EvalContext)
 	return types.Bool(true), nil
 }
 
+// evalSortWithFunction implements: sortWith(list, (a, b) => expr) or
+// sortWith(list, expr) with parameters a and b. The comparator returns a number, negative
+// if a comes before b, or a boolean, true if a comes before b. The sort is
+// stable.
+func (e *Evaluator) evalSortWithFunction(call *ast.FunctionCall, ctx *EvalContext) (types.Value, error) {
+	if len(call.Arguments) < 2 {
+		return types.Null(), errors.New(errors.ErrArgumentCount, "sortWith() requires at least 2 arguments: list and comparator")
+	}
+
+	// Evaluate the list
+	listVal, err := e.eval(call.Arguments[0], ctx)
+	if err != nil {
+		return types.Null(), err
+	}
+
+	list, ok := listVal.AsList()
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "sortWith() first argument must be a list, got %s", listVal.Type)
+	}
+
+	// Get the comparator - it needs a and b parameters
+	lambda, aName, bName, err := e.extractPairLambda(call.Arguments[1], call.Arguments, 2, "a", "b")
+	if err != nil {
+		return types.Null(), err
+	}
+
+	// Create a copy to avoid modifying the original
+	sorted := make([]types.Value, len(list))
+	copy(sorted, list)
+
+	// sort.SliceStable cannot be interrupted, so the first error makes the
+	// remaining comparisons no-ops
+	var sortErr error
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		if sortErr = ctx.iterate(); sortErr != nil {
+			return false
+		}
+		ctx.SetVariable(aName, sorted[i])
+		ctx.SetVariable(bName, sorted[j])
+		val, err := e.eval(lambda, ctx)
+		if err != nil {
+			sortErr = lambdaError("sortWith", -1, err)
+			return false
+		}
+		switch val.Type {
+		case types.TypeBool:
+			return val.IsTruthy()
+		case types.TypeInt, types.TypeFloat:
+			n, _ := val.AsFloat()
+			return n < 0
+		}
+		sortErr = errors.Newf(errors.ErrTypeMismatch, "sortWith() comparator must return a number or a boolean, got %s", val.Type)
+		return false
+	})
+	if sortErr != nil {
+		return types.Null(), sortErr
+	}
+
+	return types.List(sorted...), nil
+}
+
 // extractLambda extracts the lambda expression and parameter name from a function argument
 // It supports both lambda syntax (x => expr) and string syntax ("expr", "x")
 func (e *Evaluator) extractLambda(arg ast.Expression, allArgs []ast.Expression, nextIdx int) (ast.Expression, string, error) {
@@ -1029,31 +1874,55 @@ func (e *Evaluator) extractLambda(arg ast.Expression, allArgs []ast.Expression,
 
 // extractReduceLambda extracts lambda for reduce function which needs two parameters (acc, x)
 func (e *Evaluator) extractReduceLambda(arg ast.Expression, allArgs []ast.Expression, nextIdx int) (ast.Expression, string, string, error) {
+	lambda, accName, elemName, err := e.extractPairLambda(arg, allArgs, nextIdx, "acc", "x")
+	if err != nil {
+		return nil, "", "", errors.New(errors.ErrArgumentCount, "reduce lambda must have exactly 2 parameters (accumulator, element)")
+	}
+	return lambda, accName, elemName, nil
+}
+
+// extractPairLambda extracts a lambda with two parameters. For string syntax
+// the parameter names are taken from the next two string arguments, or default
+// to first and second.
+func (e *Evaluator) extractPairLambda(arg ast.Expression, allArgs []ast.Expression, nextIdx int, first, second string) (ast.Expression, string, string, error) {
 	// Check if it's a lambda expression
 	if lambda, ok := arg.(*ast.LambdaExpression); ok {
 		if len(lambda.Parameters) != 2 {
-			return nil, "", "", errors.New(errors.ErrArgumentCount, "reduce lambda must have exactly 2 parameters (accumulator, element)")
+			return nil, "", "", errors.New(errors.ErrArgumentCount, "lambda must have exactly 2 parameters")
 		}
 		return lambda.Body, lambda.Parameters[0].Value, lambda.Parameters[1].Value, nil
 	}
 
-	// Otherwise use default parameter names or get from additional arguments
-	accName := "acc"
-	elemName := "x"
-
 	// Check for custom parameter names
 	if nextIdx < len(allArgs) {
 		if strLit, ok := allArgs[nextIdx].(*ast.StringLiteral); ok {
-			accName = strLit.Value
+			first = strLit.Value
 		}
 	}
 	if nextIdx+1 < len(allArgs) {
 		if strLit, ok := allArgs[nextIdx+1].(*ast.StringLiteral); ok {
-			elemName = strLit.Value
+			second = strLit.Value
 		}
 	}
 
-	return arg, accName, elemName, nil
+	return arg, first, second, nil
+}
+
+// lambdaError wraps an error returned by a lambda for the element at index,
+// or for no particular element if index is negative. Limit violations are
+// returned unchanged so callers can tell them apart by code.
+func lambdaError(function string, index int, err error) error {
+	if errors.IsCode(err, errors.ErrTimeout) || errors.IsCode(err, errors.ErrIterationLimit) ||
+		errors.IsCode(err, errors.ErrFunctionDenied) || errors.IsCode(err, errors.ErrCallBudget) ||
+		errors.IsCode(err, errors.ErrMemoryLimit) || errors.IsCode(err, errors.ErrDepthLimit) ||
+		errors.IsCode(err, errors.ErrRegexDenied) || errors.IsCode(err, errors.ErrStrictComparison) ||
+		errors.IsCode(err, errors.ErrStrictNumeric) || errors.IsCode(err, errors.ErrStrictTruthiness) {
+		return err
+	}
+	if index < 0 {
+		return errors.Newf(errors.ErrFunctionPanic, "%s() failed: %v", function, err)
+	}
+	return errors.Newf(errors.ErrFunctionPanic, "%s() failed at index %d: %v", function, index, err)
 }
 
 // ============================================================================
@@ -1061,6 +1930,23 @@ func (e *Evaluator) extractReduceLambda(arg ast.Expression, allArgs []ast.Expres
 // ============================================================================
 
 func (e *Evaluator) evalFunctionCall(call *ast.FunctionCall, ctx *EvalContext) (types.Value, error) {
+	fn, ok := e.functions.Get(call.Name)
+
+	// Lazy functions evaluate only the arguments they need
+	if ok && fn.IsLazy() {
+		if pairs, ok := scorePairs(call); ok {
+			return e.evalScore(pairs, ctx)
+		}
+		args := make([]functions.Thunk, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			arg := arg
+			args[i] = functions.Memoize(func() (types.Value, error) {
+				return e.eval(arg, ctx)
+			})
+		}
+		return e.functions.CallLazy(call.Name, args...)
+	}
+
 	// Evaluate arguments
 	args := make([]types.Value, len(call.Arguments))
 	for i, arg := range call.Arguments {
@@ -1070,19 +1956,48 @@ func (e *Evaluator) evalFunctionCall(call *ast.FunctionCall, ctx *EvalContext) (
 		}
 		args[i] = val
 	}
+	return e.Call(call.Name, args, ctx)
+}
 
+// BeginCall checks a function call against the allowlist and the call
+// budgets and records it, before its arguments are evaluated.
+func (e *Evaluator) BeginCall(call *ast.FunctionCall, ctx *EvalContext) error {
+	if ctx.allowed != nil && !ctx.allowed[call.Name] {
+		return errors.NewAtf(errors.ErrFunctionDenied, call.Token.Line, call.Token.Column,
+			"function '%s' is not allowed in this expression", call.Name)
+	}
+	if err := ctx.countCall(call); err != nil {
+		return err
+	}
+	ctx.recordCall(call.Name)
+	return nil
+}
+
+// LazyCall reports whether a function evaluates its own arguments, as the
+// higher-order functions and lazy functions do, so that a call to it cannot
+// be made with Call.
+func (e *Evaluator) LazyCall(name string) bool {
+	if higherOrderFunctions[name] {
+		return true
+	}
+	fn, ok := e.functions.Get(name)
+	return ok && fn.IsLazy()
+}
+
+// Call calls a function other than a lazy one with evaluated arguments, after
+// BeginCall.
+func (e *Evaluator) Call(name string, args []types.Value, ctx *EvalContext) (types.Value, error) {
 	// Check if this is a JS function that needs the sandbox
-	fn, ok := e.functions.Get(call.Name)
-	if ok && fn.IsJS() {
+	if fn, ok := e.functions.Get(name); ok && fn.IsJS() {
 		if e.sandbox == nil {
 			return types.Null(), errors.Newf(errors.ErrSandboxViolation,
-				"cannot execute JS function '%s': sandbox not configured", call.Name)
+				"cannot execute JS function '%s': sandbox not configured", name)
 		}
-		return e.functions.CallJS(ctx.ctx, e.sandbox, call.Name, args)
+		return e.functions.CallJS(functions.WithEvalContext(ctx.ctx, ctx), e.sandbox, name, args)
 	}
 
 	// Call the built-in function
-	return e.functions.Call(call.Name, args...)
+	return e.functions.CallContext(ctx.ctx, ctx, name, args...)
 }
 
 func (e *Evaluator) evalIndexExpression(expr *ast.IndexExpression, ctx *EvalContext) (types.Value, error) {
@@ -1095,6 +2010,43 @@ func (e *Evaluator) evalIndexExpression(expr *ast.IndexExpression, ctx *EvalCont
 	if err != nil {
 		return types.Null(), err
 	}
+	return e.Index(left, index)
+}
+
+// Index returns the element of a list, the character of a string, or the
+// entry of a map at an index or key. A missing key gives null, and so does an
+// index out of range with WithSafeIndex.
+func (e *Evaluator) Index(left, index types.Value) (types.Value, error) {
+	if left.Type == types.TypeAny {
+		left = types.NewValue(left.Raw)
+	}
+	if m, ok := left.AsMap(); ok {
+		key, ok := index.AsString()
+		if !ok {
+			return types.Null(), errors.Newf(errors.ErrTypeMismatch,
+				"map key must be a string, got %s", index.Type)
+		}
+		if val, exists := m[key]; exists {
+			return val, nil
+		}
+		return types.Null(), nil
+	}
+
+	if left.Type == types.TypeString {
+		runes := []rune(left.Raw.(string))
+		idx, ok := index.AsInt()
+		if !ok {
+			return types.Null(), errors.Newf(errors.ErrTypeMismatch,
+				"index must be an integer, got %s", index.Type)
+		}
+		if idx < 0 {
+			idx = int64(len(runes)) + idx
+		}
+		if idx < 0 || idx >= int64(len(runes)) {
+			return e.outOfBounds()
+		}
+		return types.String(string(runes[idx])), nil
+	}
 
 	if left.Type != types.TypeList {
 		return types.Null(), errors.Newf(errors.ErrTypeMismatch,
@@ -1114,12 +2066,94 @@ func (e *Evaluator) evalIndexExpression(expr *ast.IndexExpression, ctx *EvalCont
 	}
 
 	if idx < 0 || idx >= int64(len(list)) {
-		return types.Null(), errors.New(errors.ErrIndexOutOfBounds, "index out of bounds")
+		return e.outOfBounds()
 	}
 
 	return list[idx], nil
 }
 
+// outOfBounds returns the result of an index out of range.
+func (e *Evaluator) outOfBounds() (types.Value, error) {
+	if e.safeIndex {
+		return types.Null(), nil
+	}
+	return types.Null(), errors.New(errors.ErrIndexOutOfBounds, "index out of bounds")
+}
+
+// evalSliceExpression returns the characters of a string or the elements of a
+// list from a start index up to, but not including, an end index. Negative
+// indices count from the end, and indices beyond either end are clamped, as
+// in the slice function.
+func (e *Evaluator) evalSliceExpression(expr *ast.SliceExpression, ctx *EvalContext) (types.Value, error) {
+	left, err := e.eval(expr.Left, ctx)
+	if err != nil {
+		return types.Null(), err
+	}
+	var bounds [2]*types.Value
+	for i, bound := range []ast.Expression{expr.Start, expr.End} {
+		if bound != nil {
+			val, err := e.eval(bound, ctx)
+			if err != nil {
+				return types.Null(), err
+			}
+			bounds[i] = &val
+		}
+	}
+	return e.Slice(left, bounds[0], bounds[1])
+}
+
+// Slice returns the characters of a string or the elements of a list from
+// start up to, but not including, end. A nil bound is omitted.
+func (e *Evaluator) Slice(left types.Value, start, end *types.Value) (types.Value, error) {
+	var runes []rune
+	var list []types.Value
+	var length int64
+	switch left.Type {
+	case types.TypeString:
+		runes = []rune(left.Raw.(string))
+		length = int64(len(runes))
+	case types.TypeList:
+		list, _ = left.AsList()
+		length = int64(len(list))
+	default:
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "cannot slice %s", left.Type)
+	}
+
+	from, err := sliceBound(start, 0, length)
+	if err != nil {
+		return types.Null(), err
+	}
+	to, err := sliceBound(end, length, length)
+	if err != nil {
+		return types.Null(), err
+	}
+	if from > to {
+		from = to
+	}
+
+	if left.Type == types.TypeString {
+		return types.String(string(runes[from:to])), nil
+	}
+	return types.List(list[from:to]...), nil
+}
+
+// sliceBound returns a bound of a slice of the given length, or def if it is
+// omitted.
+func sliceBound(bound *types.Value, def, length int64) (int64, error) {
+	if bound == nil {
+		return def, nil
+	}
+	val := *bound
+	idx, ok := val.AsInt()
+	if !ok {
+		return 0, errors.Newf(errors.ErrTypeMismatch, "slice index must be an integer, got %s", val.Type)
+	}
+	if idx < 0 {
+		idx += length
+	}
+	return min(max(idx, 0), length), nil
+}
+
 func (e *Evaluator) evalMemberExpression(expr *ast.MemberExpression, ctx *EvalContext) (types.Value, error) {
 	// For member expressions on identifiers, we can convert to variable lookup
 	// or treat as JSONPath-like access
@@ -1128,13 +2162,19 @@ func (e *Evaluator) evalMemberExpression(expr *ast.MemberExpression, ctx *EvalCo
 	if err != nil {
 		return types.Null(), err
 	}
+	return e.Member(object, expr.Property.Value)
+}
 
-	// If object is a map-like structure, access the property
+// Member returns the entry of a map named by a property, or null if there is
+// none.
+func (e *Evaluator) Member(object types.Value, property string) (types.Value, error) {
+	// Objects wrapped as any, such as by custom functions, are read as maps
 	if object.Type == types.TypeAny {
-		if m, ok := object.Raw.(map[string]interface{}); ok {
-			if val, exists := m[expr.Property.Value]; exists {
-				return types.NewValue(val), nil
-			}
+		object = types.NewValue(object.Raw)
+	}
+	if m, ok := object.AsMap(); ok {
+		if val, exists := m[property]; exists {
+			return val, nil
 		}
 	}
 
@@ -1171,8 +2211,12 @@ func gjsonToValue(result gjson.Result) types.Value {
 			}
 			return types.List(elements...)
 		}
-		// For objects, return as any
-		return types.Any(result.Value())
+		entries := make(map[string]types.Value)
+		result.ForEach(func(key, value gjson.Result) bool {
+			entries[key.String()] = gjsonToValue(value)
+			return true
+		})
+		return types.Map(entries)
 	default:
 		return types.Any(result.Value())
 	}
@@ -1239,3 +2283,85 @@ func marshalJSON(v interface{}) ([]byte, error) {
 		return []byte(fmt.Sprintf("%v", v)), nil
 	}
 }
+
+// ============================================================================
+// Weighted scoring
+// ============================================================================
+
+// scorePairs returns the conditions and weights of a call of score with a
+// literal list of [condition, weight] pairs, which the evaluator evaluates
+// one pair at a time. Other calls, such as score($.signals), are left to the
+// function.
+func scorePairs(call *ast.FunctionCall) ([][2]ast.Expression, bool) {
+	if call.Name != functions.ScoreFunction || len(call.Arguments) != 1 {
+		return nil, false
+	}
+	list, ok := call.Arguments[0].(*ast.ListLiteral)
+	if !ok {
+		return nil, false
+	}
+	pairs := make([][2]ast.Expression, len(list.Elements))
+	for i, elem := range list.Elements {
+		pair, ok := elem.(*ast.ListLiteral)
+		if !ok || len(pair.Elements) != 2 {
+			return nil, false
+		}
+		pairs[i] = [2]ast.Expression{pair.Elements[0], pair.Elements[1]}
+	}
+	return pairs, true
+}
+
+// evalScore sums the weights of the pairs whose condition holds. The weights
+// of the other pairs are not evaluated.
+func (e *Evaluator) evalScore(pairs [][2]ast.Expression, ctx *EvalContext) (types.Value, error) {
+	var total float64
+	for i, pair := range pairs {
+		cond, err := e.eval(pair[0], ctx)
+		if err != nil {
+			return types.Null(), err
+		}
+		holds, err := e.condition(cond, "a condition of score")
+		if err != nil {
+			return types.Null(), err
+		}
+		if !holds {
+			continue
+		}
+		v, err := e.eval(pair[1], ctx)
+		if err != nil {
+			return types.Null(), err
+		}
+		weight, err := functions.ScoreWeight(v, i)
+		if err != nil {
+			annotate(err, pair[1])
+			return types.Null(), err
+		}
+		total += weight
+	}
+	return types.Float(total), nil
+}
+
+// explainScore explains a score pair by pair: the condition, and the weight
+// it added if it holds.
+func (e *Evaluator) explainScore(pairs [][2]ast.Expression, result types.Value, ctx *EvalContext) ([]*Explanation, string) {
+	children := make([]*Explanation, len(pairs))
+	held := 0
+	for i, pair := range pairs {
+		condVal, condExp, _ := e.evalWithExplanation(pair[0], ctx)
+		child := &Explanation{
+			Expression: fmt.Sprintf("[%s, %s]", pair[0].String(), pair[1].String()),
+			Result:     types.Float(0),
+			Children:   []*Explanation{condExp},
+			Reason:     "Condition does not hold: +0",
+		}
+		if e.IsTruthy(condVal) {
+			weight, weightExp, _ := e.evalWithExplanation(pair[1], ctx)
+			child.Children = append(child.Children, weightExp)
+			child.Result = weight
+			child.Reason = fmt.Sprintf("Condition holds: +%v", weight.Raw)
+			held++
+		}
+		children[i] = child
+	}
+	return children, fmt.Sprintf("Score of %d of %d conditions = %v", held, len(pairs), result.Raw)
+}
@@ -2,9 +2,13 @@
 package eval
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
 	"github.com/bencagri/amel/pkg/parser"
 	"github.com/bencagri/amel/pkg/types"
 	"github.com/stretchr/testify/assert"
@@ -631,6 +635,22 @@ func TestEvaluator_DivisionByZero(t *testing.T) {
 	assert.Contains(t, err.Error(), "division by zero")
 }
 
+func TestEvaluator_IntegerDivisionOverflow(t *testing.T) {
+	evaluator, err := New()
+	require.NoError(t, err)
+
+	ctx, err := NewContext(map[string]interface{}{})
+	require.NoError(t, err)
+
+	expr, err := parser.Parse("(-9223372036854775807 - 1) ~/ -1")
+	require.NoError(t, err)
+
+	_, err = evaluator.Evaluate(expr, ctx)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrTypeMismatch), err.Error())
+	assert.Contains(t, err.Error(), "out of the range of an int")
+}
+
 func TestEvaluator_ModuloByZero(t *testing.T) {
 	evaluator, err := New()
 	require.NoError(t, err)
@@ -700,6 +720,47 @@ func TestEvaluator_Timeout(t *testing.T) {
 	// Error might or might not happen depending on timing, so we just verify no panic
 }
 
+func TestEvaluator_CooperativeCancellation(t *testing.T) {
+	registry, err := functions.NewDefaultRegistry()
+	require.NoError(t, err)
+
+	// stall() returns its argument once the evaluation has timed out, so the
+	// work on its result starts past the deadline
+	err = registry.RegisterContextual("stall", func(ctx context.Context, ec functions.EvalContext, args ...types.Value) (types.Value, error) {
+		<-ctx.Done()
+		return args[0], nil
+	}, types.NewFunctionSignature("stall", types.TypeAny, types.Param("value", types.TypeAny)))
+	require.NoError(t, err)
+
+	evaluator, err := New(WithFunctions(registry), WithTimeout(10*time.Millisecond))
+	require.NoError(t, err)
+
+	items := make([]interface{}, 5000)
+	for i := range items {
+		items[i] = []interface{}{i, i + 1}
+	}
+	ctx, err := NewContext(map[string]interface{}{"items": items, "email": "ops@example.com"})
+	require.NoError(t, err)
+
+	for _, input := range []string{
+		`flatten(stall($.items))`,
+		`unique(stall($.items))`,
+		`sortAsc(stall($.items))`,
+		`map(stall($.items), x => 1)`,
+		`-1 IN stall($.items)`,
+		`stall($.email) =~ "^ops@"`,
+	} {
+		t.Run(input, func(t *testing.T) {
+			expr, err := parser.Parse(input)
+			require.NoError(t, err)
+
+			_, err = evaluator.Evaluate(expr, ctx)
+			require.Error(t, err)
+			assert.True(t, errors.IsCode(err, errors.ErrTimeout), err.Error())
+		})
+	}
+}
+
 func TestEvaluator_IndexExpression(t *testing.T) {
 	evaluator, err := New()
 	require.NoError(t, err)
@@ -817,6 +878,119 @@ func TestEvaluator_IfThenElse(t *testing.T) {
 	}
 }
 
+func TestEvaluator_LazyFunctions(t *testing.T) {
+	evaluator, err := New()
+	require.NoError(t, err)
+
+	ctx, err := NewContext(map[string]interface{}{"zero": 0, "limit": nil})
+	require.NoError(t, err)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`ifThenElse($.zero == 0, 0, 10 / $.zero)`, int64(0)},
+		{`ifThenElse($.zero != 0, 10 / $.zero, -1)`, int64(-1)},
+		{`coalesce(1, 10 / $.zero)`, int64(1)},
+		{`defaultVal(5, 10 / $.zero)`, int64(5)},
+		{`defaultVal($.limit, 10)`, int64(10)},
+		{`tryCatch(10 / $.zero, 0)`, int64(0)},
+		{`tryCatch(10 / 2, 0)`, float64(5)},
+		{`score([[$.zero == 0, 5], [$.zero != 0, 10 / $.zero]])`, float64(5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+
+			result, err := evaluator.Evaluate(expr, ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.Raw)
+		})
+	}
+
+	t.Run("argument errors keep their code", func(t *testing.T) {
+		expr, err := parser.Parse(`ifThenElse(true, 10 / $.zero, 0)`)
+		require.NoError(t, err)
+
+		_, err = evaluator.Evaluate(expr, ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrDivisionByZero), err.Error())
+	})
+
+	t.Run("argument count is checked", func(t *testing.T) {
+		expr, err := parser.Parse(`ifThenElse(true, 1)`)
+		require.NoError(t, err)
+
+		_, err = evaluator.Evaluate(expr, ctx)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrArgumentCount), err.Error())
+	})
+}
+
+func TestEvaluator_ContextualFunctions(t *testing.T) {
+	registry, err := functions.NewDefaultRegistry()
+	require.NoError(t, err)
+
+	// tier(score) looks up the thresholds in the payload
+	err = registry.RegisterContextual("tier", func(ctx context.Context, ec functions.EvalContext, args ...types.Value) (types.Value, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return types.Null(), fmt.Errorf("no deadline")
+		}
+		score, _ := args[0].AsFloat()
+		gold, _ := ec.Lookup("$.thresholds.gold").AsFloat()
+		if score >= gold {
+			return types.String("gold"), nil
+		}
+		return types.String("basic"), nil
+	}, types.NewFunctionSignature("tier", types.TypeString, types.Param("score", types.TypeFloat)))
+	require.NoError(t, err)
+
+	// scaled() reads the lambda parameter x
+	err = registry.RegisterContextual("scaled", func(ctx context.Context, ec functions.EvalContext, args ...types.Value) (types.Value, error) {
+		x, ok := ec.Variable("x")
+		if !ok {
+			return types.Null(), fmt.Errorf("x is not defined")
+		}
+		n, _ := x.AsInt()
+		return types.Int(n * 10), nil
+	}, types.NewFunctionSignature("scaled", types.TypeInt))
+	require.NoError(t, err)
+
+	evaluator, err := New(WithFunctions(registry))
+	require.NoError(t, err)
+
+	ctx, err := NewContext(map[string]interface{}{
+		"thresholds": map[string]interface{}{"gold": 100},
+		"items":      []interface{}{1, 2},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`tier(150)`, "gold"},
+		{`tier(50)`, "basic"},
+		{`sum(map($.items, x => scaled()))`, float64(30)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+
+			result, err := evaluator.Evaluate(expr, ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.Raw)
+		})
+	}
+
+	_, err = registry.Call("tier", types.Int(1))
+	require.Error(t, err)
+}
+
 func TestEvaluator_TypeOf(t *testing.T) {
 	evaluator, err := New()
 	require.NoError(t, err)
@@ -973,3 +1147,36 @@ func BenchmarkEvaluator_ComplexExpression(b *testing.B) {
 		evaluator.Evaluate(expr, ctx)
 	}
 }
+
+func TestEvaluator_Limits(t *testing.T) {
+	evaluator, err := New(WithMaxIterations(5))
+	require.NoError(t, err)
+
+	ctx, err := NewContext(map[string]interface{}{"items": []interface{}{1, 2, 3}})
+	require.NoError(t, err)
+
+	evaluate := func(input string) (types.Value, error) {
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		return evaluator.Evaluate(expr, ctx)
+	}
+
+	_, err = evaluate(`len(map($.items, x => x * 2))`)
+	require.NoError(t, err)
+
+	_, err = evaluate(`len(map($.items, x => len(filter($.items, y => y > x))))`)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrIterationLimit), err.Error())
+
+	ctx.SetLimits(Limits{MaxIterations: 20, Functions: []string{"len", "map", "filter"}})
+	_, err = evaluate(`len(map($.items, x => len(filter($.items, y => y > x))))`)
+	require.NoError(t, err)
+
+	_, err = evaluate(`len(map($.items, x => upper("a")))`)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrFunctionDenied), err.Error())
+
+	ctx.SetLimits(Limits{})
+	_, err = evaluate(`upper("a")`)
+	require.NoError(t, err)
+}
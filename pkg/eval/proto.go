@@ -0,0 +1,190 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// NewProtoContext creates an evaluation context from a protobuf message,
+// including dynamicpb messages. Payload paths use the JSON names of fields,
+// so a field declared as user_id is read with $.userId, or with the name set
+// by its json_name option.
+//
+// Fields without presence that are not set hold their default value, as in
+// the message itself, while unset message fields, optional fields, and oneof
+// members are null. Integers and floating-point numbers keep their numeric
+// types, enums are read as the names of their values, bytes as base64
+// strings, and well-known types such as google.protobuf.Timestamp and
+// google.protobuf.Struct as in the protobuf JSON mapping. Payload still holds
+// the message.
+func NewProtoContext(msg proto.Message) (*EvalContext, error) {
+	value, err := protoMessageValue(msg.ProtoReflect())
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidPath, "failed to convert protobuf payload", err)
+	}
+	ctx, err := NewContext(value)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Payload = msg
+	return ctx, nil
+}
+
+// protoMessageValue converts a message to the values marshalJSON supports.
+func protoMessageValue(m protoreflect.Message) (interface{}, error) {
+	if !m.IsValid() {
+		return nil, nil
+	}
+
+	desc := m.Descriptor()
+	if strings.HasPrefix(string(desc.FullName()), "google.protobuf.") {
+		if strings.HasSuffix(string(desc.Name()), "Value") && desc.Fields().Len() == 1 && desc.Fields().Get(0).Name() == "value" {
+			// Wrapper types, such as google.protobuf.Int64Value
+			field := desc.Fields().Get(0)
+			return protoScalarValue(field, m.Get(field))
+		}
+		return protoWellKnownValue(m)
+	}
+
+	result := make(map[string]interface{}, desc.Fields().Len())
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.HasPresence() && !m.Has(field) {
+			continue
+		}
+		value, err := protoFieldValue(field, m.Get(field))
+		if err != nil {
+			return nil, err
+		}
+		result[field.JSONName()] = value
+	}
+	return result, nil
+}
+
+// protoFieldValue converts the value of a field, which may be a list or map.
+func protoFieldValue(field protoreflect.FieldDescriptor, value protoreflect.Value) (interface{}, error) {
+	switch {
+	case field.IsList():
+		list := value.List()
+		result := make([]interface{}, list.Len())
+		for i := range result {
+			elem, err := protoSingularValue(field, list.Get(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = elem
+		}
+		return result, nil
+	case field.IsMap():
+		result := make(map[string]interface{}, value.Map().Len())
+		var err error
+		value.Map().Range(func(key protoreflect.MapKey, elem protoreflect.Value) bool {
+			var v interface{}
+			v, err = protoSingularValue(field.MapValue(), elem)
+			result[key.String()] = v
+			return err == nil
+		})
+		return result, err
+	}
+	return protoSingularValue(field, value)
+}
+
+// protoSingularValue converts a single value of a field.
+func protoSingularValue(field protoreflect.FieldDescriptor, value protoreflect.Value) (interface{}, error) {
+	if field.Message() != nil {
+		return protoMessageValue(value.Message())
+	}
+	return protoScalarValue(field, value)
+}
+
+// protoScalarValue converts a value of a scalar or enum field.
+func protoScalarValue(field protoreflect.FieldDescriptor, value protoreflect.Value) (interface{}, error) {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return value.Bool(), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return value.Int(), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if n := value.Uint(); n <= math.MaxInt64 {
+			return int64(n), nil
+		}
+		return float64(value.Uint()), nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		f := value.Float()
+		if field.Kind() == protoreflect.FloatKind {
+			// Use the shortest decimal of the float32, 0.1 rather than 0.10000000149011612
+			f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, 32), 64)
+		}
+		switch {
+		case math.IsNaN(f):
+			return "NaN", nil
+		case math.IsInf(f, 1):
+			return "Infinity", nil
+		case math.IsInf(f, -1):
+			return "-Infinity", nil
+		}
+		return f, nil
+	case protoreflect.StringKind:
+		return value.String(), nil
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(value.Bytes()), nil
+	case protoreflect.EnumKind:
+		if field.Enum().FullName() == "google.protobuf.NullValue" {
+			return nil, nil
+		}
+		if v := field.Enum().Values().ByNumber(value.Enum()); v != nil {
+			return string(v.Name()), nil
+		}
+		return int64(value.Enum()), nil
+	}
+	return nil, nil
+}
+
+// protoWellKnownValue converts well-known types, such as Timestamp, Duration,
+// and Struct, through their protobuf JSON mapping.
+func protoWellKnownValue(m protoreflect.Message) (interface{}, error) {
+	b, err := protojson.Marshal(m.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(b)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return jsonNumbers(value), nil
+}
+
+// jsonNumbers replaces json.Number values by int64 or float64.
+func jsonNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = jsonNumbers(v[k])
+		}
+	}
+	return value
+}
@@ -0,0 +1,192 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// testOrderDescriptor describes:
+//
+//	message Order {
+//	  int64 order_id = 1;
+//	  string customer = 2 [json_name = "buyer"];
+//	  repeated Item items = 3;
+//	  Status status = 4;
+//	  map<string, string> labels = 5;
+//	  google.protobuf.Timestamp created_at = 6;
+//	  google.protobuf.DoubleValue discount = 7;
+//	  Item gift = 8;
+//	  float ratio = 9;
+//	  enum Status { PENDING = 0; SHIPPED = 1; }
+//	  message Item { string sku = 1; uint32 quantity = 2; }
+//	}
+func testOrderDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Type:   typ.Enum(),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	repeated := func(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		return f
+	}
+
+	customer := field("customer", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	customer.JsonName = proto.String("buyer")
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("amel/test/order.proto"),
+		Package:    proto.String("amel.test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto", "google/protobuf/wrappers.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Order"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("order_id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				customer,
+				repeated(field("items", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".amel.test.Order.Item")),
+				field("status", 4, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".amel.test.Order.Status"),
+				repeated(field("labels", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".amel.test.Order.LabelsEntry")),
+				field("created_at", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				field("discount", 7, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.DoubleValue"),
+				field("gift", 8, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".amel.test.Order.Item"),
+				field("ratio", 9, descriptorpb.FieldDescriptorProto_TYPE_FLOAT, ""),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{
+				{
+					Name: proto.String("Item"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("sku", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+						field("quantity", 2, descriptorpb.FieldDescriptorProto_TYPE_UINT32, ""),
+					},
+				},
+				{
+					Name: proto.String("LabelsEntry"),
+					Field: []*descriptorpb.FieldDescriptorProto{
+						field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+						field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					},
+					Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+				},
+			},
+			EnumType: []*descriptorpb.EnumDescriptorProto{{
+				Name: proto.String("Status"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{
+					{Name: proto.String("PENDING"), Number: proto.Int32(0)},
+					{Name: proto.String("SHIPPED"), Number: proto.Int32(1)},
+				},
+			}},
+		}},
+	}
+
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd.Messages().ByName("Order")
+}
+
+func TestNewProtoContext(t *testing.T) {
+	desc := testOrderDescriptor(t)
+	fields := desc.Fields()
+	item := desc.Messages().ByName("Item")
+
+	order := dynamicpb.NewMessage(desc)
+	order.Set(fields.ByName("order_id"), protoreflect.ValueOfInt64(1234567890123))
+	order.Set(fields.ByName("customer"), protoreflect.ValueOfString("ada"))
+	order.Set(fields.ByName("status"), protoreflect.ValueOfEnum(1))
+	order.Set(fields.ByName("ratio"), protoreflect.ValueOfFloat32(0.1))
+	items := order.Mutable(fields.ByName("items")).List()
+	for _, q := range []uint64{2, 5} {
+		it := dynamicpb.NewMessage(item)
+		it.Set(item.Fields().ByName("sku"), protoreflect.ValueOfString("sku-1"))
+		it.Set(item.Fields().ByName("quantity"), protoreflect.ValueOfUint32(uint32(q)))
+		items.Append(protoreflect.ValueOfMessage(it))
+	}
+	order.Mutable(fields.ByName("labels")).Map().Set(
+		protoreflect.ValueOfString("region").MapKey(), protoreflect.ValueOfString("eu"))
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	order.Set(fields.ByName("created_at"), protoreflect.ValueOfMessage(timestamppb.New(created).ProtoReflect()))
+	order.Set(fields.ByName("discount"), protoreflect.ValueOfMessage(wrapperspb.Double(0.25).ProtoReflect()))
+
+	ctx, err := NewProtoContext(order)
+	require.NoError(t, err)
+	assert.Same(t, order, ctx.Payload)
+
+	evaluator, err := New()
+	require.NoError(t, err)
+
+	tests := []struct {
+		dsl      string
+		expected types.Value
+	}{
+		{`$.orderId`, types.Int(1234567890123)},
+		{`$.buyer`, types.String("ada")},
+		{`$.customer`, types.Null()},
+		{`$.status == "SHIPPED"`, types.Bool(true)},
+		{`$.items[1].quantity * 2`, types.Int(10)},
+		{`len($.items)`, types.Int(2)},
+		{`$.labels.region`, types.String("eu")},
+		{`$.createdAt`, types.String("2026-01-02T03:04:05Z")},
+		{`$.discount`, types.Float(0.25)},
+		{`$.gift`, types.Null()},
+		{`$.ratio`, types.Float(0.1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			expr, err := parser.Parse(tt.dsl)
+			require.NoError(t, err)
+			result, err := evaluator.Evaluate(expr, ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	t.Run("NewContext accepts messages", func(t *testing.T) {
+		ctx, err := NewContext(order)
+		require.NoError(t, err)
+		expr, err := parser.Parse(`$.buyer == "ada" && $.items[0].sku == "sku-1"`)
+		require.NoError(t, err)
+		result, err := evaluator.Evaluate(expr, ctx)
+		require.NoError(t, err)
+		assert.True(t, result.IsTruthy())
+	})
+
+	t.Run("unset fields", func(t *testing.T) {
+		ctx, err := NewProtoContext(dynamicpb.NewMessage(desc))
+		require.NoError(t, err)
+		for dsl, expected := range map[string]types.Value{
+			`$.orderId`:    types.Int(0),
+			`$.status`:     types.String("PENDING"),
+			`len($.items)`: types.Int(0),
+			`$.createdAt`:  types.Null(),
+		} {
+			expr, err := parser.Parse(dsl)
+			require.NoError(t, err)
+			result, err := evaluator.Evaluate(expr, ctx)
+			require.NoError(t, err)
+			assert.Equal(t, expected, result, dsl)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"context"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// The methods below let other executors, such as the bytecode VM of package
+// vm, evaluate an expression step by step with the semantics of the
+// evaluator: Begin starts an evaluation, the operators are applied with
+// Unary, Binary, In, Match, Index, Slice, and Member, functions are called
+// with BeginCall and Call, and any node may be handed back to the evaluator
+// with Eval.
+
+// Begin prepares a context for a new evaluation, as Evaluate does: it sets up
+// the timeout and console output and resets the budgets. The returned
+// function releases the timeout.
+func (e *Evaluator) Begin(ctx *EvalContext) context.CancelFunc {
+	return e.start(ctx, false)
+}
+
+// Eval evaluates a node of an expression whose evaluation has begun, nested
+// depth levels deep in the expression.
+func (e *Evaluator) Eval(node ast.Expression, depth int, ctx *EvalContext) (types.Value, error) {
+	ctx.depth = depth
+	return e.eval(node, ctx)
+}
+
+// MaxDepth returns the maximum nesting depth of the nodes the evaluator
+// evaluates, or zero if there is no limit.
+func (e *Evaluator) MaxDepth() int {
+	return e.maxDepth
+}
+
+// Condition returns the truthiness of a value used as a condition, described
+// by what, such as "the condition of ?:". With strict types, the value must
+// be a bool.
+func (e *Evaluator) Condition(v types.Value, what string) (bool, error) {
+	return e.condition(v, what)
+}
+
+// CheckTimeout returns ErrTimeout if the evaluation timed out.
+func (ec *EvalContext) CheckTimeout() error {
+	select {
+	case <-ec.ctx.Done():
+		return errors.New(errors.ErrTimeout, "evaluation timed out")
+	default:
+		return nil
+	}
+}
+
+// RecordClause reports the outcome of an operand of && or || to the clause
+// recorder of the context, if any, and returns it.
+func (ec *EvalContext) RecordClause(clause ast.Expression, truthy bool) bool {
+	return ec.recordClause(clause, truthy)
+}
+
+// Annotate records on err the node it was raised by, unless an inner node was
+// recorded already.
+func Annotate(err error, node ast.Expression) {
+	annotate(err, node)
+}
@@ -0,0 +1,63 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// WithStrictTypes disallows implicit conversions between types. Comparing
+// values of different types with ==, !=, <, <=, >, >=, or IN fails with
+// ErrStrictComparison, an int and a float in one comparison or arithmetic
+// operation fail with ErrStrictNumeric, and a value other than a bool used as
+// a condition fails with ErrStrictTruthiness: the operands of &&, ||, and !,
+// the condition of ?:, the conditions of case and score, the results of the lambdas of
+// filter, find, some, and every, and the result of EvaluateBool and Matched. Any value may be compared
+// with null, and the bool, all, and any functions still convert their
+// arguments.
+func WithStrictTypes(enabled bool) Option {
+	return func(e *Evaluator) {
+		e.strict = enabled
+	}
+}
+
+// checkOperands returns the error strict types raise for applying a binary
+// operator, or IN, to two values.
+func (e *Evaluator) checkOperands(op string, left, right types.Value) error {
+	if !e.strict || left.IsNull() || right.IsNull() || left.Type == right.Type {
+		return nil
+	}
+	if left.Type.IsNumeric() && right.Type.IsNumeric() {
+		return errors.Newf(errors.ErrStrictNumeric, "strict types: cannot mix %s and %s with %s", left.Type, right.Type, op)
+	}
+	if comparisonOperators[op] || op == "IN" {
+		return errors.Newf(errors.ErrStrictComparison, "strict types: cannot compare %s and %s with %s", left.Type, right.Type, op)
+	}
+	return nil
+}
+
+// condition returns the truthiness of a value used as a condition, described
+// by what. With strict types, the value must be a bool.
+func (e *Evaluator) condition(v types.Value, what string) (bool, error) {
+	if e.strict && v.Type != types.TypeBool {
+		return false, errors.Newf(errors.ErrStrictTruthiness, "strict types: %s must be a bool, got %s", what, v.Type)
+	}
+	return e.IsTruthy(v), nil
+}
+
+// lambdaCondition returns the truthiness of the result of the lambda of a
+// higher-order function, such as filter, for the element at index. With
+// strict types, the result must be a bool.
+func (e *Evaluator) lambdaCondition(function string, index int, v types.Value) (bool, error) {
+	if e.strict && v.Type != types.TypeBool {
+		return false, errors.Newf(errors.ErrStrictTruthiness,
+			"strict types: the %s() lambda must return a bool, got %s at index %d", function, v.Type, index)
+	}
+	return e.IsTruthy(v), nil
+}
+
+// Matched returns whether the result of an expression counts as a match: its
+// truthiness, or with strict types an error unless it is a bool.
+func (e *Evaluator) Matched(result types.Value) (bool, error) {
+	return e.condition(result, "the result of the expression")
+}
@@ -0,0 +1,102 @@
+// Package eval implements the AST evaluator for the AMEL DSL.
+package eval
+
+import (
+	"math"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// evalTemporal evaluates arithmetic on dates/times and durations: a duration
+// added to or subtracted from a date/time, the duration between two
+// dates/times, and sums, differences, multiples, and quotients of durations.
+// Strings are read as timestamps when combined with a duration or a date/time.
+// It reports false if neither operand is a date/time or a duration.
+func evalTemporal(op string, left, right types.Value) (types.Value, bool, error) {
+	if !isTemporal(left) && !isTemporal(right) {
+		return types.Null(), false, nil
+	}
+
+	switch op {
+	case "+":
+		if d, ok := durationOperand(right); ok {
+			if t, ok := left.AsTime(); ok {
+				return types.Time(t.Add(d)), true, nil
+			}
+			if l, ok := durationOperand(left); ok {
+				return types.Duration(l + d), true, nil
+			}
+		}
+		if d, ok := durationOperand(left); ok {
+			if t, ok := right.AsTime(); ok {
+				return types.Time(t.Add(d)), true, nil
+			}
+		}
+	case "-":
+		if d, ok := durationOperand(right); ok {
+			if t, ok := left.AsTime(); ok {
+				return types.Time(t.Add(-d)), true, nil
+			}
+			if l, ok := durationOperand(left); ok {
+				return types.Duration(l - d), true, nil
+			}
+		}
+		if left.Type == types.TypeDateTime || right.Type == types.TypeDateTime {
+			l, lok := left.AsTime()
+			r, rok := right.AsTime()
+			if lok && rok {
+				return types.Duration(l.Sub(r)), true, nil
+			}
+		}
+	case "*":
+		if d, ok := durationOperand(left); ok && right.Type.IsNumeric() {
+			return types.Duration(scaleDuration(d, right)), true, nil
+		}
+		if d, ok := durationOperand(right); ok && left.Type.IsNumeric() {
+			return types.Duration(scaleDuration(d, left)), true, nil
+		}
+	case "/":
+		d, ok := durationOperand(left)
+		if !ok {
+			break
+		}
+		if r, ok := durationOperand(right); ok {
+			if r == 0 {
+				return types.Null(), true, errors.New(errors.ErrDivisionByZero, "division by zero")
+			}
+			return types.Float(float64(d) / float64(r)), true, nil
+		}
+		if r, ok := right.AsFloat(); ok {
+			if r == 0 {
+				return types.Null(), true, errors.New(errors.ErrDivisionByZero, "division by zero")
+			}
+			return types.Duration(time.Duration(math.Round(float64(d) / r))), true, nil
+		}
+	}
+	return types.Null(), false, nil
+}
+
+// isTemporal reports whether a value is a date/time or a duration.
+func isTemporal(v types.Value) bool {
+	return v.Type == types.TypeDateTime || v.Type == types.TypeDuration
+}
+
+// durationOperand returns the duration of an operand that is a duration.
+func durationOperand(v types.Value) (time.Duration, bool) {
+	if v.Type != types.TypeDuration {
+		return 0, false
+	}
+	return v.AsDuration()
+}
+
+// scaleDuration multiplies a duration by a number.
+func scaleDuration(d time.Duration, n types.Value) time.Duration {
+	if n.Type == types.TypeInt {
+		i, _ := n.AsInt()
+		return d * time.Duration(i)
+	}
+	f, _ := n.AsFloat()
+	return time.Duration(math.Round(float64(d) * f))
+}
@@ -0,0 +1,215 @@
+// Package format prints AMEL expressions in canonical form.
+package format
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/lexer"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+// Externalized is an expression whose constants were replaced by named
+// parameters.
+type Externalized struct {
+	// Source is the rewritten expression in canonical form. It reads each
+	// parameter as a plain identifier, such as minAge in $.age >= minAge.
+	Source string `json:"source"`
+	// Params maps the parameter names to the values they replaced: int64,
+	// float64, string, or []interface{} of these for lists.
+	Params map[string]interface{} `json:"params"`
+}
+
+// ExternalizeSource parses a DSL expression and externalizes its constants.
+func ExternalizeSource(dsl string) (*Externalized, error) {
+	expr, err := parser.Parse(dsl)
+	if err != nil {
+		return nil, err
+	}
+	return Externalize(expr)
+}
+
+// Externalize finds the magic constants of an expression, the number and
+// string literals compared with == != < <= > >= and the literal lists of IN,
+// and replaces them with parameters named after what they are compared with:
+// $.age >= 18 becomes $.age >= minAge, $.age < 65 becomes $.age < maxAge, and
+// $.country IN ["DE", "FR"] becomes $.country IN countryList. Equal constants
+// compared with the same field share a parameter. Booleans, null, regex
+// patterns, and function arguments are kept. expr is not modified.
+//
+// Evaluate the result with engine.CompiledExpression.Bind to supply the
+// parameters.
+func Externalize(expr ast.Expression) (*Externalized, error) {
+	// Rewrite a copy so the caller's tree is unchanged
+	data, err := ast.Marshal(expr)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := ast.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &externalizer{params: make(map[string]interface{}), used: make(map[string]bool)}
+	ast.Inspect(tree, func(node ast.Expression) bool {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			x.used[n.Value] = true
+		case *ast.LambdaExpression:
+			for _, p := range n.Parameters {
+				x.used[p.Value] = true
+			}
+		}
+		return true
+	})
+	ast.Inspect(tree, func(node ast.Expression) bool {
+		switch n := node.(type) {
+		case *ast.BinaryExpression:
+			prefix, flipped, ok := comparisonPrefix(n.Operator)
+			if !ok {
+				break
+			}
+			if value, ok := constantValue(n.Right); ok {
+				n.Right = x.param(prefix, n.Left, value)
+			} else if value, ok := constantValue(n.Left); ok {
+				n.Left = x.param(flipped, n.Right, value)
+			}
+		case *ast.InExpression:
+			if list, ok := n.Right.(*ast.ListLiteral); ok {
+				if value, ok := constantValue(list); ok {
+					n.Right = x.param("", n.Left, value, "List")
+				}
+			}
+		}
+		return true
+	})
+
+	return &Externalized{Source: Node(tree), Params: x.params}, nil
+}
+
+// externalizer names the parameters of an expression.
+type externalizer struct {
+	params map[string]interface{}
+	used   map[string]bool // Identifiers of the expression
+}
+
+// param returns the identifier of the parameter holding value, compared with
+// operand, creating the parameter unless an equal one has the same name.
+func (x *externalizer) param(prefix string, operand ast.Expression, value interface{}, suffix ...string) ast.Expression {
+	base := subjectName(operand)
+	if prefix != "" {
+		base = prefix + strings.ToUpper(base[:1]) + base[1:]
+	}
+	base += strings.Join(suffix, "")
+	if lexer.LookupIdent(base) != lexer.TOKEN_IDENT {
+		base += "Value"
+	}
+
+	name := base
+	for i := 2; ; i++ {
+		existing, ok := x.params[name]
+		if ok && reflect.DeepEqual(existing, value) {
+			break
+		}
+		if !ok && !x.used[name] {
+			x.params[name] = value
+			break
+		}
+		name = base + strconv.Itoa(i)
+	}
+	return &ast.Identifier{Token: lexer.Token{Type: lexer.TOKEN_IDENT, Literal: name}, Value: name}
+}
+
+// comparisonPrefix returns the name prefixes of the parameters of a
+// comparison, for a constant on the right and on the left.
+func comparisonPrefix(op string) (right, left string, ok bool) {
+	switch op {
+	case "==", "!=":
+		return "", "", true
+	case ">", ">=":
+		return "min", "max", true
+	case "<", "<=":
+		return "max", "min", true
+	}
+	return "", "", false
+}
+
+var namePart = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// subjectName returns the name of what a constant is compared with: the
+// last field of a path or member access, an identifier, or the function
+// name and subject of a call, such as lenName for len($.name).
+func subjectName(expr ast.Expression) string {
+	var name string
+	switch n := expr.(type) {
+	case *ast.JSONPathExpression:
+		parts := namePart.FindAllString(n.Path, -1)
+		if len(parts) > 0 {
+			name = parts[len(parts)-1]
+		}
+	case *ast.MemberExpression:
+		name = n.Property.Value
+	case *ast.Identifier:
+		name = n.Value
+	case *ast.IndexExpression:
+		name = subjectName(n.Left)
+	case *ast.SliceExpression:
+		name = subjectName(n.Left)
+	case *ast.FunctionCall:
+		name = n.Name
+		if len(n.Arguments) > 0 {
+			if arg := subjectName(n.Arguments[0]); arg != "param" {
+				name += strings.ToUpper(arg[:1]) + arg[1:]
+			}
+		}
+	}
+	if name == "" {
+		return "param"
+	}
+	return name
+}
+
+// constantValue returns the value of a number or string literal, a negated
+// number, or a list of these.
+func constantValue(expr ast.Expression) (interface{}, bool) {
+	switch n := expr.(type) {
+	case *ast.IntegerLiteral:
+		return n.Value, true
+	case *ast.FloatLiteral:
+		return n.Value, true
+	case *ast.StringLiteral:
+		return n.Value, true
+	case *ast.GroupedExpression:
+		return constantValue(n.Expression)
+	case *ast.UnaryExpression:
+		if n.Operator != "-" {
+			return nil, false
+		}
+		switch v, _ := constantValue(n.Operand); v := v.(type) {
+		case int64:
+			return -v, true
+		case float64:
+			return -v, true
+		}
+	case *ast.ListLiteral:
+		if len(n.Elements) == 0 {
+			return nil, false
+		}
+		values := make([]interface{}, len(n.Elements))
+		for i, el := range n.Elements {
+			v, ok := constantValue(el)
+			if !ok {
+				return nil, false
+			}
+			if _, nested := v.([]interface{}); nested {
+				return nil, false
+			}
+			values[i] = v
+		}
+		return values, true
+	}
+	return nil, false
+}
@@ -0,0 +1,77 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExternalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   string
+		params map[string]interface{}
+	}{
+		{
+			"thresholds",
+			`$.age >= 18 AND $.age < 65`,
+			`$.age >= minAge && $.age < maxAge`,
+			map[string]interface{}{"minAge": int64(18), "maxAge": int64(65)},
+		},
+		{
+			"constant on the left",
+			`100.5 < $.order.total`,
+			`minTotal < $.order.total`,
+			map[string]interface{}{"minTotal": 100.5},
+		},
+		{
+			"lists",
+			`$.country IN ["DE", "FR"] && $.tier NOT IN ["banned"]`,
+			`$.country IN countryList && $.tier NOT IN tierList`,
+			map[string]interface{}{"countryList": []interface{}{"DE", "FR"}, "tierList": []interface{}{"banned"}},
+		},
+		{
+			"shared and conflicting names",
+			`$.status == "open" || $.status == "open" && $.a.status != "closed"`,
+			`$.status == status || $.status == status && $.a.status != status2`,
+			map[string]interface{}{"status": "open", "status2": "closed"},
+		},
+		{
+			"calls, lambdas, and negative numbers",
+			`len($.name) > 3 && any($.orders, o => o.total > -5)`,
+			`len($.name) > minLenName && any($.orders, o => o.total > minTotal)`,
+			map[string]interface{}{"minLenName": int64(3), "minTotal": int64(-5)},
+		},
+		{
+			"kept constants",
+			`$.active == true && $.email =~ "^a" && round($.x, 2) == $.y && $.z != null && minAge > $.age`,
+			`$.active == true && $.email =~ "^a" && round($.x, 2) == $.y && $.z != null && minAge > $.age`,
+			map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExternalizeSource(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Source)
+			assert.Equal(t, tt.params, got.Params)
+		})
+	}
+
+	t.Run("input unchanged", func(t *testing.T) {
+		expr, err := parser.Parse(`$.age >= 18`)
+		require.NoError(t, err)
+		_, err = Externalize(expr)
+		require.NoError(t, err)
+		assert.Equal(t, "$.age >= 18", Node(expr))
+	})
+
+	t.Run("invalid syntax", func(t *testing.T) {
+		_, err := ExternalizeSource(`$.age >=`)
+		assert.Error(t, err)
+	})
+}
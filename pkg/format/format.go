@@ -0,0 +1,267 @@
+// Package format prints AMEL expressions in canonical form.
+//
+// The canonical form uses symbolic logical operators (&&, ||, !), single spaces
+// around binary operators, and only the parentheses required by operator
+// precedence. Comments are not part of the AST and are not preserved.
+package format
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+// Precedence levels, mirroring the parser
+const (
+	precLowest = iota
+	precLambda
+	precTernary
+	precOr
+	precAnd
+	precNot
+	precEquals
+	precCompare
+	precRegex
+	precIn
+	precSum
+	precProduct
+	precPrefix
+	precCall
+	precIndex
+)
+
+// Source parses a DSL expression and returns it in canonical form.
+func Source(dsl string) (string, error) {
+	expr, err := parser.Parse(dsl)
+	if err != nil {
+		return "", err
+	}
+	return Node(expr), nil
+}
+
+// Node returns the canonical form of an expression.
+func Node(expr ast.Expression) string {
+	var sb strings.Builder
+	write(&sb, expr)
+	return sb.String()
+}
+
+// write prints expr without surrounding parentheses.
+func write(sb *strings.Builder, expr ast.Expression) {
+	switch n := expr.(type) {
+	case nil:
+		return
+	case *ast.IntegerLiteral:
+		if n.Token.Literal != "" {
+			sb.WriteString(n.Token.Literal)
+		} else {
+			sb.WriteString(strconv.FormatInt(n.Value, 10))
+		}
+	case *ast.FloatLiteral:
+		if n.Token.Literal != "" {
+			sb.WriteString(n.Token.Literal)
+		} else {
+			sb.WriteString(strconv.FormatFloat(n.Value, 'g', -1, 64))
+		}
+	case *ast.DurationLiteral:
+		if n.Token.Literal != "" {
+			sb.WriteString(n.Token.Literal)
+		} else {
+			sb.WriteString(n.Value.String())
+		}
+	case *ast.StringLiteral:
+		sb.WriteString(strconv.Quote(n.Value))
+	case *ast.BooleanLiteral:
+		sb.WriteString(strconv.FormatBool(n.Value))
+	case *ast.NullLiteral:
+		sb.WriteString("null")
+	case *ast.Identifier:
+		sb.WriteString(n.Value)
+	case *ast.JSONPathExpression:
+		sb.WriteString(n.Path)
+	case *ast.ListLiteral:
+		sb.WriteString("[")
+		writeList(sb, n.Elements)
+		sb.WriteString("]")
+	case *ast.MapLiteral:
+		sb.WriteString("{")
+		for i, key := range n.Keys {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(strconv.Quote(key))
+			sb.WriteString(": ")
+			write(sb, n.Values[i])
+		}
+		sb.WriteString("}")
+	case *ast.GroupedExpression:
+		write(sb, n.Expression)
+	case *ast.BinaryExpression:
+		prec := precedence(n)
+		writeOperand(sb, n.Left, prec, false)
+		sb.WriteString(" ")
+		sb.WriteString(operator(n.Operator))
+		sb.WriteString(" ")
+		writeOperand(sb, n.Right, prec, true)
+	case *ast.InExpression:
+		writeOperand(sb, n.Left, precIn, false)
+		if n.Negated {
+			sb.WriteString(" NOT IN ")
+		} else {
+			sb.WriteString(" IN ")
+		}
+		writeOperand(sb, n.Right, precIn, true)
+	case *ast.RegexExpression:
+		writeOperand(sb, n.Left, precRegex, false)
+		if n.Negated {
+			sb.WriteString(" !~ ")
+		} else {
+			sb.WriteString(" =~ ")
+		}
+		writeOperand(sb, n.Pattern, precRegex, true)
+	case *ast.UnaryExpression:
+		sb.WriteString(operator(n.Operator))
+		writeOperand(sb, n.Operand, precPrefix, false)
+	case *ast.FunctionCall:
+		sb.WriteString(n.Name)
+		sb.WriteString("(")
+		writeList(sb, n.Arguments)
+		sb.WriteString(")")
+	case *ast.IndexExpression:
+		writeOperand(sb, n.Left, precIndex, false)
+		sb.WriteString("[")
+		write(sb, n.Index)
+		sb.WriteString("]")
+	case *ast.SliceExpression:
+		writeOperand(sb, n.Left, precIndex, false)
+		sb.WriteString("[")
+		if n.Start != nil {
+			write(sb, n.Start)
+		}
+		sb.WriteString(":")
+		if n.End != nil {
+			write(sb, n.End)
+		}
+		sb.WriteString("]")
+	case *ast.MemberExpression:
+		writeOperand(sb, n.Object, precIndex, false)
+		sb.WriteString(".")
+		sb.WriteString(n.Property.Value)
+	case *ast.ConditionalExpression:
+		writeOperand(sb, n.Condition, precTernary, true)
+		sb.WriteString(" ? ")
+		writeOperand(sb, n.Consequence, precTernary, true)
+		sb.WriteString(" : ")
+		writeOperand(sb, n.Alternative, precTernary, false)
+	case *ast.CaseExpression:
+		sb.WriteString("case { ")
+		for i, cond := range n.Conditions {
+			if i > 0 {
+				sb.WriteString("; ")
+			}
+			writeOperand(sb, cond, precLambda, true)
+			sb.WriteString(" => ")
+			write(sb, n.Results[i])
+		}
+		if n.Default != nil {
+			if len(n.Conditions) > 0 {
+				sb.WriteString("; ")
+			}
+			sb.WriteString("else => ")
+			write(sb, n.Default)
+		}
+		sb.WriteString(" }")
+	case *ast.LambdaExpression:
+		if len(n.Parameters) == 1 {
+			sb.WriteString(n.Parameters[0].Value)
+		} else {
+			sb.WriteString("(")
+			for i, p := range n.Parameters {
+				if i > 0 {
+					sb.WriteString(", ")
+				}
+				sb.WriteString(p.Value)
+			}
+			sb.WriteString(")")
+		}
+		sb.WriteString(" => ")
+		writeOperand(sb, n.Body, precLambda, true)
+	default:
+		sb.WriteString(expr.String())
+	}
+}
+
+// writeOperand prints an operand of an operator with precedence prec, adding
+// parentheses when the operand binds more loosely. Operators are left
+// associative, so a right operand of equal precedence is parenthesized too.
+func writeOperand(sb *strings.Builder, expr ast.Expression, prec int, right bool) {
+	p := precedence(expr)
+	if p < prec || (right && p == prec) {
+		sb.WriteString("(")
+		write(sb, expr)
+		sb.WriteString(")")
+		return
+	}
+	write(sb, expr)
+}
+
+// writeList prints comma-separated expressions.
+func writeList(sb *strings.Builder, exprs []ast.Expression) {
+	for i, el := range exprs {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		write(sb, el)
+	}
+}
+
+// precedence returns how tightly an expression binds.
+func precedence(expr ast.Expression) int {
+	switch n := expr.(type) {
+	case *ast.GroupedExpression:
+		return precedence(n.Expression)
+	case *ast.BinaryExpression:
+		switch operator(n.Operator) {
+		case "||":
+			return precOr
+		case "&&":
+			return precAnd
+		case "==", "!=":
+			return precEquals
+		case "<", ">", "<=", ">=":
+			return precCompare
+		case "+", "-":
+			return precSum
+		case "*", "/", "~/", "%":
+			return precProduct
+		}
+		return precLowest
+	case *ast.InExpression:
+		return precIn
+	case *ast.RegexExpression:
+		return precRegex
+	case *ast.UnaryExpression:
+		return precPrefix
+	case *ast.LambdaExpression:
+		return precLambda
+	case *ast.ConditionalExpression:
+		return precTernary
+	default:
+		return precIndex
+	}
+}
+
+// operator returns the canonical spelling of an operator.
+func operator(op string) string {
+	switch strings.ToUpper(op) {
+	case "AND":
+		return "&&"
+	case "OR":
+		return "||"
+	case "NOT":
+		return "!"
+	}
+	return op
+}
@@ -0,0 +1,64 @@
+package format
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keywords maps keyword operators in AST strings to their symbolic spelling
+var keywords = strings.NewReplacer(" AND ", " && ", " or ", " || ", "NOT$", "!$")
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"spacing", "$.age>=18&&$.active==true", "$.age >= 18 && $.active == true"},
+		{"keyword operators", "$.a AND NOT $.b or $.c", "$.a && !$.b || $.c"},
+		{"redundant parentheses", "(($.a + 1)) * 2 > ($.b)", "($.a + 1) * 2 > $.b"},
+		{"required parentheses", "($.a || $.b) && $.c", "($.a || $.b) && $.c"},
+		{"right associativity", "10 - (3 - 2)", "10 - (3 - 2)"},
+		{"left associativity", "(10 - 3) - 2", "10 - 3 - 2"},
+		{"negation", "!($.a && $.b)", "!($.a && $.b)"},
+		{"in list", `$.role  NOT IN ["a","b"]`, `$.role NOT IN ["a", "b"]`},
+		{"regex", `$.email=~"^a.*"`, `$.email =~ "^a.*"`},
+		{"lambda", "map($.items,x=>x*2)", "map($.items, x => x * 2)"},
+		{"multi-param lambda", "reduce($.items, 0, (acc,x)=>acc+x)", "reduce($.items, 0, (acc, x) => acc + x)"},
+		{"string escapes", `"say \"hi\""`, `"say \"hi\""`},
+		{"index", `$.items[0]`, `$.items[0]`},
+		{"slice", `$.code[0:3]+$.code[-2:]+$.items[:i+1]`, `$.code[0:3] + $.code[-2:] + $.items[:i + 1]`},
+		{"conditional", `($.a?1:2)+map($.xs,x=>x>0?x:-x)[($.b?$.c:$.d)?3:4]`, `($.a ? 1 : 2) + map($.xs, x => x > 0 ? x : -x)[($.b ? $.c : $.d) ? 3 : 4]`},
+		{"case", `case{$.tier=="gold"=>0.2;$.a?$.b:$.c=>(0.1);else=>0;}*2`, `case { $.tier == "gold" => 0.2; $.a ? $.b : $.c => 0.1; else => 0 } * 2`},
+		{"integer division", `$.a~/60%24`, `$.a ~/ 60 % 24`},
+		{"map", `{'name':$.name,"total":$.a+1}`, `{"name": $.name, "total": $.a + 1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			// Formatting is idempotent and preserves meaning
+			again, err := Source(got)
+			require.NoError(t, err)
+			assert.Equal(t, got, again)
+
+			original, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+			formatted, err := parser.Parse(got)
+			require.NoError(t, err)
+			assert.Equal(t, keywords.Replace(original.String()), formatted.String())
+		})
+	}
+}
+
+func TestSource_InvalidSyntax(t *testing.T) {
+	_, err := Source("(5 +")
+	assert.Error(t, err)
+}
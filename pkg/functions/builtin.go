@@ -2,10 +2,13 @@
 package functions
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"regexp"
+	"math/big"
+	"sort"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/bencagri/amel/internal/errors"
@@ -34,6 +37,7 @@ func RegisterBuiltIns(r *Registry) error {
 		{"pow", builtinPow, types.NewFunctionSignature("pow", types.TypeFloat, types.Param("base", types.TypeAny), types.Param("exp", types.TypeAny))},
 		{"sqrt", builtinSqrt, types.NewFunctionSignature("sqrt", types.TypeFloat, types.Param("value", types.TypeAny))},
 		{"mod", builtinMod, types.NewFunctionSignature("mod", types.TypeInt, types.Param("a", types.TypeInt), types.Param("b", types.TypeInt))},
+		{"divmod", builtinDivmod, types.NewFunctionSignature("divmod", types.TypeList, types.Param("a", types.TypeAny), types.Param("b", types.TypeAny))},
 
 		// String functions
 		{"len", builtinLen, types.NewFunctionSignature("len", types.TypeInt, types.Param("value", types.TypeAny))},
@@ -46,28 +50,21 @@ func RegisterBuiltIns(r *Registry) error {
 		{"substr", builtinSubstr, types.NewFunctionSignature("substr", types.TypeString, types.Param("str", types.TypeString), types.Param("start", types.TypeInt), types.Param("length", types.TypeInt))},
 		{"replace", builtinReplace, types.NewFunctionSignature("replace", types.TypeString, types.Param("str", types.TypeString), types.Param("old", types.TypeString), types.Param("new", types.TypeString))},
 		{"split", builtinSplit, types.NewFunctionSignature("split", types.TypeList, types.Param("str", types.TypeString), types.Param("sep", types.TypeString))},
-		{"join", builtinJoin, types.NewFunctionSignature("join", types.TypeString, types.Param("list", types.TypeList), types.Param("sep", types.TypeString))},
 		{"concat", builtinConcat, types.NewVariadicSignature("concat", types.TypeString, types.Param("strings", types.TypeString))},
-		{"match", builtinMatch, types.NewFunctionSignature("match", types.TypeBool, types.Param("str", types.TypeString), types.Param("pattern", types.TypeString))},
 
 		// Type conversion functions
 		{"int", builtinInt, types.NewFunctionSignature("int", types.TypeInt, types.Param("value", types.TypeAny))},
 		{"float", builtinFloat, types.NewFunctionSignature("float", types.TypeFloat, types.Param("value", types.TypeAny))},
 		{"string", builtinString, types.NewFunctionSignature("string", types.TypeString, types.Param("value", types.TypeAny))},
-		{"bool", builtinBool, types.NewFunctionSignature("bool", types.TypeBool, types.Param("value", types.TypeAny))},
+		{DecimalFunction, builtinDecimal, types.NewFunctionSignature(DecimalFunction, types.TypeDecimal, types.Param("value", types.TypeAny), types.ParameterDef{Name: "places", Type: types.TypeInt, Optional: true})},
 
 		// List functions
 		{"first", builtinFirst, types.NewFunctionSignature("first", types.TypeAny, types.Param("list", types.TypeList))},
 		{"last", builtinLast, types.NewFunctionSignature("last", types.TypeAny, types.Param("list", types.TypeList))},
-		{"at", builtinAt, types.NewFunctionSignature("at", types.TypeAny, types.Param("list", types.TypeList), types.Param("index", types.TypeInt))},
 		{"reverse", builtinReverse, types.NewFunctionSignature("reverse", types.TypeList, types.Param("list", types.TypeList))},
-		{"unique", builtinUnique, types.NewFunctionSignature("unique", types.TypeList, types.Param("list", types.TypeList))},
-		{"flatten", builtinFlatten, types.NewFunctionSignature("flatten", types.TypeList, types.Param("list", types.TypeList))},
 		{"slice", builtinSlice, types.NewFunctionSignature("slice", types.TypeList, types.Param("list", types.TypeList), types.Param("start", types.TypeInt), types.Param("end", types.TypeInt))},
 
-		// Logical/utility functions
-		{"coalesce", builtinCoalesce, types.NewVariadicSignature("coalesce", types.TypeAny, types.Param("values", types.TypeAny))},
-		{"ifThenElse", builtinIfThenElse, types.NewFunctionSignature("ifThenElse", types.TypeAny, types.Param("condition", types.TypeBool), types.Param("then", types.TypeAny), types.Param("else", types.TypeAny))},
+		// Utility functions
 		{"isNull", builtinIsNull, types.NewFunctionSignature("isNull", types.TypeBool, types.Param("value", types.TypeAny))},
 		{"isNotNull", builtinIsNotNull, types.NewFunctionSignature("isNotNull", types.TypeBool, types.Param("value", types.TypeAny))},
 		{"isEmpty", builtinIsEmpty, types.NewFunctionSignature("isEmpty", types.TypeBool, types.Param("value", types.TypeAny))},
@@ -75,17 +72,13 @@ func RegisterBuiltIns(r *Registry) error {
 
 		// Additional list functions
 		{"indexOf", builtinIndexOf, types.NewFunctionSignature("indexOf", types.TypeInt, types.Param("list", types.TypeList), types.Param("value", types.TypeAny))},
-		{"sortAsc", builtinSortAsc, types.NewFunctionSignature("sortAsc", types.TypeList, types.Param("list", types.TypeList))},
-		{"sortDesc", builtinSortDesc, types.NewFunctionSignature("sortDesc", types.TypeList, types.Param("list", types.TypeList))},
-		{"all", builtinAll, types.NewFunctionSignature("all", types.TypeBool, types.Param("list", types.TypeList))},
-		{"any", builtinAny, types.NewFunctionSignature("any", types.TypeBool, types.Param("list", types.TypeList))},
 
 		// Additional numeric functions
 		{"clamp", builtinClamp, types.NewFunctionSignature("clamp", types.TypeAny, types.Param("value", types.TypeAny), types.Param("min", types.TypeAny), types.Param("max", types.TypeAny))},
 		{"between", builtinBetween, types.NewFunctionSignature("between", types.TypeBool, types.Param("value", types.TypeAny), types.Param("min", types.TypeAny), types.Param("max", types.TypeAny))},
+		{"rolloutBucket", builtinRolloutBucket, types.NewFunctionSignature("rolloutBucket", types.TypeBool, types.Param("key", types.TypeAny), types.Param("percentage", types.TypeFloat), types.ParameterDef{Name: "salt", Type: types.TypeString, Optional: true})},
 
 		// Additional utility functions
-		{"defaultVal", builtinDefaultVal, types.NewFunctionSignature("defaultVal", types.TypeAny, types.Param("value", types.TypeAny), types.Param("default", types.TypeAny))},
 		{"format", builtinFormat, types.NewVariadicSignature("format", types.TypeString, types.Param("template", types.TypeString), types.Param("args", types.TypeAny))},
 
 		// Additional string functions
@@ -94,15 +87,98 @@ func RegisterBuiltIns(r *Registry) error {
 		{"padLeft", builtinPadLeft, types.NewFunctionSignature("padLeft", types.TypeString, types.Param("str", types.TypeString), types.Param("length", types.TypeInt), types.Param("pad", types.TypeString))},
 		{"padRight", builtinPadRight, types.NewFunctionSignature("padRight", types.TypeString, types.Param("str", types.TypeString), types.Param("length", types.TypeInt), types.Param("pad", types.TypeString))},
 		{"repeat", builtinRepeat, types.NewFunctionSignature("repeat", types.TypeString, types.Param("str", types.TypeString), types.Param("count", types.TypeInt))},
-	}
 
+		// Masking functions
+		{"maskEmail", builtinMaskEmail, types.NewFunctionSignature("maskEmail", types.TypeString, types.Param("str", types.TypeAny))},
+		{"maskPan", builtinMaskPan, types.NewFunctionSignature("maskPan", types.TypeString, types.Param("str", types.TypeAny))},
+
+		// Date/time functions
+		{"parseDate", builtinParseDate, types.NewFunctionSignature("parseDate", types.TypeDateTime, types.Param("str", types.TypeString), types.ParameterDef{Name: "layout", Type: types.TypeString, Optional: true})},
+		{"formatDate", builtinFormatDate, types.NewFunctionSignature("formatDate", types.TypeString, types.Param("date", types.TypeDateTime), types.ParameterDef{Name: "layout", Type: types.TypeString, Optional: true})},
+		{"dateAdd", builtinDateAdd, types.NewFunctionSignature("dateAdd", types.TypeDateTime, types.Param("date", types.TypeDateTime), types.Param("amount", types.TypeInt), types.Param("unit", types.TypeString))},
+		{"dateDiff", builtinDateDiff, types.NewFunctionSignature("dateDiff", types.TypeInt, types.Param("from", types.TypeDateTime), types.Param("to", types.TypeDateTime), types.Param("unit", types.TypeString))},
+		{"dayOfWeek", builtinDayOfWeek, types.NewFunctionSignature("dayOfWeek", types.TypeInt, types.Param("date", types.TypeDateTime))},
+		{"isBefore", builtinIsBefore, types.NewFunctionSignature("isBefore", types.TypeBool, types.Param("date", types.TypeDateTime), types.Param("other", types.TypeDateTime))},
+		{"isAfter", builtinIsAfter, types.NewFunctionSignature("isAfter", types.TypeBool, types.Param("date", types.TypeDateTime), types.Param("other", types.TypeDateTime))},
+		{"duration", builtinDuration, types.NewFunctionSignature("duration", types.TypeDuration, types.Param("str", types.TypeString))},
+		{"seconds", builtinSeconds, types.NewFunctionSignature("seconds", types.TypeFloat, types.Param("duration", types.TypeDuration))},
+		{"minutes", builtinMinutes, types.NewFunctionSignature("minutes", types.TypeFloat, types.Param("duration", types.TypeDuration))},
+		{"hours", builtinHours, types.NewFunctionSignature("hours", types.TypeFloat, types.Param("duration", types.TypeDuration))},
+		{"parseDurationStr", builtinParseDurationStr, types.NewFunctionSignature("parseDurationStr", types.TypeDuration, types.Param("str", types.TypeString))},
+
+		// Data size functions
+		{"parseBytes", builtinParseBytes, types.NewFunctionSignature("parseBytes", types.TypeInt, types.Param("str", types.TypeString))},
+		{"formatBytes", builtinFormatBytes, types.NewFunctionSignature("formatBytes", types.TypeString, types.Param("bytes", types.TypeInt))},
+	}
+
+	fns := make([]*Function, 0, len(builtins)+10)
 	for _, b := range builtins {
-		if err := r.RegisterBuiltIn(b.name, b.fn, b.sig); err != nil {
-			return err
+		if doc, ok := builtinDocs[b.name]; ok {
+			doc.document(b.sig)
 		}
+		fns = append(fns, &Function{Name: b.name, Signature: b.sig, BuiltIn: b.fn, Pure: true})
 	}
 
-	return nil
+	// The result of now changes between calls
+	nowSig := types.NewFunctionSignature("now", types.TypeDateTime)
+	builtinDocs["now"].document(nowSig)
+	fns = append(fns, &Function{Name: "now", Signature: nowSig, BuiltIn: builtinNow})
+
+	// Functions that walk whole lists or values, match regexes, test values
+	// for truth, or index lists, using the evaluation context to stop on timeout, to
+	// compile patterns, and for the truthiness and safe index rules
+	cancelable := []struct {
+		name string
+		fn   CancelableFunc
+		sig  *types.FunctionSignature
+	}{
+		{"join", builtinJoin, types.NewFunctionSignature("join", types.TypeString, types.Param("list", types.TypeList), types.Param("sep", types.TypeString))},
+		{"unique", builtinUnique, types.NewFunctionSignature("unique", types.TypeList, types.Param("list", types.TypeList))},
+		{"flatten", builtinFlatten, types.NewFunctionSignature("flatten", types.TypeList, types.Param("list", types.TypeList))},
+		{"sortAsc", builtinSortAsc, types.NewFunctionSignature("sortAsc", types.TypeList, types.Param("list", types.TypeList))},
+		{"sortDesc", builtinSortDesc, types.NewFunctionSignature("sortDesc", types.TypeList, types.Param("list", types.TypeList))},
+		{"bool", builtinBool, types.NewFunctionSignature("bool", types.TypeBool, types.Param("value", types.TypeAny))},
+		{"all", builtinAll, types.NewFunctionSignature("all", types.TypeBool, types.Param("list", types.TypeList))},
+		{"any", builtinAny, types.NewFunctionSignature("any", types.TypeBool, types.Param("list", types.TypeList))},
+		{"match", builtinMatch, types.NewFunctionSignature("match", types.TypeBool, types.Param("str", types.TypeString), types.Param("pattern", types.TypeString))},
+		{"redact", builtinRedact, types.NewFunctionSignature("redact", types.TypeString, types.Param("str", types.TypeAny), types.Param("pattern", types.TypeString), types.ParameterDef{Name: "replacement", Type: types.TypeString, Optional: true})},
+		{"at", builtinAt, types.NewFunctionSignature("at", types.TypeAny, types.Param("list", types.TypeList), types.Param("index", types.TypeInt))},
+		{"deepEquals", builtinDeepEquals, types.NewFunctionSignature("deepEquals", types.TypeBool, types.Param("a", types.TypeAny), types.Param("b", types.TypeAny))},
+		{"diff", builtinDiff, types.NewFunctionSignature("diff", types.TypeList, types.Param("a", types.TypeAny), types.Param("b", types.TypeAny))},
+	}
+
+	for _, b := range cancelable {
+		if doc, ok := builtinDocs[b.name]; ok {
+			doc.document(b.sig)
+		}
+		fns = append(fns, &Function{Name: b.name, Signature: b.sig, Cancelable: b.fn, Pure: true})
+	}
+
+	// Functions that only evaluate the arguments they need
+	lazy := []struct {
+		name string
+		fn   LazyFunc
+		sig  *types.FunctionSignature
+	}{
+		{"coalesce", builtinCoalesce, types.NewVariadicSignature("coalesce", types.TypeAny, types.Param("values", types.TypeAny))},
+		{"ifThenElse", builtinIfThenElse, types.NewFunctionSignature("ifThenElse", types.TypeAny, types.Param("condition", types.TypeBool), types.Param("then", types.TypeAny), types.Param("else", types.TypeAny))},
+		{"defaultVal", builtinDefaultVal, types.NewFunctionSignature("defaultVal", types.TypeAny, types.Param("value", types.TypeAny), types.Param("default", types.TypeAny))},
+		{"tryCatch", builtinTryCatch, types.NewFunctionSignature("tryCatch", types.TypeAny, types.Param("expr", types.TypeAny), types.Param("fallback", types.TypeAny))},
+		{ScoreFunction, builtinScore, types.NewFunctionSignature(ScoreFunction, types.TypeFloat, types.Param("pairs", types.TypeList))},
+	}
+
+	for _, b := range lazy {
+		if doc, ok := builtinDocs[b.name]; ok {
+			doc.document(b.sig)
+		}
+		fns = append(fns, &Function{Name: b.name, Signature: b.sig, Lazy: b.fn, Pure: true})
+	}
+
+	fns = append(fns, countryFunctions(defaultCountries)...)
+	fns = append(fns, jwtFunctions()...)
+
+	// Registered in one step, so the registry is copied once
+	return r.RegisterAll(fns...)
 }
 
 // NewDefaultRegistry creates a registry with all built-in functions pre-registered.
@@ -138,9 +214,12 @@ func builtinCount(args ...types.Value) (types.Value, error) {
 	return types.Int(int64(len(args))), nil
 }
 
-// builtinSum returns the sum of numeric values.
+// builtinSum returns the sum of numeric values, exact if any is a decimal.
 func builtinSum(args ...types.Value) (types.Value, error) {
 	values := flattenToValues(args)
+	if hasDecimal(values) {
+		return sumDecimals(values), nil
+	}
 
 	var sum float64
 	for _, v := range values {
@@ -252,6 +331,9 @@ func builtinAbs(args ...types.Value) (types.Value, error) {
 		return types.Null(), nil
 	}
 
+	if r, ok := args[0].AsDecimal(); ok && args[0].Type == types.TypeDecimal {
+		return types.Decimal(new(big.Rat).Abs(r)), nil
+	}
 	f, ok := args[0].AsFloat()
 	if !ok {
 		return types.Null(), errors.New(errors.ErrTypeMismatch, "abs requires a numeric value")
@@ -362,11 +444,45 @@ func builtinMod(args ...types.Value) (types.Value, error) {
 	return types.Int(a % b), nil
 }
 
+// builtinDivmod returns [a ~/ b, a % b]: the quotient truncated toward zero
+// and the remainder, which has the sign of a. Both are ints for two ints;
+// otherwise the remainder is a float.
+func builtinDivmod(args ...types.Value) (types.Value, error) {
+	if !args[0].Type.IsNumeric() || !args[1].Type.IsNumeric() {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch,
+			"divmod requires numbers, got %s and %s", args[0].Type, args[1].Type)
+	}
+
+	if args[0].Type == types.TypeInt && args[1].Type == types.TypeInt {
+		a, _ := args[0].AsInt()
+		b, _ := args[1].AsInt()
+		if b == 0 {
+			return types.Null(), errors.New(errors.ErrDivisionByZero, "division by zero")
+		}
+		if a == math.MinInt64 && b == -1 {
+			return types.Null(), errors.Newf(errors.ErrTypeMismatch, "divmod: the quotient of %v and %v is out of the range of an int", a, b)
+		}
+		return types.List(types.Int(a/b), types.Int(a%b)), nil
+	}
+
+	a, _ := args[0].AsFloat()
+	b, _ := args[1].AsFloat()
+	if b == 0 {
+		return types.Null(), errors.New(errors.ErrDivisionByZero, "division by zero")
+	}
+	q := math.Trunc(a / b)
+	if math.IsNaN(q) || q < math.MinInt64 || q >= math.MaxInt64 {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "divmod: the quotient of %v and %v is out of the range of an int", a, b)
+	}
+	return types.List(types.Int(int64(q)), types.Float(math.Mod(a, b))), nil
+}
+
 // ============================================================================
 // String Functions
 // ============================================================================
 
-// builtinLen returns the length of a string (in runes/characters) or list.
+// builtinLen returns the length of a string (in runes/characters), list, or
+// map.
 func builtinLen(args ...types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.Int(0), nil
@@ -380,6 +496,9 @@ func builtinLen(args ...types.Value) (types.Value, error) {
 	case types.TypeList:
 		list, _ := args[0].AsList()
 		return types.Int(int64(len(list))), nil
+	case types.TypeMap:
+		m, _ := args[0].AsMap()
+		return types.Int(int64(len(m))), nil
 	default:
 		return types.Int(0), nil
 	}
@@ -582,7 +701,7 @@ func builtinSplit(args ...types.Value) (types.Value, error) {
 }
 
 // builtinJoin joins a list of strings with a separator.
-func builtinJoin(args ...types.Value) (types.Value, error) {
+func builtinJoin(ctx context.Context, args ...types.Value) (types.Value, error) {
 	if len(args) < 2 {
 		return types.Null(), errors.New(errors.ErrArgumentCount, "join requires 2 arguments")
 	}
@@ -598,7 +717,10 @@ func builtinJoin(args ...types.Value) (types.Value, error) {
 	}
 
 	strs := make([]string, 0, len(list))
-	for _, v := range list {
+	for i, v := range list {
+		if err := canceledAt(ctx, i); err != nil {
+			return types.Null(), err
+		}
 		if s, ok := v.AsString(); ok {
 			strs = append(strs, s)
 		} else {
@@ -622,8 +744,9 @@ func builtinConcat(args ...types.Value) (types.Value, error) {
 	return types.String(sb.String()), nil
 }
 
-// builtinMatch checks if a string matches a regular expression.
-func builtinMatch(args ...types.Value) (types.Value, error) {
+// builtinMatch checks if a string matches a regular expression. The pattern
+// is compiled with the regex cache of ctx, if any.
+func builtinMatch(ctx context.Context, args ...types.Value) (types.Value, error) {
 	if len(args) < 2 {
 		return types.Bool(false), nil
 	}
@@ -638,9 +761,9 @@ func builtinMatch(args ...types.Value) (types.Value, error) {
 		return types.Null(), errors.New(errors.ErrTypeMismatch, "match pattern requires a string")
 	}
 
-	re, err := regexp.Compile(pattern)
+	re, err := compileRegex(ctx, pattern)
 	if err != nil {
-		return types.Null(), errors.Wrap(errors.ErrInvalidSyntax, "invalid regex pattern", err)
+		return types.Null(), err
 	}
 
 	return types.Bool(re.MatchString(str)), nil
@@ -662,6 +785,13 @@ func builtinInt(args ...types.Value) (types.Value, error) {
 	case types.TypeFloat:
 		f, _ := args[0].AsFloat()
 		return types.Int(int64(f)), nil
+	case types.TypeDecimal:
+		r, _ := args[0].AsDecimal()
+		n := new(big.Int).Quo(r.Num(), r.Denom())
+		if !n.IsInt64() {
+			return types.Null(), errors.Newf(errors.ErrTypeMismatch, "%v is out of the range of an int", args[0].Raw)
+		}
+		return types.Int(n.Int64()), nil
 	case types.TypeString:
 		s, _ := args[0].AsString()
 		var i int64
@@ -693,6 +823,9 @@ func builtinFloat(args ...types.Value) (types.Value, error) {
 		return types.Float(float64(i)), nil
 	case types.TypeFloat:
 		return args[0], nil
+	case types.TypeDecimal:
+		f, _ := args[0].AsFloat()
+		return types.Float(f), nil
 	case types.TypeString:
 		s, _ := args[0].AsString()
 		var f float64
@@ -723,18 +856,20 @@ func builtinString(args ...types.Value) (types.Value, error) {
 		return args[0], nil
 	case types.TypeNull:
 		return types.String("null"), nil
+	case types.TypeDateTime:
+		return types.String(args[0].Raw.(time.Time).Format(time.RFC3339Nano)), nil
 	default:
 		return types.String(fmt.Sprintf("%v", args[0].Raw)), nil
 	}
 }
 
 // builtinBool converts a value to a boolean.
-func builtinBool(args ...types.Value) (types.Value, error) {
+func builtinBool(ctx context.Context, args ...types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.Bool(false), nil
 	}
 
-	return types.Bool(args[0].IsTruthy()), nil
+	return types.Bool(isTruthy(ctx, args[0])), nil
 }
 
 // ============================================================================
@@ -769,8 +904,9 @@ func builtinLast(args ...types.Value) (types.Value, error) {
 	return list[len(list)-1], nil
 }
 
-// builtinAt returns the element at a specific index.
-func builtinAt(args ...types.Value) (types.Value, error) {
+// builtinAt returns the element at a specific index. Out of range, it fails,
+// or with a safe index context gives null.
+func builtinAt(ctx context.Context, args ...types.Value) (types.Value, error) {
 	if len(args) < 2 {
 		return types.Null(), errors.New(errors.ErrArgumentCount, "at requires 2 arguments")
 	}
@@ -791,6 +927,9 @@ func builtinAt(args ...types.Value) (types.Value, error) {
 	}
 
 	if idx < 0 || idx >= int64(len(list)) {
+		if safeIndex(ctx) {
+			return types.Null(), nil
+		}
 		return types.Null(), errors.New(errors.ErrIndexOutOfBounds, "index out of bounds")
 	}
 
@@ -817,7 +956,7 @@ func builtinReverse(args ...types.Value) (types.Value, error) {
 }
 
 // builtinUnique returns unique elements from a list.
-func builtinUnique(args ...types.Value) (types.Value, error) {
+func builtinUnique(ctx context.Context, args ...types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.List(), nil
 	}
@@ -830,7 +969,10 @@ func builtinUnique(args ...types.Value) (types.Value, error) {
 	var result []types.Value
 	seen := make(map[string]bool)
 
-	for _, v := range list {
+	for i, v := range list {
+		if err := canceledAt(ctx, i); err != nil {
+			return types.Null(), err
+		}
 		key := fmt.Sprintf("%v:%v", v.Type, v.Raw)
 		if !seen[key] {
 			seen[key] = true
@@ -842,7 +984,7 @@ func builtinUnique(args ...types.Value) (types.Value, error) {
 }
 
 // builtinFlatten flattens nested lists.
-func builtinFlatten(args ...types.Value) (types.Value, error) {
+func builtinFlatten(ctx context.Context, args ...types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.List(), nil
 	}
@@ -853,19 +995,31 @@ func builtinFlatten(args ...types.Value) (types.Value, error) {
 	}
 
 	var result []types.Value
-	flattenRecursive(list, &result)
+	visited := 0
+	if err := flattenRecursive(ctx, list, &result, &visited); err != nil {
+		return types.Null(), err
+	}
 
 	return types.List(result...), nil
 }
 
-func flattenRecursive(list []types.Value, result *[]types.Value) {
+// flattenRecursive appends the elements of list and its nested lists to
+// result. visited counts the elements seen so far, across nesting levels.
+func flattenRecursive(ctx context.Context, list []types.Value, result *[]types.Value, visited *int) error {
 	for _, v := range list {
+		if err := canceledAt(ctx, *visited); err != nil {
+			return err
+		}
+		*visited++
 		if nested, ok := v.AsList(); ok {
-			flattenRecursive(nested, result)
+			if err := flattenRecursive(ctx, nested, result, visited); err != nil {
+				return err
+			}
 		} else {
 			*result = append(*result, v)
 		}
 	}
+	return nil
 }
 
 // builtinSlice returns a slice of a list.
@@ -917,31 +1071,41 @@ func builtinSlice(args ...types.Value) (types.Value, error) {
 // Logical/Utility Functions
 // ============================================================================
 
-// builtinCoalesce returns the first non-null value.
-func builtinCoalesce(args ...types.Value) (types.Value, error) {
+// builtinCoalesce returns the first non-null value. Arguments after it are
+// not evaluated.
+func builtinCoalesce(args ...Thunk) (types.Value, error) {
 	for _, arg := range args {
-		if !arg.IsNull() {
-			return arg, nil
+		val, err := arg()
+		if err != nil {
+			return types.Null(), err
+		}
+		if !val.IsNull() {
+			return val, nil
 		}
 	}
 	return types.Null(), nil
 }
 
-// builtinIfThenElse returns then if condition is true, else otherwise.
-func builtinIfThenElse(args ...types.Value) (types.Value, error) {
+// builtinIfThenElse returns then if condition is true, else otherwise. Only
+// the selected branch is evaluated.
+func builtinIfThenElse(args ...Thunk) (types.Value, error) {
 	if len(args) < 3 {
 		return types.Null(), errors.New(errors.ErrArgumentCount, "ifThenElse requires 3 arguments")
 	}
 
-	condition, ok := args[0].AsBool()
+	cond, err := args[0]()
+	if err != nil {
+		return types.Null(), err
+	}
+	condition, ok := cond.AsBool()
 	if !ok {
-		condition = args[0].IsTruthy()
+		condition = cond.IsTruthy()
 	}
 
 	if condition {
-		return args[1], nil
+		return args[1]()
 	}
-	return args[2], nil
+	return args[2]()
 }
 
 // builtinIsNull checks if a value is null.
@@ -960,7 +1124,8 @@ func builtinIsNotNull(args ...types.Value) (types.Value, error) {
 	return types.Bool(!args[0].IsNull()), nil
 }
 
-// builtinIsEmpty checks if a value is empty (null, empty string, or empty list).
+// builtinIsEmpty checks if a value is empty (null, empty string, empty list, or
+// empty map).
 func builtinIsEmpty(args ...types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.Bool(true), nil
@@ -978,6 +1143,9 @@ func builtinIsEmpty(args ...types.Value) (types.Value, error) {
 	case types.TypeList:
 		list, _ := v.AsList()
 		return types.Bool(len(list) == 0), nil
+	case types.TypeMap:
+		m, _ := v.AsMap()
+		return types.Bool(len(m) == 0), nil
 	default:
 		return types.Bool(false), nil
 	}
@@ -1032,35 +1200,21 @@ func builtinIndexOf(args ...types.Value) (types.Value, error) {
 }
 
 // builtinSortAsc sorts a list in ascending order.
-func builtinSortAsc(args ...types.Value) (types.Value, error) {
-	if len(args) == 0 {
-		return types.List(), nil
-	}
-
-	list, ok := args[0].AsList()
-	if !ok {
-		return types.List(), nil
-	}
-
-	// Create a copy to avoid modifying the original
-	sorted := make([]types.Value, len(list))
-	copy(sorted, list)
-
-	// Simple bubble sort (can be optimized for production)
-	for i := 0; i < len(sorted)-1; i++ {
-		for j := 0; j < len(sorted)-i-1; j++ {
-			cmp, ok := sorted[j].Compare(sorted[j+1])
-			if ok && cmp > 0 {
-				sorted[j], sorted[j+1] = sorted[j+1], sorted[j]
-			}
-		}
-	}
-
-	return types.List(sorted...), nil
+func builtinSortAsc(ctx context.Context, args ...types.Value) (types.Value, error) {
+	return sortList(ctx, args, 1)
 }
 
 // builtinSortDesc sorts a list in descending order.
-func builtinSortDesc(args ...types.Value) (types.Value, error) {
+func builtinSortDesc(ctx context.Context, args ...types.Value) (types.Value, error) {
+	return sortList(ctx, args, -1)
+}
+
+// sortList returns a sorted copy of the list in args[0]. direction is 1 for
+// ascending and -1 for descending order. The sort is stable, and elements
+// that cannot be compared, such as a string and a number, are kept in their
+// original relative order. Once ctx is done, the remaining comparisons are
+// skipped and the sort fails.
+func sortList(ctx context.Context, args []types.Value, direction int) (types.Value, error) {
 	if len(args) == 0 {
 		return types.List(), nil
 	}
@@ -1074,32 +1228,42 @@ func builtinSortDesc(args ...types.Value) (types.Value, error) {
 	sorted := make([]types.Value, len(list))
 	copy(sorted, list)
 
-	// Simple bubble sort (can be optimized for production)
-	for i := 0; i < len(sorted)-1; i++ {
-		for j := 0; j < len(sorted)-i-1; j++ {
-			cmp, ok := sorted[j].Compare(sorted[j+1])
-			if ok && cmp < 0 {
-				sorted[j], sorted[j+1] = sorted[j+1], sorted[j]
-			}
+	var err error
+	comparisons := 0
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		if err = canceledAt(ctx, comparisons); err != nil {
+			return false
 		}
+		comparisons++
+		cmp, ok := sorted[i].Compare(sorted[j])
+		return ok && cmp*direction < 0
+	})
+	if err != nil {
+		return types.Null(), err
 	}
 
 	return types.List(sorted...), nil
 }
 
 // builtinAll returns true if all elements in the list are truthy.
-func builtinAll(args ...types.Value) (types.Value, error) {
+func builtinAll(ctx context.Context, args ...types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.Bool(true), nil
 	}
 
 	list, ok := args[0].AsList()
 	if !ok {
-		return types.Bool(args[0].IsTruthy()), nil
+		return types.Bool(isTruthy(ctx, args[0])), nil
 	}
 
-	for _, elem := range list {
-		if !elem.IsTruthy() {
+	for i, elem := range list {
+		if err := canceledAt(ctx, i); err != nil {
+			return types.Null(), err
+		}
+		if !isTruthy(ctx, elem) {
 			return types.Bool(false), nil
 		}
 	}
@@ -1107,18 +1271,21 @@ func builtinAll(args ...types.Value) (types.Value, error) {
 }
 
 // builtinAny returns true if any element in the list is truthy.
-func builtinAny(args ...types.Value) (types.Value, error) {
+func builtinAny(ctx context.Context, args ...types.Value) (types.Value, error) {
 	if len(args) == 0 {
 		return types.Bool(false), nil
 	}
 
 	list, ok := args[0].AsList()
 	if !ok {
-		return types.Bool(args[0].IsTruthy()), nil
+		return types.Bool(isTruthy(ctx, args[0])), nil
 	}
 
-	for _, elem := range list {
-		if elem.IsTruthy() {
+	for i, elem := range list {
+		if err := canceledAt(ctx, i); err != nil {
+			return types.Null(), err
+		}
+		if isTruthy(ctx, elem) {
 			return types.Bool(true), nil
 		}
 	}
@@ -1178,16 +1345,43 @@ func builtinBetween(args ...types.Value) (types.Value, error) {
 // Additional Utility Functions
 // ============================================================================
 
-// builtinDefaultVal returns the value if not null, otherwise returns the default.
-func builtinDefaultVal(args ...types.Value) (types.Value, error) {
+// builtinDefaultVal returns the value if not null, otherwise returns the
+// default. The default is only evaluated if the value is null.
+func builtinDefaultVal(args ...Thunk) (types.Value, error) {
 	if len(args) < 2 {
 		return types.Null(), nil
 	}
 
-	if args[0].IsNull() {
-		return args[1], nil
+	val, err := args[0]()
+	if err != nil {
+		return types.Null(), err
+	}
+	if val.IsNull() {
+		return args[1]()
+	}
+	return val, nil
+}
+
+// builtinTryCatch returns the value of expr, or the value of fallback if
+// evaluating expr fails. The fallback is only evaluated on failure. Timeouts,
+// iteration limits, call budgets, depth limits, and denied functions and
+// regexes are not caught: they stop the whole evaluation.
+func builtinTryCatch(args ...Thunk) (types.Value, error) {
+	if len(args) < 2 {
+		return types.Null(), errors.New(errors.ErrArgumentCount, "tryCatch requires 2 arguments")
+	}
+
+	val, err := args[0]()
+	if err == nil {
+		return val, nil
+	}
+	if errors.IsCode(err, errors.ErrTimeout) || errors.IsCode(err, errors.ErrIterationLimit) ||
+		errors.IsCode(err, errors.ErrFunctionDenied) || errors.IsCode(err, errors.ErrCallBudget) ||
+		errors.IsCode(err, errors.ErrMemoryLimit) || errors.IsCode(err, errors.ErrDepthLimit) ||
+		errors.IsCode(err, errors.ErrRegexDenied) {
+		return types.Null(), err
 	}
-	return args[0], nil
+	return args[1]()
 }
 
 // builtinFormat formats a string with placeholders.
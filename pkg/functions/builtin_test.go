@@ -2,9 +2,11 @@
 package functions
 
 import (
+	"context"
 	"math"
 	"testing"
 
+	"github.com/bencagri/amel/internal/errors"
 	"github.com/bencagri/amel/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -41,7 +43,7 @@ func TestBuiltinIndexOf(t *testing.T) {
 func TestBuiltinSortAsc(t *testing.T) {
 	t.Run("sort integers ascending", func(t *testing.T) {
 		list := types.List(types.Int(3), types.Int(1), types.Int(4), types.Int(1), types.Int(5))
-		result, err := builtinSortAsc(list)
+		result, err := builtinSortAsc(context.Background(), list)
 		require.NoError(t, err)
 
 		sorted, ok := result.AsList()
@@ -56,7 +58,7 @@ func TestBuiltinSortAsc(t *testing.T) {
 
 	t.Run("sort strings ascending", func(t *testing.T) {
 		list := types.List(types.String("banana"), types.String("apple"), types.String("cherry"))
-		result, err := builtinSortAsc(list)
+		result, err := builtinSortAsc(context.Background(), list)
 		require.NoError(t, err)
 
 		sorted, ok := result.AsList()
@@ -67,18 +69,40 @@ func TestBuiltinSortAsc(t *testing.T) {
 	})
 
 	t.Run("empty list", func(t *testing.T) {
-		result, err := builtinSortAsc(types.List())
+		result, err := builtinSortAsc(context.Background(), types.List())
 		require.NoError(t, err)
 		sorted, ok := result.AsList()
 		require.True(t, ok)
 		assert.Len(t, sorted, 0)
 	})
+
+	t.Run("large list", func(t *testing.T) {
+		values := make([]types.Value, 10000)
+		for i := range values {
+			values[i] = types.Int(int64((i * 7919) % 10000))
+		}
+		result, err := builtinSortAsc(context.Background(), types.List(values...))
+		require.NoError(t, err)
+		sorted, _ := result.AsList()
+		for i, v := range sorted {
+			assert.Equal(t, int64(i), v.Raw)
+		}
+		assert.Equal(t, int64(0), values[0].Raw, "the input is not modified")
+		assert.Equal(t, int64(7919), values[1].Raw, "the input is not modified")
+	})
+
+	t.Run("mixed numbers", func(t *testing.T) {
+		result, err := builtinSortAsc(context.Background(), types.List(types.Float(2.5), types.Int(1), types.Int(3)))
+		require.NoError(t, err)
+		sorted, _ := result.AsList()
+		assert.Equal(t, []interface{}{int64(1), 2.5, int64(3)}, []interface{}{sorted[0].Raw, sorted[1].Raw, sorted[2].Raw})
+	})
 }
 
 func TestBuiltinSortDesc(t *testing.T) {
 	t.Run("sort integers descending", func(t *testing.T) {
 		list := types.List(types.Int(3), types.Int(1), types.Int(4), types.Int(1), types.Int(5))
-		result, err := builtinSortDesc(list)
+		result, err := builtinSortDesc(context.Background(), list)
 		require.NoError(t, err)
 
 		sorted, ok := result.AsList()
@@ -108,7 +132,7 @@ func TestBuiltinAll(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := builtinAll(tt.list)
+			result, err := builtinAll(context.Background(), tt.list)
 			require.NoError(t, err)
 			assert.Equal(t, tt.expected, result.Raw)
 		})
@@ -131,7 +155,7 @@ func TestBuiltinAny(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := builtinAny(tt.list)
+			result, err := builtinAny(context.Background(), tt.list)
 			require.NoError(t, err)
 			assert.Equal(t, tt.expected, result.Raw)
 		})
@@ -199,22 +223,28 @@ func TestBuiltinBetween(t *testing.T) {
 
 func TestBuiltinDefaultVal(t *testing.T) {
 	t.Run("non-null value", func(t *testing.T) {
-		result, err := builtinDefaultVal(types.Int(42), types.Int(0))
+		result, err := builtinDefaultVal(thunks(types.Int(42), types.Int(0))...)
 		require.NoError(t, err)
 		assert.Equal(t, int64(42), result.Raw)
 	})
 
 	t.Run("null value returns default", func(t *testing.T) {
-		result, err := builtinDefaultVal(types.Null(), types.Int(99))
+		result, err := builtinDefaultVal(thunks(types.Null(), types.Int(99))...)
 		require.NoError(t, err)
 		assert.Equal(t, int64(99), result.Raw)
 	})
 
 	t.Run("string default", func(t *testing.T) {
-		result, err := builtinDefaultVal(types.Null(), types.String("default"))
+		result, err := builtinDefaultVal(thunks(types.Null(), types.String("default"))...)
 		require.NoError(t, err)
 		assert.Equal(t, "default", result.Raw)
 	})
+
+	t.Run("default not evaluated", func(t *testing.T) {
+		result, err := builtinDefaultVal(Value(types.Int(42)), failing(t))
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), result.Raw)
+	})
 }
 
 func TestBuiltinFormat(t *testing.T) {
@@ -363,7 +393,7 @@ func TestNewDefaultRegistry(t *testing.T) {
 		// Aggregate
 		"count", "sum", "avg", "min", "max",
 		// Math
-		"abs", "ceil", "floor", "round", "pow", "sqrt", "mod",
+		"abs", "ceil", "floor", "round", "pow", "sqrt", "mod", "divmod",
 		// String
 		"len", "lower", "upper", "trim", "contains", "startsWith", "endsWith",
 		"substr", "replace", "split", "join", "concat", "match",
@@ -775,6 +805,35 @@ func TestBuiltinMod(t *testing.T) {
 	}
 }
 
+func TestBuiltinDivmod(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        types.Value
+		b        types.Value
+		expected types.Value
+		hasError bool
+	}{
+		{"ints", types.Int(17), types.Int(5), types.List(types.Int(3), types.Int(2)), false},
+		{"negative dividend", types.Int(-7), types.Int(2), types.List(types.Int(-3), types.Int(-1)), false},
+		{"floats", types.Float(7.5), types.Int(2), types.List(types.Int(3), types.Float(1.5)), false},
+		{"div by zero", types.Float(5), types.Float(0), types.Null(), true},
+		{"int overflow", types.Int(math.MinInt64), types.Int(-1), types.Null(), true},
+		{"not a number", types.String("5"), types.Int(2), types.Null(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := builtinDivmod(tt.a, tt.b)
+			if tt.hasError {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+			}
+		})
+	}
+}
+
 // ============================================================================
 // String Function Tests
 // ============================================================================
@@ -1013,7 +1072,7 @@ func TestBuiltinSplit(t *testing.T) {
 func TestBuiltinJoin(t *testing.T) {
 	t.Run("basic join", func(t *testing.T) {
 		list := types.List(types.String("a"), types.String("b"), types.String("c"))
-		result, err := builtinJoin(list, types.String(","))
+		result, err := builtinJoin(context.Background(), list, types.String(","))
 		require.NoError(t, err)
 		got, _ := result.AsString()
 		assert.Equal(t, "a,b,c", got)
@@ -1021,7 +1080,7 @@ func TestBuiltinJoin(t *testing.T) {
 
 	t.Run("join with mixed types", func(t *testing.T) {
 		list := types.List(types.String("a"), types.Int(1), types.String("b"))
-		result, err := builtinJoin(list, types.String("-"))
+		result, err := builtinJoin(context.Background(), list, types.String("-"))
 		require.NoError(t, err)
 		got, _ := result.AsString()
 		assert.Equal(t, "a-1-b", got)
@@ -1051,7 +1110,7 @@ func TestBuiltinMatch(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := builtinMatch(tt.str, tt.pattern)
+			result, err := builtinMatch(context.Background(), tt.str, tt.pattern)
 			if tt.hasError {
 				assert.Error(t, err)
 			} else {
@@ -1164,7 +1223,7 @@ func TestBuiltinBool(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := builtinBool(tt.input)
+			result, err := builtinBool(context.Background(), tt.input)
 			require.NoError(t, err)
 			got, _ := result.AsBool()
 			assert.Equal(t, tt.expected, got)
@@ -1257,7 +1316,7 @@ func TestBuiltinAt(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := builtinAt(list, tt.index)
+			result, err := builtinAt(context.Background(), list, tt.index)
 			if tt.hasError {
 				assert.Error(t, err)
 			} else {
@@ -1267,6 +1326,10 @@ func TestBuiltinAt(t *testing.T) {
 			}
 		})
 	}
+
+	result, err := builtinAt(WithSafeIndex(context.Background(), true), list, types.Int(10))
+	require.NoError(t, err)
+	assert.True(t, result.IsNull())
 }
 
 func TestBuiltinReverse(t *testing.T) {
@@ -1288,7 +1351,7 @@ func TestBuiltinReverse(t *testing.T) {
 
 func TestBuiltinUnique(t *testing.T) {
 	list := types.List(types.Int(1), types.Int(2), types.Int(1), types.Int(3), types.Int(2))
-	result, err := builtinUnique(list)
+	result, err := builtinUnique(context.Background(), list)
 	require.NoError(t, err)
 
 	unique, ok := result.AsList()
@@ -1302,7 +1365,7 @@ func TestBuiltinFlatten(t *testing.T) {
 		types.List(types.Int(2), types.Int(3)),
 		types.List(types.Int(4), types.List(types.Int(5))),
 	)
-	result, err := builtinFlatten(nested)
+	result, err := builtinFlatten(context.Background(), nested)
 	require.NoError(t, err)
 
 	flat, ok := result.AsList()
@@ -1310,6 +1373,29 @@ func TestBuiltinFlatten(t *testing.T) {
 	assert.Len(t, flat, 5)
 }
 
+func TestCancelableBuiltins(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	nested := types.List(types.List(types.Int(2), types.Int(1)), types.Int(3))
+	for _, name := range []string{"flatten", "unique", "sortAsc", "sortDesc"} {
+		t.Run(name, func(t *testing.T) {
+			_, err := r.CallContext(ctx, nil, name, nested)
+			require.Error(t, err)
+			assert.True(t, errors.IsCode(err, errors.ErrTimeout), "timeouts are not wrapped: %v", err)
+
+			_, err = r.Call(name, nested)
+			assert.NoError(t, err)
+		})
+	}
+
+	_, err = builtinJoin(ctx, types.List(types.String("a")), types.String(","))
+	assert.True(t, errors.IsCode(err, errors.ErrTimeout))
+}
+
 func TestBuiltinSlice(t *testing.T) {
 	list := types.List(types.Int(1), types.Int(2), types.Int(3), types.Int(4), types.Int(5))
 
@@ -1367,7 +1453,7 @@ func TestBuiltinCoalesce(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := builtinCoalesce(tt.args...)
+			result, err := builtinCoalesce(thunks(tt.args...)...)
 			require.NoError(t, err)
 			if tt.isNull {
 				assert.True(t, result.IsNull())
@@ -1378,6 +1464,12 @@ func TestBuiltinCoalesce(t *testing.T) {
 	}
 }
 
+func TestBuiltinCoalesce_ShortCircuits(t *testing.T) {
+	result, err := builtinCoalesce(Value(types.Null()), Value(types.Int(1)), failing(t))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Raw)
+}
+
 func TestBuiltinIfThenElse(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -1394,13 +1486,86 @@ func TestBuiltinIfThenElse(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := builtinIfThenElse(tt.condition, tt.thenVal, tt.elseVal)
+			result, err := builtinIfThenElse(thunks(tt.condition, tt.thenVal, tt.elseVal)...)
 			require.NoError(t, err)
 			assert.Equal(t, tt.expected, result.Raw)
 		})
 	}
 }
 
+func TestBuiltinIfThenElse_ShortCircuits(t *testing.T) {
+	result, err := builtinIfThenElse(Value(types.Bool(true)), Value(types.Int(1)), failing(t))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Raw)
+
+	result, err = builtinIfThenElse(Value(types.Bool(false)), failing(t), Value(types.Int(2)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Raw)
+}
+
+func TestBuiltinTryCatch(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		result, err := builtinTryCatch(Value(types.Int(1)), failing(t))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), result.Raw)
+	})
+
+	t.Run("failure returns fallback", func(t *testing.T) {
+		expr := func() (types.Value, error) {
+			return types.Null(), errors.New(errors.ErrDivisionByZero, "division by zero")
+		}
+		result, err := builtinTryCatch(expr, Value(types.Int(0)))
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), result.Raw)
+	})
+
+	t.Run("timeout is not caught", func(t *testing.T) {
+		expr := func() (types.Value, error) {
+			return types.Null(), errors.New(errors.ErrTimeout, "evaluation timed out")
+		}
+		_, err := builtinTryCatch(expr, Value(types.Int(0)))
+		assert.True(t, errors.IsCode(err, errors.ErrTimeout))
+	})
+}
+
+func TestBuiltinScore(t *testing.T) {
+	pairs := types.List(
+		types.List(types.Bool(true), types.Int(40)),
+		types.List(types.Bool(false), types.String("not a weight")),
+		types.List(types.Int(1), types.Float(2.5)),
+	)
+	result, err := builtinScore(Value(pairs))
+	require.NoError(t, err)
+	assert.Equal(t, 42.5, result.Raw)
+
+	result, err = builtinScore(Value(types.List()))
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, result.Raw)
+
+	_, err = builtinScore(Value(types.List(types.List(types.Bool(true)))))
+	assert.True(t, errors.IsCode(err, errors.ErrTypeMismatch))
+
+	_, err = builtinScore(Value(types.List(types.List(types.Bool(true), types.String("high")))))
+	assert.True(t, errors.IsCode(err, errors.ErrTypeMismatch))
+}
+
+// thunks wraps evaluated values as lazy arguments.
+func thunks(values ...types.Value) []Thunk {
+	args := make([]Thunk, len(values))
+	for i, v := range values {
+		args[i] = Value(v)
+	}
+	return args
+}
+
+// failing returns a lazy argument that fails the test if it is evaluated.
+func failing(t *testing.T) Thunk {
+	return func() (types.Value, error) {
+		t.Error("argument should not be evaluated")
+		return types.Null(), nil
+	}
+}
+
 func TestBuiltinIsNull(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -0,0 +1,127 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Names of the functions reading the country reference table.
+const (
+	CountryNameFunction     = "isoCountryName"
+	CountryCurrencyFunction = "currencyForCountry"
+	InEUFunction            = "inEU"
+)
+
+// Country is the reference data of a country, keyed in tables by its ISO
+// 3166-1 alpha-2 code, such as "DE".
+type Country struct {
+	Name     string // Short English name
+	Currency string // ISO 4217 code of the currency, empty if there is none
+	EU       bool   // Member state of the European Union
+}
+
+//go:embed data/countries.csv
+var countriesCSV string
+
+// defaultCountries is the embedded reference table, parsed once.
+var defaultCountries = parseCountries(countriesCSV)
+
+// parseCountries parses the embedded reference table. The table is part of
+// the source tree, so a malformed table is a programming error.
+func parseCountries(data string) map[string]Country {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		panic("functions: malformed country table: " + err.Error())
+	}
+
+	table := make(map[string]Country, len(records))
+	for _, record := range records[1:] {
+		table[record[0]] = Country{Name: record[1], Currency: record[2], EU: record[3] == "true"}
+	}
+	return table
+}
+
+// Countries returns a copy of the embedded country reference table, for hosts
+// that build an override table with a few entries changed.
+func Countries() map[string]Country {
+	table := make(map[string]Country, len(defaultCountries))
+	for code, country := range defaultCountries {
+		table[code] = country
+	}
+	return table
+}
+
+// RegisterCountries registers isoCountryName, currencyForCountry, and inEU
+// reading the given table instead of the embedded one. Codes in the table
+// must be upper case. Unregister the functions first to replace those
+// registered by RegisterBuiltIns.
+func RegisterCountries(r *Registry, table map[string]Country) error {
+	return r.RegisterAll(countryFunctions(table)...)
+}
+
+// countryFunctions returns the functions reading a country table.
+func countryFunctions(table map[string]Country) []*Function {
+	fns := []*Function{
+		{
+			Name:      CountryNameFunction,
+			Signature: types.NewFunctionSignature(CountryNameFunction, types.TypeString, types.Param("code", types.TypeAny)),
+			BuiltIn: countryFunction(table, CountryNameFunction, func(c Country, ok bool) types.Value {
+				if !ok {
+					return types.Null()
+				}
+				return types.String(c.Name)
+			}),
+		},
+		{
+			Name:      CountryCurrencyFunction,
+			Signature: types.NewFunctionSignature(CountryCurrencyFunction, types.TypeString, types.Param("code", types.TypeAny)),
+			BuiltIn: countryFunction(table, CountryCurrencyFunction, func(c Country, ok bool) types.Value {
+				if !ok || c.Currency == "" {
+					return types.Null()
+				}
+				return types.String(c.Currency)
+			}),
+		},
+		{
+			Name:      InEUFunction,
+			Signature: types.NewFunctionSignature(InEUFunction, types.TypeBool, types.Param("code", types.TypeAny)),
+			BuiltIn: countryFunction(table, InEUFunction, func(c Country, ok bool) types.Value {
+				return types.Bool(ok && c.EU)
+			}),
+		},
+	}
+
+	for _, fn := range fns {
+		fn.Pure = true
+		if doc, ok := builtinDocs[fn.Name]; ok {
+			doc.document(fn.Signature)
+		}
+	}
+	return fns
+}
+
+// countryFunction returns a function that looks up its argument, a country
+// code in any case, in the table and converts the entry with result. ok is
+// false for unknown codes and null.
+func countryFunction(table map[string]Country, name string, result func(c Country, ok bool) types.Value) BuiltInFunc {
+	return func(args ...types.Value) (types.Value, error) {
+		if len(args) < 1 {
+			return types.Null(), errors.Newf(errors.ErrArgumentCount, "%s requires 1 argument: code", name)
+		}
+		if args[0].IsNull() {
+			return result(Country{}, false), nil
+		}
+		code, ok := args[0].AsString()
+		if !ok {
+			return types.Null(), errors.Newf(errors.ErrArgumentType, "%s code must be a string, got %s", name, args[0].Type)
+		}
+
+		country, ok := table[strings.ToUpper(strings.TrimSpace(code))]
+		return result(country, ok), nil
+	}
+}
@@ -0,0 +1,70 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountryFunctions(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	call := func(name string, arg types.Value) types.Value {
+		t.Helper()
+		result, err := r.Call(name, arg)
+		require.NoError(t, err)
+		return result
+	}
+
+	assert.Equal(t, "Germany", call(CountryNameFunction, types.String("DE")).Raw)
+	assert.Equal(t, "Germany", call(CountryNameFunction, types.String(" de ")).Raw, "codes are trimmed and case-insensitive")
+	assert.True(t, call(CountryNameFunction, types.String("ZZ")).IsNull())
+	assert.True(t, call(CountryNameFunction, types.Null()).IsNull())
+
+	assert.Equal(t, "EUR", call(CountryCurrencyFunction, types.String("HR")).Raw)
+	assert.Equal(t, "CHF", call(CountryCurrencyFunction, types.String("CH")).Raw)
+	assert.True(t, call(CountryCurrencyFunction, types.String("AQ")).IsNull(), "no currency")
+
+	assert.Equal(t, true, call(InEUFunction, types.String("fr")).Raw)
+	assert.Equal(t, false, call(InEUFunction, types.String("NO")).Raw)
+	assert.Equal(t, false, call(InEUFunction, types.String("GB")).Raw)
+	assert.Equal(t, false, call(InEUFunction, types.Null()).Raw)
+
+	_, err = r.Call(InEUFunction, types.Int(1))
+	assert.ErrorContains(t, err, "inEU code must be a string")
+}
+
+func TestCountries(t *testing.T) {
+	table := Countries()
+	assert.Len(t, table, 249)
+
+	members := 0
+	for code, country := range table {
+		assert.Len(t, code, 2)
+		assert.NotEmpty(t, country.Name, code)
+		if country.EU {
+			members++
+		}
+	}
+	assert.Equal(t, 27, members)
+
+	table["DE"] = Country{Name: "changed"}
+	assert.Equal(t, "Germany", Countries()["DE"].Name, "a copy")
+}
+
+func TestRegisterCountries(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, RegisterCountries(r, map[string]Country{"XK": {Name: "Kosovo", Currency: "EUR"}}))
+
+	result, err := r.Call(CountryNameFunction, types.String("xk"))
+	require.NoError(t, err)
+	assert.Equal(t, "Kosovo", result.Raw)
+
+	result, err = r.Call(CountryNameFunction, types.String("DE"))
+	require.NoError(t, err)
+	assert.True(t, result.IsNull(), "only the given table is read")
+}
@@ -0,0 +1,271 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// currentTime returns the time of now(); tests replace it.
+var currentTime = time.Now
+
+// builtinNow returns the current time in UTC.
+func builtinNow(args ...types.Value) (types.Value, error) {
+	return types.Time(currentTime().UTC()), nil
+}
+
+// builtinParseDate parses a string into a date/time, as an RFC 3339 timestamp
+// or date unless a Go layout such as "02/01/2006" is given.
+func builtinParseDate(args ...types.Value) (types.Value, error) {
+	s, ok := args[0].AsString()
+	if !ok {
+		if args[0].Type == types.TypeDateTime {
+			return args[0], nil
+		}
+		return types.Null(), errors.New(errors.ErrTypeMismatch, "parseDate requires a string value")
+	}
+	if len(args) < 2 {
+		t, ok := types.ParseTime(s)
+		if !ok {
+			return types.Null(), errors.Newf(errors.ErrArgumentType, "parseDate: %q is not an RFC 3339 timestamp or date", s)
+		}
+		return types.Time(t), nil
+	}
+
+	layout, ok := args[1].AsString()
+	if !ok {
+		return types.Null(), errors.New(errors.ErrTypeMismatch, "parseDate layout must be a string")
+	}
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return types.Null(), errors.Wrap(errors.ErrArgumentType, "parseDate: "+err.Error(), err)
+	}
+	return types.Time(t), nil
+}
+
+// builtinFormatDate formats a date/time with a Go layout, RFC 3339 by
+// default.
+func builtinFormatDate(args ...types.Value) (types.Value, error) {
+	t, err := timeArg("formatDate", args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	layout := time.RFC3339
+	if len(args) > 1 {
+		if layout, _ = args[1].AsString(); layout == "" {
+			return types.Null(), errors.New(errors.ErrTypeMismatch, "formatDate layout must be a non-empty string")
+		}
+	}
+	return types.String(t.Format(layout)), nil
+}
+
+// builtinDateAdd adds an amount of a unit, which may be negative, to a
+// date/time.
+func builtinDateAdd(args ...types.Value) (types.Value, error) {
+	t, err := timeArg("dateAdd", args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	amount, ok := args[1].AsInt()
+	if !ok || args[1].Type != types.TypeInt {
+		return types.Null(), errors.New(errors.ErrTypeMismatch, "dateAdd amount must be an integer")
+	}
+	unit, err := unitArg("dateAdd", args[2])
+	if err != nil {
+		return types.Null(), err
+	}
+
+	n := int(amount)
+	switch unit {
+	case "month":
+		return types.Time(t.AddDate(0, n, 0)), nil
+	case "year":
+		return types.Time(t.AddDate(n, 0, 0)), nil
+	case "day":
+		return types.Time(t.AddDate(0, 0, n)), nil
+	case "week":
+		return types.Time(t.AddDate(0, 0, 7*n)), nil
+	}
+	return types.Time(t.Add(time.Duration(amount) * durationUnits[unit])), nil
+}
+
+// builtinDateDiff returns the number of whole units from one date/time to
+// another, negative if to is earlier.
+func builtinDateDiff(args ...types.Value) (types.Value, error) {
+	from, err := timeArg("dateDiff", args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	to, err := timeArg("dateDiff", args[1])
+	if err != nil {
+		return types.Null(), err
+	}
+	unit, err := unitArg("dateDiff", args[2])
+	if err != nil {
+		return types.Null(), err
+	}
+
+	switch unit {
+	case "month":
+		return types.Int(monthsBetween(from, to)), nil
+	case "year":
+		return types.Int(monthsBetween(from, to) / 12), nil
+	case "day":
+		return types.Int(int64(to.Sub(from) / (24 * time.Hour))), nil
+	case "week":
+		return types.Int(int64(to.Sub(from) / (7 * 24 * time.Hour))), nil
+	}
+	return types.Int(int64(to.Sub(from) / durationUnits[unit])), nil
+}
+
+// builtinDayOfWeek returns the ISO 8601 day of the week of a date/time, from
+// 1 for Monday to 7 for Sunday.
+func builtinDayOfWeek(args ...types.Value) (types.Value, error) {
+	t, err := timeArg("dayOfWeek", args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	day := int64(t.Weekday())
+	if day == 0 {
+		day = 7
+	}
+	return types.Int(day), nil
+}
+
+// builtinIsBefore reports whether a date/time is before another.
+func builtinIsBefore(args ...types.Value) (types.Value, error) {
+	a, b, err := timeArgs("isBefore", args)
+	if err != nil {
+		return types.Null(), err
+	}
+	return types.Bool(a.Before(b)), nil
+}
+
+// builtinIsAfter reports whether a date/time is after another.
+func builtinIsAfter(args ...types.Value) (types.Value, error) {
+	a, b, err := timeArgs("isAfter", args)
+	if err != nil {
+		return types.Null(), err
+	}
+	return types.Bool(a.After(b)), nil
+}
+
+// builtinDuration parses a string such as "90s" or "2h30m" into a duration.
+func builtinDuration(args ...types.Value) (types.Value, error) {
+	d, err := durationArg("duration", args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	return types.Duration(d), nil
+}
+
+// builtinSeconds returns a duration as a number of seconds.
+func builtinSeconds(args ...types.Value) (types.Value, error) {
+	d, err := durationArg("seconds", args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	return types.Float(d.Seconds()), nil
+}
+
+// builtinMinutes returns a duration as a number of minutes.
+func builtinMinutes(args ...types.Value) (types.Value, error) {
+	d, err := durationArg("minutes", args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	return types.Float(d.Minutes()), nil
+}
+
+// builtinHours returns a duration as a number of hours.
+func builtinHours(args ...types.Value) (types.Value, error) {
+	d, err := durationArg("hours", args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	return types.Float(d.Hours()), nil
+}
+
+// durationUnits holds the units of fixed length accepted by dateAdd and
+// dateDiff.
+var durationUnits = map[string]time.Duration{
+	"millisecond": time.Millisecond,
+	"second":      time.Second,
+	"minute":      time.Minute,
+	"hour":        time.Hour,
+}
+
+// calendarUnits holds the units whose length depends on the calendar.
+var calendarUnits = map[string]bool{"day": true, "week": true, "month": true, "year": true}
+
+// unitArg returns the unit named by a value, such as "day" for "days".
+func unitArg(fn string, v types.Value) (string, error) {
+	s, ok := v.AsString()
+	if !ok {
+		return "", errors.Newf(errors.ErrTypeMismatch, "%s unit must be a string", fn)
+	}
+	unit := strings.TrimSuffix(strings.ToLower(s), "s")
+	if _, ok := durationUnits[unit]; !ok && !calendarUnits[unit] {
+		return "", errors.Newf(errors.ErrArgumentType,
+			"%s: unknown unit %q; use milliseconds, seconds, minutes, hours, days, weeks, months, or years", fn, s)
+	}
+	return unit, nil
+}
+
+// timeArg returns the time of a date/time argument or of a string holding a
+// timestamp.
+func timeArg(fn string, v types.Value) (time.Time, error) {
+	t, ok := v.AsTime()
+	if !ok {
+		if v.Type == types.TypeString {
+			return time.Time{}, errors.Newf(errors.ErrArgumentType, "%s: %q is not an RFC 3339 timestamp or date", fn, v.Raw)
+		}
+		return time.Time{}, errors.Newf(errors.ErrTypeMismatch, "%s requires a datetime value, got %s", fn, v.Type)
+	}
+	return t, nil
+}
+
+// durationArg returns the duration of a duration argument or of a string
+// holding one.
+func durationArg(fn string, v types.Value) (time.Duration, error) {
+	d, ok := v.AsDuration()
+	if !ok {
+		if v.Type == types.TypeString {
+			return 0, errors.Newf(errors.ErrArgumentType, "%s: %q is not a duration such as \"90s\" or \"2h30m\"", fn, v.Raw)
+		}
+		return 0, errors.Newf(errors.ErrTypeMismatch, "%s requires a duration value, got %s", fn, v.Type)
+	}
+	return d, nil
+}
+
+// timeArgs returns the times of the two arguments of a comparison.
+func timeArgs(fn string, args []types.Value) (time.Time, time.Time, error) {
+	a, err := timeArg(fn, args[0])
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	b, err := timeArg(fn, args[1])
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return a, b, nil
+}
+
+// monthsBetween returns the number of whole calendar months from one time to
+// another, such as 1 from January 15 to February 15 and 0 from January 31 to
+// February 28.
+func monthsBetween(from, to time.Time) int64 {
+	sign := int64(1)
+	if to.Before(from) {
+		from, to, sign = to, from, -1
+	}
+	to = to.In(from.Location())
+	months := int64(to.Year()-from.Year())*12 + int64(to.Month()-from.Month())
+	if months > 0 && from.AddDate(0, int(months), 0).After(to) {
+		months--
+	}
+	return sign * months
+}
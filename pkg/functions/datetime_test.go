@@ -0,0 +1,149 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDateTimeFunctions(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	date := func(s string) types.Value {
+		parsed, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return types.Time(parsed)
+	}
+	call := func(name string, args ...types.Value) types.Value {
+		t.Helper()
+		result, err := r.Call(name, args...)
+		require.NoError(t, err)
+		return result
+	}
+
+	t.Run("now", func(t *testing.T) {
+		fixed := time.Date(2024, 5, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+		defer func(orig func() time.Time) { currentTime = orig }(currentTime)
+		currentTime = func() time.Time { return fixed }
+
+		now := call("now")
+		assert.Equal(t, types.TypeDateTime, now.Type)
+		assert.Equal(t, "2024-05-01T12:00:00Z", now.Raw.(time.Time).Format(time.RFC3339))
+		fn, _ := r.Get("now")
+		assert.False(t, fn.Pure)
+	})
+
+	t.Run("parseDate and formatDate", func(t *testing.T) {
+		assert.Equal(t, date("2024-05-01T00:00:00Z"), call("parseDate", types.String("2024-05-01")))
+		assert.Equal(t, date("2024-05-01T10:30:00+02:00").Raw.(time.Time).Unix(),
+			call("parseDate", types.String("2024-05-01T10:30:00+02:00")).Raw.(time.Time).Unix())
+		assert.Equal(t, date("2024-01-02T00:00:00Z"), call("parseDate", types.String("02/01/2024"), types.String("02/01/2006")))
+
+		assert.Equal(t, types.String("2024-05-01T00:00:00Z"), call("formatDate", date("2024-05-01T00:00:00Z")))
+		assert.Equal(t, types.String("2024-05"), call("formatDate", types.String("2024-05-01"), types.String("2006-01")))
+
+		_, err := r.Call("parseDate", types.String("yesterday"))
+		assert.ErrorContains(t, err, `"yesterday" is not an RFC 3339 timestamp or date`)
+	})
+
+	t.Run("dateAdd", func(t *testing.T) {
+		base := date("2024-01-31T12:00:00Z")
+		assert.Equal(t, date("2024-01-24T12:00:00Z"), call("dateAdd", base, types.Int(-7), types.String("days")))
+		assert.Equal(t, date("2024-03-02T12:00:00Z"), call("dateAdd", base, types.Int(1), types.String("month")))
+		assert.Equal(t, date("2025-01-31T12:00:00Z"), call("dateAdd", base, types.Int(1), types.String("Years")))
+		assert.Equal(t, date("2024-01-31T14:30:00Z"), call("dateAdd", base, types.Int(150), types.String("minutes")))
+
+		_, err := r.Call("dateAdd", base, types.Int(1), types.String("fortnight"))
+		assert.Error(t, err)
+	})
+
+	t.Run("dateDiff", func(t *testing.T) {
+		from := types.String("2024-01-31")
+		assert.Equal(t, types.Int(14), call("dateDiff", types.String("2024-05-01"), types.String("2024-05-15"), types.String("days")))
+		assert.Equal(t, types.Int(-2), call("dateDiff", types.String("2024-05-15"), types.String("2024-05-01"), types.String("weeks")))
+		assert.Equal(t, types.Int(0), call("dateDiff", from, types.String("2024-02-29"), types.String("months")))
+		assert.Equal(t, types.Int(1), call("dateDiff", from, types.String("2024-03-01"), types.String("months")))
+		assert.Equal(t, types.Int(17), call("dateDiff", types.String("2006-06-01"), types.String("2024-05-31"), types.String("years")))
+		assert.Equal(t, types.Int(36), call("dateDiff", types.String("2024-05-01T00:00:00Z"), types.String("2024-05-02T12:00:00Z"), types.String("hours")))
+	})
+
+	t.Run("dayOfWeek and comparisons", func(t *testing.T) {
+		assert.Equal(t, types.Int(3), call("dayOfWeek", types.String("2024-05-01")))
+		assert.Equal(t, types.Int(7), call("dayOfWeek", types.String("2024-05-05")))
+
+		assert.Equal(t, types.Bool(true), call("isBefore", types.String("2024-05-01"), date("2024-05-01T00:00:01Z")))
+		assert.Equal(t, types.Bool(false), call("isAfter", types.String("2024-05-01"), types.String("2024-05-01")))
+
+		_, err := r.Call("isAfter", types.Int(1), types.String("2024-05-01"))
+		assert.Error(t, err)
+	})
+}
+
+func TestValue_DateTime(t *testing.T) {
+	at := types.Time(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+
+	assert.True(t, at.Equals(types.String("2024-05-01")))
+	assert.True(t, at.Equals(types.String("2024-05-01T02:00:00+02:00")))
+	assert.False(t, at.Equals(types.String("May 1")))
+
+	cmp, ok := at.Compare(types.String("2024-04-30T23:59:59Z"))
+	assert.True(t, ok)
+	assert.Equal(t, 1, cmp)
+	_, ok = at.Compare(types.Int(1))
+	assert.False(t, ok)
+
+	assert.Equal(t, "datetime", at.Type.String())
+	assert.Equal(t, at, types.NewValue(at.Raw))
+}
+
+func TestDurationFunctions(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	call := func(name string, args ...types.Value) types.Value {
+		t.Helper()
+		result, err := r.Call(name, args...)
+		require.NoError(t, err)
+		return result
+	}
+
+	assert.Equal(t, types.Duration(150*time.Minute), call("duration", types.String("2h30m")))
+	assert.Equal(t, types.Duration(36*time.Hour), call("duration", types.String("1.5d")))
+	assert.Equal(t, types.Duration(-90*time.Second), call("duration", types.String("-1m30s")))
+	assert.Equal(t, types.Float(90), call("seconds", types.Duration(90*time.Second)))
+	assert.Equal(t, types.Float(1.5), call("minutes", types.String("90s")))
+	assert.Equal(t, types.Float(0.25), call("hours", types.Duration(15*time.Minute)))
+	assert.Equal(t, types.String("1h30m0s"), call("string", types.Duration(90*time.Minute)))
+
+	_, err = r.Call("duration", types.String("soon"))
+	assert.ErrorContains(t, err, `"soon" is not a duration`)
+	_, err = r.Call("hours", types.Int(3))
+	assert.Error(t, err)
+}
+
+func TestValue_Duration(t *testing.T) {
+	d := types.Duration(90 * time.Second)
+
+	assert.True(t, d.Equals(types.String("1m30s")))
+	assert.False(t, d.Equals(types.Int(90)))
+	assert.False(t, types.Duration(0).IsTruthy())
+
+	cmp, ok := d.Compare(types.Duration(time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, 1, cmp)
+	_, ok = d.Compare(types.Time(time.Now()))
+	assert.False(t, ok)
+
+	for _, s := range []string{"", "5", "m", "5x", "1h-5m", "9999999999h"} {
+		_, ok := types.ParseDuration(s)
+		assert.False(t, ok, s)
+	}
+
+	assert.Equal(t, "duration", d.Type.String())
+	assert.Equal(t, d, types.NewValue(d.Raw))
+}
@@ -0,0 +1,84 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"math/big"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// DecimalFunction is the name of the function converting values to decimals.
+const DecimalFunction = "decimal"
+
+// MaxDecimalPlaces is the most fraction digits decimal rounds to. Rounding
+// computes a power of ten that evaluations cannot interrupt, so larger
+// values are rejected rather than tying up a CPU.
+const MaxDecimalPlaces = 100
+
+// builtinDecimal converts an int, a float, or a string such as "19.99" to a
+// decimal, an exact number for money: decimal("0.1") + decimal("0.2") ==
+// decimal("0.3") holds. Floats convert to the shortest decimal that reads
+// back as the same float, so decimal(0.1) is exactly one tenth. If places is
+// given, the result is rounded to that many fraction digits, half away from
+// zero.
+func builtinDecimal(args ...types.Value) (types.Value, error) {
+	if len(args) == 0 {
+		return types.Null(), errors.New(errors.ErrArgumentCount, "decimal requires 1 argument")
+	}
+
+	r, ok := args[0].AsDecimal()
+	if !ok {
+		if args[0].Type == types.TypeString {
+			return types.Null(), errors.Newf(errors.ErrTypeMismatch, "cannot convert %q to decimal", args[0].Raw)
+		}
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "cannot convert %s to decimal", args[0].Type)
+	}
+
+	if len(args) > 1 {
+		places, ok := args[1].AsInt()
+		if !ok || args[1].Type != types.TypeInt || places < 0 || places > MaxDecimalPlaces {
+			return types.Null(), errors.Newf(errors.ErrArgumentType, "decimal places must be an int from 0 to %d, got %v", MaxDecimalPlaces, args[1].Raw)
+		}
+		r = RoundDecimal(r, int(places))
+	}
+	return types.Decimal(r), nil
+}
+
+// RoundDecimal rounds a decimal to the given number of fraction digits, half
+// away from zero, returning a new decimal.
+func RoundDecimal(r *big.Rat, places int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(scale))
+
+	// Add one half toward the sign, then truncate
+	half := big.NewRat(int64(scaled.Sign()), 2)
+	scaled.Add(scaled, half)
+	n := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+	return new(big.Rat).SetFrac(n, scale)
+}
+
+// sumDecimals returns the exact sum of the numbers among values, as a
+// decimal, for sum when any of them is a decimal.
+func sumDecimals(values []types.Value) types.Value {
+	sum := new(big.Rat)
+	for _, v := range values {
+		if !v.Type.IsNumeric() {
+			continue // Skip non-numeric values
+		}
+		if r, ok := v.AsDecimal(); ok {
+			sum.Add(sum, r)
+		}
+	}
+	return types.Decimal(sum)
+}
+
+// hasDecimal reports whether any of the values is a decimal.
+func hasDecimal(values []types.Value) bool {
+	for _, v := range values {
+		if v.Type == types.TypeDecimal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinDecimal(t *testing.T) {
+	dec := func(args ...types.Value) string {
+		t.Helper()
+		result, err := builtinDecimal(args...)
+		require.NoError(t, err)
+		require.Equal(t, types.TypeDecimal, result.Type)
+		return result.Raw.(*types.Dec).String()
+	}
+
+	assert.Equal(t, "0.1", dec(types.Float(0.1)))
+	assert.Equal(t, "42", dec(types.Int(42)))
+	assert.Equal(t, "19.99", dec(types.String(" 19.99 ")))
+	assert.Equal(t, "0.001", dec(types.String("1e-3")))
+	assert.Equal(t, "2.68", dec(types.Float(2.675), types.Int(2)))
+	assert.Equal(t, "-2.68", dec(types.Float(-2.675), types.Int(2)))
+	assert.Equal(t, "3", dec(types.Float(2.5), types.Int(0)))
+
+	assert.Equal(t, "1"+strings.Repeat("0", types.MaxDecimalDigits), dec(types.String(fmt.Sprintf("1e%d", types.MaxDecimalDigits))))
+
+	for _, arg := range []types.Value{
+		types.String("abc"), types.String("1/3"), types.String("0x10"), types.Null(), types.Bool(true),
+		types.String("1e999999"), types.String("1e-999999"), types.String("1e99999999999999999999"),
+		types.String(fmt.Sprintf("1e%d", types.MaxDecimalDigits+1)), types.String(strings.Repeat("9", types.MaxDecimalDigits+1)),
+	} {
+		_, err := builtinDecimal(arg)
+		assert.True(t, errors.IsCode(err, errors.ErrTypeMismatch), "%v", arg.Raw)
+	}
+	_, err := builtinDecimal(types.Float(1), types.Int(-1))
+	assert.True(t, errors.IsCode(err, errors.ErrArgumentType))
+
+	assert.Equal(t, "1.5", dec(types.Float(1.5), types.Int(MaxDecimalPlaces)))
+	for _, places := range []int64{MaxDecimalPlaces + 1, 100000000} {
+		_, err = builtinDecimal(types.Float(1.5), types.Int(places))
+		assert.True(t, errors.IsCode(err, errors.ErrArgumentType), "places %d", places)
+		assert.ErrorContains(t, err, "from 0 to 100")
+	}
+}
+
+func TestDecimalConversions(t *testing.T) {
+	tenth := types.Decimal(big.NewRat(1, 10))
+
+	sum, err := builtinSum(types.List(tenth, types.Float(0.2), types.Int(1), types.String("x")))
+	require.NoError(t, err)
+	assert.True(t, sum.Equals(types.Decimal(big.NewRat(13, 10))))
+
+	abs, err := builtinAbs(types.Decimal(big.NewRat(-3, 2)))
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", abs.Raw.(*types.Dec).String())
+
+	i, err := builtinInt(types.Decimal(big.NewRat(-7, 2)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(-3), i.Raw)
+
+	f, err := builtinFloat(tenth)
+	require.NoError(t, err)
+	assert.Equal(t, 0.1, f.Raw)
+
+	s, err := builtinString(types.Decimal(big.NewRat(1, 3)))
+	require.NoError(t, err)
+	assert.Equal(t, "0.33333333333333333333", s.Raw)
+}
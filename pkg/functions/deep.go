@@ -0,0 +1,146 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// builtinDeepEquals reports whether two values have the same structure and
+// contents: lists of equal elements in the same order, or maps with the same
+// keys and equal values, at every level. Unlike ==, it never reads strings as
+// numbers, dates, or durations; ints and floats with the same value are
+// equal, as they are in JSON.
+func builtinDeepEquals(ctx context.Context, args ...types.Value) (types.Value, error) {
+	if len(args) < 2 {
+		return types.Null(), errors.New(errors.ErrArgumentCount, "deepEquals requires 2 arguments")
+	}
+
+	var paths []types.Value
+	visited := 0
+	if err := diffValues(ctx, "$", args[0], args[1], &paths, &visited, true); err != nil {
+		return types.Null(), err
+	}
+	return types.Bool(len(paths) == 0), nil
+}
+
+// builtinDiff returns the paths at which two values differ, such as
+// ["$.address.city", "$.tags[2]"], in the order of the keys and indices
+// compared. A key or index present in only one value is a difference; values
+// that are not both maps or both lists are compared whole. Equal values
+// give an empty list.
+func builtinDiff(ctx context.Context, args ...types.Value) (types.Value, error) {
+	if len(args) < 2 {
+		return types.Null(), errors.New(errors.ErrArgumentCount, "diff requires 2 arguments")
+	}
+
+	paths := []types.Value{}
+	visited := 0
+	if err := diffValues(ctx, "$", args[0], args[1], &paths, &visited, false); err != nil {
+		return types.Null(), err
+	}
+	return types.List(paths...), nil
+}
+
+// diffValues appends to paths the path of each difference between a and b
+// below path, stopping at the first one if first is set. visited counts the
+// values compared so far, across nesting levels.
+func diffValues(ctx context.Context, path string, a, b types.Value, paths *[]types.Value, visited *int, first bool) error {
+	if err := canceledAt(ctx, *visited); err != nil {
+		return err
+	}
+	*visited++
+
+	if a.Type == types.TypeAny {
+		a = types.NewValue(a.Raw)
+	}
+	if b.Type == types.TypeAny {
+		b = types.NewValue(b.Raw)
+	}
+
+	if am, ok := a.AsMap(); ok {
+		bm, ok := b.AsMap()
+		if !ok {
+			*paths = append(*paths, types.String(path))
+			return nil
+		}
+		keys := make([]string, 0, len(am)+len(bm))
+		for key := range am {
+			keys = append(keys, key)
+		}
+		for key := range bm {
+			if _, ok := am[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			av, aok := am[key]
+			bv, bok := bm[key]
+			if aok != bok {
+				*paths = append(*paths, types.String(keyPath(path, key)))
+			} else if err := diffValues(ctx, keyPath(path, key), av, bv, paths, visited, first); err != nil {
+				return err
+			}
+			if first && len(*paths) > 0 {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	if al, ok := a.AsList(); ok {
+		bl, ok := b.AsList()
+		if !ok {
+			*paths = append(*paths, types.String(path))
+			return nil
+		}
+		for i := 0; i < len(al) || i < len(bl); i++ {
+			elemPath := path + "[" + strconv.Itoa(i) + "]"
+			if i >= len(al) || i >= len(bl) {
+				*paths = append(*paths, types.String(elemPath))
+			} else if err := diffValues(ctx, elemPath, al[i], bl[i], paths, visited, first); err != nil {
+				return err
+			}
+			if first && len(*paths) > 0 {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	if !sameScalar(a, b) {
+		*paths = append(*paths, types.String(path))
+	}
+	return nil
+}
+
+// sameScalar reports whether two values that are not maps or lists are
+// equal without converting between types, except ints and floats.
+func sameScalar(a, b types.Value) bool {
+	if a.Type == types.TypeInt && b.Type == types.TypeInt {
+		ai, _ := a.AsInt()
+		bi, _ := b.AsInt()
+		return ai == bi
+	}
+	if a.Type.IsNumeric() && b.Type.IsNumeric() {
+		return a.Equals(b)
+	}
+	return a.Type == b.Type && a.Equals(b)
+}
+
+// identifierKey matches the map keys a path can name after a dot.
+var identifierKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// keyPath returns the path of the entry key of the map at path.
+func keyPath(path, key string) string {
+	if identifierKey.MatchString(key) {
+		return path + "." + key
+	}
+	return path + "[" + strconv.Quote(key) + "]"
+}
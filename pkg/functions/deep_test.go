@@ -0,0 +1,75 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinDeepEqualsAndDiff(t *testing.T) {
+	old := types.NewValue(map[string]interface{}{
+		"name":    "Ann",
+		"age":     30,
+		"tags":    []interface{}{"a", "b"},
+		"address": map[string]interface{}{"city": "Oslo", "zip": "0150"},
+		"x-id":    1,
+	})
+
+	tests := []struct {
+		name  string
+		b     types.Value
+		paths []string
+	}{
+		{"equal", types.NewValue(map[string]interface{}{
+			"name": "Ann", "age": 30.0, "tags": []interface{}{"a", "b"},
+			"address": map[string]interface{}{"zip": "0150", "city": "Oslo"}, "x-id": 1,
+		}), nil},
+		{"changed", types.NewValue(map[string]interface{}{
+			"name": "Ann", "age": "30", "tags": []interface{}{"a", "c", "d"},
+			"address": map[string]interface{}{"city": "Bergen"}, "x-id": 2, "email": "a@b.c",
+		}), []string{"$.address.city", "$.address.zip", "$.age", "$.email", "$.tags[1]", "$.tags[2]", `$["x-id"]`}},
+		{"not a map", types.List(), []string{"$"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			equal, err := builtinDeepEquals(context.Background(), old, tt.b)
+			require.NoError(t, err)
+			assert.Equal(t, types.Bool(tt.paths == nil), equal)
+
+			diff, err := builtinDiff(context.Background(), old, tt.b)
+			require.NoError(t, err)
+			list, ok := diff.AsList()
+			require.True(t, ok)
+			var paths []string
+			for _, p := range list {
+				s, _ := p.AsString()
+				paths = append(paths, s)
+			}
+			assert.Equal(t, tt.paths, paths)
+		})
+	}
+
+	// Scalars are compared without conversions other than int to float
+	for _, pair := range [][2]types.Value{
+		{types.String("5"), types.Int(5)},
+		{types.String("1h"), types.Duration(time.Hour)},
+		{types.Null(), types.Bool(false)},
+		{types.Int(1 << 62), types.Int(1<<62 + 1)},
+	} {
+		equal, err := builtinDeepEquals(context.Background(), pair[0], pair[1])
+		require.NoError(t, err)
+		assert.Equal(t, types.Bool(false), equal, "%v and %v", pair[0].Raw, pair[1].Raw)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := builtinDiff(ctx, old, old)
+	assert.True(t, errors.IsCode(err, errors.ErrTimeout))
+}
@@ -0,0 +1,313 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"sort"
+
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Function categories used by the built-in functions.
+const (
+	CategoryAggregate  = "aggregate"
+	CategoryMath       = "math"
+	CategoryString     = "string"
+	CategoryConversion = "conversion"
+	CategoryList       = "list"
+	CategoryUtility    = "utility"
+	CategoryDateTime   = "datetime"
+	CategoryUser       = "user" // Default category of JavaScript functions
+)
+
+// FunctionDoc documents a registered function and all of its overloads.
+type FunctionDoc struct {
+	Name        string         `json:"name"`
+	Category    string         `json:"category,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Kind        string         `json:"kind"` // "builtin", "js", or "lua"
+	Overloads   []SignatureDoc `json:"overloads"`
+	Examples    []string       `json:"examples,omitempty"`
+}
+
+// SignatureDoc documents one overload of a function.
+type SignatureDoc struct {
+	Signature   string         `json:"signature"` // e.g. "upper(str: string): string"
+	Description string         `json:"description,omitempty"`
+	Parameters  []ParameterDoc `json:"parameters"`
+	ReturnType  string         `json:"returnType"`
+	Variadic    bool           `json:"variadic,omitempty"`
+}
+
+// ParameterDoc documents a function parameter.
+type ParameterDoc struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+// Describe returns the documentation of a function, or false if no function
+// with that name is registered. The description, category, and examples are
+// taken from the first overload that defines them.
+func (r *Registry) Describe(name string) (*FunctionDoc, bool) {
+	overloads := r.ListOverloads(name)
+	if len(overloads) == 0 {
+		return nil, false
+	}
+
+	doc := &FunctionDoc{Name: name, Kind: "builtin", Overloads: make([]SignatureDoc, 0, len(overloads))}
+	for _, fn := range overloads {
+		if fn.IsJS() {
+			doc.Kind = "js"
+		}
+		if fn.IsLua() {
+			doc.Kind = "lua"
+		}
+		sig := fn.Signature
+		if sig == nil {
+			sig = types.NewVariadicSignature(name, types.TypeAny)
+		}
+		if doc.Description == "" {
+			doc.Description = sig.Description
+		}
+		if doc.Category == "" {
+			doc.Category = sig.Category
+		}
+		doc.Examples = append(doc.Examples, sig.Examples...)
+		doc.Overloads = append(doc.Overloads, signatureDoc(name, sig))
+	}
+	if doc.Category == "" && (doc.Kind == "js" || doc.Kind == "lua") {
+		doc.Category = CategoryUser
+	}
+	// An overload repeating the function description adds nothing
+	for i := range doc.Overloads {
+		if doc.Overloads[i].Description == doc.Description {
+			doc.Overloads[i].Description = ""
+		}
+	}
+	return doc, true
+}
+
+// Catalog returns the documentation of every registered function, sorted by
+// category and then by name.
+func (r *Registry) Catalog() []*FunctionDoc {
+	names := r.List()
+	docs := make([]*FunctionDoc, 0, len(names))
+	for _, name := range names {
+		if doc, ok := r.Describe(name); ok {
+			docs = append(docs, doc)
+		}
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		if docs[i].Category != docs[j].Category {
+			return docs[i].Category < docs[j].Category
+		}
+		return docs[i].Name < docs[j].Name
+	})
+	return docs
+}
+
+func signatureDoc(name string, sig *types.FunctionSignature) SignatureDoc {
+	named := *sig
+	named.Name = name
+	doc := SignatureDoc{
+		Signature:   named.String(),
+		Description: sig.Description,
+		Parameters:  make([]ParameterDoc, len(sig.Parameters)),
+		ReturnType:  sig.ReturnType.String(),
+		Variadic:    sig.Variadic,
+	}
+	for i, p := range sig.Parameters {
+		doc.Parameters[i] = ParameterDoc{Name: p.Name, Type: p.Type.String(), Description: p.Description}
+	}
+	return doc
+}
+
+// ============================================================================
+// Built-in function documentation
+// ============================================================================
+
+// builtinDoc documents a built-in function. Params holds the parameter
+// descriptions in order.
+type builtinDoc struct {
+	category    string
+	description string
+	params      []string
+	examples    []string
+}
+
+// document adds the documentation of a built-in function to its signature.
+func (d builtinDoc) document(sig *types.FunctionSignature) {
+	sig.Category = d.category
+	sig.Description = d.description
+	sig.Examples = d.examples
+	for i := range sig.Parameters {
+		if i < len(d.params) {
+			sig.Parameters[i].Description = d.params[i]
+		}
+	}
+}
+
+var builtinDocs = map[string]builtinDoc{
+	// Aggregate functions
+	"count": {CategoryAggregate, "Returns the number of elements of a list, or the number of arguments.",
+		[]string{"A list, or several values"}, []string{"count($.items) > 0"}},
+	"sum": {CategoryAggregate, "Returns the sum of the numeric values of a list or of the arguments, an exact decimal if any is a decimal. Non-numeric values are skipped.",
+		[]string{"A list, or several values"}, []string{"sum($.prices) < 100"}},
+	"avg": {CategoryAggregate, "Returns the average of the numeric values of a list or of the arguments.",
+		[]string{"A list, or several values"}, []string{"avg($.scores) >= 7.5"}},
+	"min": {CategoryAggregate, "Returns the smallest value of a list or of the arguments, ignoring nulls.",
+		[]string{"A list, or several values"}, []string{"min($.a, $.b)"}},
+	"max": {CategoryAggregate, "Returns the largest value of a list or of the arguments, ignoring nulls.",
+		[]string{"A list, or several values"}, []string{"max($.bids) > 1000"}},
+
+	// Math functions
+	"abs":   {CategoryMath, "Returns the absolute value of a number.", []string{"A number"}, []string{"abs($.delta) < 0.01"}},
+	"ceil":  {CategoryMath, "Rounds a number up to the nearest integer.", []string{"A number"}, []string{"ceil(4.2) == 5"}},
+	"floor": {CategoryMath, "Rounds a number down to the nearest integer.", []string{"A number"}, []string{"floor(4.8) == 4"}},
+	"round": {CategoryMath, "Rounds a number to the nearest integer, halves away from zero.", []string{"A number"}, []string{"round($.rating) == 4"}},
+	"pow": {CategoryMath, "Returns base raised to the power of exp.",
+		[]string{"The base", "The exponent"}, []string{"pow(2, 10) == 1024"}},
+	"sqrt": {CategoryMath, "Returns the square root of a number.", []string{"A non-negative number"}, []string{"sqrt($.area) > 3"}},
+	"mod": {CategoryMath, "Returns the remainder of a divided by b.",
+		[]string{"The dividend", "The divisor"}, []string{"mod($.id, 2) == 0"}},
+	"divmod": {CategoryMath, "Returns [a ~/ b, a % b], the quotient truncated toward zero and the remainder.",
+		[]string{"The dividend", "The divisor"}, []string{"divmod($.minutes, 60)[1] < 30"}},
+
+	// String functions
+	"len": {CategoryString, "Returns the length of a string in characters, or the number of elements of a list.",
+		[]string{"A string or list"}, []string{`len($.name) <= 64`}},
+	"lower": {CategoryString, "Converts a string to lower case.", []string{"The string"}, []string{`lower($.country) == "us"`}},
+	"upper": {CategoryString, "Converts a string to upper case.", []string{"The string"}, []string{`upper($.code) == "ABC"`}},
+	"trim":  {CategoryString, "Removes leading and trailing whitespace.", []string{"The string"}, []string{`trim($.input) != ""`}},
+	"contains": {CategoryString, "Reports whether a string contains a substring.",
+		[]string{"The string to search", "The substring to find"}, []string{`contains($.email, "@")`}},
+	"startsWith": {CategoryString, "Reports whether a string starts with a prefix.",
+		[]string{"The string", "The prefix"}, []string{`startsWith($.sku, "PRO-")`}},
+	"endsWith": {CategoryString, "Reports whether a string ends with a suffix.",
+		[]string{"The string", "The suffix"}, []string{`endsWith($.email, ".edu")`}},
+	"substr": {CategoryString, "Returns length characters of a string starting at start. A negative start counts from the end.",
+		[]string{"The string", "Zero-based start index", "Number of characters"}, []string{`substr($.zip, 0, 3) == "941"`}},
+	"replace": {CategoryString, "Replaces every occurrence of old in a string with new.",
+		[]string{"The string", "The text to replace", "The replacement"}, []string{`replace($.phone, "-", "")`}},
+	"split": {CategoryString, "Splits a string around each occurrence of a separator.",
+		[]string{"The string", "The separator"}, []string{`len(split($.tags, ",")) > 2`}},
+	"join": {CategoryString, "Joins the elements of a list into a string with a separator.",
+		[]string{"The list", "The separator"}, []string{`join($.names, ", ")`}},
+	"concat": {CategoryString, "Concatenates strings.", []string{"The strings"}, []string{`concat($.first, " ", $.last)`}},
+	"match": {CategoryString, "Reports whether a string matches a regular expression. Same as the =~ operator.",
+		[]string{"The string", "A regular expression"}, []string{`match($.email, "@example\\.com$")`}},
+	"trimLeft":  {CategoryString, "Removes leading whitespace.", []string{"The string"}, nil},
+	"trimRight": {CategoryString, "Removes trailing whitespace.", []string{"The string"}, nil},
+	"padLeft": {CategoryString, "Pads a string on the left to at least length characters.",
+		[]string{"The string", "The minimum length", "The padding, a space if empty"}, []string{`padLeft($.id, 6, "0")`}},
+	"padRight": {CategoryString, "Pads a string on the right to at least length characters.",
+		[]string{"The string", "The minimum length", "The padding, a space if empty"}, nil},
+	"repeat": {CategoryString, "Repeats a string count times.", []string{"The string", "The number of repetitions"}, []string{`repeat("*", 3)`}},
+	"format": {CategoryString, "Replaces the placeholders {0}, {1}, ... of a template with the arguments.",
+		[]string{"The template", "The values to insert"}, []string{`format("{0} items", len($.items))`}},
+
+	// Masking functions
+	"maskEmail": {CategoryString, "Masks the local part of an email address except for its first character, keeping the domain. Null gives null.",
+		[]string{"The email address"}, []string{`maskEmail($.user.email)`}},
+	"maskPan": {CategoryString, "Masks the digits of a payment card number except for the last four, keeping separators. Null gives null.",
+		[]string{"The card number"}, []string{`maskPan($.card.number)`}},
+	"redact": {CategoryString, "Replaces every match of a regex pattern with \"[REDACTED]\" or the replacement. Null gives null.",
+		[]string{"The string", "The regex pattern", "The text inserted instead of \"[REDACTED]\""}, []string{`redact($.message, "\\d{3}-\\d{2}-\\d{4}")`}},
+
+	// Type conversion functions
+	"int":    {CategoryConversion, "Converts a value to an integer.", []string{"The value to convert"}, []string{`int($.quantity) > 0`}},
+	"float":  {CategoryConversion, "Converts a value to a float.", []string{"The value to convert"}, []string{`float($.price) * 1.2`}},
+	"string": {CategoryConversion, "Converts a value to a string.", []string{"The value to convert"}, []string{`string($.id) == "42"`}},
+	"bool":   {CategoryConversion, "Converts a value to a boolean using its truthiness.", []string{"The value to convert"}, nil},
+	DecimalFunction: {CategoryConversion, "Converts an int, a float, or a numeric string to an exact decimal, rounded half away from zero to the given number of fraction digits if places is given.",
+		[]string{"The value to convert", "The number of fraction digits to round to"},
+		[]string{`decimal("0.1") + decimal("0.2") == decimal("0.3")`, `decimal($.price * 1.19, 2)`}},
+
+	// List functions
+	"first": {CategoryList, "Returns the first element of a list, or null if it is empty.", []string{"The list"}, []string{`first($.items).sku`}},
+	"last":  {CategoryList, "Returns the last element of a list, or null if it is empty.", []string{"The list"}, nil},
+	"at": {CategoryList, "Returns the element at an index. A negative index counts from the end.",
+		[]string{"The list", "Zero-based index"}, []string{`at($.items, -1)`}},
+	"reverse": {CategoryList, "Returns the elements of a list in reverse order.", []string{"The list"}, nil},
+	"unique":  {CategoryList, "Returns the elements of a list without duplicates, keeping the first occurrence.", []string{"The list"}, nil},
+	"flatten": {CategoryList, "Flattens nested lists into a single list.", []string{"The list"}, nil},
+	"slice": {CategoryList, "Returns the elements from start up to, but not including, end. Negative indexes count from the end.",
+		[]string{"The list", "Start index", "End index (exclusive)"}, []string{`slice($.items, 0, 3)`}},
+	"indexOf": {CategoryList, "Returns the index of the first element equal to value, or -1.",
+		[]string{"The list", "The value to find"}, []string{`indexOf($.roles, "admin") >= 0`}},
+	"sortAsc":  {CategoryList, "Returns the elements of a list in ascending order.", []string{"The list"}, nil},
+	"sortDesc": {CategoryList, "Returns the elements of a list in descending order.", []string{"The list"}, nil},
+	"all":      {CategoryList, "Reports whether every element of a list is truthy.", []string{"The list"}, nil},
+	"any":      {CategoryList, "Reports whether at least one element of a list is truthy.", []string{"The list"}, nil},
+
+	// Utility functions
+	"coalesce": {CategoryUtility, "Returns the first argument that is not null. Later arguments are not evaluated.",
+		[]string{"The candidate values"}, []string{`coalesce($.nickname, $.name, "anonymous")`}},
+	"ifThenElse": {CategoryUtility, "Returns then if the condition is truthy and else otherwise. Only the selected branch is evaluated.",
+		[]string{"The condition", "Result if the condition is truthy", "Result otherwise"}, []string{`ifThenElse($.vip, 0.2, 0.05)`}},
+	"isNull":    {CategoryUtility, "Reports whether a value is null.", []string{"The value"}, []string{`isNull($.deletedAt)`}},
+	"isNotNull": {CategoryUtility, "Reports whether a value is not null.", []string{"The value"}, nil},
+	"isEmpty": {CategoryUtility, "Reports whether a value is null, an empty string, or an empty list.",
+		[]string{"The value"}, []string{`!isEmpty($.tags)`}},
+	"typeOf": {CategoryUtility, "Returns the type name of a value.", []string{"The value"}, []string{`typeOf($.id) == "int"`}},
+	"deepEquals": {CategoryUtility, "Reports whether two values have the same contents at every level of nested lists and maps, without converting strings.",
+		[]string{"The first value", "The second value"}, []string{`!deepEquals($.old.address, $.new.address)`}},
+	"diff": {CategoryUtility, "Returns the paths at which two values differ, such as \"$.address.city\", in key and index order.",
+		[]string{"The first value", "The second value"}, []string{`"$.email" IN diff($.old, $.new)`}},
+	"defaultVal": {CategoryUtility, "Returns value, or default if value is null. The default is only evaluated when needed.",
+		[]string{"The value", "The fallback"}, []string{`defaultVal($.limit, 10)`}},
+	"tryCatch": {CategoryUtility, "Returns expr, or fallback if evaluating expr fails. Timeouts and limit errors are not caught.",
+		[]string{"The expression to try", "Result if expr fails"}, []string{`tryCatch($.total / $.count, 0)`}},
+	"score": {CategoryUtility, "Returns the sum of the weights of the [condition, weight] pairs whose condition is truthy. The weights of conditions that do not hold are not evaluated.",
+		[]string{"The [condition, weight] pairs"}, []string{`score([[$.amount > 1000, 40], [$.country IN $.highRisk, 30], [$.newDevice, 20]]) >= 50`}},
+	"rolloutBucket": {CategoryUtility, "Reports whether a key, such as a user ID, hashes into the first percentage of 100 buckets. The same key always gets the same bucket; a salt picks independent buckets per feature.",
+		[]string{"The key, a string or a number", "The share of keys in the rollout, from 0 to 100", "A salt, such as the feature name"},
+		[]string{`rolloutBucket($.userId, 25)`, `rolloutBucket($.userId, 10, "new-checkout")`}},
+	CountryNameFunction: {CategoryUtility, "Returns the English name of a country from its ISO 3166-1 alpha-2 code, in any case, or null for unknown codes.",
+		[]string{"The country code, such as \"DE\""}, []string{`isoCountryName($.country) == "Germany"`}},
+	CountryCurrencyFunction: {CategoryUtility, "Returns the ISO 4217 currency code of a country, or null for unknown codes.",
+		[]string{"The country code, such as \"DE\""}, []string{`$.currency == currencyForCountry($.country)`}},
+	InEUFunction: {CategoryUtility, "Reports whether a country is a member state of the European Union. Unknown codes and null are not.",
+		[]string{"The country code, such as \"DE\""}, []string{`inEU($.billing.country) && !inEU($.shipping.country)`}},
+	JWTClaimsFunction: {CategoryUtility, "Decodes the claims of a JSON Web Token, with or without a \"Bearer \" prefix, without verifying its signature. Malformed tokens and null give null.",
+		[]string{"The token"}, []string{`jwtClaims($.headers.authorization).sub`, `"admin" IN jwtClaims($.token).roles`}},
+	JWTValidFunction: {CategoryUtility, "Reports whether a JSON Web Token is signed by the key set configured on the engine under a name, and is not expired or not yet valid.",
+		[]string{"The token", "The name of the key set"}, []string{`jwtValid($.token, "gateway") && jwtClaims($.token).role == "admin"`}},
+	"clamp": {CategoryMath, "Limits a value to the range [min, max].",
+		[]string{"The value", "Lower bound", "Upper bound"}, []string{`clamp($.score, 0, 100)`}},
+	"between": {CategoryMath, "Reports whether a value lies in the inclusive range [min, max].",
+		[]string{"The value", "Lower bound", "Upper bound"}, []string{`between($.age, 18, 65)`}},
+
+	// Date/time functions; datetime parameters also accept RFC 3339 strings
+	"now": {CategoryDateTime, "Returns the current time in UTC.", nil, []string{`$.expiresAt > now()`}},
+	"parseDate": {CategoryDateTime, "Parses a string into a datetime, as an RFC 3339 timestamp or a date such as 2024-05-01 unless a layout is given.",
+		[]string{"The string", "A Go time layout, such as \"02/01/2006\""}, []string{`parseDate($.dob, "02/01/2006") < parseDate("2006-01-01")`}},
+	"formatDate": {CategoryDateTime, "Formats a datetime with a Go time layout, RFC 3339 by default.",
+		[]string{"The datetime", "A Go time layout, such as \"2006-01-02\""}, []string{`formatDate($.createdAt, "2006-01") == "2024-05"`}},
+	"dateAdd": {CategoryDateTime, "Adds an amount of milliseconds, seconds, minutes, hours, days, weeks, months, or years to a datetime.",
+		[]string{"The datetime", "The amount, negative to subtract", "The unit, such as \"days\""}, []string{`$.createdAt > dateAdd(now(), -7, "days")`}},
+	"dateDiff": {CategoryDateTime, "Returns the number of whole units from one datetime to another, negative if to is earlier.",
+		[]string{"The start", "The end", "The unit, such as \"days\""}, []string{`dateDiff($.dob, now(), "years") >= 18`}},
+	"dayOfWeek": {CategoryDateTime, "Returns the ISO 8601 day of the week, from 1 for Monday to 7 for Sunday.",
+		[]string{"The datetime"}, []string{`dayOfWeek(now()) <= 5`}},
+	"isBefore": {CategoryDateTime, "Reports whether a datetime is before another.",
+		[]string{"The datetime", "The datetime to compare with"}, []string{`isBefore($.startsAt, $.endsAt)`}},
+	"isAfter": {CategoryDateTime, "Reports whether a datetime is after another.",
+		[]string{"The datetime", "The datetime to compare with"}, []string{`isAfter(now(), $.trialEndsAt)`}},
+	"duration": {CategoryDateTime, "Parses a string such as \"90s\" or \"2h30m\" into a duration. Units are ns, us, ms, s, m, h, and d.",
+		[]string{"The string"}, []string{`duration($.timeout) <= 5m`}},
+	"seconds": {CategoryDateTime, "Returns a duration as a number of seconds.",
+		[]string{"The duration"}, []string{`seconds($.elapsed) < 1.5`}},
+	"minutes": {CategoryDateTime, "Returns a duration as a number of minutes.",
+		[]string{"The duration"}, []string{`minutes(now() - $.lastSeen) > 30`}},
+	"hours": {CategoryDateTime, "Returns a duration as a number of hours.",
+		[]string{"The duration"}, []string{`hours($.endsAt - $.startsAt) <= 8`}},
+	"parseDurationStr": {CategoryDateTime, "Parses a duration written by people or other systems, such as \"2h 45m\", \"1 day 6 hours\", or the ISO 8601 \"PT2H45M\".",
+		[]string{"The string"}, []string{`parseDurationStr($.retention) >= 7d`}},
+
+	// Data size functions
+	"parseBytes": {CategoryConversion, "Parses a data size such as \"512MB\", \"1.5GiB\", or \"100Mi\" into a number of bytes. Units with i are binary.",
+		[]string{"The size"}, []string{`parseBytes($.limits.memory) <= parseBytes("4Gi")`}},
+	"formatBytes": {CategoryConversion, "Formats a number of bytes with binary units, such as \"1.5 GiB\".",
+		[]string{"The number of bytes"}, []string{`formatBytes($.usage)`}},
+}
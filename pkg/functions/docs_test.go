@@ -0,0 +1,93 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryDescribe(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	doc, ok := r.Describe("substr")
+	require.True(t, ok)
+	assert.Equal(t, CategoryString, doc.Category)
+	assert.Equal(t, "builtin", doc.Kind)
+	assert.NotEmpty(t, doc.Description)
+	assert.NotEmpty(t, doc.Examples)
+	require.Len(t, doc.Overloads, 1)
+	assert.Equal(t, "substr(str: string, start: int, length: int): string", doc.Overloads[0].Signature)
+	assert.Equal(t, "Zero-based start index", doc.Overloads[0].Parameters[1].Description)
+
+	_, ok = r.Describe("nope")
+	assert.False(t, ok)
+}
+
+func TestRegistryDescribeOverloadsAndJS(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.RegisterOverload(&Function{
+		Name: "size",
+		Signature: types.NewFunctionSignature("size", types.TypeInt, types.DescribedParam("s", types.TypeString, "A string")).
+			WithDescription("Returns the size of a value.").WithCategory("custom").WithExamples(`size("ab") == 2`),
+		BuiltIn: builtinLen,
+	}))
+	require.NoError(t, r.RegisterOverload(&Function{
+		Name:      "size",
+		Signature: types.NewFunctionSignature("size", types.TypeInt, types.Param("l", types.TypeList)).WithDescription("Counts list elements."),
+		BuiltIn:   builtinLen,
+	}))
+	require.NoError(t, r.RegisterJSFunction(`function double(x) { return x * 2; }`, NewSandbox(nil)))
+
+	doc, ok := r.Describe("size")
+	require.True(t, ok)
+	assert.Equal(t, "Returns the size of a value.", doc.Description)
+	assert.Equal(t, "custom", doc.Category)
+	require.Len(t, doc.Overloads, 2)
+	assert.Empty(t, doc.Overloads[0].Description)
+	assert.Equal(t, "Counts list elements.", doc.Overloads[1].Description)
+
+	doc, ok = r.Describe("double")
+	require.True(t, ok)
+	assert.Equal(t, "js", doc.Kind)
+	assert.Equal(t, CategoryUser, doc.Category)
+
+	catalog := r.Catalog()
+	require.Len(t, catalog, 2)
+	assert.Equal(t, "size", catalog[0].Name)
+	assert.Equal(t, "double", catalog[1].Name)
+}
+
+func TestBuiltinDocs(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	catalog := r.Catalog()
+	require.Len(t, catalog, r.CountUnique())
+	assert.True(t, sort.SliceIsSorted(catalog, func(i, j int) bool {
+		if catalog[i].Category != catalog[j].Category {
+			return catalog[i].Category < catalog[j].Category
+		}
+		return catalog[i].Name < catalog[j].Name
+	}))
+
+	for _, doc := range catalog {
+		assert.NotEmpty(t, doc.Description, doc.Name)
+		assert.NotEmpty(t, doc.Category, doc.Name)
+		for _, p := range doc.Overloads[0].Parameters {
+			assert.NotEmpty(t, p.Description, "%s(%s)", doc.Name, p.Name)
+		}
+		for _, example := range doc.Examples {
+			_, err := parser.Parse(example)
+			assert.NoError(t, err, "%s: %s", doc.Name, example)
+		}
+	}
+	for name := range builtinDocs {
+		assert.True(t, r.Has(name), "documented function %s is not registered", name)
+	}
+}
@@ -0,0 +1,185 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// ExternalFunc is the signature for functions backed by a network call or
+// another slow resource, such as an HTTP, gRPC, or database lookup. ctx is
+// done when the call times out or the evaluation is over.
+type ExternalFunc func(ctx context.Context, args ...types.Value) (types.Value, error)
+
+// ExternalOption configures an external function.
+type ExternalOption func(*externalFunction)
+
+// WithCallTimeout limits each attempt of an external call. Zero, the
+// default, only bounds the call by the evaluation timeout.
+func WithCallTimeout(d time.Duration) ExternalOption {
+	return func(f *externalFunction) {
+		f.timeout = d
+	}
+}
+
+// WithRetries retries a failed external call up to n times, waiting backoff
+// between attempts. Calls are not retried once the evaluation is over.
+func WithRetries(n int, backoff time.Duration) ExternalOption {
+	return func(f *externalFunction) {
+		f.retries = n
+		f.backoff = backoff
+	}
+}
+
+// WithCircuitBreaker stops calling the function for cooldown after failures
+// consecutive failed calls; calls in that period fail immediately with
+// ErrCircuitOpen. After the cooldown the next call goes through and closes
+// the circuit if it succeeds.
+func WithCircuitBreaker(failures int, cooldown time.Duration) ExternalOption {
+	return func(f *externalFunction) {
+		f.breakerFailures = failures
+		f.breakerCooldown = cooldown
+	}
+}
+
+// externalFunction wraps an ExternalFunc with timeouts, retries, and a
+// circuit breaker. The breaker state is shared by every evaluation.
+type externalFunction struct {
+	name            string
+	fn              ExternalFunc
+	timeout         time.Duration
+	retries         int
+	backoff         time.Duration
+	breakerFailures int
+	breakerCooldown time.Duration
+
+	mu        sync.Mutex
+	failures  int       // Consecutive failed calls
+	openUntil time.Time // Calls fail fast until then
+}
+
+// RegisterExternal registers a function backed by a network call or another
+// slow resource. Each call runs with the configured timeout, retries, and
+// circuit breaker. A failed call returns an error with code ErrExternalCall,
+// which tryCatch can recover from; if the evaluation times out the error has
+// code ErrTimeout. Errors with an AMEL error code returned by fn, such as
+// ErrArgumentType, are returned unchanged and the call is not retried.
+// External functions are not pure.
+func (r *Registry) RegisterExternal(name string, fn ExternalFunc, sig *types.FunctionSignature, opts ...ExternalOption) error {
+	if fn == nil {
+		return errors.New(errors.ErrInvalidSyntax, "cannot register nil function")
+	}
+
+	ext := &externalFunction{name: name, fn: fn}
+	for _, opt := range opts {
+		opt(ext)
+	}
+	return r.RegisterContextual(name, ext.call, sig)
+}
+
+// call is the ContextFunc of the external function.
+func (f *externalFunction) call(ctx context.Context, _ EvalContext, args ...types.Value) (types.Value, error) {
+	if err := f.allow(); err != nil {
+		return types.Null(), err
+	}
+
+	var (
+		value types.Value
+		err   error
+	)
+	for attempt := 0; attempt <= f.retries; attempt++ {
+		if attempt > 0 && f.backoff > 0 {
+			timer := time.NewTimer(f.backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		value, err = f.attempt(ctx, args)
+		if err == nil {
+			f.record(true)
+			return value, nil
+		}
+		if _, ok := err.(*errors.Error); ok {
+			// The call was rejected, not failed: do not retry
+			return types.Null(), err
+		}
+	}
+
+	f.record(false)
+	if ctx.Err() != nil {
+		return types.Null(), errors.New(errors.ErrTimeout, "evaluation timed out")
+	}
+	return types.Null(), errors.Wrap(errors.ErrExternalCall,
+		fmt.Sprintf("external function '%s' failed: %v", f.name, err), err)
+}
+
+// attempt makes one call. The call runs in its own goroutine so that a
+// function ignoring its context cannot hold up the evaluation past the
+// timeout.
+func (f *externalFunction) attempt(ctx context.Context, args []types.Value) (types.Value, error) {
+	cancel := context.CancelFunc(func() {})
+	if f.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+	}
+	defer cancel()
+
+	type result struct {
+		value types.Value
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- result{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+		value, err := f.fn(ctx, args...)
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		return types.Null(), fmt.Errorf("call timed out after %s", f.timeout)
+	}
+}
+
+// allow returns an error if the circuit is open.
+func (f *externalFunction) allow() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Now().Before(f.openUntil) {
+		return errors.Newf(errors.ErrCircuitOpen,
+			"external function '%s' is unavailable after %d consecutive failures", f.name, f.failures)
+	}
+	return nil
+}
+
+// record updates the circuit breaker with the outcome of a call.
+func (f *externalFunction) record(ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if ok {
+		f.failures = 0
+		return
+	}
+	f.failures++
+	if f.breakerFailures > 0 && f.failures >= f.breakerFailures {
+		f.openUntil = time.Now().Add(f.breakerCooldown)
+	}
+}
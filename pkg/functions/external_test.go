@@ -0,0 +1,115 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubEvalContext is an empty evaluation context.
+type stubEvalContext struct{}
+
+func (stubEvalContext) Lookup(string) types.Value           { return types.Null() }
+func (stubEvalContext) Variable(string) (types.Value, bool) { return types.Null(), false }
+
+func callExternal(t *testing.T, r *Registry, ctx context.Context, name string) (types.Value, error) {
+	t.Helper()
+	return r.CallContext(ctx, stubEvalContext{}, name, types.String("u1"))
+}
+
+func TestRegisterExternal(t *testing.T) {
+	sig := types.NewFunctionSignature("riskScore", types.TypeFloat, types.Param("userId", types.TypeString))
+
+	t.Run("success", func(t *testing.T) {
+		r := NewRegistry()
+		require.NoError(t, r.RegisterExternal("riskScore", func(ctx context.Context, args ...types.Value) (types.Value, error) {
+			return types.Float(0.7), nil
+		}, sig))
+
+		fn, ok := r.Get("riskScore")
+		require.True(t, ok)
+		assert.False(t, fn.Pure)
+
+		result, err := callExternal(t, r, context.Background(), "riskScore")
+		require.NoError(t, err)
+		assert.Equal(t, 0.7, result.Raw)
+	})
+
+	t.Run("call timeout", func(t *testing.T) {
+		r := NewRegistry()
+		require.NoError(t, r.RegisterExternal("riskScore", func(ctx context.Context, args ...types.Value) (types.Value, error) {
+			time.Sleep(time.Second) // ignores ctx
+			return types.Float(0.7), nil
+		}, sig, WithCallTimeout(10*time.Millisecond)))
+
+		start := time.Now()
+		_, err := callExternal(t, r, context.Background(), "riskScore")
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrExternalCall), err.Error())
+		assert.Less(t, time.Since(start), 500*time.Millisecond)
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		var calls atomic.Int32
+		r := NewRegistry()
+		require.NoError(t, r.RegisterExternal("riskScore", func(ctx context.Context, args ...types.Value) (types.Value, error) {
+			if calls.Add(1) < 3 {
+				return types.Null(), fmt.Errorf("unavailable")
+			}
+			return types.Float(0.7), nil
+		}, sig, WithRetries(2, time.Millisecond)))
+
+		result, err := callExternal(t, r, context.Background(), "riskScore")
+		require.NoError(t, err)
+		assert.Equal(t, 0.7, result.Raw)
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("circuit breaker", func(t *testing.T) {
+		var calls atomic.Int32
+		var healthy atomic.Bool
+		r := NewRegistry()
+		require.NoError(t, r.RegisterExternal("riskScore", func(ctx context.Context, args ...types.Value) (types.Value, error) {
+			calls.Add(1)
+			if !healthy.Load() {
+				return types.Null(), fmt.Errorf("unavailable")
+			}
+			return types.Float(0.7), nil
+		}, sig, WithCircuitBreaker(2, 50*time.Millisecond)))
+
+		for i := 0; i < 2; i++ {
+			_, err := callExternal(t, r, context.Background(), "riskScore")
+			assert.True(t, errors.IsCode(err, errors.ErrExternalCall))
+		}
+
+		_, err := callExternal(t, r, context.Background(), "riskScore")
+		assert.True(t, errors.IsCode(err, errors.ErrCircuitOpen))
+		assert.Equal(t, int32(2), calls.Load())
+
+		healthy.Store(true)
+		time.Sleep(60 * time.Millisecond)
+		_, err = callExternal(t, r, context.Background(), "riskScore")
+		require.NoError(t, err)
+	})
+
+	t.Run("evaluation timeout", func(t *testing.T) {
+		r := NewRegistry()
+		require.NoError(t, r.RegisterExternal("riskScore", func(ctx context.Context, args ...types.Value) (types.Value, error) {
+			<-ctx.Done()
+			return types.Null(), ctx.Err()
+		}, sig, WithRetries(5, 0)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := callExternal(t, r, ctx, "riskScore")
+		assert.True(t, errors.IsCode(err, errors.ErrTimeout), err.Error())
+	})
+}
@@ -0,0 +1,274 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// HTTPGetJSONName is the name of the HTTP fetch builtin.
+const HTTPGetJSONName = "httpGetJSON"
+
+const (
+	defaultHTTPMaxBytes = 1 << 20 // 1MB
+	defaultHTTPTimeout  = time.Second
+	maxHTTPCacheEntries = 1024
+	maxHTTPRedirects    = 3
+)
+
+// HTTPConfig configures the httpGetJSON builtin.
+type HTTPConfig struct {
+	// AllowedHosts lists the hosts that may be fetched, such as
+	// "config.example.com" or "config.example.com:8443". An entry starting
+	// with "*." matches any subdomain. A URL with a port only matches an
+	// entry with the same port. Nothing can be fetched if the list is empty.
+	AllowedHosts []string
+	// MaxBytes limits the size of a response body. Defaults to 1MB.
+	MaxBytes int64
+	// Timeout limits each request. Defaults to 1s. Requests are also bounded
+	// by the evaluation timeout.
+	Timeout time.Duration
+	// CacheTTL is how long a successful response is reused. Zero disables
+	// caching.
+	CacheTTL time.Duration
+	// Client sends the requests. Defaults to a client without cookies.
+	// Redirects are always checked against AllowedHosts.
+	Client *http.Client
+}
+
+// httpFetcher implements httpGetJSON.
+type httpFetcher struct {
+	config HTTPConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]httpCacheEntry
+}
+
+type httpCacheEntry struct {
+	value   types.Value
+	expires time.Time
+}
+
+// RegisterHTTPGetJSON registers httpGetJSON(url), which fetches a JSON
+// document with an HTTP GET request and returns it as a value. Only http and
+// https URLs on an allowed host can be fetched, including after redirects;
+// anything else fails with ErrFunctionDenied. Responses that fail, are not
+// JSON, or exceed MaxBytes fail with ErrExternalCall.
+func RegisterHTTPGetJSON(r *Registry, config HTTPConfig) error {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = defaultHTTPMaxBytes
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHTTPTimeout
+	}
+	config.AllowedHosts = append([]string{}, config.AllowedHosts...)
+
+	f := &httpFetcher{
+		config: config,
+		cache:  make(map[string]httpCacheEntry),
+	}
+
+	client := http.Client{}
+	if config.Client != nil {
+		client = *config.Client
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxHTTPRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxHTTPRedirects)
+		}
+		return f.check(req.URL)
+	}
+	f.client = &client
+
+	sig := types.NewFunctionSignature(HTTPGetJSONName, types.TypeAny,
+		types.DescribedParam("url", types.TypeString, "An http or https URL on an allowed host")).
+		WithCategory(CategoryUtility).
+		WithDescription("Fetches a JSON document with an HTTP GET request. Only allowed hosts can be fetched.").
+		WithExamples(`httpGetJSON("https://config.example.com/flags.json").checkout == true`)
+	return r.RegisterExternal(HTTPGetJSONName, f.get, sig, WithCallTimeout(config.Timeout))
+}
+
+// get fetches a URL, serving it from the cache when possible.
+func (f *httpFetcher) get(ctx context.Context, args ...types.Value) (types.Value, error) {
+	raw, ok := args[0].AsString()
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrArgumentType, "%s requires a string URL", HTTPGetJSONName)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return types.Null(), errors.Wrap(errors.ErrFunctionDenied, fmt.Sprintf("invalid URL %q", raw), err)
+	}
+	if err := f.check(u); err != nil {
+		return types.Null(), err
+	}
+
+	key := u.String()
+	if value, ok := f.cached(key); ok {
+		return value, nil
+	}
+
+	value, err := f.fetch(ctx, key)
+	if err != nil {
+		return types.Null(), err
+	}
+	f.store(key, value)
+	return value, nil
+}
+
+// check returns an error unless u may be fetched.
+func (f *httpFetcher) check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.Newf(errors.ErrFunctionDenied, "URL scheme '%s' is not allowed", u.Scheme)
+	}
+	if u.User != nil {
+		return errors.New(errors.ErrFunctionDenied, "URLs with credentials are not allowed")
+	}
+	if !hostAllowed(u, f.config.AllowedHosts) {
+		return errors.Newf(errors.ErrFunctionDenied, "host '%s' is not allowed", u.Host)
+	}
+	return nil
+}
+
+// hostAllowed reports whether the host of u matches an entry of allowed.
+func hostAllowed(u *url.URL, allowed []string) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if host == "" {
+		return false
+	}
+
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		entryHost, entryPort, err := net.SplitHostPort(entry)
+		if err != nil {
+			entryHost, entryPort = entry, ""
+		}
+		if entryPort != port {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(entryHost, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == entryHost {
+			return true
+		}
+	}
+	return false
+}
+
+// fetch sends the request and decodes the response.
+func (f *httpFetcher) fetch(ctx context.Context, rawURL string) (types.Value, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return types.Null(), err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// Keep the code of a redirect to a host that is not allowed
+		if urlErr, ok := err.(*url.Error); ok {
+			if amelErr, ok := urlErr.Err.(*errors.Error); ok {
+				return types.Null(), amelErr
+			}
+		}
+		return types.Null(), err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return types.Null(), fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.config.MaxBytes+1))
+	if err != nil {
+		return types.Null(), err
+	}
+	if int64(len(body)) > f.config.MaxBytes {
+		return types.Null(), fmt.Errorf("GET %s: response exceeds %d bytes", rawURL, f.config.MaxBytes)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return types.Null(), fmt.Errorf("GET %s: invalid JSON: %v", rawURL, err)
+	}
+	return jsonToValue(decoded), nil
+}
+
+func (f *httpFetcher) cached(key string) (types.Value, bool) {
+	if f.config.CacheTTL <= 0 {
+		return types.Null(), false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	entry, ok := f.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return types.Null(), false
+	}
+	return entry.value, true
+}
+
+func (f *httpFetcher) store(key string, value types.Value) {
+	if f.config.CacheTTL <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if len(f.cache) >= maxHTTPCacheEntries {
+		for k, entry := range f.cache {
+			if now.After(entry.expires) {
+				delete(f.cache, k)
+			}
+		}
+	}
+	if len(f.cache) >= maxHTTPCacheEntries {
+		// Still full: drop an arbitrary entry
+		for k := range f.cache {
+			delete(f.cache, k)
+			break
+		}
+	}
+	f.cache[key] = httpCacheEntry{value: value, expires: now.Add(f.config.CacheTTL)}
+}
+
+// jsonToValue converts a decoded JSON document to a value. Whole numbers
+// become integers; objects are kept as maps.
+func jsonToValue(v interface{}) types.Value {
+	switch val := v.(type) {
+	case float64:
+		if val == float64(int64(val)) {
+			return types.Int(int64(val))
+		}
+		return types.Float(val)
+	case []interface{}:
+		elements := make([]types.Value, len(val))
+		for i, elem := range val {
+			elements[i] = jsonToValue(elem)
+		}
+		return types.List(elements...)
+	case map[string]interface{}:
+		return types.Any(val)
+	default:
+		return types.NewValue(val)
+	}
+}
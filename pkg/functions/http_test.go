@@ -0,0 +1,126 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPGetJSON(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/flags.json":
+			w.Write([]byte(`{"checkout": true, "limit": 5}`))
+		case "/list.json":
+			w.Write([]byte(`[1, 2.5, "three"]`))
+		case "/large.json":
+			w.Write([]byte(`"` + strings.Repeat("x", 100) + `"`))
+		case "/text":
+			w.Write([]byte("not json"))
+		case "/redirect":
+			http.Redirect(w, r, "http://example.com/flags.json", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	newRegistry := func(config HTTPConfig) *Registry {
+		r := NewRegistry()
+		require.NoError(t, RegisterHTTPGetJSON(r, config))
+		return r
+	}
+	get := func(r *Registry, path string) (types.Value, error) {
+		return r.CallContext(context.Background(), stubEvalContext{}, HTTPGetJSONName, types.String(server.URL+path))
+	}
+
+	r := newRegistry(HTTPConfig{AllowedHosts: []string{host}, MaxBytes: 64})
+
+	t.Run("object", func(t *testing.T) {
+		result, err := get(r, "/flags.json")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"checkout": true, "limit": float64(5)}, result.Raw)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		result, err := get(r, "/list.json")
+		require.NoError(t, err)
+		assert.Equal(t, types.List(types.Int(1), types.Float(2.5), types.String("three")), result)
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		for _, path := range []string{"/large.json", "/text", "/missing"} {
+			_, err := get(r, path)
+			assert.True(t, errors.IsCode(err, errors.ErrExternalCall), "%s: %v", path, err)
+		}
+	})
+
+	t.Run("host not allowed", func(t *testing.T) {
+		denied := newRegistry(HTTPConfig{AllowedHosts: []string{"config.example.com"}})
+		before := requests.Load()
+		_, err := get(denied, "/flags.json")
+		assert.True(t, errors.IsCode(err, errors.ErrFunctionDenied), err)
+		assert.Equal(t, before, requests.Load())
+	})
+
+	t.Run("scheme not allowed", func(t *testing.T) {
+		_, err := r.CallContext(context.Background(), stubEvalContext{}, HTTPGetJSONName, types.String("file:///etc/passwd"))
+		assert.True(t, errors.IsCode(err, errors.ErrFunctionDenied), err)
+	})
+
+	t.Run("redirect to a host not allowed", func(t *testing.T) {
+		_, err := get(r, "/redirect")
+		assert.True(t, errors.IsCode(err, errors.ErrFunctionDenied), err)
+	})
+
+	t.Run("caching", func(t *testing.T) {
+		cached := newRegistry(HTTPConfig{AllowedHosts: []string{host}, CacheTTL: time.Minute})
+		before := requests.Load()
+		for i := 0; i < 3; i++ {
+			_, err := get(cached, "/flags.json")
+			require.NoError(t, err)
+		}
+		assert.Equal(t, before+1, requests.Load())
+	})
+}
+
+func TestHostAllowed(t *testing.T) {
+	allowed := []string{"config.example.com", "*.internal.example.com", "api.example.com:8443"}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://config.example.com/flags.json", true},
+		{"https://CONFIG.example.com/flags.json", true},
+		{"https://config.example.com:8080/flags.json", false},
+		{"https://a.internal.example.com/x", true},
+		{"https://internal.example.com/x", false},
+		{"https://api.example.com:8443/x", true},
+		{"https://api.example.com/x", false},
+		{"https://evil.com/config.example.com", false},
+		{"https://config.example.com.evil.com/", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, hostAllowed(u, allowed))
+		})
+	}
+}
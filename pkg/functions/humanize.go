@@ -0,0 +1,219 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// byteUnits maps the lower-case units of a data size to their number of
+// bytes. Units without "i" are decimal, as in SI and Kubernetes quantities;
+// units with "i" are binary, as in IEC.
+var byteUnits = map[string]int64{
+	"": 1, "b": 1, "byte": 1, "bytes": 1,
+	"k": 1e3, "kb": 1e3, "ki": 1 << 10, "kib": 1 << 10,
+	"m": 1e6, "mb": 1e6, "mi": 1 << 20, "mib": 1 << 20,
+	"g": 1e9, "gb": 1e9, "gi": 1 << 30, "gib": 1 << 30,
+	"t": 1e12, "tb": 1e12, "ti": 1 << 40, "tib": 1 << 40,
+	"p": 1e15, "pb": 1e15, "pi": 1 << 50, "pib": 1 << 50,
+	"e": 1e18, "eb": 1e18, "ei": 1 << 60, "eib": 1 << 60,
+}
+
+// formatByteUnits are the binary units formatBytes writes, smallest first.
+var formatByteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// humanDurationUnits maps the lower-case units parseDurationStr accepts to
+// their length.
+var humanDurationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond, "nanosecond": time.Nanosecond, "nanoseconds": time.Nanosecond,
+	"us": time.Microsecond, "µs": time.Microsecond, "microsecond": time.Microsecond, "microseconds": time.Microsecond,
+	"ms": time.Millisecond, "msec": time.Millisecond, "millisecond": time.Millisecond, "milliseconds": time.Millisecond,
+	"s": time.Second, "sec": time.Second, "secs": time.Second, "second": time.Second, "seconds": time.Second,
+	"m": time.Minute, "min": time.Minute, "mins": time.Minute, "minute": time.Minute, "minutes": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hrs": time.Hour, "hour": time.Hour, "hours": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour, "days": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour, "wk": 7 * 24 * time.Hour, "week": 7 * 24 * time.Hour, "weeks": 7 * 24 * time.Hour,
+}
+
+// builtinParseBytes parses a data size such as "1.5GiB", "512 MB", or "100Mi"
+// into a number of bytes, rounded to a whole byte.
+func builtinParseBytes(args ...types.Value) (types.Value, error) {
+	s, ok := args[0].AsString()
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "parseBytes requires a string, got %s", args[0].Type)
+	}
+
+	number, unit := cutNumber(strings.TrimSpace(s))
+	size, ok := types.ParseDecimal(number)
+	multiplier, known := byteUnits[strings.ToLower(strings.TrimSpace(unit))]
+	if number == "" || !ok || !known {
+		return types.Null(), errors.Newf(errors.ErrArgumentType, "parseBytes: %q is not a size such as \"512MB\" or \"1.5GiB\"", s)
+	}
+
+	bytes := RoundDecimal(size.Mul(size, new(big.Rat).SetInt64(multiplier)), 0)
+	if !bytes.Num().IsInt64() {
+		return types.Null(), errors.Newf(errors.ErrArgumentType, "parseBytes: %q is out of the range of an int", s)
+	}
+	return types.Int(bytes.Num().Int64()), nil
+}
+
+// builtinFormatBytes formats a number of bytes with the largest binary unit
+// that keeps the number at least 1 and at most two fraction digits, such as
+// "1.5 GiB" or "512 B".
+func builtinFormatBytes(args ...types.Value) (types.Value, error) {
+	n, ok := args[0].AsFloat()
+	if !ok || !args[0].Type.IsNumeric() {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "formatBytes requires a number, got %s", args[0].Type)
+	}
+
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	unit := 0
+	for unit < len(formatByteUnits)-1 && n >= 1024 {
+		n /= 1024
+		unit++
+	}
+	n = math.Round(n*100) / 100
+	if n >= 1024 && unit < len(formatByteUnits)-1 {
+		// 1023.999 KiB rounds up to the next unit
+		n, unit = math.Round(n/1024*100)/100, unit+1
+	}
+	return types.String(sign + strconv.FormatFloat(n, 'f', -1, 64) + " " + formatByteUnits[unit]), nil
+}
+
+// builtinParseDurationStr parses a duration written by people or by other
+// systems: everything duration accepts, plus spaces and long unit names, as in
+// "2h 45m" or "1 day 6 hours", weeks, and ISO 8601 durations such as
+// "PT2H45M" or "P1DT12H".
+func builtinParseDurationStr(args ...types.Value) (types.Value, error) {
+	s, ok := args[0].AsString()
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "parseDurationStr requires a string, got %s", args[0].Type)
+	}
+	d, ok := parseHumanDuration(s)
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrArgumentType, "parseDurationStr: %q is not a duration such as \"2h45m\", \"1 day 6 hours\", or \"PT2H45M\"", s)
+	}
+	return types.Duration(d), nil
+}
+
+// parseHumanDuration parses the durations parseDurationStr accepts.
+func parseHumanDuration(s string) (time.Duration, bool) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+"))
+	if s == "" {
+		return 0, false
+	}
+
+	var total float64
+	var ok bool
+	if s[0] == 'P' || s[0] == 'p' {
+		total, ok = parseISODuration(strings.ToUpper(s[1:]))
+	} else {
+		total, ok = parseDurationWords(strings.ToLower(s))
+	}
+	if !ok || total >= math.MaxInt64 {
+		return 0, false
+	}
+	if neg {
+		total = -total
+	}
+	return time.Duration(math.Round(total)), true
+}
+
+// parseDurationWords sums the amounts and units of a duration such as
+// "2h45m" or "1 day, 6 hours and 30 minutes", in lower case.
+func parseDurationWords(s string) (float64, bool) {
+	var total float64
+	parts := 0
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if strings.HasPrefix(s, "and ") && parts > 0 {
+			s = strings.TrimLeft(s[len("and "):], " ")
+		}
+		if s == "" {
+			return total, parts > 0
+		}
+
+		number, rest := cutNumber(s)
+		amount, err := strconv.ParseFloat(number, 64)
+		if number == "" || err != nil {
+			return 0, false
+		}
+		rest = strings.TrimLeft(rest, " ")
+		end := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsLetter(r) })
+		if end < 0 {
+			end = len(rest)
+		}
+		unit, ok := humanDurationUnits[rest[:end]]
+		if !ok {
+			return 0, false
+		}
+		total += amount * float64(unit)
+		s = rest[end:]
+		parts++
+	}
+}
+
+// parseISODuration parses an ISO 8601 duration after the leading "P", in
+// upper case. Years and months have no fixed length and are rejected.
+func parseISODuration(s string) (float64, bool) {
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+	timeUnits := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+
+	var total float64
+	parts := 0
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' && !inTime {
+			inTime = true
+			s = s[1:]
+			if s == "" {
+				return 0, false
+			}
+			continue
+		}
+		number, rest := cutNumber(s)
+		amount, err := strconv.ParseFloat(number, 64)
+		if number == "" || err != nil || rest == "" {
+			return 0, false
+		}
+		unit, ok := units[rest[0]]
+		if inTime {
+			unit, ok = timeUnits[rest[0]]
+		}
+		if !ok {
+			return 0, false
+		}
+		total += amount * float64(unit)
+		s = rest[1:]
+		parts++
+	}
+	return total, parts > 0
+}
+
+// cutNumber cuts an unsigned decimal number, such as "12" or "1.5", from the
+// start of s.
+func cutNumber(s string) (number, rest string) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i > 0 && i+1 < len(s) && s[i] == '.' && s[i+1] >= '0' && s[i+1] <= '9' {
+		i++
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,106 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBytes(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"512", 512},
+		{"512B", 512},
+		{"1.5GiB", 1610612736},
+		{"1.5 GB", 1500000000},
+		{"100Mi", 104857600},
+		{"2k", 2000},
+		{"4 kib", 4096},
+		{"1.5 bytes", 2},
+		{" 8EiB ", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := r.Call("parseBytes", types.String(tt.input))
+			if tt.want < 0 {
+				assert.ErrorContains(t, err, "out of the range")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, types.Int(tt.want), result)
+		})
+	}
+
+	for _, input := range []string{"", "GB", "1.5 XB", "-1KB", "1.2.3MB"} {
+		_, err := r.Call("parseBytes", types.String(input))
+		assert.ErrorContains(t, err, "is not a size", input)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	tests := []struct {
+		input types.Value
+		want  string
+	}{
+		{types.Int(0), "0 B"},
+		{types.Int(1023), "1023 B"},
+		{types.Int(1536), "1.5 KiB"},
+		{types.Int(1610612736), "1.5 GiB"},
+		{types.Int(1500000000), "1.4 GiB"},
+		{types.Int(1048575), "1 MiB"},
+		{types.Int(-2048), "-2 KiB"},
+		{types.Float(1536.0), "1.5 KiB"},
+	}
+	for _, tt := range tests {
+		result, err := r.Call("formatBytes", tt.input)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, result.Raw, tt.input.Raw)
+	}
+}
+
+func TestParseDurationStr(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"2h45m", 2*time.Hour + 45*time.Minute},
+		{"2h 45m", 2*time.Hour + 45*time.Minute},
+		{"1 day 6 hours", 30 * time.Hour},
+		{"1 day, 6 hours and 30 minutes", 30*time.Hour + 30*time.Minute},
+		{"1.5 hrs", 90 * time.Minute},
+		{"2w", 14 * 24 * time.Hour},
+		{"-90s", -90 * time.Second},
+		{"250ms", 250 * time.Millisecond},
+		{"PT2H45M", 2*time.Hour + 45*time.Minute},
+		{"P1DT12H", 36 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"PT0.5S", 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := r.Call("parseDurationStr", types.String(tt.input))
+			require.NoError(t, err)
+			assert.Equal(t, types.Duration(tt.want), result)
+		})
+	}
+
+	for _, input := range []string{"", "5", "and 5m", "2 fortnights", "P1Y", "P1M", "PT", "P", "PT5H3"} {
+		_, err := r.Call("parseDurationStr", types.String(input))
+		assert.ErrorContains(t, err, "is not a duration", input)
+	}
+}
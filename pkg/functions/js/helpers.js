@@ -0,0 +1,147 @@
+// @amel/helpers: small, dependency-free helpers for AMEL JavaScript functions.
+// Every helper is pure; none of them mutates its arguments.
+
+"use strict";
+
+function iteratee(fn) {
+  if (typeof fn === "function") return fn;
+  if (fn === undefined || fn === null) return (x) => x;
+  return (x) => get(x, fn);
+}
+
+function toPath(path) {
+  if (Array.isArray(path)) return path;
+  return String(path).replace(/\[(\d+)\]/g, ".$1").split(".").filter((p) => p !== "");
+}
+
+// get returns the value at a dotted path like "a.b[0].c", or def if missing.
+function get(obj, path, def) {
+  let cur = obj;
+  for (const key of toPath(path)) {
+    if (cur === null || cur === undefined) return def;
+    cur = cur[key];
+  }
+  return cur === undefined ? def : cur;
+}
+
+// has reports whether obj has a value at path.
+function has(obj, path) {
+  const marker = {};
+  return get(obj, path, marker) !== marker;
+}
+
+function pick(obj, keys) {
+  const out = {};
+  for (const key of keys) {
+    if (obj !== null && obj !== undefined && Object.prototype.hasOwnProperty.call(obj, key)) out[key] = obj[key];
+  }
+  return out;
+}
+
+function omit(obj, keys) {
+  const out = Object.assign({}, obj);
+  for (const key of keys) delete out[key];
+  return out;
+}
+
+function groupBy(list, fn) {
+  const key = iteratee(fn);
+  const out = {};
+  for (const item of list || []) {
+    const k = key(item);
+    (out[k] = out[k] || []).push(item);
+  }
+  return out;
+}
+
+function keyBy(list, fn) {
+  const key = iteratee(fn);
+  const out = {};
+  for (const item of list || []) out[key(item)] = item;
+  return out;
+}
+
+function countBy(list, fn) {
+  const key = iteratee(fn);
+  const out = {};
+  for (const item of list || []) {
+    const k = key(item);
+    out[k] = (out[k] || 0) + 1;
+  }
+  return out;
+}
+
+function uniq(list) {
+  return Array.from(new Set(list || []));
+}
+
+function uniqBy(list, fn) {
+  const key = iteratee(fn);
+  const seen = new Set();
+  return (list || []).filter((item) => {
+    const k = key(item);
+    if (seen.has(k)) return false;
+    seen.add(k);
+    return true;
+  });
+}
+
+function sortBy(list, fn) {
+  const key = iteratee(fn);
+  return (list || [])
+    .map((item, index) => ({ item, index, k: key(item) }))
+    .sort((a, b) => (a.k < b.k ? -1 : a.k > b.k ? 1 : a.index - b.index))
+    .map((entry) => entry.item);
+}
+
+function chunk(list, size) {
+  const out = [];
+  const n = Math.max(1, Math.floor(size) || 1);
+  for (let i = 0; i < (list || []).length; i += n) out.push(list.slice(i, i + n));
+  return out;
+}
+
+function flatten(list, depth) {
+  return (list || []).flat(depth === undefined ? 1 : depth);
+}
+
+function sumBy(list, fn) {
+  const value = iteratee(fn);
+  return (list || []).reduce((total, item) => total + Number(value(item) || 0), 0);
+}
+
+function sum(list) {
+  return sumBy(list);
+}
+
+function mean(list) {
+  return list && list.length ? sum(list) / list.length : NaN;
+}
+
+function clamp(n, lower, upper) {
+  return Math.min(Math.max(n, lower), upper);
+}
+
+function range(start, end, step) {
+  if (end === undefined) {
+    end = start;
+    start = 0;
+  }
+  step = step || (start <= end ? 1 : -1);
+  const out = [];
+  for (let i = start; step > 0 ? i < end : i > end; i += step) out.push(i);
+  return out;
+}
+
+function isEmpty(value) {
+  if (value === null || value === undefined) return true;
+  if (typeof value === "string" || Array.isArray(value)) return value.length === 0;
+  if (typeof value === "object") return Object.keys(value).length === 0;
+  return false;
+}
+
+module.exports = Object.freeze({
+  get, has, pick, omit,
+  groupBy, keyBy, countBy, uniq, uniqBy, sortBy, chunk, flatten,
+  sum, sumBy, mean, clamp, range, isEmpty,
+});
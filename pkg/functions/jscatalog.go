@@ -0,0 +1,104 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"sort"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// JSCatalogVersion is the version of the catalog format written by
+// ExportJSFunctions. ImportJSFunctions rejects other versions.
+const JSCatalogVersion = 1
+
+// JSCatalog is a portable list of user-defined JavaScript functions, for
+// backing up the functions of a registry and replicating them to another.
+// It encodes to JSON.
+type JSCatalog struct {
+	Version   int             `json:"version"`
+	Functions []JSFunctionDef `json:"functions"`
+}
+
+// JSFunctionDef is a JavaScript function in a catalog. The name, parameters,
+// and return type are those declared by the source; they are recorded for
+// readers of the catalog and checked against the source on import.
+type JSFunctionDef struct {
+	Name       string   `json:"name"`
+	Params     []string `json:"params"`
+	ReturnType string   `json:"returnType"`
+	Source     string   `json:"source"`
+}
+
+// ExportJSFunctions returns the JavaScript functions of the registry, sorted
+// by name.
+func (r *Registry) ExportJSFunctions() JSCatalog {
+	catalog := JSCatalog{Version: JSCatalogVersion, Functions: []JSFunctionDef{}}
+	for _, name := range r.List() {
+		for _, fn := range r.ListOverloads(name) {
+			if !fn.IsJS() {
+				continue
+			}
+			def := JSFunctionDef{Name: fn.Name, Params: []string{}, ReturnType: types.TypeAny.String(), Source: fn.JSBody}
+			if fn.Signature != nil {
+				for _, param := range fn.Signature.Parameters {
+					def.Params = append(def.Params, param.Name)
+				}
+				def.ReturnType = fn.Signature.ReturnType.String()
+			}
+			catalog.Functions = append(catalog.Functions, def)
+		}
+	}
+
+	sort.SliceStable(catalog.Functions, func(i, j int) bool {
+		return catalog.Functions[i].Name < catalog.Functions[j].Name
+	})
+	return catalog
+}
+
+// ImportJSFunctions registers the functions of a catalog. A function that is
+// already registered with the same source is skipped, so importing a catalog
+// twice is harmless. Either every function is registered or, if one is
+// invalid or its name is taken by a different function, none is.
+func (r *Registry) ImportJSFunctions(catalog JSCatalog) error {
+	if catalog.Version != JSCatalogVersion {
+		return errors.Newf(errors.ErrInvalidSyntax,
+			"unsupported JS function catalog version %d (expected %d)", catalog.Version, JSCatalogVersion)
+	}
+
+	fns := make([]*Function, 0, len(catalog.Functions))
+	for _, def := range catalog.Functions {
+		fn, err := newJSFunction(def.Source)
+		if err != nil {
+			return errors.Wrap(errors.ErrInvalidSyntax, "function '"+def.Name+"': "+err.Error(), err)
+		}
+		if err := def.check(fn); err != nil {
+			return err
+		}
+
+		if existing, ok := r.Get(fn.Name); ok {
+			if existing.IsJS() && existing.JSBody == fn.JSBody {
+				continue
+			}
+			return errors.Newf(errors.ErrInvalidSyntax, "function '%s' is already registered", fn.Name)
+		}
+		fns = append(fns, fn)
+	}
+
+	return r.RegisterAll(fns...)
+}
+
+// check returns an error if the definition does not match the function
+// declared by its source.
+func (def JSFunctionDef) check(fn *Function) error {
+	mismatch := def.Name != fn.Name || def.ReturnType != fn.Signature.ReturnType.String() ||
+		len(def.Params) != len(fn.Signature.Parameters)
+	for i := 0; !mismatch && i < len(def.Params); i++ {
+		mismatch = def.Params[i] != fn.Signature.Parameters[i].Name
+	}
+	if mismatch {
+		return errors.Newf(errors.ErrInvalidSyntax, "function '%s' does not match its source, which declares %s",
+			def.Name, fn.Signature.String())
+	}
+	return nil
+}
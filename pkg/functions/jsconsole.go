@@ -0,0 +1,76 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/dop251/goja"
+)
+
+// MaxConsoleMessage is the maximum length in bytes of a console message;
+// longer messages are truncated.
+const MaxConsoleMessage = 1024
+
+// ConsoleEntry is a message written with console.log, console.warn, or
+// another console method by JavaScript code in the sandbox.
+type ConsoleEntry struct {
+	Function string `json:"function,omitempty"` // JS function that wrote the message; empty for expressions
+	Level    string `json:"level"`              // log, info, warn, error, or debug
+	Message  string `json:"message"`
+}
+
+// ConsoleFunc receives console output from the sandbox. It is called on the
+// goroutine running the JavaScript code.
+type ConsoleFunc func(entry ConsoleEntry)
+
+type consoleKey struct{}
+
+// WithConsole returns a context that sends the console output of JavaScript
+// executed with it to fn. Without one, console output is discarded.
+func WithConsole(ctx context.Context, fn ConsoleFunc) context.Context {
+	return context.WithValue(ctx, consoleKey{}, fn)
+}
+
+// consoleFrom returns the console function of a context, or nil.
+func consoleFrom(ctx context.Context) ConsoleFunc {
+	fn, _ := ctx.Value(consoleKey{}).(ConsoleFunc)
+	return fn
+}
+
+// installConsole sets the console object of a VM. Its methods write to the
+// console function of the execution running in the VM.
+func installConsole(v *sandboxVM) {
+	console := v.vm.NewObject()
+	for _, level := range []string{"log", "info", "warn", "error", "debug"} {
+		level := level
+		_ = console.Set(level, func(call goja.FunctionCall) goja.Value {
+			if v.console != nil {
+				v.console(ConsoleEntry{Function: v.function, Level: level, Message: formatConsole(call.Arguments)})
+			}
+			return goja.Undefined()
+		})
+	}
+	_ = v.vm.Set("console", console)
+}
+
+// formatConsole joins console arguments with spaces like browsers do:
+// strings as they are and other values as JSON where possible.
+func formatConsole(args []goja.Value) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.String()
+		if _, ok := arg.(*goja.Object); ok {
+			if data, err := json.Marshal(arg.Export()); err == nil {
+				parts[i] = string(data)
+			}
+		}
+	}
+
+	message := strings.Join(parts, " ")
+	if len(message) > MaxConsoleMessage {
+		message = strings.ToValidUTF8(message[:MaxConsoleMessage], "") + "..."
+	}
+	return message
+}
@@ -0,0 +1,48 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"runtime/metrics"
+	"time"
+)
+
+// memoryCheckInterval is how often a running script execution is checked
+// against the memory limit.
+const memoryCheckInterval = 5 * time.Millisecond
+
+const heapLiveMetric = "/gc/heap/live:bytes"
+
+// memoryInterrupt is the value a VM is interrupted with when an execution
+// exceeds the memory limit.
+type memoryInterrupt struct {
+	limit int64
+}
+
+// heapMeter measures the growth of the live heap during a script execution.
+// Neither goja nor gopher-lua account memory per runtime, so the meter reads
+// the live heap of the process as of the last garbage collection, which the
+// Go runtime runs on its own as the heap grows; the meter never forces one.
+// Memory retained by other goroutines at the same time counts against the
+// execution, which is why memory limits are off unless configured.
+type heapMeter struct {
+	limit int64
+	live  uint64 // Live heap when the execution started
+}
+
+// newHeapMeter starts measuring heap growth against a limit in bytes.
+func newHeapMeter(limit int64) *heapMeter {
+	return &heapMeter{limit: limit, live: readLiveHeap()}
+}
+
+// exceeded reports whether the live heap grew by more than the limit.
+func (m *heapMeter) exceeded() bool {
+	live := readLiveHeap()
+	return live > m.live && live-m.live > uint64(m.limit)
+}
+
+// readLiveHeap returns the live heap as of the last garbage collection.
+func readLiveHeap() uint64 {
+	samples := []metrics.Sample{{Name: heapLiveMetric}}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64()
+}
@@ -0,0 +1,183 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	_ "embed"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/dop251/goja"
+)
+
+// BundledModulePrefix is the prefix of the modules bundled with the sandbox.
+// Names with this prefix cannot be registered.
+const BundledModulePrefix = "@amel/"
+
+// helpersJS is the source of the bundled @amel/helpers module.
+//
+//go:embed js/helpers.js
+var helpersJS string
+
+// bundledModules holds the modules every sandbox provides.
+var bundledModules = map[string]*jsModule{
+	BundledModulePrefix + "helpers": mustCompileModule(BundledModulePrefix+"helpers", helpersJS),
+}
+
+// moduleNamePattern matches valid module names, optionally scoped like
+// npm packages.
+var moduleNamePattern = regexp.MustCompile(`^(@[a-z0-9][a-z0-9_.-]*/)?[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// jsModule is a compiled JavaScript module.
+type jsModule struct {
+	name    string
+	source  string
+	program *goja.Program // Evaluates to a function(module, exports, require)
+}
+
+// moduleInstance is a module loaded into a VM.
+type moduleInstance struct {
+	object *goja.Object // The module object, whose exports property require returns
+}
+
+// compileModule compiles a CommonJS style module: the source assigns what it
+// exports to module.exports or adds properties to exports.
+func compileModule(name, source string) (*jsModule, error) {
+	wrapped := "(function (module, exports, require) {\n" + source + "\n})"
+	program, err := goja.Compile(name, wrapped, false)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "invalid JS module '"+name+"': "+err.Error(), err)
+	}
+	return &jsModule{name: name, source: source, program: program}, nil
+}
+
+// mustCompileModule compiles a bundled module and panics if it is invalid.
+func mustCompileModule(name, source string) *jsModule {
+	module, err := compileModule(name, source)
+	if err != nil {
+		panic(err)
+	}
+	return module
+}
+
+// RegisterModule registers a JavaScript module that functions can load with
+// require(name). The source is a CommonJS style module, for example:
+//
+//	module.exports = { round2: x => Math.round(x * 100) / 100 };
+//
+// Registering a name again replaces the module for later calls. Modules are
+// evaluated once per VM, the first time a function requires them.
+func (s *Sandbox) RegisterModule(name, source string) error {
+	if !moduleNamePattern.MatchString(name) {
+		return errors.Newf(errors.ErrInvalidSyntax, "invalid JS module name '%s'", name)
+	}
+	if strings.HasPrefix(name, BundledModulePrefix) {
+		return errors.Newf(errors.ErrInvalidSyntax, "JS module names starting with '%s' are reserved", BundledModulePrefix)
+	}
+
+	module, err := compileModule(name, source)
+	if err != nil {
+		return err
+	}
+
+	s.modulesMu.Lock()
+	defer s.modulesMu.Unlock()
+	s.modules[name] = module
+	s.modulesGen.Add(1)
+	return nil
+}
+
+// UnregisterModule removes a registered module. It returns false if there
+// was no module with that name.
+func (s *Sandbox) UnregisterModule(name string) bool {
+	s.modulesMu.Lock()
+	defer s.modulesMu.Unlock()
+	_, ok := s.modules[name]
+	delete(s.modules, name)
+	s.modulesGen.Add(1)
+	return ok
+}
+
+// Modules returns the names of the registered and bundled modules, sorted.
+func (s *Sandbox) Modules() []string {
+	s.modulesMu.RLock()
+	names := make([]string, 0, len(s.modules)+len(bundledModules))
+	for name := range s.modules {
+		names = append(names, name)
+	}
+	s.modulesMu.RUnlock()
+
+	for name := range bundledModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Clone returns a sandbox with a copy of the configuration and the modules,
+// and its own VMs, statistics, and empty persistent state.
+func (s *Sandbox) Clone() *Sandbox {
+	config := *s.config
+	clone := NewSandbox(&config)
+
+	s.modulesMu.RLock()
+	defer s.modulesMu.RUnlock()
+	for name, module := range s.modules {
+		clone.modules[name] = module
+	}
+	return clone
+}
+
+// module returns the module with the given name.
+func (s *Sandbox) module(name string) (*jsModule, bool) {
+	if module, ok := bundledModules[name]; ok {
+		return module, true
+	}
+	s.modulesMu.RLock()
+	defer s.modulesMu.RUnlock()
+	module, ok := s.modules[name]
+	return module, ok
+}
+
+// requireFunc returns the require function of a VM. A module is evaluated
+// the first time it is required and its exports are reused by later calls in
+// the same VM, until any module is registered or unregistered. As in
+// CommonJS, a module required while it is still being evaluated gets its
+// exports so far.
+func (s *Sandbox) requireFunc(v *sandboxVM) func(goja.FunctionCall) goja.Value {
+	var require func(goja.FunctionCall) goja.Value
+	require = func(call goja.FunctionCall) goja.Value {
+		vm := v.vm
+		name := call.Argument(0).String()
+		module, ok := s.module(name)
+		if !ok {
+			panic(vm.NewTypeError("JS module '%s' is not registered", name))
+		}
+		if gen := s.modulesGen.Load(); v.modulesGen != gen {
+			clear(v.exports)
+			v.modulesGen = gen
+		}
+		if instance, ok := v.exports[name]; ok {
+			return instance.object.Get("exports")
+		}
+
+		object := vm.NewObject()
+		exports := vm.NewObject()
+		_ = object.Set("exports", exports)
+		v.exports[name] = &moduleInstance{object: object}
+
+		wrapper, err := vm.RunProgram(module.program)
+		if err != nil {
+			delete(v.exports, name)
+			panic(err)
+		}
+		fn, _ := goja.AssertFunction(wrapper)
+		if _, err := fn(goja.Undefined(), object, exports, vm.ToValue(require)); err != nil {
+			delete(v.exports, name)
+			panic(err)
+		}
+		return object.Get("exports")
+	}
+	return require
+}
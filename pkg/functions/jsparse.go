@@ -0,0 +1,432 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/dop251/goja"
+)
+
+// jsDefinition is a parsed JavaScript function definition.
+type jsDefinition struct {
+	name       string
+	params     []jsParam
+	returnType types.Type
+	async      bool
+	source     string // Executable source: type annotations removed, bound with var
+}
+
+// jsParam is a parameter of a JavaScript function.
+type jsParam struct {
+	name     string
+	optional bool // Has a default value
+	rest     bool // ...name
+}
+
+// signature returns the function signature of the definition. JavaScript is
+// dynamically typed, so parameters accept any type.
+func (def *jsDefinition) signature() *types.FunctionSignature {
+	params := make([]types.ParameterDef, len(def.params))
+	variadic := false
+	for i, p := range def.params {
+		params[i] = types.ParameterDef{Name: p.name, Type: types.TypeAny, Optional: p.optional}
+		variadic = p.rest
+	}
+	return &types.FunctionSignature{
+		Name:       def.name,
+		Parameters: params,
+		ReturnType: def.returnType,
+		Variadic:   variadic,
+	}
+}
+
+// jsScanner reads a function definition. edits collects the changes that
+// make the source executable.
+type jsScanner struct {
+	src   string
+	pos   int
+	edits []jsEdit
+}
+
+// jsEdit replaces src[start:end].
+type jsEdit struct {
+	start, end  int
+	replacement string
+}
+
+// parseJSDefinition parses a function definition in one of the forms
+//
+//	[async] function name(params) { body }
+//	const|let|var name = [async] function [name](params) { body }
+//	const|let|var name = [async] (params) => body
+//	const|let|var name = [async] param => body
+//
+// Parameters may have default values and be destructured, and the last one
+// may be a rest parameter. Type annotations on parameters and the return type,
+// as in function name(x: int): float { ... }, are accepted and removed. The
+// returned source binds the function with var, so it can be run repeatedly
+// in a pooled VM, and has been checked by the JavaScript compiler.
+func parseJSDefinition(source string) (*jsDefinition, error) {
+	s := &jsScanner{src: source}
+	def := &jsDefinition{returnType: types.TypeAny}
+
+	s.skipSpace()
+	switch word := s.peekWord(); word {
+	case "async", "function":
+		if err := s.parseFunction(def, true); err != nil {
+			return nil, err
+		}
+	case "const", "let", "var":
+		start := s.pos
+		s.pos += len(word)
+		s.edits = append(s.edits, jsEdit{start, s.pos, "var"})
+		if err := s.parseBinding(def); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New(errors.ErrInvalidSyntax,
+			"JS function must start with the 'function' keyword or bind a function with const, let, or var")
+	}
+
+	def.source = s.apply()
+	if _, err := goja.Compile(def.name, def.source, false); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, fmt.Sprintf("invalid JS function '%s': %v", def.name, err), err)
+	}
+	return def, nil
+}
+
+// parseFunction parses [async] function name(params) { body }. The name is
+// optional for function expressions.
+func (s *jsScanner) parseFunction(def *jsDefinition, declaration bool) error {
+	if s.peekWord() == "async" {
+		s.pos += len("async")
+		s.skipSpace()
+		def.async = true
+	}
+	if s.peekWord() != "function" {
+		return errors.New(errors.ErrInvalidSyntax, "expected 'function'")
+	}
+	s.pos += len("function")
+	s.skipSpace()
+	if s.peek() == '*' {
+		return errors.New(errors.ErrInvalidSyntax, "JS generator functions are not supported")
+	}
+
+	name := s.ident()
+	if declaration {
+		if name == "" {
+			return errors.New(errors.ErrInvalidSyntax, "JS function must have a name")
+		}
+		def.name = name
+	}
+
+	s.skipSpace()
+	if s.peek() != '(' {
+		return errors.New(errors.ErrInvalidSyntax, "expected '(' after function name")
+	}
+	if err := s.parseParams(def); err != nil {
+		return err
+	}
+	s.parseReturnType(def, "{")
+
+	if s.peek() != '{' {
+		return errors.New(errors.ErrInvalidSyntax, "expected '{' for function body")
+	}
+	return s.skipBlock()
+}
+
+// parseBinding parses name = <function or arrow function>, after the
+// const, let, or var keyword.
+func (s *jsScanner) parseBinding(def *jsDefinition) error {
+	s.skipSpace()
+	def.name = s.ident()
+	if def.name == "" {
+		return errors.New(errors.ErrInvalidSyntax, "JS function must have a name")
+	}
+	s.skipSpace()
+	if s.peek() != '=' {
+		return errors.New(errors.ErrInvalidSyntax, "expected '=' after function name")
+	}
+	s.pos++
+	s.skipSpace()
+
+	afterAsync := s.pos
+	if s.peekWord() == "async" {
+		afterAsync += len("async")
+		for afterAsync < len(s.src) && isSpace(s.src[afterAsync]) {
+			afterAsync++
+		}
+	}
+	if strings.HasPrefix(s.src[afterAsync:], "function") {
+		return s.parseFunction(def, false)
+	}
+
+	// Arrow function
+	if afterAsync > s.pos {
+		def.async = true
+		s.pos = afterAsync
+	}
+	if s.peek() == '(' {
+		if err := s.parseParams(def); err != nil {
+			return err
+		}
+		s.parseReturnType(def, "=>")
+	} else if param := s.ident(); param != "" {
+		def.params = []jsParam{{name: param}}
+		s.skipSpace()
+	} else {
+		return errors.New(errors.ErrInvalidSyntax, "expected a function or an arrow function")
+	}
+
+	if !strings.HasPrefix(s.src[s.pos:], "=>") {
+		return errors.New(errors.ErrInvalidSyntax, "expected '=>' after arrow function parameters")
+	}
+	return nil
+}
+
+// parseParams parses a parenthesized parameter list, removing type
+// annotations.
+func (s *jsScanner) parseParams(def *jsDefinition) error {
+	open := s.pos
+	closing, err := s.matching(open)
+	if err != nil {
+		return errors.New(errors.ErrInvalidSyntax, "expected ')' after parameters")
+	}
+
+	for i, segment := range s.split(open+1, closing) {
+		text := strings.TrimSpace(s.src[segment[0]:segment[1]])
+		if text == "" {
+			continue
+		}
+		start := segment[0] + strings.Index(s.src[segment[0]:segment[1]], text)
+
+		p := jsParam{}
+		pos := start
+		if strings.HasPrefix(text, "...") {
+			p.rest = true
+			pos += 3
+		}
+
+		s.pos = pos
+		p.name = s.ident()
+		if p.name == "" {
+			// Destructured parameter
+			p.name = fmt.Sprintf("arg%d", i+1)
+			if end, err := s.matching(s.pos); err == nil {
+				s.pos = end + 1
+			}
+		}
+		s.skipSpace()
+
+		if s.peek() == ':' {
+			end := s.typeEnd(s.pos+1, segment[1], ",=")
+			s.edits = append(s.edits, jsEdit{s.pos, end, ""})
+			s.pos = end
+		}
+		s.skipSpace()
+		p.optional = s.peek() == '='
+
+		def.params = append(def.params, p)
+	}
+
+	s.pos = closing + 1
+	s.skipSpace()
+	return nil
+}
+
+// parseReturnType parses and removes an optional ": type" annotation ending
+// before terminator.
+func (s *jsScanner) parseReturnType(def *jsDefinition, terminator string) {
+	if s.peek() != ':' {
+		return
+	}
+	end := s.pos + 1
+	for end < len(s.src) && !strings.HasPrefix(s.src[end:], terminator) {
+		end++
+	}
+	def.returnType = jsTypeOf(strings.TrimSpace(s.src[s.pos+1 : end]))
+	s.edits = append(s.edits, jsEdit{s.pos, end, " "})
+	s.pos = end
+}
+
+// typeEnd returns the end of a parameter type annotation starting at pos: the
+// first of the stop characters outside brackets, or limit.
+func (s *jsScanner) typeEnd(pos, limit int, stop string) int {
+	depth := 0
+	for ; pos < limit; pos++ {
+		switch c := s.src[pos]; {
+		case c == '<' || c == '(' || c == '[' || c == '{':
+			depth++
+		case c == '>' || c == ')' || c == ']' || c == '}':
+			depth--
+		case depth == 0 && strings.IndexByte(stop, c) >= 0:
+			return pos
+		}
+	}
+	return limit
+}
+
+// jsTypeOf maps a type annotation to an AMEL type. Both AMEL and TypeScript
+// names are understood, and Promise<T> is T; other types are treated as any.
+func jsTypeOf(annotation string) types.Type {
+	switch {
+	case strings.HasPrefix(annotation, "Promise<") && strings.HasSuffix(annotation, ">"):
+		return jsTypeOf(strings.TrimSpace(annotation[len("Promise<") : len(annotation)-1]))
+	case annotation == "number":
+		return types.TypeFloat
+	case annotation == "boolean":
+		return types.TypeBool
+	case strings.HasSuffix(annotation, "[]") || strings.HasPrefix(annotation, "Array<"):
+		return types.TypeList
+	}
+	if t := types.ParseType(annotation); t != types.TypeUnknown {
+		return t
+	}
+	return types.TypeAny
+}
+
+// skipBlock moves past the block starting at the current position.
+func (s *jsScanner) skipBlock() error {
+	end, err := s.matching(s.pos)
+	if err != nil {
+		return errors.New(errors.ErrInvalidSyntax, "unmatched braces in function body")
+	}
+	s.pos = end + 1
+	return nil
+}
+
+// matching returns the position of the bracket closing the one at open,
+// skipping strings, template literals, and comments.
+func (s *jsScanner) matching(open int) (int, error) {
+	depth := 0
+	for pos := open; pos < len(s.src); pos++ {
+		switch c := s.src[pos]; c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return pos, nil
+			}
+		case '"', '\'', '`':
+			pos = s.stringEnd(pos)
+		case '/':
+			pos = s.commentEnd(pos)
+		}
+	}
+	return 0, fmt.Errorf("unmatched %q", s.src[open])
+}
+
+// split returns the ranges of the comma-separated items in src[start:end].
+func (s *jsScanner) split(start, end int) [][2]int {
+	var items [][2]int
+	depth, itemStart := 0, start
+	for pos := start; pos < end; pos++ {
+		switch c := s.src[pos]; c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case '"', '\'', '`':
+			pos = s.stringEnd(pos)
+		case ',':
+			if depth == 0 {
+				items = append(items, [2]int{itemStart, pos})
+				itemStart = pos + 1
+			}
+		}
+	}
+	return append(items, [2]int{itemStart, end})
+}
+
+// stringEnd returns the position of the quote closing the string at pos.
+func (s *jsScanner) stringEnd(pos int) int {
+	quote := s.src[pos]
+	for pos++; pos < len(s.src) && s.src[pos] != quote; pos++ {
+		if s.src[pos] == '\\' {
+			pos++
+		}
+	}
+	return pos
+}
+
+// commentEnd returns the last position of the comment at pos, or pos if
+// there is none.
+func (s *jsScanner) commentEnd(pos int) int {
+	switch {
+	case strings.HasPrefix(s.src[pos:], "//"):
+		if end := strings.IndexByte(s.src[pos:], '\n'); end >= 0 {
+			return pos + end
+		}
+		return len(s.src)
+	case strings.HasPrefix(s.src[pos:], "/*"):
+		if end := strings.Index(s.src[pos+2:], "*/"); end >= 0 {
+			return pos + 2 + end + 1
+		}
+		return len(s.src)
+	}
+	return pos
+}
+
+// skipSpace skips whitespace and comments.
+func (s *jsScanner) skipSpace() {
+	for s.pos < len(s.src) {
+		if isSpace(s.src[s.pos]) {
+			s.pos++
+			continue
+		}
+		if end := s.commentEnd(s.pos); end != s.pos {
+			s.pos = end + 1
+			continue
+		}
+		return
+	}
+}
+
+func (s *jsScanner) peek() byte {
+	if s.pos < len(s.src) {
+		return s.src[s.pos]
+	}
+	return 0
+}
+
+// peekWord returns the identifier at the current position without consuming it.
+func (s *jsScanner) peekWord() string {
+	end := s.pos
+	for end < len(s.src) && isIdentChar(s.src[end]) {
+		end++
+	}
+	return s.src[s.pos:end]
+}
+
+// ident consumes an identifier.
+func (s *jsScanner) ident() string {
+	word := s.peekWord()
+	s.pos += len(word)
+	return word
+}
+
+// apply returns the source with the edits applied.
+func (s *jsScanner) apply() string {
+	var b strings.Builder
+	last := 0
+	for _, edit := range s.edits {
+		b.WriteString(s.src[last:edit.start])
+		b.WriteString(edit.replacement)
+		last = edit.end
+	}
+	b.WriteString(s.src[last:])
+	return b.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// isIdentChar returns true if the character can be part of an identifier.
+func isIdentChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '$'
+}
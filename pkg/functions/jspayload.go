@@ -0,0 +1,96 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/dop251/goja"
+)
+
+type evalContextKey struct{}
+
+// WithEvalContext returns a context that lets JavaScript executed with it
+// read the payload and variables of an evaluation through amel.payload,
+// amel.path, and amel.variable, if SandboxConfig.PayloadAccess is set.
+func WithEvalContext(ctx context.Context, ec EvalContext) context.Context {
+	return context.WithValue(ctx, evalContextKey{}, ec)
+}
+
+// evalContextFrom returns the evaluation context of a context, or nil.
+func evalContextFrom(ctx context.Context) EvalContext {
+	ec, _ := ctx.Value(evalContextKey{}).(EvalContext)
+	return ec
+}
+
+// installPayload sets the amel APIs reading the evaluation that called the
+// function running in a VM:
+//
+//	amel.payload         the whole payload
+//	amel.path(path)      the value at a path such as "user.age" or "$.items[0]"
+//	amel.variable(name)  a variable, such as a lambda parameter
+//
+// Values are copies; changing them does not change the payload. Outside an
+// evaluation they are null.
+func (s *Sandbox) installPayload(v *sandboxVM, amel *goja.Object) {
+	vm := v.vm
+	// Captured before user code runs, which could replace JSON.parse
+	parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+	copyToJS := func(value types.Value) goja.Value {
+		return copyToJS(vm, parse, value)
+	}
+
+	current := func() EvalContext {
+		if !s.config.PayloadAccess {
+			panic(vm.NewTypeError("the payload is not available to JS functions; set SandboxConfig.PayloadAccess to enable it"))
+		}
+		return v.eval
+	}
+
+	getPayload := vm.ToValue(func(goja.FunctionCall) goja.Value {
+		ec := current()
+		if ec == nil {
+			return goja.Null()
+		}
+		return copyToJS(ec.Lookup("$"))
+	})
+	_ = amel.DefineAccessorProperty("payload", getPayload, nil, goja.FLAG_FALSE, goja.FLAG_TRUE)
+
+	_ = amel.Set("path", func(call goja.FunctionCall) goja.Value {
+		ec := current()
+		if ec == nil {
+			return goja.Null()
+		}
+		return copyToJS(ec.Lookup(call.Argument(0).String()))
+	})
+
+	_ = amel.Set("variable", func(call goja.FunctionCall) goja.Value {
+		ec := current()
+		if ec == nil {
+			return goja.Null()
+		}
+		value, ok := ec.Variable(call.Argument(0).String())
+		if !ok {
+			return goja.Undefined()
+		}
+		return copyToJS(value)
+	})
+}
+
+// copyToJS converts a value to plain JavaScript objects and arrays with
+// JSON.parse, so the JavaScript value shares nothing with the Go value.
+func copyToJS(vm *goja.Runtime, parse goja.Callable, value types.Value) goja.Value {
+	if value.IsNull() {
+		return goja.Null()
+	}
+	data, err := json.Marshal(value.Plain())
+	if err != nil {
+		return goja.Null()
+	}
+	copied, err := parse(goja.Undefined(), vm.ToValue(string(data)))
+	if err != nil {
+		return goja.Null()
+	}
+	return copied
+}
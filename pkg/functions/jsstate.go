@@ -0,0 +1,132 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// jsState is the persistent state of a sandbox, shared by all its VMs.
+// Values are stored as JSON, so every call gets its own copy.
+type jsState struct {
+	mu     sync.Mutex
+	values map[string]string
+	size   int64 // Bytes of keys and values
+}
+
+// newJSState creates an empty state.
+func newJSState() *jsState {
+	return &jsState{values: make(map[string]string)}
+}
+
+// StateSize returns the number of keys in the persistent state of the
+// sandbox and their size in bytes, counting keys and JSON encoded values.
+func (s *Sandbox) StateSize() (keys int, bytes int64) {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	return len(s.state.values), s.state.size
+}
+
+// ResetState deletes the persistent state of the sandbox.
+func (s *Sandbox) ResetState() {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	s.state.values = make(map[string]string)
+	s.state.size = 0
+}
+
+// SetStateLimit updates the size limit of the persistent state. Zero
+// disables the state; values already stored are kept until ResetState.
+func (s *Sandbox) SetStateLimit(bytes int64) {
+	s.config.StateLimit = bytes
+}
+
+// installState sets amel.state in a VM. It is a key-value store that keeps
+// JSON values across calls while SandboxConfig.StateLimit is positive:
+//
+//	amel.state.get(key[, default])  amel.state.set(key, value)
+//	amel.state.has(key)             amel.state.delete(key)
+//	amel.state.keys()
+func (s *Sandbox) installState(vm *goja.Runtime, amel *goja.Object) {
+	state := vm.NewObject()
+	enabled := func() {
+		if s.config.StateLimit <= 0 {
+			panic(vm.NewTypeError("amel.state is disabled; set SandboxConfig.StateLimit to enable it"))
+		}
+	}
+
+	_ = state.Set("get", func(call goja.FunctionCall) goja.Value {
+		enabled()
+		s.state.mu.Lock()
+		data, ok := s.state.values[call.Argument(0).String()]
+		s.state.mu.Unlock()
+		if !ok {
+			return call.Argument(1)
+		}
+		var value interface{}
+		_ = json.Unmarshal([]byte(data), &value)
+		return vm.ToValue(value)
+	})
+
+	_ = state.Set("set", func(call goja.FunctionCall) goja.Value {
+		enabled()
+		key := call.Argument(0).String()
+		data, err := json.Marshal(call.Argument(1).Export())
+		if err != nil || goja.IsUndefined(call.Argument(1)) {
+			panic(vm.NewTypeError("amel.state value for '%s' is not JSON serializable", key))
+		}
+
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		size := s.state.size + int64(len(data))
+		if old, ok := s.state.values[key]; ok {
+			size -= int64(len(old))
+		} else {
+			size += int64(len(key))
+		}
+		if size > s.config.StateLimit {
+			panic(vm.NewTypeError("amel.state limit of %d bytes exceeded", s.config.StateLimit))
+		}
+		s.state.values[key] = string(data)
+		s.state.size = size
+		return goja.Undefined()
+	})
+
+	_ = state.Set("has", func(call goja.FunctionCall) goja.Value {
+		enabled()
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		_, ok := s.state.values[call.Argument(0).String()]
+		return vm.ToValue(ok)
+	})
+
+	_ = state.Set("delete", func(call goja.FunctionCall) goja.Value {
+		enabled()
+		key := call.Argument(0).String()
+		s.state.mu.Lock()
+		defer s.state.mu.Unlock()
+		old, ok := s.state.values[key]
+		if ok {
+			delete(s.state.values, key)
+			s.state.size -= int64(len(key) + len(old))
+		}
+		return vm.ToValue(ok)
+	})
+
+	_ = state.Set("keys", func(goja.FunctionCall) goja.Value {
+		enabled()
+		s.state.mu.Lock()
+		keys := make([]interface{}, 0, len(s.state.values))
+		for key := range s.state.values {
+			keys = append(keys, key)
+		}
+		s.state.mu.Unlock()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].(string) < keys[j].(string) })
+		return vm.NewArray(keys...)
+	})
+
+	_ = amel.Set("state", state)
+}
@@ -0,0 +1,358 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256" // Hashes of the HS256, RS256, PS256, and ES256 algorithms
+	_ "crypto/sha512" // Hashes of the 384 and 512 algorithms
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Names of the functions inspecting JSON Web Tokens.
+const (
+	JWTClaimsFunction = "jwtClaims"
+	JWTValidFunction  = "jwtValid"
+)
+
+// JWTKeys verifies the signatures of JSON Web Tokens with an HMAC secret or
+// with the public keys of a JSON Web Key Set. Create it with JWTSecret or
+// ParseJWKS.
+type JWTKeys struct {
+	secret []byte
+	keys   []jwk
+}
+
+// jwk is a public key of a key set.
+type jwk struct {
+	kid string
+	alg string // Empty if the key does not restrict its algorithm
+	key crypto.PublicKey
+}
+
+// JWTSecret returns keys verifying tokens signed with an HMAC secret, with
+// the algorithms HS256, HS384, and HS512.
+func JWTSecret(secret []byte) *JWTKeys {
+	return &JWTKeys{secret: append([]byte(nil), secret...)}
+}
+
+// ParseJWKS parses a JSON Web Key Set, such as the document served at the
+// jwks_uri of an identity provider, into keys verifying tokens signed with
+// RSA (RS256, PS256, ...), ECDSA (ES256, ES384, ES512), or Ed25519 (EdDSA).
+// Keys of other types, and keys for encryption only, are skipped.
+func ParseJWKS(data []byte) (*JWTKeys, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, fmt.Sprintf("invalid JWKS: %v", err), err)
+	}
+
+	keys := &JWTKeys{}
+	for i, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k.N, k.E)
+		case "EC":
+			key, err = ecdsaKey(k.Crv, k.X, k.Y)
+		case "OKP":
+			if k.Crv != "Ed25519" {
+				continue
+			}
+			var x []byte
+			if x, err = base64.RawURLEncoding.DecodeString(k.X); err == nil && len(x) != ed25519.PublicKeySize {
+				err = fmt.Errorf("key is %d bytes long", len(x))
+			}
+			key = ed25519.PublicKey(x)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Newf(errors.ErrInvalidSyntax, "invalid JWKS: key %d (%q): %v", i, k.Kid, err)
+		}
+		keys.keys = append(keys.keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	if len(keys.keys) == 0 {
+		return nil, errors.New(errors.ErrInvalidSyntax, "invalid JWKS: no signature verification keys")
+	}
+	return keys, nil
+}
+
+// rsaKey decodes the modulus and exponent of an RSA key.
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %v", err)
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %v", err)
+	}
+	exp := new(big.Int).SetBytes(exponent)
+	if len(modulus) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("modulus or exponent out of range")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(exp.Int64())}, nil
+}
+
+// ecdsaKey decodes the point of an ECDSA key.
+func ecdsaKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xb, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("x: %v", err)
+	}
+	yb, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %v", err)
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("point is not on the curve")
+	}
+	return key, nil
+}
+
+// RegisterJWTValid registers jwtValid verifying tokens with the named keys
+// instead of none. Unregister the function first to replace the one
+// registered by RegisterBuiltIns.
+func RegisterJWTValid(r *Registry, keys map[string]*JWTKeys) error {
+	return r.RegisterAll(jwtValidFunction(keys))
+}
+
+// jwtFunctions returns jwtClaims and jwtValid without keys.
+func jwtFunctions() []*Function {
+	claimsSig := types.NewFunctionSignature(JWTClaimsFunction, types.TypeAny, types.Param("token", types.TypeAny))
+	builtinDocs[JWTClaimsFunction].document(claimsSig)
+	return []*Function{
+		{Name: JWTClaimsFunction, Signature: claimsSig, BuiltIn: builtinJWTClaims, Pure: true},
+		jwtValidFunction(nil),
+	}
+}
+
+// jwtValidFunction returns jwtValid verifying tokens with the named keys. The
+// result depends on the time, so the function is not pure.
+func jwtValidFunction(keys map[string]*JWTKeys) *Function {
+	sig := types.NewFunctionSignature(JWTValidFunction, types.TypeBool,
+		types.Param("token", types.TypeAny), types.Param("keys", types.TypeString))
+	builtinDocs[JWTValidFunction].document(sig)
+
+	return &Function{
+		Name:      JWTValidFunction,
+		Signature: sig,
+		BuiltIn: func(args ...types.Value) (types.Value, error) {
+			if len(args) < 2 {
+				return types.Null(), errors.New(errors.ErrArgumentCount, "jwtValid requires 2 arguments: token, keys")
+			}
+			name, ok := args[1].AsString()
+			if !ok {
+				return types.Null(), errors.Newf(errors.ErrArgumentType, "jwtValid keys must be a string, got %s", args[1].Type)
+			}
+			set, ok := keys[name]
+			if !ok {
+				return types.Null(), errors.Newf(errors.ErrArgumentType, "no JWT keys named %q are configured", name)
+			}
+
+			token, err := jwtArg(JWTValidFunction, args[0])
+			if err != nil || token == nil {
+				return types.Bool(false), err
+			}
+			return types.Bool(token.verify(set) && token.current()), nil
+		},
+	}
+}
+
+// builtinJWTClaims decodes the claims of a JSON Web Token, with or without a
+// "Bearer " prefix, without verifying it. Malformed tokens and null give null.
+func builtinJWTClaims(args ...types.Value) (types.Value, error) {
+	token, err := jwtArg(JWTClaimsFunction, args[0])
+	if err != nil || token == nil {
+		return types.Null(), err
+	}
+	return jsonToValue(token.claims), nil
+}
+
+// jwt is a decoded JSON Web Token.
+type jwt struct {
+	alg       string
+	kid       string
+	claims    map[string]interface{}
+	signed    string // The header and payload, as signed
+	signature []byte
+}
+
+// jwtArg decodes the token argument of a JWT function. It returns nil for
+// null and malformed tokens, and an error for values other than strings.
+func jwtArg(fn string, v types.Value) (*jwt, error) {
+	if v.IsNull() {
+		return nil, nil
+	}
+	s, ok := v.AsString()
+	if !ok {
+		return nil, errors.Newf(errors.ErrArgumentType, "%s token must be a string, got %s", fn, v.Type)
+	}
+	return parseJWT(s), nil
+}
+
+// parseJWT decodes a compact JSON Web Token, or returns nil.
+func parseJWT(s string) *jwt {
+	s = strings.TrimSpace(s)
+	if len(s) > 7 && strings.EqualFold(s[:7], "Bearer ") {
+		s = strings.TrimSpace(s[7:])
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	t := &jwt{signed: parts[0] + "." + parts[1]}
+	if !decodeJWTPart(parts[0], &header) || !decodeJWTPart(parts[1], &t.claims) || t.claims == nil {
+		return nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil
+	}
+	t.alg, t.kid, t.signature = header.Alg, header.Kid, signature
+	return t
+}
+
+// decodeJWTPart decodes a base64url-encoded JSON part of a token.
+func decodeJWTPart(part string, v interface{}) bool {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	return err == nil && json.Unmarshal(data, v) == nil
+}
+
+// verify reports whether the token is signed by one of the keys, with the
+// algorithm of its header. HMAC secrets only verify HS algorithms and public
+// keys only the algorithms of their type, so a public key is never used as
+// an HMAC secret; "none" is never accepted.
+func (t *jwt) verify(keys *JWTKeys) bool {
+	if hash, ok := jwtHMAC[t.alg]; ok {
+		if keys.secret == nil {
+			return false
+		}
+		mac := hmac.New(hash.New, keys.secret)
+		mac.Write([]byte(t.signed))
+		return hmac.Equal(mac.Sum(nil), t.signature)
+	}
+
+	for _, k := range keys.keys {
+		if (t.kid != "" && k.kid != "" && k.kid != t.kid) || (k.alg != "" && k.alg != t.alg) {
+			continue
+		}
+		if verifyJWTSignature(t.alg, k.key, []byte(t.signed), t.signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// current reports whether the token is within its validity period: before
+// its expiry ("exp") and not before its start ("nbf"), if it has them.
+func (t *jwt) current() bool {
+	now := float64(currentTime().Unix())
+	if exp, ok := t.claims["exp"]; ok {
+		if f, ok := exp.(float64); !ok || now >= f {
+			return false
+		}
+	}
+	if nbf, ok := t.claims["nbf"]; ok {
+		if f, ok := nbf.(float64); !ok || now < f {
+			return false
+		}
+	}
+	return true
+}
+
+// Hashes of the JWT signature algorithms.
+var (
+	jwtHMAC = map[string]crypto.Hash{"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512}
+	jwtRSA  = map[string]crypto.Hash{"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512}
+	jwtPSS  = map[string]crypto.Hash{"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512}
+	jwtEC   = map[string]struct {
+		hash  crypto.Hash
+		curve elliptic.Curve
+	}{
+		"ES256": {crypto.SHA256, elliptic.P256()},
+		"ES384": {crypto.SHA384, elliptic.P384()},
+		"ES512": {crypto.SHA512, elliptic.P521()},
+	}
+)
+
+// verifyJWTSignature verifies a signature made with a public key algorithm.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if hash, ok := jwtRSA[alg]; ok {
+			return rsa.VerifyPKCS1v15(key, hash, digest(hash, signed), signature) == nil
+		}
+		if hash, ok := jwtPSS[alg]; ok {
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			return rsa.VerifyPSS(key, hash, digest(hash, signed), signature, opts) == nil
+		}
+	case *ecdsa.PublicKey:
+		ec, ok := jwtEC[alg]
+		if !ok || key.Curve != ec.curve {
+			return false
+		}
+		// The signature is r and s, each padded to the size of the curve
+		size := (ec.curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest(ec.hash, signed), r, s)
+	case ed25519.PublicKey:
+		return alg == "EdDSA" && ed25519.Verify(key, signed, signature)
+	}
+	return false
+}
+
+// digest hashes data.
+func digest(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
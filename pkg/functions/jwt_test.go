@@ -0,0 +1,209 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signJWT returns a token with the header and claims, signed by sign.
+func signJWT(t *testing.T, header, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+// hs256 returns a function signing with an HMAC secret.
+func hs256(secret string) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestJWTClaims(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	token := signJWT(t, map[string]interface{}{"alg": "HS256"},
+		map[string]interface{}{"sub": "alice", "roles": []string{"admin"}, "exp": 1700000000}, hs256("secret"))
+
+	for _, input := range []string{token, "Bearer " + token, "bearer  " + token + " "} {
+		result, err := r.Call(JWTClaimsFunction, types.String(input))
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"sub": "alice", "roles": []interface{}{"admin"}, "exp": float64(1700000000)}, result.Plain())
+	}
+
+	for _, input := range []types.Value{
+		types.Null(),
+		types.String(""),
+		types.String("not a token"),
+		types.String("a.b.c"),
+		types.String(b64([]byte(`{"alg":"HS256"}`)) + "." + b64([]byte(`[1,2]`)) + ".sig"),
+	} {
+		result, err := r.Call(JWTClaimsFunction, input)
+		require.NoError(t, err)
+		assert.True(t, result.IsNull(), input.Raw)
+	}
+
+	_, err = r.Call(JWTClaimsFunction, types.Int(1))
+	assert.ErrorContains(t, err, "jwtClaims token must be a string")
+}
+
+func TestJWTValid_Secret(t *testing.T) {
+	defer func(orig func() time.Time) { currentTime = orig }(currentTime)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+
+	r := NewRegistry()
+	require.NoError(t, RegisterJWTValid(r, map[string]*JWTKeys{"gateway": JWTSecret([]byte("secret"))}))
+
+	valid := func(header, claims map[string]interface{}, sign func([]byte) []byte) bool {
+		result, err := r.Call(JWTValidFunction, types.String(signJWT(t, header, claims, sign)), types.String("gateway"))
+		require.NoError(t, err)
+		return result.Raw.(bool)
+	}
+	hs := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	unix := now.Unix()
+
+	assert.True(t, valid(hs, map[string]interface{}{"sub": "alice"}, hs256("secret")))
+	assert.True(t, valid(hs, map[string]interface{}{"exp": unix + 60, "nbf": unix - 60}, hs256("secret")))
+	assert.False(t, valid(hs, map[string]interface{}{"sub": "alice"}, hs256("other")), "wrong secret")
+	assert.False(t, valid(hs, map[string]interface{}{"exp": unix}, hs256("secret")), "expired")
+	assert.False(t, valid(hs, map[string]interface{}{"nbf": unix + 60}, hs256("secret")), "not yet valid")
+	assert.False(t, valid(hs, map[string]interface{}{"exp": "tomorrow"}, hs256("secret")), "malformed exp")
+	assert.False(t, valid(map[string]interface{}{"alg": "none"}, map[string]interface{}{}, func([]byte) []byte { return nil }), "alg none")
+	assert.False(t, valid(map[string]interface{}{"alg": "RS256"}, map[string]interface{}{}, hs256("secret")), "secret with a public key algorithm")
+
+	result, err := r.Call(JWTValidFunction, types.String("garbage"), types.String("gateway"))
+	require.NoError(t, err)
+	assert.Equal(t, types.Bool(false), result)
+
+	result, err = r.Call(JWTValidFunction, types.Null(), types.String("gateway"))
+	require.NoError(t, err)
+	assert.Equal(t, types.Bool(false), result)
+
+	_, err = r.Call(JWTValidFunction, types.String("a.b.c"), types.String("partner"))
+	assert.ErrorContains(t, err, `no JWT keys named "partner"`)
+}
+
+func TestJWTValid_JWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPublic, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "alg": "ES256", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPublic)},
+		{"kty": "oct", "kid": "ignored", "k": "c2VjcmV0"},
+	}})
+	require.NoError(t, err)
+	keys, err := ParseJWKS(jwks)
+	require.NoError(t, err)
+
+	r := NewRegistry()
+	require.NoError(t, RegisterJWTValid(r, map[string]*JWTKeys{"idp": keys}))
+
+	rs256 := func(signed []byte) []byte {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sha256Sum(signed))
+		require.NoError(t, err)
+		return sig
+	}
+	ps256 := func(signed []byte) []byte {
+		sig, err := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, sha256Sum(signed), &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		require.NoError(t, err)
+		return sig
+	}
+	es256 := func(signed []byte) []byte {
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, sha256Sum(signed))
+		require.NoError(t, err)
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	eddsa := func(signed []byte) []byte {
+		return ed25519.Sign(edKey, signed)
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]interface{}
+		sign   func([]byte) []byte
+		want   bool
+	}{
+		{"RS256", map[string]interface{}{"alg": "RS256", "kid": "rsa"}, rs256, true},
+		{"RS256 without kid", map[string]interface{}{"alg": "RS256"}, rs256, true},
+		{"PS256", map[string]interface{}{"alg": "PS256", "kid": "rsa"}, ps256, true},
+		{"ES256", map[string]interface{}{"alg": "ES256", "kid": "ec"}, es256, true},
+		{"EdDSA", map[string]interface{}{"alg": "EdDSA", "kid": "ed"}, eddsa, true},
+		{"wrong kid", map[string]interface{}{"alg": "RS256", "kid": "ec"}, rs256, false},
+		{"algorithm of another key type", map[string]interface{}{"alg": "ES256", "kid": "rsa"}, rs256, false},
+		{"HMAC with a public key", map[string]interface{}{"alg": "HS256", "kid": "rsa"}, hs256(string(rsaKey.N.Bytes())), false},
+		{"tampered", map[string]interface{}{"alg": "ES256", "kid": "ec"}, func(signed []byte) []byte {
+			return es256(append([]byte(nil), signed[:len(signed)-1]...))
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signJWT(t, tt.header, map[string]interface{}{"sub": "alice"}, tt.sign)
+			result, err := r.Call(JWTValidFunction, types.String(token), types.String("idp"))
+			require.NoError(t, err)
+			assert.Equal(t, types.Bool(tt.want), result)
+		})
+	}
+}
+
+func TestParseJWKS_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		jwks string
+		want string
+	}{
+		{"not JSON", `keys`, "invalid JWKS"},
+		{"no keys", `{"keys":[]}`, "no signature verification keys"},
+		{"encryption keys only", `{"keys":[{"kty":"RSA","use":"enc","n":"AQAB","e":"AQAB"}]}`, "no signature verification keys"},
+		{"bad modulus", `{"keys":[{"kty":"RSA","kid":"a","n":"!","e":"AQAB"}]}`, `key 0 ("a"): modulus`},
+		{"unknown curve", `{"keys":[{"kty":"EC","crv":"P-192","x":"AA","y":"AA"}]}`, `unsupported curve "P-192"`},
+		{"point off the curve", `{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`, "not on the curve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJWKS([]byte(tt.jwks))
+			require.Error(t, err)
+			assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,438 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// LuaSandbox runs user-defined functions written in Lua 5.1 with gopher-lua.
+// Only the base, string, table, and math libraries are available; the base
+// functions that load code or reach outside the sandbox are removed, and
+// print writes to the console function of the context, like console.log in
+// JavaScript. It uses the Timeout, MemoryLimit, MaxStackDepth, and PoolSize
+// of its configuration.
+type LuaSandbox struct {
+	config *SandboxConfig
+
+	mu      sync.Mutex
+	states  []*luaVM // Idle states kept for reuse
+	created atomic.Uint64
+
+	protos sync.Map // Function source to its compiled *lua.FunctionProto
+	usage  sandboxUsage
+}
+
+var _ ScriptSandbox = (*LuaSandbox)(nil)
+
+// luaVM is a pooled Lua state together with the function definitions it has
+// already run.
+type luaVM struct {
+	L       *lua.LState
+	defined map[string]string // Function name to the source that defined it
+	console ConsoleFunc       // Console output of the current execution, if wanted
+	name    string            // Name of the function being executed
+}
+
+// luaRemovedGlobals are base library functions that load code, change
+// environments, or control the collector.
+var luaRemovedGlobals = []string{
+	"dofile", "loadfile", "load", "loadstring", "require", "module",
+	"setfenv", "getfenv", "collectgarbage", "newproxy", "_printregs",
+}
+
+// luaDefinitionPattern matches the start of a global Lua function definition.
+var luaDefinitionPattern = regexp.MustCompile(`^\s*function\s+([A-Za-z_][A-Za-z0-9_]*)\s*\(([^)]*)\)`)
+
+// NewLuaSandbox creates a Lua sandbox with the given configuration, or the
+// default sandbox configuration if it is nil.
+func NewLuaSandbox(config *SandboxConfig) *LuaSandbox {
+	if config == nil {
+		config = DefaultSandboxConfig()
+	}
+	return &LuaSandbox{config: config}
+}
+
+// Config returns the configuration of the sandbox.
+func (s *LuaSandbox) Config() *SandboxConfig {
+	return s.config
+}
+
+// Stats returns the usage statistics of the sandbox.
+func (s *LuaSandbox) Stats() SandboxStats {
+	s.mu.Lock()
+	pooled := len(s.states)
+	s.mu.Unlock()
+
+	stats := s.usage.stats()
+	stats.PooledVMs = pooled
+	stats.CreatedVMs = s.created.Load()
+	return stats
+}
+
+// acquire gets a state from the pool or creates a new one.
+func (s *LuaSandbox) acquire() *luaVM {
+	s.mu.Lock()
+	if n := len(s.states); n > 0 {
+		v := s.states[n-1]
+		s.states = s.states[:n-1]
+		s.mu.Unlock()
+		return v
+	}
+	s.mu.Unlock()
+
+	depth := s.config.MaxStackDepth
+	if depth <= 0 {
+		depth = lua.CallStackSize
+	}
+	v := &luaVM{
+		L:       lua.NewState(lua.Options{SkipOpenLibs: true, CallStackSize: depth}),
+		defined: make(map[string]string),
+	}
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		v.L.Push(v.L.NewFunction(lib.open))
+		v.L.Push(lua.LString(lib.name))
+		v.L.Call(1, 0)
+	}
+	for _, name := range luaRemovedGlobals {
+		v.L.SetGlobal(name, lua.LNil)
+	}
+	v.L.SetGlobal("print", v.L.NewFunction(func(L *lua.LState) int {
+		if v.console != nil {
+			parts := make([]string, L.GetTop())
+			for i := range parts {
+				parts[i] = L.ToStringMeta(L.Get(i + 1)).String()
+			}
+			message := strings.Join(parts, "\t")
+			if len(message) > MaxConsoleMessage {
+				message = strings.ToValidUTF8(message[:MaxConsoleMessage], "") + "..."
+			}
+			v.console(ConsoleEntry{Function: v.name, Level: "log", Message: message})
+		}
+		return 0
+	}))
+
+	s.created.Add(1)
+	return v
+}
+
+// release returns a state to the pool after an execution. A state that was
+// interrupted is closed instead.
+func (s *LuaSandbox) release(v *luaVM, err error) {
+	v.L.RemoveContext()
+	v.console, v.name = nil, ""
+	v.L.SetTop(0)
+
+	size := s.config.PoolSize
+	if size <= 0 {
+		size = runtime.GOMAXPROCS(0)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if errors.IsCode(err, errors.ErrTimeout) || errors.IsCode(err, errors.ErrMemoryLimit) || len(s.states) >= size {
+		v.L.Close()
+		return
+	}
+	s.states = append(s.states, v)
+}
+
+// compile returns the compiled function prototype of a chunk. Prototypes are
+// shared by all states of the sandbox.
+func (s *LuaSandbox) compile(source string) (*lua.FunctionProto, error) {
+	if proto, ok := s.protos.Load(source); ok {
+		return proto.(*lua.FunctionProto), nil
+	}
+	proto, err := compileLua(source)
+	if err != nil {
+		return nil, err
+	}
+	s.protos.Store(source, proto)
+	return proto, nil
+}
+
+// compileLua compiles a chunk.
+func compileLua(source string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), "<function>")
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, "<function>")
+}
+
+// Execute runs a Lua function with the given arguments.
+func (s *LuaSandbox) Execute(ctx context.Context, source string, funcName string, args []types.Value) (types.Value, error) {
+	start := time.Now()
+	value, err := s.execute(ctx, source, funcName, args)
+	s.usage.record(start, err)
+	return value, err
+}
+
+func (s *LuaSandbox) execute(ctx context.Context, source string, funcName string, args []types.Value) (_ types.Value, err error) {
+	v := s.acquire()
+	v.console, v.name = consoleFrom(ctx), funcName
+	defer func() { s.release(v, err) }()
+	stop := s.watch(ctx, v.L)
+	defer func() { err = stop(err) }()
+
+	if v.defined[funcName] != source {
+		if err := s.run(v.L, source); err != nil {
+			delete(v.defined, funcName)
+			return types.Null(), errors.Wrap(errors.ErrSandboxViolation, fmt.Sprintf("failed to compile Lua function: %v", err), err)
+		}
+		v.defined[funcName] = source
+	}
+
+	fn, ok := v.L.GetGlobal(funcName).(*lua.LFunction)
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrUndefinedFunction, "function '%s' not found in Lua code", funcName)
+	}
+
+	luaArgs := make([]lua.LValue, len(args))
+	for i, arg := range args {
+		luaArgs[i] = toLua(v.L, arg.Raw)
+	}
+	if err := v.L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, luaArgs...); err != nil {
+		return types.Null(), errors.Wrap(errors.ErrSandboxViolation, fmt.Sprintf("Lua execution failed: %v", err), err)
+	}
+	return types.NewValue(fromLua(v.L.Get(-1))), nil
+}
+
+// ExecuteExpression evaluates a Lua expression and returns the result.
+func (s *LuaSandbox) ExecuteExpression(ctx context.Context, expr string) (types.Value, error) {
+	start := time.Now()
+	value, err := s.executeExpression(ctx, expr)
+	s.usage.record(start, err)
+	return value, err
+}
+
+func (s *LuaSandbox) executeExpression(ctx context.Context, expr string) (_ types.Value, err error) {
+	v := s.acquire()
+	v.console = consoleFrom(ctx)
+	defer func() { s.release(v, err) }()
+	stop := s.watch(ctx, v.L)
+	defer func() { err = stop(err) }()
+
+	proto, err := compileLua("return " + expr)
+	if err != nil {
+		return types.Null(), errors.Wrap(errors.ErrSandboxViolation, fmt.Sprintf("Lua expression failed: %v", err), err)
+	}
+	v.L.Push(v.L.NewFunctionFromProto(proto))
+	if err := v.L.PCall(0, 1, nil); err != nil {
+		return types.Null(), errors.Wrap(errors.ErrSandboxViolation, fmt.Sprintf("Lua expression failed: %v", err), err)
+	}
+	return types.NewValue(fromLua(v.L.Get(-1))), nil
+}
+
+// run compiles and runs a chunk.
+func (s *LuaSandbox) run(L *lua.LState, source string) error {
+	proto, err := s.compile(source)
+	if err != nil {
+		return err
+	}
+	L.Push(L.NewFunctionFromProto(proto))
+	return L.PCall(0, 0, nil)
+}
+
+// watch cancels the state when the context is cancelled, the timeout
+// elapses, or the execution exceeds the memory limit. The returned function
+// stops watching and turns the error of a cancelled execution into a
+// timeout or memory limit error.
+func (s *LuaSandbox) watch(ctx context.Context, L *lua.LState) func(error) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	L.SetContext(ctx)
+
+	var overMemory atomic.Bool
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if s.config.MemoryLimit <= 0 {
+			return
+		}
+		meter := newHeapMeter(s.config.MemoryLimit)
+		ticker := time.NewTicker(memoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if meter.exceeded() {
+					overMemory.Store(true)
+					cancel()
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func(err error) error {
+		close(done)
+		<-stopped
+		interrupted := ctx.Err() != nil
+		cancel()
+		if err == nil || !interrupted {
+			return err
+		}
+		if overMemory.Load() {
+			return errors.Newf(errors.ErrMemoryLimit, "Lua execution exceeded the memory limit of %d bytes", s.config.MemoryLimit)
+		}
+		return errors.New(errors.ErrTimeout, "Lua execution interrupted: execution timeout")
+	}
+}
+
+// toLua converts a Go value, as held by an AMEL value, to a Lua value. Lists
+// become sequences and maps become tables.
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch val := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(val)
+	case int:
+		return lua.LNumber(val)
+	case int64:
+		return lua.LNumber(val)
+	case float64:
+		return lua.LNumber(val)
+	case string:
+		return lua.LString(val)
+	case time.Time:
+		return lua.LString(val.Format(time.RFC3339Nano))
+	case time.Duration:
+		return lua.LString(val.String())
+	case []types.Value:
+		table := L.CreateTable(len(val), 0)
+		for _, elem := range val {
+			table.Append(toLua(L, elem.Raw))
+		}
+		return table
+	case []interface{}:
+		table := L.CreateTable(len(val), 0)
+		for _, elem := range val {
+			table.Append(toLua(L, elem))
+		}
+		return table
+	case map[string]types.Value:
+		table := L.CreateTable(0, len(val))
+		for key, elem := range val {
+			table.RawSetString(key, toLua(L, elem.Raw))
+		}
+		return table
+	case map[string]interface{}:
+		table := L.CreateTable(0, len(val))
+		for key, elem := range val {
+			table.RawSetString(key, toLua(L, elem))
+		}
+		return table
+	case types.Value:
+		return toLua(L, val.Raw)
+	default:
+		return lua.LString(fmt.Sprint(val))
+	}
+}
+
+// fromLua converts a Lua value to a Go value. Whole numbers become int64,
+// sequences become lists, and other tables become maps with string keys.
+func fromLua(v lua.LValue) interface{} {
+	switch val := v.(type) {
+	case lua.LBool:
+		return bool(val)
+	case lua.LNumber:
+		f := float64(val)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f)
+		}
+		return f
+	case lua.LString:
+		return string(val)
+	case *lua.LTable:
+		if n := val.Len(); n > 0 && luaIsSequence(val, n) {
+			list := make([]interface{}, n)
+			for i := 1; i <= n; i++ {
+				list[i-1] = fromLua(val.RawGetInt(i))
+			}
+			return list
+		}
+		m := make(map[string]interface{})
+		val.ForEach(func(key, value lua.LValue) {
+			m[key.String()] = fromLua(value)
+		})
+		return m
+	default:
+		return nil
+	}
+}
+
+// luaIsSequence reports whether a table has only the keys 1 to n.
+func luaIsSequence(table *lua.LTable, n int) bool {
+	count := 0
+	table.ForEach(func(lua.LValue, lua.LValue) { count++ })
+	return count == n
+}
+
+// ParseLuaFunction parses the definition of a global Lua function, such as
+// "function discount(price, rate) return price * (1 - rate) end", into a
+// function. Lua values are dynamically typed, so parameters and results have
+// type any; a "..." parameter makes the function variadic.
+func ParseLuaFunction(source string) (*Function, error) {
+	match := luaDefinitionPattern.FindStringSubmatch(source)
+	if match == nil {
+		return nil, errors.New(errors.ErrInvalidSyntax, "Lua function must start with 'function name(params)'")
+	}
+	if _, err := parse.Parse(strings.NewReader(source), "<function>"); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "invalid Lua function: "+err.Error(), err)
+	}
+
+	sig := &types.FunctionSignature{Name: match[1], ReturnType: types.TypeAny}
+	for _, param := range strings.Split(match[2], ",") {
+		param = strings.TrimSpace(param)
+		switch {
+		case param == "":
+			continue
+		case param == "...":
+			sig.Variadic = true
+			sig.Parameters = append(sig.Parameters, types.ParameterDef{Name: "args", Type: types.TypeAny})
+		default:
+			sig.Parameters = append(sig.Parameters, types.ParameterDef{Name: param, Type: types.TypeAny})
+		}
+	}
+	return &Function{Name: match[1], Signature: sig, LuaBody: source}, nil
+}
+
+// RegisterLuaFunction parses a Lua function and registers it to run in the
+// given Lua sandbox.
+func (r *Registry) RegisterLuaFunction(source string, sandbox *LuaSandbox) error {
+	fn, err := ParseLuaFunction(source)
+	if err != nil {
+		return err
+	}
+	name, body := fn.Name, fn.LuaBody
+	fn.Context = func(ctx context.Context, _ EvalContext, args ...types.Value) (types.Value, error) {
+		return sandbox.Execute(ctx, body, name, args)
+	}
+	return r.Register(fn)
+}
@@ -0,0 +1,116 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLuaFunction(t *testing.T) {
+	fn, err := ParseLuaFunction(`function discount(price, rate) return price * (1 - rate) end`)
+	require.NoError(t, err)
+	assert.True(t, fn.IsLua())
+	assert.False(t, fn.IsBuiltIn())
+	assert.Equal(t, "discount(price: any, rate: any): any", fn.Signature.String())
+
+	fn, err = ParseLuaFunction(`function total(...) local n = 0 for _, v in ipairs({...}) do n = n + v end return n end`)
+	require.NoError(t, err)
+	assert.True(t, fn.Signature.Variadic)
+
+	_, err = ParseLuaFunction(`local function hidden() return 1 end`)
+	assert.Error(t, err)
+	_, err = ParseLuaFunction(`function broken( return 1 end`)
+	assert.Error(t, err)
+	_, err = ParseLuaFunction(`function noEnd() return 1`)
+	assert.Error(t, err)
+}
+
+func TestLuaSandbox(t *testing.T) {
+	sandbox := NewLuaSandbox(&SandboxConfig{Timeout: 50 * time.Millisecond, MaxStackDepth: 100})
+	ctx := context.Background()
+	var _ ScriptSandbox = sandbox
+
+	t.Run("values", func(t *testing.T) {
+		source := `function describe(user, tags)
+			local names = {}
+			for i, tag in ipairs(tags) do names[i] = string.upper(tag) end
+			return { name = user.name, adult = user.age >= 18, tags = names, score = user.age / 2 }
+		end`
+		user := types.NewValue(map[string]interface{}{"name": "Ada", "age": 21})
+		tags := types.NewValue([]interface{}{"a", "b"})
+		for i := 0; i < 2; i++ {
+			result, err := sandbox.Execute(ctx, source, "describe", []types.Value{user, tags})
+			require.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{
+				"name": "Ada", "adult": true, "tags": []interface{}{"A", "B"}, "score": 10.5,
+			}, result.Raw)
+		}
+		assert.Equal(t, uint64(1), sandbox.Stats().CreatedVMs)
+
+		result, err := sandbox.ExecuteExpression(ctx, `math.max(3, 7) + #"abc"`)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), result.Raw)
+	})
+
+	t.Run("restricted", func(t *testing.T) {
+		for _, expr := range []string{`os`, `io`, `loadstring`, `require`, `dofile`, `debug`} {
+			result, err := sandbox.ExecuteExpression(ctx, expr)
+			require.NoError(t, err)
+			assert.True(t, result.IsNull(), expr)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := sandbox.Execute(ctx, `function fail() error("no tier") end`, "fail", nil)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrSandboxViolation))
+		assert.Contains(t, err.Error(), "no tier")
+
+		_, err = sandbox.Execute(ctx, `function spin() while true do end end`, "spin", nil)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrTimeout))
+
+		_, err = sandbox.Execute(ctx, `function deep(n) return deep(n + 1) + 1 end`, "deep", []types.Value{types.Int(1)})
+		assert.Error(t, err)
+
+		stats := sandbox.Stats()
+		assert.Equal(t, uint64(1), stats.Timeouts)
+		assert.Equal(t, uint64(3), stats.Failures)
+	})
+
+	t.Run("print", func(t *testing.T) {
+		var entries []ConsoleEntry
+		ctx := WithConsole(ctx, func(entry ConsoleEntry) { entries = append(entries, entry) })
+		_, err := sandbox.Execute(ctx, `function hello(x) print("x is", x) return x end`, "hello", []types.Value{types.Int(2)})
+		require.NoError(t, err)
+		assert.Equal(t, []ConsoleEntry{{Function: "hello", Level: "log", Message: "x is\t2"}}, entries)
+	})
+
+	t.Run("memory limit", func(t *testing.T) {
+		sandbox := NewLuaSandbox(&SandboxConfig{Timeout: 10 * time.Second, MemoryLimit: 8 * 1024 * 1024, MaxStackDepth: 100})
+		_, err := sandbox.Execute(ctx, `function grow() local t = {} while true do t[#t + 1] = string.rep("x", 100) .. #t end end`, "grow", nil)
+		require.Error(t, err)
+		assert.True(t, errors.IsCode(err, errors.ErrMemoryLimit), err.Error())
+	})
+}
+
+func TestRegistryRegisterLuaFunction(t *testing.T) {
+	registry := NewRegistry()
+	sandbox := NewLuaSandbox(nil)
+	require.NoError(t, registry.RegisterLuaFunction(`function double(x) return x * 2 end`, sandbox))
+
+	result, err := registry.CallContext(context.Background(), testEvalContext{}, "double", types.Int(21))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), result.Raw)
+
+	doc, ok := registry.Describe("double")
+	require.True(t, ok)
+	assert.Equal(t, "lua", doc.Kind)
+	assert.Equal(t, CategoryUser, doc.Category)
+}
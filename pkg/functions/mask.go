@@ -0,0 +1,124 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// RedactedText replaces the matches of redact unless a replacement is given.
+const RedactedText = "[REDACTED]"
+
+// maskChar replaces the characters hidden by maskEmail and maskPan.
+const maskChar = '*'
+
+// panVisibleDigits is the number of trailing digits maskPan keeps, the most
+// PCI DSS allows to be displayed along with the first six.
+const panVisibleDigits = 4
+
+// builtinMaskEmail masks the local part of an email address except for its
+// first character, keeping the domain: "john.doe@example.com" becomes
+// "j*******@example.com". A string without "@" is masked like a local part.
+// Null gives null.
+func builtinMaskEmail(args ...types.Value) (types.Value, error) {
+	s, ok, err := maskArg("maskEmail", args[0])
+	if !ok {
+		return types.Null(), err
+	}
+
+	local, domain := s, ""
+	if at := strings.LastIndex(s, "@"); at >= 0 {
+		local, domain = s[:at], s[at:]
+	}
+
+	var b strings.Builder
+	for i, r := range local {
+		if i == 0 && utf8.RuneCountInString(local) > 1 {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteRune(maskChar)
+	}
+	b.WriteString(domain)
+	return types.String(b.String()), nil
+}
+
+// builtinMaskPan masks the digits of a payment card number except for the
+// last four, keeping separators: "4111 1111 1111 1111" becomes
+// "**** **** **** 1111". Numbers of four digits or fewer are masked entirely.
+// Null gives null.
+func builtinMaskPan(args ...types.Value) (types.Value, error) {
+	s, ok, err := maskArg("maskPan", args[0])
+	if !ok {
+		return types.Null(), err
+	}
+
+	digits := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	visible := 0
+	if digits > panVisibleDigits {
+		visible = panVisibleDigits
+	}
+
+	var b strings.Builder
+	seen := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			seen++
+			if seen <= digits-visible {
+				r = maskChar
+			}
+		}
+		b.WriteRune(r)
+	}
+	return types.String(b.String()), nil
+}
+
+// builtinRedact replaces every match of a regex pattern in a string with
+// "[REDACTED]", or with the replacement if one is given. The replacement is
+// inserted literally. Null gives null.
+func builtinRedact(ctx context.Context, args ...types.Value) (types.Value, error) {
+	s, ok, err := maskArg("redact", args[0])
+	if !ok {
+		return types.Null(), err
+	}
+
+	pattern, ok := args[1].AsString()
+	if !ok {
+		return types.Null(), errors.New(errors.ErrTypeMismatch, "redact pattern requires a string")
+	}
+	replacement := RedactedText
+	if len(args) > 2 {
+		if replacement, ok = args[2].AsString(); !ok {
+			return types.Null(), errors.New(errors.ErrTypeMismatch, "redact replacement requires a string")
+		}
+	}
+
+	re, err := compileRegex(ctx, pattern)
+	if err != nil {
+		return types.Null(), err
+	}
+	return types.String(re.ReplaceAllLiteralString(s, replacement)), nil
+}
+
+// maskArg returns the string a masking function hides parts of. ok is false
+// for null, which the functions pass through, and for other types, with an
+// error.
+func maskArg(fn string, v types.Value) (s string, ok bool, err error) {
+	if v.IsNull() {
+		return "", false, nil
+	}
+	s, ok = v.AsString()
+	if !ok {
+		return "", false, errors.Newf(errors.ErrArgumentType, "%s requires a string, got %s", fn, v.Type)
+	}
+	return s, true, nil
+}
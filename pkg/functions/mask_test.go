@@ -0,0 +1,88 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskEmail(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	tests := []struct {
+		input types.Value
+		want  types.Value
+	}{
+		{types.String("john.doe@example.com"), types.String("j*******@example.com")},
+		{types.String("a@example.com"), types.String("*@example.com")},
+		{types.String("jörg@example.de"), types.String("j***@example.de")},
+		{types.String("\"a@b\"@example.com"), types.String("\"****@example.com")},
+		{types.String("nobody"), types.String("n*****")},
+		{types.String(""), types.String("")},
+		{types.Null(), types.Null()},
+	}
+	for _, tt := range tests {
+		result, err := r.Call("maskEmail", tt.input)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, result, tt.input.Raw)
+	}
+
+	_, err = r.Call("maskEmail", types.Int(1))
+	assert.ErrorContains(t, err, "maskEmail requires a string")
+}
+
+func TestMaskPan(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	tests := []struct {
+		input types.Value
+		want  types.Value
+	}{
+		{types.String("4111111111111111"), types.String("************1111")},
+		{types.String("4111 1111 1111 1111"), types.String("**** **** **** 1111")},
+		{types.String("3782-822463-10005"), types.String("****-******-*0005")},
+		{types.String("1234"), types.String("****")},
+		{types.Null(), types.Null()},
+	}
+	for _, tt := range tests {
+		result, err := r.Call("maskPan", tt.input)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, result, tt.input.Raw)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	result, err := r.Call("redact", types.String("ssn 123-45-6789, alt 987-65-4321"), types.String(`\d{3}-\d{2}-\d{4}`))
+	require.NoError(t, err)
+	assert.Equal(t, "ssn [REDACTED], alt [REDACTED]", result.Raw)
+
+	result, err = r.Call("redact", types.String("token=abc123"), types.String(`token=\w+`), types.String("token=$1"))
+	require.NoError(t, err)
+	assert.Equal(t, "token=$1", result.Raw, "the replacement is literal")
+
+	result, err = r.Call("redact", types.Null(), types.String("x"))
+	require.NoError(t, err)
+	assert.True(t, result.IsNull())
+
+	_, err = r.Call("redact", types.String("x"), types.String("("))
+	assert.ErrorContains(t, err, "invalid regex pattern")
+
+	cache, err := NewRegexCache(RegexConfig{Approved: []string{`\d+`}})
+	require.NoError(t, err)
+	ctx := WithRegexCache(context.Background(), cache)
+	result, err = builtinRedact(ctx, types.String("pin 1234"), types.String(`\d+`))
+	require.NoError(t, err)
+	assert.Equal(t, "pin [REDACTED]", result.Raw)
+	_, err = builtinRedact(ctx, types.String("pin 1234"), types.String(`\d`))
+	assert.True(t, errors.IsCode(err, errors.ErrRegexDenied), err)
+}
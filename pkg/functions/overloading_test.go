@@ -405,3 +405,87 @@ func TestUnregisterOverloaded(t *testing.T) {
 		t.Error("expected function to be removed after unregister")
 	}
 }
+
+func TestCloneCopiesOverloads(t *testing.T) {
+	r := NewRegistry()
+	for _, typ := range []types.Type{types.TypeInt, types.TypeString} {
+		fn := &Function{
+			Name:      "pick",
+			Signature: types.NewFunctionSignature("pick", typ, types.Param("a", typ)),
+			BuiltIn:   func(args ...types.Value) (types.Value, error) { return args[0], nil },
+		}
+		if err := r.RegisterOverload(fn); err != nil {
+			t.Fatalf("failed to register overload: %v", err)
+		}
+	}
+
+	clone := r.Clone()
+	if got := len(clone.ListOverloads("pick")); got != 2 {
+		t.Fatalf("expected 2 overloads in clone, got %d", got)
+	}
+
+	extra := &Function{
+		Name:      "pick",
+		Signature: types.NewFunctionSignature("pick", types.TypeBool, types.Param("a", types.TypeBool)),
+		BuiltIn:   func(args ...types.Value) (types.Value, error) { return args[0], nil },
+	}
+	if err := clone.RegisterOverload(extra); err != nil {
+		t.Fatalf("failed to register overload on clone: %v", err)
+	}
+	if got := len(r.ListOverloads("pick")); got != 2 {
+		t.Errorf("registering on the clone changed the original: %d overloads", got)
+	}
+}
+
+func TestRegisterLazy(t *testing.T) {
+	r := NewRegistry()
+
+	calls := 0
+	first := func(args ...Thunk) (types.Value, error) {
+		calls++
+		return args[0]()
+	}
+	sig := types.NewFunctionSignature("first", types.TypeAny, types.Param("a", types.TypeAny), types.Param("b", types.TypeAny))
+	if err := r.RegisterLazy("first", first, sig); err != nil {
+		t.Fatalf("failed to register lazy function: %v", err)
+	}
+
+	fn, ok := r.Get("first")
+	if !ok || !fn.IsLazy() || !fn.IsBuiltIn() {
+		t.Fatalf("expected a lazy built-in function")
+	}
+
+	// Call wraps evaluated arguments
+	result, err := r.Call("first", types.Int(1), types.Int(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := result.AsInt(); v != 1 {
+		t.Errorf("expected 1, got %v", result.Raw)
+	}
+
+	// CallLazy validates the argument count only
+	if _, err := r.CallLazy("first", Value(types.Int(1))); err == nil {
+		t.Error("expected an argument count error")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	evaluations := 0
+	thunk := Memoize(func() (types.Value, error) {
+		evaluations++
+		return types.Int(42), nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if v, err := thunk(); err != nil || v.Raw != int64(42) {
+			t.Fatalf("unexpected result: %v, %v", v.Raw, err)
+		}
+	}
+	if evaluations != 1 {
+		t.Errorf("expected 1 evaluation, got %d", evaluations)
+	}
+}
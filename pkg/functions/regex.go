@@ -0,0 +1,177 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/bencagri/amel/internal/errors"
+)
+
+// DefaultRegexCacheSize is the number of compiled regex patterns kept by a
+// RegexCache unless RegexConfig.CacheSize is set.
+const DefaultRegexCacheSize = 1000
+
+// RegexConfig restricts the regex patterns that expressions may use, for
+// engines evaluating user-submitted expressions.
+type RegexConfig struct {
+	// MaxPatternLength is the length of the longest pattern accepted, in
+	// bytes. Zero or less means no limit.
+	MaxPatternLength int
+	// CacheSize is the number of compiled patterns kept. The least recently
+	// used pattern is evicted when the cache is full. Zero or less uses
+	// DefaultRegexCacheSize.
+	CacheSize int
+	// Approved, if not nil, lists the only patterns accepted. They are
+	// compiled once, when the cache is created, and never evicted.
+	Approved []string
+}
+
+// RegexCacheStats reports the activity of a RegexCache.
+type RegexCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"` // Patterns compiled
+	Evictions uint64 `json:"evictions"`
+	Rejected  uint64 `json:"rejected"` // Patterns refused by the configuration
+	Entries   int    `json:"entries"`
+}
+
+// RegexCache compiles the regex patterns of evaluations and keeps the
+// compiled patterns, so that a pattern used by every evaluation is compiled
+// only once. It is safe for concurrent use.
+type RegexCache struct {
+	mu        sync.Mutex
+	maxLength int
+	size      int
+	approved  map[string]*regexp.Regexp // Nil unless patterns are approved
+
+	order *list.List // Front is most recently used
+	items map[string]*list.Element
+	stats RegexCacheStats
+}
+
+type regexEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// NewRegexCache creates a cache applying config. It fails if an approved
+// pattern does not compile.
+func NewRegexCache(config RegexConfig) (*RegexCache, error) {
+	c := &RegexCache{
+		maxLength: config.MaxPatternLength,
+		size:      config.CacheSize,
+		order:     list.New(),
+		items:     make(map[string]*list.Element),
+	}
+	if c.size <= 0 {
+		c.size = DefaultRegexCacheSize
+	}
+	if config.Approved != nil {
+		c.approved = make(map[string]*regexp.Regexp, len(config.Approved))
+		for _, pattern := range config.Approved {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.Wrap(errors.ErrInvalidSyntax, fmt.Sprintf("invalid approved regex pattern %q", pattern), err)
+			}
+			c.approved[pattern] = re
+		}
+	}
+	return c, nil
+}
+
+// Check returns an ErrRegexDenied error if the configuration refuses
+// pattern. It does not compile the pattern.
+func (c *RegexCache) Check(pattern string) error {
+	if c.approved != nil {
+		if _, ok := c.approved[pattern]; !ok {
+			return errors.Newf(errors.ErrRegexDenied, "regex pattern %q is not approved", pattern)
+		}
+		return nil
+	}
+	if c.maxLength > 0 && len(pattern) > c.maxLength {
+		return errors.Newf(errors.ErrRegexDenied, "regex pattern is %d bytes long, more than the maximum of %d",
+			len(pattern), c.maxLength)
+	}
+	return nil
+}
+
+// Compile returns the compiled pattern, compiling it on first use. Refused
+// patterns fail with ErrRegexDenied and invalid ones with ErrInvalidSyntax.
+func (c *RegexCache) Compile(pattern string) (*regexp.Regexp, error) {
+	if err := c.Check(pattern); err != nil {
+		c.mu.Lock()
+		c.stats.Rejected++
+		c.mu.Unlock()
+		return nil, err
+	}
+	if re, ok := c.approved[pattern]; ok {
+		c.mu.Lock()
+		c.stats.Hits++
+		c.mu.Unlock()
+		return re, nil
+	}
+
+	c.mu.Lock()
+	if elem, ok := c.items[pattern]; ok {
+		c.order.MoveToFront(elem)
+		c.stats.Hits++
+		c.mu.Unlock()
+		return elem.Value.(*regexEntry).re, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// Compiled without the lock; concurrent misses of a pattern may each
+	// compile it
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, fmt.Sprintf("invalid regex pattern: %v", err), err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[pattern]; ok {
+		return elem.Value.(*regexEntry).re, nil
+	}
+	c.items[pattern] = c.order.PushFront(&regexEntry{pattern: pattern, re: re})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*regexEntry).pattern)
+		c.stats.Evictions++
+	}
+	return re, nil
+}
+
+// Stats returns the activity of the cache.
+func (c *RegexCache) Stats() RegexCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.order.Len() + len(c.approved)
+	return stats
+}
+
+type regexCacheKey struct{}
+
+// WithRegexCache returns a context whose regex matches, such as those of the
+// match function, compile their patterns with c.
+func WithRegexCache(ctx context.Context, c *RegexCache) context.Context {
+	return context.WithValue(ctx, regexCacheKey{}, c)
+}
+
+// compileRegex compiles pattern with the regex cache of ctx, if any.
+func compileRegex(ctx context.Context, pattern string) (*regexp.Regexp, error) {
+	if c, ok := ctx.Value(regexCacheKey{}).(*RegexCache); ok {
+		return c.Compile(pattern)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, fmt.Sprintf("invalid regex pattern: %v", err), err)
+	}
+	return re, nil
+}
@@ -0,0 +1,59 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexCache(t *testing.T) {
+	c, err := NewRegexCache(RegexConfig{CacheSize: 2, MaxPatternLength: 8})
+	require.NoError(t, err)
+
+	first, err := c.Compile(`^a+$`)
+	require.NoError(t, err)
+	again, err := c.Compile(`^a+$`)
+	require.NoError(t, err)
+	assert.Same(t, first, again)
+
+	_, err = c.Compile(`^b+$`)
+	require.NoError(t, err)
+	_, err = c.Compile(`^c+$`)
+	require.NoError(t, err)
+
+	_, err = c.Compile(`^[a-z]+@example$`)
+	assert.True(t, errors.IsCode(err, errors.ErrRegexDenied))
+	_, err = c.Compile(`[`)
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+
+	assert.Equal(t, RegexCacheStats{Hits: 1, Misses: 4, Evictions: 1, Rejected: 1, Entries: 2}, c.Stats())
+
+	t.Run("approved patterns", func(t *testing.T) {
+		c, err := NewRegexCache(RegexConfig{Approved: []string{`^ops@`}})
+		require.NoError(t, err)
+		_, err = c.Compile(`^ops@`)
+		assert.NoError(t, err)
+		_, err = c.Compile(`^dev@`)
+		assert.True(t, errors.IsCode(err, errors.ErrRegexDenied))
+
+		_, err = NewRegexCache(RegexConfig{Approved: []string{`(`}})
+		assert.Error(t, err)
+	})
+
+	t.Run("match", func(t *testing.T) {
+		r, err := NewDefaultRegistry()
+		require.NoError(t, err)
+		ctx := WithRegexCache(context.Background(), c)
+
+		_, err = r.CallContext(ctx, nil, "match", types.String("x"), types.String(`^[a-z]+@example$`))
+		assert.True(t, errors.IsCode(err, errors.ErrRegexDenied), "not wrapped: %v", err)
+		result, err := r.CallContext(ctx, nil, "match", types.String("aaa"), types.String(`^a+$`))
+		require.NoError(t, err)
+		assert.Equal(t, true, result.Raw)
+	})
+}
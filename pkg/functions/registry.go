@@ -2,8 +2,10 @@
 package functions
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/bencagri/amel/internal/errors"
 	"github.com/bencagri/amel/pkg/types"
@@ -12,13 +14,67 @@ import (
 // BuiltInFunc is the signature for built-in Go functions.
 type BuiltInFunc func(args ...types.Value) (types.Value, error)
 
+// Thunk evaluates an argument of a lazy function on demand. A thunk
+// evaluates its argument at most once; later calls return the same result.
+type Thunk func() (types.Value, error)
+
+// LazyFunc is the signature for built-in Go functions that receive their
+// arguments unevaluated, so they can skip arguments they do not need.
+type LazyFunc func(args ...Thunk) (types.Value, error)
+
+// EvalContext is the evaluation state available to context-aware functions.
+// It is implemented by the evaluation context of the eval package.
+type EvalContext interface {
+	// Lookup resolves a JSONPath such as "$.user.id" against the payload. It
+	// returns null if the path does not exist.
+	Lookup(path string) types.Value
+	// Variable returns a variable of the evaluation, such as a lambda parameter.
+	Variable(name string) (types.Value, bool)
+}
+
+// ContextFunc is the signature for built-in Go functions that need the
+// evaluation state. ctx is done when the evaluation times out.
+type ContextFunc func(ctx context.Context, ec EvalContext, args ...types.Value) (types.Value, error)
+
+// CancelableFunc is the signature for built-in Go functions that walk large
+// inputs. ctx is done when the evaluation times out; the function should then
+// stop and return the error of Canceled.
+type CancelableFunc func(ctx context.Context, args ...types.Value) (types.Value, error)
+
+// CancelCheckInterval is the number of elements a loop processes between two
+// checks of its context, keeping the checks cheap on long lists.
+const CancelCheckInterval = 1024
+
+// Canceled returns an ErrTimeout error if ctx is done, and nil otherwise.
+func Canceled(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return errors.New(errors.ErrTimeout, "evaluation timed out")
+	default:
+		return nil
+	}
+}
+
+// canceledAt is Canceled for the i-th element of a loop, only checking ctx
+// every CancelCheckInterval elements.
+func canceledAt(ctx context.Context, i int) error {
+	if i%CancelCheckInterval != 0 {
+		return nil
+	}
+	return Canceled(ctx)
+}
+
 // Function represents a callable function in the AMEL engine.
 type Function struct {
-	Name      string
-	Signature *types.FunctionSignature
-	BuiltIn   BuiltInFunc // For Go built-in functions
-	JSBody    string      // For user-defined JS functions
-	Pure      bool        // Whether the function has no side effects
+	Name       string
+	Signature  *types.FunctionSignature
+	BuiltIn    BuiltInFunc    // For Go built-in functions
+	Lazy       LazyFunc       // For Go built-in functions with lazy arguments
+	Context    ContextFunc    // For Go built-in functions using the evaluation state
+	Cancelable CancelableFunc // For Go built-in functions that stop on timeout
+	JSBody     string         // For user-defined JS functions
+	LuaBody    string         // For user-defined Lua functions, which run through Context
+	Pure       bool           // Whether the function has no side effects
 }
 
 // OverloadedFunction represents a function with multiple overloads.
@@ -29,7 +85,18 @@ type OverloadedFunction struct {
 
 // IsBuiltIn returns true if this is a built-in Go function.
 func (f *Function) IsBuiltIn() bool {
-	return f.BuiltIn != nil
+	return (f.BuiltIn != nil || f.Lazy != nil || f.Context != nil || f.Cancelable != nil) && !f.IsLua()
+}
+
+// IsLazy returns true if this is a built-in Go function with lazy arguments.
+func (f *Function) IsLazy() bool {
+	return f.Lazy != nil
+}
+
+// IsContextual returns true if this is a built-in Go function using the
+// evaluation state.
+func (f *Function) IsContextual() bool {
+	return f.Context != nil
 }
 
 // IsJS returns true if this is a user-defined JavaScript function.
@@ -37,19 +104,67 @@ func (f *Function) IsJS() bool {
 	return f.JSBody != ""
 }
 
+// IsLua returns true if this is a user-defined Lua function.
+func (f *Function) IsLua() bool {
+	return f.LuaBody != ""
+}
+
 // Registry manages function registration and lookup.
+//
+// A registry is safe for concurrent use. Reads use an immutable snapshot of
+// the functions and never block; a registration copies the snapshot, changes
+// the copy, and publishes it, so evaluations in progress keep seeing the
+// functions they started with.
 type Registry struct {
-	mu                  sync.RWMutex
+	mu       sync.Mutex // Serializes writers
+	snapshot atomic.Pointer[registrySnapshot]
+}
+
+// registrySnapshot is the state of a registry. It is never modified once
+// published; an OverloadedFunction in it is replaced rather than changed.
+type registrySnapshot struct {
 	functions           map[string]*Function
 	overloadedFunctions map[string]*OverloadedFunction
 }
 
 // NewRegistry creates a new function registry.
 func NewRegistry() *Registry {
-	return &Registry{
+	r := &Registry{}
+	r.snapshot.Store(&registrySnapshot{
 		functions:           make(map[string]*Function),
 		overloadedFunctions: make(map[string]*OverloadedFunction),
+	})
+	return r
+}
+
+// load returns the current snapshot.
+func (r *Registry) load() *registrySnapshot {
+	return r.snapshot.Load()
+}
+
+// update applies fn to a copy of the current snapshot and publishes the copy
+// if fn succeeds.
+func (r *Registry) update(fn func(s *registrySnapshot) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.load()
+	next := &registrySnapshot{
+		functions:           make(map[string]*Function, len(current.functions)+1),
+		overloadedFunctions: make(map[string]*OverloadedFunction, len(current.overloadedFunctions)),
+	}
+	for name, f := range current.functions {
+		next.functions[name] = f
+	}
+	for name, overloaded := range current.overloadedFunctions {
+		next.overloadedFunctions[name] = overloaded
+	}
+
+	if err := fn(next); err != nil {
+		return err
 	}
+	r.snapshot.Store(next)
+	return nil
 }
 
 // Register adds a function to the registry.
@@ -61,15 +176,36 @@ func (r *Registry) Register(fn *Function) error {
 		return errors.New(errors.ErrInvalidSyntax, "function name cannot be empty")
 	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	return r.update(func(s *registrySnapshot) error {
+		if _, exists := s.functions[fn.Name]; exists {
+			return errors.Newf(errors.ErrInvalidSyntax, "function '%s' is already registered", fn.Name)
+		}
+		s.functions[fn.Name] = fn
+		return nil
+	})
+}
 
-	if _, exists := r.functions[fn.Name]; exists {
-		return errors.Newf(errors.ErrInvalidSyntax, "function '%s' is already registered", fn.Name)
+// RegisterAll adds several functions to the registry in one step. Either all
+// of them are registered or, if one is invalid or its name is taken, none is.
+func (r *Registry) RegisterAll(fns ...*Function) error {
+	for _, fn := range fns {
+		if fn == nil {
+			return errors.New(errors.ErrInvalidSyntax, "cannot register nil function")
+		}
+		if fn.Name == "" {
+			return errors.New(errors.ErrInvalidSyntax, "function name cannot be empty")
+		}
 	}
 
-	r.functions[fn.Name] = fn
-	return nil
+	return r.update(func(s *registrySnapshot) error {
+		for _, fn := range fns {
+			if _, exists := s.functions[fn.Name]; exists {
+				return errors.Newf(errors.ErrInvalidSyntax, "function '%s' is already registered", fn.Name)
+			}
+			s.functions[fn.Name] = fn
+		}
+		return nil
+	})
 }
 
 // RegisterOverload adds a function overload to the registry.
@@ -85,41 +221,45 @@ func (r *Registry) RegisterOverload(fn *Function) error {
 		return errors.New(errors.ErrInvalidSyntax, "overloaded function must have a signature")
 	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	// Check if there's already an overloaded function with this name
-	if overloaded, exists := r.overloadedFunctions[fn.Name]; exists {
-		// Check for duplicate signature
-		for _, existing := range overloaded.Overloads {
-			if signaturesMatch(existing.Signature, fn.Signature) {
-				return errors.Newf(errors.ErrInvalidSyntax, "function '%s' with same signature already registered", fn.Name)
+	return r.update(func(s *registrySnapshot) error {
+		// Check if there's already an overloaded function with this name
+		if overloaded, exists := s.overloadedFunctions[fn.Name]; exists {
+			// Check for duplicate signature
+			for _, existing := range overloaded.Overloads {
+				if signaturesMatch(existing.Signature, fn.Signature) {
+					return errors.Newf(errors.ErrInvalidSyntax, "function '%s' with same signature already registered", fn.Name)
+				}
+			}
+			overloads := make([]*Function, len(overloaded.Overloads), len(overloaded.Overloads)+1)
+			copy(overloads, overloaded.Overloads)
+			s.overloadedFunctions[fn.Name] = &OverloadedFunction{
+				Name:      fn.Name,
+				Overloads: append(overloads, fn),
 			}
+			return nil
 		}
-		overloaded.Overloads = append(overloaded.Overloads, fn)
-		return nil
-	}
 
-	// Check if there's a non-overloaded function with this name
-	if existing, exists := r.functions[fn.Name]; exists {
-		// Convert to overloaded function
-		if existing.Signature == nil {
-			return errors.Newf(errors.ErrInvalidSyntax, "cannot add overload to function '%s' without signature", fn.Name)
+		// Check if there's a non-overloaded function with this name
+		if existing, exists := s.functions[fn.Name]; exists {
+			// Convert to overloaded function
+			if existing.Signature == nil {
+				return errors.Newf(errors.ErrInvalidSyntax, "cannot add overload to function '%s' without signature", fn.Name)
+			}
+			s.overloadedFunctions[fn.Name] = &OverloadedFunction{
+				Name:      fn.Name,
+				Overloads: []*Function{existing, fn},
+			}
+			delete(s.functions, fn.Name)
+			return nil
 		}
-		r.overloadedFunctions[fn.Name] = &OverloadedFunction{
+
+		// Create new overloaded function
+		s.overloadedFunctions[fn.Name] = &OverloadedFunction{
 			Name:      fn.Name,
-			Overloads: []*Function{existing, fn},
+			Overloads: []*Function{fn},
 		}
-		delete(r.functions, fn.Name)
 		return nil
-	}
-
-	// Create new overloaded function
-	r.overloadedFunctions[fn.Name] = &OverloadedFunction{
-		Name:      fn.Name,
-		Overloads: []*Function{fn},
-	}
-	return nil
+	})
 }
 
 // signaturesMatch checks if two function signatures match (same parameter types).
@@ -151,16 +291,37 @@ func (r *Registry) RegisterBuiltIn(name string, fn BuiltInFunc, sig *types.Funct
 	})
 }
 
+// RegisterLazy registers a built-in Go function that receives its arguments
+// unevaluated. Lazy functions cannot be overloaded.
+func (r *Registry) RegisterLazy(name string, fn LazyFunc, sig *types.FunctionSignature) error {
+	return r.Register(&Function{
+		Name:      name,
+		Signature: sig,
+		Lazy:      fn,
+		Pure:      true,
+	})
+}
+
+// RegisterContextual registers a built-in Go function that receives the
+// evaluation context. Such functions depend on the payload, so they are not
+// pure.
+func (r *Registry) RegisterContextual(name string, fn ContextFunc, sig *types.FunctionSignature) error {
+	return r.Register(&Function{
+		Name:      name,
+		Signature: sig,
+		Context:   fn,
+	})
+}
+
 // Get retrieves a function by name.
 // For overloaded functions, returns the first overload.
 func (r *Registry) Get(name string) (*Function, bool) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
-	if fn, ok := r.functions[name]; ok {
+	if fn, ok := s.functions[name]; ok {
 		return fn, true
 	}
-	if overloaded, ok := r.overloadedFunctions[name]; ok && len(overloaded.Overloads) > 0 {
+	if overloaded, ok := s.overloadedFunctions[name]; ok && len(overloaded.Overloads) > 0 {
 		return overloaded.Overloads[0], true
 	}
 	return nil, false
@@ -168,14 +329,13 @@ func (r *Registry) Get(name string) (*Function, bool) {
 
 // GetOverloaded retrieves all overloads of a function by name.
 func (r *Registry) GetOverloaded(name string) (*OverloadedFunction, bool) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
-	if overloaded, ok := r.overloadedFunctions[name]; ok {
+	if overloaded, ok := s.overloadedFunctions[name]; ok {
 		return overloaded, true
 	}
 	// If it's a regular function, wrap it as overloaded
-	if fn, ok := r.functions[name]; ok {
+	if fn, ok := s.functions[name]; ok {
 		return &OverloadedFunction{
 			Name:      name,
 			Overloads: []*Function{fn},
@@ -186,16 +346,15 @@ func (r *Registry) GetOverloaded(name string) (*OverloadedFunction, bool) {
 
 // GetBestMatch retrieves the best matching overload for the given argument types.
 func (r *Registry) GetBestMatch(name string, args []types.Value) (*Function, bool) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
 	// Check regular functions first
-	if fn, ok := r.functions[name]; ok {
+	if fn, ok := s.functions[name]; ok {
 		return fn, true
 	}
 
 	// Check overloaded functions
-	overloaded, ok := r.overloadedFunctions[name]
+	overloaded, ok := s.overloadedFunctions[name]
 	if !ok || len(overloaded.Overloads) == 0 {
 		return nil, false
 	}
@@ -228,10 +387,7 @@ func matchScore(sig *types.FunctionSignature, args []types.Value) int {
 	}
 
 	// Check argument count
-	minArgs := len(sig.Parameters)
-	if sig.Variadic && minArgs > 0 {
-		minArgs--
-	}
+	minArgs := sig.MinArgs()
 
 	if len(args) < minArgs {
 		return -1 // Not enough arguments
@@ -267,55 +423,52 @@ func matchScore(sig *types.FunctionSignature, args []types.Value) int {
 
 // Has checks if a function exists in the registry.
 func (r *Registry) Has(name string) bool {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
-	if _, ok := r.functions[name]; ok {
+	if _, ok := s.functions[name]; ok {
 		return true
 	}
-	_, ok := r.overloadedFunctions[name]
+	_, ok := s.overloadedFunctions[name]
 	return ok
 }
 
 // IsOverloaded checks if a function has multiple overloads.
 func (r *Registry) IsOverloaded(name string) bool {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
-	_, ok := r.overloadedFunctions[name]
+	_, ok := s.overloadedFunctions[name]
 	return ok
 }
 
 // Unregister removes a function from the registry.
 func (r *Registry) Unregister(name string) bool {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if _, exists := r.functions[name]; exists {
-		delete(r.functions, name)
-		return true
-	}
-	if _, exists := r.overloadedFunctions[name]; exists {
-		delete(r.overloadedFunctions, name)
-		return true
-	}
-	return false
+	removed := false
+	r.update(func(s *registrySnapshot) error {
+		if _, exists := s.functions[name]; exists {
+			delete(s.functions, name)
+			removed = true
+		} else if _, exists := s.overloadedFunctions[name]; exists {
+			delete(s.overloadedFunctions, name)
+			removed = true
+		}
+		return nil
+	})
+	return removed
 }
 
 // List returns all registered function names.
 func (r *Registry) List() []string {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
 	seen := make(map[string]bool)
-	names := make([]string, 0, len(r.functions)+len(r.overloadedFunctions))
-	for name := range r.functions {
+	names := make([]string, 0, len(s.functions)+len(s.overloadedFunctions))
+	for name := range s.functions {
 		if !seen[name] {
 			names = append(names, name)
 			seen[name] = true
 		}
 	}
-	for name := range r.overloadedFunctions {
+	for name := range s.overloadedFunctions {
 		if !seen[name] {
 			names = append(names, name)
 			seen[name] = true
@@ -326,16 +479,15 @@ func (r *Registry) List() []string {
 
 // ListSignatures returns all registered function signatures.
 func (r *Registry) ListSignatures() []*types.FunctionSignature {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
-	sigs := make([]*types.FunctionSignature, 0, len(r.functions)+len(r.overloadedFunctions)*2)
-	for _, fn := range r.functions {
+	sigs := make([]*types.FunctionSignature, 0, len(s.functions)+len(s.overloadedFunctions)*2)
+	for _, fn := range s.functions {
 		if fn.Signature != nil {
 			sigs = append(sigs, fn.Signature)
 		}
 	}
-	for _, overloaded := range r.overloadedFunctions {
+	for _, overloaded := range s.overloadedFunctions {
 		for _, fn := range overloaded.Overloads {
 			if fn.Signature != nil {
 				sigs = append(sigs, fn.Signature)
@@ -347,15 +499,14 @@ func (r *Registry) ListSignatures() []*types.FunctionSignature {
 
 // ListOverloads returns all overloads for a function name.
 func (r *Registry) ListOverloads(name string) []*Function {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
-	if overloaded, ok := r.overloadedFunctions[name]; ok {
+	if overloaded, ok := s.overloadedFunctions[name]; ok {
 		result := make([]*Function, len(overloaded.Overloads))
 		copy(result, overloaded.Overloads)
 		return result
 	}
-	if fn, ok := r.functions[name]; ok {
+	if fn, ok := s.functions[name]; ok {
 		return []*Function{fn}
 	}
 	return nil
@@ -363,7 +514,15 @@ func (r *Registry) ListOverloads(name string) []*Function {
 
 // Call invokes a function by name with the given arguments.
 // For overloaded functions, it selects the best matching overload.
+// Context-aware functions cannot be called without an evaluation context;
+// use CallContext.
 func (r *Registry) Call(name string, args ...types.Value) (types.Value, error) {
+	return r.CallContext(context.Background(), nil, name, args...)
+}
+
+// CallContext invokes a function by name with the given arguments, passing ctx
+// and ec to context-aware functions.
+func (r *Registry) CallContext(ctx context.Context, ec EvalContext, name string, args ...types.Value) (types.Value, error) {
 	fn, ok := r.GetBestMatch(name, args)
 	if !ok {
 		return types.Null(), errors.Newf(errors.ErrUndefinedFunction, "undefined function '%s'", name)
@@ -377,6 +536,36 @@ func (r *Registry) Call(name string, args ...types.Value) (types.Value, error) {
 	}
 
 	// Call the function
+	if fn.IsLazy() {
+		thunks := make([]Thunk, len(args))
+		for i, arg := range args {
+			thunks[i] = Value(arg)
+		}
+		return callLazy(fn, thunks)
+	}
+	if fn.IsContextual() {
+		if ec == nil {
+			return types.Null(), errors.Newf(errors.ErrInvalidSyntax, "function '%s' must be called during an evaluation", name)
+		}
+		result, err := fn.Context(ctx, ec, args...)
+		if err != nil {
+			if _, ok := err.(*errors.Error); ok {
+				return types.Null(), err
+			}
+			return types.Null(), errors.Wrap(errors.ErrFunctionPanic, fmt.Sprintf("function '%s' failed: %v", name, err), err)
+		}
+		return result, nil
+	}
+	if fn.Cancelable != nil {
+		result, err := fn.Cancelable(ctx, args...)
+		if err != nil {
+			if errors.IsCode(err, errors.ErrTimeout) || errors.IsCode(err, errors.ErrRegexDenied) {
+				return types.Null(), err
+			}
+			return types.Null(), errors.Wrap(errors.ErrFunctionPanic, fmt.Sprintf("function '%s' failed: %v", name, err), err)
+		}
+		return result, nil
+	}
 	if fn.IsBuiltIn() {
 		result, err := fn.BuiltIn(args...)
 		if err != nil {
@@ -389,15 +578,69 @@ func (r *Registry) Call(name string, args ...types.Value) (types.Value, error) {
 	return types.Null(), errors.Newf(errors.ErrInvalidSyntax, "JS function '%s' must be called via sandbox", name)
 }
 
-// Clone creates a copy of the registry.
-func (r *Registry) Clone() *Registry {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// CallLazy invokes a lazy function by name with unevaluated arguments. Only
+// the argument count is validated, since the arguments have no values yet.
+func (r *Registry) CallLazy(name string, args ...Thunk) (types.Value, error) {
+	fn, ok := r.Get(name)
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrUndefinedFunction, "undefined function '%s'", name)
+	}
+	if !fn.IsLazy() {
+		return types.Null(), errors.Newf(errors.ErrInvalidSyntax, "function '%s' does not take lazy arguments", name)
+	}
+
+	if fn.Signature != nil {
+		if err := fn.Signature.ValidateArgCount(len(args)); err != nil {
+			return types.Null(), errors.Wrap(errors.ErrArgumentCount, err.Error(), err)
+		}
+	}
+
+	return callLazy(fn, args)
+}
 
-	clone := NewRegistry()
-	for name, fn := range r.functions {
-		clone.functions[name] = fn
+// callLazy calls a lazy function. Errors returned by the arguments, such as a
+// division by zero, keep their code; other errors are reported as a failure
+// of the function.
+func callLazy(fn *Function, args []Thunk) (types.Value, error) {
+	result, err := fn.Lazy(args...)
+	if err != nil {
+		if _, ok := err.(*errors.Error); ok {
+			return types.Null(), err
+		}
+		return types.Null(), errors.Wrap(errors.ErrFunctionPanic, fmt.Sprintf("function '%s' failed: %v", fn.Name, err), err)
+	}
+	return result, nil
+}
+
+// Value returns a thunk for an already evaluated value.
+func Value(v types.Value) Thunk {
+	return func() (types.Value, error) {
+		return v, nil
+	}
+}
+
+// Memoize returns a thunk that calls fn at most once.
+func Memoize(fn func() (types.Value, error)) Thunk {
+	var (
+		done  bool
+		value types.Value
+		err   error
+	)
+	return func() (types.Value, error) {
+		if !done {
+			value, err = fn()
+			done = true
+		}
+		return value, err
 	}
+}
+
+// Clone creates a copy of the registry. The copy shares the current snapshot
+// with r, so cloning is cheap; registrations in either registry do not affect
+// the other.
+func (r *Registry) Clone() *Registry {
+	clone := &Registry{}
+	clone.snapshot.Store(r.load())
 	return clone
 }
 
@@ -408,18 +651,16 @@ func (r *Registry) Merge(other *Registry) {
 		return
 	}
 
-	other.mu.RLock()
-	defer other.mu.RUnlock()
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	for name, fn := range other.functions {
-		r.functions[name] = fn
-	}
-	for name, overloaded := range other.overloadedFunctions {
-		r.overloadedFunctions[name] = overloaded
-	}
+	o := other.load()
+	r.update(func(s *registrySnapshot) error {
+		for name, fn := range o.functions {
+			s.functions[name] = fn
+		}
+		for name, overloaded := range o.overloadedFunctions {
+			s.overloadedFunctions[name] = overloaded
+		}
+		return nil
+	})
 }
 
 // Clear removes all functions from the registry.
@@ -427,17 +668,18 @@ func (r *Registry) Clear() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.functions = make(map[string]*Function)
-	r.overloadedFunctions = make(map[string]*OverloadedFunction)
+	r.snapshot.Store(&registrySnapshot{
+		functions:           make(map[string]*Function),
+		overloadedFunctions: make(map[string]*OverloadedFunction),
+	})
 }
 
 // Count returns the number of registered functions (including overloads).
 func (r *Registry) Count() int {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
-	count := len(r.functions)
-	for _, overloaded := range r.overloadedFunctions {
+	count := len(s.functions)
+	for _, overloaded := range s.overloadedFunctions {
 		count += len(overloaded.Overloads)
 	}
 	return count
@@ -445,8 +687,7 @@ func (r *Registry) Count() int {
 
 // CountUnique returns the number of unique function names.
 func (r *Registry) CountUnique() int {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+	s := r.load()
 
-	return len(r.functions) + len(r.overloadedFunctions)
+	return len(s.functions) + len(s.overloadedFunctions)
 }
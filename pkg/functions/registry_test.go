@@ -0,0 +1,102 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func constantFunction(name string, value types.Value) *Function {
+	return &Function{
+		Name:      name,
+		Signature: types.NewFunctionSignature(name, value.Type),
+		BuiltIn:   func(...types.Value) (types.Value, error) { return value, nil },
+		Pure:      true,
+	}
+}
+
+func TestRegistry_RegisterAll(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.RegisterAll(
+		constantFunction("one", types.Int(1)),
+		constantFunction("two", types.Int(2)),
+	))
+	assert.Equal(t, 2, r.Count())
+
+	// A taken name rejects the whole batch
+	err := r.RegisterAll(constantFunction("three", types.Int(3)), constantFunction("one", types.Int(1)))
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+	assert.False(t, r.Has("three"))
+
+	// So does a duplicate within the batch
+	err = r.RegisterAll(constantFunction("four", types.Int(4)), constantFunction("four", types.Int(4)))
+	assert.Error(t, err)
+	assert.False(t, r.Has("four"))
+
+	assert.Error(t, r.RegisterAll(nil))
+}
+
+func TestRegistry_CloneIsIndependent(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	clone := r.Clone()
+	assert.Equal(t, r.Count(), clone.Count())
+
+	require.NoError(t, clone.RegisterBuiltIn("tenantOnly", func(...types.Value) (types.Value, error) {
+		return types.Bool(true), nil
+	}, nil))
+	assert.True(t, clone.Unregister("upper"))
+	require.NoError(t, r.RegisterBuiltIn("parentOnly", func(...types.Value) (types.Value, error) {
+		return types.Bool(true), nil
+	}, nil))
+
+	assert.True(t, clone.Has("tenantOnly"))
+	assert.False(t, r.Has("tenantOnly"))
+	assert.True(t, r.Has("upper"))
+	assert.False(t, clone.Has("upper"))
+	assert.False(t, clone.Has("parentOnly"))
+}
+
+func TestRegistry_ConcurrentReadsAndWrites(t *testing.T) {
+	r, err := NewDefaultRegistry()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				name := fmt.Sprintf("fn_%d_%d", i, j)
+				assert.NoError(t, r.Register(constantFunction(name, types.Int(int64(j)))))
+				if j%2 == 0 {
+					r.Unregister(name)
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				result, err := r.Call("upper", types.String("amel"))
+				assert.NoError(t, err)
+				assert.Equal(t, "AMEL", result.Raw)
+				r.List()
+				r.Clone().Count()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, r.Has("fn_0_99"))
+	assert.False(t, r.Has("fn_0_98"))
+}
@@ -0,0 +1,75 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// builtinRolloutBucket reports whether a key falls in the first percentage
+// of 100 buckets, so that rolloutBucket($.userId, 25) holds for a stable
+// quarter of the users. The bucket is the 32-bit FNV-1a hash of the key,
+// prefixed with the salt and a colon if one is given, modulo 10000, divided
+// by 100: a number in [0, 100) with two decimals. Raising the percentage only
+// adds keys; a different salt, such as the name of the feature, picks
+// independent keys. A null key is never in the rollout.
+func builtinRolloutBucket(args ...types.Value) (types.Value, error) {
+	if len(args) < 2 {
+		return types.Null(), errors.New(errors.ErrArgumentCount, "rolloutBucket requires 2 arguments: key, percentage")
+	}
+	if args[0].IsNull() {
+		return types.Bool(false), nil
+	}
+
+	key, err := rolloutKey(args[0])
+	if err != nil {
+		return types.Null(), err
+	}
+	percentage, ok := args[1].AsFloat()
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrArgumentType, "rolloutBucket percentage must be a number, got %s", args[1].Type)
+	}
+	if len(args) > 2 {
+		salt, ok := args[2].AsString()
+		if !ok {
+			return types.Null(), errors.Newf(errors.ErrArgumentType, "rolloutBucket salt must be a string, got %s", args[2].Type)
+		}
+		key = salt + ":" + key
+	}
+
+	return types.Bool(RolloutBucket(key) < percentage), nil
+}
+
+// RolloutBucket returns the bucket of a key used by rolloutBucket, in
+// [0, 100), for hosts that assign keys to rollouts outside of expressions.
+func RolloutBucket(key string) float64 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return float64(h.Sum32()%10000) / 100
+}
+
+// rolloutKey converts a key to the string that is hashed. Whole floats are
+// written without a fraction, so that 42 and 42.0 are in the same bucket.
+func rolloutKey(key types.Value) (string, error) {
+	if key.Type == types.TypeAny {
+		key = types.NewValue(key.Raw)
+	}
+	switch key.Type {
+	case types.TypeString:
+		s, _ := key.AsString()
+		return s, nil
+	case types.TypeInt:
+		n, _ := key.AsInt()
+		return strconv.FormatInt(n, 10), nil
+	case types.TypeFloat:
+		f, _ := key.AsFloat()
+		if f == float64(int64(f)) {
+			return strconv.FormatInt(int64(f), 10), nil
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	return "", errors.Newf(errors.ErrArgumentType, "rolloutBucket key must be a string or a number, got %s", key.Type)
+}
@@ -0,0 +1,55 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinRolloutBucket(t *testing.T) {
+	in := func(args ...types.Value) bool {
+		t.Helper()
+		result, err := builtinRolloutBucket(args...)
+		require.NoError(t, err)
+		return result.Raw.(bool)
+	}
+
+	bucket := RolloutBucket("user-1")
+	assert.GreaterOrEqual(t, bucket, 0.0)
+	assert.Less(t, bucket, 100.0)
+	assert.Equal(t, bucket, RolloutBucket("user-1"), "stable")
+	assert.True(t, in(types.String("user-1"), types.Float(bucket+0.01)))
+	assert.False(t, in(types.String("user-1"), types.Float(bucket)))
+
+	assert.False(t, in(types.String("user-1"), types.Int(0)))
+	assert.True(t, in(types.String("user-1"), types.Int(100)))
+	assert.False(t, in(types.Null(), types.Int(100)), "a null key is never in the rollout")
+	assert.Equal(t, in(types.String("42"), types.Int(50)), in(types.Int(42), types.Int(50)))
+	assert.Equal(t, in(types.Float(42), types.Int(50)), in(types.Int(42), types.Int(50)))
+
+	// About a quarter of the keys, and a different quarter with a salt
+	inRollout, inBoth := 0, 0
+	for i := 0; i < 10000; i++ {
+		key := types.String(fmt.Sprintf("user-%d", i))
+		plain := in(key, types.Int(25))
+		salted := in(key, types.Int(25), types.String("new-checkout"))
+		if plain {
+			inRollout++
+		}
+		if plain && salted {
+			inBoth++
+		}
+	}
+	assert.InDelta(t, 2500, inRollout, 250)
+	assert.InDelta(t, 625, inBoth, 150)
+
+	_, err := builtinRolloutBucket(types.List(), types.Int(10))
+	assert.True(t, errors.IsCode(err, errors.ErrArgumentType))
+	_, err = builtinRolloutBucket(types.String("user-1"), types.String("ten"))
+	assert.True(t, errors.IsCode(err, errors.ErrArgumentType))
+}
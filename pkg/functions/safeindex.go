@@ -0,0 +1,18 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import "context"
+
+type safeIndexKey struct{}
+
+// WithSafeIndex returns a context in which the at function gives null for an
+// index beyond either end of its list instead of failing.
+func WithSafeIndex(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, safeIndexKey{}, enabled)
+}
+
+// safeIndex reports whether ctx gives null for out-of-range indices.
+func safeIndex(ctx context.Context) bool {
+	enabled, _ := ctx.Value(safeIndexKey{}).(bool)
+	return enabled
+}
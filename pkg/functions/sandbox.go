@@ -4,7 +4,10 @@ package functions
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bencagri/amel/internal/errors"
@@ -15,16 +18,18 @@ import (
 // SandboxConfig defines configuration for the JavaScript sandbox.
 type SandboxConfig struct {
 	Timeout       time.Duration // Maximum execution time
-	MemoryLimit   int64         // Maximum memory in bytes (informational, not enforced by goja)
+	MemoryLimit   int64         // Maximum growth of the process heap in bytes during an execution; 0, the default, disables the check
 	MaxStackDepth int           // Maximum call stack depth
 	AllowedAPIs   []string      // List of allowed global APIs
+	PoolSize      int           // Idle VMs kept for reuse; 0 means GOMAXPROCS
+	StateLimit    int64         // Bytes JS functions may keep in amel.state across calls; 0 keeps them stateless
+	PayloadAccess bool          // Lets JS functions read the calling evaluation with amel.payload and amel.path
 }
 
 // DefaultSandboxConfig returns the default sandbox configuration.
 func DefaultSandboxConfig() *SandboxConfig {
 	return &SandboxConfig{
 		Timeout:       100 * time.Millisecond,
-		MemoryLimit:   10 * 1024 * 1024, // 10MB
 		MaxStackDepth: 100,
 		AllowedAPIs:   []string{"Math", "JSON", "Array", "Object", "String", "Number", "Boolean", "Date", "RegExp"},
 	}
@@ -34,50 +39,109 @@ func DefaultSandboxConfig() *SandboxConfig {
 type Sandbox struct {
 	config *SandboxConfig
 	pool   *vmPool
+
+	programs sync.Map // Function source to its compiled *goja.Program
+
+	modulesMu  sync.RWMutex
+	modules    map[string]*jsModule
+	modulesGen atomic.Uint64 // Incremented when modules change
+
+	state *jsState
+	usage sandboxUsage
+}
+
+// ScriptSandbox runs user-defined functions written in a scripting language.
+// Sandbox runs JavaScript and LuaSandbox runs Lua.
+type ScriptSandbox interface {
+	// Execute defines the function in source and calls it by name.
+	Execute(ctx context.Context, source string, funcName string, args []types.Value) (types.Value, error)
+	// ExecuteExpression evaluates an expression of the language.
+	ExecuteExpression(ctx context.Context, expr string) (types.Value, error)
+	// Stats returns the usage statistics of the sandbox.
+	Stats() SandboxStats
+}
+
+var _ ScriptSandbox = (*Sandbox)(nil)
+
+// sandboxUsage counts the executions of a sandbox.
+type sandboxUsage struct {
+	executions atomic.Uint64
+	failures   atomic.Uint64
+	timeouts   atomic.Uint64
+	overMemory atomic.Uint64
+	busy       atomic.Int64 // Nanoseconds spent executing
+}
+
+// SandboxStats reports how much the sandbox has been used.
+type SandboxStats struct {
+	Executions uint64        `json:"executions"` // Functions and expressions run
+	Failures   uint64        `json:"failures"`   // Executions that returned an error, including timeouts
+	Timeouts   uint64        `json:"timeouts"`   // Executions interrupted by the timeout or a cancelled context
+	OverMemory uint64        `json:"overMemory"` // Executions interrupted by the memory limit
+	Busy       time.Duration `json:"busyNs"`     // Total time spent executing scripts
+	PooledVMs  int           `json:"pooledVMs"`  // Idle VMs kept for reuse
+	CreatedVMs uint64        `json:"createdVMs"` // VMs created, including those not kept
+}
+
+// sandboxVM is a pooled goja VM together with the function definitions it
+// has already run, so repeated calls skip re-running the definitions.
+type sandboxVM struct {
+	vm      *goja.Runtime
+	defined map[string]string          // Function name to the source that defined it
+	exports map[string]*moduleInstance // Modules loaded with require
+
+	modulesGen uint64 // Sandbox.modulesGen when exports was last valid
+
+	console  ConsoleFunc // Console output of the current execution, if wanted
+	function string      // Name of the JS function being executed
+	eval     EvalContext // Evaluation calling the current execution, if any
 }
 
 // vmPool manages a pool of goja VMs for reuse.
 type vmPool struct {
-	mu   sync.Mutex
-	vms  []*goja.Runtime
-	max  int
-	init func(*goja.Runtime)
+	mu      sync.Mutex
+	vms     []*sandboxVM
+	max     int
+	init    func(*sandboxVM)
+	created atomic.Uint64
 }
 
 // newVMPool creates a new VM pool.
-func newVMPool(max int, initFn func(*goja.Runtime)) *vmPool {
+func newVMPool(max int, initFn func(*sandboxVM)) *vmPool {
 	return &vmPool{
-		vms:  make([]*goja.Runtime, 0, max),
+		vms:  make([]*sandboxVM, 0, max),
 		max:  max,
 		init: initFn,
 	}
 }
 
 // acquire gets a VM from the pool or creates a new one.
-func (p *vmPool) acquire() *goja.Runtime {
+func (p *vmPool) acquire() *sandboxVM {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	if len(p.vms) > 0 {
-		vm := p.vms[len(p.vms)-1]
-		p.vms = p.vms[:len(p.vms)-1]
-		return vm
+	if n := len(p.vms); n > 0 {
+		v := p.vms[n-1]
+		p.vms = p.vms[:n-1]
+		p.mu.Unlock()
+		return v
 	}
+	p.mu.Unlock()
 
-	vm := goja.New()
+	// Create outside the lock so concurrent callers don't wait on each other
+	v := &sandboxVM{vm: goja.New(), defined: make(map[string]string), exports: make(map[string]*moduleInstance)}
 	if p.init != nil {
-		p.init(vm)
+		p.init(v)
 	}
-	return vm
+	p.created.Add(1)
+	return v
 }
 
 // release returns a VM to the pool.
-func (p *vmPool) release(vm *goja.Runtime) {
+func (p *vmPool) release(v *sandboxVM) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	if len(p.vms) < p.max {
-		p.vms = append(p.vms, vm)
+		p.vms = append(p.vms, v)
 	}
 	// If pool is full, let the VM be garbage collected
 }
@@ -89,20 +153,27 @@ func NewSandbox(config *SandboxConfig) *Sandbox {
 	}
 
 	s := &Sandbox{
-		config: config,
+		config:  config,
+		modules: make(map[string]*jsModule),
+		state:   newJSState(),
 	}
 
-	s.pool = newVMPool(10, s.initVM)
+	size := config.PoolSize
+	if size <= 0 {
+		size = runtime.GOMAXPROCS(0)
+	}
+	s.pool = newVMPool(size, s.initVM)
 	return s
 }
 
 // initVM initializes a VM with sandbox restrictions.
-func (s *Sandbox) initVM(vm *goja.Runtime) {
+func (s *Sandbox) initVM(v *sandboxVM) {
+	vm := v.vm
+
 	// Remove dangerous globals
 	restrictedGlobals := []string{
 		"eval",
 		"Function",
-		"require",
 		"module",
 		"exports",
 		"process",
@@ -123,42 +194,90 @@ func (s *Sandbox) initVM(vm *goja.Runtime) {
 		_ = vm.Set(name, goja.Undefined())
 	}
 
-	// Add safe console implementation (limited logging)
-	console := map[string]interface{}{
-		"log":   func(args ...interface{}) {},
-		"info":  func(args ...interface{}) {},
-		"warn":  func(args ...interface{}) {},
-		"error": func(args ...interface{}) {},
-		"debug": func(args ...interface{}) {},
-	}
-	_ = vm.Set("console", console)
+	// Only registered modules can be loaded
+	_ = vm.Set("require", s.requireFunc(v))
+
+	// Console output goes to the console function of the execution, if any
+	installConsole(v)
+
+	// The amel object holds the APIs the sandbox provides
+	amel := vm.NewObject()
+	s.installState(vm, amel)
+	s.installPayload(v, amel)
+	_ = vm.Set("amel", amel)
 
 	// Set stack depth limit
 	vm.SetMaxCallStackSize(s.config.MaxStackDepth)
 }
 
-// Execute runs a JavaScript function with the given arguments.
-func (s *Sandbox) Execute(ctx context.Context, jsBody string, funcName string, args []types.Value) (types.Value, error) {
-	vm := s.pool.acquire()
-	defer s.pool.release(vm)
+// Stats returns the usage statistics of the sandbox.
+func (s *Sandbox) Stats() SandboxStats {
+	s.pool.mu.Lock()
+	pooled := len(s.pool.vms)
+	s.pool.mu.Unlock()
 
-	// Re-initialize VM to ensure clean state
-	s.initVM(vm)
+	stats := s.usage.stats()
+	stats.PooledVMs = pooled
+	stats.CreatedVMs = s.pool.created.Load()
+	return stats
+}
 
-	// Set up interrupt for timeout
-	done := make(chan struct{})
-	defer close(done)
+// stats returns the counted statistics.
+func (u *sandboxUsage) stats() SandboxStats {
+	return SandboxStats{
+		Executions: u.executions.Load(),
+		Failures:   u.failures.Load(),
+		Timeouts:   u.timeouts.Load(),
+		OverMemory: u.overMemory.Load(),
+		Busy:       time.Duration(u.busy.Load()),
+	}
+}
 
-	go func() {
-		select {
-		case <-ctx.Done():
-			vm.Interrupt("execution timeout")
-		case <-time.After(s.config.Timeout):
-			vm.Interrupt("execution timeout")
-		case <-done:
-			// Execution completed normally
+// record updates the usage statistics after an execution.
+func (u *sandboxUsage) record(start time.Time, err error) {
+	u.executions.Add(1)
+	u.busy.Add(int64(time.Since(start)))
+	if err != nil {
+		u.failures.Add(1)
+		if errors.IsCode(err, errors.ErrTimeout) {
+			u.timeouts.Add(1)
 		}
-	}()
+		if errors.IsCode(err, errors.ErrMemoryLimit) {
+			u.overMemory.Add(1)
+		}
+	}
+}
+
+// Execute runs a JavaScript function with the given arguments.
+func (s *Sandbox) Execute(ctx context.Context, jsBody string, funcName string, args []types.Value) (types.Value, error) {
+	start := time.Now()
+	value, err := s.execute(ctx, jsBody, funcName, args)
+	s.usage.record(start, err)
+	return value, err
+}
+
+func (s *Sandbox) execute(ctx context.Context, jsBody string, funcName string, args []types.Value) (_ types.Value, err error) {
+	v := s.pool.acquire()
+	vm := v.vm
+	v.console, v.function, v.eval = consoleFrom(ctx), funcName, evalContextFrom(ctx)
+	defer func() { s.finish(v, err) }()
+	defer s.watch(ctx, vm)()
+
+	// Define the function unless this VM already ran the same definition
+	if v.defined[funcName] != jsBody {
+		program, err := s.compile(jsBody)
+		if err == nil {
+			_, err = vm.RunProgram(program)
+		}
+		if err != nil {
+			delete(v.defined, funcName)
+			if jsErr, ok := err.(*goja.InterruptedError); ok {
+				return types.Null(), interruptError(jsErr)
+			}
+			return types.Null(), errors.Wrap(errors.ErrSandboxViolation, fmt.Sprintf("failed to compile JS function: %v", err), err)
+		}
+		v.defined[funcName] = jsBody
+	}
 
 	// Convert arguments to JavaScript values
 	jsArgs := make([]goja.Value, len(args))
@@ -166,12 +285,6 @@ func (s *Sandbox) Execute(ctx context.Context, jsBody string, funcName string, a
 		jsArgs[i] = s.valueToJS(vm, arg)
 	}
 
-	// Run the function definition
-	_, err := vm.RunString(jsBody)
-	if err != nil {
-		return types.Null(), errors.Wrap(errors.ErrSandboxViolation, fmt.Sprintf("failed to compile JS function: %v", err), err)
-	}
-
 	// Get the function
 	fn := vm.Get(funcName)
 	if fn == nil || goja.IsUndefined(fn) || goja.IsNull(fn) {
@@ -187,45 +300,153 @@ func (s *Sandbox) Execute(ctx context.Context, jsBody string, funcName string, a
 	result, err := callable(goja.Undefined(), jsArgs...)
 	if err != nil {
 		if jsErr, ok := err.(*goja.InterruptedError); ok {
-			return types.Null(), errors.Newf(errors.ErrTimeout, "JS execution interrupted: %v", jsErr.Value())
+			return types.Null(), interruptError(jsErr)
 		}
 		return types.Null(), errors.Wrap(errors.ErrSandboxViolation, fmt.Sprintf("JS execution failed: %v", err), err)
 	}
 
+	result, err = settle(result)
+	if err != nil {
+		return types.Null(), err
+	}
+
 	// Convert result back to AMEL Value
 	return s.jsToValue(result), nil
 }
 
-// ExecuteExpression runs a JavaScript expression and returns the result.
-func (s *Sandbox) ExecuteExpression(ctx context.Context, expr string) (types.Value, error) {
-	vm := s.pool.acquire()
-	defer s.pool.release(vm)
+// compile returns the compiled program for a function source. Programs are
+// shared by all VMs of the sandbox, so each source is parsed once.
+func (s *Sandbox) compile(source string) (*goja.Program, error) {
+	if program, ok := s.programs.Load(source); ok {
+		return program.(*goja.Program), nil
+	}
+	program, err := goja.Compile("", source, false)
+	if err != nil {
+		return nil, err
+	}
+	s.programs.Store(source, program)
+	return program, nil
+}
 
-	// Re-initialize VM
-	s.initVM(vm)
+// watch interrupts the VM when the context is cancelled, the timeout
+// elapses, or the execution exceeds the memory limit. The returned function
+// stops watching and clears any interrupt, so the VM can be reused.
+func (s *Sandbox) watch(ctx context.Context, vm *goja.Runtime) func() {
+	vm.SetMaxCallStackSize(s.config.MaxStackDepth)
 
-	// Set up interrupt
 	done := make(chan struct{})
-	defer close(done)
+	stopped := make(chan struct{})
+	timer := time.NewTimer(s.config.Timeout)
+
+	// Only check memory when a limit is set; a nil channel never fires
+	var meter *heapMeter
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if limit := s.config.MemoryLimit; limit > 0 {
+		meter = newHeapMeter(limit)
+		ticker = time.NewTicker(memoryCheckInterval)
+		tick = ticker.C
+	}
 
 	go func() {
-		select {
-		case <-ctx.Done():
-			vm.Interrupt("execution timeout")
-		case <-time.After(s.config.Timeout):
-			vm.Interrupt("execution timeout")
-		case <-done:
+		defer close(stopped)
+		for {
+			select {
+			case <-ctx.Done():
+				vm.Interrupt("execution timeout")
+			case <-timer.C:
+				vm.Interrupt("execution timeout")
+			case <-tick:
+				if !meter.exceeded() {
+					continue
+				}
+				vm.Interrupt(memoryInterrupt{limit: meter.limit})
+			case <-done:
+				// Execution completed normally
+			}
+			return
 		}
 	}()
 
+	return func() {
+		timer.Stop()
+		if ticker != nil {
+			ticker.Stop()
+		}
+		close(done)
+		<-stopped
+		vm.ClearInterrupt()
+	}
+}
+
+// interruptError returns the error for an execution interrupted by watch.
+func interruptError(err *goja.InterruptedError) error {
+	if mem, ok := err.Value().(memoryInterrupt); ok {
+		return errors.Newf(errors.ErrMemoryLimit, "JS execution exceeded the memory limit of %d bytes", mem.limit)
+	}
+	return errors.Newf(errors.ErrTimeout, "JS execution interrupted: %v", err.Value())
+}
+
+// finish returns a VM to the pool after an execution. A VM that was
+// interrupted may have stopped halfway through a definition, or hold the
+// memory that got it interrupted, so it is dropped instead.
+func (s *Sandbox) finish(v *sandboxVM, err error) {
+	v.console, v.function, v.eval = nil, "", nil
+	if errors.IsCode(err, errors.ErrTimeout) || errors.IsCode(err, errors.ErrMemoryLimit) {
+		return
+	}
+	s.pool.release(v)
+}
+
+// settle returns the value of a promise returned by JavaScript code, such as
+// the result of an async function, and any other value unchanged. Promise
+// jobs run before a call returns, within the timeout, so a promise that is
+// still pending waits for something the sandbox does not provide, such as a
+// timer.
+func settle(result goja.Value) (goja.Value, error) {
+	if result == nil || result.ExportType() != reflect.TypeOf((*goja.Promise)(nil)) {
+		return result, nil
+	}
+
+	promise := result.Export().(*goja.Promise)
+	switch promise.State() {
+	case goja.PromiseStateFulfilled:
+		return promise.Result(), nil
+	case goja.PromiseStateRejected:
+		return nil, errors.Newf(errors.ErrSandboxViolation, "JS promise rejected: %v", promise.Result())
+	default:
+		return nil, errors.New(errors.ErrSandboxViolation, "JS promise did not settle; timers and I/O are not available in the sandbox")
+	}
+}
+
+// ExecuteExpression runs a JavaScript expression and returns the result.
+func (s *Sandbox) ExecuteExpression(ctx context.Context, expr string) (types.Value, error) {
+	start := time.Now()
+	value, err := s.executeExpression(ctx, expr)
+	s.usage.record(start, err)
+	return value, err
+}
+
+func (s *Sandbox) executeExpression(ctx context.Context, expr string) (_ types.Value, err error) {
+	v := s.pool.acquire()
+	vm := v.vm
+	v.console, v.eval = consoleFrom(ctx), evalContextFrom(ctx)
+	defer func() { s.finish(v, err) }()
+	defer s.watch(ctx, vm)()
+
 	result, err := vm.RunString(expr)
 	if err != nil {
 		if jsErr, ok := err.(*goja.InterruptedError); ok {
-			return types.Null(), errors.Newf(errors.ErrTimeout, "JS execution interrupted: %v", jsErr.Value())
+			return types.Null(), interruptError(jsErr)
 		}
 		return types.Null(), errors.Wrap(errors.ErrSandboxViolation, fmt.Sprintf("JS expression failed: %v", err), err)
 	}
 
+	result, err = settle(result)
+	if err != nil {
+		return types.Null(), err
+	}
+
 	return s.jsToValue(result), nil
 }
 
@@ -254,6 +475,24 @@ func (s *Sandbox) valueToJS(vm *goja.Runtime, v types.Value) goja.Value {
 			arr[i] = s.valueToJS(vm, elem).Export()
 		}
 		return vm.ToValue(arr)
+	case types.TypeMap:
+		m, ok := v.AsMap()
+		if !ok {
+			return goja.Null()
+		}
+		obj := make(map[string]interface{}, len(m))
+		for key, elem := range m {
+			obj[key] = s.valueToJS(vm, elem).Export()
+		}
+		return vm.ToValue(obj)
+	case types.TypeDateTime:
+		return vm.ToValue(v.Raw.(time.Time).Format(time.RFC3339Nano))
+	case types.TypeDuration:
+		return vm.ToValue(v.Raw.(time.Duration).String())
+	case types.TypeDecimal:
+		// JavaScript has no decimal type
+		f, _ := v.AsFloat()
+		return vm.ToValue(f)
 	default:
 		return vm.ToValue(v.Raw)
 	}
@@ -291,9 +530,6 @@ func (s *Sandbox) jsToValue(v goja.Value) types.Value {
 			elements[i] = types.NewValue(elem)
 		}
 		return types.List(elements...)
-	case map[string]interface{}:
-		// Return as Any type for objects
-		return types.Any(val)
 	default:
 		return types.NewValue(exported)
 	}
@@ -304,7 +540,7 @@ func (s *Sandbox) SetTimeout(d time.Duration) {
 	s.config.Timeout = d
 }
 
-// SetMemoryLimit updates the memory limit (informational).
+// SetMemoryLimit updates the memory limit.
 func (s *Sandbox) SetMemoryLimit(bytes int64) {
 	s.config.MemoryLimit = bytes
 }
@@ -320,183 +556,50 @@ func (s *Sandbox) Config() *SandboxConfig {
 }
 
 // ParseJSFunction parses a JavaScript function definition and extracts metadata.
-// Expected format: function name(param1, param2): returnType { body }
-// The return type annotation is optional and uses a colon prefix.
+// Accepted forms are function declarations, including async ones, and
+// functions or arrow functions bound with const, let, or var:
+//
+//	function name(a, b = 1): returnType { body }
+//	async function name(...items) { body }
+//	const name = (a, { b, c }) => expression
+//
+// Type annotations are optional and use a colon prefix. The returned body is
+// the source ready to run in the sandbox, with type annotations removed.
 func ParseJSFunction(source string) (name string, params []string, returnType types.Type, body string, err error) {
-	// This is a simplified parser. For production, consider using a proper JS parser.
-	// Format: function name(params) { body } or function name(params): type { body }
-
-	// Find "function" keyword
-	const funcKeyword = "function "
-	idx := 0
-	for ; idx < len(source) && (source[idx] == ' ' || source[idx] == '\t' || source[idx] == '\n'); idx++ {
-	}
-
-	if idx+len(funcKeyword) > len(source) || source[idx:idx+len(funcKeyword)] != funcKeyword {
-		return "", nil, types.TypeAny, "", errors.New(errors.ErrInvalidSyntax, "JS function must start with 'function' keyword")
-	}
-	idx += len(funcKeyword)
-
-	// Skip whitespace
-	for ; idx < len(source) && (source[idx] == ' ' || source[idx] == '\t'); idx++ {
-	}
-
-	// Extract function name
-	nameStart := idx
-	for ; idx < len(source) && isIdentChar(source[idx]); idx++ {
-	}
-	name = source[nameStart:idx]
-	if name == "" {
-		return "", nil, types.TypeAny, "", errors.New(errors.ErrInvalidSyntax, "JS function must have a name")
-	}
-
-	// Skip whitespace
-	for ; idx < len(source) && (source[idx] == ' ' || source[idx] == '\t'); idx++ {
-	}
-
-	// Expect '('
-	if idx >= len(source) || source[idx] != '(' {
-		return "", nil, types.TypeAny, "", errors.New(errors.ErrInvalidSyntax, "expected '(' after function name")
-	}
-	idx++
-
-	// Extract parameters
-	params = []string{}
-	for idx < len(source) && source[idx] != ')' {
-		// Skip whitespace and commas
-		for idx < len(source) && (source[idx] == ' ' || source[idx] == '\t' || source[idx] == ',' || source[idx] == '\n') {
-			idx++
-		}
-		if idx < len(source) && source[idx] == ')' {
-			break
-		}
-
-		// Extract parameter name
-		paramStart := idx
-		for idx < len(source) && isIdentChar(source[idx]) {
-			idx++
-		}
-		if idx > paramStart {
-			params = append(params, source[paramStart:idx])
-		}
-
-		// Skip optional type annotation (param: type)
-		for idx < len(source) && (source[idx] == ' ' || source[idx] == '\t') {
-			idx++
-		}
-		if idx < len(source) && source[idx] == ':' {
-			idx++
-			for idx < len(source) && source[idx] != ',' && source[idx] != ')' {
-				idx++
-			}
-		}
-	}
-
-	if idx >= len(source) || source[idx] != ')' {
-		return "", nil, types.TypeAny, "", errors.New(errors.ErrInvalidSyntax, "expected ')' after parameters")
-	}
-	idx++
-
-	// Skip whitespace
-	for idx < len(source) && (source[idx] == ' ' || source[idx] == '\t') {
-		idx++
-	}
-
-	// Check for return type annotation
-	returnType = types.TypeAny
-	if idx < len(source) && source[idx] == ':' {
-		idx++
-		// Skip whitespace
-		for idx < len(source) && (source[idx] == ' ' || source[idx] == '\t') {
-			idx++
-		}
-		// Extract return type
-		typeStart := idx
-		for idx < len(source) && isIdentChar(source[idx]) {
-			idx++
-		}
-		typeName := source[typeStart:idx]
-		returnType = types.ParseType(typeName)
-	}
-
-	// Skip whitespace
-	for idx < len(source) && (source[idx] == ' ' || source[idx] == '\t' || source[idx] == '\n') {
-		idx++
-	}
-
-	// Expect '{'
-	if idx >= len(source) || source[idx] != '{' {
-		return "", nil, types.TypeAny, "", errors.New(errors.ErrInvalidSyntax, "expected '{' for function body")
-	}
-
-	// Find matching '}' for the body
-	braceCount := 1
-	bodyStart := idx
-	idx++
-	for idx < len(source) && braceCount > 0 {
-		if source[idx] == '{' {
-			braceCount++
-		} else if source[idx] == '}' {
-			braceCount--
-		} else if source[idx] == '"' || source[idx] == '\'' || source[idx] == '`' {
-			// Skip string literals
-			quote := source[idx]
-			idx++
-			for idx < len(source) && source[idx] != quote {
-				if source[idx] == '\\' {
-					idx++
-				}
-				idx++
-			}
-		}
-		idx++
+	def, err := parseJSDefinition(source)
+	if err != nil {
+		return "", nil, types.TypeAny, "", err
 	}
 
-	if braceCount != 0 {
-		return "", nil, types.TypeAny, "", errors.New(errors.ErrInvalidSyntax, "unmatched braces in function body")
+	params = make([]string, len(def.params))
+	for i, p := range def.params {
+		params[i] = p.name
 	}
-
-	body = source[bodyStart:idx]
-
-	// Reconstruct full function for execution
-	body = source // Return the full source as body for execution
-
-	return name, params, returnType, body, nil
-}
-
-// isIdentChar returns true if the character can be part of an identifier.
-func isIdentChar(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '$'
+	return def.name, params, def.returnType, def.source, nil
 }
 
 // RegisterJSFunction parses a JS function source and registers it in the registry.
 func (r *Registry) RegisterJSFunction(source string, sandbox *Sandbox) error {
-	name, params, returnType, body, err := ParseJSFunction(source)
+	fn, err := newJSFunction(source)
 	if err != nil {
 		return err
 	}
+	return r.Register(fn)
+}
 
-	// Build parameter definitions
-	paramDefs := make([]types.ParameterDef, len(params))
-	for i, p := range params {
-		paramDefs[i] = types.ParameterDef{
-			Name: p,
-			Type: types.TypeAny, // JS is dynamically typed
-		}
-	}
-
-	fn := &Function{
-		Name: name,
-		Signature: &types.FunctionSignature{
-			Name:       name,
-			Parameters: paramDefs,
-			ReturnType: returnType,
-		},
-		JSBody: body,
-		Pure:   false, // Assume JS functions may have side effects
+// newJSFunction parses a JS function source into a function.
+func newJSFunction(source string) (*Function, error) {
+	def, err := parseJSDefinition(source)
+	if err != nil {
+		return nil, err
 	}
 
-	return r.Register(fn)
+	return &Function{
+		Name:      def.name,
+		Signature: def.signature(),
+		JSBody:    def.source,
+		Pure:      false, // Assume JS functions may have side effects
+	}, nil
 }
 
 // CallJS invokes a JavaScript function through the sandbox.
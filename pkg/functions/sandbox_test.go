@@ -3,9 +3,13 @@ package functions
 
 import (
 	"context"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/bencagri/amel/internal/errors"
 	"github.com/bencagri/amel/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,7 +20,7 @@ func TestNewSandbox(t *testing.T) {
 		sandbox := NewSandbox(nil)
 		assert.NotNil(t, sandbox)
 		assert.Equal(t, 100*time.Millisecond, sandbox.config.Timeout)
-		assert.Equal(t, int64(10*1024*1024), sandbox.config.MemoryLimit)
+		assert.Equal(t, int64(0), sandbox.config.MemoryLimit)
 		assert.Equal(t, 100, sandbox.config.MaxStackDepth)
 	})
 
@@ -291,6 +295,96 @@ func TestParseJSFunction(t *testing.T) {
 
 		require.Error(t, err)
 	})
+
+	t.Run("modern forms", func(t *testing.T) {
+		tests := []struct {
+			source     string
+			name       string
+			params     []string
+			returnType types.Type
+		}{
+			{`async function fetchScore(id) { return await Promise.resolve(id); }`, "fetchScore", []string{"id"}, types.TypeAny},
+			{`const double = (x: number): number => x * 2;`, "double", []string{"x"}, types.TypeFloat},
+			{`let shout = s => s.toUpperCase()`, "shout", []string{"s"}, types.TypeAny},
+			{`var total = async (items, { tax = 0 } = {}) => items.length + tax`, "total", []string{"items", "arg2"}, types.TypeAny},
+			{`const pick = function (a, b = "x", ...rest): Promise<string> { return a ?? b; }`, "pick", []string{"a", "b", "rest"}, types.TypeString},
+			{"// Copied from a Node module\nfunction tags(list: string[]): list { return list.map(t => `#${t}`); }", "tags", []string{"list"}, types.TypeList},
+		}
+
+		for _, tt := range tests {
+			name, params, returnType, body, err := ParseJSFunction(tt.source)
+			require.NoError(t, err, tt.source)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.params, params)
+			assert.Equal(t, tt.returnType, returnType)
+			assert.NotContains(t, body, "number", "type annotations are removed")
+			assert.NotRegexp(t, `^\s*(const|let) `, body)
+		}
+	})
+
+	t.Run("invalid JavaScript", func(t *testing.T) {
+		_, _, _, _, err := ParseJSFunction(`function broken(a) { return a +; }`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid JS function 'broken'")
+
+		_, _, _, _, err = ParseJSFunction(`function* numbers() { yield 1; }`)
+		require.Error(t, err)
+	})
+}
+
+func TestSandboxModernJavaScript(t *testing.T) {
+	registry := NewRegistry()
+	sandbox := NewSandbox(nil)
+	ctx := context.Background()
+
+	sources := []string{
+		`async function lookup(user) { const profile = await Promise.resolve(user?.profile); return profile?.tier ?? "basic"; }`,
+		`const greet = (name, greeting = "Hello") => ` + "`${greeting}, ${name}`",
+		`function sum(...values): float { return values.reduce((a, b) => a + b, 0); }`,
+		`const rejects = async () => { throw new Error("no tier"); }`,
+		`const waits = () => new Promise(() => {})`,
+		`function counter() { class Counter { #n = 0; inc() { return ++this.#n; } } const c = new Counter(); c.inc(); return c.inc(); }`,
+	}
+	for _, source := range sources {
+		require.NoError(t, registry.RegisterJSFunction(source, sandbox), source)
+	}
+
+	call := func(name string, args ...types.Value) (types.Value, error) {
+		return registry.CallJS(ctx, sandbox, name, args)
+	}
+
+	// Registered functions run repeatedly in pooled VMs
+	for i := 0; i < 3; i++ {
+		result, err := call("lookup", types.NewValue(map[string]interface{}{"profile": map[string]interface{}{"tier": "gold"}}))
+		require.NoError(t, err)
+		assert.Equal(t, "gold", result.Raw)
+	}
+
+	result, err := call("lookup", types.Null())
+	require.NoError(t, err)
+	assert.Equal(t, "basic", result.Raw)
+
+	result, err = call("greet", types.String("Ada"))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello, Ada", result.Raw)
+	_, err = call("greet")
+	assert.Error(t, err, "parameters without a default are required")
+
+	result, err = call("sum", types.Int(1), types.Int(2), types.Int(3))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), result.Raw)
+
+	result, err = call("counter")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), result.Raw)
+
+	_, err = call("rejects")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "JS promise rejected: Error: no tier")
+
+	_, err = call("waits")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "did not settle")
 }
 
 func TestRegistryRegisterJSFunction(t *testing.T) {
@@ -372,4 +466,284 @@ func TestVMPool(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, int64(i+1), result.Raw)
 	}
+	assert.Equal(t, uint64(1), sandbox.Stats().CreatedVMs, "sequential calls reuse one VM")
+
+	t.Run("redefined function", func(t *testing.T) {
+		result, err := sandbox.Execute(ctx, `function test(n) { return n * 10; }`, "test", []types.Value{types.Int(2)})
+		require.NoError(t, err)
+		assert.Equal(t, int64(20), result.Raw)
+	})
+
+	t.Run("concurrent calls", func(t *testing.T) {
+		sandbox := NewSandbox(&SandboxConfig{Timeout: time.Second, MaxStackDepth: 100, PoolSize: 4})
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 10; j++ {
+					result, err := sandbox.Execute(ctx, `function inc(n) { return n + 1; }`, "inc", []types.Value{types.Int(int64(i))})
+					assert.NoError(t, err)
+					assert.Equal(t, int64(i+1), result.Raw)
+				}
+			}(i)
+		}
+		wg.Wait()
+		assert.LessOrEqual(t, sandbox.Stats().PooledVMs, 4)
+	})
+
+	t.Run("timed out VM is not reused", func(t *testing.T) {
+		sandbox := NewSandbox(&SandboxConfig{Timeout: 20 * time.Millisecond, MaxStackDepth: 100})
+		_, err := sandbox.Execute(ctx, `function spin() { while(true) {} }`, "spin", nil)
+		require.Error(t, err)
+		result, err := sandbox.ExecuteExpression(ctx, `1 + 1`)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), result.Raw)
+		assert.Equal(t, uint64(2), sandbox.Stats().CreatedVMs)
+	})
+}
+
+func TestSandboxMemoryLimit(t *testing.T) {
+	sandbox := NewSandbox(&SandboxConfig{Timeout: 10 * time.Second, MemoryLimit: 8 * 1024 * 1024, MaxStackDepth: 100})
+	ctx := context.Background()
+
+	grow := `function grow() { const chunks = []; while (true) { chunks.push(new Array(10000).fill("x")); } }`
+	start := time.Now()
+	_, err := sandbox.Execute(ctx, grow, "grow", nil)
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrMemoryLimit), err.Error())
+	assert.Contains(t, err.Error(), "memory limit of 8388608 bytes")
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	// Short-lived garbage is not retained, so it does not count
+	churn := `function churn(n) { let total = 0; for (let i = 0; i < n; i++) { total += new Array(1000).fill(1).length; } return total; }`
+	result, err := sandbox.Execute(ctx, churn, "churn", []types.Value{types.Int(2000)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2000000), result.Raw)
+
+	stats := sandbox.Stats()
+	assert.Equal(t, uint64(1), stats.OverMemory)
+	assert.Equal(t, uint64(0), stats.Timeouts)
+
+	t.Run("disabled", func(t *testing.T) {
+		sandbox := NewSandbox(&SandboxConfig{Timeout: 50 * time.Millisecond, MaxStackDepth: 100})
+		_, err := sandbox.Execute(ctx, grow, "grow", nil)
+		assert.True(t, errors.IsCode(err, errors.ErrTimeout))
+	})
+
+	t.Run("off by default despite other goroutines", func(t *testing.T) {
+		sandbox := NewSandbox(&SandboxConfig{Timeout: 10 * time.Second, MaxStackDepth: 100})
+		held := make(chan [][]byte)
+		go func() {
+			var chunks [][]byte
+			for i := 0; i < 64; i++ {
+				chunks = append(chunks, make([]byte, 1024*1024))
+				runtime.GC()
+			}
+			held <- chunks
+		}()
+
+		spin := `function spin(n) { let total = 0; for (let i = 0; i < n; i++) { total += i % 2; } return total; }`
+		result, err := sandbox.Execute(ctx, spin, "spin", []types.Value{types.Int(5000000)})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2500000), result.Raw)
+		assert.Len(t, <-held, 64)
+	})
+}
+
+func TestSandboxModules(t *testing.T) {
+	sandbox := NewSandbox(nil)
+	ctx := context.Background()
+	require.NoError(t, sandbox.RegisterModule("a", `const b = require("b"); exports.twice = x => b.double(x);`))
+	require.NoError(t, sandbox.RegisterModule("b", `module.exports = { double: x => x * 2 };`))
+	assert.Equal(t, []string{"@amel/helpers", "a", "b"}, sandbox.Modules())
+
+	call := func(source, name string, args ...types.Value) (types.Value, error) {
+		return sandbox.Execute(ctx, source, name, args)
+	}
+
+	result, err := call(`function twice(x) { return require("a").twice(x); }`, "twice", types.Int(21))
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), result.Raw)
+
+	t.Run("bundled helpers", func(t *testing.T) {
+		source := `function summary(orders) {
+			const _ = require("@amel/helpers");
+			const byStatus = _.countBy(orders, "status");
+			return [_.get(orders, "[0].customer.name", "?"), byStatus.paid, _.uniq(_.flatten(_.range(3).map(i => [i, i]))).length,
+				_.sortBy(orders, o => -o.total)[0].total, _.isEmpty(_.pick(orders[0], ["missing"]))].join(",");
+		}`
+		orders := types.NewValue([]interface{}{
+			map[string]interface{}{"status": "paid", "total": 5, "customer": map[string]interface{}{"name": "Ada"}},
+			map[string]interface{}{"status": "paid", "total": 9},
+			map[string]interface{}{"status": "open", "total": 1},
+		})
+		result, err := call(source, "summary", orders)
+		require.NoError(t, err)
+		assert.Equal(t, "Ada,2,3,9,true", result.Raw)
+	})
+
+	t.Run("replaced module", func(t *testing.T) {
+		require.NoError(t, sandbox.RegisterModule("b", `exports.double = x => x * 3;`))
+		result, err := call(`function twice(x) { return require("a").twice(x); }`, "twice", types.Int(2))
+		require.NoError(t, err)
+		assert.Equal(t, int64(6), result.Raw, "modules requiring the replaced module are evaluated again")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := call(`function missing() { return require("nope"); }`, "missing")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "JS module 'nope' is not registered")
+
+		require.NoError(t, sandbox.RegisterModule("throws", `throw new Error("boom");`))
+		_, err = call(`function load() { try { require("throws"); } catch (e) { return e.message; } }`, "load")
+		require.NoError(t, err)
+		result, err := call(`function load() { try { require("throws"); } catch (e) { return e.message; } }`, "load")
+		require.NoError(t, err)
+		assert.Equal(t, "boom", result.Raw, "a module that failed is evaluated again")
+
+		assert.Error(t, sandbox.RegisterModule("@amel/mine", `exports.x = 1;`))
+		assert.Error(t, sandbox.RegisterModule("", `exports.x = 1;`))
+		assert.Error(t, sandbox.RegisterModule("bad", `exports.x = ;`))
+		assert.True(t, sandbox.UnregisterModule("throws"))
+		assert.False(t, sandbox.UnregisterModule("throws"))
+	})
+
+	t.Run("clone", func(t *testing.T) {
+		clone := sandbox.Clone()
+		require.NoError(t, clone.RegisterModule("c", `exports.x = 1;`))
+		assert.Contains(t, clone.Modules(), "a")
+		assert.NotContains(t, sandbox.Modules(), "c")
+		assert.Equal(t, SandboxStats{}, clone.Stats())
+	})
+}
+
+func TestSandboxConsole(t *testing.T) {
+	sandbox := NewSandbox(nil)
+	var entries []ConsoleEntry
+	ctx := WithConsole(context.Background(), func(entry ConsoleEntry) {
+		entries = append(entries, entry)
+	})
+
+	_, err := sandbox.Execute(ctx, `function f(x) { console.info("x is", x, [1, 2], null); console.debug("a".repeat(2000)); return x; }`,
+		"f", []types.Value{types.Int(3)})
+	require.NoError(t, err)
+	_, err = sandbox.ExecuteExpression(ctx, `console.log(true), 1`)
+	require.NoError(t, err)
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, ConsoleEntry{Function: "f", Level: "info", Message: "x is 3 [1,2] null"}, entries[0])
+	assert.Len(t, entries[1].Message, MaxConsoleMessage+3)
+	assert.Equal(t, ConsoleEntry{Level: "log", Message: "true"}, entries[2])
+
+	// Without a console function output is discarded
+	_, err = sandbox.Execute(context.Background(), `function g() { console.log("dropped"); return 1; }`, "g", nil)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestSandboxState(t *testing.T) {
+	sandbox := NewSandbox(&SandboxConfig{Timeout: time.Second, MaxStackDepth: 100, StateLimit: 64})
+	ctx := context.Background()
+	call := func(source, name string, args ...types.Value) (types.Value, error) {
+		return sandbox.Execute(ctx, source, name, args)
+	}
+
+	counter := `function count() { const n = amel.state.get("n", 0) + 1; amel.state.set("n", n); return n; }`
+	for i := 1; i <= 3; i++ {
+		result, err := call(counter, "count")
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), result.Raw)
+	}
+
+	// Values are copies
+	result, err := call(`function copy() { amel.state.set("o", {a: [1]}); amel.state.get("o").a.push(2); return amel.state.get("o").a.length; }`, "copy")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Raw)
+	keys, size := sandbox.StateSize()
+	assert.Equal(t, 2, keys)
+	assert.Equal(t, int64(len("n")+len("3")+len("o")+len(`{"a":[1]}`)), size)
+
+	result, err = call(`function list() { return amel.state.keys().join(",") + ":" + amel.state.has("n") + amel.state.delete("o") + amel.state.has("o"); }`, "list")
+	require.NoError(t, err)
+	assert.Equal(t, "n,o:truetruefalse", result.Raw)
+
+	_, err = call(`function big() { amel.state.set("big", "x".repeat(100)); }`, "big")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "amel.state limit of 64 bytes exceeded")
+	_, err = call(`function fn() { amel.state.set("f", () => 1); }`, "fn")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not JSON serializable")
+
+	sandbox.ResetState()
+	result, err = call(counter, "count")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), result.Raw)
+	assert.Equal(t, 0, func() int { keys, _ := sandbox.Clone().StateSize(); return keys }())
+
+	t.Run("disabled by default", func(t *testing.T) {
+		_, err := NewSandbox(nil).Execute(ctx, counter, "count", nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "amel.state is disabled")
+	})
+}
+
+// testEvalContext is an EvalContext over a map payload.
+type testEvalContext map[string]interface{}
+
+func (c testEvalContext) Lookup(path string) types.Value {
+	if path == "$" {
+		return types.NewValue(map[string]interface{}(c))
+	}
+	value, ok := c[strings.TrimPrefix(path, "$.")]
+	if !ok {
+		return types.Null()
+	}
+	return types.NewValue(value)
+}
+
+func (c testEvalContext) Variable(name string) (types.Value, bool) {
+	return types.Null(), false
+}
+
+func TestSandboxPayloadAccess(t *testing.T) {
+	sandbox := NewSandbox(&SandboxConfig{Timeout: time.Second, MaxStackDepth: 100, PayloadAccess: true})
+	payload := testEvalContext{"tier": "gold", "tags": []interface{}{"a"}}
+	ctx := WithEvalContext(context.Background(), payload)
+
+	source := `function read() { const p = amel.payload; p.tags.push("b"); return [p.tier, amel.path("$.tier"), amel.path("missing"), amel.variable("x"), p.tags.length].join(","); }`
+	result, err := sandbox.Execute(ctx, source, "read", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "gold,gold,,,2", result.Raw)
+	assert.Equal(t, []interface{}{"a"}, payload["tags"], "the payload is not changed")
+
+	result, err = sandbox.Execute(context.Background(), `function none() { return amel.payload === null && amel.path("tier") === null; }`, "none", nil)
+	require.NoError(t, err)
+	assert.Equal(t, true, result.Raw, "null outside an evaluation")
+
+	_, err = NewSandbox(nil).Execute(ctx, source, "read", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SandboxConfig.PayloadAccess")
+}
+
+func TestSandboxStats(t *testing.T) {
+	sandbox := NewSandbox(&SandboxConfig{Timeout: 50 * time.Millisecond, MaxStackDepth: 100})
+	ctx := context.Background()
+	assert.Equal(t, SandboxStats{}, sandbox.Stats())
+
+	_, err := sandbox.Execute(ctx, `function one() { return 1; }`, "one", nil)
+	require.NoError(t, err)
+	_, err = sandbox.Execute(ctx, `function bad() { throw new Error("x"); }`, "bad", nil)
+	require.Error(t, err)
+	_, err = sandbox.Execute(ctx, `function spin() { while(true) {} }`, "spin", nil)
+	require.Error(t, err)
+	_, err = sandbox.ExecuteExpression(ctx, `1 + 1`)
+	require.NoError(t, err)
+
+	stats := sandbox.Stats()
+	assert.Equal(t, uint64(4), stats.Executions)
+	assert.Equal(t, uint64(2), stats.Failures)
+	assert.Equal(t, uint64(1), stats.Timeouts)
+	assert.GreaterOrEqual(t, stats.Busy, 50*time.Millisecond)
+	assert.Equal(t, 1, stats.PooledVMs)
 }
@@ -0,0 +1,63 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// ScoreFunction is the name of the weighted scoring function. The evaluator
+// evaluates calls with a literal list of pairs itself, so that the weight of
+// a condition that does not hold is never evaluated.
+const ScoreFunction = "score"
+
+// builtinScore returns the sum of the weights of the [condition, weight]
+// pairs of a list whose condition is truthy, as a float.
+func builtinScore(args ...Thunk) (types.Value, error) {
+	if len(args) < 1 {
+		return types.Null(), errors.New(errors.ErrArgumentCount, "score requires 1 argument")
+	}
+
+	list, err := args[0]()
+	if err != nil {
+		return types.Null(), err
+	}
+	pairs, ok := list.AsList()
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrTypeMismatch, "score requires a list of [condition, weight] pairs, got %s", list.Type)
+	}
+
+	var total float64
+	for i, p := range pairs {
+		pair, ok := p.AsList()
+		if !ok || len(pair) != 2 {
+			return types.Null(), errors.Newf(errors.ErrTypeMismatch, "score requires [condition, weight] pairs, got %s at index %d", p.Type, i)
+		}
+		cond, ok := pair[0].AsBool()
+		if !ok {
+			cond = pair[0].IsTruthy()
+		}
+		if !cond {
+			continue
+		}
+		weight, err := ScoreWeight(pair[1], i)
+		if err != nil {
+			return types.Null(), err
+		}
+		total += weight
+	}
+	return types.Float(total), nil
+}
+
+// ScoreWeight returns the weight of the score pair at index, which must be a
+// number.
+func ScoreWeight(v types.Value, index int) (float64, error) {
+	if v.Type == types.TypeAny {
+		v = types.NewValue(v.Raw)
+	}
+	if !v.Type.IsNumeric() {
+		return 0, errors.Newf(errors.ErrTypeMismatch, "score weight must be a number, got %s at index %d", v.Type, index)
+	}
+	weight, _ := v.AsFloat()
+	return weight, nil
+}
@@ -0,0 +1,22 @@
+// Package functions provides function management for the AMEL DSL engine.
+package functions
+
+import (
+	"context"
+
+	"github.com/bencagri/amel/pkg/types"
+)
+
+type truthinessKey struct{}
+
+// WithTruthiness returns a context whose functions testing values for truth,
+// such as bool, all, and any, use t.
+func WithTruthiness(ctx context.Context, t *types.Truthiness) context.Context {
+	return context.WithValue(ctx, truthinessKey{}, t)
+}
+
+// isTruthy returns the truthiness of a value under the rules of ctx, if any.
+func isTruthy(ctx context.Context, v types.Value) bool {
+	t, _ := ctx.Value(truthinessKey{}).(*types.Truthiness)
+	return t.IsTruthy(v)
+}
@@ -0,0 +1,194 @@
+// Package gopack loads function packs compiled as Go plugins.
+//
+// A function pack is a Go plugin (go build -buildmode=plugin) that exports a
+// variable named AmelPack of type gopack.Pack, or a function returning a
+// *gopack.Pack:
+//
+//	package main
+//
+//	var AmelPack = gopack.Pack{
+//	    Name:        "geo",
+//	    Version:     "1.4.0",
+//	    APIVersions: []int{1},
+//	    Register: func(r *functions.Registry, apiVersion int) error {
+//	        return r.RegisterBuiltIn("distanceKm", distanceKm, distanceKmSignature)
+//	    },
+//	}
+//
+// The Go runtime only loads plugins built with the same toolchain and the
+// same versions of shared packages as the host, including this module. Packs
+// run in the host process without a sandbox and must be trusted; use the
+// wasmplugin package for untrusted code. Plugins are supported on Linux,
+// FreeBSD, and macOS with cgo enabled.
+package gopack
+
+import (
+	"path/filepath"
+	"plugin"
+	"sort"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+)
+
+const (
+	// APIVersion is the newest pack API version supported by this host.
+	APIVersion = 1
+	// MinAPIVersion is the oldest pack API version supported by this host.
+	MinAPIVersion = 1
+	// SymbolName is the name of the symbol a pack exports.
+	SymbolName = "AmelPack"
+)
+
+// Pack describes a function pack.
+type Pack struct {
+	// Name identifies the pack; names must be unique within a loader.
+	Name string
+	// Version is the version of the pack itself, for diagnostics.
+	Version string
+	// APIVersions lists the pack API versions the pack supports.
+	APIVersions []int
+	// Register registers the functions of the pack using the negotiated API
+	// version. r contains only the functions of the pack.
+	Register func(r *functions.Registry, apiVersion int) error
+}
+
+// LoadedPack is a pack that was loaded and registered.
+type LoadedPack struct {
+	Pack       *Pack
+	Path       string
+	APIVersion int
+	Functions  []string
+}
+
+// symbolLookup finds an exported symbol of a plugin.
+type symbolLookup func(name string) (plugin.Symbol, error)
+
+// Loader loads the function packs of a directory.
+type Loader struct {
+	dir     string
+	pattern string
+	open    func(path string) (symbolLookup, error)
+}
+
+// LoaderOption configures a Loader.
+type LoaderOption func(*Loader)
+
+// WithPattern sets the file name pattern of packs, in the syntax of
+// filepath.Match. Defaults to "*.so".
+func WithPattern(pattern string) LoaderOption {
+	return func(l *Loader) {
+		l.pattern = pattern
+	}
+}
+
+// NewLoader creates a loader for the packs in dir.
+func NewLoader(dir string, opts ...LoaderOption) *Loader {
+	l := &Loader{dir: dir, pattern: "*.so", open: openPlugin}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func openPlugin(path string) (symbolLookup, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return p.Lookup, nil
+}
+
+// Load loads the packs of the directory in file name order and registers
+// their functions in r. A pack whose functions would replace a function of
+// r, or of a pack loaded before it, is rejected without registering any of
+// its functions. Go plugins cannot be unloaded, so on error the packs loaded
+// before the failing one stay registered and are returned with the error.
+func (l *Loader) Load(r *functions.Registry) ([]LoadedPack, error) {
+	paths, err := filepath.Glob(filepath.Join(l.dir, l.pattern))
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "invalid pack pattern", err)
+	}
+	sort.Strings(paths)
+
+	var loaded []LoadedPack
+	names := make(map[string]string)
+	for _, path := range paths {
+		pack, err := l.openPack(path)
+		if err != nil {
+			return loaded, err
+		}
+		if other, ok := names[pack.Name]; ok {
+			return loaded, errors.Newf(errors.ErrInvalidSyntax, "%s: pack '%s' is already loaded from %s", path, pack.Name, other)
+		}
+
+		result, err := register(path, pack, r)
+		if err != nil {
+			return loaded, err
+		}
+		names[pack.Name] = path
+		loaded = append(loaded, result)
+	}
+	return loaded, nil
+}
+
+// openPack opens a pack and reads its description.
+func (l *Loader) openPack(path string) (*Pack, error) {
+	lookup, err := l.open(path)
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, path+": cannot open pack: "+err.Error(), err)
+	}
+	symbol, err := lookup(SymbolName)
+	if err != nil {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "%s: pack does not export %s", path, SymbolName)
+	}
+
+	var pack *Pack
+	switch s := symbol.(type) {
+	case *Pack:
+		pack = s
+	case func() *Pack:
+		pack = s()
+	}
+	if pack == nil || pack.Name == "" || pack.Register == nil {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "%s: %s is not a named gopack.Pack with a Register function", path, SymbolName)
+	}
+	return pack, nil
+}
+
+// register negotiates the API version of a pack and registers its functions
+// in r.
+func register(path string, pack *Pack, r *functions.Registry) (LoadedPack, error) {
+	version, ok := Negotiate(pack.APIVersions)
+	if !ok {
+		return LoadedPack{}, errors.Newf(errors.ErrInvalidSyntax, "%s: pack '%s' supports API versions %v; the host supports %d to %d",
+			path, pack.Name, pack.APIVersions, MinAPIVersion, APIVersion)
+	}
+
+	scratch := functions.NewRegistry()
+	if err := pack.Register(scratch, version); err != nil {
+		return LoadedPack{}, errors.Wrap(errors.ErrInvalidSyntax, path+": pack '"+pack.Name+"' failed to register: "+err.Error(), err)
+	}
+	fns := scratch.List()
+	sort.Strings(fns)
+	for _, name := range fns {
+		if r.Has(name) {
+			return LoadedPack{}, errors.Newf(errors.ErrInvalidSyntax, "%s: pack '%s': function '%s' is already registered", path, pack.Name, name)
+		}
+	}
+	r.Merge(scratch)
+
+	return LoadedPack{Pack: pack, Path: path, APIVersion: version, Functions: fns}, nil
+}
+
+// Negotiate returns the newest API version supported by both the host and a
+// pack declaring versions, and false if there is none.
+func Negotiate(versions []int) (int, bool) {
+	best := 0
+	for _, v := range versions {
+		if v >= MinAPIVersion && v <= APIVersion && v > best {
+			best = v
+		}
+	}
+	return best, best != 0
+}
@@ -0,0 +1,144 @@
+package gopack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"plugin"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLoader returns a loader for a directory holding one empty file per
+// entry of symbols, whose AmelPack symbol is the entry's value.
+func testLoader(t *testing.T, symbols map[string]plugin.Symbol) *Loader {
+	t.Helper()
+	dir := t.TempDir()
+	for name := range symbols {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), nil, 0o644))
+
+	l := NewLoader(dir)
+	l.open = func(path string) (symbolLookup, error) {
+		symbol, ok := symbols[filepath.Base(path)]
+		if !ok {
+			return nil, fmt.Errorf("unexpected file %s", path)
+		}
+		return func(name string) (plugin.Symbol, error) {
+			if name != SymbolName || symbol == nil {
+				return nil, fmt.Errorf("symbol %s not found", name)
+			}
+			return symbol, nil
+		}, nil
+	}
+	return l
+}
+
+func constantPack(name string, versions []int, fns ...string) *Pack {
+	return &Pack{
+		Name:        name,
+		Version:     "1.0.0",
+		APIVersions: versions,
+		Register: func(r *functions.Registry, _ int) error {
+			for _, fn := range fns {
+				value := types.String(name + "." + fn)
+				err := r.RegisterBuiltIn(fn, func(...types.Value) (types.Value, error) {
+					return value, nil
+				}, types.NewFunctionSignature(fn, types.TypeString))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func TestLoader_Load(t *testing.T) {
+	l := testLoader(t, map[string]plugin.Symbol{
+		"geo.so":   constantPack("geo", []int{1}, "distanceKm", "country"),
+		"fraud.so": func() *Pack { return constantPack("fraud", []int{0, 1, 2}, "velocity") },
+	})
+
+	registry, err := functions.NewDefaultRegistry()
+	require.NoError(t, err)
+	loaded, err := l.Load(registry)
+	require.NoError(t, err)
+
+	require.Len(t, loaded, 2)
+	assert.Equal(t, "fraud", loaded[0].Pack.Name)
+	assert.Equal(t, 1, loaded[0].APIVersion)
+	assert.Equal(t, []string{"country", "distanceKm"}, loaded[1].Functions)
+
+	result, err := registry.Call("velocity")
+	require.NoError(t, err)
+	assert.Equal(t, "fraud.velocity", result.Raw)
+	assert.True(t, registry.Has("upper"))
+}
+
+func TestLoader_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		symbol  plugin.Symbol
+		message string
+	}{
+		{"missing symbol", nil, "does not export AmelPack"},
+		{"wrong type", "pack", "is not a named gopack.Pack"},
+		{"unsupported version", constantPack("next", []int{2, 3}, "f"), "supports API versions [2 3]"},
+		{"builtin conflict", constantPack("strings", []int{1}, "shout", "upper"), "function 'upper' is already registered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := testLoader(t, map[string]plugin.Symbol{"pack.so": tt.symbol})
+			registry, err := functions.NewDefaultRegistry()
+			require.NoError(t, err)
+
+			loaded, err := l.Load(registry)
+			assert.Empty(t, loaded)
+			require.Error(t, err)
+			assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+			assert.Contains(t, err.Error(), tt.message)
+			assert.False(t, registry.Has("shout"), "a rejected pack registers nothing")
+		})
+	}
+}
+
+func TestLoader_DuplicatePack(t *testing.T) {
+	l := testLoader(t, map[string]plugin.Symbol{
+		"a.so": constantPack("geo", []int{1}, "distanceKm"),
+		"b.so": constantPack("geo", []int{1}, "country"),
+	})
+
+	registry := functions.NewRegistry()
+	loaded, err := l.Load(registry)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pack 'geo' is already loaded from")
+	require.Len(t, loaded, 1)
+	assert.True(t, registry.Has("distanceKm"))
+	assert.False(t, registry.Has("country"))
+}
+
+func TestNegotiate(t *testing.T) {
+	version, ok := Negotiate([]int{0, APIVersion, APIVersion + 1})
+	assert.True(t, ok)
+	assert.Equal(t, APIVersion, version)
+
+	_, ok = Negotiate(nil)
+	assert.False(t, ok)
+}
+
+func TestLoader_OpenError(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.so"), []byte("not a plugin"), 0o644))
+
+	_, err := NewLoader(dir).Load(functions.NewRegistry())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot open pack")
+}
@@ -0,0 +1,442 @@
+// Package jsonlogic converts between JSONLogic rules and AMEL expressions.
+package jsonlogic
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+// Export converts an AMEL expression to a JSONLogic rule, encoded as JSON.
+func Export(expr ast.Expression) ([]byte, error) {
+	rule, err := ExportRule(expr)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(rule)
+}
+
+// ExportSource parses a DSL expression and converts it to a JSONLogic rule,
+// encoded as JSON.
+func ExportSource(dsl string) ([]byte, error) {
+	expr, err := parser.Parse(dsl)
+	if err != nil {
+		return nil, err
+	}
+	return Export(expr)
+}
+
+// ExportRule converts an AMEL expression to a JSONLogic rule made of the
+// values encoding/json encodes: maps, slices, strings, numbers, bools, and
+// nil.
+func ExportRule(expr ast.Expression) (interface{}, error) {
+	return (&exporter{}).rule(expr)
+}
+
+// exporter converts expressions. Inside lambdas, params maps the lambda
+// parameters to the var paths they stand for, and JSON paths cannot be read.
+type exporter struct {
+	params map[string]string
+}
+
+func (ex *exporter) rule(expr ast.Expression) (interface{}, error) {
+	switch n := expr.(type) {
+	case *ast.IntegerLiteral:
+		return n.Value, nil
+	case *ast.FloatLiteral:
+		return n.Value, nil
+	case *ast.StringLiteral:
+		return n.Value, nil
+	case *ast.BooleanLiteral:
+		return n.Value, nil
+	case *ast.NullLiteral:
+		return nil, nil
+	case *ast.ListLiteral:
+		return ex.rules(n.Elements)
+	case *ast.MapLiteral:
+		if len(n.Keys) == 1 {
+			return nil, errors.New(errors.ErrInvalidSyntax, "a map of 1 key reads as an operation in JSONLogic")
+		}
+		return data(n)
+	case *ast.JSONPathExpression, *ast.Identifier, *ast.MemberExpression, *ast.IndexExpression:
+		path, err := ex.path(expr)
+		if err != nil {
+			return nil, err
+		}
+		return operation("var", path), nil
+	case *ast.GroupedExpression:
+		return ex.rule(n.Expression)
+	case *ast.BinaryExpression:
+		return ex.binary(n)
+	case *ast.UnaryExpression:
+		return ex.unary(n)
+	case *ast.ConditionalExpression:
+		args, err := ex.rules([]ast.Expression{n.Condition, n.Consequence, n.Alternative})
+		if err != nil {
+			return nil, err
+		}
+		return operation("if", args), nil
+	case *ast.CaseExpression:
+		var exprs []ast.Expression
+		for i, cond := range n.Conditions {
+			exprs = append(exprs, cond, n.Results[i])
+		}
+		if n.Default != nil {
+			exprs = append(exprs, n.Default)
+		}
+		args, err := ex.rules(exprs)
+		if err != nil {
+			return nil, err
+		}
+		return operation("if", args), nil
+	case *ast.InExpression:
+		args, err := ex.rules([]ast.Expression{n.Left, n.Right})
+		if err != nil {
+			return nil, err
+		}
+		if n.Negated {
+			return operation("!", []interface{}{operation("in", args)}), nil
+		}
+		return operation("in", args), nil
+	case *ast.FunctionCall:
+		return ex.call(n)
+	}
+	return nil, errors.Newf(errors.ErrInvalidSyntax, "unsupported expression type for JSONLogic: %T", expr)
+}
+
+func (ex *exporter) rules(exprs []ast.Expression) ([]interface{}, error) {
+	args := make([]interface{}, len(exprs))
+	for i, expr := range exprs {
+		arg, err := ex.rule(expr)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// binaryOperations maps AMEL operators to JSONLogic operations.
+var binaryOperations = map[string]string{
+	"&&": "and", "and": "and", "AND": "and",
+	"||": "or", "or": "or", "OR": "or",
+	"==": "==", "!=": "!=", "<": "<", ">": ">", "<=": "<=", ">=": ">=",
+	"+": "+", "-": "-", "*": "*", "/": "/", "%": "%",
+}
+
+func (ex *exporter) binary(n *ast.BinaryExpression) (interface{}, error) {
+	op, ok := binaryOperations[n.Operator]
+	if !ok {
+		return nil, errors.Newf(errors.ErrInvalidOperator, "unsupported operator for JSONLogic: %s", n.Operator)
+	}
+
+	operands := []ast.Expression{n.Left, n.Right}
+	switch op {
+	case "and", "or", "+", "*":
+		// These operations take any number of arguments
+		operands = flatten(op, n)
+	}
+	args, err := ex.rules(operands)
+	if err != nil {
+		return nil, err
+	}
+	return operation(op, args), nil
+}
+
+// flatten returns the operands of a chain of operators that map to op, such
+// as a, b, and c for a && (b && c).
+func flatten(op string, expr ast.Expression) []ast.Expression {
+	switch n := expr.(type) {
+	case *ast.GroupedExpression:
+		return flatten(op, n.Expression)
+	case *ast.BinaryExpression:
+		if binaryOperations[n.Operator] == op {
+			return append(flatten(op, n.Left), flatten(op, n.Right)...)
+		}
+	}
+	return []ast.Expression{expr}
+}
+
+func (ex *exporter) unary(n *ast.UnaryExpression) (interface{}, error) {
+	switch n.Operator {
+	case "!", "not", "NOT":
+		if fc, ok := n.Operand.(*ast.FunctionCall); ok && fc.Name == "some" {
+			// !some(list, x => ...) is none
+			rule, err := ex.call(fc)
+			if err != nil {
+				return nil, err
+			}
+			return operation("none", rule.(map[string]interface{})["some"]), nil
+		}
+		arg, err := ex.rule(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return operation("!", []interface{}{arg}), nil
+	case "-":
+		arg, err := ex.rule(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		return operation("-", []interface{}{arg}), nil
+	}
+	return nil, errors.Newf(errors.ErrInvalidOperator, "unsupported operator for JSONLogic: %s", n.Operator)
+}
+
+// call converts a function call. The functions Import produces become the
+// JSONLogic operations they came from; the others become custom operations
+// of the same name.
+func (ex *exporter) call(n *ast.FunctionCall) (interface{}, error) {
+	args := n.Arguments
+	switch {
+	case n.Name == "defaultVal" && len(args) == 2:
+		if path, err := ex.path(args[0]); err == nil {
+			def, err := ex.rule(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return operation("var", []interface{}{path, def}), nil
+		}
+	case n.Name == "bool" && len(args) == 1:
+		return ex.operation("!!", args)
+	case n.Name == "float" && len(args) == 1:
+		return ex.operation("+", args)
+	case n.Name == "concat":
+		// Import converts the arguments of cat with string, which cat does
+		unwrapped := make([]ast.Expression, len(args))
+		for i, arg := range args {
+			unwrapped[i] = arg
+			if conv, ok := arg.(*ast.FunctionCall); ok && conv.Name == "string" && len(conv.Arguments) == 1 {
+				unwrapped[i] = conv.Arguments[0]
+			}
+		}
+		return ex.operation("cat", unwrapped)
+	case n.Name == "contains" && len(args) == 2:
+		return ex.operation("in", []ast.Expression{args[1], args[0]})
+	case n.Name == "isNull" && len(args) == 1:
+		return ex.operation("==", []ast.Expression{args[0], null()})
+	case n.Name == "flatten" && len(args) == 1:
+		if l, ok := args[0].(*ast.ListLiteral); ok {
+			return ex.operation("merge", l.Elements)
+		}
+	case n.Name == "substr" && len(args) == 3:
+		if length, ok := args[2].(*ast.FunctionCall); ok && length.Name == "len" &&
+			len(length.Arguments) == 1 && length.Arguments[0].String() == args[0].String() {
+			// The rest of the string
+			return ex.operation("substr", args[:2])
+		}
+	case n.Name == "map", n.Name == "filter", n.Name == "some":
+		return ex.iteration(n.Name, args)
+	case n.Name == "every":
+		return ex.iteration("all", args)
+	case n.Name == "reduce" && len(args) == 3:
+		items, err := ex.rule(args[0])
+		if err != nil {
+			return nil, err
+		}
+		initial, err := ex.rule(args[1])
+		if err != nil {
+			return nil, err
+		}
+		fn, ok := args[2].(*ast.LambdaExpression)
+		if !ok || len(fn.Parameters) != 2 {
+			return nil, errors.New(errors.ErrInvalidSyntax, "reduce requires a lambda of 2 parameters for JSONLogic")
+		}
+		body, err := ex.lambda(fn, accumulatorParam, currentParam)
+		if err != nil {
+			return nil, err
+		}
+		return operation("reduce", []interface{}{items, body, initial}), nil
+	}
+
+	if !identifier.MatchString(n.Name) {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "unsupported function for JSONLogic: %s", n.Name)
+	}
+	return ex.operation(n.Name, args)
+}
+
+// iteration converts map, filter, some, and every, which apply a lambda of
+// one parameter to the elements of a list.
+func (ex *exporter) iteration(op string, args []ast.Expression) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "%s requires 2 arguments for JSONLogic", op)
+	}
+	items, err := ex.rule(args[0])
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := args[1].(*ast.LambdaExpression)
+	if !ok || len(fn.Parameters) != 1 {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "%s requires a lambda of 1 parameter for JSONLogic", op)
+	}
+	body, err := ex.lambda(fn, "")
+	if err != nil {
+		return nil, err
+	}
+	return operation(op, []interface{}{items, body}), nil
+}
+
+// lambda converts the body of a lambda whose parameters read the given var
+// paths.
+func (ex *exporter) lambda(fn *ast.LambdaExpression, paths ...string) (interface{}, error) {
+	inner := &exporter{params: make(map[string]string)}
+	for i, p := range fn.Parameters {
+		inner.params[p.Value] = paths[i]
+	}
+	return inner.rule(fn.Body)
+}
+
+// operation converts the arguments of a JSONLogic operation.
+func (ex *exporter) operation(op string, exprs []ast.Expression) (interface{}, error) {
+	for _, expr := range exprs {
+		if _, ok := expr.(*ast.LambdaExpression); ok {
+			return nil, errors.Newf(errors.ErrInvalidSyntax, "%s cannot take a lambda in JSONLogic", op)
+		}
+	}
+	args, err := ex.rules(exprs)
+	if err != nil {
+		return nil, err
+	}
+	return operation(op, args), nil
+}
+
+// path returns the var path an expression reads: a JSON path outside of
+// lambdas, or a lambda parameter and the fields and elements read from it.
+func (ex *exporter) path(expr ast.Expression) (string, error) {
+	var segments []string
+	for {
+		switch n := expr.(type) {
+		case *ast.JSONPathExpression:
+			if ex.params != nil {
+				return "", errors.Newf(errors.ErrInvalidSyntax, "JSONLogic cannot read %s inside a lambda", n.Path)
+			}
+			root, err := pathSegments(n.Path)
+			if err != nil {
+				return "", err
+			}
+			return joinPath(append(root, segments...))
+		case *ast.Identifier:
+			prefix, ok := ex.params[n.Value]
+			if !ok {
+				return "", errors.Newf(errors.ErrInvalidSyntax, "unsupported identifier for JSONLogic: %s", n.Value)
+			}
+			if prefix != "" {
+				segments = append([]string{prefix}, segments...)
+			}
+			return joinPath(segments)
+		case *ast.MemberExpression:
+			segments = append([]string{n.Property.Value}, segments...)
+			expr = n.Object
+		case *ast.IndexExpression:
+			switch index := n.Index.(type) {
+			case *ast.IntegerLiteral:
+				if index.Value < 0 {
+					return "", errors.New(errors.ErrInvalidSyntax, "JSONLogic cannot read negative indices")
+				}
+				segments = append([]string{strconv.FormatInt(index.Value, 10)}, segments...)
+			case *ast.StringLiteral:
+				segments = append([]string{index.Value}, segments...)
+			default:
+				return "", errors.New(errors.ErrInvalidSyntax, "JSONLogic cannot read computed indices")
+			}
+			expr = n.Left
+		case *ast.GroupedExpression:
+			expr = n.Expression
+		default:
+			return "", errors.Newf(errors.ErrInvalidSyntax, "unsupported expression type for JSONLogic: %T", expr)
+		}
+	}
+}
+
+// pathSegments splits a JSON path such as $.user.tags[0] into its keys and
+// indices.
+func pathSegments(path string) ([]string, error) {
+	var segments []string
+	rest := strings.TrimPrefix(path, "$")
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			segments = append(segments, rest[1:end+1])
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, `["`):
+			quoted, err := strconv.QuotedPrefix(rest[1:])
+			if err != nil {
+				return nil, errors.Wrap(errors.ErrInvalidJSONPath, "invalid JSON path "+path, err)
+			}
+			key, _ := strconv.Unquote(quoted)
+			segments = append(segments, key)
+			rest = strings.TrimPrefix(rest[1+len(quoted):], "]")
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errors.Newf(errors.ErrInvalidJSONPath, "invalid JSON path %s", path)
+			}
+			segments = append(segments, rest[1:end])
+			rest = rest[end+1:]
+		default:
+			return nil, errors.Newf(errors.ErrInvalidJSONPath, "invalid JSON path %s", path)
+		}
+	}
+	return segments, nil
+}
+
+// joinPath returns the dotted var path of segments, which cannot contain
+// dots themselves.
+func joinPath(segments []string) (string, error) {
+	for _, seg := range segments {
+		if strings.Contains(seg, ".") {
+			return "", errors.Newf(errors.ErrInvalidSyntax, "JSONLogic cannot read the key %q", seg)
+		}
+	}
+	return strings.Join(segments, "."), nil
+}
+
+// data converts a map literal of constants, which JSONLogic does not
+// evaluate.
+func data(expr ast.Expression) (interface{}, error) {
+	switch n := expr.(type) {
+	case *ast.IntegerLiteral:
+		return n.Value, nil
+	case *ast.FloatLiteral:
+		return n.Value, nil
+	case *ast.StringLiteral:
+		return n.Value, nil
+	case *ast.BooleanLiteral:
+		return n.Value, nil
+	case *ast.NullLiteral:
+		return nil, nil
+	case *ast.ListLiteral:
+		values := make([]interface{}, len(n.Elements))
+		for i, elem := range n.Elements {
+			v, err := data(elem)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case *ast.MapLiteral:
+		values := make(map[string]interface{}, len(n.Keys))
+		for i, key := range n.Keys {
+			v, err := data(n.Values[i])
+			if err != nil {
+				return nil, err
+			}
+			values[key] = v
+		}
+		return values, nil
+	}
+	return nil, errors.New(errors.ErrInvalidSyntax, "JSONLogic maps can only hold constants")
+}
+
+func operation(op string, args interface{}) map[string]interface{} {
+	return map[string]interface{}{op: args}
+}
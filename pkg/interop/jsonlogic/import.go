@@ -0,0 +1,595 @@
+// Package jsonlogic converts between JSONLogic rules (https://jsonlogic.com)
+// and AMEL expressions, so rules written for jsonlogic libraries can be
+// evaluated by the engine and exported back.
+//
+// Import maps the JSONLogic operations to their AMEL counterparts: var to
+// JSON paths, == and === to ==, and/or to && and ||, if to ?: or case, cat
+// to concat of its arguments converted with string, in to IN or contains,
+// map/filter/all/some/none/reduce to the lambda functions, and so on.
+// Operations it does not know, such as those added with add_operation,
+// become calls of the AMEL function of the same name. Export does the
+// reverse for the expressions Import produces and fails with
+// ErrInvalidSyntax on anything JSONLogic cannot express, such as regular
+// expressions or durations.
+//
+// The two languages differ in a few corners: AMEL comparisons do not
+// convert strings to numbers unless the engine uses WithTypeCoercion, && and
+// || return booleans rather than the deciding operand, "all" of an empty list
+// is true, merge flattens nested lists completely, cat writes null as "null"
+// rather than an empty string, and in only tests for a substring when its
+// second argument is a literal string.
+package jsonlogic
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/lexer"
+)
+
+// Names of the lambda parameters of imported rules, for the element of map,
+// filter, all, some, and none, and for the arguments of the reduce lambda.
+const (
+	elementParam     = "x"
+	currentParam     = "current"
+	accumulatorParam = "accumulator"
+)
+
+// Import converts a JSONLogic rule, given as JSON, to an AMEL expression.
+// Print it with format.Node to get the DSL source.
+func Import(data []byte) (ast.Expression, error) {
+	var rule interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&rule); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "invalid JSONLogic rule", err)
+	}
+	return ImportRule(rule)
+}
+
+// ImportRule converts a decoded JSONLogic rule to an AMEL expression. The
+// rule holds the values encoding/json decodes: maps, slices, strings,
+// bools, nil, and float64 or json.Number numbers.
+func ImportRule(rule interface{}) (ast.Expression, error) {
+	return (&importer{}).rule(rule)
+}
+
+// Scopes of var: the data, the element of map, filter, all, some, and none,
+// or the current element and accumulator of reduce.
+const (
+	dataScope = iota
+	elementScope
+	reduceScope
+)
+
+// importer converts rules in a scope.
+type importer struct {
+	scope int
+}
+
+func (im *importer) rule(rule interface{}) (ast.Expression, error) {
+	switch r := rule.(type) {
+	case []interface{}:
+		elements := make([]ast.Expression, len(r))
+		for i, elem := range r {
+			expr, err := im.rule(elem)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = expr
+		}
+		return list(elements...), nil
+	case map[string]interface{}:
+		if len(r) != 1 {
+			// Objects other than operations are data
+			return literal(r)
+		}
+		for op, args := range r {
+			return im.operation(op, args)
+		}
+	}
+	return literal(rule)
+}
+
+// operation converts the operation op applied to args, which JSONLogic
+// allows to be a single argument instead of a list.
+func (im *importer) operation(op string, value interface{}) (ast.Expression, error) {
+	raw, ok := value.([]interface{})
+	if !ok {
+		raw = []interface{}{value}
+	}
+
+	switch op {
+	case "var":
+		return im.variable(raw)
+	case "missing":
+		if len(raw) == 1 {
+			if keys, ok := raw[0].([]interface{}); ok {
+				return im.missing(keys)
+			}
+		}
+		return im.missing(raw)
+	case "missing_some":
+		if len(raw) != 2 {
+			return nil, errors.New(errors.ErrInvalidSyntax, "missing_some requires a count and a list of keys")
+		}
+		keys, ok := raw[1].([]interface{})
+		if !ok {
+			return nil, errors.New(errors.ErrInvalidSyntax, "missing_some requires a list of keys")
+		}
+		need, err := im.rule(raw[0])
+		if err != nil {
+			return nil, err
+		}
+		missing, err := im.missing(keys)
+		if err != nil {
+			return nil, err
+		}
+		// At least need keys present gives no missing keys
+		present := binary("-", integer(int64(len(keys))), call("len", missing))
+		return conditional(binary(">=", present, need), list(), missing), nil
+	case "map", "filter", "all", "some", "none":
+		return im.iteration(op, raw)
+	case "reduce":
+		return im.reduce(raw)
+	}
+
+	args, err := im.rules(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "==", "===":
+		return comparison("==", args)
+	case "!=", "!==":
+		return comparison("!=", args)
+	case ">", ">=":
+		return comparison(op, args)
+	case "<", "<=":
+		if len(args) == 3 {
+			// Between: a < b < c
+			return binary("&&", binary(op, args[0], args[1]), binary(op, args[1], args[2])), nil
+		}
+		return comparison(op, args)
+	case "!":
+		if len(args) != 1 {
+			return nil, errors.New(errors.ErrInvalidSyntax, "! requires 1 argument")
+		}
+		return unary("!", args[0]), nil
+	case "!!":
+		if len(args) != 1 {
+			return nil, errors.New(errors.ErrInvalidSyntax, "!! requires 1 argument")
+		}
+		return call("bool", args[0]), nil
+	case "and", "or":
+		if len(args) == 0 {
+			return nil, errors.Newf(errors.ErrInvalidSyntax, "%s requires at least 1 argument", op)
+		}
+		operator := "&&"
+		if op == "or" {
+			operator = "||"
+		}
+		return chain(operator, args), nil
+	case "if", "?:":
+		return ifThenElse(args), nil
+	case "+":
+		switch len(args) {
+		case 0:
+			return integer(0), nil
+		case 1:
+			return call("float", args[0]), nil
+		}
+		return chain("+", args), nil
+	case "*":
+		if len(args) == 0 {
+			return nil, errors.New(errors.ErrInvalidSyntax, "* requires at least 1 argument")
+		}
+		return chain("*", args), nil
+	case "-":
+		switch len(args) {
+		case 1:
+			return unary("-", args[0]), nil
+		case 2:
+			return binary("-", args[0], args[1]), nil
+		}
+		return nil, errors.New(errors.ErrInvalidSyntax, "- requires 1 or 2 arguments")
+	case "/", "%":
+		if len(args) != 2 {
+			return nil, errors.Newf(errors.ErrInvalidSyntax, "%s requires 2 arguments", op)
+		}
+		return binary(op, args[0], args[1]), nil
+	case "in":
+		if len(args) != 2 {
+			return nil, errors.New(errors.ErrInvalidSyntax, "in requires 2 arguments")
+		}
+		if _, ok := args[1].(*ast.StringLiteral); ok {
+			return call("contains", args[1], args[0]), nil
+		}
+		return &ast.InExpression{Token: token(lexer.TOKEN_IN, "IN"), Left: args[0], Right: args[1]}, nil
+	case "cat":
+		// cat converts its arguments to strings; concat requires strings
+		for i, arg := range args {
+			if _, ok := arg.(*ast.StringLiteral); !ok {
+				args[i] = call("string", arg)
+			}
+		}
+		return call("concat", args...), nil
+	case "substr":
+		switch len(args) {
+		case 2:
+			return call("substr", args[0], args[1], call("len", args[0])), nil
+		case 3:
+			return call("substr", args...), nil
+		}
+		return nil, errors.New(errors.ErrInvalidSyntax, "substr requires 2 or 3 arguments")
+	case "merge":
+		return call("flatten", list(args...)), nil
+	case "log":
+		return nil, errors.New(errors.ErrInvalidSyntax, "unsupported JSONLogic operation: log")
+	}
+
+	if !identifier.MatchString(op) || lexer.LookupIdent(op) != lexer.TOKEN_IDENT {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "unsupported JSONLogic operation: %s", op)
+	}
+	// A custom operation
+	return call(op, args...), nil
+}
+
+func (im *importer) rules(raw []interface{}) ([]ast.Expression, error) {
+	args := make([]ast.Expression, len(raw))
+	for i, arg := range raw {
+		expr, err := im.rule(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = expr
+	}
+	return args, nil
+}
+
+// variable converts var, whose arguments are a path and an optional default.
+func (im *importer) variable(args []interface{}) (ast.Expression, error) {
+	if len(args) == 0 {
+		return im.path(""), nil
+	}
+
+	var path string
+	switch p := args[0].(type) {
+	case nil:
+	case string:
+		path = p
+	case json.Number:
+		path = p.String()
+	case float64:
+		path = strconv.FormatFloat(p, 'f', -1, 64)
+	default:
+		return nil, errors.New(errors.ErrInvalidSyntax, "var requires a literal path")
+	}
+
+	expr := im.path(path)
+	if len(args) > 1 {
+		def, err := im.rule(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return call("defaultVal", expr, def), nil
+	}
+	return expr, nil
+}
+
+// path converts the dotted path of var, such as "user.tags.0".
+func (im *importer) path(path string) ast.Expression {
+	var segments []string
+	if path != "" {
+		segments = strings.Split(path, ".")
+	}
+
+	if im.scope == dataScope {
+		jp := "$"
+		for _, seg := range segments {
+			switch {
+			case isIndex(seg):
+				jp += "[" + seg + "]"
+			case isKey(seg):
+				jp += "." + seg
+			default:
+				jp += "[" + strconv.Quote(seg) + "]"
+			}
+		}
+		return &ast.JSONPathExpression{Token: token(lexer.TOKEN_DOLLAR, "$"), Path: jp}
+	}
+
+	root := elementParam
+	if im.scope == reduceScope {
+		// Inside reduce, the data is {"current": ..., "accumulator": ...}
+		if len(segments) == 0 || segments[0] != currentParam && segments[0] != accumulatorParam {
+			return null()
+		}
+		root, segments = segments[0], segments[1:]
+	}
+	var expr ast.Expression = ident(root)
+	for _, seg := range segments {
+		switch {
+		case isIndex(seg):
+			n, _ := strconv.ParseInt(seg, 10, 64)
+			expr = &ast.IndexExpression{Token: token(lexer.TOKEN_LBRACKET, "["), Left: expr, Index: integer(n)}
+		case isKey(seg):
+			expr = &ast.MemberExpression{Token: token(lexer.TOKEN_DOT, "."), Object: expr, Property: ident(seg)}
+		default:
+			expr = &ast.IndexExpression{Token: token(lexer.TOKEN_LBRACKET, "["), Left: expr, Index: str(seg)}
+		}
+	}
+	return expr
+}
+
+// missing converts missing, which lists the keys whose values are null, as
+// flatten([isNull($.a) ? ["a"] : [], ...]).
+func (im *importer) missing(keys []interface{}) (ast.Expression, error) {
+	checks := make([]ast.Expression, len(keys))
+	for i, key := range keys {
+		name, ok := key.(string)
+		if !ok {
+			return nil, errors.New(errors.ErrInvalidSyntax, "missing requires literal keys")
+		}
+		checks[i] = conditional(call("isNull", im.path(name)), list(str(name)), list())
+	}
+	return call("flatten", list(checks...)), nil
+}
+
+// iteration converts map, filter, all, some, and none, whose arguments are a
+// list and a rule applied to each element.
+func (im *importer) iteration(op string, raw []interface{}) (ast.Expression, error) {
+	if len(raw) != 2 {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "%s requires 2 arguments", op)
+	}
+	items, err := im.rule(raw[0])
+	if err != nil {
+		return nil, err
+	}
+	body, err := (&importer{scope: elementScope}).rule(raw[1])
+	if err != nil {
+		return nil, err
+	}
+
+	fn := lambda(body, elementParam)
+	switch op {
+	case "all":
+		return call("every", items, fn), nil
+	case "none":
+		return unary("!", call("some", items, fn)), nil
+	}
+	return call(op, items, fn), nil
+}
+
+// reduce converts reduce, whose arguments are a list, a rule combining
+// "current" and "accumulator", and the initial accumulator.
+func (im *importer) reduce(raw []interface{}) (ast.Expression, error) {
+	if len(raw) != 3 {
+		return nil, errors.New(errors.ErrInvalidSyntax, "reduce requires 3 arguments")
+	}
+	items, err := im.rule(raw[0])
+	if err != nil {
+		return nil, err
+	}
+	body, err := (&importer{scope: reduceScope}).rule(raw[1])
+	if err != nil {
+		return nil, err
+	}
+	initial, err := im.rule(raw[2])
+	if err != nil {
+		return nil, err
+	}
+	return call("reduce", items, initial, lambda(body, accumulatorParam, currentParam)), nil
+}
+
+// literal converts data, which is not evaluated.
+func literal(value interface{}) (ast.Expression, error) {
+	switch v := value.(type) {
+	case nil:
+		return null(), nil
+	case bool:
+		if v {
+			return &ast.BooleanLiteral{Token: token(lexer.TOKEN_TRUE, "true"), Value: true}, nil
+		}
+		return &ast.BooleanLiteral{Token: token(lexer.TOKEN_FALSE, "false"), Value: false}, nil
+	case string:
+		return str(v), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return integer(n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, errors.Wrap(errors.ErrInvalidSyntax, "invalid number "+v.String(), err)
+		}
+		return float(f), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return integer(int64(v)), nil
+		}
+		return float(v), nil
+	case int:
+		return integer(int64(v)), nil
+	case int64:
+		return integer(v), nil
+	case []interface{}:
+		elements := make([]ast.Expression, len(v))
+		for i, elem := range v {
+			expr, err := literal(elem)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = expr
+		}
+		return list(elements...), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]ast.Expression, len(keys))
+		for i, key := range keys {
+			expr, err := literal(v[key])
+			if err != nil {
+				return nil, err
+			}
+			values[i] = expr
+		}
+		return &ast.MapLiteral{Token: token(lexer.TOKEN_LBRACE, "{"), Keys: keys, Values: values}, nil
+	}
+	return nil, errors.Newf(errors.ErrInvalidSyntax, "unsupported JSONLogic value of type %T", value)
+}
+
+// comparison converts a comparison of 2 arguments.
+func comparison(op string, args []ast.Expression) (ast.Expression, error) {
+	if len(args) != 2 {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "%s requires 2 arguments", op)
+	}
+	return binary(op, args[0], args[1]), nil
+}
+
+// chain joins args with a left-associative operator.
+func chain(op string, args []ast.Expression) ast.Expression {
+	expr := args[0]
+	for _, arg := range args[1:] {
+		expr = binary(op, expr, arg)
+	}
+	return expr
+}
+
+// ifThenElse converts the arguments of if: conditions and results in turn,
+// and an optional result if no condition holds.
+func ifThenElse(args []ast.Expression) ast.Expression {
+	switch len(args) {
+	case 0:
+		return null()
+	case 1:
+		return args[0]
+	case 2:
+		return conditional(args[0], args[1], null())
+	case 3:
+		return conditional(args[0], args[1], args[2])
+	}
+
+	ce := &ast.CaseExpression{Token: token(lexer.TOKEN_IDENT, "case")}
+	for i := 0; i+1 < len(args); i += 2 {
+		ce.Conditions = append(ce.Conditions, args[i])
+		ce.Results = append(ce.Results, args[i+1])
+	}
+	if len(args)%2 == 1 {
+		ce.Default = args[len(args)-1]
+	}
+	return ce
+}
+
+// identifier matches the names AMEL can write without quoting.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// isKey reports whether a path segment can follow a dot.
+func isKey(seg string) bool {
+	return identifier.MatchString(seg) && lexer.LookupIdent(seg) == lexer.TOKEN_IDENT
+}
+
+// isIndex reports whether a path segment is a list index.
+func isIndex(seg string) bool {
+	if seg == "" {
+		return false
+	}
+	for _, c := range seg {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func token(t lexer.TokenType, literal string) lexer.Token {
+	return lexer.Token{Type: t, Literal: literal}
+}
+
+// operatorTokens maps the operators of imported expressions to their tokens.
+var operatorTokens = map[string]lexer.TokenType{
+	"==": lexer.TOKEN_EQ,
+	"!=": lexer.TOKEN_NEQ,
+	"<":  lexer.TOKEN_LT,
+	">":  lexer.TOKEN_GT,
+	"<=": lexer.TOKEN_LTE,
+	">=": lexer.TOKEN_GTE,
+	"&&": lexer.TOKEN_LAND,
+	"||": lexer.TOKEN_LOR,
+	"+":  lexer.TOKEN_PLUS,
+	"-":  lexer.TOKEN_MINUS,
+	"*":  lexer.TOKEN_STAR,
+	"/":  lexer.TOKEN_SLASH,
+	"%":  lexer.TOKEN_PERCENT,
+	"!":  lexer.TOKEN_BANG,
+}
+
+func binary(op string, left, right ast.Expression) ast.Expression {
+	return &ast.BinaryExpression{Token: token(operatorTokens[op], op), Left: left, Operator: op, Right: right}
+}
+
+func unary(op string, operand ast.Expression) ast.Expression {
+	return &ast.UnaryExpression{Token: token(operatorTokens[op], op), Operator: op, Operand: operand}
+}
+
+func conditional(cond, consequence, alternative ast.Expression) ast.Expression {
+	return &ast.ConditionalExpression{
+		Token:       token(lexer.TOKEN_QUESTION, "?"),
+		Condition:   cond,
+		Consequence: consequence,
+		Alternative: alternative,
+	}
+}
+
+func call(name string, args ...ast.Expression) ast.Expression {
+	return &ast.FunctionCall{Token: token(lexer.TOKEN_IDENT, name), Name: name, Arguments: args}
+}
+
+func lambda(body ast.Expression, params ...string) ast.Expression {
+	fn := &ast.LambdaExpression{Token: token(lexer.TOKEN_ARROW, "=>"), Body: body}
+	for _, p := range params {
+		fn.Parameters = append(fn.Parameters, ident(p))
+	}
+	return fn
+}
+
+func list(elements ...ast.Expression) ast.Expression {
+	if elements == nil {
+		elements = []ast.Expression{}
+	}
+	return &ast.ListLiteral{Token: token(lexer.TOKEN_LBRACKET, "["), Elements: elements}
+}
+
+func ident(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token(lexer.TOKEN_IDENT, name), Value: name}
+}
+
+func integer(n int64) ast.Expression {
+	return &ast.IntegerLiteral{Token: token(lexer.TOKEN_INT, strconv.FormatInt(n, 10)), Value: n}
+}
+
+func float(f float64) ast.Expression {
+	lit := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(lit, ".") {
+		lit += ".0"
+	}
+	return &ast.FloatLiteral{Token: token(lexer.TOKEN_FLOAT, lit), Value: f}
+}
+
+func str(s string) ast.Expression {
+	return &ast.StringLiteral{Token: token(lexer.TOKEN_STRING, s), Value: s}
+}
+
+func null() ast.Expression {
+	return &ast.NullLiteral{Token: token(lexer.TOKEN_NULL, "null")}
+}
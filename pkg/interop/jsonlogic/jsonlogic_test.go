@@ -0,0 +1,184 @@
+package jsonlogic
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/bencagri/amel/pkg/format"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		rule     string
+		expected string
+	}{
+		{`{"==": [{"var": "user.age"}, 18]}`, `$.user.age == 18`},
+		{`{"===": [{"var": "tags.0"}, "vip"]}`, `$.tags[0] == "vip"`},
+		{`{"var": "user.first name"}`, `$.user["first name"]`},
+		{`{"var": ""}`, `$`},
+		{`{"var": ["score", 0]}`, `defaultVal($.score, 0)`},
+		{`{"and": [{">": [{"var": "a"}, 1]}, {"<": [{"var": "b"}, 2.5]}, true]}`, `$.a > 1 && $.b < 2.5 && true`},
+		{`{"or": [{"!": {"var": "a"}}, {"!!": [{"var": "b"}]}]}`, `!$.a || bool($.b)`},
+		{`{"<=": [1, {"var": "x"}, 10]}`, `1 <= $.x && $.x <= 10`},
+		{`{"if": [{"var": "vip"}, "gold", "basic"]}`, `$.vip ? "gold" : "basic"`},
+		{`{"if": [{">": [{"var": "n"}, 10]}, "big", {">": [{"var": "n"}, 5]}, "medium", "small"]}`,
+			`case { $.n > 10 => "big"; $.n > 5 => "medium"; else => "small" }`},
+		{`{"+": [1, 2, 3]}`, `1 + 2 + 3`},
+		{`{"+": "3.5"}`, `float("3.5")`},
+		{`{"-": [{"var": "a"}]}`, `-$.a`},
+		{`{"*": [2, {"/": [{"var": "a"}, 4]}]}`, `2 * ($.a / 4)`},
+		{`{"in": [{"var": "country"}, ["DE", "FR"]]}`, `$.country IN ["DE", "FR"]`},
+		{`{"in": ["Spring", "Springfield"]}`, `contains("Springfield", "Spring")`},
+		{`{"cat": ["Hello, ", {"var": "name"}]}`, `concat("Hello, ", string($.name))`},
+		{`{"cat": ["a", 1]}`, `concat("a", string(1))`},
+		{`{"substr": [{"var": "code"}, 2]}`, `substr($.code, 2, len($.code))`},
+		{`{"merge": [[1, 2], [3]]}`, `flatten([[1, 2], [3]])`},
+		{`{"max": [1, {"var": "a"}]}`, `max(1, $.a)`},
+		{`{"map": [{"var": "items"}, {"*": [{"var": "price"}, 2]}]}`, `map($.items, x => x.price * 2)`},
+		{`{"filter": [{"var": "nums"}, {">": [{"var": ""}, 2]}]}`, `filter($.nums, x => x > 2)`},
+		{`{"all": [{"var": "items"}, {"var": "stock.0"}]}`, `every($.items, x => x.stock[0])`},
+		{`{"none": [{"var": "items"}, {"var": "broken"}]}`, `!some($.items, x => x.broken)`},
+		{`{"reduce": [{"var": "items"}, {"+": [{"var": "current.price"}, {"var": "accumulator"}]}, 0]}`,
+			`reduce($.items, 0, (accumulator, current) => current.price + accumulator)`},
+		{`{"missing": ["a", "b"]}`, `flatten([isNull($.a) ? ["a"] : [], isNull($.b) ? ["b"] : []])`},
+		{`{"isAdult": [{"var": "age"}]}`, `isAdult($.age)`},
+		{`{"a": 1, "b": [true, null]}`, `{"a": 1, "b": [true, null]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			expr, err := Import([]byte(tt.rule))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, format.Node(expr))
+
+			// The printed expression parses back to the same form
+			source, err := format.Source(format.Node(expr))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, source)
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	for _, rule := range []string{
+		`{"==": [1]}`,
+		`{"var": {"cat": ["a", "b"]}}`,
+		`{"log": "x"}`,
+		`{"not an operation": [1]}`,
+		`{"map": [[1, 2]]}`,
+		`{"missing": [{"var": "a"}]}`,
+		`{"==": [1, 2]`,
+	} {
+		_, err := Import([]byte(rule))
+		assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax), rule)
+	}
+}
+
+func TestImportEvaluate(t *testing.T) {
+	eng, err := engine.New()
+	require.NoError(t, err)
+
+	payload := map[string]interface{}{
+		"user":  map[string]interface{}{"age": 30, "country": "DE"},
+		"items": []interface{}{map[string]interface{}{"price": 10}, map[string]interface{}{"price": 25}},
+	}
+	tests := []struct {
+		rule     string
+		expected interface{}
+	}{
+		{`{"and": [{">=": [{"var": "user.age"}, 18]}, {"in": [{"var": "user.country"}, ["DE", "FR"]]}]}`, true},
+		{`{"reduce": [{"var": "items"}, {"+": [{"var": "current.price"}, {"var": "accumulator"}]}, 0]}`, int64(35)},
+		{`{"some": [{"var": "items"}, {">": [{"var": "price"}, 20]}]}`, true},
+		{`{"missing": ["user.age", "user.email"]}`, []interface{}{"user.email"}},
+		{`{"missing_some": [1, ["user.email", "user.country"]]}`, []interface{}{}},
+		{`{"if": [{"<": [{"var": "user.age"}, 18]}, "minor", "adult"]}`, "adult"},
+		{`{"cat": ["a", 1]}`, "a1"},
+		{`{"cat": ["age: ", {"var": "user.age"}, ", ", true]}`, "age: 30, true"},
+	}
+
+	for _, tt := range tests {
+		expr, err := Import([]byte(tt.rule))
+		require.NoError(t, err, tt.rule)
+		result, err := eng.EvaluateDirect(format.Node(expr), payload)
+		require.NoError(t, err, tt.rule)
+		assert.Equal(t, tt.expected, result.Plain(), tt.rule)
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		dsl      string
+		expected string
+	}{
+		{`$.user.age >= 18 AND $.user["first name"] != "x"`, `{"and":[{">=":[{"var":"user.age"},18]},{"!=":[{"var":"user.first name"},"x"]}]}`},
+		{`$.a || ($.b || !$.c)`, `{"or":[{"var":"a"},{"var":"b"},{"!":[{"var":"c"}]}]}`},
+		{`$.tags[1] NOT IN ["a"]`, `{"!":[{"in":[{"var":"tags.1"},["a"]]}]}`},
+		{`contains($.name, "ann")`, `{"in":["ann",{"var":"name"}]}`},
+		{`isNull($.email)`, `{"==":[{"var":"email"},null]}`},
+		{`defaultVal($.score, 1.5) * 2`, `{"*":[{"var":["score",1.5]},2]}`},
+		{`every($.items, item => item.qty > 0)`, `{"all":[{"var":"items"},{">":[{"var":"qty"},0]}]}`},
+		{`isAdult($.age)`, `{"isAdult":[{"var":"age"}]}`},
+		{`{"a": 1, "b": "x"}`, `{"a":1,"b":"x"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsl, func(t *testing.T) {
+			data, err := ExportSource(tt.dsl)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.expected, string(data))
+		})
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	for _, dsl := range []string{
+		`$.name =~ "^a"`,
+		`$.timeout > 5m`,
+		`$.items[$.i]`,
+		`map($.items, x => x.price * $.rate)`,
+		`map($.items, upper)`,
+		`{"a": $.b}`,
+		`$["a.b"] == 1`,
+	} {
+		_, err := ExportSource(dsl)
+		assert.Error(t, err, dsl)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, rule := range []string{
+		`{"and":[{"==":[{"var":"user.age"},18]},{"!=":[{"var":"tags.0"},"vip"]}]}`,
+		`{"if":[{">":[{"var":"n"},10]},"big",{">":[{"var":"n"},5]},"medium","small"]}`,
+		`{"if":[{"var":"vip"},"gold","basic"]}`,
+		`{"var":["score",0]}`,
+		`{"in":["Spring","Springfield"]}`,
+		`{"in":[{"var":"country"},["DE","FR"]]}`,
+		`{"cat":["Hello, ",{"var":"name"}]}`,
+		`{"cat":["a",1]}`,
+		`{"substr":[{"var":"code"},2]}`,
+		`{"merge":[[1,2],[3]]}`,
+		`{"!!":[{"var":"b"}]}`,
+		`{"+":[{"var":"a"}]}`,
+		`{"map":[{"var":"items"},{"*":[{"var":"price"},2]}]}`,
+		`{"filter":[{"var":"nums"},{">":[{"var":""},2]}]}`,
+		`{"none":[{"var":"items"},{"var":"broken"}]}`,
+		`{"reduce":[{"var":"items"},{"+":[{"var":"current.price"},{"var":"accumulator"}]},0]}`,
+		`{"isAdult":[{"var":"age"}]}`,
+	} {
+		expr, err := Import([]byte(rule))
+		require.NoError(t, err, rule)
+		data, err := Export(expr)
+		require.NoError(t, err, rule)
+		assert.JSONEq(t, rule, string(data))
+
+		var decoded interface{}
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		again, err := ImportRule(decoded)
+		require.NoError(t, err, rule)
+		assert.Equal(t, format.Node(expr), format.Node(again), rule)
+	}
+}
@@ -112,6 +112,18 @@ func (l *Lexer) NextToken() Token {
 	case '%':
 		tok = l.newToken(TOKEN_PERCENT, string(l.ch))
 		l.readChar()
+	case '~':
+		if l.peekChar() == '/' {
+			ch := l.ch
+			l.readChar()
+			tok = l.newToken(TOKEN_INT_DIV, string(ch)+string(l.ch))
+			l.readChar()
+		} else {
+			tok = l.newToken(TOKEN_ILLEGAL, string(l.ch))
+			l.addError(errors.NewAtf(errors.ErrUnexpectedCharacter, l.line, l.startColumn,
+				"unexpected character '~', did you mean '~/'?"))
+			l.readChar()
+		}
 	case '(':
 		tok = l.newToken(TOKEN_LPAREN, string(l.ch))
 		l.readChar()
@@ -124,6 +136,12 @@ func (l *Lexer) NextToken() Token {
 	case ']':
 		tok = l.newToken(TOKEN_RBRACKET, string(l.ch))
 		l.readChar()
+	case '{':
+		tok = l.newToken(TOKEN_LBRACE, string(l.ch))
+		l.readChar()
+	case '}':
+		tok = l.newToken(TOKEN_RBRACE, string(l.ch))
+		l.readChar()
 	case ',':
 		tok = l.newToken(TOKEN_COMMA, string(l.ch))
 		l.readChar()
@@ -136,6 +154,12 @@ func (l *Lexer) NextToken() Token {
 	case '$':
 		tok = l.newToken(TOKEN_DOLLAR, string(l.ch))
 		l.readChar()
+	case '?':
+		tok = l.newToken(TOKEN_QUESTION, string(l.ch))
+		l.readChar()
+	case ';':
+		tok = l.newToken(TOKEN_SEMICOLON, string(l.ch))
+		l.readChar()
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -329,7 +353,8 @@ func (l *Lexer) readIdentifier() Token {
 	}
 }
 
-// readNumber reads a number (integer or float).
+// readNumber reads a number (integer or float), or a duration such as 5m or
+// 2h30m.
 func (l *Lexer) readNumber() Token {
 	startPos := l.position
 	startCol := l.column
@@ -351,6 +376,19 @@ func (l *Lexer) readNumber() Token {
 		}
 	}
 
+	// A unit right after the number makes a duration
+	if n := durationSuffixLen(l.input[l.position:]); n > 0 {
+		for end := l.position + n; l.position < end; {
+			l.readChar()
+		}
+		return Token{
+			Type:    TOKEN_DURATION,
+			Literal: l.input[startPos:l.position],
+			Line:    l.startLine,
+			Column:  startCol,
+		}
+	}
+
 	// Check for exponent (scientific notation)
 	if l.ch == 'e' || l.ch == 'E' {
 		isFloat = true
@@ -483,6 +521,52 @@ func isLetter(ch rune) bool {
 	return unicode.IsLetter(ch) || ch == '_'
 }
 
+// durationUnits holds the units of duration literals, longest first so that
+// "ms" is matched before "m".
+var durationUnits = []string{"ns", "us", "µs", "ms", "s", "m", "h", "d"}
+
+// durationSuffixLen returns the length of the units and further amounts, such
+// as "h30m" in 2h30m, that follow the first amount of a duration literal, or 0
+// if s does not start with a unit or is followed by more of an identifier, as
+// in 5min.
+func durationSuffixLen(s string) int {
+	i := 0
+	for {
+		unit := ""
+		for _, u := range durationUnits {
+			if strings.HasPrefix(s[i:], u) {
+				unit = u
+				break
+			}
+		}
+		if unit == "" {
+			return 0
+		}
+		i += len(unit)
+
+		// Another amount, as in 2h30m
+		j := i
+		for j < len(s) && isDigit(rune(s[j])) {
+			j++
+		}
+		if j > i && j+1 < len(s) && s[j] == '.' && isDigit(rune(s[j+1])) {
+			j += 2
+			for j < len(s) && isDigit(rune(s[j])) {
+				j++
+			}
+		}
+		if j == i {
+			break
+		}
+		i = j
+	}
+
+	if next, _ := utf8.DecodeRuneInString(s[i:]); isLetter(next) || isDigit(next) {
+		return 0
+	}
+	return i
+}
+
 // isDigit checks if a rune is a digit.
 func isDigit(ch rune) bool {
 	return ch >= '0' && ch <= '9'
@@ -22,10 +22,14 @@ func TestLexer_SingleCharacterTokens(t *testing.T) {
 		{")", []TokenType{TOKEN_RPAREN, TOKEN_EOF}},
 		{"[", []TokenType{TOKEN_LBRACKET, TOKEN_EOF}},
 		{"]", []TokenType{TOKEN_RBRACKET, TOKEN_EOF}},
+		{"{", []TokenType{TOKEN_LBRACE, TOKEN_EOF}},
+		{"}", []TokenType{TOKEN_RBRACE, TOKEN_EOF}},
 		{",", []TokenType{TOKEN_COMMA, TOKEN_EOF}},
 		{".", []TokenType{TOKEN_DOT, TOKEN_EOF}},
 		{":", []TokenType{TOKEN_COLON, TOKEN_EOF}},
 		{"$", []TokenType{TOKEN_DOLLAR, TOKEN_EOF}},
+		{"?", []TokenType{TOKEN_QUESTION, TOKEN_EOF}},
+		{";", []TokenType{TOKEN_SEMICOLON, TOKEN_EOF}},
 		{"!", []TokenType{TOKEN_BANG, TOKEN_EOF}},
 		{"<", []TokenType{TOKEN_LT, TOKEN_EOF}},
 		{">", []TokenType{TOKEN_GT, TOKEN_EOF}},
@@ -54,6 +58,7 @@ func TestLexer_TwoCharacterTokens(t *testing.T) {
 		{">=", TOKEN_GTE, ">="},
 		{"&&", TOKEN_LAND, "&&"},
 		{"||", TOKEN_LOR, "||"},
+		{"~/", TOKEN_INT_DIV, "~/"},
 	}
 
 	for _, tt := range tests {
@@ -183,6 +188,36 @@ func TestLexer_FloatLiterals(t *testing.T) {
 	}
 }
 
+func TestLexer_DurationLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Token
+	}{
+		{"5m", []Token{{Type: TOKEN_DURATION, Literal: "5m"}}},
+		{"2h30m", []Token{{Type: TOKEN_DURATION, Literal: "2h30m"}}},
+		{"1.5h", []Token{{Type: TOKEN_DURATION, Literal: "1.5h"}}},
+		{"300ms", []Token{{Type: TOKEN_DURATION, Literal: "300ms"}}},
+		{"7d", []Token{{Type: TOKEN_DURATION, Literal: "7d"}}},
+		{"1e3", []Token{{Type: TOKEN_FLOAT, Literal: "1e3"}}},
+		{"5min", []Token{{Type: TOKEN_INT, Literal: "5"}, {Type: TOKEN_IDENT, Literal: "min"}}},
+		{"2h30", []Token{{Type: TOKEN_INT, Literal: "2"}, {Type: TOKEN_IDENT, Literal: "h30"}}},
+		{"now()-7d", []Token{{Type: TOKEN_IDENT, Literal: "now"}, {Type: TOKEN_LPAREN, Literal: "("},
+			{Type: TOKEN_RPAREN, Literal: ")"}, {Type: TOKEN_MINUS, Literal: "-"}, {Type: TOKEN_DURATION, Literal: "7d"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			l := New(tt.input)
+			for _, expected := range tt.expected {
+				tok := l.NextToken()
+				assert.Equal(t, expected.Type, tok.Type)
+				assert.Equal(t, expected.Literal, tok.Literal)
+			}
+			assert.Equal(t, TOKEN_EOF, l.NextToken().Type)
+		})
+	}
+}
+
 func TestLexer_StringLiterals(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -748,7 +783,7 @@ func TestToken_IsComparisonOperator(t *testing.T) {
 }
 
 func TestToken_IsArithmeticOperator(t *testing.T) {
-	arithOps := []TokenType{TOKEN_PLUS, TOKEN_MINUS, TOKEN_STAR, TOKEN_SLASH, TOKEN_PERCENT}
+	arithOps := []TokenType{TOKEN_PLUS, TOKEN_MINUS, TOKEN_STAR, TOKEN_SLASH, TOKEN_INT_DIV, TOKEN_PERCENT}
 	for _, op := range arithOps {
 		tok := Token{Type: op}
 		assert.True(t, tok.IsArithmeticOperator(), "token type: %v", op)
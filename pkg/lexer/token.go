@@ -62,6 +62,15 @@ const (
 
 	// JSONPath
 	TOKEN_DOLLAR // $
+
+	// Appended so that the values of the tokens above, stored in compiled
+	// expressions, do not change
+	TOKEN_DURATION  // duration literal, such as 5m or 2h30m
+	TOKEN_LBRACE    // {
+	TOKEN_RBRACE    // }
+	TOKEN_INT_DIV   // ~/
+	TOKEN_QUESTION  // ?
+	TOKEN_SEMICOLON // ;
 )
 
 var tokenNames = map[TokenType]string{
@@ -112,6 +121,13 @@ var tokenNames = map[TokenType]string{
 	TOKEN_ARROW:    "=>",
 
 	TOKEN_DOLLAR: "$",
+
+	TOKEN_DURATION:  "DURATION",
+	TOKEN_LBRACE:    "{",
+	TOKEN_RBRACE:    "}",
+	TOKEN_INT_DIV:   "~/",
+	TOKEN_QUESTION:  "?",
+	TOKEN_SEMICOLON: ";",
 }
 
 // String returns the string representation of a token type.
@@ -177,9 +193,10 @@ func (t Token) IsOneOf(types ...TokenType) bool {
 	return false
 }
 
-// IsLiteral checks if the token is a literal (int, float, string, bool, null).
+// IsLiteral checks if the token is a literal (int, float, duration, string,
+// bool, null).
 func (t Token) IsLiteral() bool {
-	return t.IsOneOf(TOKEN_INT, TOKEN_FLOAT, TOKEN_STRING, TOKEN_TRUE, TOKEN_FALSE, TOKEN_NULL)
+	return t.IsOneOf(TOKEN_INT, TOKEN_FLOAT, TOKEN_DURATION, TOKEN_STRING, TOKEN_TRUE, TOKEN_FALSE, TOKEN_NULL)
 }
 
 // IsComparisonOperator checks if the token is a comparison operator.
@@ -189,7 +206,7 @@ func (t Token) IsComparisonOperator() bool {
 
 // IsArithmeticOperator checks if the token is an arithmetic operator.
 func (t Token) IsArithmeticOperator() bool {
-	return t.IsOneOf(TOKEN_PLUS, TOKEN_MINUS, TOKEN_STAR, TOKEN_SLASH, TOKEN_PERCENT)
+	return t.IsOneOf(TOKEN_PLUS, TOKEN_MINUS, TOKEN_STAR, TOKEN_SLASH, TOKEN_INT_DIV, TOKEN_PERCENT)
 }
 
 // IsLogicalOperator checks if the token is a logical operator.
@@ -0,0 +1,266 @@
+// Package lint reports suspicious constructs in AMEL expressions.
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/format"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/lexer"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+// Severity indicates how serious an issue is.
+type Severity int
+
+const (
+	// SeverityWarning marks code that is valid but likely not what was intended.
+	SeverityWarning Severity = iota
+	// SeverityError marks code that fails or cannot match at runtime.
+	SeverityError
+)
+
+// String returns the string representation of the severity.
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Rule names reported in Issue.Rule
+const (
+	RuleUnknownFunction    = "unknown-function"
+	RuleConstantOperand    = "constant-operand"
+	RuleBooleanComparison  = "boolean-comparison"
+	RuleSelfComparison     = "self-comparison"
+	RuleNullOrdering       = "null-ordering"
+	RuleEmptyList          = "empty-list"
+	RuleDuplicateElement   = "duplicate-element"
+	RuleInvalidRegex       = "invalid-regex"
+	RuleConstantExpression = "constant-expression"
+)
+
+// Issue is a single lint finding.
+type Issue struct {
+	Rule     string
+	Severity Severity
+	Message  string
+	Line     int
+	Column   int
+}
+
+// String formats the issue as "line:column: severity: message (rule)".
+func (i Issue) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s (%s)", i.Line, i.Column, i.Severity, i.Message, i.Rule)
+}
+
+// Linter checks expressions for suspicious constructs.
+type Linter struct {
+	functions *functions.Registry
+}
+
+// Option is a function that configures the linter.
+type Option func(*Linter)
+
+// WithFunctions enables the unknown-function check against the given registry.
+func WithFunctions(r *functions.Registry) Option {
+	return func(l *Linter) {
+		l.functions = r
+	}
+}
+
+// New creates a new linter.
+func New(opts ...Option) *Linter {
+	l := &Linter{}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// LintSource parses a DSL expression and lints it.
+// Syntax errors are returned as an error rather than as issues.
+func (l *Linter) LintSource(dsl string) ([]Issue, error) {
+	expr, err := parser.Parse(dsl)
+	if err != nil {
+		return nil, err
+	}
+	return l.Lint(expr), nil
+}
+
+// Lint returns the issues found in expr, ordered by position.
+func (l *Linter) Lint(expr ast.Expression) []Issue {
+	var issues []Issue
+	report := func(tok lexer.Token, rule string, severity Severity, format string, args ...interface{}) {
+		issues = append(issues, Issue{
+			Rule:     rule,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+			Line:     tok.Line,
+			Column:   tok.Column,
+		})
+	}
+
+	if isConstant(expr) {
+		report(firstToken(expr), RuleConstantExpression, SeverityWarning,
+			"expression does not depend on the payload")
+	}
+
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		switch n := node.(type) {
+		case *ast.FunctionCall:
+			if l.functions != nil && !eval.IsHigherOrderFunction(n.Name) && !l.functions.Has(n.Name) {
+				report(n.Token, RuleUnknownFunction, SeverityError, "unknown function %s", n.Name)
+			}
+		case *ast.BinaryExpression:
+			l.lintBinary(n, report)
+		case *ast.InExpression:
+			l.lintIn(n, report)
+		case *ast.RegexExpression:
+			if lit, ok := n.Pattern.(*ast.StringLiteral); ok {
+				if _, err := regexp.Compile(lit.Value); err != nil {
+					report(n.Token, RuleInvalidRegex, SeverityError, "invalid regular expression: %v", err)
+				}
+			}
+		}
+		return true
+	})
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Line != issues[j].Line {
+			return issues[i].Line < issues[j].Line
+		}
+		return issues[i].Column < issues[j].Column
+	})
+	return issues
+}
+
+type reportFunc func(tok lexer.Token, rule string, severity Severity, format string, args ...interface{})
+
+func (l *Linter) lintBinary(n *ast.BinaryExpression, report reportFunc) {
+	switch n.Operator {
+	case "&&", "||", "AND", "and", "OR", "or":
+		for _, operand := range []ast.Expression{n.Left, n.Right} {
+			if lit, ok := operand.(*ast.BooleanLiteral); ok {
+				report(n.Token, RuleConstantOperand, SeverityWarning,
+					"operand %t makes %s redundant or constant", lit.Value, n.Operator)
+			}
+		}
+
+	case "==", "!=":
+		for _, operand := range []ast.Expression{n.Left, n.Right} {
+			if lit, ok := operand.(*ast.BooleanLiteral); ok {
+				report(n.Token, RuleBooleanComparison, SeverityWarning,
+					"comparison with %t can be simplified", lit.Value)
+			}
+		}
+		l.lintSelfComparison(n, report)
+
+	case "<", ">", "<=", ">=":
+		if isNull(n.Left) || isNull(n.Right) {
+			report(n.Token, RuleNullOrdering, SeverityError, "null cannot be ordered with %s", n.Operator)
+		}
+		l.lintSelfComparison(n, report)
+	}
+}
+
+func (l *Linter) lintSelfComparison(n *ast.BinaryExpression, report reportFunc) {
+	if format.Node(n.Left) == format.Node(n.Right) {
+		report(n.Token, RuleSelfComparison, SeverityWarning,
+			"both sides of %s are %s", n.Operator, format.Node(n.Left))
+	}
+}
+
+func (l *Linter) lintIn(n *ast.InExpression, report reportFunc) {
+	list, ok := n.Right.(*ast.ListLiteral)
+	if !ok {
+		return
+	}
+	if len(list.Elements) == 0 {
+		if n.Negated {
+			report(n.Token, RuleEmptyList, SeverityWarning, "NOT IN an empty list is always true")
+		} else {
+			report(n.Token, RuleEmptyList, SeverityWarning, "IN an empty list is always false")
+		}
+		return
+	}
+
+	seen := make(map[string]bool, len(list.Elements))
+	for _, el := range list.Elements {
+		if !isLiteral(el) {
+			continue
+		}
+		key := format.Node(el)
+		if seen[key] {
+			report(n.Token, RuleDuplicateElement, SeverityWarning, "list contains %s more than once", key)
+		}
+		seen[key] = true
+	}
+}
+
+// isConstant reports whether expr reads neither the payload nor any variable
+// and calls no functions.
+func isConstant(expr ast.Expression) bool {
+	constant := true
+	ast.Inspect(expr, func(node ast.Expression) bool {
+		switch node.(type) {
+		case *ast.JSONPathExpression, *ast.Identifier, *ast.FunctionCall:
+			constant = false
+		}
+		return constant
+	})
+	return constant
+}
+
+func isLiteral(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.DurationLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		return true
+	}
+	return false
+}
+
+func isNull(expr ast.Expression) bool {
+	_, ok := expr.(*ast.NullLiteral)
+	return ok
+}
+
+// firstToken returns the leftmost token of expr, used to position whole-expression issues.
+func firstToken(expr ast.Expression) lexer.Token {
+	switch n := expr.(type) {
+	case *ast.BinaryExpression:
+		return firstToken(n.Left)
+	case *ast.InExpression:
+		return firstToken(n.Left)
+	case *ast.RegexExpression:
+		return firstToken(n.Left)
+	case *ast.ConditionalExpression:
+		return firstToken(n.Condition)
+	case *ast.CaseExpression:
+		return n.Token
+	case *ast.IntegerLiteral:
+		return n.Token
+	case *ast.FloatLiteral:
+		return n.Token
+	case *ast.DurationLiteral:
+		return n.Token
+	case *ast.StringLiteral:
+		return n.Token
+	case *ast.BooleanLiteral:
+		return n.Token
+	case *ast.NullLiteral:
+		return n.Token
+	case *ast.ListLiteral:
+		return n.Token
+	case *ast.MapLiteral:
+		return n.Token
+	case *ast.UnaryExpression:
+		return n.Token
+	}
+	return lexer.Token{Line: 1, Column: 1}
+}
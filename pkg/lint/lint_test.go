@@ -0,0 +1,65 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rules(issues []Issue) []string {
+	names := make([]string, len(issues))
+	for i, issue := range issues {
+		names[i] = issue.Rule
+	}
+	return names
+}
+
+func TestLinter_LintSource(t *testing.T) {
+	registry := functions.NewRegistry()
+	require.NoError(t, functions.RegisterBuiltIns(registry))
+	l := New(WithFunctions(registry))
+
+	tests := []struct {
+		name string
+		dsl  string
+		want []string
+	}{
+		{"clean", `$.age >= 18 && $.role IN ["admin", "user"]`, []string{}},
+		{"higher-order functions are known", `some($.items, x => x > 3)`, []string{}},
+		{"unknown function", `frobnicate($.x)`, []string{RuleUnknownFunction}},
+		{"constant operand", `$.active && true`, []string{RuleConstantOperand}},
+		{"boolean comparison", `$.active == true`, []string{RuleBooleanComparison}},
+		{"self comparison", `$.a == $.a`, []string{RuleSelfComparison}},
+		{"null ordering", `$.age > null`, []string{RuleNullOrdering}},
+		{"empty list", `$.role IN []`, []string{RuleEmptyList}},
+		{"duplicate element", `$.role IN ["a", "b", "a"]`, []string{RuleDuplicateElement}},
+		{"invalid regex", `$.name =~ "(unclosed"`, []string{RuleInvalidRegex}},
+		{"constant expression", `1 + 2 > 2`, []string{RuleConstantExpression}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues, err := l.LintSource(tt.dsl)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rules(issues))
+		})
+	}
+}
+
+func TestLinter_Positions(t *testing.T) {
+	issues, err := New().LintSource("$.a > 1 &&\n  $.b == false")
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+
+	assert.Equal(t, 2, issues[0].Line)
+	assert.Equal(t, SeverityWarning, issues[0].Severity)
+	assert.Contains(t, issues[0].String(), "2:")
+	assert.Contains(t, issues[0].String(), RuleBooleanComparison)
+}
+
+func TestLinter_SyntaxError(t *testing.T) {
+	_, err := New().LintSource("(5 +")
+	assert.Error(t, err)
+}
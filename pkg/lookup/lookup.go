@@ -0,0 +1,217 @@
+// Package lookup provides lookup tables of reference data for AMEL rules.
+//
+// Tables are exposed to expressions through the lookup function:
+//
+//	lookup("blocked_ips", $.ip)
+//
+// returns the value stored for the key, or null if the table has no entry for
+// it. A Provider supplies the data of a table; providers that cache data, such
+// as CSVProvider, implement Refresher so the data can be reloaded.
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// FunctionName is the name of the lookup function.
+const FunctionName = "lookup"
+
+// Provider supplies the entries of a lookup table. Lookup returns false if
+// the table has no entry for key. Implementations must be safe for concurrent
+// use.
+type Provider interface {
+	Lookup(ctx context.Context, key string) (types.Value, bool, error)
+}
+
+// Refresher is implemented by providers whose data can be reloaded. A refresh
+// that fails must leave the previous data in place.
+type Refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// Tables is a set of named lookup tables.
+type Tables struct {
+	mu     sync.RWMutex
+	tables map[string]Provider
+}
+
+// NewTables creates an empty set of lookup tables.
+func NewTables() *Tables {
+	return &Tables{tables: make(map[string]Provider)}
+}
+
+// Add adds or replaces a table.
+func (t *Tables) Add(name string, p Provider) error {
+	if name == "" {
+		return errors.New(errors.ErrInvalidSyntax, "lookup table name cannot be empty")
+	}
+	if p == nil {
+		return errors.Newf(errors.ErrInvalidSyntax, "lookup table '%s' has no provider", name)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tables[name] = p
+	return nil
+}
+
+// Remove removes a table and reports whether it existed.
+func (t *Tables) Remove(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.tables[name]
+	delete(t.tables, name)
+	return ok
+}
+
+// Get returns the provider of a table.
+func (t *Tables) Get(name string) (Provider, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	p, ok := t.tables[name]
+	return p, ok
+}
+
+// Names returns the names of the tables in sorted order.
+func (t *Tables) Names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.tables))
+	for name := range t.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the value stored for key in a table, or null if there is
+// none.
+func (t *Tables) Lookup(ctx context.Context, table string, key types.Value) (types.Value, error) {
+	p, ok := t.Get(table)
+	if !ok {
+		return types.Null(), errors.Newf(errors.ErrUndefinedVariable, "undefined lookup table '%s'", table)
+	}
+	if key.IsNull() {
+		return types.Null(), nil
+	}
+
+	value, found, err := p.Lookup(ctx, keyString(key))
+	if err != nil {
+		return types.Null(), errors.Wrap(errors.ErrExternalCall,
+			fmt.Sprintf("lookup in table '%s' failed: %v", table, err), err)
+	}
+	if !found {
+		return types.Null(), nil
+	}
+	return value, nil
+}
+
+// Refresh reloads the tables whose provider implements Refresher, or only the
+// named tables if names are given. It refreshes every table even if some fail
+// and returns the first error.
+func (t *Tables) Refresh(ctx context.Context, names ...string) error {
+	if len(names) == 0 {
+		names = t.Names()
+	}
+
+	var first error
+	for _, name := range names {
+		p, ok := t.Get(name)
+		if !ok {
+			if first == nil {
+				first = errors.Newf(errors.ErrUndefinedVariable, "undefined lookup table '%s'", name)
+			}
+			continue
+		}
+		r, ok := p.(Refresher)
+		if !ok {
+			continue
+		}
+		if err := r.Refresh(ctx); err != nil && first == nil {
+			first = fmt.Errorf("refreshing lookup table '%s': %w", name, err)
+		}
+	}
+	return first
+}
+
+// Watch refreshes the tables each time a change notification is received,
+// until ctx is done or changes is closed. Refresh errors are passed to
+// onError, if set, and the previous data stays active.
+//
+// Notifications typically come from a ticker, a file watcher, or a message
+// announcing new reference data.
+func (t *Tables) Watch(ctx context.Context, changes <-chan struct{}, onError func(error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+			if err := t.Refresh(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Register registers the lookup(table, key) function in r, resolving tables
+// in t. An unknown table fails with ErrUndefinedVariable and a provider error
+// with ErrExternalCall.
+func Register(r *functions.Registry, t *Tables) error {
+	sig := types.NewFunctionSignature(FunctionName, types.TypeAny,
+		types.DescribedParam("table", types.TypeString, "The name of the lookup table"),
+		types.DescribedParam("key", types.TypeAny, "The key to look up"),
+	).
+		WithCategory(functions.CategoryUtility).
+		WithDescription("Returns the value stored for key in a lookup table, or null if there is none.").
+		WithExamples(`lookup("blocked_ips", $.ip) == true`, `defaultVal(lookup("country_limits", $.country), 100)`)
+
+	return r.RegisterContextual(FunctionName, func(ctx context.Context, _ functions.EvalContext, args ...types.Value) (types.Value, error) {
+		table, ok := args[0].AsString()
+		if !ok {
+			return types.Null(), errors.Newf(errors.ErrArgumentType, "lookup table name must be a string, got %s", args[0].Type)
+		}
+		return t.Lookup(ctx, table, args[1])
+	}, sig)
+}
+
+// keyString converts a key to the string used by providers. Whole floats are
+// written without a fraction so that 42 and 42.0 find the same entry.
+func keyString(key types.Value) string {
+	switch key.Type {
+	case types.TypeString:
+		s, _ := key.AsString()
+		return s
+	case types.TypeInt:
+		n, _ := key.AsInt()
+		return strconv.FormatInt(n, 10)
+	case types.TypeFloat:
+		f, _ := key.AsFloat()
+		if f == float64(int64(f)) {
+			return strconv.FormatInt(int64(f), 10)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	case types.TypeBool:
+		b, _ := key.AsBool()
+		return strconv.FormatBool(b)
+	case types.TypeDateTime:
+		t, _ := key.AsTime()
+		return t.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(key.Raw)
+	}
+}
@@ -0,0 +1,110 @@
+package lookup
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingProvider fails every lookup and refresh.
+type failingProvider struct{}
+
+func (failingProvider) Lookup(context.Context, string) (types.Value, bool, error) {
+	return types.Null(), false, fmt.Errorf("connection refused")
+}
+
+func (failingProvider) Refresh(context.Context) error {
+	return fmt.Errorf("connection refused")
+}
+
+func TestLookupFunction(t *testing.T) {
+	tables := NewTables()
+	require.NoError(t, tables.Add("blocked_ips", NewSetProvider("10.0.0.1", "10.0.0.2")))
+	require.NoError(t, tables.Add("limits", NewMapProvider(map[string]interface{}{"TR": 500, "42": "answer"})))
+	require.NoError(t, tables.Add("broken", failingProvider{}))
+
+	registry, err := functions.NewDefaultRegistry()
+	require.NoError(t, err)
+	require.NoError(t, Register(registry, tables))
+
+	evaluator, err := eval.New(eval.WithFunctions(registry))
+	require.NoError(t, err)
+
+	ctx, err := eval.NewContext(map[string]interface{}{"ip": "10.0.0.1", "country": "TR", "id": 42})
+	require.NoError(t, err)
+
+	evaluate := func(input string) (types.Value, error) {
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		return evaluator.Evaluate(expr, ctx)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`lookup("blocked_ips", $.ip) == true`, true},
+		{`lookup("blocked_ips", "192.168.1.1") == null`, true},
+		{`lookup("limits", $.country) > 100`, true},
+		{`lookup("limits", $.id)`, "answer"},
+		{`defaultVal(lookup("limits", "US"), 100)`, int64(100)},
+		{`lookup("limits", null) == null`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := evaluate(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.Raw)
+		})
+	}
+
+	_, err = evaluate(`lookup("unknown", $.ip)`)
+	assert.True(t, errors.IsCode(err, errors.ErrUndefinedVariable), err)
+
+	_, err = evaluate(`lookup("broken", $.ip)`)
+	assert.True(t, errors.IsCode(err, errors.ErrExternalCall), err)
+}
+
+func TestTables_Refresh(t *testing.T) {
+	tables := NewTables()
+	require.NoError(t, tables.Add("static", NewSetProvider("a")))
+	require.NoError(t, tables.Add("broken", failingProvider{}))
+
+	assert.NoError(t, tables.Refresh(context.Background(), "static"))
+	assert.Error(t, tables.Refresh(context.Background()))
+	assert.Error(t, tables.Refresh(context.Background(), "missing"))
+
+	assert.Equal(t, []string{"broken", "static"}, tables.Names())
+	assert.True(t, tables.Remove("broken"))
+	assert.NoError(t, tables.Refresh(context.Background()))
+
+	assert.Error(t, tables.Add("", NewSetProvider()))
+	assert.Error(t, tables.Add("nil", nil))
+}
+
+func TestTables_Watch(t *testing.T) {
+	tables := NewTables()
+	require.NoError(t, tables.Add("broken", failingProvider{}))
+
+	changes := make(chan struct{})
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		tables.Watch(context.Background(), changes, func(err error) { errs <- err })
+		close(done)
+	}()
+
+	changes <- struct{}{}
+	assert.Error(t, <-errs)
+	close(changes)
+	<-done
+}
@@ -0,0 +1,371 @@
+// Package lookup provides lookup tables of reference data for AMEL rules.
+package lookup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// ============================================================================
+// Map provider
+// ============================================================================
+
+// MapProvider is an in-memory lookup table.
+type MapProvider struct {
+	mu      sync.RWMutex
+	entries map[string]types.Value
+}
+
+// NewMapProvider creates an in-memory table from a map. Values are converted
+// with types.NewValue.
+func NewMapProvider(entries map[string]interface{}) *MapProvider {
+	p := &MapProvider{}
+	p.Replace(entries)
+	return p
+}
+
+// NewSetProvider creates an in-memory table in which every key maps to true,
+// for membership tests such as lookup("blocked_ips", $.ip).
+func NewSetProvider(keys ...string) *MapProvider {
+	entries := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		entries[key] = true
+	}
+	return NewMapProvider(entries)
+}
+
+// Lookup implements Provider.
+func (p *MapProvider) Lookup(_ context.Context, key string) (types.Value, bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	value, ok := p.entries[key]
+	return value, ok, nil
+}
+
+// Replace atomically replaces the entries of the table.
+func (p *MapProvider) Replace(entries map[string]interface{}) {
+	values := make(map[string]types.Value, len(entries))
+	for key, value := range entries {
+		values[key] = types.NewValue(value)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries = values
+}
+
+// Len returns the number of entries.
+func (p *MapProvider) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.entries)
+}
+
+// ============================================================================
+// CSV provider
+// ============================================================================
+
+// CSVProvider is a lookup table loaded from a CSV file with a header row.
+// Refresh reloads the file.
+type CSVProvider struct {
+	fsys        fs.FS
+	path        string
+	keyColumn   string
+	valueColumn string
+	table       *MapProvider
+}
+
+// NewCSVProvider loads a table from the CSV file at path in fsys. Keys are
+// read from keyColumn. Values are read from valueColumn and converted to
+// integers, floats, or booleans when possible; if valueColumn is empty every
+// key maps to true. Use os.DirFS to read files from disk.
+func NewCSVProvider(fsys fs.FS, path, keyColumn, valueColumn string) (*CSVProvider, error) {
+	p := &CSVProvider{
+		fsys:        fsys,
+		path:        path,
+		keyColumn:   keyColumn,
+		valueColumn: valueColumn,
+		table:       NewMapProvider(nil),
+	}
+	if err := p.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Lookup implements Provider.
+func (p *CSVProvider) Lookup(ctx context.Context, key string) (types.Value, bool, error) {
+	return p.table.Lookup(ctx, key)
+}
+
+// Refresh implements Refresher. The file is read completely before the
+// entries are replaced.
+func (p *CSVProvider) Refresh(_ context.Context) error {
+	f, err := p.fsys.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := readCSV(f, p.keyColumn, p.valueColumn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.path, err)
+	}
+	p.table.Replace(entries)
+	return nil
+}
+
+// readCSV reads the entries of a CSV document with a header row.
+func readCSV(r io.Reader, keyColumn, valueColumn string) (map[string]interface{}, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	keyIndex, valueIndex := -1, -1
+	for i, name := range header {
+		switch name {
+		case keyColumn:
+			keyIndex = i
+		case valueColumn:
+			valueIndex = i
+		}
+	}
+	if keyIndex < 0 {
+		return nil, fmt.Errorf("column %q not found", keyColumn)
+	}
+	if valueColumn != "" && valueIndex < 0 {
+		return nil, fmt.Errorf("column %q not found", valueColumn)
+	}
+
+	entries := make(map[string]interface{})
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if valueIndex < 0 {
+			entries[record[keyIndex]] = true
+			continue
+		}
+		entries[record[keyIndex]] = parseScalar(record[valueIndex])
+	}
+	return entries, nil
+}
+
+// parseScalar converts a CSV field to an integer, float, or boolean if it is
+// one, and returns it unchanged otherwise.
+func parseScalar(s string) interface{} {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b
+	}
+	return s
+}
+
+// ============================================================================
+// SQL provider
+// ============================================================================
+
+// SQLProvider looks up keys with a SQL query on every call. Wrap it in a
+// CachedProvider to reduce database load.
+type SQLProvider struct {
+	db    *sql.DB
+	query string
+}
+
+// NewSQLProvider creates a table backed by a query that takes the key as its
+// only parameter and returns a single column, for example
+//
+//	SELECT credit_limit FROM accounts WHERE id = $1
+//
+// The placeholder syntax depends on the database driver. A query returning no
+// rows means the key has no entry; only the first row is used.
+func NewSQLProvider(db *sql.DB, query string) *SQLProvider {
+	return &SQLProvider{db: db, query: query}
+}
+
+// Lookup implements Provider.
+func (p *SQLProvider) Lookup(ctx context.Context, key string) (types.Value, bool, error) {
+	var value interface{}
+	err := p.db.QueryRowContext(ctx, p.query, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return types.Null(), false, nil
+	}
+	if err != nil {
+		return types.Null(), false, err
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	return types.NewValue(value), true, nil
+}
+
+// ============================================================================
+// Redis provider
+// ============================================================================
+
+// RedisClient is the part of a Redis client a RedisProvider uses. found is
+// false when the key or field does not exist, which go-redis reports as
+// redis.Nil, so the provider does not depend on a particular client:
+//
+//	type goRedis struct{ client *redis.Client }
+//
+//	func (r goRedis) Get(ctx context.Context, key string) (string, bool, error) {
+//		return found(r.client.Get(ctx, key).Result())
+//	}
+//
+//	func (r goRedis) HGet(ctx context.Context, key, field string) (string, bool, error) {
+//		return found(r.client.HGet(ctx, key, field).Result())
+//	}
+//
+//	func found(value string, err error) (string, bool, error) {
+//		if err == redis.Nil {
+//			return "", false, nil
+//		}
+//		return value, err == nil, err
+//	}
+type RedisClient interface {
+	Get(ctx context.Context, key string) (value string, found bool, err error)
+	HGet(ctx context.Context, key, field string) (value string, found bool, err error)
+}
+
+// RedisProvider looks up keys in Redis on every call, either as string keys
+// or as the fields of a hash. Values are converted to integers, floats, or
+// booleans when possible, like those of a CSVProvider. Wrap it in a
+// CachedProvider to reduce round trips.
+type RedisProvider struct {
+	client RedisClient
+	prefix string // Prepended to keys read with GET
+	hash   string // Hash whose fields are read with HGET, if set
+}
+
+// NewRedisProvider creates a table reading each key with GET, prefixed with
+// prefix, such as "blocked_ips:".
+func NewRedisProvider(client RedisClient, prefix string) *RedisProvider {
+	return &RedisProvider{client: client, prefix: prefix}
+}
+
+// NewRedisHashProvider creates a table reading each key as a field of the
+// hash with HGET.
+func NewRedisHashProvider(client RedisClient, hash string) *RedisProvider {
+	return &RedisProvider{client: client, hash: hash}
+}
+
+// Lookup implements Provider.
+func (p *RedisProvider) Lookup(ctx context.Context, key string) (types.Value, bool, error) {
+	var value string
+	var found bool
+	var err error
+	if p.hash != "" {
+		value, found, err = p.client.HGet(ctx, p.hash, key)
+	} else {
+		value, found, err = p.client.Get(ctx, p.prefix+key)
+	}
+	if err != nil || !found {
+		return types.Null(), false, err
+	}
+	return types.NewValue(parseScalar(value)), true, nil
+}
+
+// ============================================================================
+// Cached provider
+// ============================================================================
+
+// CachedProvider caches the results of a remote provider, such as a
+// SQLProvider or a RedisProvider, for a fixed time. Keys without an
+// entry are cached too. Errors are not cached.
+type CachedProvider struct {
+	provider   Provider
+	ttl        time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	cache map[string]cachedEntry
+}
+
+type cachedEntry struct {
+	value   types.Value
+	found   bool
+	expires time.Time
+}
+
+// NewCachedProvider caches the results of p for ttl. At most maxEntries keys
+// are cached; zero or less means 10000.
+func NewCachedProvider(p Provider, ttl time.Duration, maxEntries int) *CachedProvider {
+	if maxEntries <= 0 {
+		maxEntries = 10000
+	}
+	return &CachedProvider{
+		provider:   p,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		cache:      make(map[string]cachedEntry),
+	}
+}
+
+// Lookup implements Provider.
+func (p *CachedProvider) Lookup(ctx context.Context, key string) (types.Value, bool, error) {
+	now := time.Now()
+
+	p.mu.Lock()
+	entry, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.value, entry.found, nil
+	}
+
+	value, found, err := p.provider.Lookup(ctx, key)
+	if err != nil {
+		return types.Null(), false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.cache) >= p.maxEntries {
+		for k, e := range p.cache {
+			if now.After(e.expires) {
+				delete(p.cache, k)
+			}
+		}
+		if len(p.cache) >= p.maxEntries {
+			p.cache = make(map[string]cachedEntry)
+		}
+	}
+	p.cache[key] = cachedEntry{value: value, found: found, expires: now.Add(p.ttl)}
+	return value, found, nil
+}
+
+// Refresh implements Refresher. It refreshes the underlying provider if it is
+// a Refresher and then clears the cache.
+func (p *CachedProvider) Refresh(ctx context.Context) error {
+	if r, ok := p.provider.(Refresher); ok {
+		if err := r.Refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cache = make(map[string]cachedEntry)
+	return nil
+}
@@ -0,0 +1,206 @@
+package lookup
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVProvider(t *testing.T) {
+	fsys := fstest.MapFS{
+		"limits.csv": {Data: []byte("country,limit,name\nTR,500,Turkey\nDE,1.5,Germany\nUS,true,United States\n")},
+	}
+
+	p, err := NewCSVProvider(fsys, "limits.csv", "country", "limit")
+	require.NoError(t, err)
+
+	tests := []struct {
+		key      string
+		expected types.Value
+	}{
+		{"TR", types.Int(500)},
+		{"DE", types.Float(1.5)},
+		{"US", types.Bool(true)},
+	}
+	for _, tt := range tests {
+		value, found, err := p.Lookup(context.Background(), tt.key)
+		require.NoError(t, err)
+		assert.True(t, found, tt.key)
+		assert.Equal(t, tt.expected, value, tt.key)
+	}
+
+	names, err := NewCSVProvider(fsys, "limits.csv", "name", "")
+	require.NoError(t, err)
+	value, found, _ := names.Lookup(context.Background(), "Turkey")
+	assert.True(t, found)
+	assert.Equal(t, types.Bool(true), value)
+
+	t.Run("refresh", func(t *testing.T) {
+		fsys["limits.csv"] = &fstest.MapFile{Data: []byte("country,limit\nFR,300\n")}
+		require.NoError(t, p.Refresh(context.Background()))
+		_, found, _ := p.Lookup(context.Background(), "TR")
+		assert.False(t, found)
+
+		// A failed refresh keeps the previous data
+		fsys["limits.csv"] = &fstest.MapFile{Data: []byte("code,limit\nFR,300\n")}
+		require.Error(t, p.Refresh(context.Background()))
+		_, found, _ = p.Lookup(context.Background(), "FR")
+		assert.True(t, found)
+	})
+
+	_, err = NewCSVProvider(fsys, "missing.csv", "country", "limit")
+	assert.Error(t, err)
+}
+
+// countingProvider counts lookups.
+type countingProvider struct {
+	calls atomic.Int32
+}
+
+func (p *countingProvider) Lookup(_ context.Context, key string) (types.Value, bool, error) {
+	p.calls.Add(1)
+	return types.String(key), key != "missing", nil
+}
+
+func TestCachedProvider(t *testing.T) {
+	inner := &countingProvider{}
+	p := NewCachedProvider(inner, time.Minute, 0)
+
+	for i := 0; i < 3; i++ {
+		value, found, err := p.Lookup(context.Background(), "a")
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, types.String("a"), value)
+
+		_, found, err = p.Lookup(context.Background(), "missing")
+		require.NoError(t, err)
+		assert.False(t, found)
+	}
+	assert.Equal(t, int32(2), inner.calls.Load())
+
+	require.NoError(t, p.Refresh(context.Background()))
+	_, _, _ = p.Lookup(context.Background(), "a")
+	assert.Equal(t, int32(3), inner.calls.Load())
+}
+
+func TestSQLProvider(t *testing.T) {
+	db := sql.OpenDB(fakeConnector{rows: map[string]driver.Value{"u1": int64(1000), "u2": []byte("gold")}})
+	defer db.Close()
+
+	p := NewSQLProvider(db, "SELECT credit_limit FROM accounts WHERE id = ?")
+
+	value, found, err := p.Lookup(context.Background(), "u1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, types.Int(1000), value)
+
+	value, found, err = p.Lookup(context.Background(), "u2")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, types.String("gold"), value)
+
+	_, found, err = p.Lookup(context.Background(), "u3")
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestRedisProvider(t *testing.T) {
+	client := &fakeRedis{
+		strings: map[string]string{"blocked_ips:10.0.0.1": "1", "limits:TR": "500"},
+		hashes:  map[string]map[string]string{"tiers": {"u1": "gold", "u2": "2.5"}},
+	}
+	ctx := context.Background()
+
+	p := NewRedisProvider(client, "blocked_ips:")
+	value, found, err := p.Lookup(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, types.Int(1), value)
+	_, found, err = p.Lookup(ctx, "10.0.0.2")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	p = NewRedisHashProvider(client, "tiers")
+	value, found, err = p.Lookup(ctx, "u1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, types.String("gold"), value)
+	value, _, err = p.Lookup(ctx, "u2")
+	require.NoError(t, err)
+	assert.Equal(t, types.Float(2.5), value)
+	_, found, err = p.Lookup(ctx, "u3")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	client.err = io.ErrUnexpectedEOF
+	_, found, err = p.Lookup(ctx, "u1")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.False(t, found)
+}
+
+// fakeRedis is a RedisClient serving fixed strings and hashes.
+type fakeRedis struct {
+	strings map[string]string
+	hashes  map[string]map[string]string
+	err     error
+}
+
+func (r *fakeRedis) Get(_ context.Context, key string) (string, bool, error) {
+	value, ok := r.strings[key]
+	return value, ok, r.err
+}
+
+func (r *fakeRedis) HGet(_ context.Context, key, field string) (string, bool, error) {
+	value, ok := r.hashes[key][field]
+	return value, ok, r.err
+}
+
+// fakeConnector is a database/sql driver answering every query with the row
+// stored for its only argument.
+type fakeConnector struct {
+	rows map[string]driver.Value
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn fakeConnector
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt(c), nil }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+type fakeStmt fakeConn
+
+func (s fakeStmt) Close() error                               { return nil }
+func (s fakeStmt) NumInput() int                              { return 1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	value, ok := s.rows[args[0].(string)]
+	return &fakeRows{value: value, done: !ok}, nil
+}
+
+type fakeRows struct {
+	value driver.Value
+	done  bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	dest[0] = r.value
+	r.done = true
+	return nil
+}
@@ -0,0 +1,80 @@
+// Package lsp implements a Language Server Protocol server for AMEL expressions.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// conn reads and writes JSON-RPC messages framed with Content-Length headers.
+type conn struct {
+	r  *bufio.Reader
+	mu sync.Mutex // Serializes writes
+	w  io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: bufio.NewReader(r), w: w}
+}
+
+// read returns the next message body. It returns io.EOF when the stream ends.
+func (c *conn) read() ([]byte, error) {
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// reply sends the response to a request. A nil result is sent as JSON null.
+func (c *conn) reply(id *json.RawMessage, result interface{}, rerr *responseError) error {
+	resp := &response{JSONRPC: "2.0", ID: id, Error: rerr}
+	if rerr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		raw := json.RawMessage(data)
+		resp.Result = &raw
+	}
+	return c.write(resp)
+}
+
+// notify sends a notification.
+func (c *conn) notify(method string, params interface{}) error {
+	return c.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// write sends a framed message.
+func (c *conn) write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
@@ -0,0 +1,171 @@
+// Package lsp implements a Language Server Protocol server for AMEL expressions.
+package lsp
+
+import "encoding/json"
+
+// This file declares the subset of the Language Server Protocol used by the server.
+// See https://microsoft.github.io/language-server-protocol/ for the full specification.
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// request is an incoming JSON-RPC 2.0 request, or a notification if ID is nil.
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// response is an outgoing JSON-RPC 2.0 response. Exactly one of Result and
+// Error is set.
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  *json.RawMessage `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+// notification is an outgoing JSON-RPC 2.0 notification.
+type notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// responseError is a JSON-RPC error object.
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Position is a zero-based line and character offset in a document.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span in a document. End is exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// DiagnosticSeverity mirrors the LSP severity levels.
+type DiagnosticSeverity int
+
+const (
+	SeverityError       DiagnosticSeverity = 1
+	SeverityWarning     DiagnosticSeverity = 2
+	SeverityInformation DiagnosticSeverity = 3
+	SeverityHint        DiagnosticSeverity = 4
+)
+
+// Diagnostic is a problem reported for a document.
+type Diagnostic struct {
+	Range    Range              `json:"range"`
+	Severity DiagnosticSeverity `json:"severity"`
+	Code     string             `json:"code,omitempty"`
+	Source   string             `json:"source"`
+	Message  string             `json:"message"`
+}
+
+// MarkupContent is formatted documentation text.
+type MarkupContent struct {
+	Kind  string `json:"kind"` // "plaintext" or "markdown"
+	Value string `json:"value"`
+}
+
+// Hover is the result of a hover request.
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// CompletionItemKind mirrors the LSP completion item kinds used by the server.
+type CompletionItemKind int
+
+const (
+	CompletionKindFunction CompletionItemKind = 3
+	CompletionKindKeyword  CompletionItemKind = 14
+)
+
+// CompletionItem is a single completion proposal.
+type CompletionItem struct {
+	Label         string             `json:"label"`
+	Kind          CompletionItemKind `json:"kind"`
+	Detail        string             `json:"detail,omitempty"`
+	Documentation *MarkupContent     `json:"documentation,omitempty"`
+}
+
+// TextEdit replaces a range of a document with new text.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type didOpenParams struct {
+	TextDocument textDocumentItem `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"` // Full document sync only
+	} `json:"contentChanges"`
+}
+
+type didCloseParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type documentFormattingParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type initializeResult struct {
+	Capabilities serverCapabilities `json:"capabilities"`
+	ServerInfo   serverInfo         `json:"serverInfo"`
+}
+
+type serverInfo struct {
+	Name string `json:"name"`
+}
+
+type serverCapabilities struct {
+	TextDocumentSync           int                `json:"textDocumentSync"` // 1 = full
+	HoverProvider              bool               `json:"hoverProvider"`
+	CompletionProvider         *completionOptions `json:"completionProvider,omitempty"`
+	DocumentFormattingProvider bool               `json:"documentFormattingProvider"`
+}
+
+type completionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+}
@@ -0,0 +1,479 @@
+// Package lsp implements a Language Server Protocol server for AMEL expressions.
+//
+// The server supports full document synchronization, diagnostics from the parser
+// and linter, hover documentation for functions and operators, completion of
+// functions and keywords, and document formatting. Each document holds a single
+// AMEL expression.
+//
+// Serve speaks the protocol over a reader and writer pair, typically standard
+// input and output. The analysis methods (Diagnose, Hover, Complete, Format) can
+// also be used directly, e.g. by a web editor integration.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/format"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/lint"
+	"github.com/bencagri/amel/pkg/parser"
+)
+
+const diagnosticSource = "amel"
+
+// Server is an AMEL language server.
+type Server struct {
+	functions *functions.Registry
+	linter    *lint.Linter
+
+	mu        sync.Mutex
+	documents map[string]string
+
+	conn     *conn
+	shutdown bool
+}
+
+// NewServer creates a language server that resolves functions from the engine's registry.
+func NewServer(eng *engine.Engine) *Server {
+	registry := eng.GetFunctionRegistry()
+	return &Server{
+		functions: registry,
+		linter:    lint.New(lint.WithFunctions(registry)),
+		documents: make(map[string]string),
+	}
+}
+
+// Serve handles protocol messages from r and writes responses to w until the
+// client sends "exit", the input ends, or ctx is done.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.conn = newConn(r, w)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		body, err := s.conn.read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.conn.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.dispatch(&req)
+		if req.ID == nil {
+			continue // Notifications have no response
+		}
+		if err := s.conn.reply(req.ID, result, rerr); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch runs the handler for a request and recovers from handler panics so a
+// single malformed document cannot take down the server.
+func (s *Server) dispatch(req *request) (result interface{}, rerr *responseError) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, rerr = nil, &responseError{Code: codeInternalError, Message: fmt.Sprint(r)}
+		}
+	}()
+
+	if s.shutdown && req.Method != "exit" {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		return &initializeResult{
+			Capabilities: serverCapabilities{
+				TextDocumentSync:           1,
+				HoverProvider:              true,
+				CompletionProvider:         &completionOptions{TriggerCharacters: []string{"."}},
+				DocumentFormattingProvider: true,
+			},
+			ServerInfo: serverInfo{Name: "amel"},
+		}, nil
+
+	case "initialized":
+		return nil, nil
+
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params didCloseParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.mu.Lock()
+		delete(s.documents, params.TextDocument.URI)
+		s.mu.Unlock()
+		// Clear the diagnostics of the closed document
+		_ = s.conn.notify("textDocument/publishDiagnostics",
+			&publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		return nil, nil
+
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		hover := s.Hover(s.document(params.TextDocument.URI), params.Position)
+		if hover == nil {
+			return nil, nil
+		}
+		return hover, nil
+
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		return s.Complete(s.document(params.TextDocument.URI), params.Position), nil
+
+	case "textDocument/formatting":
+		var params documentFormattingParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, invalidParams(err)
+		}
+		edits, err := s.Format(s.document(params.TextDocument.URI))
+		if err != nil {
+			// Documents with syntax errors are left unchanged
+			return []TextEdit{}, nil
+		}
+		return edits, nil
+
+	default:
+		if req.ID == nil || strings.HasPrefix(req.Method, "$/") {
+			return nil, nil // Unknown notifications are ignored
+		}
+		return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+func invalidParams(err error) *responseError {
+	return &responseError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// update stores the document text and publishes its diagnostics.
+func (s *Server) update(uri, text string) {
+	s.mu.Lock()
+	s.documents[uri] = text
+	s.mu.Unlock()
+
+	_ = s.conn.notify("textDocument/publishDiagnostics",
+		&publishDiagnosticsParams{URI: uri, Diagnostics: s.Diagnose(text)})
+}
+
+func (s *Server) document(uri string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.documents[uri]
+}
+
+// ============================================================================
+// Analysis
+// ============================================================================
+
+// Diagnose returns the syntax errors of an expression or, if it parses, the
+// issues reported by the linter.
+func (s *Server) Diagnose(text string) []Diagnostic {
+	diagnostics := []Diagnostic{}
+	if strings.TrimSpace(text) == "" {
+		return diagnostics
+	}
+
+	p := parser.New(text)
+	expr, _ := p.Parse()
+	if errs := p.Errors(); len(errs) > 0 {
+		for _, err := range errs {
+			diagnostics = append(diagnostics, syntaxDiagnostic(text, err))
+		}
+		return diagnostics
+	}
+
+	for _, issue := range s.linter.Lint(expr) {
+		severity := SeverityWarning
+		if issue.Severity == lint.SeverityError {
+			severity = SeverityError
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    wordRange(text, issue.Line, issue.Column),
+			Severity: severity,
+			Code:     issue.Rule,
+			Source:   diagnosticSource,
+			Message:  issue.Message,
+		})
+	}
+	return diagnostics
+}
+
+// syntaxDiagnostic converts a parser or lexer error to a diagnostic.
+func syntaxDiagnostic(text string, err error) Diagnostic {
+	d := Diagnostic{
+		Severity: SeverityError,
+		Source:   diagnosticSource,
+		Message:  err.Error(),
+	}
+	line, column := 1, 1
+	if amelErr, ok := err.(*errors.Error); ok {
+		d.Message = amelErr.Message
+		d.Code = amelErr.Code.String()
+		if amelErr.Line > 0 {
+			line, column = amelErr.Line, amelErr.Column
+		}
+	}
+	d.Range = wordRange(text, line, column)
+	return d
+}
+
+// Hover returns documentation for the function, keyword, or payload path at pos,
+// or nil if there is nothing to describe.
+func (s *Server) Hover(text string, pos Position) *Hover {
+	start, end := wordAt(text, pos)
+	if start == end {
+		return nil
+	}
+	word := text[start:end]
+	r := &Range{Start: positionAt(text, start), End: positionAt(text, end)}
+
+	var doc string
+	switch {
+	case start > 0 && (text[start-1] == '$' || text[start-1] == '.') && strings.Contains(text[:start], "$"):
+		doc = fmt.Sprintf("Payload field `%s`", word)
+	case eval.IsHigherOrderFunction(word):
+		doc = fmt.Sprintf("```amel\n%s(list, x => ...)\n```\nHigher-order function taking a lambda.", word)
+	case s.functions.Has(word):
+		doc = s.functionDoc(word)
+	default:
+		if kw, ok := keywordDocs[word]; ok {
+			doc = kw
+		} else if kw, ok := keywordDocs[strings.ToUpper(word)]; ok {
+			doc = kw
+		}
+	}
+	if doc == "" {
+		return nil
+	}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: doc}, Range: r}
+}
+
+// functionDoc renders the documentation of a function as markdown: its
+// signatures, description, parameters, and examples.
+func (s *Server) functionDoc(name string) string {
+	doc, ok := s.functions.Describe(name)
+	if !ok {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("```amel\n")
+	for _, overload := range doc.Overloads {
+		sb.WriteString(overload.Signature)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("```")
+	if doc.Description != "" {
+		sb.WriteString("\n\n")
+		sb.WriteString(doc.Description)
+	}
+	for _, overload := range doc.Overloads {
+		for _, p := range overload.Parameters {
+			if p.Description != "" {
+				fmt.Fprintf(&sb, "\n\n`%s` — %s", p.Name, p.Description)
+			}
+		}
+	}
+	if len(doc.Examples) > 0 {
+		sb.WriteString("\n\n**Examples**\n```amel\n")
+		sb.WriteString(strings.Join(doc.Examples, "\n"))
+		sb.WriteString("\n```")
+	}
+	return sb.String()
+}
+
+// Complete returns completion proposals for the word being typed at pos.
+func (s *Server) Complete(text string, pos Position) []CompletionItem {
+	start, _ := wordAt(text, pos)
+	prefix := text[start:offsetAt(text, pos)]
+
+	// Field names after '$.' are not known without a payload schema
+	if start > 0 && (text[start-1] == '.' || text[start-1] == '$') {
+		return []CompletionItem{}
+	}
+
+	items := []CompletionItem{}
+	names := s.functions.List()
+	for _, name := range eval.HigherOrderFunctions() {
+		if !s.functions.Has(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		item := CompletionItem{Label: name, Kind: CompletionKindFunction}
+		if doc, ok := s.functions.Describe(name); ok {
+			item.Detail = doc.Overloads[0].Signature
+			if doc.Description != "" {
+				item.Documentation = &MarkupContent{Kind: "markdown", Value: doc.Description}
+			}
+		} else {
+			item.Detail = name + "(list, x => ...)"
+		}
+		items = append(items, item)
+	}
+
+	keywords := make([]string, 0, len(keywordDocs))
+	for kw := range keywordDocs {
+		keywords = append(keywords, kw)
+	}
+	sort.Strings(keywords)
+	for _, kw := range keywords {
+		if strings.HasPrefix(strings.ToUpper(kw), strings.ToUpper(prefix)) {
+			items = append(items, CompletionItem{
+				Label:         kw,
+				Kind:          CompletionKindKeyword,
+				Documentation: &MarkupContent{Kind: "markdown", Value: keywordDocs[kw]},
+			})
+		}
+	}
+	return items
+}
+
+// Format returns the edits that rewrite the document in canonical form.
+func (s *Server) Format(text string) ([]TextEdit, error) {
+	formatted, err := format.Source(text)
+	if err != nil {
+		return nil, err
+	}
+	if formatted == strings.TrimRight(text, "\n") {
+		return []TextEdit{}, nil
+	}
+	if strings.HasSuffix(text, "\n") {
+		formatted += "\n"
+	}
+	return []TextEdit{{
+		Range:   Range{Start: Position{}, End: positionAt(text, len(text))},
+		NewText: formatted,
+	}}, nil
+}
+
+// keywordDocs documents the keywords and literals offered in completion and hover.
+var keywordDocs = map[string]string{
+	"true":   "Boolean literal `true`.",
+	"false":  "Boolean literal `false`.",
+	"null":   "The null literal. Missing payload fields evaluate to null.",
+	"AND":    "Logical AND, same as `&&`. Short-circuits.",
+	"OR":     "Logical OR, same as `||`. Short-circuits.",
+	"NOT":    "Logical negation, same as `!`.",
+	"IN":     "Membership test: `$.role IN [\"admin\", \"owner\"]`. Use `NOT IN` to negate.",
+	"NOT IN": "Negated membership test: `$.country NOT IN [\"US\", \"CA\"]`.",
+}
+
+// ============================================================================
+// Positions
+// ============================================================================
+
+// offsetAt converts a zero-based position to a byte offset in text, clamped to
+// the text. Characters are counted in runes.
+func offsetAt(text string, pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+	for char := 0; char < pos.Character && offset < len(text) && text[offset] != '\n'; char++ {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// positionAt converts a byte offset in text to a zero-based position.
+func positionAt(text string, offset int) Position {
+	before := text[:offset]
+	line := strings.Count(before, "\n")
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return Position{Line: line, Character: utf8.RuneCountInString(before[lineStart:])}
+}
+
+// wordAt returns the byte range of the identifier touching pos.
+func wordAt(text string, pos Position) (int, int) {
+	offset := offsetAt(text, pos)
+	start, end := offset, offset
+	for start > 0 && isWordByte(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWordByte(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+// wordRange returns the range of the word at a one-based line and column, or a
+// single character if there is no word there.
+func wordRange(text string, line, column int) Range {
+	pos := Position{Line: line - 1, Character: column - 1}
+	offset := offsetAt(text, pos)
+	start, end := wordAt(text, pos)
+	if start == end || start != offset {
+		start, end = offset, offset
+		if end < len(text) {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size
+		}
+	}
+	return Range{Start: positionAt(text, start), End: positionAt(text, end)}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
@@ -0,0 +1,201 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return NewServer(eng)
+}
+
+func TestServer_Diagnose(t *testing.T) {
+	s := newTestServer(t)
+
+	assert.Empty(t, s.Diagnose(`$.age >= 18`))
+	assert.Empty(t, s.Diagnose("  "))
+
+	t.Run("syntax error", func(t *testing.T) {
+		diags := s.Diagnose("$.age >= ")
+		require.NotEmpty(t, diags)
+		assert.Equal(t, SeverityError, diags[0].Severity)
+		assert.Equal(t, "amel", diags[0].Source)
+	})
+
+	t.Run("lint issues", func(t *testing.T) {
+		diags := s.Diagnose("$.a > 1 &&\n  nope($.b)")
+		require.Len(t, diags, 1)
+		assert.Equal(t, "unknown-function", diags[0].Code)
+		assert.Equal(t, SeverityError, diags[0].Severity)
+		assert.Equal(t, Range{Start: Position{1, 2}, End: Position{1, 6}}, diags[0].Range)
+	})
+}
+
+func TestServer_Hover(t *testing.T) {
+	s := newTestServer(t)
+	text := `max($.a, 2) > 1 AND $.b IN [1]`
+
+	hover := s.Hover(text, Position{0, 1})
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.Value, "max(values: any...): any")
+	assert.Contains(t, hover.Contents.Value, "Returns the largest value")
+	assert.Contains(t, hover.Contents.Value, "**Examples**")
+	assert.Equal(t, Range{Start: Position{0, 0}, End: Position{0, 3}}, *hover.Range)
+
+	hover = s.Hover(text, Position{0, 6})
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.Value, "Payload field `a`")
+
+	hover = s.Hover(text, Position{0, 17})
+	require.NotNil(t, hover)
+	assert.Contains(t, hover.Contents.Value, "Logical AND")
+
+	assert.Nil(t, s.Hover(text, Position{0, 12}))
+}
+
+func TestServer_Complete(t *testing.T) {
+	s := newTestServer(t)
+
+	items := s.Complete("$.a > ma", Position{0, 8})
+	labels := make([]string, len(items))
+	for i, item := range items {
+		labels[i] = item.Label
+	}
+	assert.Contains(t, labels, "max")
+	assert.Contains(t, labels, "map")
+	require.NotNil(t, items[slices.Index(labels, "max")].Documentation)
+	assert.Contains(t, items[slices.Index(labels, "max")].Documentation.Value, "largest value")
+	assert.NotContains(t, labels, "min")
+
+	assert.Empty(t, s.Complete("$.ma", Position{0, 4}), "payload fields are not completed")
+
+	items = s.Complete("n", Position{0, 1})
+	var found bool
+	for _, item := range items {
+		if item.Label == "null" {
+			found = true
+			assert.Equal(t, CompletionKindKeyword, item.Kind)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestServer_Format(t *testing.T) {
+	s := newTestServer(t)
+
+	edits, err := s.Format("$.a>1 AND $.b\n")
+	require.NoError(t, err)
+	require.Len(t, edits, 1)
+	assert.Equal(t, "$.a > 1 && $.b\n", edits[0].NewText)
+	assert.Equal(t, Position{1, 0}, edits[0].Range.End)
+
+	edits, err = s.Format("$.a > 1")
+	require.NoError(t, err)
+	assert.Empty(t, edits)
+
+	_, err = s.Format("(1 +")
+	assert.Error(t, err)
+}
+
+// frame encodes messages with Content-Length headers.
+func frame(t *testing.T, msgs ...interface{}) io.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		body, err := json.Marshal(msg)
+		require.NoError(t, err)
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	}
+	return &buf
+}
+
+// readAll decodes the framed messages written by the server.
+func readAll(t *testing.T, r io.Reader) []map[string]interface{} {
+	t.Helper()
+
+	c := newConn(r, io.Discard)
+	var msgs []map[string]interface{}
+	for {
+		body, err := c.read()
+		if err == io.EOF {
+			return msgs
+		}
+		require.NoError(t, err)
+		var msg map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &msg))
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestServer_Serve(t *testing.T) {
+	s := newTestServer(t)
+	uri := "file:///rules/adult.amel"
+
+	in := frame(t,
+		map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": map[string]interface{}{}},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "initialized", "params": map[string]interface{}{}},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "languageId": "amel", "version": 1, "text": "$.age >="},
+		}},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/didChange", "params": map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri},
+			"contentChanges": []map[string]interface{}{{"text": "$.age>=18"}},
+		}},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 2, "method": "textDocument/formatting", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+		}},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 3, "method": "textDocument/hover", "params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri}, "position": map[string]interface{}{"line": 0, "character": 7},
+		}},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 4, "method": "workspace/unknown"},
+		map[string]interface{}{"jsonrpc": "2.0", "id": 5, "method": "shutdown"},
+		map[string]interface{}{"jsonrpc": "2.0", "method": "exit"},
+	)
+
+	var out bytes.Buffer
+	require.NoError(t, s.Serve(context.Background(), in, &out))
+
+	msgs := readAll(t, strings.NewReader(out.String()))
+	require.Len(t, msgs, 7)
+
+	// initialize
+	caps := msgs[0]["result"].(map[string]interface{})["capabilities"].(map[string]interface{})
+	assert.Equal(t, true, caps["hoverProvider"])
+	assert.Equal(t, true, caps["documentFormattingProvider"])
+
+	// didOpen publishes a syntax error, didChange clears it
+	assert.Equal(t, "textDocument/publishDiagnostics", msgs[1]["method"])
+	assert.NotEmpty(t, msgs[1]["params"].(map[string]interface{})["diagnostics"])
+	assert.Empty(t, msgs[2]["params"].(map[string]interface{})["diagnostics"])
+
+	// formatting
+	edits := msgs[3]["result"].([]interface{})
+	require.Len(t, edits, 1)
+	assert.Equal(t, "$.age >= 18", edits[0].(map[string]interface{})["newText"])
+
+	// hover over a number has no result, but the response carries a null result
+	assert.Contains(t, msgs[4], "result")
+	assert.Nil(t, msgs[4]["result"])
+
+	// unknown method
+	assert.EqualValues(t, codeMethodNotFound, msgs[5]["error"].(map[string]interface{})["code"])
+
+	// shutdown
+	assert.EqualValues(t, 5, msgs[6]["id"])
+	assert.NotContains(t, msgs[6], "error")
+}
@@ -2,6 +2,8 @@
 package optimizer
 
 import (
+	"math"
+
 	"github.com/bencagri/amel/pkg/ast"
 	"github.com/bencagri/amel/pkg/lexer"
 	"github.com/bencagri/amel/pkg/types"
@@ -10,6 +12,9 @@ import (
 // Optimizer performs various optimizations on the AST.
 type Optimizer struct {
 	foldConstants bool
+	coerce        bool
+	strict        bool
+	decimal       bool
 }
 
 // Option is a function that configures the optimizer.
@@ -22,6 +27,32 @@ func WithConstantFolding(enabled bool) Option {
 	}
 }
 
+// WithTypeCoercion folds comparisons of constants the way an evaluator with
+// eval.WithTypeCoercion evaluates them, converting strings compared with
+// numbers and booleans.
+func WithTypeCoercion(enabled bool) Option {
+	return func(o *Optimizer) {
+		o.coerce = enabled
+	}
+}
+
+// WithStrictTypes folds only the operations that an evaluator with
+// eval.WithStrictTypes allows, leaving comparisons of constants of different
+// types and arithmetic mixing int and float to fail when evaluated.
+func WithStrictTypes(enabled bool) Option {
+	return func(o *Optimizer) {
+		o.strict = enabled
+	}
+}
+
+// WithDecimalArithmetic leaves arithmetic on float constants, and division,
+// to an evaluator with eval.WithDecimalArithmetic, which computes it exactly.
+func WithDecimalArithmetic(enabled bool) Option {
+	return func(o *Optimizer) {
+		o.decimal = enabled
+	}
+}
+
 // New creates a new Optimizer with the given options.
 func New(opts ...Option) *Optimizer {
 	o := &Optimizer{
@@ -55,6 +86,9 @@ func (o *Optimizer) foldConstant(expr ast.Expression) ast.Expression {
 	case *ast.ListLiteral:
 		return o.foldListLiteral(e)
 
+	case *ast.MapLiteral:
+		return o.foldMapLiteral(e)
+
 	case *ast.GroupedExpression:
 		return o.foldGroupedExpression(e)
 
@@ -64,9 +98,24 @@ func (o *Optimizer) foldConstant(expr ast.Expression) ast.Expression {
 	case *ast.IndexExpression:
 		return o.foldIndexExpression(e)
 
+	case *ast.SliceExpression:
+		return &ast.SliceExpression{
+			Token: e.Token,
+			Left:  o.foldConstant(e.Left),
+			Start: o.foldConstant(e.Start),
+			End:   o.foldConstant(e.End),
+		}
+
 	case *ast.InExpression:
 		return o.foldInExpression(e)
 
+	case *ast.ConditionalExpression:
+		return o.foldConditionalExpression(e)
+
+	case *ast.CaseExpression:
+		folded, _ := foldCaseExpression(e, o.foldConstant)
+		return folded
+
 	default:
 		// Literals, identifiers, and JSONPath expressions cannot be folded
 		return expr
@@ -94,7 +143,8 @@ func (o *Optimizer) foldBinaryExpression(expr *ast.BinaryExpression) ast.Express
 	}
 
 	// Try to evaluate the operation
-	result := evaluateBinaryOp(expr.Operator, leftLit, rightLit)
+	leftLit, rightLit = o.coerceLiterals(expr.Operator, leftLit, rightLit)
+	result := o.evaluateBinaryOp(expr.Operator, leftLit, rightLit)
 	if result == nil {
 		// Can't fold this operation
 		return &ast.BinaryExpression{
@@ -133,6 +183,62 @@ func (o *Optimizer) foldUnaryExpression(expr *ast.UnaryExpression) ast.Expressio
 	return valueToLiteral(result, expr.Token)
 }
 
+// foldConditionalExpression replaces a conditional whose condition is a
+// constant bool with the branch it selects. Other constant conditions are
+// left for the evaluator, whose truthiness rules may be configured.
+func (o *Optimizer) foldConditionalExpression(expr *ast.ConditionalExpression) ast.Expression {
+	condition := o.foldConstant(expr.Condition)
+	if b, ok := getLiteralValue(condition).(bool); ok {
+		if b {
+			return o.foldConstant(expr.Consequence)
+		}
+		return o.foldConstant(expr.Alternative)
+	}
+
+	return &ast.ConditionalExpression{
+		Token:       expr.Token,
+		Condition:   condition,
+		Consequence: o.foldConstant(expr.Consequence),
+		Alternative: o.foldConstant(expr.Alternative),
+	}
+}
+
+// foldCaseExpression optimizes the parts of a case expression with optimize,
+// then drops the arms whose condition is the constant false and the arms
+// after one whose condition is the constant true, which becomes the else arm.
+// A case left without arms is replaced by its else arm, or null. Like
+// foldConditionalExpression, it leaves other constant conditions alone. It
+// reports whether an arm was dropped.
+func foldCaseExpression(expr *ast.CaseExpression, optimize func(ast.Expression) ast.Expression) (ast.Expression, bool) {
+	folded := &ast.CaseExpression{Token: expr.Token}
+	dropped := false
+	def := expr.Default
+	for i, cond := range expr.Conditions {
+		cond = optimize(cond)
+		if b, ok := getLiteralValue(cond).(bool); ok {
+			dropped = true
+			if b {
+				def = expr.Results[i]
+				break
+			}
+			continue
+		}
+		folded.Conditions = append(folded.Conditions, cond)
+		folded.Results = append(folded.Results, optimize(expr.Results[i]))
+	}
+	if def != nil {
+		folded.Default = optimize(def)
+	}
+
+	if len(folded.Conditions) == 0 {
+		if folded.Default == nil {
+			return &ast.NullLiteral{Token: expr.Token}, dropped
+		}
+		return folded.Default, dropped
+	}
+	return folded, dropped
+}
+
 // foldListLiteral folds list elements.
 func (o *Optimizer) foldListLiteral(expr *ast.ListLiteral) ast.Expression {
 	elements := make([]ast.Expression, len(expr.Elements))
@@ -145,6 +251,19 @@ func (o *Optimizer) foldListLiteral(expr *ast.ListLiteral) ast.Expression {
 	}
 }
 
+// foldMapLiteral folds map values.
+func (o *Optimizer) foldMapLiteral(expr *ast.MapLiteral) ast.Expression {
+	values := make([]ast.Expression, len(expr.Values))
+	for i, value := range expr.Values {
+		values[i] = o.foldConstant(value)
+	}
+	return &ast.MapLiteral{
+		Token:  expr.Token,
+		Keys:   expr.Keys,
+		Values: values,
+	}
+}
+
 // foldGroupedExpression folds the inner expression.
 func (o *Optimizer) foldGroupedExpression(expr *ast.GroupedExpression) ast.Expression {
 	inner := o.foldConstant(expr.Expression)
@@ -205,11 +324,11 @@ func (o *Optimizer) foldInExpression(expr *ast.InExpression) ast.Expression {
 	leftVal := getLiteralValue(left)
 	rightList, rightOk := right.(*ast.ListLiteral)
 
-	if leftVal != nil && rightOk && areAllLiterals(rightList.Elements) {
+	if leftVal != nil && rightOk && areAllLiterals(rightList.Elements) && o.strictAllowsIn(leftVal, rightList.Elements) {
 		found := false
 		for _, elem := range rightList.Elements {
-			elemVal := getLiteralValue(elem)
-			if elemVal != nil && valuesEqual(leftVal, elemVal) {
+			l, elemVal := o.coerceLiterals("==", leftVal, getLiteralValue(elem))
+			if elemVal != nil && valuesEqual(l, elemVal) {
 				found = true
 				break
 			}
@@ -234,6 +353,70 @@ func (o *Optimizer) foldInExpression(expr *ast.InExpression) ast.Expression {
 	}
 }
 
+// evaluateBinaryOp evaluates a binary operation on two constant values, or
+// returns nil if it cannot be folded.
+func (o *Optimizer) evaluateBinaryOp(op string, left, right interface{}) interface{} {
+	if o.strict && !o.strictAllows(op, left, right) {
+		return nil
+	}
+	if o.decimal && decimalOperation(op, left, right) {
+		return nil
+	}
+	return evaluateBinaryOp(op, left, right)
+}
+
+// decimalOperation reports whether decimal arithmetic computes an operation on
+// two constants exactly: division, or other arithmetic on a float.
+func decimalOperation(op string, left, right interface{}) bool {
+	switch op {
+	case "/":
+		return true
+	case "+", "-", "*", "%":
+		_, lf := left.(float64)
+		_, rf := right.(float64)
+		return lf || rf
+	}
+	return false
+}
+
+// strictAllows reports whether strict types allow an operation on two
+// constants: logical operators and operands of the same type.
+func (o *Optimizer) strictAllows(op string, left, right interface{}) bool {
+	switch op {
+	case "&&", "AND", "||", "OR":
+		return true
+	}
+	return types.NewValue(left).Type == types.NewValue(right).Type
+}
+
+// strictAllowsIn reports whether strict types allow testing a constant for
+// membership in a list of constants, which holds only values of its type.
+func (o *Optimizer) strictAllowsIn(left interface{}, elements []ast.Expression) bool {
+	if !o.strict {
+		return true
+	}
+	for _, elem := range elements {
+		l, r := o.coerceLiterals("==", left, getLiteralValue(elem))
+		if r != nil && !o.strictAllows("==", l, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// coerceLiterals converts the constant operands of a comparison like
+// types.Coerce, if coercion is enabled.
+func (o *Optimizer) coerceLiterals(op string, left, right interface{}) (interface{}, interface{}) {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		if o.coerce {
+			l, r, _ := types.Coerce(types.NewValue(left), types.NewValue(right))
+			return l.Raw, r.Raw
+		}
+	}
+	return left, right
+}
+
 // getLiteralValue extracts the Go value from a literal expression.
 func getLiteralValue(expr ast.Expression) interface{} {
 	switch e := expr.(type) {
@@ -314,6 +497,8 @@ func evaluateBinaryOp(op string, left, right interface{}) interface{} {
 		return evalMul(left, right)
 	case "/":
 		return evalDiv(left, right)
+	case "~/":
+		return evalIntDiv(left, right)
 	case "%":
 		return evalMod(left, right)
 	case "==":
@@ -470,6 +655,26 @@ func evalDiv(left, right interface{}) interface{} {
 	return nil
 }
 
+func evalIntDiv(left, right interface{}) interface{} {
+	if lv, lok := left.(int64); lok {
+		if rv, rok := right.(int64); rok {
+			if rv == 0 || (lv == math.MinInt64 && rv == -1) {
+				return nil // Left for the evaluator to report
+			}
+			return lv / rv
+		}
+	}
+	q, ok := evalDiv(left, right).(float64)
+	if !ok {
+		return nil
+	}
+	q = math.Trunc(q)
+	if math.IsNaN(q) || q < math.MinInt64 || q >= math.MaxInt64 {
+		return nil // Left for the evaluator to report
+	}
+	return int64(q)
+}
+
 func evalMod(left, right interface{}) interface{} {
 	if lv, lok := left.(int64); lok {
 		if rv, rok := right.(int64); rok {
@@ -479,7 +684,23 @@ func evalMod(left, right interface{}) interface{} {
 			return lv % rv
 		}
 	}
-	return nil
+	l, lok := floatOperand(left)
+	r, rok := floatOperand(right)
+	if !lok || !rok || r == 0 {
+		return nil
+	}
+	return math.Mod(l, r)
+}
+
+// floatOperand returns a constant number as a float64.
+func floatOperand(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
 }
 
 // Comparison operations
@@ -630,7 +851,8 @@ func (o *Optimizer) optimizeWithStats(expr ast.Expression, stats *Stats) ast.Exp
 		rightLit := getLiteralValue(right)
 
 		if leftLit != nil && rightLit != nil {
-			result := evaluateBinaryOp(e.Operator, leftLit, rightLit)
+			leftLit, rightLit := o.coerceLiterals(e.Operator, leftLit, rightLit)
+			result := o.evaluateBinaryOp(e.Operator, leftLit, rightLit)
 			if result != nil {
 				stats.ConstantsFolded++
 				return valueToLiteral(result, e.Token)
@@ -672,6 +894,17 @@ func (o *Optimizer) optimizeWithStats(expr ast.Expression, stats *Stats) ast.Exp
 			Elements: elements,
 		}
 
+	case *ast.MapLiteral:
+		values := make([]ast.Expression, len(e.Values))
+		for i, value := range e.Values {
+			values[i] = o.optimizeWithStats(value, stats)
+		}
+		return &ast.MapLiteral{
+			Token:  e.Token,
+			Keys:   e.Keys,
+			Values: values,
+		}
+
 	case *ast.GroupedExpression:
 		inner := o.optimizeWithStats(e.Expression, stats)
 		if isLiteral(inner) {
@@ -715,6 +948,16 @@ func (o *Optimizer) optimizeWithStats(expr ast.Expression, stats *Stats) ast.Exp
 			Index: index,
 		}
 
+	case *ast.SliceExpression:
+		slice := &ast.SliceExpression{Token: e.Token, Left: o.optimizeWithStats(e.Left, stats)}
+		if e.Start != nil {
+			slice.Start = o.optimizeWithStats(e.Start, stats)
+		}
+		if e.End != nil {
+			slice.End = o.optimizeWithStats(e.End, stats)
+		}
+		return slice
+
 	case *ast.InExpression:
 		left := o.optimizeWithStats(e.Left, stats)
 		right := o.optimizeWithStats(e.Right, stats)
@@ -722,11 +965,11 @@ func (o *Optimizer) optimizeWithStats(expr ast.Expression, stats *Stats) ast.Exp
 		leftVal := getLiteralValue(left)
 		rightList, rightOk := right.(*ast.ListLiteral)
 
-		if leftVal != nil && rightOk && areAllLiterals(rightList.Elements) {
+		if leftVal != nil && rightOk && areAllLiterals(rightList.Elements) && o.strictAllowsIn(leftVal, rightList.Elements) {
 			found := false
 			for _, elem := range rightList.Elements {
-				elemVal := getLiteralValue(elem)
-				if elemVal != nil && valuesEqual(leftVal, elemVal) {
+				l, elemVal := o.coerceLiterals("==", leftVal, getLiteralValue(elem))
+				if elemVal != nil && valuesEqual(l, elemVal) {
 					found = true
 					break
 				}
@@ -751,6 +994,32 @@ func (o *Optimizer) optimizeWithStats(expr ast.Expression, stats *Stats) ast.Exp
 			Negated: e.Negated,
 		}
 
+	case *ast.ConditionalExpression:
+		condition := o.optimizeWithStats(e.Condition, stats)
+		if b, ok := getLiteralValue(condition).(bool); ok {
+			stats.ConstantsFolded++
+			if b {
+				return o.optimizeWithStats(e.Consequence, stats)
+			}
+			return o.optimizeWithStats(e.Alternative, stats)
+		}
+
+		return &ast.ConditionalExpression{
+			Token:       e.Token,
+			Condition:   condition,
+			Consequence: o.optimizeWithStats(e.Consequence, stats),
+			Alternative: o.optimizeWithStats(e.Alternative, stats),
+		}
+
+	case *ast.CaseExpression:
+		folded, dropped := foldCaseExpression(e, func(expr ast.Expression) ast.Expression {
+			return o.optimizeWithStats(expr, stats)
+		})
+		if dropped {
+			stats.ConstantsFolded++
+		}
+		return folded
+
 	default:
 		return expr
 	}
@@ -766,6 +1035,9 @@ func IsConstant(expr ast.Expression) bool {
 	case *ast.ListLiteral:
 		return areAllLiterals(e.Elements)
 
+	case *ast.MapLiteral:
+		return areAllLiterals(e.Values)
+
 	case *ast.BinaryExpression:
 		return IsConstant(e.Left) && IsConstant(e.Right)
 
@@ -778,6 +1050,17 @@ func IsConstant(expr ast.Expression) bool {
 	case *ast.InExpression:
 		return IsConstant(e.Left) && IsConstant(e.Right)
 
+	case *ast.ConditionalExpression:
+		return IsConstant(e.Condition) && IsConstant(e.Consequence) && IsConstant(e.Alternative)
+
+	case *ast.CaseExpression:
+		for i, cond := range e.Conditions {
+			if !IsConstant(cond) || !IsConstant(e.Results[i]) {
+				return false
+			}
+		}
+		return e.Default == nil || IsConstant(e.Default)
+
 	default:
 		// Identifiers, JSONPath, function calls, etc. are not constant
 		return false
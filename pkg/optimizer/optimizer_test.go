@@ -25,12 +25,16 @@ func TestConstantFolding(t *testing.T) {
 		{"multiply integers", "3 * 4", int64(12)},
 		{"divide integers", "20 / 4", int64(5)},
 		{"modulo integers", "17 % 5", int64(2)},
+		{"integer division", "17 ~/ 5", int64(3)},
+		{"negative integer division", "-17 ~/ 5", int64(-3)},
 
 		// Float arithmetic
 		{"add floats", "2.5 + 3.5", float64(6.0)},
 		{"subtract floats", "10.5 - 4.5", float64(6.0)},
 		{"multiply floats", "2.5 * 4.0", float64(10.0)},
 		{"divide floats", "10.0 / 4.0", float64(2.5)},
+		{"modulo floats", "7.5 % 2", float64(1.5)},
+		{"integer division floats", "7.5 ~/ 2", int64(3)},
 
 		// Mixed numeric
 		{"int + float", "2 + 3.5", float64(5.5)},
@@ -95,6 +99,68 @@ func TestConstantFoldingDivisionByZero(t *testing.T) {
 	assert.True(t, isBinary, "division by zero should not be folded")
 }
 
+func TestConstantFoldingTypeCoercion(t *testing.T) {
+	fold := func(opt *Optimizer, input string) ast.Expression {
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		return opt.Optimize(expr)
+	}
+
+	lenient := New(WithTypeCoercion(true))
+	for input, want := range map[string]bool{
+		`"5" == 5`:         true,
+		`"2.5" < 3`:        true,
+		`"true" == true`:   true,
+		`"7" IN [5, 6, 7]`: true,
+		`"x" == 0`:         false,
+	} {
+		lit, ok := fold(lenient, input).(*ast.BooleanLiteral)
+		require.True(t, ok, input)
+		assert.Equal(t, want, lit.Value, input)
+	}
+
+	lit, ok := fold(New(), `"5" == 5`).(*ast.BooleanLiteral)
+	require.True(t, ok)
+	assert.False(t, lit.Value)
+}
+
+func TestConstantFoldingStrictTypes(t *testing.T) {
+	strict := New(WithStrictTypes(true))
+	for _, input := range []string{`1 == 1.0`, `1 + 2.5`, `"5" == 5`, `1 IN [1.0, 2]`, `true && 1`} {
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		assert.False(t, isLiteral(strict.Optimize(expr)), input)
+	}
+
+	for input, want := range map[string]bool{
+		`1 + 2 == 3`:      true,
+		`"a" IN ["a"]`:    true,
+		`false && 1`:      false,
+		`2.5 * 2.0 > 4.5`: true,
+	} {
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		lit, ok := strict.Optimize(expr).(*ast.BooleanLiteral)
+		require.True(t, ok, input)
+		assert.Equal(t, want, lit.Value, input)
+	}
+}
+
+func TestConstantFoldingDecimalArithmetic(t *testing.T) {
+	decimal := New(WithDecimalArithmetic(true))
+	for _, input := range []string{`0.1 + 0.2 == 0.3`, `1 / 3`, `2 * 1.5`, `5.5 % 2`} {
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		assert.False(t, isLiteral(decimal.Optimize(expr)), input)
+	}
+
+	for _, input := range []string{`1 + 2 == 3`, `7 ~/ 2`, `0.1 < 0.2`, `-0.5`} {
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		assert.True(t, isLiteral(decimal.Optimize(expr)), input)
+	}
+}
+
 func TestConstantFoldingPreservesNonConstants(t *testing.T) {
 	opt := New()
 
@@ -164,6 +230,84 @@ func TestConstantFoldingList(t *testing.T) {
 	}
 }
 
+func TestConstantFoldingConditional(t *testing.T) {
+	opt := New()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 < 2 ? $.a : $.b", "$.a"},
+		{"!true ? 1 / 0 : $.b", "$.b"},
+		{"1 ? $.a : $.b", "(1 ? $.a : $.b)"}, // Truthiness of non-bools is left to the evaluator
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, opt.Optimize(expr).String())
+
+			optimized, stats := opt.OptimizeWithStats(expr)
+			assert.Equal(t, tt.expected, optimized.String())
+			assert.Equal(t, tt.expected != "(1 ? $.a : $.b)", stats.ConstantsFolded > 0)
+		})
+	}
+
+	// Branches are folded when the condition is not constant
+	expr, err := parser.Parse("$.a ? 1 + 1 : 2 + 2")
+	require.NoError(t, err)
+	cond, ok := opt.Optimize(expr).(*ast.ConditionalExpression)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), cond.Consequence.(*ast.IntegerLiteral).Value)
+	assert.Equal(t, int64(4), cond.Alternative.(*ast.IntegerLiteral).Value)
+}
+
+func TestConstantFoldingCase(t *testing.T) {
+	opt := New()
+
+	tests := []struct {
+		input    string
+		expected string
+		folded   bool
+	}{
+		{"case { 1 > 2 => 1 / 0; $.a => 2; else => 3 }", "case { $.a => 2; else => 3 }", true},
+		{"case { $.a => 1; 1 < 2 => $.b; $.c => 1 / 0 }", "case { $.a => 1; else => $.b }", true},
+		{"case { false => 1; true => $.b; else => 3 }", "$.b", true},
+		{"case { false => 1 }", "null", true},
+		{"case { 1 => $.a; else => $.b }", "case { 1 => $.a; else => $.b }", false}, // Truthiness of non-bools is left to the evaluator
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, opt.Optimize(expr).String())
+
+			optimized, stats := opt.OptimizeWithStats(expr)
+			assert.Equal(t, tt.expected, optimized.String())
+			assert.Equal(t, tt.folded, stats.ConstantsFolded > 0)
+		})
+	}
+}
+
+func TestConstantFoldingMap(t *testing.T) {
+	opt := New()
+
+	// Map values should be folded, keeping their keys
+	expr, err := parser.Parse(`{"sum": 1 + 1, "name": $.name, "flag": !false}`)
+	require.NoError(t, err)
+
+	optimized := opt.Optimize(expr)
+
+	m, ok := optimized.(*ast.MapLiteral)
+	require.True(t, ok)
+	assert.Equal(t, []string{"sum", "name", "flag"}, m.Keys)
+	assert.Equal(t, int64(2), m.Values[0].(*ast.IntegerLiteral).Value)
+	assert.IsType(t, &ast.JSONPathExpression{}, m.Values[1])
+	assert.Equal(t, true, m.Values[2].(*ast.BooleanLiteral).Value)
+}
+
 func TestConstantFoldingIndexExpression(t *testing.T) {
 	opt := New()
 
@@ -300,6 +444,10 @@ func TestIsConstant(t *testing.T) {
 		{"function call", "max(1, 2)", false},
 		{"mixed", "x + 2", false},
 		{"list with non-constant", "[1, x, 3]", false},
+		{"constant map", `{"a": 1}`, true},
+		{"map with non-constant", `{"a": x}`, false},
+		{"constant case", `case { 1 > 2 => "a"; else => "b" }`, true},
+		{"case with non-constant", `case { x => "a" }`, false},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,414 @@
+// Package optimizer provides AST optimization for the AMEL DSL.
+package optimizer
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// MinClauseSamples is the number of times every clause of a run must have
+// been evaluated before Reorder moves its clauses.
+const MinClauseSamples = 100
+
+// ClauseStats counts how often the clauses of the && and || chains of an
+// expression evaluate to true and false, to reorder them with Reorder. Chains
+// nested in function arguments, lambdas, and conditionals are not counted. It
+// is safe for concurrent use.
+type ClauseStats struct {
+	counters []*clauseCounter                  // In source order
+	clauses  map[ast.Expression]*clauseCounter // By clause of the original expression
+
+	mu      sync.Mutex                                        // Serializes the writers of byNode
+	byNode  atomic.Pointer[map[ast.Expression]*clauseCounter] // Clauses and their latest rewritten copies
+	reorder atomic.Uint64
+}
+
+type clauseCounter struct {
+	clause   string
+	operator string // "&&" or "||"
+	truthy   atomic.Uint64
+	falsy    atomic.Uint64
+}
+
+// ClauseStat reports the outcomes of a clause of an && or || chain.
+type ClauseStat struct {
+	Clause   string `json:"clause"`
+	Operator string `json:"operator"` // The chain operator, "&&" or "||"
+	True     uint64 `json:"true"`
+	False    uint64 `json:"false"`
+}
+
+// ShortCircuits returns the number of evaluations in which the clause decided
+// its chain: the false ones for &&, the true ones for ||.
+func (s ClauseStat) ShortCircuits() uint64 {
+	if s.Operator == "||" {
+		return s.True
+	}
+	return s.False
+}
+
+// NewClauseStats creates the statistics of the clauses of expr, which must be
+// the expression that is evaluated.
+func NewClauseStats(expr ast.Expression) *ClauseStats {
+	s := &ClauseStats{}
+	byNode := make(map[ast.Expression]*clauseCounter)
+	walkChains(expr, func(op string, clauses []ast.Expression) {
+		for _, clause := range clauses {
+			if _, ok := byNode[clause]; ok {
+				continue
+			}
+			counter := &clauseCounter{clause: clause.String(), operator: op}
+			byNode[clause] = counter
+			s.counters = append(s.counters, counter)
+		}
+	})
+	s.clauses = byNode
+	s.byNode.Store(&byNode)
+	return s
+}
+
+// Record counts an evaluation of clause. Expressions that are not clauses of
+// the expression are ignored.
+func (s *ClauseStats) Record(clause ast.Expression, truthy bool) {
+	counter, ok := (*s.byNode.Load())[clause]
+	if !ok {
+		return
+	}
+	if truthy {
+		counter.truthy.Add(1)
+	} else {
+		counter.falsy.Add(1)
+	}
+}
+
+// Snapshot returns the statistics of every clause, in source order.
+func (s *ClauseStats) Snapshot() []ClauseStat {
+	stats := make([]ClauseStat, len(s.counters))
+	for i, counter := range s.counters {
+		stats[i] = ClauseStat{
+			Clause:   counter.clause,
+			Operator: counter.operator,
+			True:     counter.truthy.Load(),
+			False:    counter.falsy.Load(),
+		}
+	}
+	return stats
+}
+
+// Reorders returns the number of times Reorder changed the order of clauses.
+func (s *ClauseStats) Reorders() uint64 {
+	return s.reorder.Load()
+}
+
+// Reorder returns a copy of expr, the expression stats were created for, in
+// which the clauses of each && and || chain are sorted so that those most
+// likely to decide the chain are evaluated first. Only clauses that cannot
+// fail and have no side effects are moved: equality tests, IN tests against
+// list literals, and negations and chains of these. Other clauses stay in
+// place and no clause moves across them, so reordering never changes a
+// result or error. Runs of clauses evaluated fewer than MinClauseSamples
+// times keep their order. expr is not modified.
+//
+// With WithStrictTypes, under which comparisons of different types and
+// conditions other than bools fail, only clauses that cannot fail under
+// strict types are moved: comparisons with null or of literals of one type,
+// and negations and chains of these. Other options are ignored.
+func Reorder(expr ast.Expression, stats *ClauseStats, opts ...Option) ast.Expression {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	r := &reorderer{byNode: stats.clauses, strict: New(opts...).strict}
+	result := r.rewrite(expr)
+	// Copies made by earlier calls are dropped, so evaluations still running
+	// with an earlier order may go partly uncounted
+	byNode := stats.clauses
+	if r.aliases != nil {
+		byNode = make(map[ast.Expression]*clauseCounter, len(stats.clauses)+len(r.aliases))
+		for node, counter := range stats.clauses {
+			byNode[node] = counter
+		}
+		for node, counter := range r.aliases {
+			byNode[node] = counter
+		}
+	}
+	stats.byNode.Store(&byNode)
+	if r.moved {
+		stats.reorder.Add(1)
+	}
+	return result
+}
+
+// reorderer rewrites the chains of an expression. Rewritten clauses are
+// recorded as aliases so that their evaluations keep being counted.
+type reorderer struct {
+	byNode  map[ast.Expression]*clauseCounter
+	aliases map[ast.Expression]*clauseCounter
+	moved   bool
+	strict  bool // Whether strict types apply
+}
+
+func (r *reorderer) rewrite(expr ast.Expression) ast.Expression {
+	switch e := expr.(type) {
+	case *ast.BinaryExpression:
+		op := logicalOperator(e.Operator)
+		if op == "" {
+			return expr
+		}
+		clauses := flattenChain(e, op)
+		rewritten := make([]ast.Expression, len(clauses))
+		changed := false
+		for i, clause := range clauses {
+			rewritten[i] = r.rewrite(clause)
+			if rewritten[i] != clause {
+				changed = true
+				r.alias(clause, rewritten[i])
+			}
+		}
+		if r.sort(op, rewritten) {
+			changed = true
+		}
+		if !changed {
+			return expr
+		}
+		chain := rewritten[0]
+		for _, clause := range rewritten[1:] {
+			chain = &ast.BinaryExpression{Token: e.Token, Left: chain, Operator: e.Operator, Right: clause}
+		}
+		return chain
+
+	case *ast.GroupedExpression:
+		inner := r.rewrite(e.Expression)
+		if inner == e.Expression {
+			return expr
+		}
+		return &ast.GroupedExpression{Token: e.Token, Expression: inner}
+
+	case *ast.UnaryExpression:
+		operand := r.rewrite(e.Operand)
+		if operand == e.Operand {
+			return expr
+		}
+		return &ast.UnaryExpression{Token: e.Token, Operator: e.Operator, Operand: operand}
+
+	default:
+		return expr
+	}
+}
+
+// alias counts the evaluations of the rewritten copy of a clause as those of
+// the clause.
+func (r *reorderer) alias(clause, rewritten ast.Expression) {
+	counter, ok := r.byNode[clause]
+	if !ok {
+		return
+	}
+	if r.aliases == nil {
+		r.aliases = make(map[ast.Expression]*clauseCounter)
+	}
+	r.aliases[rewritten] = counter
+}
+
+// sort sorts the runs of movable clauses of a chain by how often they decide
+// it, most often first, and reports whether the order changed.
+func (r *reorderer) sort(op string, clauses []ast.Expression) bool {
+	changed := false
+	start := 0
+	for end := 0; end <= len(clauses); end++ {
+		if end < len(clauses) && r.movable(clauses[end]) {
+			continue
+		}
+		if r.sortRun(op, clauses[start:end]) {
+			changed = true
+		}
+		start = end + 1
+	}
+	if changed {
+		r.moved = true
+	}
+	return changed
+}
+
+func (r *reorderer) sortRun(op string, run []ast.Expression) bool {
+	if len(run) < 2 {
+		return false
+	}
+	rates := make(map[ast.Expression]float64, len(run))
+	for _, clause := range run {
+		counter := r.counter(clause)
+		if counter == nil {
+			return false
+		}
+		total := counter.truthy.Load() + counter.falsy.Load()
+		if total < MinClauseSamples {
+			return false
+		}
+		decided := counter.falsy.Load()
+		if op == "||" {
+			decided = counter.truthy.Load()
+		}
+		rates[clause] = float64(decided) / float64(total)
+	}
+
+	before := make([]ast.Expression, len(run))
+	copy(before, run)
+	sort.SliceStable(run, func(i, j int) bool { return rates[run[i]] > rates[run[j]] })
+	for i := range run {
+		if run[i] != before[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reorderer) counter(clause ast.Expression) *clauseCounter {
+	if counter, ok := r.byNode[clause]; ok {
+		return counter
+	}
+	return r.aliases[clause]
+}
+
+// walkChains calls fn with the operator and clauses of every && and || chain
+// of expr that Reorder can reach.
+func walkChains(expr ast.Expression, fn func(op string, clauses []ast.Expression)) {
+	switch e := expr.(type) {
+	case *ast.BinaryExpression:
+		op := logicalOperator(e.Operator)
+		if op == "" {
+			return
+		}
+		clauses := flattenChain(e, op)
+		fn(op, clauses)
+		for _, clause := range clauses {
+			walkChains(clause, fn)
+		}
+	case *ast.GroupedExpression:
+		walkChains(e.Expression, fn)
+	case *ast.UnaryExpression:
+		walkChains(e.Operand, fn)
+	}
+}
+
+// flattenChain returns the operands of a chain of op, such as a, b, and c for
+// (a && b) && c.
+func flattenChain(expr ast.Expression, op string) []ast.Expression {
+	if bin, ok := expr.(*ast.BinaryExpression); ok && logicalOperator(bin.Operator) == op {
+		return append(flattenChain(bin.Left, op), flattenChain(bin.Right, op)...)
+	}
+	return []ast.Expression{expr}
+}
+
+// movable reports whether a clause of a chain can be moved. Under strict
+// types, a clause that is not a bool fails the chain.
+func (r *reorderer) movable(clause ast.Expression) bool {
+	if r.strict {
+		return strictReorderable(clause)
+	}
+	return reorderable(clause)
+}
+
+// reorderable reports whether a clause can be evaluated earlier or later, or
+// skipped, without changing the result: it cannot fail and has no side
+// effects.
+func reorderable(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.DurationLiteral, *ast.StringLiteral,
+		*ast.BooleanLiteral, *ast.NullLiteral, *ast.JSONPathExpression:
+		return true
+	case *ast.GroupedExpression:
+		return reorderable(e.Expression)
+	case *ast.UnaryExpression:
+		return isNot(e.Operator) && reorderable(e.Operand)
+	case *ast.BinaryExpression:
+		switch e.Operator {
+		case "==", "!=":
+		default:
+			if logicalOperator(e.Operator) == "" {
+				return false
+			}
+		}
+		return reorderable(e.Left) && reorderable(e.Right)
+	case *ast.InExpression:
+		list, ok := e.Right.(*ast.ListLiteral)
+		return ok && reorderable(e.Left) && reorderable(list)
+	case *ast.ConditionalExpression:
+		return reorderable(e.Condition) && reorderable(e.Consequence) && reorderable(e.Alternative)
+	case *ast.CaseExpression:
+		for i, cond := range e.Conditions {
+			if !reorderable(cond) || !reorderable(e.Results[i]) {
+				return false
+			}
+		}
+		return e.Default == nil || reorderable(e.Default)
+	case *ast.ListLiteral:
+		for _, elem := range e.Elements {
+			if !reorderable(elem) {
+				return false
+			}
+		}
+		return true
+	case *ast.MapLiteral:
+		for _, value := range e.Values {
+			if !reorderable(value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// strictReorderable reports whether an expression is a bool that cannot fail
+// under strict types: a bool literal, a comparison with null or of literals
+// of one type, or a negation or chain of these.
+func strictReorderable(expr ast.Expression) bool {
+	switch e := expr.(type) {
+	case *ast.BooleanLiteral:
+		return true
+	case *ast.GroupedExpression:
+		return strictReorderable(e.Expression)
+	case *ast.UnaryExpression:
+		return isNot(e.Operator) && strictReorderable(e.Operand)
+	case *ast.BinaryExpression:
+		switch e.Operator {
+		case "==", "!=":
+			if !reorderable(e.Left) || !reorderable(e.Right) {
+				return false
+			}
+			if isNull(e.Left) || isNull(e.Right) {
+				return true
+			}
+			return isLiteral(e.Left) && isLiteral(e.Right) &&
+				types.NewValue(getLiteralValue(e.Left)).Type == types.NewValue(getLiteralValue(e.Right)).Type
+		}
+		return logicalOperator(e.Operator) != "" && strictReorderable(e.Left) && strictReorderable(e.Right)
+	}
+	return false
+}
+
+// isNull reports whether an expression is the null literal.
+func isNull(expr ast.Expression) bool {
+	_, ok := expr.(*ast.NullLiteral)
+	return ok
+}
+
+// isNot reports whether a unary operator is a negation.
+func isNot(op string) bool {
+	return op == "!" || strings.EqualFold(op, "not")
+}
+
+// logicalOperator normalizes the spellings of && and ||, returning "" for
+// other operators.
+func logicalOperator(op string) string {
+	switch strings.ToLower(op) {
+	case "&&", "and":
+		return "&&"
+	case "||", "or":
+		return "||"
+	}
+	return ""
+}
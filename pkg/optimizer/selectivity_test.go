@@ -0,0 +1,76 @@
+// Package optimizer provides AST optimization for the AMEL DSL.
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordChain records n evaluations of the clauses of a chain, the first
+// falseRates[i]*n of which are false.
+func recordChain(stats *ClauseStats, clauses []ast.Expression, n int, falseRates ...float64) {
+	for i, clause := range clauses {
+		falses := int(falseRates[i] * float64(n))
+		for j := 0; j < n; j++ {
+			stats.Record(clause, j >= falses)
+		}
+	}
+}
+
+func TestReorder(t *testing.T) {
+	expr, err := parser.Parse(`$.a == 1 && $.b IN ["x", "y"] && $.c > 5 && $.d == true && !($.e != null)`)
+	require.NoError(t, err)
+	stats := NewClauseStats(expr)
+	clauses := flattenChain(expr, "&&")
+	require.Len(t, clauses, 5)
+
+	recordChain(stats, clauses, MinClauseSamples/2, 0.1, 0.9, 0.5, 0.2, 0.6)
+	assert.Same(t, expr, Reorder(expr, stats), "too few samples")
+	assert.Zero(t, stats.Reorders())
+
+	recordChain(stats, clauses, MinClauseSamples/2, 0.1, 0.9, 0.5, 0.2, 0.6)
+	reordered := Reorder(expr, stats)
+	assert.Equal(t, `((((($.b IN ["x", "y"]) && ($.a == 1)) && ($.c > 5)) && (!($.e != null))) && ($.d == true))`,
+		reordered.String(), "clauses move within the runs around $.c > 5, which can fail")
+	assert.Equal(t, uint64(1), stats.Reorders())
+	assert.Contains(t, expr.String(), `($.a == 1) && ($.b IN`, "the original is unchanged")
+
+	snapshot := stats.Snapshot()
+	require.Len(t, snapshot, 5)
+	assert.Equal(t, ClauseStat{Clause: "($.a == 1)", Operator: "&&", True: 90, False: 10}, snapshot[0])
+	assert.Equal(t, uint64(90), snapshot[1].ShortCircuits())
+
+	t.Run("nested chains", func(t *testing.T) {
+		expr, err := parser.Parse(`$.x > 0 || ($.a == 1 && $.b == 2)`)
+		require.NoError(t, err)
+		stats := NewClauseStats(expr)
+		inner := flattenChain(expr.(*ast.BinaryExpression).Right, "&&")
+		recordChain(stats, inner, MinClauseSamples, 0, 1)
+
+		reordered := Reorder(expr, stats)
+		assert.Equal(t, `(($.x > 0) || (($.b == 2) && ($.a == 1)))`, reordered.String())
+
+		// The rewritten chain is still counted as the original clause
+		chain := reordered.(*ast.BinaryExpression).Right
+		stats.Record(chain, true)
+		assert.Equal(t, ClauseStat{Clause: "(($.a == 1) && ($.b == 2))", Operator: "||", True: 1}, stats.Snapshot()[1])
+	})
+
+	t.Run("strict types", func(t *testing.T) {
+		// Comparing a path with a literal fails under strict types when the
+		// types differ, so only the null tests move
+		expr, err := parser.Parse(`$.kind == "num" && $.value == 5 && $.a != null && !($.b == null)`)
+		require.NoError(t, err)
+		stats := NewClauseStats(expr)
+		recordChain(stats, flattenChain(expr, "&&"), MinClauseSamples, 0.1, 0.5, 0.2, 0.9)
+
+		assert.Equal(t, `(((($.kind == "num") && ($.value == 5)) && (!($.b == null))) && ($.a != null))`,
+			Reorder(expr, stats, WithStrictTypes(true)).String())
+		assert.Equal(t, `((((!($.b == null)) && ($.value == 5)) && ($.a != null)) && ($.kind == "num"))`,
+			Reorder(expr, stats).String())
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/bencagri/amel/internal/errors"
 	"github.com/bencagri/amel/pkg/ast"
 	"github.com/bencagri/amel/pkg/lexer"
+	"github.com/bencagri/amel/pkg/types"
 )
 
 // Precedence levels for operators (lower number = lower precedence)
@@ -15,6 +16,7 @@ const (
 	_ int = iota
 	LOWEST
 	LAMBDA      // =>
+	TERNARY     // ? :
 	OR          // ||, OR
 	AND         // &&, AND
 	NOT         // ! (unary)
@@ -32,6 +34,7 @@ const (
 // Operator precedence mapping
 var precedences = map[lexer.TokenType]int{
 	lexer.TOKEN_ARROW:     LAMBDA,
+	lexer.TOKEN_QUESTION:  TERNARY,
 	lexer.TOKEN_LOR:       OR,
 	lexer.TOKEN_OR:        OR,
 	lexer.TOKEN_LAND:      AND,
@@ -51,16 +54,23 @@ var precedences = map[lexer.TokenType]int{
 	lexer.TOKEN_STAR:      PRODUCT,
 	lexer.TOKEN_SLASH:     PRODUCT,
 	lexer.TOKEN_PERCENT:   PRODUCT,
+	lexer.TOKEN_INT_DIV:   PRODUCT,
 	lexer.TOKEN_LPAREN:    CALL,
 	lexer.TOKEN_LBRACKET:  INDEX,
 	lexer.TOKEN_DOT:       INDEX,
 }
 
+// DefaultMaxDepth is the default maximum nesting depth of an expression.
+const DefaultMaxDepth = 1000
+
 // Parser parses AMEL DSL expressions into an AST.
 type Parser struct {
 	lexer  *lexer.Lexer
 	errors []error
 
+	maxDepth int // Zero or less means no limit
+	depth    int // Nesting depth of the expression being parsed
+
 	curToken  lexer.Token
 	peekToken lexer.Token
 
@@ -73,72 +83,40 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
-// New creates a new Parser for the given input string.
-func New(input string) *Parser {
-	l := lexer.New(input)
-	p := &Parser{
-		lexer:  l,
-		errors: []error{},
-	}
-
-	p.prefixParseFns = make(map[lexer.TokenType]prefixParseFn)
-	p.registerPrefix(lexer.TOKEN_IDENT, p.parseIdentifier)
-	p.registerPrefix(lexer.TOKEN_INT, p.parseIntegerLiteral)
-	p.registerPrefix(lexer.TOKEN_FLOAT, p.parseFloatLiteral)
-	p.registerPrefix(lexer.TOKEN_STRING, p.parseStringLiteral)
-	p.registerPrefix(lexer.TOKEN_TRUE, p.parseBooleanLiteral)
-	p.registerPrefix(lexer.TOKEN_FALSE, p.parseBooleanLiteral)
-	p.registerPrefix(lexer.TOKEN_NULL, p.parseNullLiteral)
-	p.registerPrefix(lexer.TOKEN_BANG, p.parsePrefixExpression)
-	p.registerPrefix(lexer.TOKEN_NOT, p.parsePrefixExpression)
-	p.registerPrefix(lexer.TOKEN_MINUS, p.parsePrefixExpression)
-	p.registerPrefix(lexer.TOKEN_LPAREN, p.parseGroupedExpression)
-	p.registerPrefix(lexer.TOKEN_LBRACKET, p.parseListLiteral)
-	p.registerPrefix(lexer.TOKEN_DOLLAR, p.parseJSONPath)
-
-	p.infixParseFns = make(map[lexer.TokenType]infixParseFn)
-	p.registerInfix(lexer.TOKEN_PLUS, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_MINUS, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_STAR, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_SLASH, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_PERCENT, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_EQ, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_NEQ, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_LT, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_GT, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_LTE, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_GTE, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_LAND, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_LOR, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_AND, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_OR, p.parseInfixExpression)
-	p.registerInfix(lexer.TOKEN_IN, p.parseInExpression)
-	p.registerInfix(lexer.TOKEN_NOT_IN, p.parseInExpression)
-	p.registerInfix(lexer.TOKEN_MATCH, p.parseRegexExpression)
-	p.registerInfix(lexer.TOKEN_NOT_MATCH, p.parseRegexExpression)
-	p.registerInfix(lexer.TOKEN_ARROW, p.parseLambdaExpression)
-	p.registerInfix(lexer.TOKEN_LPAREN, p.parseCallExpression)
-	p.registerInfix(lexer.TOKEN_LBRACKET, p.parseIndexExpression)
-	p.registerInfix(lexer.TOKEN_DOT, p.parseMemberExpression)
+// Option is a function that configures a Parser.
+type Option func(*Parser)
 
-	// Read two tokens to initialize curToken and peekToken
-	p.nextToken()
-	p.nextToken()
+// WithMaxDepth sets the maximum nesting depth of an expression: the number
+// of operators, calls, groups, and lambdas nested inside each other. Deeper
+// expressions fail with ErrDepthLimit instead of exhausting the stack. Zero
+// or less means no limit. The default is DefaultMaxDepth.
+func WithMaxDepth(n int) Option {
+	return func(p *Parser) {
+		p.maxDepth = n
+	}
+}
 
-	return p
+// New creates a new Parser for the given input string.
+func New(input string, opts ...Option) *Parser {
+	return NewFromLexer(lexer.New(input), opts...)
 }
 
 // NewFromLexer creates a new Parser using an existing lexer.
-func NewFromLexer(l *lexer.Lexer) *Parser {
+func NewFromLexer(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{
-		lexer:  l,
-		errors: []error{},
+		lexer:    l,
+		errors:   []error{},
+		maxDepth: DefaultMaxDepth,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
 
 	p.prefixParseFns = make(map[lexer.TokenType]prefixParseFn)
 	p.registerPrefix(lexer.TOKEN_IDENT, p.parseIdentifier)
 	p.registerPrefix(lexer.TOKEN_INT, p.parseIntegerLiteral)
 	p.registerPrefix(lexer.TOKEN_FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(lexer.TOKEN_DURATION, p.parseDurationLiteral)
 	p.registerPrefix(lexer.TOKEN_STRING, p.parseStringLiteral)
 	p.registerPrefix(lexer.TOKEN_TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(lexer.TOKEN_FALSE, p.parseBooleanLiteral)
@@ -148,6 +126,7 @@ func NewFromLexer(l *lexer.Lexer) *Parser {
 	p.registerPrefix(lexer.TOKEN_MINUS, p.parsePrefixExpression)
 	p.registerPrefix(lexer.TOKEN_LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(lexer.TOKEN_LBRACKET, p.parseListLiteral)
+	p.registerPrefix(lexer.TOKEN_LBRACE, p.parseMapLiteral)
 	p.registerPrefix(lexer.TOKEN_DOLLAR, p.parseJSONPath)
 
 	p.infixParseFns = make(map[lexer.TokenType]infixParseFn)
@@ -156,6 +135,7 @@ func NewFromLexer(l *lexer.Lexer) *Parser {
 	p.registerInfix(lexer.TOKEN_STAR, p.parseInfixExpression)
 	p.registerInfix(lexer.TOKEN_SLASH, p.parseInfixExpression)
 	p.registerInfix(lexer.TOKEN_PERCENT, p.parseInfixExpression)
+	p.registerInfix(lexer.TOKEN_INT_DIV, p.parseInfixExpression)
 	p.registerInfix(lexer.TOKEN_EQ, p.parseInfixExpression)
 	p.registerInfix(lexer.TOKEN_NEQ, p.parseInfixExpression)
 	p.registerInfix(lexer.TOKEN_LT, p.parseInfixExpression)
@@ -171,6 +151,7 @@ func NewFromLexer(l *lexer.Lexer) *Parser {
 	p.registerInfix(lexer.TOKEN_MATCH, p.parseRegexExpression)
 	p.registerInfix(lexer.TOKEN_NOT_MATCH, p.parseRegexExpression)
 	p.registerInfix(lexer.TOKEN_ARROW, p.parseLambdaExpression)
+	p.registerInfix(lexer.TOKEN_QUESTION, p.parseConditionalExpression)
 	p.registerInfix(lexer.TOKEN_LPAREN, p.parseCallExpression)
 	p.registerInfix(lexer.TOKEN_LBRACKET, p.parseIndexExpression)
 	p.registerInfix(lexer.TOKEN_DOT, p.parseMemberExpression)
@@ -277,6 +258,11 @@ func (p *Parser) peekPrecedence() int {
 // ============================================================================
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	if !p.enter() {
+		return nil
+	}
+	defer p.leave()
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
@@ -284,11 +270,18 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	leftExp := prefix()
 
+	// Each operator applied to leftExp nests it one level deeper
+	chained := 0
+	defer func() { p.depth -= chained }()
 	for !p.peekTokenIs(lexer.TOKEN_EOF) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
 		}
+		if !p.enter() {
+			return nil
+		}
+		chained++
 		p.nextToken()
 		leftExp = infix(leftExp)
 	}
@@ -296,11 +289,34 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	return leftExp
 }
 
+// enter descends one nesting level. It reports false, recording an error
+// once, if the maximum depth is exceeded.
+func (p *Parser) enter() bool {
+	if p.maxDepth > 0 && p.depth >= p.maxDepth {
+		if len(p.errors) == 0 || !errors.IsCode(p.errors[len(p.errors)-1], errors.ErrDepthLimit) {
+			p.addError(errors.NewAtf(errors.ErrDepthLimit, p.curToken.Line, p.curToken.Column,
+				"expression is nested deeper than the maximum depth of %d", p.maxDepth))
+		}
+		return false
+	}
+	p.depth++
+	return true
+}
+
+// leave ascends one nesting level.
+func (p *Parser) leave() {
+	p.depth--
+}
+
 // ============================================================================
 // Prefix parsers
 // ============================================================================
 
 func (p *Parser) parseIdentifier() ast.Expression {
+	// case is not a keyword; an identifier is never followed by '{' otherwise
+	if p.curToken.Literal == "case" && p.peekTokenIs(lexer.TOKEN_LBRACE) {
+		return p.parseCaseExpression()
+	}
 	return &ast.Identifier{
 		Token: p.curToken,
 		Value: p.curToken.Literal,
@@ -335,6 +351,20 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseDurationLiteral() ast.Expression {
+	lit := &ast.DurationLiteral{Token: p.curToken}
+
+	value, ok := types.ParseDuration(p.curToken.Literal)
+	if !ok {
+		p.addError(errors.NewAtf(errors.ErrInvalidNumber, p.curToken.Line, p.curToken.Column,
+			"could not parse %q as duration", p.curToken.Literal))
+		return nil
+	}
+
+	lit.Value = value
+	return lit
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{
 		Token: p.curToken,
@@ -431,6 +461,101 @@ func (p *Parser) parseListLiteral() ast.Expression {
 	return list
 }
 
+func (p *Parser) parseMapLiteral() ast.Expression {
+	m := &ast.MapLiteral{Token: p.curToken, Keys: []string{}, Values: []ast.Expression{}}
+	if p.peekTokenIs(lexer.TOKEN_RBRACE) {
+		p.nextToken()
+		return m
+	}
+
+	seen := make(map[string]bool)
+	for {
+		if !p.expectPeek(lexer.TOKEN_STRING) {
+			return nil
+		}
+		key := p.curToken
+		if seen[key.Literal] {
+			p.addError(errors.NewAtf(errors.ErrInvalidSyntax, key.Line, key.Column,
+				"duplicate key %q in map literal", key.Literal))
+			return nil
+		}
+		seen[key.Literal] = true
+
+		if !p.expectPeek(lexer.TOKEN_COLON) {
+			return nil
+		}
+		p.nextToken()
+		m.Keys = append(m.Keys, key.Literal)
+		m.Values = append(m.Values, p.parseExpression(LOWEST))
+
+		if !p.peekTokenIs(lexer.TOKEN_COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(lexer.TOKEN_RBRACE) {
+		return nil
+	}
+	return m
+}
+
+// parseCaseExpression parses case { condition => result; ...; else => result }.
+// The arms are separated by semicolons, and a semicolon may follow the last
+// one. The else arm is optional and must come last.
+func (p *Parser) parseCaseExpression() ast.Expression {
+	expr := &ast.CaseExpression{Token: p.curToken}
+	p.nextToken() // move to '{'
+
+	for !p.peekTokenIs(lexer.TOKEN_RBRACE) {
+		if expr.Default != nil {
+			p.addError(errors.NewAtf(errors.ErrInvalidSyntax, p.peekToken.Line, p.peekToken.Column,
+				"the else arm must be the last arm of a case expression"))
+			return nil
+		}
+		p.nextToken()
+
+		isElse := p.curTokenIs(lexer.TOKEN_IDENT) && p.curToken.Literal == "else" && p.peekTokenIs(lexer.TOKEN_ARROW)
+		var cond ast.Expression
+		if !isElse {
+			// Parse above '=>' so the arrow ends the condition
+			if cond = p.parseExpression(LAMBDA); cond == nil {
+				return nil
+			}
+		}
+		if !p.expectPeek(lexer.TOKEN_ARROW) {
+			return nil
+		}
+		p.nextToken()
+		result := p.parseExpression(LOWEST)
+		if result == nil {
+			return nil
+		}
+
+		if isElse {
+			expr.Default = result
+		} else {
+			expr.Conditions = append(expr.Conditions, cond)
+			expr.Results = append(expr.Results, result)
+		}
+
+		if !p.peekTokenIs(lexer.TOKEN_SEMICOLON) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(lexer.TOKEN_RBRACE) {
+		return nil
+	}
+	if len(expr.Conditions) == 0 && expr.Default == nil {
+		p.addError(errors.NewAtf(errors.ErrInvalidSyntax, expr.Token.Line, expr.Token.Column,
+			"case expression has no arms"))
+		return nil
+	}
+	return expr
+}
+
 func (p *Parser) parseExpressionList(end lexer.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 
@@ -476,24 +601,21 @@ func (p *Parser) parseJSONPath() ast.Expression {
 			jp.Path += p.curToken.Literal
 		} else if p.peekTokenIs(lexer.TOKEN_LBRACKET) {
 			p.nextToken() // consume '['
-			jp.Path += "["
-
-			if p.peekTokenIs(lexer.TOKEN_INT) {
-				p.nextToken()
-				jp.Path += p.curToken.Literal
-			} else if p.peekTokenIs(lexer.TOKEN_STRING) {
-				p.nextToken()
-				jp.Path += fmt.Sprintf("%q", p.curToken.Literal)
-			} else {
-				p.addError(errors.NewAtf(errors.ErrInvalidJSONPath, p.curToken.Line, p.curToken.Column,
-					"expected integer or string in JSON path bracket"))
-				return jp
+			bracket := p.curToken
+			p.nextToken()
+
+			// Brackets other than a plain index or key, such as [-1], [0:3],
+			// or [i + 1], index the value of the path so far
+			if !p.curTokenIs(lexer.TOKEN_INT) && !p.curTokenIs(lexer.TOKEN_STRING) || !p.peekTokenIs(lexer.TOKEN_RBRACKET) {
+				return p.parseIndex(bracket, jp)
 			}
 
-			if !p.expectPeek(lexer.TOKEN_RBRACKET) {
-				return jp
+			if p.curTokenIs(lexer.TOKEN_INT) {
+				jp.Path += "[" + p.curToken.Literal + "]"
+			} else {
+				jp.Path += fmt.Sprintf("[%q]", p.curToken.Literal)
 			}
-			jp.Path += "]"
+			p.nextToken() // consume ']'
 		}
 	}
 
@@ -544,6 +666,28 @@ func (p *Parser) parseRegexExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseConditionalExpression parses condition ? consequence : alternative.
+// The operator is right-associative, so a ? b : c ? d : e nests the second
+// conditional in the alternative of the first.
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{
+		Token:     p.curToken,
+		Condition: condition,
+	}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(lexer.TOKEN_COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Alternative = p.parseExpression(TERNARY - 1)
+
+	return expression
+}
+
 func (p *Parser) parseLambdaExpression(left ast.Expression) ast.Expression {
 	// The left side should be an identifier (single parameter) or a grouped expression with identifiers
 	token := p.curToken
@@ -592,7 +736,7 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	}
 
 	exp := &ast.FunctionCall{
-		Token: p.curToken,
+		Token: ident.Token,
 		Name:  ident.Value,
 	}
 	exp.Arguments = p.parseExpressionList(lexer.TOKEN_RPAREN)
@@ -600,19 +744,35 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{
-		Token: p.curToken,
-		Left:  left,
-	}
-
+	tok := p.curToken
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	return p.parseIndex(tok, left)
+}
 
+// parseIndex parses the rest of left[index], or of a slice such as
+// left[1:3], left[:3], or left[1:], from the token after the '[' token tok.
+func (p *Parser) parseIndex(tok lexer.Token, left ast.Expression) ast.Expression {
+	var start ast.Expression
+	if !p.curTokenIs(lexer.TOKEN_COLON) {
+		start = p.parseExpression(LOWEST)
+		if !p.peekTokenIs(lexer.TOKEN_COLON) {
+			if !p.expectPeek(lexer.TOKEN_RBRACKET) {
+				return nil
+			}
+			return &ast.IndexExpression{Token: tok, Left: left, Index: start}
+		}
+		p.nextToken()
+	}
+
+	slice := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+	if !p.peekTokenIs(lexer.TOKEN_RBRACKET) {
+		p.nextToken()
+		slice.End = p.parseExpression(LOWEST)
+	}
 	if !p.expectPeek(lexer.TOKEN_RBRACKET) {
 		return nil
 	}
-
-	return exp
+	return slice
 }
 
 func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
@@ -638,7 +798,7 @@ func (p *Parser) parseMemberExpression(left ast.Expression) ast.Expression {
 // ============================================================================
 
 // Parse parses the input string and returns the AST.
-func Parse(input string) (ast.Expression, error) {
-	p := New(input)
+func Parse(input string, opts ...Option) (ast.Expression, error) {
+	p := New(input, opts...)
 	return p.Parse()
 }
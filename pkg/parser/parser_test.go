@@ -2,8 +2,11 @@
 package parser
 
 import (
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/bencagri/amel/internal/errors"
 	"github.com/bencagri/amel/pkg/ast"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -58,6 +61,32 @@ func TestParseFloatLiteral(t *testing.T) {
 	}
 }
 
+func TestParseDurationLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"5m", 5 * time.Minute},
+		{"2h30m", 150 * time.Minute},
+		{"1.5h", 90 * time.Minute},
+		{"250ms", 250 * time.Millisecond},
+		{"7d", 7 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := Parse(tt.input)
+			require.NoError(t, err)
+			require.NotNil(t, expr)
+
+			lit, ok := expr.(*ast.DurationLiteral)
+			require.True(t, ok, "expected DurationLiteral, got %T", expr)
+			assert.Equal(t, tt.expected, lit.Value)
+			assert.Equal(t, tt.input, lit.String())
+		})
+	}
+}
+
 func TestParseStringLiteral(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -144,6 +173,38 @@ func TestParseListLiteral(t *testing.T) {
 	}
 }
 
+func TestParseMapLiteral(t *testing.T) {
+	tests := []struct {
+		input string
+		keys  []string
+	}{
+		{"{}", []string{}},
+		{`{"a": 1}`, []string{"a"}},
+		{`{"name": $.name, "adult": $.age >= 18}`, []string{"name", "adult"}},
+		{`{'b': [1, 2], "a": {"c": null}}`, []string{"b", "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := Parse(tt.input)
+			require.NoError(t, err)
+			require.NotNil(t, expr)
+
+			m, ok := expr.(*ast.MapLiteral)
+			require.True(t, ok, "expected MapLiteral, got %T", expr)
+			assert.Equal(t, tt.keys, m.Keys)
+			assert.Len(t, m.Values, len(tt.keys))
+		})
+	}
+
+	for _, input := range []string{`{"a": 1, "a": 2}`, `{a: 1}`, `{"a" 1}`, `{"a": 1,}`, `{"a": 1`} {
+		_, err := Parse(input)
+		assert.Error(t, err, input)
+	}
+	_, err := Parse(`{"a": 1, "a": 2}`)
+	assert.ErrorContains(t, err, `duplicate key "a"`)
+}
+
 func TestParsePrefixExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -179,6 +240,7 @@ func TestParseInfixExpressions(t *testing.T) {
 		{"5 * 5", int64(5), "*", int64(5)},
 		{"5 / 5", int64(5), "/", int64(5)},
 		{"5 % 3", int64(5), "%", int64(3)},
+		{"5 ~/ 3", int64(5), "~/", int64(3)},
 		{"5 > 5", int64(5), ">", int64(5)},
 		{"5 < 5", int64(5), "<", int64(5)},
 		{"5 == 5", int64(5), "==", int64(5)},
@@ -263,6 +325,7 @@ func TestParseOperatorPrecedence(t *testing.T) {
 		{"1 + 2 * 3", "(1 + (2 * 3))"},
 		{"1 * 2 + 3", "((1 * 2) + 3)"},
 		{"1 * 2 * 3", "((1 * 2) * 3)"},
+		{"1 + 7 ~/ 2 * 3", "(1 + ((7 ~/ 2) * 3))"},
 		{"-1 * 2", "((-1) * 2)"},
 		{"!true == false", "((!true) == false)"},
 		{"1 + 2 == 3", "((1 + 2) == 3)"},
@@ -270,6 +333,14 @@ func TestParseOperatorPrecedence(t *testing.T) {
 		{"a || b && c", "(a || (b && c))"},
 		{"1 > 2 == false", "((1 > 2) == false)"},
 		{"1 < 2 && 3 > 4", "((1 < 2) && (3 > 4))"},
+		{"a || b ? 1 + 2 : 3", "((a || b) ? (1 + 2) : 3)"},
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+		{"a ? b ? c : d : e", "(a ? (b ? c : d) : e)"},
+		{"x => x > 0 ? x : -x", "x => ((x > 0) ? x : (-x))"},
+		{"case { a => 1 + 2 }", "case { a => (1 + 2) }"},
+		{"case { a || b => 1; c => 2; else => 3 }", "case { (a || b) => 1; c => 2; else => 3 }"},
+		{"case { a => b ? 1 : 2; else => x => x; }", "case { a => (b ? 1 : 2); else => x => x }"},
+		{"1 + case { a => 1; else => 2 } * 3", "(1 + (case { a => 1; else => 2 } * 3))"},
 	}
 
 	for _, tt := range tests {
@@ -451,6 +522,37 @@ func TestParseIndexExpression(t *testing.T) {
 	assert.Equal(t, int64(0), index.Value)
 }
 
+func TestParseSliceExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"list[1:3]", "(list[1:3])"},
+		{"list[:3]", "(list[:3])"},
+		{"list[1:]", "(list[1:])"},
+		{"list[:]", "(list[:])"},
+		{"$.code[0:3]", "($.code[0:3])"},
+		{"$.code[-2:]", "($.code[(-2):])"},
+		{"$.code[-1]", "($.code[(-1)])"},
+		{"$.items[i + 1]", "($.items[(i + 1)])"},
+		{"$.items[0].code[1]", "$.items[0].code[1]"},
+		{`$.codes["a"][:2]`, `($.codes["a"][:2])`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			expr, err := Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, expr.String())
+		})
+	}
+
+	for _, input := range []string{"list[1:", "list[1:2:3]", "$.code[0:"} {
+		_, err := Parse(input)
+		assert.Error(t, err, input)
+	}
+}
+
 func TestParseMemberExpression(t *testing.T) {
 	input := "obj.property"
 	expr, err := Parse(input)
@@ -471,13 +573,19 @@ func TestParseErrors(t *testing.T) {
 		input       string
 		expectError bool
 	}{
-		{"(5", true},        // Missing closing paren
-		{"5 +", true},       // Missing operand
-		{"[1, 2,", true},    // Incomplete list
-		{"func(", true},     // Incomplete function call
-		{"", true},          // Empty input
-		{"@ invalid", true}, // Invalid character
-		{"5 5", true},       // Two expressions without operator
+		{"(5", true},                         // Missing closing paren
+		{"5 +", true},                        // Missing operand
+		{"[1, 2,", true},                     // Incomplete list
+		{"func(", true},                      // Incomplete function call
+		{"", true},                           // Empty input
+		{"@ invalid", true},                  // Invalid character
+		{"5 5", true},                        // Two expressions without operator
+		{"a ? b", true},                      // Missing alternative
+		{"a ? : b", true},                    // Missing consequence
+		{"case { }", true},                   // No arms
+		{"case { a 1 }", true},               // Missing =>
+		{"case { a => 1 b => 2 }", true},     // Missing ;
+		{"case { else => 1; a => 2 }", true}, // else before an arm
 	}
 
 	for _, tt := range tests {
@@ -491,6 +599,27 @@ func TestParseErrors(t *testing.T) {
 	}
 }
 
+func TestParseMaxDepth(t *testing.T) {
+	nested := func(n int) string {
+		return strings.Repeat("(", n) + "1" + strings.Repeat(")", n)
+	}
+
+	_, err := Parse(nested(100))
+	require.NoError(t, err)
+
+	// Deep enough to exhaust the stack without the limit
+	_, err = Parse(nested(DefaultMaxDepth * 100))
+	require.Error(t, err)
+	assert.True(t, errors.IsCode(err, errors.ErrDepthLimit), err.Error())
+
+	_, err = Parse("!!!!!!true", WithMaxDepth(5))
+	assert.True(t, errors.IsCode(err, errors.ErrDepthLimit))
+	_, err = Parse("1 + 2 + 3 + 4 + 5 + 6", WithMaxDepth(5))
+	assert.True(t, errors.IsCode(err, errors.ErrDepthLimit), "operator chains nest too")
+	_, err = Parse(nested(2000), WithMaxDepth(0))
+	assert.NoError(t, err)
+}
+
 func TestParseASTString(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -560,3 +689,16 @@ func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) {
 	require.True(t, ok, "expected BooleanLiteral, got %T", exp)
 	assert.Equal(t, value, lit.Value)
 }
+
+func TestExtractPathsAndFunctions(t *testing.T) {
+	expr, err := Parse(`$.age >= 18 && upper($.name) =~ "^J" && any($.orders, o => o.total > len($.name)) || coalesce($.tier, lower($.users[0].name)) == "gold"`)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"$.age", "$.name", "$.orders", "$.tier", "$.users[0].name"}, ast.ExtractPaths(expr))
+	assert.Equal(t, []string{"any", "coalesce", "len", "lower", "upper"}, ast.ExtractFunctions(expr))
+
+	expr, err = Parse(`1 + 2`)
+	require.NoError(t, err)
+	assert.Empty(t, ast.ExtractPaths(expr))
+	assert.Empty(t, ast.ExtractFunctions(expr))
+}
@@ -0,0 +1,104 @@
+// Package rulefile loads AMEL rule definitions from JSON and YAML files.
+package rulefile
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bencagri/amel/pkg/engine"
+)
+
+// Loader keeps a compiled rule set in sync with the rule files of a file system.
+//
+// Reloads are atomic: a new rule set is built completely before it replaces the
+// current one, and a reload that fails leaves the current rule set in place.
+// Evaluations that already obtained a rule set keep using it until they finish.
+type Loader struct {
+	engine  *engine.Engine
+	fsys    fs.FS
+	options []engine.RuleSetOption
+
+	mu      sync.Mutex // Serializes reloads
+	current atomic.Pointer[engine.RuleSet]
+	version atomic.Uint64
+}
+
+// LoaderOption is a function that configures a Loader.
+type LoaderOption func(*Loader)
+
+// WithRuleSetOptions sets the options used for every rule set the loader builds.
+func WithRuleSetOptions(opts ...engine.RuleSetOption) LoaderOption {
+	return func(l *Loader) {
+		l.options = opts
+	}
+}
+
+// NewLoader creates a loader for the rule files in fsys and performs the initial load.
+// Use os.DirFS to load rules from a directory on disk.
+func NewLoader(eng *engine.Engine, fsys fs.FS, opts ...LoaderOption) (*Loader, error) {
+	l := &Loader{
+		engine: eng,
+		fsys:   fsys,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// RuleSet returns the current rule set.
+func (l *Loader) RuleSet() *engine.RuleSet {
+	return l.current.Load()
+}
+
+// Version returns the number of successful loads, starting at 1 after NewLoader.
+func (l *Loader) Version() uint64 {
+	return l.version.Load()
+}
+
+// Reload reads, validates, and compiles the rule files and swaps in the new rule set.
+func (l *Loader) Reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	defs, err := Load(l.fsys)
+	if err != nil {
+		return err
+	}
+	rs, err := Build(l.engine, defs, l.options...)
+	if err != nil {
+		return err
+	}
+
+	l.current.Store(rs)
+	l.version.Add(1)
+	return nil
+}
+
+// Watch reloads the rule files each time a change notification is received, until
+// ctx is done or changes is closed. Reload errors are passed to onError, if set, and
+// the previous rule set stays active.
+//
+// Notifications typically come from a file watcher or a SIGHUP handler.
+func (l *Loader) Watch(ctx context.Context, changes <-chan struct{}, onError func(error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+			if err := l.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
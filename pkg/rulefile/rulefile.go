@@ -0,0 +1,177 @@
+// Package rulefile loads AMEL rule definitions from JSON and YAML files.
+package rulefile
+
+import (
+	"encoding/json"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies the encoding of a rule file.
+type Format int
+
+const (
+	FormatJSON Format = iota
+	FormatYAML
+)
+
+// Definition describes a single rule as written in a rule file.
+type Definition struct {
+	Name        string   `json:"name" yaml:"name"`
+	Expression  string   `json:"expression" yaml:"expression"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Owner       string   `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Priority    int      `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Output      string   `json:"output,omitempty" yaml:"output,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty" yaml:"enabled,omitempty"` // Defaults to true
+
+	// Action is the payload returned when the rule fires: any scalar, list,
+	// or map the file can hold.
+	Action interface{} `json:"action,omitempty" yaml:"action,omitempty"`
+
+	Source string `json:"-" yaml:"-"` // File the definition was read from
+}
+
+// File is the top-level structure of a rule file.
+//
+//	rules:
+//	  - name: highRisk
+//	    expression: $.score > 70
+//	    tags: [fraud]
+//	    priority: 10
+//	    action: {decision: review}
+type File struct {
+	Rules []Definition `json:"rules" yaml:"rules"`
+}
+
+// FormatFromPath determines the file format from its extension.
+func FormatFromPath(name string) (Format, bool) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		return FormatJSON, true
+	case ".yaml", ".yml":
+		return FormatYAML, true
+	default:
+		return FormatJSON, false
+	}
+}
+
+// Parse decodes rule definitions from data in the given format.
+func Parse(data []byte, format Format) ([]Definition, error) {
+	var f File
+	var err error
+	switch format {
+	case FormatYAML:
+		err = yaml.Unmarshal(data, &f)
+	default:
+		err = json.Unmarshal(data, &f)
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "failed to parse rule file", err)
+	}
+	return f.Rules, nil
+}
+
+// Load reads rule definitions from every JSON and YAML file in fsys, in lexical
+// order. Files with other extensions are ignored.
+func Load(fsys fs.FS) ([]Definition, error) {
+	var defs []Definition
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		format, ok := FormatFromPath(name)
+		if !ok {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		fileDefs, err := Parse(data, format)
+		if err != nil {
+			return errors.Wrap(errors.ErrInvalidSyntax, name+": "+err.Error(), err)
+		}
+		for i := range fileDefs {
+			fileDefs[i].Source = name
+		}
+		defs = append(defs, fileDefs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// Validate checks that every definition has a unique name and an expression.
+func Validate(defs []Definition) error {
+	seen := make(map[string]string)
+	for _, def := range defs {
+		if def.Name == "" {
+			return errors.Newf(errors.ErrInvalidSyntax, "%srule without a name", sourcePrefix(def))
+		}
+		if strings.TrimSpace(def.Expression) == "" {
+			return errors.Newf(errors.ErrMissingExpression, "%srule '%s' has no expression", sourcePrefix(def), def.Name)
+		}
+		if other, exists := seen[def.Name]; exists {
+			return errors.Newf(errors.ErrInvalidSyntax, "%srule '%s' is already defined in %s", sourcePrefix(def), def.Name, other)
+		}
+		seen[def.Name] = def.Source
+	}
+	return nil
+}
+
+// Build validates the definitions and compiles them into a new rule set.
+func Build(eng *engine.Engine, defs []Definition, opts ...engine.RuleSetOption) (*engine.RuleSet, error) {
+	if err := Validate(defs); err != nil {
+		return nil, err
+	}
+
+	rs := eng.NewRuleSet(opts...)
+	for _, def := range defs {
+		if err := rs.Add(def.Name, def.Expression, def.options()...); err != nil {
+			return nil, errors.Wrap(errors.ErrInvalidSyntax,
+				sourcePrefix(def)+"rule '"+def.Name+"': "+err.Error(), err)
+		}
+	}
+	return rs, nil
+}
+
+// options converts the definition's metadata into rule options.
+func (def Definition) options() []engine.RuleOption {
+	opts := []engine.RuleOption{
+		engine.WithPriority(def.Priority),
+		engine.WithDescription(def.Description),
+		engine.WithOwner(def.Owner),
+		engine.WithTags(def.Tags...),
+	}
+	if def.Output != "" {
+		opts = append(opts, engine.WithOutput(def.Output))
+	}
+	if def.Enabled != nil {
+		opts = append(opts, engine.WithEnabled(*def.Enabled))
+	}
+	if def.Action != nil {
+		opts = append(opts, engine.WithAction(def.Action))
+	}
+	return opts
+}
+
+// sourcePrefix returns "file: " for definitions read from a file.
+func sourcePrefix(def Definition) string {
+	if def.Source == "" {
+		return ""
+	}
+	return def.Source + ": "
+}
@@ -0,0 +1,191 @@
+package rulefile
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fraudYAML = `
+rules:
+  - name: velocity
+    expression: $.txPerHour > 10
+    description: Too many transactions
+    owner: risk-team
+    tags: [fraud]
+    priority: 5
+    action:
+      decision: review
+      queue: fraud
+  - name: legacy
+    expression: "true"
+    enabled: false
+`
+
+const pricingJSON = `{
+	"rules": [
+		{"name": "discount", "expression": "$.total > 100", "tags": ["pricing"], "priority": 1, "action": "discount10"}
+	]
+}`
+
+func newTestEngine(t *testing.T) *engine.Engine {
+	t.Helper()
+
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return eng
+}
+
+func TestParse(t *testing.T) {
+	defs, err := Parse([]byte(fraudYAML), FormatYAML)
+	require.NoError(t, err)
+	require.Len(t, defs, 2)
+	assert.Equal(t, "velocity", defs[0].Name)
+	assert.Equal(t, "$.txPerHour > 10", defs[0].Expression)
+	assert.Equal(t, []string{"fraud"}, defs[0].Tags)
+	assert.Equal(t, 5, defs[0].Priority)
+	require.NotNil(t, defs[1].Enabled)
+	assert.False(t, *defs[1].Enabled)
+
+	assert.Equal(t, map[string]interface{}{"decision": "review", "queue": "fraud"}, defs[0].Action)
+	assert.Nil(t, defs[1].Action)
+
+	defs, err = Parse([]byte(pricingJSON), FormatJSON)
+	require.NoError(t, err)
+	require.Len(t, defs, 1)
+	assert.Equal(t, "discount10", defs[0].Action)
+
+	_, err = Parse([]byte("{not json"), FormatJSON)
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"fraud.yaml":        {Data: []byte(fraudYAML)},
+		"pricing/main.json": {Data: []byte(pricingJSON)},
+		"README.md":         {Data: []byte("# ignored")},
+	}
+
+	defs, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, defs, 3)
+	assert.Equal(t, "fraud.yaml", defs[0].Source)
+	assert.Equal(t, "pricing/main.json", defs[2].Source)
+}
+
+func TestBuild(t *testing.T) {
+	eng := newTestEngine(t)
+
+	defs, err := Parse([]byte(fraudYAML), FormatYAML)
+	require.NoError(t, err)
+
+	rs, err := Build(eng, defs)
+	require.NoError(t, err)
+
+	rule, ok := rs.Get("velocity")
+	require.True(t, ok)
+	assert.Equal(t, "risk-team", rule.Owner)
+	assert.Equal(t, map[string]interface{}{"decision": "review", "queue": "fraud"}, rule.Action)
+	legacy, _ := rs.Get("legacy")
+	assert.True(t, legacy.Disabled)
+
+	result, err := rs.Fire(map[string]interface{}{"txPerHour": 20})
+	require.NoError(t, err)
+	require.Len(t, result.Fired, 1)
+	assert.Equal(t, rule.Action, result.Fired[0].Action)
+
+	tests := []struct {
+		name string
+		defs []Definition
+	}{
+		{"missing name", []Definition{{Expression: "true"}}},
+		{"missing expression", []Definition{{Name: "a"}}},
+		{"duplicate name", []Definition{{Name: "a", Expression: "true"}, {Name: "a", Expression: "false"}}},
+		{"invalid expression", []Definition{{Name: "a", Expression: "(1 +"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Build(eng, tt.defs)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoader_Reload(t *testing.T) {
+	eng := newTestEngine(t)
+	fsys := fstest.MapFS{
+		"rules.json": {Data: []byte(pricingJSON)},
+	}
+
+	loader, err := NewLoader(eng, fsys, WithRuleSetOptions(engine.WithConflictPolicy(engine.PolicyAllMatches)))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), loader.Version())
+
+	old := loader.RuleSet()
+	assert.Equal(t, []string{"discount"}, old.Names())
+	assert.Equal(t, engine.PolicyAllMatches, old.Policy())
+
+	t.Run("successful reload swaps the rule set", func(t *testing.T) {
+		fsys["fraud.yaml"] = &fstest.MapFile{Data: []byte(fraudYAML)}
+		require.NoError(t, loader.Reload())
+
+		assert.Equal(t, uint64(2), loader.Version())
+		assert.Equal(t, []string{"velocity", "legacy", "discount"}, loader.RuleSet().Names())
+		// Holders of the previous rule set are unaffected
+		assert.Equal(t, []string{"discount"}, old.Names())
+	})
+
+	t.Run("failed reload keeps the current rule set", func(t *testing.T) {
+		fsys["broken.json"] = &fstest.MapFile{Data: []byte(`{"rules": [{"name": "broken", "expression": "(1 +"}]}`)}
+		defer delete(fsys, "broken.json")
+
+		current := loader.RuleSet()
+		assert.Error(t, loader.Reload())
+		assert.Same(t, current, loader.RuleSet())
+		assert.Equal(t, uint64(2), loader.Version())
+	})
+}
+
+func TestLoader_Watch(t *testing.T) {
+	eng := newTestEngine(t)
+	fsys := fstest.MapFS{
+		"rules.json": {Data: []byte(pricingJSON)},
+	}
+
+	loader, err := NewLoader(eng, fsys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{})
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		loader.Watch(ctx, changes, func(err error) { errs <- err })
+		close(done)
+	}()
+
+	fsys["fraud.yaml"] = &fstest.MapFile{Data: []byte(fraudYAML)}
+	changes <- struct{}{}
+
+	require.Eventually(t, func() bool { return loader.Version() == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 3, loader.RuleSet().Len())
+
+	fsys["broken.yaml"] = &fstest.MapFile{Data: []byte("rules: [{name: x}]")}
+	changes <- struct{}{}
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("expected reload error")
+	}
+
+	close(changes)
+	<-done
+}
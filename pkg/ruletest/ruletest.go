@@ -0,0 +1,159 @@
+// Package ruletest runs regression suites for AMEL rules.
+//
+// A suite names the expression or catalog rule under test and lists cases,
+// each with a payload and the expected result, error, or explanation steps:
+//
+//	tests:
+//	  - name: adults
+//	    expression: $.age >= 18 && $.country IN ["DE", "FR"]
+//	    cases:
+//	      - name: adult in Germany
+//	        payload: {age: 30, country: DE}
+//	        expect: true
+//	      - name: minor
+//	        payload: {age: 12, country: DE}
+//	        expect: false
+//	        explain: ["$.age => 12"]
+//	      - name: age is not a number
+//	        payload: {age: "x", country: DE}
+//	        error: TypeMismatch
+//	  - name: velocity rule
+//	    rule: velocity
+//	    cases:
+//	      - payload: {txPerHour: 11}
+//	        expect: true
+//
+// Suites are written in JSON or YAML files like rule files, and run with a
+// Runner or the "amel test" command.
+package ruletest
+
+import (
+	"encoding/json"
+	"io/fs"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/rulefile"
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a set of cases for one expression or catalog rule.
+type Suite struct {
+	Name       string `json:"name" yaml:"name"`
+	Expression string `json:"expression,omitempty" yaml:"expression,omitempty"`
+	Rule       string `json:"rule,omitempty" yaml:"rule,omitempty"` // Name of a catalog rule, used if Expression is empty
+	Cases      []Case `json:"cases" yaml:"cases"`
+
+	Source string `json:"-" yaml:"-"` // File the suite was read from
+}
+
+// Case is a payload and the expected outcome of evaluating it.
+type Case struct {
+	Name    string      `json:"name,omitempty" yaml:"name,omitempty"`
+	Payload interface{} `json:"payload" yaml:"payload"`
+
+	// Expect is the expected result. It is checked if it is non-nil or if
+	// ExpectSet is true, so that files can expect null.
+	Expect    interface{} `json:"expect,omitempty" yaml:"expect,omitempty"`
+	ExpectSet bool        `json:"-" yaml:"-"` // Set by Parse when the case has an expect key
+
+	// Error is the expected error code name, such as "TypeMismatch", or a
+	// part of the expected error message. If empty, the evaluation must
+	// succeed.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+
+	// Explain lists steps that must appear in the explanation of the
+	// evaluation, written as "<expression> => <JSON result>". A step matches
+	// if it contains the text.
+	Explain []string `json:"explain,omitempty" yaml:"explain,omitempty"`
+}
+
+// plainCase has the fields of Case without its decoding methods.
+type plainCase Case
+
+// UnmarshalJSON decodes a case, recording whether it has an expect key.
+func (c *Case) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*plainCase)(c)); err != nil {
+		return err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	_, c.ExpectSet = keys["expect"]
+	return nil
+}
+
+// UnmarshalYAML decodes a case, recording whether it has an expect key.
+func (c *Case) UnmarshalYAML(node *yaml.Node) error {
+	if err := node.Decode((*plainCase)(c)); err != nil {
+		return err
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "expect" {
+			c.ExpectSet = true
+		}
+	}
+	return nil
+}
+
+// checksResult reports whether the case expects a result.
+func (c *Case) checksResult() bool {
+	return c.ExpectSet || c.Expect != nil
+}
+
+// File is the top-level structure of a test file.
+type File struct {
+	Tests []Suite `json:"tests" yaml:"tests"`
+}
+
+// Parse decodes test suites from data in the given format.
+func Parse(data []byte, format rulefile.Format) ([]Suite, error) {
+	var f File
+	var err error
+	switch format {
+	case rulefile.FormatYAML:
+		err = yaml.Unmarshal(data, &f)
+	default:
+		err = json.Unmarshal(data, &f)
+	}
+	if err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "failed to parse test file", err)
+	}
+	return f.Tests, nil
+}
+
+// Load reads test suites from every JSON and YAML file in fsys, in lexical
+// order. Files with other extensions are ignored.
+func Load(fsys fs.FS) ([]Suite, error) {
+	var suites []Suite
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		format, ok := rulefile.FormatFromPath(name)
+		if !ok {
+			return nil
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		fileSuites, err := Parse(data, format)
+		if err != nil {
+			return errors.Wrap(errors.ErrInvalidSyntax, name+": "+err.Error(), err)
+		}
+		for i := range fileSuites {
+			fileSuites[i].Source = name
+		}
+		suites = append(suites, fileSuites...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return suites, nil
+}
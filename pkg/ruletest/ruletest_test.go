@@ -0,0 +1,116 @@
+package ruletest
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/bencagri/amel/pkg/rulefile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const adultsYAML = `
+tests:
+  - name: adults
+    expression: $.age >= 18 && $.country IN ["DE", "FR"]
+    cases:
+      - name: adult in Germany
+        payload: {age: 30, country: DE}
+        expect: true
+      - name: minor
+        payload: {age: 12, country: DE}
+        expect: false
+        explain: ["$.age => 12"]
+      - name: age is not a number
+        payload: {age: "x", country: DE}
+        error: TypeMismatch
+      - payload: {age: 40, country: US}
+`
+
+const totalsJSON = `{
+	"tests": [
+		{"name": "totals", "expression": "$.order.total", "cases": [
+			{"name": "present", "payload": {"order": {"total": 3}}, "expect": 3.0},
+			{"name": "missing", "payload": {"order": {}}, "expect": null}
+		]}
+	]
+}`
+
+func newTestEngine(t *testing.T) *engine.Engine {
+	t.Helper()
+
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return eng
+}
+
+func TestParse(t *testing.T) {
+	suites, err := Parse([]byte(adultsYAML), rulefile.FormatYAML)
+	require.NoError(t, err)
+	require.Len(t, suites, 1)
+	require.Len(t, suites[0].Cases, 4)
+	assert.True(t, suites[0].Cases[0].ExpectSet)
+	assert.Equal(t, []string{"$.age => 12"}, suites[0].Cases[1].Explain)
+	assert.False(t, suites[0].Cases[3].ExpectSet)
+
+	suites, err = Parse([]byte(totalsJSON), rulefile.FormatJSON)
+	require.NoError(t, err)
+	assert.True(t, suites[0].Cases[1].ExpectSet, "expect: null is an expectation")
+	assert.Nil(t, suites[0].Cases[1].Expect)
+
+	_, err = Parse([]byte("tests: [oops"), rulefile.FormatYAML)
+	assert.Error(t, err)
+}
+
+func TestRunner(t *testing.T) {
+	fsys := fstest.MapFS{
+		"adults.yaml": {Data: []byte(adultsYAML)},
+		"totals.json": {Data: []byte(totalsJSON)},
+		"README.md":   {Data: []byte("ignored")},
+	}
+	suites, err := Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, suites, 2)
+	assert.Equal(t, "adults.yaml", suites[0].Source)
+
+	report := NewRunner(newTestEngine(t)).Run(suites...)
+	assert.True(t, report.OK(), "failures: %+v", report.Failures())
+	assert.Equal(t, 6, report.Passed)
+	assert.Equal(t, "#4", report.Results[3].Case)
+
+	t.Run("failures", func(t *testing.T) {
+		report := NewRunner(newTestEngine(t)).Run(Suite{
+			Name:       "wrong",
+			Expression: "$.n * 2",
+			Cases: []Case{
+				{Name: "value", Payload: map[string]interface{}{"n": 2}, Expect: 5},
+				{Name: "error", Payload: map[string]interface{}{"n": 2}, Error: "DivisionByZero"},
+				{Name: "explain", Payload: map[string]interface{}{"n": 2}, Explain: []string{"$.n => 3"}},
+				{Name: "unexpected error", Payload: map[string]interface{}{"n": "x"}},
+			},
+		})
+		assert.Equal(t, 4, report.Failed)
+		failures := report.Failures()
+		assert.Equal(t, "expected 5, got 4", failures[0].Failure)
+		assert.Equal(t, `expected error "DivisionByZero", got result 4`, failures[1].Failure)
+		assert.Equal(t, `explanation has no step "$.n => 3"`, failures[2].Failure)
+		assert.Contains(t, failures[3].Failure, "unexpected error")
+	})
+
+	t.Run("catalog rules", func(t *testing.T) {
+		eng := newTestEngine(t)
+		rs, err := rulefile.Build(eng, []rulefile.Definition{{Name: "velocity", Expression: "$.txPerHour > 10"}})
+		require.NoError(t, err)
+
+		report := NewRunner(eng, WithRules(rs)).Run(
+			Suite{Name: "velocity", Rule: "velocity", Cases: []Case{
+				{Payload: map[string]interface{}{"txPerHour": 11}, Expect: true},
+			}},
+			Suite{Name: "missing", Rule: "nope", Cases: []Case{{Expect: true}}},
+		)
+		assert.Equal(t, 1, report.Passed)
+		require.Len(t, report.Failures(), 1)
+		assert.Contains(t, report.Failures()[0].Failure, "rule 'nope' does not exist")
+	})
+}
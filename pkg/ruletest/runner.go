@@ -0,0 +1,207 @@
+// Package ruletest runs regression suites for AMEL rules.
+package ruletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Runner runs test suites against an engine.
+type Runner struct {
+	engine *engine.Engine
+	rules  *engine.RuleSet
+}
+
+// Option is a function that configures a Runner.
+type Option func(*Runner)
+
+// WithRules sets the catalog in which suites with a rule name find their rule.
+// By default the catalog of the engine is used.
+func WithRules(rs *engine.RuleSet) Option {
+	return func(r *Runner) {
+		r.rules = rs
+	}
+}
+
+// NewRunner creates a runner evaluating suites with eng.
+func NewRunner(eng *engine.Engine, opts ...Option) *Runner {
+	r := &Runner{engine: eng, rules: eng.Rules()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// CaseResult is the outcome of one case.
+type CaseResult struct {
+	Suite   string      `json:"suite"`
+	Case    string      `json:"case"` // The case name, or "#<n>" counting from 1
+	Source  string      `json:"source,omitempty"`
+	Passed  bool        `json:"passed"`
+	Failure string      `json:"failure,omitempty"` // Why the case failed
+	Result  interface{} `json:"result"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// Report is the outcome of a test run.
+type Report struct {
+	Passed  int           `json:"passed"`
+	Failed  int           `json:"failed"`
+	Results []*CaseResult `json:"results"`
+}
+
+// OK reports whether every case passed.
+func (r *Report) OK() bool {
+	return r.Failed == 0
+}
+
+// Failures returns the results of the failed cases.
+func (r *Report) Failures() []*CaseResult {
+	var failures []*CaseResult
+	for _, result := range r.Results {
+		if !result.Passed {
+			failures = append(failures, result)
+		}
+	}
+	return failures
+}
+
+// Run runs every case of the suites. A suite whose expression does not
+// compile or whose rule does not exist fails all its cases, unless they
+// expect that error.
+func (r *Runner) Run(suites ...Suite) *Report {
+	report := &Report{Results: []*CaseResult{}}
+	for _, suite := range suites {
+		compiled, err := r.compile(suite)
+		for i, c := range suite.Cases {
+			name := c.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			result := &CaseResult{Suite: suite.Name, Case: name, Source: suite.Source}
+			if err != nil {
+				result.Error = err.Error()
+				result.Failure = checkError(c, err)
+			} else {
+				result.Failure = r.runCase(compiled, c, result)
+			}
+			result.Passed = result.Failure == ""
+			if result.Passed {
+				report.Passed++
+			} else {
+				report.Failed++
+			}
+			report.Results = append(report.Results, result)
+		}
+	}
+	return report
+}
+
+// compile returns the expression under test of a suite.
+func (r *Runner) compile(suite Suite) (*engine.CompiledExpression, error) {
+	if suite.Expression != "" {
+		return r.engine.Compile(suite.Expression)
+	}
+	if suite.Rule == "" {
+		return nil, errors.Newf(errors.ErrMissingExpression, "suite '%s' has no expression or rule", suite.Name)
+	}
+	rule, ok := r.rules.Get(suite.Rule)
+	if !ok {
+		return nil, errors.Newf(errors.ErrInvalidSyntax, "rule '%s' does not exist", suite.Rule)
+	}
+	return rule.Compiled, nil
+}
+
+// runCase evaluates a case and returns why it failed, or "".
+func (r *Runner) runCase(compiled *engine.CompiledExpression, c Case, result *CaseResult) string {
+	var value types.Value
+	var explanation *eval.Explanation
+	var err error
+	if len(c.Explain) > 0 {
+		value, explanation, err = r.engine.EvaluateWithExplanation(compiled, c.Payload)
+	} else {
+		value, err = r.engine.Evaluate(compiled, c.Payload)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return checkError(c, err)
+	}
+	result.Result = value.Raw
+
+	if c.Error != "" {
+		return fmt.Sprintf("expected error %q, got result %s", c.Error, encode(value.Raw))
+	}
+	if c.checksResult() && !sameJSON(value.Raw, c.Expect) {
+		return fmt.Sprintf("expected %s, got %s", encode(c.Expect), encode(value.Raw))
+	}
+	if len(c.Explain) > 0 {
+		steps := explanationSteps(explanation, nil)
+		for _, want := range c.Explain {
+			if !containsStep(steps, want) {
+				return fmt.Sprintf("explanation has no step %q", want)
+			}
+		}
+	}
+	return ""
+}
+
+// checkError returns why an error fails a case, or "" if the case expects it.
+func checkError(c Case, err error) string {
+	if c.Error == "" {
+		return "unexpected error: " + err.Error()
+	}
+	if e, ok := err.(*errors.Error); ok && e.Code.String() == c.Error {
+		return ""
+	}
+	if strings.Contains(err.Error(), c.Error) {
+		return ""
+	}
+	return fmt.Sprintf("expected error %q, got: %v", c.Error, err)
+}
+
+// sameJSON reports whether two values have the same JSON representation, so
+// that numbers decoded from test files compare equal to evaluation results.
+func sameJSON(a, b interface{}) bool {
+	var x, y interface{}
+	if json.Unmarshal([]byte(encode(a)), &x) != nil || json.Unmarshal([]byte(encode(b)), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func encode(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// explanationSteps flattens an explanation tree into "<expression> =>
+// <result>" lines.
+func explanationSteps(exp *eval.Explanation, steps []string) []string {
+	if exp == nil {
+		return steps
+	}
+	steps = append(steps, exp.Expression+" => "+encode(exp.Result.Raw))
+	for _, child := range exp.Children {
+		steps = explanationSteps(child, steps)
+	}
+	return steps
+}
+
+func containsStep(steps []string, want string) bool {
+	for _, step := range steps {
+		if strings.Contains(step, want) {
+			return true
+		}
+	}
+	return false
+}
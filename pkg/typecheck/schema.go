@@ -0,0 +1,140 @@
+// Package typecheck infers the types of AMEL expressions and reports type
+// errors without evaluating them.
+package typecheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Schema is the subset of JSON Schema used for type checking: "type",
+// "properties", "items", "additionalProperties", "required", and "enum".
+// Other keywords are ignored.
+type Schema struct {
+	Type                 Types              `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+}
+
+// ParseSchema parses a JSON Schema.
+func ParseSchema(data []byte) (*Schema, error) {
+	s := &Schema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, errors.Wrap(errors.ErrInvalidSyntax, "invalid payload schema", err)
+	}
+	return s, nil
+}
+
+// Types is the "type" of a schema. It accepts both "type": "string" and
+// "type": ["string", "null"].
+type Types []string
+
+// MarshalJSON writes a single type as a string.
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON reads a type or a list of types.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("schema type must be a string or an array of strings")
+	}
+	*t = multiple
+	return nil
+}
+
+// ValueType returns the AMEL type of values described by the schema. Null is
+// ignored in type unions; unions of several other types give TypeAny.
+func (s *Schema) ValueType() types.Type {
+	result := types.TypeAny
+	for _, name := range s.Type {
+		var t types.Type
+		switch name {
+		case "integer":
+			t = types.TypeInt
+		case "number":
+			t = types.TypeFloat
+		case "string":
+			t = types.TypeString
+		case "boolean":
+			t = types.TypeBool
+		case "array":
+			t = types.TypeList
+		case "object":
+			t = types.TypeMap
+		case "null":
+			continue
+		default:
+			return types.TypeAny
+		}
+		if result != types.TypeAny && result != t {
+			if result.IsNumeric() && t.IsNumeric() {
+				result = types.TypeFloat
+				continue
+			}
+			return types.TypeAny
+		}
+		result = t
+	}
+	return result
+}
+
+// Closed reports whether the schema forbids properties it does not list.
+func (s *Schema) Closed() bool {
+	return strings.TrimSpace(string(s.AdditionalProperties)) == "false"
+}
+
+// bracketSegment matches [0], ["key"], and ['key'] path segments.
+var bracketSegment = regexp.MustCompile(`\[(\d+|"[^"]*"|'[^']*'|\*)\]`)
+
+// Lookup resolves a payload path such as $.user.tags[0] against the schema.
+// It returns nil and the unresolved segment if the schema does not define the
+// path, or nil and an empty segment if the schema cannot tell. closed reports
+// whether the object missing the segment forbids unlisted properties, in
+// which case the path cannot exist in valid payloads.
+func (s *Schema) Lookup(path string) (node *Schema, missing string, closed bool) {
+	path = strings.TrimPrefix(path, "$")
+	path = bracketSegment.ReplaceAllStringFunc(path, func(seg string) string {
+		return "." + strings.Trim(seg[1:len(seg)-1], `"'`)
+	})
+
+	node = s
+	for _, seg := range strings.Split(path, ".") {
+		if seg == "" {
+			continue
+		}
+		if node.Items != nil {
+			if _, err := strconv.Atoi(seg); err == nil || seg == "*" || seg == "#" {
+				node = node.Items
+				continue
+			}
+		}
+		child, ok := node.Properties[seg]
+		if !ok {
+			if node.Closed() || len(node.Properties) > 0 {
+				return nil, seg, node.Closed()
+			}
+			return nil, "", false
+		}
+		node = child
+	}
+	return node, "", false
+}
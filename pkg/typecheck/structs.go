@@ -0,0 +1,147 @@
+// Package typecheck infers the types of AMEL expressions and reports type
+// errors without evaluating them.
+package typecheck
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshaler     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	emptyInterfaceTyp = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// SchemaOf returns the schema of the JSON encoding of a Go value, such as a
+// struct describing the payload, or of a reflect.Type. Field names and
+// omitted fields follow the json struct tags as encoding/json does: fields
+// tagged omitempty and pointer fields are optional, and the other fields are
+// required. Pointers may be null. Types that encode themselves, other than
+// time.Time, may hold any value.
+func SchemaOf(v interface{}) *Schema {
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	if t == nil {
+		return &Schema{}
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return schemaOfType(t, map[reflect.Type]bool{})
+}
+
+// schemaOfType returns the schema of t. Types in visiting are being described
+// already; recursive references to them may hold any value.
+func schemaOfType(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	if t.Kind() == reflect.Ptr {
+		s := schemaOfType(t.Elem(), visiting)
+		if len(s.Type) > 0 {
+			s.Type = append(s.Type, "null")
+		}
+		return s
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: Types{"string"}}
+	case t == rawMessageType || t == emptyInterfaceTyp:
+		return &Schema{}
+	case t.Implements(jsonMarshaler) || reflect.PtrTo(t).Implements(jsonMarshaler):
+		return &Schema{}
+	case t.Implements(textMarshaler) || reflect.PtrTo(t).Implements(textMarshaler):
+		return &Schema{Type: Types{"string"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}} // Base64
+		}
+		return &Schema{Type: Types{"array"}, Items: schemaOfType(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: Types{"object"}}
+	case reflect.Struct:
+		if visiting[t] {
+			return &Schema{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		s := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}}
+		addFields(s, t, visiting)
+		return s
+	}
+	return &Schema{}
+}
+
+// addFields adds the properties encoding/json writes for the fields of the
+// struct type t, then for the fields of its embedded structs, which the
+// fields of t shadow.
+func addFields(s *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := s.Properties[name]; ok {
+			continue // Shadowed by a field of an enclosing struct
+		}
+		prop := schemaOfType(field.Type, visiting)
+		if strings.Contains(opts, "string") && len(prop.Type) > 0 && prop.Type[0] != "object" && prop.Type[0] != "array" {
+			prop = &Schema{Type: Types{"string"}}
+		}
+		s.Properties[name] = prop
+
+		optional := field.Type.Kind() == reflect.Ptr
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "omitempty" {
+				optional = true
+			}
+		}
+		if !optional {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	for _, ft := range embedded {
+		addFields(s, ft, visiting)
+	}
+}
@@ -0,0 +1,76 @@
+// Package typecheck infers the types of AMEL expressions and reports type
+// errors without evaluating them.
+package typecheck
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBase struct {
+	ID      string `json:"id"`
+	Comment string `json:"comment"`
+}
+
+type testOrder struct {
+	testBase
+	Comment  int               `json:"comment"`
+	Total    float64           `json:"total"`
+	Count    uint              `json:"count,omitempty"`
+	Placed   time.Time         `json:"placed"`
+	Items    []testItem        `json:"items"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Coupon   *string           `json:"coupon"`
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	Quantity int64             `json:"quantity,string"`
+	Ignored  bool              `json:"-"`
+	NoTag    bool
+	parent   *testOrder
+}
+
+type testItem struct {
+	SKU  string      `json:"sku"`
+	Next *testItem   `json:"next,omitempty"`
+	Data []byte      `json:"data"`
+	Any  interface{} `json:"any"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema := SchemaOf(&testOrder{})
+	out, err := json.Marshal(schema)
+	assert.NoError(t, err)
+
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "string"},
+			"comment": {"type": "integer"},
+			"total": {"type": "number"},
+			"count": {"type": "integer"},
+			"placed": {"type": "string"},
+			"items": {"type": "array", "items": {
+				"type": "object",
+				"properties": {
+					"sku": {"type": "string"},
+					"next": {},
+					"data": {"type": "string"},
+					"any": {}
+				},
+				"required": ["sku", "data", "any"]
+			}},
+			"labels": {"type": "object"},
+			"coupon": {"type": ["string", "null"]},
+			"raw": {},
+			"quantity": {"type": "string"},
+			"NoTag": {"type": "boolean"}
+		},
+		"required": ["comment", "total", "placed", "items", "quantity", "NoTag", "id"]
+	}`, string(out))
+
+	assert.Equal(t, schema, SchemaOf(reflect.TypeOf(testOrder{})))
+	assert.Equal(t, &Schema{}, SchemaOf(nil))
+}
@@ -0,0 +1,625 @@
+// Package typecheck infers the types of AMEL expressions and reports type
+// errors without evaluating them: operators applied to incompatible types,
+// function calls that do not match the signature of the function, and, with
+// a payload schema, payload paths the schema does not define.
+//
+// The types of payload paths come from a Schema, parsed from a JSON Schema
+// with ParseSchema or derived from a Go struct with SchemaOf. Without one,
+// paths may hold any type and only the types of literals and function results
+// are known.
+package typecheck
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/lexer"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Severity indicates how serious a finding is.
+type Severity string
+
+const (
+	// SeverityError marks a finding that makes the expression fail or
+	// misbehave when evaluated.
+	SeverityError Severity = "error"
+	// SeverityWarning marks a finding that may be intentional.
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a single finding reported by Check.
+type Diagnostic struct {
+	Severity Severity         `json:"severity"`
+	Code     errors.ErrorCode `json:"code"`
+	Message  string           `json:"message"`
+	Line     int              `json:"line,omitempty"`
+	Column   int              `json:"column,omitempty"`
+}
+
+// String formats the diagnostic as "line:column: severity: message".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+// Result is the outcome of Check.
+type Result struct {
+	// Type is the statically inferred result type, or TypeAny if it cannot
+	// be determined.
+	Type types.Type
+	// Diagnostics lists the findings in source order.
+	Diagnostics []Diagnostic
+}
+
+// Errors returns the diagnostics with SeverityError.
+func (r *Result) Errors() []Diagnostic {
+	var out []Diagnostic
+	for _, d := range r.Diagnostics {
+		if d.Severity == SeverityError {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// Option configures Check.
+type Option func(*checker)
+
+// WithSchema sets the schema of the payload, which gives the types of
+// payload paths.
+func WithSchema(s *Schema) Option {
+	return func(c *checker) {
+		c.schema = s
+	}
+}
+
+// WithFunctions sets the registry function calls are checked against. The
+// default is the registry of built-in functions.
+func WithFunctions(r *functions.Registry) Option {
+	return func(c *checker) {
+		c.functions = r
+	}
+}
+
+// WithRegexCache checks literal regex patterns against the configuration of
+// a regex cache, reporting the patterns it refuses.
+func WithRegexCache(r *functions.RegexCache) Option {
+	return func(c *checker) {
+		c.regexes = r
+	}
+}
+
+// WithTypeCoercion allows the comparisons the evaluator makes under type
+// coercion: strings with numbers and booleans.
+func WithTypeCoercion(enabled bool) Option {
+	return func(c *checker) {
+		c.coerce = enabled
+	}
+}
+
+// WithStrictTypes reports the implicit conversions refused by strict types:
+// comparisons of different types, ints mixed with floats, and conditions
+// that are not bools.
+func WithStrictTypes(enabled bool) Option {
+	return func(c *checker) {
+		c.strict = enabled
+	}
+}
+
+// WithDecimalArithmetic infers the types the evaluator computes under
+// decimal arithmetic: decimals for arithmetic on floats and for division.
+func WithDecimalArithmetic(enabled bool) Option {
+	return func(c *checker) {
+		c.decimal = enabled
+	}
+}
+
+// Check infers the type of an expression and reports its type errors.
+func Check(expr ast.Expression, opts ...Option) *Result {
+	c := &checker{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.functions == nil {
+		c.functions, _ = functions.NewDefaultRegistry()
+	}
+
+	typ := c.check(expr)
+	c.sort()
+	return &Result{Type: typ, Diagnostics: c.diagnostics}
+}
+
+// checker walks an expression, inferring types and collecting diagnostics.
+type checker struct {
+	functions   *functions.Registry
+	regexes     *functions.RegexCache // Nil unless patterns are checked
+	schema      *Schema
+	coerce      bool // Whether strings compare with numbers and booleans
+	strict      bool // Whether implicit conversions between types are errors
+	decimal     bool // Whether arithmetic on floats gives decimals
+	diagnostics []Diagnostic
+	lambdaDepth int // Greater than zero inside higher-order function arguments
+}
+
+// sort orders the diagnostics by position.
+func (c *checker) sort() {
+	sort.SliceStable(c.diagnostics, func(i, j int) bool {
+		a, b := c.diagnostics[i], c.diagnostics[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+func (c *checker) report(severity Severity, code errors.ErrorCode, tok lexer.Token, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Line:     tok.Line,
+		Column:   tok.Column,
+	})
+}
+
+// known reports whether t is a concrete type that can be checked.
+func known(t types.Type) bool {
+	return t != types.TypeAny && t != types.TypeUnknown && t != types.TypeNull
+}
+
+// check returns the inferred type of expr. TypeAny means the type depends on
+// the payload or cannot be inferred.
+func (c *checker) check(expr ast.Expression) types.Type {
+	switch n := expr.(type) {
+	case *ast.IntegerLiteral:
+		return types.TypeInt
+	case *ast.FloatLiteral:
+		return types.TypeFloat
+	case *ast.DurationLiteral:
+		return types.TypeDuration
+	case *ast.StringLiteral:
+		return types.TypeString
+	case *ast.BooleanLiteral:
+		return types.TypeBool
+	case *ast.NullLiteral:
+		return types.TypeNull
+	case *ast.ListLiteral:
+		for _, el := range n.Elements {
+			c.check(el)
+		}
+		return types.TypeList
+	case *ast.MapLiteral:
+		for _, value := range n.Values {
+			c.check(value)
+		}
+		return types.TypeMap
+	case *ast.Identifier:
+		if c.lambdaDepth == 0 {
+			c.report(SeverityWarning, errors.ErrUndefinedVariable, n.Token,
+				"'%s' is not a lambda parameter and must be supplied as a variable", n.Value)
+		}
+		return types.TypeAny
+	case *ast.JSONPathExpression:
+		return c.checkPath(n)
+	case *ast.GroupedExpression:
+		return c.check(n.Expression)
+	case *ast.UnaryExpression:
+		return c.checkUnary(n)
+	case *ast.BinaryExpression:
+		return c.checkBinary(n)
+	case *ast.InExpression:
+		c.check(n.Left)
+		if right := c.check(n.Right); known(right) && right != types.TypeList {
+			c.report(SeverityError, errors.ErrTypeMismatch, n.Token,
+				"IN operator requires a list on the right side, got %s", right)
+		}
+		return types.TypeBool
+	case *ast.RegexExpression:
+		if left := c.check(n.Left); known(left) && left != types.TypeString {
+			c.report(SeverityError, errors.ErrTypeMismatch, n.Token, "regex match requires string, got %s", left)
+		}
+		if pattern := c.check(n.Pattern); known(pattern) && pattern != types.TypeString {
+			c.report(SeverityError, errors.ErrTypeMismatch, n.Token, "regex pattern must be string, got %s", pattern)
+		}
+		if lit, ok := n.Pattern.(*ast.StringLiteral); ok {
+			c.checkPattern(lit)
+		}
+		return types.TypeBool
+	case *ast.FunctionCall:
+		return c.checkCall(n)
+	case *ast.IndexExpression:
+		left := c.check(n.Left)
+		c.check(n.Index)
+		if left == types.TypeString {
+			return types.TypeString
+		}
+		return types.TypeAny
+	case *ast.SliceExpression:
+		left := c.check(n.Left)
+		c.check(n.Start)
+		c.check(n.End)
+		switch left {
+		case types.TypeString, types.TypeList:
+			return left
+		case types.TypeAny, types.TypeUnknown, types.TypeNull:
+			return types.TypeAny
+		}
+		c.report(SeverityError, errors.ErrTypeMismatch, n.Token, "cannot slice %s", left)
+		return types.TypeAny
+	case *ast.MemberExpression:
+		c.check(n.Object)
+		return types.TypeAny
+	case *ast.ConditionalExpression:
+		c.checkCondition(c.check(n.Condition), n.Token, "the condition of ?:")
+		then, alt := c.check(n.Consequence), c.check(n.Alternative)
+		if then == alt {
+			return then
+		}
+		return types.TypeAny
+	case *ast.CaseExpression:
+		result := types.TypeNull
+		if n.Default != nil {
+			result = c.check(n.Default)
+		}
+		for i, cond := range n.Conditions {
+			c.checkCondition(c.check(cond), n.Token, "a condition of case")
+			if t := c.check(n.Results[i]); t != result {
+				result = types.TypeAny
+			}
+		}
+		return result
+	case *ast.LambdaExpression:
+		c.check(n.Body)
+		return types.TypeFunction
+	}
+	return types.TypeAny
+}
+
+func (c *checker) checkPath(n *ast.JSONPathExpression) types.Type {
+	if c.schema == nil {
+		return types.TypeAny
+	}
+	node, missing, closed := c.schema.Lookup(n.Path)
+	if node == nil {
+		switch {
+		case closed:
+			c.report(SeverityWarning, errors.ErrPathNotFound, n.Token,
+				"payload schema does not define '%s' in %s; the path always evaluates to null", missing, n.Path)
+		case missing != "":
+			c.report(SeverityWarning, errors.ErrPathNotFound, n.Token,
+				"payload schema does not define '%s' in %s", missing, n.Path)
+		}
+		return types.TypeAny
+	}
+	return node.ValueType()
+}
+
+func (c *checker) checkUnary(n *ast.UnaryExpression) types.Type {
+	operand := c.check(n.Operand)
+	switch n.Operator {
+	case "-":
+		if known(operand) && !operand.IsNumeric() && operand != types.TypeDuration {
+			c.report(SeverityError, errors.ErrTypeMismatch, n.Token, "cannot negate %s", operand)
+		}
+		if operand.IsNumeric() || operand == types.TypeDuration {
+			return operand
+		}
+		return types.TypeAny
+	default:
+		c.checkCondition(operand, n.Token, "the operand of "+n.Operator)
+		return types.TypeBool
+	}
+}
+
+func (c *checker) checkBinary(n *ast.BinaryExpression) types.Type {
+	left, right := c.check(n.Left), c.check(n.Right)
+	bothKnown := known(left) && known(right)
+	if bothKnown && !c.checkStrict(n, left, right) {
+		return types.TypeAny
+	}
+
+	switch n.Operator {
+	case "&&", "and", "AND", "||", "or", "OR":
+		c.checkCondition(left, n.Token, "the left operand of "+n.Operator)
+		c.checkCondition(right, n.Token, "the right operand of "+n.Operator)
+		return types.TypeBool
+
+	case "==", "!=":
+		if bothKnown && !left.IsCompatible(right) && !(c.coerce && coercibleEquality(left, right)) {
+			always := "false"
+			if n.Operator == "!=" {
+				always = "true"
+			}
+			c.report(SeverityError, errors.ErrTypeMismatch, n.Token,
+				"%s %s %s is always %s", left, n.Operator, right, always)
+		}
+		return types.TypeBool
+
+	case "<", ">", "<=", ">=":
+		comparable := (left.IsNumeric() && right.IsNumeric()) || (left == types.TypeString && right == types.TypeString) ||
+			((temporal(left) || temporal(right)) && left.IsCompatible(right)) ||
+			(c.coerce && coercible(left, right))
+		if bothKnown && !comparable {
+			c.report(SeverityError, errors.ErrTypeMismatch, n.Token, "cannot compare %s and %s", left, right)
+		}
+		return types.TypeBool
+
+	case "+":
+		if t, ok := temporalResult(n.Operator, left, right); ok {
+			return t
+		}
+		if left == types.TypeString && right == types.TypeString {
+			return types.TypeString
+		}
+		if left.IsNumeric() && right.IsNumeric() {
+			return c.promote(left, right)
+		}
+		if bothKnown {
+			c.report(SeverityError, errors.ErrTypeMismatch, n.Token, "cannot add %s and %s", left, right)
+		}
+		return types.TypeAny
+
+	case "-", "*", "/", "~/", "%":
+		if t, ok := temporalResult(n.Operator, left, right); ok {
+			return t
+		}
+		for _, t := range []types.Type{left, right} {
+			if known(t) && !t.IsNumeric() {
+				c.report(SeverityError, errors.ErrTypeMismatch, n.Token,
+					"operator %s requires numbers, got %s and %s", n.Operator, left, right)
+				return types.TypeAny
+			}
+		}
+		switch {
+		case n.Operator == "/" && bothKnown:
+			if c.decimal || left == types.TypeDecimal || right == types.TypeDecimal {
+				return types.TypeDecimal
+			}
+			return types.TypeFloat
+		case n.Operator == "~/" && bothKnown:
+			return types.TypeInt
+		case left.IsNumeric() && right.IsNumeric():
+			return c.promote(left, right)
+		}
+		return types.TypeAny
+	}
+	return types.TypeAny
+}
+
+// promote returns the type of arithmetic other than division on two numbers.
+func (c *checker) promote(left, right types.Type) types.Type {
+	t := types.PromoteNumeric(left, right)
+	if c.decimal && t == types.TypeFloat {
+		return types.TypeDecimal
+	}
+	return t
+}
+
+// checkStrict reports operands of known types that strict types refuse: an
+// int and a float, or values of different types compared. It returns false
+// if it reported one.
+func (c *checker) checkStrict(n *ast.BinaryExpression, left, right types.Type) bool {
+	if !c.strict || left == right {
+		return true
+	}
+	switch {
+	case left.IsNumeric() && right.IsNumeric():
+		c.report(SeverityError, errors.ErrStrictNumeric, n.Token, "strict types: cannot mix %s and %s with %s", left, right, n.Operator)
+		return false
+	case comparisonOperators[n.Operator]:
+		c.report(SeverityError, errors.ErrStrictComparison, n.Token, "strict types: cannot compare %s and %s with %s", left, right, n.Operator)
+		return false
+	}
+	return true
+}
+
+// checkCondition reports a value of known type other than bool used as a
+// condition, described by what, under strict types.
+func (c *checker) checkCondition(t types.Type, tok lexer.Token, what string) {
+	if c.strict && known(t) && t != types.TypeBool {
+		c.report(SeverityError, errors.ErrStrictTruthiness, tok, "strict types: %s must be a bool, got %s", what, t)
+	}
+}
+
+// comparisonOperators are the binary operators that compare their operands.
+var comparisonOperators = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// temporal reports whether t is a date/time or a duration.
+func temporal(t types.Type) bool {
+	return t == types.TypeDateTime || t == types.TypeDuration
+}
+
+// temporalResult returns the type of arithmetic on dates/times and durations,
+// TypeAny if the other operand depends on the payload. It reports false if
+// neither operand is a date/time or a duration, or if the operator does not
+// apply to them.
+func temporalResult(op string, left, right types.Type) (types.Type, bool) {
+	if !temporal(left) && !temporal(right) {
+		return types.TypeUnknown, false
+	}
+	if !known(left) || !known(right) {
+		return types.TypeAny, true
+	}
+
+	timeLike := func(t types.Type) bool { return t == types.TypeDateTime || t == types.TypeString }
+	switch op {
+	case "+":
+		switch {
+		case left == types.TypeDuration && right == types.TypeDuration:
+			return types.TypeDuration, true
+		case left == types.TypeDuration && timeLike(right), timeLike(left) && right == types.TypeDuration:
+			return types.TypeDateTime, true
+		}
+	case "-":
+		switch {
+		case left == types.TypeDuration && right == types.TypeDuration:
+			return types.TypeDuration, true
+		case timeLike(left) && right == types.TypeDuration:
+			return types.TypeDateTime, true
+		case timeLike(left) && timeLike(right):
+			return types.TypeDuration, true
+		}
+	case "*":
+		if (left == types.TypeDuration && right.IsNumeric()) || (left.IsNumeric() && right == types.TypeDuration) {
+			return types.TypeDuration, true
+		}
+	case "/":
+		switch {
+		case left == types.TypeDuration && right == types.TypeDuration:
+			return types.TypeFloat, true
+		case left == types.TypeDuration && right.IsNumeric():
+			return types.TypeDuration, true
+		}
+	}
+	return types.TypeUnknown, false
+}
+
+// coercible reports whether WithTypeCoercion may make two types ordered: a
+// string and a number.
+func coercible(a, b types.Type) bool {
+	return (a == types.TypeString && b.IsNumeric()) || (a.IsNumeric() && b == types.TypeString)
+}
+
+// coercibleEquality reports whether WithTypeCoercion may make values of two
+// types equal: a string and a number or a bool.
+func coercibleEquality(a, b types.Type) bool {
+	scalar := func(t types.Type) bool { return t.IsNumeric() || t == types.TypeBool }
+	return (a == types.TypeString && scalar(b)) || (scalar(a) && b == types.TypeString)
+}
+
+// higherOrderArity is the minimum number of arguments of each higher-order
+// function.
+var higherOrderArity = map[string]int{"reduce": 3}
+
+// checkPattern reports a literal regex pattern that does not compile or that
+// the regex configuration of the engine refuses.
+func (c *checker) checkPattern(lit *ast.StringLiteral) {
+	if _, err := regexp.Compile(lit.Value); err != nil {
+		c.report(SeverityError, errors.ErrInvalidSyntax, lit.Token, "invalid regex pattern: %v", err)
+		return
+	}
+	if c.regexes != nil {
+		if err := c.regexes.Check(lit.Value); err != nil {
+			c.report(SeverityError, errors.ErrRegexDenied, lit.Token, "%s", err.(*errors.Error).Message)
+		}
+	}
+}
+
+func (c *checker) checkCall(n *ast.FunctionCall) types.Type {
+	if eval.IsHigherOrderFunction(n.Name) {
+		return c.checkHigherOrderCall(n)
+	}
+
+	argTypes := make([]types.Type, len(n.Arguments))
+	for i, arg := range n.Arguments {
+		argTypes[i] = c.check(arg)
+	}
+	if (n.Name == "match" || n.Name == "redact") && len(n.Arguments) >= 2 {
+		if lit, ok := n.Arguments[1].(*ast.StringLiteral); ok {
+			c.checkPattern(lit)
+		}
+	}
+
+	if c.functions == nil {
+		return types.TypeAny
+	}
+	overloads := c.functions.ListOverloads(n.Name)
+	if len(overloads) == 0 {
+		c.report(SeverityError, errors.ErrUndefinedFunction, n.Token, "unknown function '%s'", n.Name)
+		return types.TypeAny
+	}
+
+	var firstErr *Diagnostic
+	for _, fn := range overloads {
+		if fn.Signature == nil {
+			return types.TypeAny
+		}
+		d := matchSignature(fn.Signature, argTypes)
+		if d == nil {
+			return fn.Signature.ReturnType
+		}
+		if firstErr == nil {
+			firstErr = d
+		}
+	}
+
+	firstErr.Line, firstErr.Column = n.Token.Line, n.Token.Column
+	c.diagnostics = append(c.diagnostics, *firstErr)
+	return types.TypeAny
+}
+
+func (c *checker) checkHigherOrderCall(n *ast.FunctionCall) types.Type {
+	minArgs := 2
+	if m, ok := higherOrderArity[n.Name]; ok {
+		minArgs = m
+	}
+	if len(n.Arguments) < minArgs {
+		c.report(SeverityError, errors.ErrArgumentCount, n.Token,
+			"function %s requires at least %d arguments, got %d", n.Name, minArgs, len(n.Arguments))
+	}
+
+	if len(n.Arguments) > 0 {
+		if list := c.check(n.Arguments[0]); known(list) && list != types.TypeList {
+			c.report(SeverityError, errors.ErrTypeMismatch, n.Token,
+				"%s() first argument must be a list, got %s", n.Name, list)
+		}
+	}
+
+	// Lambda parameters may be split across arguments by the parser, so
+	// identifiers in the remaining arguments are not reported.
+	c.lambdaDepth++
+	for _, arg := range n.Arguments[min(1, len(n.Arguments)):] {
+		c.check(arg)
+	}
+	c.lambdaDepth--
+
+	switch n.Name {
+	case "map", "filter", "sortWith":
+		return types.TypeList
+	case "some", "every":
+		return types.TypeBool
+	}
+	return types.TypeAny
+}
+
+// matchSignature checks argument types against a signature and returns a
+// diagnostic describing the first mismatch, or nil if the call is valid.
+func matchSignature(sig *types.FunctionSignature, args []types.Type) *Diagnostic {
+	minArgs := sig.MinArgs()
+	if len(args) < minArgs || (!sig.Variadic && len(args) > len(sig.Parameters)) {
+		want := strconv.Itoa(len(sig.Parameters))
+		if sig.Variadic {
+			want = fmt.Sprintf("at least %d", minArgs)
+		} else if minArgs < len(sig.Parameters) {
+			want = fmt.Sprintf("%d to %d", minArgs, len(sig.Parameters))
+		}
+		return &Diagnostic{
+			Severity: SeverityError,
+			Code:     errors.ErrArgumentCount,
+			Message:  fmt.Sprintf("function %s expects %s arguments, got %d", sig.Name, want, len(args)),
+		}
+	}
+
+	for i, arg := range args {
+		var expected types.Type
+		if i < len(sig.Parameters) {
+			expected = sig.Parameters[i].Type
+		} else if len(sig.Parameters) > 0 {
+			expected = sig.Parameters[len(sig.Parameters)-1].Type
+		}
+		if known(arg) && known(expected) && !arg.IsCompatible(expected) {
+			return &Diagnostic{
+				Severity: SeverityError,
+				Code:     errors.ErrArgumentType,
+				Message:  fmt.Sprintf("function %s argument %d: expected %s, got %s", sig.Name, i+1, expected, arg),
+			}
+		}
+	}
+	return nil
+}
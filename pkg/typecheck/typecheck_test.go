@@ -0,0 +1,127 @@
+// Package typecheck infers the types of AMEL expressions and reports type
+// errors without evaluating them.
+package typecheck
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": ["integer", "null"]},
+		"score": {"type": "number"},
+		"active": {"type": "boolean"},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"address": {
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {"city": {"type": "string"}}
+		}
+	}
+}`
+
+func check(t *testing.T, input string, opts ...Option) *Result {
+	t.Helper()
+	expr, err := parser.Parse(input)
+	require.NoError(t, err)
+	return Check(expr, opts...)
+}
+
+func codes(r *Result) []errors.ErrorCode {
+	var out []errors.ErrorCode
+	for _, d := range r.Diagnostics {
+		out = append(out, d.Code)
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	require.NoError(t, err)
+
+	tests := []struct {
+		input    string
+		typ      types.Type
+		expected []errors.ErrorCode
+	}{
+		{`$.age >= 18 && $.active`, types.TypeBool, nil},
+		{`$.name == 5`, types.TypeBool, []errors.ErrorCode{errors.ErrTypeMismatch}},
+		{`$.name != true`, types.TypeBool, []errors.ErrorCode{errors.ErrTypeMismatch}},
+		{`$.age == 18.0`, types.TypeBool, nil},
+		{`$.name == null`, types.TypeBool, nil},
+		{`$.age > "18"`, types.TypeBool, []errors.ErrorCode{errors.ErrTypeMismatch}},
+		{`$.score * 2`, types.TypeFloat, nil},
+		{`$.name + 1`, types.TypeAny, []errors.ErrorCode{errors.ErrTypeMismatch}},
+		{`"x" IN $.name`, types.TypeBool, []errors.ErrorCode{errors.ErrTypeMismatch}},
+		{`upper($.name)`, types.TypeString, nil},
+		{`upper($.age)`, types.TypeAny, []errors.ErrorCode{errors.ErrArgumentType}},
+		{`len($.tags) > 0 ? $.tags[0] : "none"`, types.TypeString, nil},
+		{`case { $.age > 65 => "senior"; $.age < 18 => "minor"; else => $.name }`, types.TypeString, nil},
+		{`case { $.age > 65 => "senior" }`, types.TypeAny, nil},
+		{`$.tags[0] == 1`, types.TypeBool, []errors.ErrorCode{errors.ErrTypeMismatch}},
+		{`$.address.zip == "x"`, types.TypeBool, []errors.ErrorCode{errors.ErrPathNotFound}},
+		{`nosuch(1)`, types.TypeAny, []errors.ErrorCode{errors.ErrUndefinedFunction}},
+		{`decimal($.score) * 2`, types.TypeDecimal, nil},
+		{`decimal($.score) / 2`, types.TypeDecimal, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := check(t, tt.input, WithSchema(schema))
+			assert.Equal(t, tt.expected, codes(result))
+			assert.Equal(t, tt.typ, result.Type)
+		})
+	}
+}
+
+func TestCheckWithoutSchema(t *testing.T) {
+	// Paths may hold any type
+	assert.Empty(t, check(t, `$.name == 5 && $.age > "18"`).Diagnostics)
+
+	result := check(t, `"a" == 1`)
+	require.Len(t, result.Errors(), 1)
+	assert.Equal(t, "1:5: error: string == int is always false", result.Errors()[0].String())
+}
+
+func TestCheckOptions(t *testing.T) {
+	assert.Empty(t, check(t, `"5" == 5`, WithTypeCoercion(true)).Diagnostics)
+	assert.Empty(t, check(t, `"true" != true`, WithTypeCoercion(true)).Diagnostics)
+
+	assert.Empty(t, check(t, `1 == 1.0`).Diagnostics)
+	assert.Equal(t, []errors.ErrorCode{errors.ErrStrictNumeric}, codes(check(t, `1 == 1.0`, WithStrictTypes(true))))
+	assert.Equal(t, []errors.ErrorCode{errors.ErrStrictTruthiness}, codes(check(t, `1 ? 2 : 3`, WithStrictTypes(true))))
+	assert.Equal(t, []errors.ErrorCode{errors.ErrStrictTruthiness}, codes(check(t, `case { true => 1; 1 => 2 }`, WithStrictTypes(true))))
+
+	assert.Equal(t, types.TypeDecimal, check(t, `0.1 + 0.2`, WithDecimalArithmetic(true)).Type)
+	assert.Equal(t, types.TypeDecimal, check(t, `1 / 3`, WithDecimalArithmetic(true)).Type)
+	assert.Equal(t, types.TypeInt, check(t, `1 + 3`, WithDecimalArithmetic(true)).Type)
+}
+
+func TestParseSchema(t *testing.T) {
+	_, err := ParseSchema([]byte(`{"type": 3}`))
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax))
+
+	schema, err := ParseSchema([]byte(testSchema))
+	require.NoError(t, err)
+
+	node, missing, closed := schema.Lookup("$.tags[2]")
+	require.NotNil(t, node)
+	assert.Equal(t, types.TypeString, node.ValueType())
+	assert.Empty(t, missing)
+	assert.False(t, closed)
+
+	node, missing, closed = schema.Lookup("$.address.zip")
+	assert.Nil(t, node)
+	assert.Equal(t, "zip", missing)
+	assert.True(t, closed)
+
+	node, _, _ = schema.Lookup("$.age")
+	assert.Equal(t, types.TypeInt, node.ValueType())
+}
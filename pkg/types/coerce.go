@@ -0,0 +1,64 @@
+// Package types provides type definitions and type checking for the AMEL DSL.
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Coercion describes a string operand converted by Coerce.
+type Coercion struct {
+	From Value
+	To   Value
+}
+
+// String describes the coercion, such as `"5" (string) as 5 (int)`.
+func (c Coercion) String() string {
+	return fmt.Sprintf("%q (string) as %v (%s)", c.From.Raw, c.To.Raw, c.To.Type)
+}
+
+// Coerce converts a string compared with a number or a boolean to the type of
+// the other operand, for payloads that carry every value as a string: "5"
+// compared with 3 becomes 5, and "true" compared with false becomes true.
+// Numbers may be surrounded by spaces; booleans are matched without regard to
+// case. It returns the operands, converted if possible, and the coercion
+// made, or nil if neither operand was converted.
+func Coerce(a, b Value) (Value, Value, *Coercion) {
+	if c := coerceTo(a, b.Type); c != nil {
+		return c.To, b, c
+	}
+	if c := coerceTo(b, a.Type); c != nil {
+		return a, c.To, c
+	}
+	return a, b, nil
+}
+
+// coerceTo converts a string value to a number or a boolean, as given by
+// target, or returns nil.
+func coerceTo(v Value, target Type) *Coercion {
+	s, ok := v.AsString()
+	if !ok {
+		return nil
+	}
+
+	switch target {
+	case TypeInt, TypeFloat, TypeDecimal:
+		s = strings.TrimSpace(s)
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return &Coercion{From: v, To: Int(n)}
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return &Coercion{From: v, To: Float(f)}
+		}
+	case TypeBool:
+		switch strings.ToLower(s) {
+		case "true":
+			return &Coercion{From: v, To: Bool(true)}
+		case "false":
+			return &Coercion{From: v, To: Bool(false)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package types provides type definitions and type checking for the AMEL DSL.
+package types
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DecimalPrecision is the number of fraction digits decimals that cannot be
+// written exactly, such as 1/3, are rounded to when formatted.
+const DecimalPrecision = 20
+
+// MaxDecimalDigits bounds the digits and the exponent of the decimals
+// ParseDecimal accepts. Parsing and arithmetic on big numbers cannot be
+// interrupted, so a string such as "1e999999" is rejected rather than
+// expanded to a million digits. The bound covers the strings of every
+// float64.
+const MaxDecimalDigits = 1000
+
+// Dec is the raw form of a decimal Value, an exact rational number. It
+// formats with FormatDecimal and encodes as a JSON number.
+type Dec big.Rat
+
+// Rat returns the rational number of the decimal.
+func (d *Dec) Rat() *big.Rat {
+	return (*big.Rat)(d)
+}
+
+// String formats the decimal with FormatDecimal, such as "0.3".
+func (d *Dec) String() string {
+	return FormatDecimal(d.Rat())
+}
+
+// MarshalJSON encodes the decimal as a JSON number.
+func (d *Dec) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Decimal creates a decimal Value, an exact rational number such as 0.1.
+func Decimal(r *big.Rat) Value {
+	return Value{Type: TypeDecimal, Raw: (*Dec)(r)}
+}
+
+// AsDecimal converts the value to an exact rational number. Ints convert
+// exactly; floats convert to the shortest decimal that reads back as the same
+// float, so 0.1 is one tenth; strings are parsed with ParseDecimal. The
+// result of a decimal is shared with the value and must not be modified.
+func (v Value) AsDecimal() (*big.Rat, bool) {
+	switch v.Type {
+	case TypeDecimal:
+		return v.Raw.(*Dec).Rat(), true
+	case TypeInt:
+		return new(big.Rat).SetInt64(v.Raw.(int64)), true
+	case TypeFloat:
+		return FloatDecimal(v.Raw.(float64))
+	case TypeString:
+		return ParseDecimal(v.Raw.(string))
+	}
+	return nil, false
+}
+
+// FloatDecimal converts a float to the shortest decimal that reads back as
+// the same float. Infinities and NaN have no decimal.
+func FloatDecimal(f float64) (*big.Rat, bool) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// ParseDecimal parses a decimal number, such as "19.99", "-0.5", or "1e-3",
+// surrounded by optional spaces. Numbers with more than MaxDecimalDigits
+// digits, or an exponent beyond ±MaxDecimalDigits, are rejected.
+func ParseDecimal(s string) (*big.Rat, bool) {
+	s = strings.TrimSpace(s)
+	// Rat.SetString also accepts fractions, such as "1/3", and hexadecimal
+	if s == "" || strings.ContainsAny(s, "/xXpP_") {
+		return nil, false
+	}
+
+	mantissa := s
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exponent, err := strconv.Atoi(s[i+1:])
+		if err != nil || exponent < -MaxDecimalDigits || exponent > MaxDecimalDigits {
+			return nil, false
+		}
+		mantissa = s[:i]
+	}
+	digits := 0
+	for _, c := range mantissa {
+		if c >= '0' && c <= '9' {
+			digits++
+		}
+	}
+	if digits > MaxDecimalDigits {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// FormatDecimal writes a decimal in positional notation, such as "0.3" or
+// "-12". Decimals that cannot be written exactly are rounded to
+// DecimalPrecision fraction digits.
+func FormatDecimal(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// A fraction is written exactly with as many digits as the larger power
+	// of 2 or 5 in its denominator, if it has no other factors
+	digits := 0
+	denom := new(big.Int).Set(r.Denom())
+	for _, factor := range []int64{2, 5} {
+		f := big.NewInt(factor)
+		n := 0
+		for new(big.Int).Mod(denom, f).Sign() == 0 {
+			denom.Quo(denom, f)
+			n++
+		}
+		digits = max(digits, n)
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 || digits > DecimalPrecision {
+		s := r.FloatString(DecimalPrecision)
+		return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return r.FloatString(digits)
+}
+
+// decimalFloat converts a decimal to the nearest float.
+func decimalFloat(r *big.Rat) float64 {
+	f, _ := r.Float64()
+	return f
+}
+
+// compareDecimal compares two numbers exactly, at least one of which is a
+// decimal.
+func compareDecimal(v, other Value) (int, bool) {
+	a, aok := v.AsDecimal()
+	b, bok := other.AsDecimal()
+	if !aok || !bok {
+		return 0, false
+	}
+	return a.Cmp(b), true
+}
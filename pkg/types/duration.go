@@ -0,0 +1,98 @@
+// Package types provides type definitions and type checking for the AMEL DSL.
+package types
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration creates a duration Value.
+func Duration(d time.Duration) Value {
+	return Value{Type: TypeDuration, Raw: d}
+}
+
+// AsDuration converts the value to a duration. Strings are parsed with
+// ParseDuration, such as "90s" or "2h30m".
+func (v Value) AsDuration() (time.Duration, bool) {
+	switch v.Type {
+	case TypeDuration:
+		return v.Raw.(time.Duration), true
+	case TypeString:
+		return ParseDuration(v.Raw.(string))
+	}
+	return 0, false
+}
+
+// durationUnits holds the units of a duration, longest first so that "ms"
+// is matched before "m".
+var durationUnits = []struct {
+	name string
+	unit time.Duration
+}{
+	{"ns", time.Nanosecond},
+	{"us", time.Microsecond},
+	{"µs", time.Microsecond},
+	{"ms", time.Millisecond},
+	{"s", time.Second},
+	{"m", time.Minute},
+	{"h", time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// ParseDuration parses a duration such as "300ms", "1.5h", "-2h45m", or
+// "7d". It accepts the units of time.ParseDuration, ns, us (or µs), ms, s,
+// m, and h, and d for days of 24 hours.
+func ParseDuration(s string) (time.Duration, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	if s == "" {
+		return 0, false
+	}
+
+	var total float64
+	for s != "" {
+		amount, unit, rest, ok := cutDuration(s)
+		if !ok {
+			return 0, false
+		}
+		total += amount * float64(unit)
+		s = rest
+	}
+	if total >= math.MaxInt64 {
+		return 0, false
+	}
+	if neg {
+		total = -total
+	}
+	return time.Duration(math.Round(total)), true
+}
+
+// cutDuration cuts an amount and a unit, such as "2h" or "1.5ms", from the
+// start of s.
+func cutDuration(s string) (amount float64, unit time.Duration, rest string, ok bool) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return 0, 0, s, false
+	}
+	if i+1 < len(s) && s[i] == '.' && s[i+1] >= '0' && s[i+1] <= '9' {
+		i++
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	}
+	amount, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, 0, s, false
+	}
+	for _, u := range durationUnits {
+		if strings.HasPrefix(s[i:], u.name) {
+			return amount, u.unit, s[i+len(u.name):], true
+		}
+	}
+	return 0, 0, s, false
+}
@@ -0,0 +1,49 @@
+// Package types provides type definitions and type checking for the AMEL DSL.
+package types
+
+import "strings"
+
+// Truthiness decides which values count as true where a condition is
+// expected, such as the operands of &&, ||, and !. The zero value keeps the
+// rules of Value.IsTruthy, under which null, false, 0, 0.0, "", [], and {} are
+// falsy.
+type Truthiness struct {
+	EmptyStringTruthy bool // "" is truthy, as in Ruby
+	EmptyListTruthy   bool // [] and {} are truthy, as in JavaScript and Ruby
+	ZeroTruthy        bool // 0 and 0.0 are truthy, as in Ruby
+
+	// FalseStrings lists strings that are falsy, compared without regard to
+	// case, such as "false", "0", and "no" for values read from forms or
+	// environment variables.
+	FalseStrings []string
+}
+
+// IsTruthy returns the truthiness of a value under t. A nil t uses the
+// rules of Value.IsTruthy.
+func (t *Truthiness) IsTruthy(v Value) bool {
+	if t == nil || v.IsNull() {
+		return v.IsTruthy()
+	}
+
+	switch v.Type {
+	case TypeInt, TypeFloat, TypeDecimal:
+		if t.ZeroTruthy {
+			return true
+		}
+	case TypeString:
+		s := v.Raw.(string)
+		for _, f := range t.FalseStrings {
+			if strings.EqualFold(s, f) {
+				return false
+			}
+		}
+		if s == "" {
+			return t.EmptyStringTruthy
+		}
+	case TypeList, TypeMap:
+		if t.EmptyListTruthy {
+			return true
+		}
+	}
+	return v.IsTruthy()
+}
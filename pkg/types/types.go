@@ -1,7 +1,13 @@
 // Package types provides type definitions and type checking for the AMEL DSL.
 package types
 
-import "fmt"
+import (
+	"cmp"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
 
 // Type represents the type of a value in the AMEL type system.
 type Type int
@@ -16,6 +22,10 @@ const (
 	TypeList
 	TypeAny
 	TypeFunction
+	TypeDateTime
+	TypeDuration
+	TypeMap
+	TypeDecimal
 )
 
 var typeNames = map[Type]string{
@@ -28,6 +38,10 @@ var typeNames = map[Type]string{
 	TypeList:     "list",
 	TypeAny:      "any",
 	TypeFunction: "function",
+	TypeDateTime: "datetime",
+	TypeDuration: "duration",
+	TypeMap:      "map",
+	TypeDecimal:  "decimal",
 }
 
 // String returns the string representation of a type.
@@ -48,14 +62,14 @@ func ParseType(name string) Type {
 	return TypeUnknown
 }
 
-// IsNumeric returns true if the type is a numeric type (int or float).
+// IsNumeric returns true if the type is a numeric type (int, float, or decimal).
 func (t Type) IsNumeric() bool {
-	return t == TypeInt || t == TypeFloat
+	return t == TypeInt || t == TypeFloat || t == TypeDecimal
 }
 
 // IsComparable returns true if the type can be compared with comparison operators.
 func (t Type) IsComparable() bool {
-	return t == TypeInt || t == TypeFloat || t == TypeString || t == TypeBool
+	return t.IsNumeric() || t == TypeString || t == TypeBool || t == TypeDateTime || t == TypeDuration
 }
 
 // IsCompatible checks if two types are compatible for operations.
@@ -70,12 +84,23 @@ func (t Type) IsCompatible(other Type) bool {
 	if t.IsNumeric() && other.IsNumeric() {
 		return true
 	}
+	// Strings may hold timestamps and durations
+	if (t == TypeDateTime || t == TypeDuration) && other == TypeString {
+		return true
+	}
+	if t == TypeString && (other == TypeDateTime || other == TypeDuration) {
+		return true
+	}
 	return false
 }
 
 // PromoteNumeric returns the promoted type when combining two numeric types.
-// If either is float, result is float. Otherwise, int.
+// If either is decimal, result is decimal; if either is float, result is
+// float. Otherwise, int.
 func PromoteNumeric(a, b Type) Type {
+	if a == TypeDecimal || b == TypeDecimal {
+		return TypeDecimal
+	}
 	if a == TypeFloat || b == TypeFloat {
 		return TypeFloat
 	}
@@ -113,6 +138,18 @@ func NewValue(v interface{}) Value {
 		return Value{Type: TypeList, Raw: val}
 	case []Value:
 		return Value{Type: TypeList, Raw: val}
+	case map[string]Value:
+		return Value{Type: TypeMap, Raw: val}
+	case map[string]interface{}:
+		return Value{Type: TypeMap, Raw: val}
+	case time.Time:
+		return Time(val)
+	case time.Duration:
+		return Duration(val)
+	case *big.Rat:
+		return Decimal(val)
+	case *Dec:
+		return Value{Type: TypeDecimal, Raw: val}
 	default:
 		return Value{Type: TypeAny, Raw: val}
 	}
@@ -138,6 +175,11 @@ func Bool(v bool) Value {
 	return Value{Type: TypeBool, Raw: v}
 }
 
+// Time creates a date/time Value.
+func Time(t time.Time) Value {
+	return Value{Type: TypeDateTime, Raw: t}
+}
+
 // Null creates a null Value.
 func Null() Value {
 	return Value{Type: TypeNull, Raw: nil}
@@ -148,6 +190,11 @@ func List(elements ...Value) Value {
 	return Value{Type: TypeList, Raw: elements}
 }
 
+// Map creates a map Value from its entries.
+func Map(entries map[string]Value) Value {
+	return Value{Type: TypeMap, Raw: entries}
+}
+
 // Any creates an any-typed Value.
 func Any(v interface{}) Value {
 	return Value{Type: TypeAny, Raw: v}
@@ -171,6 +218,10 @@ func (v Value) IsTruthy() bool {
 		return v.Raw.(int64) != 0
 	case TypeFloat:
 		return v.Raw.(float64) != 0
+	case TypeDecimal:
+		return v.Raw.(*Dec).Rat().Sign() != 0
+	case TypeDuration:
+		return v.Raw.(time.Duration) != 0
 	case TypeString:
 		return v.Raw.(string) != ""
 	case TypeList:
@@ -180,6 +231,9 @@ func (v Value) IsTruthy() bool {
 		case []Value:
 			return len(list) > 0
 		}
+	case TypeMap:
+		m, _ := v.AsMap()
+		return len(m) > 0
 	}
 	return v.Raw != nil
 }
@@ -191,6 +245,8 @@ func (v Value) AsInt() (int64, bool) {
 		return v.Raw.(int64), true
 	case TypeFloat:
 		return int64(v.Raw.(float64)), true
+	case TypeDecimal:
+		return int64(decimalFloat(v.Raw.(*Dec).Rat())), true
 	}
 	return 0, false
 }
@@ -202,6 +258,8 @@ func (v Value) AsFloat() (float64, bool) {
 		return float64(v.Raw.(int64)), true
 	case TypeFloat:
 		return v.Raw.(float64), true
+	case TypeDecimal:
+		return decimalFloat(v.Raw.(*Dec).Rat()), true
 	}
 	return 0, false
 }
@@ -222,6 +280,29 @@ func (v Value) AsBool() (bool, bool) {
 	return false, false
 }
 
+// AsTime converts the value to a time. Strings are parsed as RFC 3339
+// timestamps, such as "2024-05-01T12:00:00Z", or as dates, such as
+// "2024-05-01", which are midnight UTC.
+func (v Value) AsTime() (time.Time, bool) {
+	switch v.Type {
+	case TypeDateTime:
+		return v.Raw.(time.Time), true
+	case TypeString:
+		return ParseTime(v.Raw.(string))
+	}
+	return time.Time{}, false
+}
+
+// ParseTime parses an RFC 3339 timestamp or a date in the form 2006-01-02.
+func ParseTime(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
 // AsList converts the value to a list of Values.
 func (v Value) AsList() ([]Value, bool) {
 	if v.Type != TypeList {
@@ -241,6 +322,45 @@ func (v Value) AsList() ([]Value, bool) {
 	return nil, false
 }
 
+// AsMap converts the value to a map of Values.
+func (v Value) AsMap() (map[string]Value, bool) {
+	if v.Type != TypeMap {
+		return nil, false
+	}
+
+	switch m := v.Raw.(type) {
+	case map[string]Value:
+		return m, true
+	case map[string]interface{}:
+		result := make(map[string]Value, len(m))
+		for key, elem := range m {
+			result[key] = NewValue(elem)
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// Plain returns the raw form of a value, converting the elements of lists
+// and maps as well, such as for encoding as JSON.
+func (v Value) Plain() interface{} {
+	switch raw := v.Raw.(type) {
+	case []Value:
+		plain := make([]interface{}, len(raw))
+		for i, el := range raw {
+			plain[i] = el.Plain()
+		}
+		return plain
+	case map[string]Value:
+		plain := make(map[string]interface{}, len(raw))
+		for key, el := range raw {
+			plain[key] = el.Plain()
+		}
+		return plain
+	}
+	return v.Raw
+}
+
 // Equals checks if two values are equal.
 func (v Value) Equals(other Value) bool {
 	// Handle null comparison
@@ -251,13 +371,31 @@ func (v Value) Equals(other Value) bool {
 		return false
 	}
 
-	// Handle numeric comparison with type promotion
+	// Handle numeric comparison with type promotion, exact for decimals
 	if v.Type.IsNumeric() && other.Type.IsNumeric() {
+		if v.Type == TypeDecimal || other.Type == TypeDecimal {
+			c, ok := compareDecimal(v, other)
+			return ok && c == 0
+		}
 		vf, _ := v.AsFloat()
 		of, _ := other.AsFloat()
 		return vf == of
 	}
 
+	// Date/time comparison, reading strings as timestamps
+	if v.Type == TypeDateTime || other.Type == TypeDateTime {
+		vt, vok := v.AsTime()
+		ot, ook := other.AsTime()
+		return vok && ook && vt.Equal(ot)
+	}
+
+	// Duration comparison, reading strings such as "5m" as durations
+	if v.Type == TypeDuration || other.Type == TypeDuration {
+		vd, vok := v.AsDuration()
+		od, ook := other.AsDuration()
+		return vok && ook && vd == od
+	}
+
 	// Same type comparison
 	if v.Type != other.Type {
 		return false
@@ -280,6 +418,18 @@ func (v Value) Equals(other Value) bool {
 			}
 		}
 		return true
+	case TypeMap:
+		vMap, _ := v.AsMap()
+		oMap, _ := other.AsMap()
+		if len(vMap) != len(oMap) {
+			return false
+		}
+		for key, elem := range vMap {
+			if o, ok := oMap[key]; !ok || !elem.Equals(o) {
+				return false
+			}
+		}
+		return true
 	}
 
 	return v.Raw == other.Raw
@@ -291,8 +441,11 @@ func (v Value) Equals(other Value) bool {
 //	0 if v == other
 //	1 if v > other
 func (v Value) Compare(other Value) (int, bool) {
-	// Numeric comparison
+	// Numeric comparison, exact for decimals
 	if v.Type.IsNumeric() && other.Type.IsNumeric() {
+		if v.Type == TypeDecimal || other.Type == TypeDecimal {
+			return compareDecimal(v, other)
+		}
 		vf, _ := v.AsFloat()
 		of, _ := other.AsFloat()
 		if vf < of {
@@ -303,6 +456,26 @@ func (v Value) Compare(other Value) (int, bool) {
 		return 0, true
 	}
 
+	// Date/time comparison, reading strings as timestamps
+	if v.Type == TypeDateTime || other.Type == TypeDateTime {
+		vt, vok := v.AsTime()
+		ot, ook := other.AsTime()
+		if !vok || !ook {
+			return 0, false
+		}
+		return vt.Compare(ot), true
+	}
+
+	// Duration comparison, reading strings such as "5m" as durations
+	if v.Type == TypeDuration || other.Type == TypeDuration {
+		vd, vok := v.AsDuration()
+		od, ook := other.AsDuration()
+		if !vok || !ook {
+			return 0, false
+		}
+		return cmp.Compare(vd, od), true
+	}
+
 	// String comparison
 	if v.Type == TypeString && other.Type == TypeString {
 		vs := v.Raw.(string)
@@ -320,8 +493,10 @@ func (v Value) Compare(other Value) (int, bool) {
 
 // ParameterDef defines a function parameter.
 type ParameterDef struct {
-	Name string
-	Type Type
+	Name        string
+	Type        Type
+	Description string // Optional documentation
+	Optional    bool   // May be omitted; only the parameters after it may follow it
 }
 
 // FunctionSignature defines the signature of a function.
@@ -330,6 +505,11 @@ type FunctionSignature struct {
 	Parameters []ParameterDef
 	ReturnType Type
 	Variadic   bool // if true, last parameter can accept multiple values
+
+	// Optional documentation, shown by editors and function catalogs
+	Description string
+	Category    string   // e.g. "string", "math", "list"
+	Examples    []string // Example expressions
 }
 
 // NewFunctionSignature creates a new function signature.
@@ -356,21 +536,49 @@ func Param(name string, typ Type) ParameterDef {
 	return ParameterDef{Name: name, Type: typ}
 }
 
-// ValidateArgs validates that the given arguments match the function signature.
-func (sig *FunctionSignature) ValidateArgs(args []Value) error {
-	minArgs := len(sig.Parameters)
-	if sig.Variadic && minArgs > 0 {
-		minArgs-- // variadic functions need at least (params - 1) args
-	}
+// DescribedParam creates a documented parameter definition.
+func DescribedParam(name string, typ Type, description string) ParameterDef {
+	return ParameterDef{Name: name, Type: typ, Description: description}
+}
 
-	if len(args) < minArgs {
-		return fmt.Errorf("function %s requires at least %d arguments, got %d",
-			sig.Name, minArgs, len(args))
+// WithDescription sets the description of the function and returns the signature.
+func (sig *FunctionSignature) WithDescription(description string) *FunctionSignature {
+	sig.Description = description
+	return sig
+}
+
+// WithCategory sets the category of the function and returns the signature.
+func (sig *FunctionSignature) WithCategory(category string) *FunctionSignature {
+	sig.Category = category
+	return sig
+}
+
+// WithExamples adds example expressions and returns the signature.
+func (sig *FunctionSignature) WithExamples(examples ...string) *FunctionSignature {
+	sig.Examples = append(sig.Examples, examples...)
+	return sig
+}
+
+// String renders the signature, e.g. "substr(str: string, start: int, length: int): string".
+// The last parameter of a variadic signature is followed by "...".
+func (sig *FunctionSignature) String() string {
+	params := make([]string, len(sig.Parameters))
+	for i, p := range sig.Parameters {
+		params[i] = p.Name + ": " + p.Type.String()
+		if p.Optional {
+			params[i] = p.Name + "?: " + p.Type.String()
+		}
+		if sig.Variadic && i == len(sig.Parameters)-1 {
+			params[i] += "..."
+		}
 	}
+	return fmt.Sprintf("%s(%s): %s", sig.Name, strings.Join(params, ", "), sig.ReturnType)
+}
 
-	if !sig.Variadic && len(args) > len(sig.Parameters) {
-		return fmt.Errorf("function %s accepts at most %d arguments, got %d",
-			sig.Name, len(sig.Parameters), len(args))
+// ValidateArgs validates that the given arguments match the function signature.
+func (sig *FunctionSignature) ValidateArgs(args []Value) error {
+	if err := sig.ValidateArgCount(len(args)); err != nil {
+		return err
 	}
 
 	// Check argument types
@@ -391,3 +599,36 @@ func (sig *FunctionSignature) ValidateArgs(args []Value) error {
 
 	return nil
 }
+
+// MinArgs returns the number of arguments the function requires: the
+// parameters before the first optional one, not counting the last parameter
+// of a variadic function.
+func (sig *FunctionSignature) MinArgs() int {
+	minArgs := len(sig.Parameters)
+	if sig.Variadic && minArgs > 0 {
+		minArgs-- // variadic functions need at least (params - 1) args
+	}
+	for i := 0; i < minArgs; i++ {
+		if sig.Parameters[i].Optional {
+			return i
+		}
+	}
+	return minArgs
+}
+
+// ValidateArgCount validates that the function accepts n arguments.
+func (sig *FunctionSignature) ValidateArgCount(n int) error {
+	minArgs := sig.MinArgs()
+
+	if n < minArgs {
+		return fmt.Errorf("function %s requires at least %d arguments, got %d",
+			sig.Name, minArgs, n)
+	}
+
+	if !sig.Variadic && n > len(sig.Parameters) {
+		return fmt.Errorf("function %s accepts at most %d arguments, got %d",
+			sig.Name, len(sig.Parameters), n)
+	}
+
+	return nil
+}
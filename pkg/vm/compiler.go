@@ -0,0 +1,354 @@
+// Package vm compiles AMEL expressions to bytecode and runs them on a
+// stack-based virtual machine.
+//
+// A program evaluates an expression with the semantics of the tree-walking
+// evaluator of package eval, which it uses to apply operators and call
+// functions, but without walking the tree: operands are pushed on a stack,
+// and &&, ||, and ?: jump over the code they do not evaluate. Nodes the
+// compiler does not translate, such as the calls of higher-order functions,
+// are handed back to the evaluator.
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Opcode is the operation of an instruction.
+type Opcode uint8
+
+const (
+	OpConst            Opcode = iota // Push constants[Arg]
+	OpPath                           // Push the payload value at strings[Arg]
+	OpVar                            // Push the variable strings[Arg]
+	OpList                           // Pop Arg values and push a list of them
+	OpMap                            // Pop the values of the keys keys[Arg] and push a map
+	OpUnary                          // Apply the unary operator strings[Arg] to the top value
+	OpBinary                         // Apply the binary operator strings[Arg] to the top two values
+	OpIn                             // Apply IN, or NOT IN if Arg is 1, to the top two values
+	OpMatch                          // Apply =~, or !~ if Arg is 1, to the top two values
+	OpIndex                          // Index the value below the top with the top value
+	OpSlice                          // Slice a value; Arg has bit 0 set if a start and bit 1 if an end is pushed
+	OpMember                         // Replace the top value with its property strings[Arg]
+	OpTest                           // Replace the top value with its truthiness as the condition tests[Arg]
+	OpJump                           // Jump to Arg
+	OpJumpIfFalse                    // Pop the top value and jump to Arg if it is false
+	OpJumpIfFalseOrPop               // Jump to Arg if the top value is false, or pop it
+	OpJumpIfTrueOrPop                // Jump to Arg if the top value is true, or pop it
+	OpBeginCall                      // Start the call of the node; jump to Arg after evaluating a lazy call
+	OpCall                           // Pop Arg arguments and call the function of the node
+	OpEval                           // Push the value of the node evaluated by the evaluator
+)
+
+var opcodeNames = [...]string{
+	OpConst:            "CONST",
+	OpPath:             "PATH",
+	OpVar:              "VAR",
+	OpList:             "LIST",
+	OpMap:              "MAP",
+	OpUnary:            "UNARY",
+	OpBinary:           "BINARY",
+	OpIn:               "IN",
+	OpMatch:            "MATCH",
+	OpIndex:            "INDEX",
+	OpSlice:            "SLICE",
+	OpMember:           "MEMBER",
+	OpTest:             "TEST",
+	OpJump:             "JUMP",
+	OpJumpIfFalse:      "JUMP_IF_FALSE",
+	OpJumpIfFalseOrPop: "JUMP_IF_FALSE_OR_POP",
+	OpJumpIfTrueOrPop:  "JUMP_IF_TRUE_OR_POP",
+	OpBeginCall:        "BEGIN_CALL",
+	OpCall:             "CALL",
+	OpEval:             "EVAL",
+}
+
+// String returns the name of the opcode.
+func (op Opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("Opcode(%d)", op)
+}
+
+// Instruction is a single instruction of a program.
+type Instruction struct {
+	Op   Opcode
+	Arg  int32
+	Node int32 // Index of the node the instruction evaluates, for errors
+}
+
+// test is a value used as a condition: its description and, for the
+// operands of && and ||, the clause it reports to the clause recorder.
+type test struct {
+	what   string
+	clause ast.Expression
+}
+
+// Program is a compiled expression. A program is immutable and may be run
+// concurrently.
+type Program struct {
+	Instructions []Instruction
+
+	expr      ast.Expression
+	constants []types.Value
+	strings   []string
+	keys      [][]string
+	tests     []test
+	nodes     []ast.Expression
+	levels    []int // Nesting depth of each node
+	depth     int   // Maximum nesting depth of the translated nodes
+	stackSize int
+}
+
+// Compile compiles an expression to a program. Compilation does not fail:
+// nodes without an instruction are evaluated by the evaluator when the
+// program runs.
+func Compile(expr ast.Expression) *Program {
+	c := &compiler{program: &Program{expr: expr}}
+	c.compile(expr, 0)
+	return c.program
+}
+
+// String returns a listing of the instructions of the program.
+func (p *Program) String() string {
+	var b strings.Builder
+	for i, ins := range p.Instructions {
+		fmt.Fprintf(&b, "%04d %s", i, ins.Op)
+		switch ins.Op {
+		case OpConst, OpBeginCall, OpEval:
+			fmt.Fprintf(&b, " %s", p.nodes[ins.Node].String())
+			if ins.Op == OpBeginCall {
+				fmt.Fprintf(&b, " %d", ins.Arg)
+			}
+		case OpPath, OpVar, OpUnary, OpBinary, OpMember:
+			fmt.Fprintf(&b, " %s", p.strings[ins.Arg])
+		case OpMap:
+			fmt.Fprintf(&b, " %s", strings.Join(p.keys[ins.Arg], ", "))
+		case OpTest:
+			fmt.Fprintf(&b, " %s", p.tests[ins.Arg].what)
+		default:
+			if ins.Op != OpIndex {
+				fmt.Fprintf(&b, " %d", ins.Arg)
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+type compiler struct {
+	program *Program
+	stack   int // Values on the stack at the current instruction
+}
+
+// compile emits the instructions that push the value of node, nested level
+// levels deep in the expression.
+func (c *compiler) compile(node ast.Expression, level int) {
+	if level > c.program.depth {
+		c.program.depth = level
+	}
+	inner := level + 1
+
+	switch n := node.(type) {
+	case *ast.IntegerLiteral:
+		c.emitConst(types.Int(n.Value), node, level)
+	case *ast.FloatLiteral:
+		c.emitConst(types.Float(n.Value), node, level)
+	case *ast.DurationLiteral:
+		c.emitConst(types.Duration(n.Value), node, level)
+	case *ast.StringLiteral:
+		c.emitConst(types.String(n.Value), node, level)
+	case *ast.BooleanLiteral:
+		c.emitConst(types.Bool(n.Value), node, level)
+	case *ast.NullLiteral:
+		c.emitConst(types.Null(), node, level)
+
+	case *ast.JSONPathExpression:
+		c.emit(OpPath, c.addString(n.Path), node, level, 1)
+	case *ast.Identifier:
+		c.emit(OpVar, c.addString(n.Value), node, level, 1)
+
+	case *ast.ListLiteral:
+		for _, elem := range n.Elements {
+			c.compile(elem, inner)
+		}
+		c.emit(OpList, int32(len(n.Elements)), node, level, 1-len(n.Elements))
+
+	case *ast.MapLiteral:
+		for _, value := range n.Values {
+			c.compile(value, inner)
+		}
+		c.program.keys = append(c.program.keys, n.Keys)
+		c.emit(OpMap, int32(len(c.program.keys)-1), node, level, 1-len(n.Values))
+
+	case *ast.GroupedExpression:
+		c.compile(n.Expression, inner)
+
+	case *ast.UnaryExpression:
+		c.compile(n.Operand, inner)
+		c.emit(OpUnary, c.addString(n.Operator), node, level, 0)
+
+	case *ast.BinaryExpression:
+		switch n.Operator {
+		case "&&", "and", "AND":
+			c.compileLogical(n, OpJumpIfFalseOrPop, level)
+		case "||", "or", "OR":
+			c.compileLogical(n, OpJumpIfTrueOrPop, level)
+		default:
+			c.compile(n.Left, inner)
+			c.compile(n.Right, inner)
+			c.emit(OpBinary, c.addString(n.Operator), node, level, -1)
+		}
+
+	case *ast.InExpression:
+		c.compile(n.Left, inner)
+		c.compile(n.Right, inner)
+		c.emit(OpIn, flag(n.Negated), node, level, -1)
+
+	case *ast.RegexExpression:
+		c.compile(n.Left, inner)
+		c.compile(n.Pattern, inner)
+		c.emit(OpMatch, flag(n.Negated), node, level, -1)
+
+	case *ast.ConditionalExpression:
+		c.compile(n.Condition, inner)
+		c.emitTest("the condition of ?:", nil, node, level)
+		jumpToElse := c.emit(OpJumpIfFalse, 0, node, level, -1)
+		c.compile(n.Consequence, inner)
+		jumpToEnd := c.emit(OpJump, 0, node, level, -1)
+		c.patch(jumpToElse)
+		c.compile(n.Alternative, inner)
+		c.patch(jumpToEnd)
+
+	case *ast.CaseExpression:
+		var jumpsToEnd []int
+		for i, cond := range n.Conditions {
+			c.compile(cond, inner)
+			c.emitTest("a condition of case", nil, node, level)
+			jumpToNext := c.emit(OpJumpIfFalse, 0, node, level, -1)
+			c.compile(n.Results[i], inner)
+			jumpsToEnd = append(jumpsToEnd, c.emit(OpJump, 0, node, level, -1))
+			c.patch(jumpToNext)
+		}
+		if n.Default != nil {
+			c.compile(n.Default, inner)
+		} else {
+			c.emitConst(types.Null(), node, level)
+		}
+		for _, jump := range jumpsToEnd {
+			c.patch(jump)
+		}
+
+	case *ast.IndexExpression:
+		c.compile(n.Left, inner)
+		c.compile(n.Index, inner)
+		c.emit(OpIndex, 0, node, level, -1)
+
+	case *ast.SliceExpression:
+		c.compile(n.Left, inner)
+		var bounds int32
+		for i, bound := range []ast.Expression{n.Start, n.End} {
+			if bound != nil {
+				c.compile(bound, inner)
+				bounds |= 1 << i
+			}
+		}
+		c.emit(OpSlice, bounds, node, level, -popcount(bounds))
+
+	case *ast.MemberExpression:
+		c.compile(n.Object, inner)
+		c.emit(OpMember, c.addString(n.Property.Value), node, level, 0)
+
+	case *ast.FunctionCall:
+		c.compileCall(n, level)
+
+	default:
+		// Lambdas and unknown nodes raise their errors in the evaluator
+		c.emit(OpEval, 0, node, level, 1)
+	}
+}
+
+// compileLogical compiles && or || with short-circuit evaluation: the left
+// operand decides the result unless jump falls through to the right one.
+func (c *compiler) compileLogical(n *ast.BinaryExpression, jump Opcode, level int) {
+	c.compile(n.Left, level+1)
+	c.emitTest("the left operand of "+n.Operator, n.Left, n, level)
+	end := c.emit(jump, 0, n, level, -1)
+	c.compile(n.Right, level+1)
+	c.emitTest("the right operand of "+n.Operator, n.Right, n, level)
+	c.patch(end)
+}
+
+// compileCall compiles a function call. Calls with lambda arguments are
+// evaluated by the evaluator; so are the calls of lazy functions, which
+// OpBeginCall detects when the program runs.
+func (c *compiler) compileCall(call *ast.FunctionCall, level int) {
+	for _, arg := range call.Arguments {
+		if _, ok := arg.(*ast.LambdaExpression); ok {
+			c.emit(OpEval, 0, call, level, 1)
+			return
+		}
+	}
+
+	begin := c.emit(OpBeginCall, 0, call, level, 0)
+	for _, arg := range call.Arguments {
+		c.compile(arg, level+1)
+	}
+	c.emit(OpCall, int32(len(call.Arguments)), call, level, 1-len(call.Arguments))
+	c.patch(begin)
+}
+
+// emit appends an instruction that changes the number of values on the
+// stack by effect and returns its address.
+func (c *compiler) emit(op Opcode, arg int32, node ast.Expression, level, effect int) int {
+	p := c.program
+	p.nodes = append(p.nodes, node)
+	p.levels = append(p.levels, level)
+	p.Instructions = append(p.Instructions, Instruction{Op: op, Arg: arg, Node: int32(len(p.nodes) - 1)})
+
+	c.stack += effect
+	if c.stack > p.stackSize {
+		p.stackSize = c.stack
+	}
+	return len(p.Instructions) - 1
+}
+
+func (c *compiler) emitConst(v types.Value, node ast.Expression, level int) {
+	c.program.constants = append(c.program.constants, v)
+	c.emit(OpConst, int32(len(c.program.constants)-1), node, level, 1)
+}
+
+func (c *compiler) emitTest(what string, clause, node ast.Expression, level int) {
+	c.program.tests = append(c.program.tests, test{what: what, clause: clause})
+	c.emit(OpTest, int32(len(c.program.tests)-1), node, level, 0)
+}
+
+// patch points the jump at addr to the next instruction.
+func (c *compiler) patch(addr int) {
+	c.program.Instructions[addr].Arg = int32(len(c.program.Instructions))
+}
+
+func (c *compiler) addString(s string) int32 {
+	for i, existing := range c.program.strings {
+		if existing == s {
+			return int32(i)
+		}
+	}
+	c.program.strings = append(c.program.strings, s)
+	return int32(len(c.program.strings) - 1)
+}
+
+func flag(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func popcount(bits int32) int {
+	return int(bits&1 + bits>>1&1)
+}
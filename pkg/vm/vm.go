@@ -0,0 +1,189 @@
+// Package vm compiles AMEL expressions to bytecode and runs them on a
+// stack-based virtual machine.
+package vm
+
+import (
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/ast"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+// Run evaluates the program in ctx with the operators, functions, and limits
+// of the evaluator. It returns what the evaluator returns for the compiled
+// expression, including the positions of errors.
+func (p *Program) Run(e *eval.Evaluator, ctx *eval.EvalContext) (types.Value, error) {
+	cancel := e.Begin(ctx)
+	defer cancel()
+
+	// The evaluator reports the node that is nested too deeply
+	if maxDepth := e.MaxDepth(); maxDepth > 0 && p.depth >= maxDepth {
+		return e.Eval(p.expr, 0, ctx)
+	}
+
+	value, at, err := p.run(e, ctx)
+	if err != nil {
+		eval.Annotate(err, p.nodes[p.Instructions[at].Node])
+		return types.Null(), err
+	}
+	return value, nil
+}
+
+// run executes the instructions and returns the result, or the error and the
+// address of the instruction that raised it.
+func (p *Program) run(e *eval.Evaluator, ctx *eval.EvalContext) (types.Value, int, error) {
+	if err := ctx.CheckTimeout(); err != nil {
+		return types.Null(), 0, err
+	}
+
+	stack := make([]types.Value, 0, p.stackSize)
+	var err error
+	for pc := 0; pc < len(p.Instructions); pc++ {
+		ins := p.Instructions[pc]
+		top := len(stack) - 1
+
+		switch ins.Op {
+		case OpConst:
+			stack = append(stack, p.constants[ins.Arg])
+
+		case OpPath:
+			stack = append(stack, ctx.Lookup(p.strings[ins.Arg]))
+
+		case OpVar:
+			name := p.strings[ins.Arg]
+			val, ok := ctx.Variables[name]
+			if !ok {
+				return types.Null(), pc, errors.Newf(errors.ErrUndefinedVariable, "undefined variable: %s", name)
+			}
+			stack = append(stack, val)
+
+		case OpList:
+			n := len(stack) - int(ins.Arg)
+			elements := make([]types.Value, ins.Arg)
+			copy(elements, stack[n:])
+			stack = append(stack[:n], types.List(elements...))
+
+		case OpMap:
+			keys := p.keys[ins.Arg]
+			n := len(stack) - len(keys)
+			entries := make(map[string]types.Value, len(keys))
+			for i, key := range keys {
+				entries[key] = stack[n+i]
+			}
+			stack = append(stack[:n], types.Map(entries))
+
+		case OpUnary:
+			if stack[top], err = e.Unary(p.strings[ins.Arg], stack[top]); err != nil {
+				return types.Null(), pc, err
+			}
+
+		case OpBinary:
+			if stack[top-1], err = e.Binary(p.strings[ins.Arg], stack[top-1], stack[top]); err != nil {
+				return types.Null(), pc, err
+			}
+			stack = stack[:top]
+
+		case OpIn:
+			if stack[top-1], err = e.In(stack[top-1], stack[top], ins.Arg == 1, ctx); err != nil {
+				return types.Null(), pc, err
+			}
+			stack = stack[:top]
+
+		case OpMatch:
+			if stack[top-1], err = e.Match(stack[top-1], stack[top], ins.Arg == 1, ctx); err != nil {
+				return types.Null(), pc, err
+			}
+			stack = stack[:top]
+
+		case OpIndex:
+			if stack[top-1], err = e.Index(stack[top-1], stack[top]); err != nil {
+				return types.Null(), pc, err
+			}
+			stack = stack[:top]
+
+		case OpSlice:
+			var bounds [2]*types.Value
+			for i := 1; i >= 0; i-- {
+				if ins.Arg&(1<<i) != 0 {
+					bounds[i] = &stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+				}
+			}
+			top = len(stack) - 1
+			if stack[top], err = e.Slice(stack[top], bounds[0], bounds[1]); err != nil {
+				return types.Null(), pc, err
+			}
+
+		case OpMember:
+			if stack[top], err = e.Member(stack[top], p.strings[ins.Arg]); err != nil {
+				return types.Null(), pc, err
+			}
+
+		case OpTest:
+			t := p.tests[ins.Arg]
+			truthy, err := e.Condition(stack[top], t.what)
+			if err != nil {
+				return types.Null(), pc, err
+			}
+			if t.clause != nil {
+				truthy = ctx.RecordClause(t.clause, truthy)
+			}
+			stack[top] = types.Bool(truthy)
+
+		case OpJump:
+			pc = int(ins.Arg) - 1
+
+		case OpJumpIfFalse:
+			truthy, _ := stack[top].AsBool()
+			stack = stack[:top]
+			if !truthy {
+				pc = int(ins.Arg) - 1
+			}
+
+		case OpJumpIfFalseOrPop, OpJumpIfTrueOrPop:
+			truthy, _ := stack[top].AsBool()
+			if truthy == (ins.Op == OpJumpIfTrueOrPop) {
+				pc = int(ins.Arg) - 1
+			} else {
+				stack = stack[:top]
+			}
+
+		case OpBeginCall:
+			call := p.nodes[ins.Node].(*ast.FunctionCall)
+			if e.LazyCall(call.Name) {
+				val, err := e.Eval(call, p.levels[ins.Node], ctx)
+				if err != nil {
+					return types.Null(), pc, err
+				}
+				stack = append(stack, val)
+				pc = int(ins.Arg) - 1
+				continue
+			}
+			if err := ctx.CheckTimeout(); err != nil {
+				return types.Null(), pc, err
+			}
+			if err := e.BeginCall(call, ctx); err != nil {
+				return types.Null(), pc, err
+			}
+
+		case OpCall:
+			call := p.nodes[ins.Node].(*ast.FunctionCall)
+			n := len(stack) - int(ins.Arg)
+			args := make([]types.Value, ins.Arg)
+			copy(args, stack[n:])
+			val, err := e.Call(call.Name, args, ctx)
+			if err != nil {
+				return types.Null(), pc, err
+			}
+			stack = append(stack[:n], val)
+
+		case OpEval:
+			val, err := e.Eval(p.nodes[ins.Node], p.levels[ins.Node], ctx)
+			if err != nil {
+				return types.Null(), pc, err
+			}
+			stack = append(stack, val)
+		}
+	}
+	return stack[0], 0, nil
+}
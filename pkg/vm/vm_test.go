@@ -0,0 +1,182 @@
+// Package vm compiles AMEL expressions to bytecode and runs them on a
+// stack-based virtual machine.
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPayload = map[string]interface{}{
+	"user": map[string]interface{}{
+		"name":  "Alice",
+		"age":   30,
+		"email": "alice@example.com",
+		"tags":  []interface{}{"admin", "beta"},
+	},
+	"items": []interface{}{
+		map[string]interface{}{"price": 10.5, "qty": 2},
+		map[string]interface{}{"price": 3.0, "qty": 1},
+	},
+	"count": 3,
+	"zero":  0,
+}
+
+// run evaluates input with the evaluator and with a compiled program.
+func run(t *testing.T, evaluator *eval.Evaluator, input string) (want, got types.Value, wantErr, gotErr error) {
+	t.Helper()
+	expr, err := parser.Parse(input)
+	require.NoError(t, err, input)
+
+	ctx, err := eval.NewContext(testPayload)
+	require.NoError(t, err)
+	ctx.SetVariable("limit", types.Int(25))
+	wantVal, wantErr := evaluator.Evaluate(expr, ctx)
+
+	ctx, err = eval.NewContext(testPayload)
+	require.NoError(t, err)
+	ctx.SetVariable("limit", types.Int(25))
+	gotVal, gotErr := Compile(expr).Run(evaluator, ctx)
+	return wantVal, gotVal, wantErr, gotErr
+}
+
+func TestRunMatchesEvaluator(t *testing.T) {
+	evaluator, err := eval.New()
+	require.NoError(t, err)
+
+	inputs := []string{
+		`42`,
+		`1 + 2 * 3 - 4 / 2`,
+		`17 ~/ 5 + 17 % 5`,
+		`-$.count`,
+		`!true`,
+		`$.user.age >= 18 && $.user.name == "Alice"`,
+		`$.user.age < 18 && unknownFn()`,
+		`$.user.age > 18 || unknownFn()`,
+		`$.zero || $.count`,
+		`$.count > 5 ? "many" : "few"`,
+		`$.zero ? 1 : $.count ? 2 : 3`,
+		`case { $.zero => "zero"; $.count > 5 => "many"; else => "few" }`,
+		`case { $.count > 5 => 100 / $.zero }`,
+		`case { $.zero == 1 => 1 }`,
+		`"admin" IN $.user.tags`,
+		`"guest" NOT IN $.user.tags`,
+		`$.user.email =~ "@example\\.com$"`,
+		`$.user.email !~ "^bob"`,
+		`[1, 2, $.count][2]`,
+		`{"a": 1, "b": $.user.name}.b`,
+		`"hello"[1:3]`,
+		`[1, 2, 3, 4][:2]`,
+		`[1, 2, 3, 4][2:]`,
+		`len($.items) * 2 == 4 && upper($.user.name) == "ALICE"`,
+		`upper($.user.name)`,
+		`sum(map($.items, x => x.price * x.qty))`,
+		`filter($.user.tags, t => t != "beta")`,
+		`ifThenElse($.zero != 0, 100 / $.zero, -1)`,
+		`coalesce(null, $.missing, "fallback")`,
+		`limit * 2`,
+		`(($.count + 1) * 2)`,
+	}
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			want, got, wantErr, gotErr := run(t, evaluator, input)
+			require.NoError(t, wantErr)
+			require.NoError(t, gotErr)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	evaluator, err := eval.New(eval.WithStrictTypes(true), eval.WithMaxCalls(2))
+	require.NoError(t, err)
+
+	inputs := []string{
+		`1 + (2 / $.zero)`,
+		`$.user.name * 2`,
+		`undefinedVar + 1`,
+		`unknownFn(1)`,
+		`$.count && true`,
+		`$.count ? 1 : 2`,
+		`upper(lower(upper("a")))`,
+		`[1, 2][5]`,
+		`x => x`,
+		`(-9223372036854775807 - 1) ~/ -1`,
+	}
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			_, _, wantErr, gotErr := run(t, evaluator, input)
+			require.Error(t, wantErr)
+			require.Error(t, gotErr)
+			assert.Equal(t, wantErr.Error(), gotErr.Error())
+
+			want, ok := wantErr.(*errors.Error)
+			require.True(t, ok)
+			got, ok := gotErr.(*errors.Error)
+			require.True(t, ok)
+			assert.Equal(t, want.Code, got.Code)
+			assert.Equal(t, [4]int{want.Line, want.Column, want.EndLine, want.EndColumn},
+				[4]int{got.Line, got.Column, got.EndLine, got.EndColumn})
+			assert.Equal(t, want.Function, got.Function)
+			assert.Equal(t, want.Path, got.Path)
+		})
+	}
+}
+
+func TestRunMaxDepth(t *testing.T) {
+	evaluator, err := eval.New(eval.WithMaxDepth(3))
+	require.NoError(t, err)
+
+	_, got, _, gotErr := run(t, evaluator, `1 + 2`)
+	require.NoError(t, gotErr)
+	assert.Equal(t, types.Int(3), got)
+
+	_, _, wantErr, gotErr := run(t, evaluator, `1 + (2 * (3 - $.count))`)
+	require.Error(t, wantErr)
+	assert.Equal(t, wantErr, gotErr)
+}
+
+func TestCompileListing(t *testing.T) {
+	expr, err := parser.Parse(`$.a > 1 && upper($.b) == "X"`)
+	require.NoError(t, err)
+
+	listing := Compile(expr).String()
+	assert.Equal(t, []string{
+		"0000 PATH $.a",
+		"0001 CONST 1",
+		"0002 BINARY >",
+		"0003 TEST the left operand of &&",
+		"0004 JUMP_IF_FALSE_OR_POP 11",
+		"0005 BEGIN_CALL upper($.b) 8",
+		"0006 PATH $.b",
+		"0007 CALL 1",
+		"0008 CONST \"X\"",
+		"0009 BINARY ==",
+		"0010 TEST the right operand of &&",
+	}, strings.Split(strings.TrimSpace(listing), "\n"))
+}
+
+func BenchmarkRun(b *testing.B) {
+	evaluator, _ := eval.New()
+	ctx, _ := eval.NewContext(testPayload)
+	expr, _ := parser.Parse(`$.user.age >= 18 && "admin" IN $.user.tags && $.count * 2 + 1 > 5 ? "yes" : "no"`)
+	program := Compile(expr)
+
+	b.Run("evaluator", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			evaluator.Evaluate(expr, ctx)
+		}
+	})
+	b.Run("vm", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			program.Run(evaluator, ctx)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+//go:build js && wasm
+
+// Package wasm exposes the AMEL engine to JavaScript when built for WebAssembly.
+package wasm
+
+import (
+	"encoding/json"
+	"syscall/js"
+)
+
+// Register installs the bindings as a global JavaScript object with the methods
+// compile(dsl), evaluate(dsl, payload), explain(dsl, payload), and functions().
+// Payloads may be JavaScript values or JSON strings. Results are plain objects.
+func (b *Bindings) Register(name string) {
+	obj := js.Global().Get("Object").New()
+
+	obj.Set("compile", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return toJS(b.Compile(stringArg(args, 0)))
+	}))
+	obj.Set("evaluate", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return toJS(b.Evaluate(stringArg(args, 0), payloadArg(args, 1)))
+	}))
+	obj.Set("explain", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return toJS(b.Explain(stringArg(args, 0), payloadArg(args, 1)))
+	}))
+	obj.Set("functions", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return toJS(b.Functions())
+	}))
+
+	js.Global().Set(name, obj)
+}
+
+// stringArg returns argument i as a string, or "" if it is missing.
+func stringArg(args []js.Value, i int) string {
+	if i >= len(args) || args[i].Type() != js.TypeString {
+		return ""
+	}
+	return args[i].String()
+}
+
+// payloadArg returns argument i as a JSON document. Strings are passed through;
+// other values are serialized with JSON.stringify.
+func payloadArg(args []js.Value, i int) string {
+	if i >= len(args) {
+		return ""
+	}
+	switch args[i].Type() {
+	case js.TypeUndefined, js.TypeNull:
+		return ""
+	case js.TypeString:
+		return args[i].String()
+	default:
+		return js.Global().Get("JSON").Call("stringify", args[i]).String()
+	}
+}
+
+// toJS converts a Go value to a JavaScript value through JSON.
+func toJS(v interface{}) js.Value {
+	data, err := json.Marshal(v)
+	if err != nil {
+		obj := js.Global().Get("Object").New()
+		obj.Set("error", err.Error())
+		return obj
+	}
+	return js.Global().Get("JSON").Call("parse", string(data))
+}
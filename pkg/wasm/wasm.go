@@ -0,0 +1,93 @@
+// Package wasm exposes the AMEL engine to JavaScript when built for WebAssembly.
+//
+// The Bindings methods are plain Go and work on every platform; Register, which
+// installs them as a JavaScript object, is only available with GOOS=js GOARCH=wasm.
+// Build the module with:
+//
+//	GOOS=js GOARCH=wasm go build -o amel.wasm ./cmd/amel-wasm
+//
+// and load it with the wasm_exec.js support file shipped with Go:
+//
+//	const go = new Go();
+//	const { instance } = await WebAssembly.instantiateStreaming(fetch("amel.wasm"), go.importObject);
+//	go.run(instance);
+//	amel.evaluate("$.age >= 18", { age: 21 }); // { result: true, type: "bool" }
+//
+// Results are the same JSON structures the Go engine returns, so previews in a
+// web UI behave exactly like evaluation on the server.
+package wasm
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/engine"
+)
+
+// Bindings adapts an engine to the JSON-in, JSON-out calls used from JavaScript.
+type Bindings struct {
+	engine *engine.Engine
+}
+
+// New creates bindings for the given engine.
+func New(eng *engine.Engine) *Bindings {
+	return &Bindings{engine: eng}
+}
+
+// CompileResult is the result of Compile.
+type CompileResult struct {
+	Valid     bool   `json:"valid"`
+	Optimized string `json:"optimized,omitempty"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode int    `json:"errorCode,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+}
+
+// Compile validates an expression and returns its optimized form or the syntax
+// error with its position.
+func (b *Bindings) Compile(dsl string) *CompileResult {
+	compiled, err := b.engine.Compile(dsl)
+	if err != nil {
+		result := &CompileResult{Error: err.Error()}
+		if amelErr, ok := err.(*errors.Error); ok {
+			result.ErrorCode = int(amelErr.Code)
+			result.Line = amelErr.Line
+			result.Column = amelErr.Column
+		}
+		return result
+	}
+
+	result := &CompileResult{Valid: true}
+	if compiled.Optimized != nil {
+		result.Optimized = compiled.Optimized.String()
+	}
+	return result
+}
+
+// Evaluate evaluates an expression against a payload given as a JSON document.
+// An empty payload evaluates against null.
+func (b *Bindings) Evaluate(dsl, payloadJSON string) *engine.EvalResponse {
+	return b.engine.EvaluateRequest(&engine.EvalRequest{DSL: dsl, Payload: payload(payloadJSON)})
+}
+
+// Explain evaluates an expression and includes the explanation tree in the response.
+func (b *Bindings) Explain(dsl, payloadJSON string) *engine.EvalResponse {
+	return b.engine.ExplainRequest(&engine.EvalRequest{DSL: dsl, Payload: payload(payloadJSON)})
+}
+
+// Functions returns the names of the registered functions, sorted.
+func (b *Bindings) Functions() []string {
+	names := b.engine.ListFunctions()
+	sort.Strings(names)
+	return names
+}
+
+// payload converts a JSON document to an evaluation payload.
+func payload(payloadJSON string) interface{} {
+	if strings.TrimSpace(payloadJSON) == "" {
+		return nil
+	}
+	return payloadJSON
+}
@@ -0,0 +1,61 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/bencagri/amel/pkg/engine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBindings(t *testing.T) *Bindings {
+	t.Helper()
+
+	eng, err := engine.New()
+	require.NoError(t, err)
+	return New(eng)
+}
+
+func TestBindings_Compile(t *testing.T) {
+	b := newTestBindings(t)
+
+	result := b.Compile("$.age >= 10 + 8")
+	assert.True(t, result.Valid)
+	assert.NotEmpty(t, result.Optimized)
+
+	result = b.Compile("(1 +")
+	assert.False(t, result.Valid)
+	assert.NotEmpty(t, result.Error)
+	assert.NotZero(t, result.ErrorCode)
+	assert.Equal(t, 1, result.Line)
+}
+
+func TestBindings_Evaluate(t *testing.T) {
+	b := newTestBindings(t)
+
+	resp := b.Evaluate("$.age >= 18", `{"age": 21}`)
+	assert.Empty(t, resp.Error)
+	assert.Equal(t, true, resp.Result)
+
+	resp = b.Evaluate("1 + 2", "")
+	assert.Equal(t, int64(3), resp.Result)
+
+	resp = b.Evaluate("nope + 1", "")
+	assert.NotEmpty(t, resp.Error)
+	assert.NotZero(t, resp.ErrorCode)
+}
+
+func TestBindings_Explain(t *testing.T) {
+	b := newTestBindings(t)
+
+	resp := b.Explain("$.a > 1 && $.b", `{"a": 2, "b": true}`)
+	assert.Equal(t, true, resp.Result)
+	require.NotNil(t, resp.Explanation)
+	assert.Len(t, resp.Explanation.Children, 2)
+}
+
+func TestBindings_Functions(t *testing.T) {
+	names := newTestBindings(t).Functions()
+	assert.Contains(t, names, "max")
+	assert.IsIncreasing(t, names)
+}
@@ -0,0 +1,182 @@
+package wasmplugin
+
+import (
+	"bytes"
+)
+
+// testManifest is the manifest of the module built by testModule.
+const testManifest = `{"functions":[` +
+	`{"name":"echo","params":[{"name":"values","type":"any"}],"returns":"list","variadic":true,"description":"Returns its arguments as a list"},` +
+	`{"name":"fail","params":[],"returns":"any"},` +
+	`{"name":"spin","params":[],"returns":"any"}]}`
+
+const (
+	valuePrefix    = `{"value":`
+	errorDoc       = `{"error":"boom"}`
+	valuePrefixAt  = 0
+	errorDocAt     = 16
+	manifestAt     = 64
+	heapStart      = 4096
+	i32, i64       = 0x7f, 0x7e
+	funcExport     = 0x00
+	memoryExport   = 0x02
+	opEnd          = 0x0b
+	opLocalGet     = 0x20
+	opLocalSet     = 0x21
+	opGlobalGet    = 0x23
+	opGlobalSet    = 0x24
+	opI32Const     = 0x41
+	opI64Const     = 0x42
+	opI32Add       = 0x6a
+	opI64Or        = 0x84
+	opI64Shl       = 0x86
+	opI64ExtendU   = 0xad
+	opCall         = 0x10
+	opLoop         = 0x03
+	opBr           = 0x0c
+	opI32Store8    = 0x3a
+	blockTypeEmpty = 0x40
+)
+
+// testModule returns a plugin module, encoded by hand, that follows the ABI:
+//
+//	echo(values...)  returns its arguments as a list
+//	fail()           returns {"error": "boom"}
+//	spin()           loops forever
+//
+// amel_alloc is a bump allocator that never frees.
+func testModule() []byte {
+	var m bytes.Buffer
+	m.Write([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})
+
+	// Types: 0 (i32) -> i32, 1 () -> i64, 2 (i32, i32) -> i64
+	section(&m, 1, vector(
+		[]byte{0x60, 1, i32, 1, i32},
+		[]byte{0x60, 0, 1, i64},
+		[]byte{0x60, 2, i32, i32, 1, i64},
+	))
+
+	// Functions: amel_alloc, amel_manifest, echo, fail, spin
+	section(&m, 3, vector([]byte{0}, []byte{1}, []byte{2}, []byte{2}, []byte{2}))
+
+	// Memory: one page
+	section(&m, 5, vector([]byte{0x00, 1}))
+
+	// Global 0: the next free address
+	section(&m, 6, vector(concat([]byte{i32, 0x01, opI32Const}, sleb(heapStart), []byte{opEnd})))
+
+	section(&m, 7, vector(
+		export("memory", memoryExport, 0),
+		export(allocExport, funcExport, 0),
+		export(manifestExport, funcExport, 1),
+		export("echo", funcExport, 2),
+		export("fail", funcExport, 3),
+		export("spin", funcExport, 4),
+	))
+
+	alloc := []byte{
+		opGlobalGet, 0,
+		opGlobalGet, 0, opLocalGet, 0, opI32Add, opGlobalSet, 0,
+		opEnd,
+	}
+	manifest := concat([]byte{opI64Const}, sleb(manifestAt<<32|int64(len(testManifest))), []byte{opEnd})
+	echo := concat(
+		// out = amel_alloc(len + 10)
+		[]byte{opLocalGet, 1, opI32Const, 10, opI32Add, opCall, 0, opLocalSet, 2},
+		// memory.copy(out, valuePrefixAt, 9)
+		[]byte{opLocalGet, 2, opI32Const, valuePrefixAt, opI32Const, 9, 0xfc, 0x0a, 0, 0},
+		// memory.copy(out + 9, ptr, len)
+		[]byte{opLocalGet, 2, opI32Const, 9, opI32Add, opLocalGet, 0, opLocalGet, 1, 0xfc, 0x0a, 0, 0},
+		// out[9 + len] = '}'
+		[]byte{opLocalGet, 2, opI32Const, 9, opI32Add, opLocalGet, 1, opI32Add},
+		opI32ConstBytes('}'),
+		[]byte{opI32Store8, 0, 0},
+		// return out << 32 | (len + 10)
+		[]byte{opLocalGet, 2, opI64ExtendU, opI64Const, 32, opI64Shl},
+		[]byte{opLocalGet, 1, opI32Const, 10, opI32Add, opI64ExtendU, opI64Or},
+		[]byte{opEnd},
+	)
+	fail := concat([]byte{opI64Const}, sleb(errorDocAt<<32|int64(len(errorDoc))), []byte{opEnd})
+	spin := []byte{opLoop, blockTypeEmpty, opBr, 0, opEnd, opI64Const, 0, opEnd}
+
+	section(&m, 10, vector(
+		code(nil, alloc),
+		code(nil, manifest),
+		code([]byte{1, 1, i32}, echo),
+		code(nil, fail),
+		code(nil, spin),
+	))
+
+	section(&m, 11, vector(
+		data(valuePrefixAt, valuePrefix),
+		data(errorDocAt, errorDoc),
+		data(manifestAt, testManifest),
+	))
+
+	return m.Bytes()
+}
+
+func opI32ConstBytes(v int64) []byte {
+	return concat([]byte{opI32Const}, sleb(v))
+}
+
+func section(m *bytes.Buffer, id byte, content []byte) {
+	m.WriteByte(id)
+	m.Write(uleb(uint64(len(content))))
+	m.Write(content)
+}
+
+func vector(items ...[]byte) []byte {
+	return concat(append([][]byte{uleb(uint64(len(items)))}, items...)...)
+}
+
+func export(name string, kind byte, index int) []byte {
+	return concat(uleb(uint64(len(name))), []byte(name), []byte{kind}, uleb(uint64(index)))
+}
+
+// code encodes a function body. locals holds the encoded local declarations,
+// nil for none.
+func code(locals, body []byte) []byte {
+	if locals == nil {
+		locals = []byte{0}
+	}
+	fn := concat(locals, body)
+	return concat(uleb(uint64(len(fn))), fn)
+}
+
+func data(offset int64, content string) []byte {
+	return concat([]byte{0x00, opI32Const}, sleb(offset), []byte{opEnd}, uleb(uint64(len(content))), []byte(content))
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func uleb(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+		return append(out, b)
+	}
+}
+
+func sleb(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
@@ -0,0 +1,428 @@
+// Package wasmplugin loads AMEL functions from WebAssembly modules.
+//
+// A plugin is a WebAssembly module, written in any language that compiles to
+// WebAssembly, that exports:
+//
+//	memory                              the linear memory
+//	amel_alloc(size i32) -> i32         allocates size bytes and returns their address
+//	amel_manifest() -> i64              returns the manifest
+//	<function>(ptr i32, len i32) -> i64 one export per function in the manifest
+//
+// Values cross the boundary as UTF-8 JSON. A function receives its arguments
+// as a JSON array written by the host into memory obtained from amel_alloc,
+// and returns the address and length of a JSON result packed into an i64 as
+// (address << 32) | length. The result is either {"value": <value>} or
+// {"error": "<message>"}. amel_manifest returns a JSON document in the same
+// way:
+//
+//	{"functions": [{
+//	    "name": "riskBand",
+//	    "params": [{"name": "score", "type": "float", "description": "..."}],
+//	    "returns": "string",
+//	    "variadic": false,
+//	    "description": "...",
+//	    "examples": ["riskBand($.score) == \"high\""]
+//	}]}
+//
+// Type names are those of the types package: int, float, string, bool, list,
+// and any. Plugins run without access to the file system, network, clock, or
+// environment; WASI imports are provided for language runtimes that need
+// them, but only with those capabilities removed. A reactor module's
+// _initialize function is called when an instance is created.
+package wasmplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/types"
+)
+
+const (
+	allocExport    = "amel_alloc"
+	manifestExport = "amel_manifest"
+
+	defaultMemoryLimitPages = 256 // 16MB
+	defaultMaxInstances     = 4
+	defaultMaxResultBytes   = 1 << 20 // 1MB
+)
+
+// Config limits the resources of a plugin.
+type Config struct {
+	// MemoryLimitPages limits the linear memory of each instance, in 64KB
+	// pages. Defaults to 256 (16MB).
+	MemoryLimitPages uint32
+	// MaxInstances is the number of instances kept for concurrent calls.
+	// Defaults to 4. More instances are created under load and discarded
+	// after use.
+	MaxInstances int
+	// MaxResultBytes limits the size of a result document. Defaults to 1MB.
+	MaxResultBytes uint32
+	// Timeout limits the execution time of each call, including the creation
+	// of an instance, like SandboxConfig.Timeout for JavaScript. WebAssembly
+	// has no instruction budget, so a runaway loop is stopped by time. Zero
+	// means calls run until the evaluation context is done.
+	Timeout time.Duration
+}
+
+// Manifest describes the functions of a plugin.
+type Manifest struct {
+	Functions []FunctionSpec `json:"functions"`
+}
+
+// FunctionSpec describes a plugin function.
+type FunctionSpec struct {
+	Name        string      `json:"name"`
+	Params      []ParamSpec `json:"params"`
+	Returns     string      `json:"returns"`
+	Variadic    bool        `json:"variadic,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Examples    []string    `json:"examples,omitempty"`
+}
+
+// ParamSpec describes a parameter of a plugin function.
+type ParamSpec struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+// Plugin is a loaded WebAssembly module.
+type Plugin struct {
+	name     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	config   Config
+	manifest Manifest
+
+	mu        sync.Mutex
+	instances []api.Module // Idle instances
+	closed    bool
+}
+
+// Load compiles a plugin and reads its manifest. The functions are not
+// registered until Register is called. name identifies the plugin in errors
+// and becomes the category of its functions.
+func Load(ctx context.Context, name string, wasm []byte, config Config) (*Plugin, error) {
+	if config.MemoryLimitPages == 0 {
+		config.MemoryLimitPages = defaultMemoryLimitPages
+	}
+	if config.MaxInstances <= 0 {
+		config.MaxInstances = defaultMaxInstances
+	}
+	if config.MaxResultBytes == 0 {
+		config.MaxResultBytes = defaultMaxResultBytes
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(config.MemoryLimitPages).
+		WithCloseOnContextDone(true))
+
+	p := &Plugin{name: name, runtime: runtime, config: config}
+	if err := p.load(ctx, wasm); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Plugin) load(ctx context.Context, wasm []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+		return p.errorf(errors.ErrSandboxViolation, "cannot provide WASI: %v", err)
+	}
+
+	compiled, err := p.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return p.errorf(errors.ErrInvalidSyntax, "invalid module: %v", err)
+	}
+	p.compiled = compiled
+
+	exports := compiled.ExportedFunctions()
+	for _, name := range []string{allocExport, manifestExport} {
+		if _, ok := exports[name]; !ok {
+			return p.errorf(errors.ErrInvalidSyntax, "module does not export %s", name)
+		}
+	}
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok {
+		return p.errorf(errors.ErrInvalidSyntax, "module does not export its memory")
+	}
+
+	mod, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := p.read(ctx, mod, manifestExport)
+	p.release(ctx, mod, err)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &p.manifest); err != nil {
+		return p.errorf(errors.ErrInvalidSyntax, "invalid manifest: %v", err)
+	}
+	for _, spec := range p.manifest.Functions {
+		if _, ok := exports[spec.Name]; !ok {
+			return p.errorf(errors.ErrInvalidSyntax, "manifest lists '%s', which the module does not export", spec.Name)
+		}
+		for _, param := range spec.Params {
+			if types.ParseType(param.Type) == types.TypeUnknown {
+				return p.errorf(errors.ErrInvalidSyntax, "function '%s': unknown type '%s'", spec.Name, param.Type)
+			}
+		}
+		if spec.Returns != "" && types.ParseType(spec.Returns) == types.TypeUnknown {
+			return p.errorf(errors.ErrInvalidSyntax, "function '%s': unknown type '%s'", spec.Name, spec.Returns)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the plugin.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Manifest returns the manifest of the plugin.
+func (p *Plugin) Manifest() Manifest {
+	return p.manifest
+}
+
+// Register registers the functions of the plugin in r. It fails without
+// registering anything if a function name is already taken.
+func (p *Plugin) Register(r *functions.Registry) error {
+	for _, spec := range p.manifest.Functions {
+		if r.Has(spec.Name) {
+			return p.errorf(errors.ErrInvalidSyntax, "function '%s' is already registered", spec.Name)
+		}
+	}
+
+	for _, spec := range p.manifest.Functions {
+		name := spec.Name
+		call := func(ctx context.Context, _ functions.EvalContext, args ...types.Value) (types.Value, error) {
+			return p.Call(ctx, name, args...)
+		}
+		if err := r.RegisterContextual(name, call, p.signature(spec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signature builds the function signature of a manifest entry.
+func (p *Plugin) signature(spec FunctionSpec) *types.FunctionSignature {
+	params := make([]types.ParameterDef, len(spec.Params))
+	for i, param := range spec.Params {
+		params[i] = types.DescribedParam(param.Name, types.ParseType(param.Type), param.Description)
+	}
+
+	returns := types.TypeAny
+	if spec.Returns != "" {
+		returns = types.ParseType(spec.Returns)
+	}
+
+	sig := types.NewFunctionSignature(spec.Name, returns, params...)
+	sig.Variadic = spec.Variadic
+	return sig.WithCategory(p.name).WithDescription(spec.Description).WithExamples(spec.Examples...)
+}
+
+// Call calls a plugin function. Errors reported by the plugin and traps have
+// code ErrFunctionPanic; if ctx is done or Config.Timeout expires first the
+// error has code ErrTimeout.
+func (p *Plugin) Call(ctx context.Context, name string, args ...types.Value) (types.Value, error) {
+	input, err := json.Marshal(toJSON(types.List(args...)))
+	if err != nil {
+		return types.Null(), errors.Wrap(errors.ErrArgumentType, fmt.Sprintf("cannot pass arguments to '%s': %v", name, err), err)
+	}
+
+	callCtx := ctx
+	if p.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, p.config.Timeout)
+		defer cancel()
+	}
+
+	mod, err := p.acquire(callCtx)
+	if err == nil {
+		var data []byte
+		data, err = p.callWithInput(callCtx, mod, name, input)
+		p.release(callCtx, mod, err)
+		if err == nil {
+			return p.decode(name, data)
+		}
+	}
+	if ctx.Err() != nil {
+		return types.Null(), errors.New(errors.ErrTimeout, "evaluation timed out")
+	}
+	if callCtx.Err() != nil {
+		return types.Null(), p.errorf(errors.ErrTimeout, "function '%s' exceeded its time limit of %v", name, p.config.Timeout)
+	}
+	return types.Null(), err
+}
+
+// decode converts the result document of a function to a value.
+func (p *Plugin) decode(name string, data []byte) (types.Value, error) {
+
+	var result struct {
+		Value *json.RawMessage `json:"value"`
+		Error string           `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return types.Null(), p.errorf(errors.ErrFunctionPanic, "function '%s' returned invalid JSON: %v", name, err)
+	}
+	if result.Error != "" {
+		return types.Null(), p.errorf(errors.ErrFunctionPanic, "function '%s' failed: %s", name, result.Error)
+	}
+	if result.Value == nil {
+		return types.Null(), nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(*result.Value, &value); err != nil {
+		return types.Null(), p.errorf(errors.ErrFunctionPanic, "function '%s' returned invalid JSON: %v", name, err)
+	}
+	return fromJSON(value), nil
+}
+
+// Close releases the plugin. Its functions fail once it is closed.
+func (p *Plugin) Close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.instances = nil
+	p.mu.Unlock()
+	return p.runtime.Close(ctx)
+}
+
+// callWithInput copies input into the instance and calls a function with it.
+func (p *Plugin) callWithInput(ctx context.Context, mod api.Module, name string, input []byte) ([]byte, error) {
+	results, err := mod.ExportedFunction(allocExport).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, p.errorf(errors.ErrFunctionPanic, "%s failed: %v", allocExport, err)
+	}
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, input) {
+		return nil, p.errorf(errors.ErrSandboxViolation, "%s returned memory out of range", allocExport)
+	}
+
+	fn := mod.ExportedFunction(name)
+	if fn == nil {
+		return nil, p.errorf(errors.ErrUndefinedFunction, "module does not export '%s'", name)
+	}
+	results, err = fn.Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, p.errorf(errors.ErrFunctionPanic, "function '%s' trapped: %v", name, err)
+	}
+	return p.result(mod, name, results)
+}
+
+// read calls a function without arguments that returns a document.
+func (p *Plugin) read(ctx context.Context, mod api.Module, name string) ([]byte, error) {
+	results, err := mod.ExportedFunction(name).Call(ctx)
+	if err != nil {
+		return nil, p.errorf(errors.ErrFunctionPanic, "%s trapped: %v", name, err)
+	}
+	return p.result(mod, name, results)
+}
+
+// result copies the document a function returned out of the instance memory.
+func (p *Plugin) result(mod api.Module, name string, results []uint64) ([]byte, error) {
+	if len(results) != 1 {
+		return nil, p.errorf(errors.ErrFunctionPanic, "function '%s' must return a single i64", name)
+	}
+	ptr, size := uint32(results[0]>>32), uint32(results[0])
+	if size > p.config.MaxResultBytes {
+		return nil, p.errorf(errors.ErrMemoryLimit, "function '%s' returned %d bytes, more than %d", name, size, p.config.MaxResultBytes)
+	}
+	data, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return nil, p.errorf(errors.ErrSandboxViolation, "function '%s' returned memory out of range", name)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// acquire returns an idle instance or creates one.
+func (p *Plugin) acquire(ctx context.Context) (api.Module, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, p.errorf(errors.ErrSandboxViolation, "plugin is closed")
+	}
+	if n := len(p.instances); n > 0 {
+		mod := p.instances[n-1]
+		p.instances = p.instances[:n-1]
+		p.mu.Unlock()
+		return mod, nil
+	}
+	p.mu.Unlock()
+
+	// Instances are anonymous so that several can coexist; reactor modules
+	// are initialized with _initialize, and nothing else is granted.
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errors.New(errors.ErrTimeout, "evaluation timed out")
+		}
+		return nil, p.errorf(errors.ErrSandboxViolation, "cannot instantiate module: %v", err)
+	}
+	return mod, nil
+}
+
+// release returns an instance to the pool. Instances that failed may be in an
+// inconsistent state and are discarded.
+func (p *Plugin) release(ctx context.Context, mod api.Module, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil || p.closed || len(p.instances) >= p.config.MaxInstances {
+		mod.Close(context.WithoutCancel(ctx))
+		return
+	}
+	p.instances = append(p.instances, mod)
+}
+
+func (p *Plugin) errorf(code errors.ErrorCode, format string, args ...interface{}) error {
+	return errors.Newf(code, "plugin '%s': %s", p.name, fmt.Sprintf(format, args...))
+}
+
+// toJSON converts a value to a structure encoding/json can marshal.
+func toJSON(v types.Value) interface{} {
+	if list, ok := v.AsList(); ok {
+		elements := make([]interface{}, len(list))
+		for i, elem := range list {
+			elements[i] = toJSON(elem)
+		}
+		return elements
+	}
+	return v.Raw
+}
+
+// fromJSON converts a decoded JSON document to a value. Whole numbers become
+// integers; objects are kept as maps.
+func fromJSON(v interface{}) types.Value {
+	switch val := v.(type) {
+	case float64:
+		if val == float64(int64(val)) {
+			return types.Int(int64(val))
+		}
+		return types.Float(val)
+	case []interface{}:
+		elements := make([]types.Value, len(val))
+		for i, elem := range val {
+			elements[i] = fromJSON(elem)
+		}
+		return types.List(elements...)
+	case map[string]interface{}:
+		return types.Any(val)
+	default:
+		return types.NewValue(val)
+	}
+}
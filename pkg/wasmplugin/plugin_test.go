@@ -0,0 +1,132 @@
+package wasmplugin
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bencagri/amel/internal/errors"
+	"github.com/bencagri/amel/pkg/eval"
+	"github.com/bencagri/amel/pkg/functions"
+	"github.com/bencagri/amel/pkg/parser"
+	"github.com/bencagri/amel/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestPlugin(t *testing.T) *Plugin {
+	t.Helper()
+	p, err := Load(context.Background(), "test", testModule(), Config{MaxInstances: 2})
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close(context.Background()) })
+	return p
+}
+
+func TestLoad(t *testing.T) {
+	p := loadTestPlugin(t)
+	assert.Equal(t, "test", p.Name())
+
+	manifest := p.Manifest()
+	require.Len(t, manifest.Functions, 3)
+	assert.Equal(t, "echo", manifest.Functions[0].Name)
+	assert.True(t, manifest.Functions[0].Variadic)
+
+	_, err := Load(context.Background(), "bad", []byte("not wasm"), Config{})
+	assert.True(t, errors.IsCode(err, errors.ErrInvalidSyntax), err)
+}
+
+func TestPlugin_Register(t *testing.T) {
+	p := loadTestPlugin(t)
+
+	registry, err := functions.NewDefaultRegistry()
+	require.NoError(t, err)
+	require.NoError(t, p.Register(registry))
+
+	doc, ok := registry.Describe("echo")
+	require.True(t, ok)
+	assert.Equal(t, "test", doc.Category)
+	assert.Equal(t, "Returns its arguments as a list", doc.Description)
+
+	evaluator, err := eval.New(eval.WithFunctions(registry), eval.WithTimeout(time.Second))
+	require.NoError(t, err)
+	ctx, err := eval.NewContext(map[string]interface{}{"name": "amel", "score": 0.5})
+	require.NoError(t, err)
+
+	evaluate := func(input string) (types.Value, error) {
+		expr, err := parser.Parse(input)
+		require.NoError(t, err)
+		return evaluator.Evaluate(expr, ctx)
+	}
+
+	result, err := evaluate(`echo($.name, $.score, 3, [true, null])`)
+	require.NoError(t, err)
+	assert.Equal(t, types.List(
+		types.String("amel"), types.Float(0.5), types.Int(3),
+		types.List(types.Bool(true), types.Null()),
+	), result)
+
+	result, err = evaluate(`len(echo(1, 2)) == 2`)
+	require.NoError(t, err)
+	assert.Equal(t, true, result.Raw)
+
+	_, err = evaluate(`fail()`)
+	assert.True(t, errors.IsCode(err, errors.ErrFunctionPanic), err)
+	assert.Contains(t, err.Error(), "boom")
+
+	// Names are not registered twice
+	assert.Error(t, p.Register(registry))
+}
+
+func TestPlugin_Timeout(t *testing.T) {
+	p := loadTestPlugin(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := p.Call(ctx, "spin")
+	assert.True(t, errors.IsCode(err, errors.ErrTimeout), err)
+
+	// The interrupted instance is discarded; later calls work
+	result, err := p.Call(context.Background(), "echo", types.Int(1))
+	require.NoError(t, err)
+	assert.Equal(t, types.List(types.Int(1)), result)
+}
+
+func TestPlugin_CallTimeout(t *testing.T) {
+	p, err := Load(context.Background(), "test", testModule(), Config{Timeout: 20 * time.Millisecond})
+	require.NoError(t, err)
+	defer p.Close(context.Background())
+
+	_, err = p.Call(context.Background(), "spin")
+	assert.True(t, errors.IsCode(err, errors.ErrTimeout), err)
+	assert.Contains(t, err.Error(), "time limit")
+
+	result, err := p.Call(context.Background(), "echo", types.Int(1))
+	require.NoError(t, err)
+	assert.Equal(t, types.List(types.Int(1)), result)
+}
+
+func TestPlugin_Concurrent(t *testing.T) {
+	p := loadTestPlugin(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := p.Call(context.Background(), "echo", types.Int(int64(i)))
+			assert.NoError(t, err)
+			assert.Equal(t, types.List(types.Int(int64(i))), result)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPlugin_Close(t *testing.T) {
+	p, err := Load(context.Background(), "test", testModule(), Config{})
+	require.NoError(t, err)
+	require.NoError(t, p.Close(context.Background()))
+
+	_, err = p.Call(context.Background(), "echo")
+	assert.True(t, errors.IsCode(err, errors.ErrSandboxViolation), err)
+}